@@ -0,0 +1,147 @@
+// Command attest creates a fake Nitro Enclaves attestation authority and signs
+// attestation documents with it, for use with kms -attestation-root.
+//
+//	attest init -cert root.pem -key root-key.pem
+//	attest sign -cert root.pem -key root-key.pem -public-key enclave.pem -pcr 0=<hex> > doc.b64
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/fernomac/aws-local/pkg/attestation"
+)
+
+// pcrFlag collects repeated -pcr index=hex flags.
+type pcrFlag map[int][]byte
+
+func (p pcrFlag) String() string {
+	return fmt.Sprint(map[int][]byte(p))
+}
+
+func (p pcrFlag) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("expected index=hex, got %q", value)
+	}
+	index, err := strconv.Atoi(parts[0])
+	if err != nil || index < 0 || index > 31 {
+		return fmt.Errorf("bad PCR index %q", parts[0])
+	}
+	b, err := hex.DecodeString(parts[1])
+	if err != nil {
+		return err
+	}
+	p[index] = b
+	return nil
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: attest init|sign [flags]")
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	switch os.Args[1] {
+	case "init":
+		initAuthority(os.Args[2:])
+	case "sign":
+		sign(os.Args[2:])
+	default:
+		usage()
+	}
+}
+
+func initAuthority(args []string) {
+	flags := flag.NewFlagSet("init", flag.ExitOnError)
+	certFile := flags.String("cert", "root.pem", "where to write the root certificate")
+	keyFile := flags.String("key", "root-key.pem", "where to write the root key")
+	flags.Parse(args)
+
+	authority, err := attestation.NewAuthority()
+	if err != nil {
+		log.Fatal(err)
+	}
+	keyPEM, err := authority.KeyPEM()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(*certFile, authority.CertPEM(), 0644); err != nil {
+		log.Fatal(err)
+	}
+	if err := ioutil.WriteFile(*keyFile, keyPEM, 0600); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func sign(args []string) {
+	pcrs := pcrFlag{}
+
+	flags := flag.NewFlagSet("sign", flag.ExitOnError)
+	certFile := flags.String("cert", "root.pem", "the root certificate")
+	keyFile := flags.String("key", "root-key.pem", "the root key")
+	publicKey := flags.String("public-key", "", "PEM or DER file holding the enclave's RSA public key")
+	moduleID := flags.String("module-id", "", "the enclave module ID")
+	userData := flags.String("user-data", "", "user data to include")
+	nonce := flags.String("nonce", "", "nonce to include")
+	flags.Var(pcrs, "pcr", "a PCR value as index=hex; may be repeated")
+	flags.Parse(args)
+
+	certPEM, err := ioutil.ReadFile(*certFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	keyPEM, err := ioutil.ReadFile(*keyFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	authority, err := attestation.LoadAuthority(certPEM, keyPEM)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	doc := &attestation.Document{
+		ModuleID: *moduleID,
+		PCRs:     pcrs,
+	}
+
+	if *publicKey != "" {
+		der, err := ioutil.ReadFile(*publicKey)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if block, _ := pem.Decode(der); block != nil {
+			der = block.Bytes
+		}
+		if _, err := attestation.ParseRSAPublicKey(der); err != nil {
+			log.Fatal(err)
+		}
+		doc.PublicKey = der
+	}
+	if *userData != "" {
+		doc.UserData = []byte(*userData)
+	}
+	if *nonce != "" {
+		doc.Nonce = []byte(*nonce)
+	}
+
+	signed, err := authority.Sign(doc)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Println(base64.StdEncoding.EncodeToString(signed))
+}
@@ -0,0 +1,202 @@
+// Command aws-local serves all the service fakes from a single endpoint,
+// sharing one KMS store between them.
+package main
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fernomac/aws-local/pkg/audit"
+	"github.com/fernomac/aws-local/pkg/common"
+	"github.com/fernomac/aws-local/pkg/dynamodb"
+	"github.com/fernomac/aws-local/pkg/events"
+	"github.com/fernomac/aws-local/pkg/gateway"
+	"github.com/fernomac/aws-local/pkg/identity"
+	"github.com/fernomac/aws-local/pkg/kinesis"
+	"github.com/fernomac/aws-local/pkg/kms"
+	"github.com/fernomac/aws-local/pkg/logs"
+	"github.com/fernomac/aws-local/pkg/metrics"
+	"github.com/fernomac/aws-local/pkg/s3"
+	"github.com/fernomac/aws-local/pkg/secretsmanager"
+	"github.com/fernomac/aws-local/pkg/sns"
+	"github.com/fernomac/aws-local/pkg/sqs"
+	"github.com/fernomac/aws-local/pkg/ssm"
+	"github.com/fernomac/aws-local/pkg/sts"
+)
+
+func main() {
+	if err := run(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// run serves everything until either listener fails. It returns rather than
+// exiting so that the audit log file is closed on the way out.
+func run() error {
+	addr := flag.String("addr", "localhost:4566", "address to listen on")
+	adminAddr := flag.String("admin-addr", "localhost:4567", "address to serve /admin/* and /metrics on")
+	auditLog := flag.String("audit-log", "", "where to write audit events: empty for nowhere, '-' for stdout, or a file path")
+	auditMaxSize := flag.Int64("audit-max-size", 100<<20, "rotate the audit log file once it exceeds this many bytes")
+	auditBackups := flag.Int("audit-backups", 5, "number of rotated audit log files to keep")
+	auditRing := flag.Int("audit-ring", 10000, "number of recent audit events to keep in memory")
+	attestationRoot := flag.String("attestation-root", "", "PEM file of root certificates that Nitro Enclaves attestation documents must chain up to")
+	strictContext := flag.Bool("strict-encryption-context", false, "reject KMS calls that leave out encryption context keys their key requires")
+	requiredContext := flag.String("required-encryption-context", "", "JSON file mapping key IDs, ARNs or alias names to the encryption context keys they require in strict mode")
+	s3Dir := flag.String("s3-dir", filepath.Join(os.TempDir(), "aws-local-s3"), "directory to keep S3 object data in")
+	snsInbox := flag.Int("sns-inbox", 1000, "number of recent SNS deliveries to the 'inbox' sink to keep in memory")
+	eventsInbox := flag.Int("events-inbox", 1000, "number of recent EventBridge deliveries to the 'inbox' sink to keep in memory")
+	roles := flag.String("roles", "", "JSON file of roles that need an external ID or allow longer sessions")
+	issuers := flag.String("oidc-issuers", "", "JSON file of OpenID Connect issuers whose tokens AssumeRoleWithWebIdentity accepts")
+	flag.Parse()
+
+	ring := audit.NewRing(*auditRing)
+	sinks := []audit.Sink{ring}
+
+	switch *auditLog {
+	case "":
+	case "-":
+		sinks = append(sinks, audit.NewWriterSink(os.Stdout))
+	default:
+		file, err := audit.NewFileSink(*auditLog, *auditMaxSize, *auditBackups)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		sinks = append(sinks, file)
+	}
+
+	registry := metrics.NewRegistry()
+	observers := []common.Observer{audit.NewTrail(sinks...), metrics.NewCallMetrics(registry)}
+
+	kmsOpts := []kms.Option{}
+	if *attestationRoot != "" {
+		pem, err := ioutil.ReadFile(*attestationRoot)
+		if err != nil {
+			return err
+		}
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in %v", *attestationRoot)
+		}
+		kmsOpts = append(kmsOpts, kms.WithAttestationRoots(roots))
+	}
+	if *strictContext {
+		required := map[string][]string{}
+		if *requiredContext != "" {
+			if err := readJSON(*requiredContext, &required); err != nil {
+				return err
+			}
+		}
+		kmsOpts = append(kmsOpts, kms.WithStrictEncryptionContext(required))
+	}
+
+	contexts := kms.NewContextLog()
+	kmsOpts = append(kmsOpts, kms.WithContextLog(contexts))
+	kmsStore := kms.New(kmsOpts...)
+	kms.RegisterMetrics(registry, kmsStore)
+
+	secrets := secretsmanager.New(kmsStore)
+	parameters := ssm.New(kmsStore)
+	tables := dynamodb.New(kmsStore)
+	logGroups := logs.New(kmsStore)
+	streams := kinesis.New(kmsStore)
+	queues := sqs.New(kmsStore, sqs.WithEndpoint("http://"+*addr))
+	inbox := sns.NewInbox(*snsInbox)
+	topics := sns.New(kmsStore, sns.WithQueues(queues), sns.WithSink("inbox", inbox), sns.WithEndpoint("http://"+*addr))
+	inbox.ConfirmWith(topics)
+	objects, err := s3.New(kmsStore, *s3Dir, s3.WithEndpoint("http://"+*addr))
+	if err != nil {
+		return err
+	}
+	ruleInbox := events.NewInbox(*eventsInbox)
+	buses := events.New(events.WithQueues(queues), events.WithSink("inbox", ruleInbox))
+	events.StartScheduler(buses, time.Second)
+
+	credentials := identity.NewRegistry(nil)
+	stsOpts := []sts.Option{}
+	if *roles != "" {
+		config := []sts.Role{}
+		if err := readJSON(*roles, &config); err != nil {
+			return err
+		}
+		for _, role := range config {
+			stsOpts = append(stsOpts, sts.WithRole(role))
+		}
+	}
+	if *issuers != "" {
+		config := []struct {
+			URL           string   `json:"url"`
+			ClientIDs     []string `json:"clientIds"`
+			PublicKeyFile string   `json:"publicKeyFile"`
+		}{}
+		if err := readJSON(*issuers, &config); err != nil {
+			return err
+		}
+		for _, issuer := range config {
+			pem, err := ioutil.ReadFile(issuer.PublicKeyFile)
+			if err != nil {
+				return err
+			}
+			keys, err := sts.ParsePublicKeys(pem)
+			if err != nil {
+				return fmt.Errorf("reading %v: %v", issuer.PublicKeyFile, err)
+			}
+			stsOpts = append(stsOpts, sts.WithIssuer(sts.Issuer{URL: issuer.URL, ClientIDs: issuer.ClientIDs, Keys: keys}))
+		}
+	}
+	tokens := sts.New(credentials, stsOpts...)
+
+	gw := gateway.New()
+	gw.Handle("kms", kms.NewHandler(kmsStore, observers...), "TrentService")
+	gw.Handle("secretsmanager", secretsmanager.NewHandler(secrets, observers...), "secretsmanager")
+	gw.Handle("ssm", ssm.NewHandler(parameters, observers...), "AmazonSSM")
+	gw.Handle("dynamodb", dynamodb.NewHandler(tables, observers...), "DynamoDB_20120810")
+	gw.Handle("logs", logs.NewHandler(logGroups, observers...), "Logs_20140328")
+	gw.Handle("kinesis", kinesis.NewHandler(streams, observers...), "Kinesis_20131202")
+
+	sqsHandler := sqs.NewHandler(queues, observers...)
+	gw.Handle("sqs", sqsHandler, "AmazonSQS")
+	gw.HandleVersion(sqs.Version, sqsHandler)
+
+	snsHandler := sns.NewHandler(topics, observers...)
+	gw.Handle("sns", snsHandler)
+	gw.HandleVersion(sns.Version, snsHandler)
+
+	gw.Handle("s3", s3.NewHandler(objects, observers...))
+	gw.Handle("events", events.NewHandler(buses, observers...), "AWSEvents")
+
+	stsHandler := sts.NewHandler(tokens, credentials, observers...)
+	gw.Handle("sts", stsHandler)
+	gw.HandleVersion(sts.Version, stsHandler)
+
+	admin := http.NewServeMux()
+	admin.Handle("/admin/audit", ring)
+	admin.Handle("/admin/encryption-contexts", contexts)
+	admin.Handle("/admin/sns-inbox", inbox)
+	admin.Handle("/admin/events-inbox", ruleInbox)
+	admin.Handle("/metrics", registry)
+
+	errs := make(chan error, 2)
+	go func() { errs <- http.ListenAndServe(*adminAddr, admin) }()
+	go func() { errs <- http.ListenAndServe(*addr, gw) }()
+	return <-errs
+}
+
+func readJSON(file string, v interface{}) error {
+	body, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("reading %v: %v", file, err)
+	}
+	return nil
+}
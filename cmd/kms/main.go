@@ -1,11 +1,95 @@
 package main
 
 import (
+	"crypto/x509"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
 	"net/http"
+	"os"
 
+	"github.com/fernomac/aws-local/pkg/audit"
 	"github.com/fernomac/aws-local/pkg/kms"
+	"github.com/fernomac/aws-local/pkg/metrics"
 )
 
 func main() {
-	http.ListenAndServe("localhost:8080", kms.NewHandler(kms.New()))
+	if err := run(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// run serves KMS until the listener fails. It returns rather than exiting so
+// that the audit log file is closed on the way out.
+func run() error {
+	addr := flag.String("addr", "localhost:8080", "address to listen on")
+	auditLog := flag.String("audit-log", "", "where to write audit events: empty for nowhere, '-' for stdout, or a file path")
+	auditMaxSize := flag.Int64("audit-max-size", 100<<20, "rotate the audit log file once it exceeds this many bytes")
+	auditBackups := flag.Int("audit-backups", 5, "number of rotated audit log files to keep")
+	auditRing := flag.Int("audit-ring", 10000, "number of recent audit events to keep in memory")
+	attestationRoot := flag.String("attestation-root", "", "PEM file of root certificates that Nitro Enclaves attestation documents must chain up to")
+	strictContext := flag.Bool("strict-encryption-context", false, "reject calls that leave out encryption context keys their key requires")
+	requiredContext := flag.String("required-encryption-context", "", "JSON file mapping key IDs, ARNs or alias names to the encryption context keys they require in strict mode")
+	flag.Parse()
+
+	ring := audit.NewRing(*auditRing)
+	sinks := []audit.Sink{ring}
+
+	switch *auditLog {
+	case "":
+	case "-":
+		sinks = append(sinks, audit.NewWriterSink(os.Stdout))
+	default:
+		file, err := audit.NewFileSink(*auditLog, *auditMaxSize, *auditBackups)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		sinks = append(sinks, file)
+	}
+
+	opts := []kms.Option{}
+	if *attestationRoot != "" {
+		pem, err := ioutil.ReadFile(*attestationRoot)
+		if err != nil {
+			return err
+		}
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in %v", *attestationRoot)
+		}
+		opts = append(opts, kms.WithAttestationRoots(roots))
+	}
+
+	if *strictContext {
+		required := map[string][]string{}
+		if *requiredContext != "" {
+			body, err := ioutil.ReadFile(*requiredContext)
+			if err != nil {
+				return err
+			}
+			if err := json.Unmarshal(body, &required); err != nil {
+				return fmt.Errorf("reading %v: %v", *requiredContext, err)
+			}
+		}
+		opts = append(opts, kms.WithStrictEncryptionContext(required))
+	}
+
+	contexts := kms.NewContextLog()
+	opts = append(opts, kms.WithContextLog(contexts))
+
+	store := kms.New(opts...)
+
+	registry := metrics.NewRegistry()
+	kms.RegisterMetrics(registry, store)
+
+	mux := http.NewServeMux()
+	mux.Handle("/admin/audit", ring)
+	mux.Handle("/admin/encryption-contexts", contexts)
+	mux.Handle("/metrics", registry)
+	mux.Handle("/", kms.NewHandler(store, audit.NewTrail(sinks...), metrics.NewCallMetrics(registry)))
+
+	return http.ListenAndServe(*addr, mux)
 }
@@ -0,0 +1,88 @@
+// Command xks-stub runs a stub external key store proxy for testing KMS
+// external key stores.
+//
+// Besides the XKS API, it serves a few admin endpoints to drive it:
+//
+//	POST /admin/keys?id=<id>                 create a key
+//	POST /admin/keys?id=<id>&status=DISABLED set a key's status
+//	POST /admin/fault?status=500&name=<name> fail every request; no params to stop
+//	POST /admin/latency?duration=1s          delay every response
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fernomac/aws-local/pkg/sigv4"
+	"github.com/fernomac/aws-local/pkg/xks"
+)
+
+func main() {
+	addr := flag.String("addr", "localhost:8081", "address to listen on")
+	accessKeyID := flag.String("access-key-id", "AKIAXKSSTUBEXAMPLE00", "access key ID requests must be signed with")
+	secret := flag.String("secret-access-key", "xksstubsecretaccesskeyexample000000000000", "secret access key requests must be signed with")
+	keys := flag.String("keys", "", "comma-separated IDs of keys to create at startup")
+	flag.Parse()
+
+	stub := xks.NewStub(sigv4.Credentials{AccessKeyID: *accessKeyID, SecretAccessKey: *secret})
+	for _, id := range strings.Split(*keys, ",") {
+		if id == "" {
+			continue
+		}
+		if err := stub.AddKey(id); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/admin/keys", func(w http.ResponseWriter, req *http.Request) {
+		id := req.URL.Query().Get("id")
+		if id == "" {
+			http.Error(w, "missing id", http.StatusBadRequest)
+			return
+		}
+
+		var err error
+		if status := req.URL.Query().Get("status"); status != "" {
+			err = stub.SetKeyStatus(id, status)
+		} else {
+			err = stub.AddKey(id)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+	})
+
+	mux.HandleFunc("/admin/fault", func(w http.ResponseWriter, req *http.Request) {
+		name := req.URL.Query().Get("name")
+		if name == "" {
+			stub.Fail(nil)
+			return
+		}
+
+		status, err := strconv.Atoi(req.URL.Query().Get("status"))
+		if err != nil {
+			http.Error(w, "bad status", http.StatusBadRequest)
+			return
+		}
+		stub.Fail(&xks.Error{Status: status, Name: name, Message: req.URL.Query().Get("message")})
+	})
+
+	mux.HandleFunc("/admin/latency", func(w http.ResponseWriter, req *http.Request) {
+		d, err := time.ParseDuration(req.URL.Query().Get("duration"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		stub.SetLatency(d)
+	})
+
+	mux.Handle("/", stub)
+
+	log.Fatal(http.ListenAndServe(*addr, mux))
+}
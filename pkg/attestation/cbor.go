@@ -0,0 +1,272 @@
+package attestation
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Just enough CBOR (RFC 8949) to read and write attestation documents.
+
+const (
+	majorUint   = 0
+	majorNegint = 1
+	majorBytes  = 2
+	majorText   = 3
+	majorArray  = 4
+	majorMap    = 5
+	majorTag    = 6
+	majorSimple = 7
+)
+
+// pair is a single map entry; maps are written in the order given.
+type pair struct {
+	key   interface{}
+	value interface{}
+}
+
+// orderedMap is a CBOR map whose entries are written in order.
+type orderedMap []pair
+
+// tagged is a tagged CBOR value.
+type tagged struct {
+	tag   uint64
+	value interface{}
+}
+
+func writeHead(buf *bytes.Buffer, major byte, n uint64) {
+	switch {
+	case n < 24:
+		buf.WriteByte(major<<5 | byte(n))
+	case n <= math.MaxUint8:
+		buf.WriteByte(major<<5 | 24)
+		buf.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		buf.WriteByte(major<<5 | 25)
+		binary.Write(buf, binary.BigEndian, uint16(n))
+	case n <= math.MaxUint32:
+		buf.WriteByte(major<<5 | 26)
+		binary.Write(buf, binary.BigEndian, uint32(n))
+	default:
+		buf.WriteByte(major<<5 | 27)
+		binary.Write(buf, binary.BigEndian, n)
+	}
+}
+
+func encode(buf *bytes.Buffer, v interface{}) error {
+	switch val := v.(type) {
+	case nil:
+		buf.WriteByte(majorSimple<<5 | 22)
+	case bool:
+		if val {
+			buf.WriteByte(majorSimple<<5 | 21)
+		} else {
+			buf.WriteByte(majorSimple<<5 | 20)
+		}
+	case int:
+		return encode(buf, int64(val))
+	case int64:
+		if val < 0 {
+			writeHead(buf, majorNegint, uint64(-1-val))
+		} else {
+			writeHead(buf, majorUint, uint64(val))
+		}
+	case uint64:
+		writeHead(buf, majorUint, val)
+	case []byte:
+		writeHead(buf, majorBytes, uint64(len(val)))
+		buf.Write(val)
+	case string:
+		writeHead(buf, majorText, uint64(len(val)))
+		buf.WriteString(val)
+	case []interface{}:
+		writeHead(buf, majorArray, uint64(len(val)))
+		for _, elem := range val {
+			if err := encode(buf, elem); err != nil {
+				return err
+			}
+		}
+	case orderedMap:
+		writeHead(buf, majorMap, uint64(len(val)))
+		for _, p := range val {
+			if err := encode(buf, p.key); err != nil {
+				return err
+			}
+			if err := encode(buf, p.value); err != nil {
+				return err
+			}
+		}
+	case tagged:
+		writeHead(buf, majorTag, val.tag)
+		return encode(buf, val.value)
+	default:
+		return fmt.Errorf("cbor: can't encode %T", v)
+	}
+	return nil
+}
+
+func marshalCBOR(v interface{}) ([]byte, error) {
+	buf := bytes.Buffer{}
+	if err := encode(&buf, v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+var errTruncated = errors.New("cbor: truncated input")
+
+type decoder struct {
+	data  []byte
+	pos   int
+	depth int
+}
+
+func (d *decoder) readHead() (byte, byte, uint64, error) {
+	if d.pos >= len(d.data) {
+		return 0, 0, 0, errTruncated
+	}
+	b := d.data[d.pos]
+	d.pos++
+
+	major, info := b>>5, b&0x1F
+	var size int
+	switch {
+	case info < 24:
+		return major, info, uint64(info), nil
+	case info == 24:
+		size = 1
+	case info == 25:
+		size = 2
+	case info == 26:
+		size = 4
+	case info == 27:
+		size = 8
+	default:
+		return 0, 0, 0, errors.New("cbor: indefinite lengths are not supported")
+	}
+
+	if d.pos+size > len(d.data) {
+		return 0, 0, 0, errTruncated
+	}
+	n := uint64(0)
+	for _, c := range d.data[d.pos : d.pos+size] {
+		n = n<<8 | uint64(c)
+	}
+	d.pos += size
+	return major, info, n, nil
+}
+
+func (d *decoder) readN(n uint64) ([]byte, error) {
+	if n > uint64(len(d.data)-d.pos) {
+		return nil, errTruncated
+	}
+	out := d.data[d.pos : d.pos+int(n)]
+	d.pos += int(n)
+	return out, nil
+}
+
+func (d *decoder) decode() (interface{}, error) {
+	d.depth++
+	defer func() { d.depth-- }()
+	if d.depth > 32 {
+		return nil, errors.New("cbor: nested too deeply")
+	}
+
+	major, info, n, err := d.readHead()
+	if err != nil {
+		return nil, err
+	}
+
+	switch major {
+	case majorUint:
+		return n, nil
+	case majorNegint:
+		if n > math.MaxInt64 {
+			return nil, errors.New("cbor: integer overflow")
+		}
+		return -1 - int64(n), nil
+	case majorBytes:
+		b, err := d.readN(n)
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte(nil), b...), nil
+	case majorText:
+		b, err := d.readN(n)
+		if err != nil {
+			return nil, err
+		}
+		return string(b), nil
+	case majorArray:
+		if n > uint64(len(d.data)) {
+			return nil, errTruncated
+		}
+		out := make([]interface{}, 0, n)
+		for i := uint64(0); i < n; i++ {
+			elem, err := d.decode()
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, elem)
+		}
+		return out, nil
+	case majorMap:
+		if n > uint64(len(d.data)) {
+			return nil, errTruncated
+		}
+		out := make(map[interface{}]interface{}, n)
+		for i := uint64(0); i < n; i++ {
+			key, err := d.decode()
+			if err != nil {
+				return nil, err
+			}
+			switch key.(type) {
+			case uint64, int64, string:
+			default:
+				return nil, fmt.Errorf("cbor: unsupported map key type %T", key)
+			}
+			value, err := d.decode()
+			if err != nil {
+				return nil, err
+			}
+			out[key] = value
+		}
+		return out, nil
+	case majorTag:
+		value, err := d.decode()
+		if err != nil {
+			return nil, err
+		}
+		return tagged{tag: n, value: value}, nil
+	default:
+		switch info {
+		case 20:
+			return false, nil
+		case 21:
+			return true, nil
+		case 22, 23:
+			return nil, nil
+		case 25:
+			return nil, errors.New("cbor: half-precision floats are not supported")
+		case 26:
+			return float64(math.Float32frombits(uint32(n))), nil
+		case 27:
+			return math.Float64frombits(n), nil
+		}
+		return nil, fmt.Errorf("cbor: unsupported simple value %v", info)
+	}
+}
+
+func unmarshalCBOR(data []byte) (interface{}, error) {
+	d := &decoder{data: data}
+	v, err := d.decode()
+	if err != nil {
+		return nil, err
+	}
+	if d.pos != len(data) {
+		return nil, errors.New("cbor: trailing data")
+	}
+	return v, nil
+}
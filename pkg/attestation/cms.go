@@ -0,0 +1,213 @@
+package attestation
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+)
+
+// KMS returns data for an enclave as a CMS EnvelopedData (RFC 5652): the
+// content is encrypted with a fresh AES-256-CBC key, which is in turn
+// encrypted to the enclave's RSA public key with RSAES-OAEP and SHA-256.
+
+var (
+	oidData          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidEnvelopedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 3}
+	oidRSAESOAEP     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 7}
+	oidMGF1          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 8}
+	oidSHA256        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidAES256CBC     = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+)
+
+type algorithmIdentifier struct {
+	Algorithm  asn1.ObjectIdentifier
+	Parameters asn1.RawValue `asn1:"optional"`
+}
+
+type oaepParams struct {
+	Hash algorithmIdentifier `asn1:"explicit,tag:0"`
+	MGF  algorithmIdentifier `asn1:"explicit,tag:1"`
+}
+
+type keyTransRecipientInfo struct {
+	Version                int
+	RID                    asn1.RawValue
+	KeyEncryptionAlgorithm algorithmIdentifier
+	EncryptedKey           []byte
+}
+
+type encryptedContentInfo struct {
+	ContentType                asn1.ObjectIdentifier
+	ContentEncryptionAlgorithm algorithmIdentifier
+	EncryptedContent           asn1.RawValue `asn1:"optional"`
+}
+
+type envelopedData struct {
+	Version              int
+	RecipientInfos       []keyTransRecipientInfo `asn1:"set"`
+	EncryptedContentInfo encryptedContentInfo
+}
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     envelopedData `asn1:"explicit,tag:0"`
+}
+
+func mustMarshal(v interface{}) []byte {
+	b, err := asn1.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func oaepAlgorithm() algorithmIdentifier {
+	sha256ID := algorithmIdentifier{Algorithm: oidSHA256}
+	params := oaepParams{
+		Hash: sha256ID,
+		MGF: algorithmIdentifier{
+			Algorithm:  oidMGF1,
+			Parameters: asn1.RawValue{FullBytes: mustMarshal(sha256ID)},
+		},
+	}
+	return algorithmIdentifier{
+		Algorithm:  oidRSAESOAEP,
+		Parameters: asn1.RawValue{FullBytes: mustMarshal(params)},
+	}
+}
+
+// ParseRSAPublicKey parses a DER-encoded SubjectPublicKeyInfo holding an RSA
+// key, as found in an attestation document's public_key.
+func ParseRSAPublicKey(der []byte) (*rsa.PublicKey, error) {
+	pub, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, err
+	}
+	rsaPub, ok := pub.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("attestation: public key is not an RSA key")
+	}
+	return rsaPub, nil
+}
+
+// Seal encrypts plaintext to the given RSA public key, returning a DER-encoded
+// CMS EnvelopedData.
+func Seal(pub *rsa.PublicKey, plaintext []byte) ([]byte, error) {
+	cek := make([]byte, 32)
+	iv := make([]byte, aes.BlockSize)
+	if _, err := rand.Read(cek); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(iv); err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+
+	// PKCS#7 padding.
+	pad := aes.BlockSize - len(plaintext)%aes.BlockSize
+	padded := append(append([]byte(nil), plaintext...), bytes.Repeat([]byte{byte(pad)}, pad)...)
+	ciphertext := make([]byte, len(padded))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(ciphertext, padded)
+
+	encryptedKey, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, pub, cek, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	spki, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, err
+	}
+	ski := sha1.Sum(spki)
+
+	ivParam, err := asn1.Marshal(iv)
+	if err != nil {
+		return nil, err
+	}
+
+	return asn1.Marshal(contentInfo{
+		ContentType: oidEnvelopedData,
+		Content: envelopedData{
+			Version: 2,
+			RecipientInfos: []keyTransRecipientInfo{{
+				Version:                2,
+				RID:                    asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, Bytes: ski[:]},
+				KeyEncryptionAlgorithm: oaepAlgorithm(),
+				EncryptedKey:           encryptedKey,
+			}},
+			EncryptedContentInfo: encryptedContentInfo{
+				ContentType: oidData,
+				ContentEncryptionAlgorithm: algorithmIdentifier{
+					Algorithm:  oidAES256CBC,
+					Parameters: asn1.RawValue{FullBytes: ivParam},
+				},
+				EncryptedContent: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, Bytes: ciphertext},
+			},
+		},
+	})
+}
+
+// Open decrypts a CMS EnvelopedData produced by Seal, as an enclave would.
+func Open(priv *rsa.PrivateKey, envelope []byte) ([]byte, error) {
+	ci := contentInfo{}
+	rest, err := asn1.Unmarshal(envelope, &ci)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 || !ci.ContentType.Equal(oidEnvelopedData) {
+		return nil, errors.New("attestation: not a CMS EnvelopedData")
+	}
+
+	ed := ci.Content
+	if len(ed.RecipientInfos) != 1 {
+		return nil, errors.New("attestation: expected exactly one recipient")
+	}
+	if !ed.RecipientInfos[0].KeyEncryptionAlgorithm.Algorithm.Equal(oidRSAESOAEP) {
+		return nil, errors.New("attestation: unsupported key encryption algorithm")
+	}
+
+	cek, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, priv, ed.RecipientInfos[0].EncryptedKey, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	eci := ed.EncryptedContentInfo
+	if !eci.ContentEncryptionAlgorithm.Algorithm.Equal(oidAES256CBC) {
+		return nil, errors.New("attestation: unsupported content encryption algorithm")
+	}
+
+	var iv []byte
+	if _, err := asn1.Unmarshal(eci.ContentEncryptionAlgorithm.Parameters.FullBytes, &iv); err != nil {
+		return nil, err
+	}
+
+	ciphertext := eci.EncryptedContent.Bytes
+	if len(iv) != aes.BlockSize || len(ciphertext) == 0 || len(ciphertext)%aes.BlockSize != 0 {
+		return nil, errors.New("attestation: malformed encrypted content")
+	}
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext := make([]byte, len(ciphertext))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plaintext, ciphertext)
+
+	pad := int(plaintext[len(plaintext)-1])
+	if pad < 1 || pad > aes.BlockSize || pad > len(plaintext) {
+		return nil, errors.New("attestation: bad padding")
+	}
+	return plaintext[:len(plaintext)-pad], nil
+}
@@ -0,0 +1,299 @@
+// Package attestation reads, verifies and forges Nitro Enclaves attestation
+// documents: COSE_Sign1 structures (RFC 8152) signed with ECDSA P-384 whose
+// payload is a CBOR map describing the enclave.
+package attestation
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"time"
+)
+
+// algES384 is the COSE algorithm identifier for ECDSA with SHA-384.
+const algES384 = -35
+
+// coseSign1Tag is the CBOR tag for COSE_Sign1.
+const coseSign1Tag = 18
+
+// Document is a parsed attestation document.
+type Document struct {
+	ModuleID    string
+	Digest      string
+	Timestamp   time.Time
+	PCRs        map[int][]byte
+	Certificate *x509.Certificate
+	CABundle    []*x509.Certificate
+	PublicKey   []byte
+	UserData    []byte
+	Nonce       []byte
+}
+
+// PCR returns the given PCR as a lower-case hex string, as it appears in
+// kms:RecipientAttestation:PCR<n> conditions.
+func (d *Document) PCR(index int) string {
+	return hex.EncodeToString(d.PCRs[index])
+}
+
+// ImageSha384 returns the enclave image hash, which is PCR0.
+func (d *Document) ImageSha384() string {
+	return d.PCR(0)
+}
+
+func sigStructure(protected []byte, payload []byte) ([]byte, error) {
+	return marshalCBOR([]interface{}{"Signature1", protected, []byte{}, payload})
+}
+
+func asBytes(v interface{}, name string) ([]byte, error) {
+	b, ok := v.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("attestation: %v is not a byte string", name)
+	}
+	return b, nil
+}
+
+// coseSign1 is the signed envelope around a document.
+type coseSign1 struct {
+	protected []byte
+	payload   []byte
+	signature []byte
+}
+
+func parseSign1(data []byte) (*coseSign1, error) {
+	raw, err := unmarshalCBOR(data)
+	if err != nil {
+		return nil, err
+	}
+	if t, ok := raw.(tagged); ok {
+		if t.tag != coseSign1Tag {
+			return nil, fmt.Errorf("attestation: unexpected CBOR tag %v", t.tag)
+		}
+		raw = t.value
+	}
+
+	parts, ok := raw.([]interface{})
+	if !ok || len(parts) != 4 {
+		return nil, errors.New("attestation: not a COSE_Sign1 structure")
+	}
+
+	out := &coseSign1{}
+	if out.protected, err = asBytes(parts[0], "protected header"); err != nil {
+		return nil, err
+	}
+	if out.payload, err = asBytes(parts[2], "payload"); err != nil {
+		return nil, err
+	}
+	if out.signature, err = asBytes(parts[3], "signature"); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Parse parses an attestation document without verifying it.
+func Parse(data []byte) (*Document, error) {
+	cose, err := parseSign1(data)
+	if err != nil {
+		return nil, err
+	}
+	return parsePayload(cose.payload)
+}
+
+func parsePayload(payload []byte) (*Document, error) {
+	raw, err := unmarshalCBOR(payload)
+	if err != nil {
+		return nil, err
+	}
+	m, ok := raw.(map[interface{}]interface{})
+	if !ok {
+		return nil, errors.New("attestation: payload is not a map")
+	}
+
+	doc := &Document{
+		PCRs: map[int][]byte{},
+	}
+
+	doc.ModuleID, _ = m["module_id"].(string)
+	doc.Digest, _ = m["digest"].(string)
+	if ts, ok := m["timestamp"].(uint64); ok {
+		doc.Timestamp = time.Unix(0, int64(ts)*int64(time.Millisecond)).UTC()
+	}
+
+	pcrs, ok := m["pcrs"].(map[interface{}]interface{})
+	if !ok {
+		return nil, errors.New("attestation: missing pcrs")
+	}
+	for index, value := range pcrs {
+		i, ok := index.(uint64)
+		if !ok || i > 31 {
+			return nil, errors.New("attestation: bad PCR index")
+		}
+		b, err := asBytes(value, "PCR")
+		if err != nil {
+			return nil, err
+		}
+		doc.PCRs[int(i)] = b
+	}
+
+	der, err := asBytes(m["certificate"], "certificate")
+	if err != nil {
+		return nil, err
+	}
+	if doc.Certificate, err = x509.ParseCertificate(der); err != nil {
+		return nil, err
+	}
+
+	if bundle, ok := m["cabundle"].([]interface{}); ok {
+		for _, c := range bundle {
+			der, err := asBytes(c, "cabundle entry")
+			if err != nil {
+				return nil, err
+			}
+			cert, err := x509.ParseCertificate(der)
+			if err != nil {
+				return nil, err
+			}
+			doc.CABundle = append(doc.CABundle, cert)
+		}
+	}
+
+	doc.PublicKey, _ = m["public_key"].([]byte)
+	doc.UserData, _ = m["user_data"].([]byte)
+	doc.Nonce, _ = m["nonce"].([]byte)
+
+	return doc, nil
+}
+
+// Verify parses an attestation document and checks that it was signed by a
+// certificate chaining up to one of the given roots.
+func Verify(data []byte, roots *x509.CertPool) (*Document, error) {
+	cose, err := parseSign1(data)
+	if err != nil {
+		return nil, err
+	}
+	protected, payload, signature := cose.protected, cose.payload, cose.signature
+
+	doc, err := parsePayload(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	header, err := unmarshalCBOR(protected)
+	if err != nil {
+		return nil, err
+	}
+	hm, ok := header.(map[interface{}]interface{})
+	if !ok || hm[uint64(1)] != int64(algES384) {
+		return nil, errors.New("attestation: unsupported signing algorithm")
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range doc.CABundle {
+		intermediates.AddCert(cert)
+	}
+
+	// Fake documents get reused long after their certificates would have
+	// expired, so the chain is checked as of when the document was signed.
+	_, err = doc.Certificate.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   doc.Timestamp,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	pub, ok := doc.Certificate.PublicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, errors.New("attestation: certificate does not hold an ECDSA key")
+	}
+	if len(signature) != 96 {
+		return nil, errors.New("attestation: bad signature length")
+	}
+
+	tbs, err := sigStructure(protected, payload)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha512.Sum384(tbs)
+
+	r := new(big.Int).SetBytes(signature[:48])
+	s := new(big.Int).SetBytes(signature[48:])
+	if !ecdsa.Verify(pub, digest[:], r, s) {
+		return nil, errors.New("attestation: bad signature")
+	}
+
+	return doc, nil
+}
+
+func (d *Document) payload() ([]byte, error) {
+	indexes := []int{}
+	for i := range d.PCRs {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+
+	pcrs := orderedMap{}
+	for _, i := range indexes {
+		pcrs = append(pcrs, pair{uint64(i), d.PCRs[i]})
+	}
+
+	bundle := []interface{}{}
+	for _, cert := range d.CABundle {
+		bundle = append(bundle, cert.Raw)
+	}
+
+	optional := func(b []byte) interface{} {
+		if b == nil {
+			return nil
+		}
+		return b
+	}
+
+	return marshalCBOR(orderedMap{
+		{"module_id", d.ModuleID},
+		{"digest", d.Digest},
+		{"timestamp", uint64(d.Timestamp.UnixNano() / int64(time.Millisecond))},
+		{"pcrs", pcrs},
+		{"certificate", d.Certificate.Raw},
+		{"cabundle", bundle},
+		{"public_key", optional(d.PublicKey)},
+		{"user_data", optional(d.UserData)},
+		{"nonce", optional(d.Nonce)},
+	})
+}
+
+func sign(doc *Document, key *ecdsa.PrivateKey) ([]byte, error) {
+	protected, err := marshalCBOR(orderedMap{{int64(1), int64(algES384)}})
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := doc.payload()
+	if err != nil {
+		return nil, err
+	}
+
+	tbs, err := sigStructure(protected, payload)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha512.Sum384(tbs)
+
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		return nil, err
+	}
+
+	signature := make([]byte, 96)
+	r.FillBytes(signature[:48])
+	s.FillBytes(signature[48:])
+
+	return marshalCBOR(tagged{coseSign1Tag, []interface{}{protected, orderedMap{}, payload, signature}})
+}
@@ -0,0 +1,97 @@
+package attestation_test
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/fernomac/aws-local/pkg/attestation"
+)
+
+// newAuthority makes an authority whose root became valid at notBefore.
+func newAuthority(t *testing.T, notBefore time.Time) *attestation.Authority {
+	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test root"},
+		NotBefore:             notBefore,
+		NotAfter:              notBefore.AddDate(1, 0, 0),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &attestation.Authority{Root: root, RootKey: key}
+}
+
+func TestVerify(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name      string
+		notBefore time.Time
+		timestamp time.Time
+		ok        bool
+	}{
+		{"fresh root", now.Add(-time.Minute), now, true},
+		{"old root", now.AddDate(0, -6, 0), now, true},
+		{"old document", now.AddDate(0, -6, 0), now.AddDate(0, -5, 0), true},
+		{"document before root", now.Add(-time.Minute), now.AddDate(0, -1, 0), false},
+	}
+
+	for _, test := range tests {
+		authority := newAuthority(t, test.notBefore)
+		data, err := authority.Sign(&attestation.Document{
+			PCRs:      map[int][]byte{0: make([]byte, 48)},
+			Timestamp: test.timestamp,
+			Nonce:     []byte("nonce"),
+		})
+		if err != nil {
+			t.Fatalf("%v: %v", test.name, err)
+		}
+
+		roots := x509.NewCertPool()
+		roots.AddCert(authority.Root)
+		doc, err := attestation.Verify(data, roots)
+		if !test.ok {
+			if err == nil {
+				t.Errorf("%v: verified", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: %v", test.name, err)
+			continue
+		}
+		if !bytes.Equal(doc.Nonce, []byte("nonce")) {
+			t.Errorf("%v: nonce is %q", test.name, doc.Nonce)
+		}
+	}
+
+	// A root that isn't trusted never verifies.
+	data, err := newAuthority(t, now.Add(-time.Minute)).Sign(&attestation.Document{PCRs: map[int][]byte{0: make([]byte, 48)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := x509.NewCertPool()
+	other.AddCert(newAuthority(t, now.Add(-time.Minute)).Root)
+	if _, err := attestation.Verify(data, other); err == nil {
+		t.Errorf("verified against the wrong root")
+	}
+}
@@ -0,0 +1,161 @@
+package audit
+
+import (
+	"encoding/json"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/fernomac/aws-local/pkg/common"
+)
+
+// Hidden replaces redacted values, as it does in CloudTrail.
+const Hidden = "HIDDEN_DUE_TO_SECURITY_REASONS"
+
+// UserIdentity identifies the caller.
+type UserIdentity struct {
+	Type        string `json:"type"`
+	PrincipalID string `json:"principalId,omitempty"`
+	Arn         string `json:"arn,omitempty"`
+	AccountID   string `json:"accountId,omitempty"`
+	AccessKeyID string `json:"accessKeyId,omitempty"`
+}
+
+// Event is a CloudTrail-like record of a single call.
+type Event struct {
+	EventVersion       string                 `json:"eventVersion"`
+	UserIdentity       UserIdentity           `json:"userIdentity"`
+	EventTime          time.Time              `json:"eventTime"`
+	EventSource        string                 `json:"eventSource"`
+	EventName          string                 `json:"eventName"`
+	AWSRegion          string                 `json:"awsRegion"`
+	SourceIPAddress    string                 `json:"sourceIPAddress"`
+	UserAgent          string                 `json:"userAgent,omitempty"`
+	ErrorCode          string                 `json:"errorCode,omitempty"`
+	ErrorMessage       string                 `json:"errorMessage,omitempty"`
+	RequestParameters  map[string]interface{} `json:"requestParameters"`
+	ResponseElements   map[string]interface{} `json:"responseElements"`
+	RequestID          string                 `json:"requestID"`
+	EventID            string                 `json:"eventID"`
+	EventType          string                 `json:"eventType"`
+	RecipientAccountID string                 `json:"recipientAccountId,omitempty"`
+	DurationMillis     float64                `json:"durationMillis"`
+}
+
+// accessKeyID pulls the access key ID out of a SigV4 Authorization header.
+func accessKeyID(auth string) string {
+	i := strings.Index(auth, "Credential=")
+	if i < 0 {
+		return ""
+	}
+	cred := auth[i+len("Credential="):]
+	if j := strings.IndexAny(cred, "/, "); j >= 0 {
+		cred = cred[:j]
+	}
+	return cred
+}
+
+// region pulls the region out of a SigV4 Authorization header.
+func region(auth string) string {
+	i := strings.Index(auth, "Credential=")
+	if i < 0 {
+		return ""
+	}
+	cred := auth[i+len("Credential="):]
+	if j := strings.IndexAny(cred, ", "); j >= 0 {
+		cred = cred[:j]
+	}
+	parts := strings.Split(cred, "/")
+	if len(parts) < 3 {
+		return ""
+	}
+	return parts[2]
+}
+
+func sourceIP(remoteAddr string) string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return remoteAddr
+	}
+	return host
+}
+
+// decode turns a JSON document into a generic map, redacting sensitive
+// members along the way.
+func decode(data []byte, redact map[string]bool) map[string]interface{} {
+	if len(data) == 0 {
+		return nil
+	}
+
+	out := map[string]interface{}{}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil
+	}
+
+	redactValue(out, redact)
+	return out
+}
+
+func redactValue(v interface{}, redact map[string]bool) {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for name, member := range val {
+			if redact[name] {
+				val[name] = Hidden
+			} else {
+				redactValue(member, redact)
+			}
+		}
+	case []interface{}:
+		for _, member := range val {
+			redactValue(member, redact)
+		}
+	}
+}
+
+func newEvent(call *common.Call, redact map[string]bool, defaultRegion string) *Event {
+	auth := call.HTTP.Header.Get("Authorization")
+
+	e := &Event{
+		EventVersion:      "1.08",
+		EventTime:         call.Start.UTC(),
+		EventSource:       call.EventSource,
+		EventName:         call.Operation,
+		AWSRegion:         region(auth),
+		SourceIPAddress:   sourceIP(call.HTTP.RemoteAddr),
+		UserAgent:         call.HTTP.UserAgent(),
+		RequestParameters: decode(call.Input, redact),
+		RequestID:         call.RequestID,
+		EventID:           common.NewRequestID(),
+		EventType:         "AwsApiCall",
+		DurationMillis:    float64(call.Duration) / float64(time.Millisecond),
+	}
+
+	if e.AWSRegion == "" {
+		e.AWSRegion = defaultRegion
+	}
+
+	if key := accessKeyID(auth); key != "" {
+		e.UserIdentity = UserIdentity{
+			Type:        "IAMUser",
+			AccessKeyID: key,
+		}
+	} else {
+		e.UserIdentity = UserIdentity{Type: "Anonymous"}
+	}
+
+	if call.Err != nil {
+		e.ErrorCode = call.ErrorCode()
+		if ce, ok := call.Err.(common.Error); ok {
+			e.ErrorMessage = ce.Message
+		} else {
+			e.ErrorMessage = call.Err.Error()
+		}
+	} else if call.Output != nil {
+		if data, err := json.Marshal(call.Output); err == nil {
+			e.ResponseElements = decode(data, redact)
+		}
+	}
+
+	return e
+}
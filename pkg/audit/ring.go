@@ -0,0 +1,136 @@
+package audit
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Filter selects events from a Ring. Zero-valued fields match everything.
+type Filter struct {
+	EventSource string
+	EventName   string
+	ErrorCode   string
+	AccessKeyID string
+	Since       time.Time
+	Limit       int
+}
+
+func (f *Filter) matches(e *Event) bool {
+	if f.EventSource != "" && f.EventSource != e.EventSource {
+		return false
+	}
+	if f.EventName != "" && f.EventName != e.EventName {
+		return false
+	}
+	if f.ErrorCode != "" && f.ErrorCode != e.ErrorCode {
+		return false
+	}
+	if f.AccessKeyID != "" && f.AccessKeyID != e.UserIdentity.AccessKeyID {
+		return false
+	}
+	if !f.Since.IsZero() && e.EventTime.Before(f.Since) {
+		return false
+	}
+	return true
+}
+
+// Ring keeps the most recent events in memory.
+type Ring struct {
+	lock   sync.RWMutex
+	events []*Event
+	next   int
+	full   bool
+}
+
+// NewRing creates a ring buffer holding up to size events.
+func NewRing(size int) *Ring {
+	return &Ring{
+		events: make([]*Event, size),
+	}
+}
+
+// Write adds an event, evicting the oldest if the ring is full.
+func (r *Ring) Write(e *Event) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if len(r.events) == 0 {
+		return nil
+	}
+
+	r.events[r.next] = e
+	r.next = (r.next + 1) % len(r.events)
+	if r.next == 0 {
+		r.full = true
+	}
+	return nil
+}
+
+// Query returns matching events, newest first.
+func (r *Ring) Query(f Filter) []*Event {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	n := r.next
+	if r.full {
+		n = len(r.events)
+	}
+
+	out := []*Event{}
+	for i := 0; i < n; i++ {
+		idx := (r.next - 1 - i + len(r.events)) % len(r.events)
+		e := r.events[idx]
+		if !f.matches(e) {
+			continue
+		}
+		out = append(out, e)
+		if f.Limit > 0 && len(out) >= f.Limit {
+			break
+		}
+	}
+	return out
+}
+
+// ServeHTTP serves matching events as a JSON array. The filter is taken from
+// the eventSource, eventName, errorCode, accessKeyId, since (RFC 3339) and
+// limit query parameters.
+func (r *Ring) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	q := req.URL.Query()
+
+	f := Filter{
+		EventSource: q.Get("eventSource"),
+		EventName:   q.Get("eventName"),
+		ErrorCode:   q.Get("errorCode"),
+		AccessKeyID: q.Get("accessKeyId"),
+	}
+
+	if since := q.Get("since"); since != "" {
+		t, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			http.Error(resp, "invalid since: "+err.Error(), 400)
+			return
+		}
+		f.Since = t
+	}
+
+	if limit := q.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil {
+			http.Error(resp, "invalid limit: "+err.Error(), 400)
+			return
+		}
+		f.Limit = n
+	}
+
+	body, err := json.Marshal(r.Query(f))
+	if err != nil {
+		http.Error(resp, err.Error(), 500)
+		return
+	}
+
+	resp.Header().Add("Content-Type", "application/json")
+	resp.Write(body)
+}
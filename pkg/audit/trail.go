@@ -0,0 +1,61 @@
+package audit
+
+import (
+	"log"
+
+	"github.com/fernomac/aws-local/pkg/common"
+)
+
+// DefaultRedactions are the request and response members whose values are
+// never recorded.
+var DefaultRedactions = []string{
+	"Plaintext",
+	"PrivateKeyPlaintext",
+	"SecretString",
+	"SecretBinary",
+	"EncryptedKeyMaterial",
+	"Value",
+	"SecretAccessKey",
+	"SessionToken",
+	"WebIdentityToken",
+}
+
+// Sink receives audit events.
+type Sink interface {
+	Write(event *Event) error
+}
+
+// Trail turns calls into events and writes them to a set of sinks.
+type Trail struct {
+	sinks  []Sink
+	redact map[string]bool
+	region string
+}
+
+// NewTrail creates a new trail writing to the given sinks.
+func NewTrail(sinks ...Sink) *Trail {
+	t := &Trail{
+		sinks:  sinks,
+		redact: make(map[string]bool),
+		region: "us-local-1",
+	}
+	t.Redact(DefaultRedactions...)
+	return t
+}
+
+// Redact adds to the set of members whose values are hidden.
+func (t *Trail) Redact(names ...string) {
+	for _, name := range names {
+		t.redact[name] = true
+	}
+}
+
+// Observe records the given call.
+func (t *Trail) Observe(call *common.Call) {
+	e := newEvent(call, t.redact, t.region)
+	for _, sink := range t.sinks {
+		if err := sink.Write(e); err != nil {
+			log.Printf("audit: error writing event %v: %v", e.EventID, err)
+		}
+	}
+}
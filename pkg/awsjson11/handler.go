@@ -5,12 +5,13 @@ import (
 	"io/ioutil"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/fernomac/aws-local/pkg/common"
 )
 
-func sendError(resp http.ResponseWriter, err error) {
-	resp.Header().Add("Content-Type", "application/x-amz-json-1.1")
+func sendError(resp http.ResponseWriter, contentType string, err error) {
+	resp.Header().Add("Content-Type", contentType)
 	resp.WriteHeader(400)
 
 	msg := map[string]string{}
@@ -39,27 +40,69 @@ type HandlerFunc func([]byte) (interface{}, error)
 
 // Handler handles HTTP requests.
 type Handler struct {
-	prefix   string
-	handlers map[string]HandlerFunc
+	prefix      string
+	source      string
+	contentType string
+	handlers    map[string]HandlerFunc
+	observers   []common.Observer
 }
 
 // NewHandler creates a new handler.
 func NewHandler(prefix string) *Handler {
 	return &Handler{
-		prefix:   prefix + ".",
-		handlers: make(map[string]HandlerFunc),
+		prefix:      prefix + ".",
+		source:      prefix,
+		contentType: "application/x-amz-json-1.1",
+		handlers:    make(map[string]HandlerFunc),
 	}
 }
 
+// UseJSON10 makes the handler speak awsJson1.0, as older services such as
+// DynamoDB do. It differs from awsJson1.1 only in its content type.
+func (h *Handler) UseJSON10() {
+	h.contentType = "application/x-amz-json-1.0"
+}
+
 // HandleWith handles the given operation with the given handler function.
 func (h *Handler) HandleWith(op string, handler HandlerFunc) {
 	h.handlers[op] = handler
 }
 
+// SetEventSource sets the event source reported to observers, e.g.
+// "kms.amazonaws.com". It defaults to the target prefix.
+func (h *Handler) SetEventSource(source string) {
+	h.source = source
+}
+
+// ObserveWith notifies the given observer of every call handled.
+func (h *Handler) ObserveWith(observer common.Observer) {
+	h.observers = append(h.observers, observer)
+}
+
 func (h *Handler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	call := &common.Call{
+		EventSource: h.source,
+		RequestID:   common.NewRequestID(),
+		HTTP:        req,
+		Start:       time.Now(),
+	}
+	resp.Header().Set("x-amzn-RequestId", call.RequestID)
+
+	h.serve(resp, req, call)
+
+	if call.Operation == "" {
+		return
+	}
+	call.Duration = time.Since(call.Start)
+	for _, o := range h.observers {
+		o.Observe(call)
+	}
+}
+
+func (h *Handler) serve(resp http.ResponseWriter, req *http.Request, call *common.Call) {
 	target := req.Header.Get("x-amz-target")
 	if req.Method != "POST" || req.RequestURI != "/" || !strings.HasPrefix(target, h.prefix) {
-		sendError(resp, common.NewError("UnknownOperationException"))
+		sendError(resp, h.contentType, common.NewError("UnknownOperationException"))
 		return
 	}
 
@@ -73,25 +116,32 @@ func (h *Handler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
 
 	handler, ok := h.handlers[target]
 	if !ok {
-		sendError(resp, common.NewError("UnknownOperationException"))
+		sendError(resp, h.contentType, common.NewError("UnknownOperationException"))
 		return
 	}
 
+	call.Operation = target
+	call.Input = body
+
 	out, err := handler(body)
 	if err != nil {
-		sendError(resp, err)
+		call.Err = err
+		sendError(resp, h.contentType, err)
 		return
 	}
+	call.Output = out
 
 	var rbody []byte
 	if out != nil {
 		rbody, err = json.Marshal(out)
 		if err != nil {
-			sendError(resp, err)
+			call.Err = err
+			sendError(resp, h.contentType, err)
+			return
 		}
 	}
 
-	resp.Header().Add("Content-Type", "application/x-amz-json-1.1")
+	resp.Header().Add("Content-Type", h.contentType)
 	resp.WriteHeader(200)
 
 	if out != nil {
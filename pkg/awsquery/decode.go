@@ -0,0 +1,195 @@
+package awsquery
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/fernomac/aws-local/pkg/common"
+)
+
+// field describes how a struct field is named in the query string. The tag
+// looks like `query:"Name,flattened,key=Name,value=Value"`.
+type field struct {
+	name      string
+	flattened bool
+	key       string
+	value     string
+}
+
+func parseField(f reflect.StructField) (field, bool) {
+	tag := f.Tag.Get("query")
+	if tag == "-" {
+		return field{}, false
+	}
+
+	out := field{name: f.Name, key: "key", value: "value"}
+	for i, part := range strings.Split(tag, ",") {
+		switch {
+		case i == 0 && part != "":
+			out.name = part
+		case part == "flattened":
+			out.flattened = true
+		case strings.HasPrefix(part, "key="):
+			out.key = part[len("key="):]
+		case strings.HasPrefix(part, "value="):
+			out.value = part[len("value="):]
+		}
+	}
+	return out, true
+}
+
+// Decode fills v, a pointer to a struct, from query parameters. Fields are
+// named by their `query` tag, defaulting to the field name. Nested structs
+// read Name.Member; lists read Name.member.N and maps read Name.entry.N.key
+// and Name.entry.N.value, counting from 1. The flattened option drops the
+// member and entry levels, and the key and value options rename a map's
+// parts, for services such as SQS that use Attribute.N.Name.
+func Decode(values url.Values, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		panic("awsquery: Decode needs a pointer to a struct")
+	}
+	return decodeStruct(values, "", rv.Elem())
+}
+
+func has(values url.Values, prefix string) bool {
+	for name := range values {
+		if name == prefix || strings.HasPrefix(name, prefix+".") {
+			return true
+		}
+	}
+	return false
+}
+
+func decodeStruct(values url.Values, prefix string, rv reflect.Value) error {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		if rt.Field(i).PkgPath != "" {
+			continue
+		}
+		f, ok := parseField(rt.Field(i))
+		if !ok {
+			continue
+		}
+		if err := decodeValue(values, prefix+f.name, f, rv.Field(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func decodeValue(values url.Values, name string, f field, rv reflect.Value) error {
+	switch rv.Kind() {
+	case reflect.Struct:
+		return decodeStruct(values, name+".", rv)
+
+	case reflect.Ptr:
+		if !has(values, name) {
+			return nil
+		}
+		elem := reflect.New(rv.Type().Elem())
+		if err := decodeValue(values, name, field{key: "key", value: "value"}, elem.Elem()); err != nil {
+			return err
+		}
+		rv.Set(elem)
+		return nil
+
+	case reflect.Slice:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			break
+		}
+		prefix := name + ".member."
+		if f.flattened {
+			prefix = name + "."
+		}
+		slice := reflect.MakeSlice(rv.Type(), 0, 0)
+		for n := 1; has(values, prefix+strconv.Itoa(n)); n++ {
+			elem := reflect.New(rv.Type().Elem()).Elem()
+			if err := decodeValue(values, prefix+strconv.Itoa(n), field{key: "key", value: "value"}, elem); err != nil {
+				return err
+			}
+			slice = reflect.Append(slice, elem)
+		}
+		if slice.Len() > 0 {
+			rv.Set(slice)
+		}
+		return nil
+
+	case reflect.Map:
+		prefix := name + ".entry."
+		if f.flattened {
+			prefix = name + "."
+		}
+		m := reflect.MakeMap(rv.Type())
+		for n := 1; has(values, prefix+strconv.Itoa(n)); n++ {
+			entry := prefix + strconv.Itoa(n) + "."
+			key := reflect.New(rv.Type().Key()).Elem()
+			if err := decodeValue(values, entry+f.key, field{}, key); err != nil {
+				return err
+			}
+			val := reflect.New(rv.Type().Elem()).Elem()
+			if err := decodeValue(values, entry+f.value, field{key: "key", value: "value"}, val); err != nil {
+				return err
+			}
+			m.SetMapIndex(key, val)
+		}
+		if m.Len() > 0 {
+			rv.Set(m)
+		}
+		return nil
+	}
+
+	raw, ok := values[name]
+	if !ok || len(raw) == 0 {
+		return nil
+	}
+	return decodeScalar(name, raw[0], rv)
+}
+
+func decodeScalar(name string, raw string, rv reflect.Value) error {
+	invalid := func() error {
+		return common.Errorf("InvalidParameterValue", "Value %v for parameter %v is invalid.", raw, name)
+	}
+
+	switch rv.Kind() {
+	case reflect.String:
+		rv.SetString(raw)
+
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return invalid()
+		}
+		rv.SetBool(b)
+
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, rv.Type().Bits())
+		if err != nil {
+			return invalid()
+		}
+		rv.SetInt(n)
+
+	case reflect.Float64:
+		n, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return invalid()
+		}
+		rv.SetFloat(n)
+
+	case reflect.Slice:
+		// []byte: blobs are base64 encoded.
+		b, err := base64.StdEncoding.DecodeString(raw)
+		if err != nil {
+			return invalid()
+		}
+		rv.SetBytes(b)
+
+	default:
+		panic(fmt.Sprintf("awsquery: can't decode %v", rv.Type()))
+	}
+	return nil
+}
@@ -0,0 +1,244 @@
+// Package awsquery serves services that speak the AWS query protocol: form
+// encoded requests naming an Action, and XML responses.
+package awsquery
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/fernomac/aws-local/pkg/common"
+)
+
+// Request is a query protocol request.
+type Request struct {
+	// HTTP is the underlying HTTP request.
+	HTTP *http.Request
+	// Params are the request parameters, from both the URL and the body.
+	Params url.Values
+}
+
+// Decode fills v, a pointer to a struct, from the request parameters.
+func (r *Request) Decode(v interface{}) error {
+	return Decode(r.Params, v)
+}
+
+// HandlerFunc is the type of function the Handler uses to handle things.
+type HandlerFunc func(*Request) (interface{}, error)
+
+// Handler handles HTTP requests.
+type Handler struct {
+	namespace string
+	source    string
+	handlers  map[string]HandlerFunc
+	statuses  map[string]int
+	observers []common.Observer
+}
+
+// NewHandler creates a new handler whose responses are in the given XML
+// namespace, e.g. "https://sts.amazonaws.com/doc/2011-06-15/".
+func NewHandler(namespace string) *Handler {
+	return &Handler{
+		namespace: namespace,
+		source:    namespace,
+		handlers:  make(map[string]HandlerFunc),
+		statuses:  make(map[string]int),
+	}
+}
+
+// HandleWith handles the given action with the given handler function.
+func (h *Handler) HandleWith(action string, handler HandlerFunc) {
+	h.handlers[action] = handler
+}
+
+// SetEventSource sets the event source reported to observers, e.g.
+// "sts.amazonaws.com". It defaults to the namespace.
+func (h *Handler) SetEventSource(source string) {
+	h.source = source
+}
+
+// StatusFor sets the HTTP status code returned for errors with the given code.
+// Errors default to 400, or 500 if they are not a common.Error.
+func (h *Handler) StatusFor(code string, status int) {
+	h.statuses[code] = status
+}
+
+// ObserveWith notifies the given observer of every call handled.
+func (h *Handler) ObserveWith(observer common.Observer) {
+	h.observers = append(h.observers, observer)
+}
+
+func (h *Handler) sendError(resp http.ResponseWriter, requestID string, err error) {
+	type errorDetail struct {
+		Type    string `xml:"Type"`
+		Code    string `xml:"Code"`
+		Message string `xml:"Message,omitempty"`
+	}
+	type errorResponse struct {
+		XMLName   xml.Name    `xml:"ErrorResponse"`
+		Namespace string      `xml:"xmlns,attr"`
+		Error     errorDetail `xml:"Error"`
+		RequestID string      `xml:"RequestId"`
+	}
+
+	status := 400
+	out := &errorResponse{
+		Namespace: h.namespace,
+		Error:     errorDetail{Type: "Sender"},
+		RequestID: requestID,
+	}
+
+	if ce, ok := err.(common.Error); ok {
+		out.Error.Code, out.Error.Message = ce.Code, ce.Message
+		if s, ok := h.statuses[ce.Code]; ok {
+			status = s
+		}
+	} else {
+		out.Error.Type, out.Error.Code, out.Error.Message = "Receiver", "InternalFailure", err.Error()
+		status = 500
+	}
+
+	body, err := xml.Marshal(out)
+	if err != nil {
+		panic(err)
+	}
+
+	resp.Header().Add("Content-Type", "text/xml")
+	resp.WriteHeader(status)
+	resp.Write(append([]byte(xml.Header), body...))
+}
+
+func (h *Handler) sendResult(resp http.ResponseWriter, action string, requestID string, out interface{}) error {
+	type responseMetadata struct {
+		RequestID string `xml:"RequestId"`
+	}
+
+	buf := &bytes.Buffer{}
+	enc := xml.NewEncoder(buf)
+
+	start := xml.StartElement{
+		Name: xml.Name{Local: action + "Response"},
+		Attr: []xml.Attr{{Name: xml.Name{Local: "xmlns"}, Value: h.namespace}},
+	}
+	if err := enc.EncodeToken(start); err != nil {
+		return err
+	}
+	if out != nil {
+		if err := enc.EncodeElement(out, xml.StartElement{Name: xml.Name{Local: action + "Result"}}); err != nil {
+			return err
+		}
+	}
+	if err := enc.EncodeElement(&responseMetadata{requestID}, xml.StartElement{Name: xml.Name{Local: "ResponseMetadata"}}); err != nil {
+		return err
+	}
+	if err := enc.EncodeToken(start.End()); err != nil {
+		return err
+	}
+	if err := enc.Flush(); err != nil {
+		return err
+	}
+
+	resp.Header().Add("Content-Type", "text/xml")
+	resp.WriteHeader(200)
+	resp.Write(append([]byte(xml.Header), buf.Bytes()...))
+	return nil
+}
+
+// params reads the request parameters from the URL and, for POSTs, the form
+// encoded body.
+func params(req *http.Request) (url.Values, error) {
+	values := req.URL.Query()
+	if req.Method != "POST" {
+		return values, nil
+	}
+
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return nil, err
+	}
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		return nil, common.Errorf("MalformedQueryString", "%v", err)
+	}
+	for name, vs := range form {
+		values[name] = append(values[name], vs...)
+	}
+	return values, nil
+}
+
+// input renders the request parameters as JSON for observers, which expect
+// JSON request bodies.
+func input(values url.Values) []byte {
+	flat := map[string]string{}
+	for name, vs := range values {
+		if name != "Action" && name != "Version" && len(vs) > 0 {
+			flat[name] = vs[0]
+		}
+	}
+	body, err := json.Marshal(flat)
+	if err != nil {
+		panic(err)
+	}
+	return body
+}
+
+func (h *Handler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	call := &common.Call{
+		EventSource: h.source,
+		RequestID:   common.NewRequestID(),
+		HTTP:        req,
+		Start:       time.Now(),
+	}
+	resp.Header().Set("x-amzn-RequestId", call.RequestID)
+
+	h.serve(resp, req, call)
+
+	if call.Operation == "" {
+		return
+	}
+	call.Duration = time.Since(call.Start)
+	for _, o := range h.observers {
+		o.Observe(call)
+	}
+}
+
+func (h *Handler) serve(resp http.ResponseWriter, req *http.Request, call *common.Call) {
+	if req.Method != "POST" && req.Method != "GET" {
+		resp.Header().Add("Content-Type", "text/xml")
+		resp.WriteHeader(405)
+		return
+	}
+
+	values, err := params(req)
+	if err != nil {
+		h.sendError(resp, call.RequestID, err)
+		return
+	}
+
+	action := values.Get("Action")
+	handler, ok := h.handlers[action]
+	if !ok {
+		h.sendError(resp, call.RequestID, common.Errorf("InvalidAction", "Could not find operation %v", action))
+		return
+	}
+
+	call.Operation = action
+	call.Input = input(values)
+
+	out, err := handler(&Request{HTTP: req, Params: values})
+	if err != nil {
+		call.Err = err
+		h.sendError(resp, call.RequestID, err)
+		return
+	}
+	call.Output = out
+
+	if err := h.sendResult(resp, action, call.RequestID, out); err != nil {
+		call.Err = err
+		h.sendError(resp, call.RequestID, err)
+	}
+}
@@ -0,0 +1,375 @@
+package awsrest
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fernomac/aws-local/pkg/common"
+)
+
+// Request is an incoming request that has been matched to a route.
+type Request struct {
+	// HTTP is the underlying HTTP request.
+	HTTP *http.Request
+	// Params holds the values bound to the labels in the route's template.
+	Params map[string]string
+	// Query holds the parsed query string.
+	Query url.Values
+	// Header holds the request headers.
+	Header http.Header
+	// Body holds the request body.
+	Body []byte
+	// Operation is the name of the operation, as reported to observers.
+	// Handlers for routes serving several operations, like S3's PutObject
+	// and CopyObject, set it to the one they do.
+	Operation string
+
+	protocol Protocol
+}
+
+// Bind maps the request into the struct pointed to by v.
+//
+// Fields are bound according to their `location` tag, named by their
+// `locationName` tag (or the field name if absent):
+//
+//	location:"uri"          a label from the URI template
+//	location:"querystring"  a query string parameter
+//	location:"header"       a single header
+//	location:"headers"      all headers with the locationName prefix, as a map
+//	location:"payload"      the whole body; raw if []byte, decoded otherwise
+//
+// If no field is tagged as the payload, the body is decoded into v itself,
+// so bound fields should be tagged `json:"-"` or `xml:"-"`.
+func (r *Request) Bind(v interface{}) error {
+	ptr := reflect.ValueOf(v)
+	if ptr.Kind() != reflect.Ptr || ptr.Elem().Kind() != reflect.Struct {
+		return errors.New("awsrest: Bind requires a pointer to a struct")
+	}
+	val := ptr.Elem()
+	typ := val.Type()
+
+	payload := -1
+	for i := 0; i < typ.NumField(); i++ {
+		if typ.Field(i).Tag.Get("location") == "payload" {
+			payload = i
+			break
+		}
+	}
+
+	if payload >= 0 {
+		field := val.Field(payload)
+		if field.Type() == reflect.TypeOf([]byte(nil)) {
+			field.SetBytes(r.Body)
+		} else if len(r.Body) > 0 {
+			if err := r.protocol.unmarshal(r.Body, field.Addr().Interface()); err != nil {
+				return common.Errorf("SerializationException", "%v", err)
+			}
+		}
+	} else if len(r.Body) > 0 {
+		if err := r.protocol.unmarshal(r.Body, v); err != nil {
+			return common.Errorf("SerializationException", "%v", err)
+		}
+	}
+
+	for i := 0; i < typ.NumField(); i++ {
+		sf := typ.Field(i)
+		name := sf.Tag.Get("locationName")
+		if name == "" {
+			name = sf.Name
+		}
+
+		var err error
+		switch sf.Tag.Get("location") {
+		case "uri":
+			if str, ok := r.Params[name]; ok {
+				err = setValue(val.Field(i), []string{str}, false)
+			}
+		case "querystring":
+			if strs, ok := r.Query[name]; ok {
+				err = setValue(val.Field(i), strs, false)
+			}
+		case "header":
+			if strs, ok := r.Header[http.CanonicalHeaderKey(name)]; ok {
+				err = setValue(val.Field(i), strs, true)
+			}
+		case "headers":
+			err = setPrefixed(val.Field(i), r.Header, name)
+		}
+
+		if err != nil {
+			return common.Errorf("SerializationException", "invalid value for %v: %v", name, err)
+		}
+	}
+
+	return nil
+}
+
+func setValue(field reflect.Value, strs []string, header bool) error {
+	if field.Kind() == reflect.Ptr {
+		elem := reflect.New(field.Type().Elem())
+		if err := setValue(elem.Elem(), strs, header); err != nil {
+			return err
+		}
+		field.Set(elem)
+		return nil
+	}
+
+	if field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.String {
+		if header && len(strs) == 1 {
+			strs = strings.Split(strs[0], ",")
+			for i := range strs {
+				strs[i] = strings.TrimSpace(strs[i])
+			}
+		}
+		field.Set(reflect.ValueOf(append([]string(nil), strs...)))
+		return nil
+	}
+
+	str := strs[0]
+
+	if field.Type() == reflect.TypeOf(time.Time{}) {
+		t, err := parseTime(str, header)
+		if err != nil {
+			return err
+		}
+		field.Set(reflect.ValueOf(t))
+		return nil
+	}
+
+	if field.Type() == reflect.TypeOf([]byte(nil)) {
+		raw, err := base64.StdEncoding.DecodeString(str)
+		if err != nil {
+			return err
+		}
+		field.SetBytes(raw)
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(str)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(str)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(str, 10, 64)
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(str, 64)
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	default:
+		return errors.New("unsupported field type " + field.Type().String())
+	}
+
+	return nil
+}
+
+func setPrefixed(field reflect.Value, header http.Header, prefix string) error {
+	if field.Type() != reflect.TypeOf(map[string]string(nil)) {
+		return errors.New("headers location requires a map[string]string")
+	}
+
+	prefix = strings.ToLower(prefix)
+	out := map[string]string{}
+	for name, values := range header {
+		lower := strings.ToLower(name)
+		if strings.HasPrefix(lower, prefix) && len(values) > 0 {
+			out[lower[len(prefix):]] = values[0]
+		}
+	}
+
+	if len(out) > 0 {
+		field.Set(reflect.ValueOf(out))
+	}
+	return nil
+}
+
+func parseTime(str string, header bool) (time.Time, error) {
+	if header {
+		if t, err := http.ParseTime(str); err == nil {
+			return t, nil
+		}
+	}
+	if t, err := time.Parse(time.RFC3339Nano, str); err == nil {
+		return t, nil
+	}
+	if secs, err := strconv.ParseFloat(str, 64); err == nil {
+		return time.Unix(0, int64(secs*float64(time.Second))).UTC(), nil
+	}
+	return time.Time{}, errors.New("unrecognized timestamp " + str)
+}
+
+func formatValue(field reflect.Value) (string, bool) {
+	if field.Kind() == reflect.Ptr {
+		if field.IsNil() {
+			return "", false
+		}
+		field = field.Elem()
+	}
+
+	if t, ok := field.Interface().(time.Time); ok {
+		if t.IsZero() {
+			return "", false
+		}
+		return t.UTC().Format(http.TimeFormat), true
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		return field.String(), field.String() != ""
+	case reflect.Bool:
+		return strconv.FormatBool(field.Bool()), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(field.Int(), 10), true
+	case reflect.Slice:
+		if field.Type().Elem().Kind() == reflect.String && field.Len() > 0 {
+			return strings.Join(field.Interface().([]string), ","), true
+		}
+	}
+
+	return "", false
+}
+
+// writeResponse writes out as the response, honoring the same `location`
+// tags as Bind. A `location:"statusCode"` int field overrides the status.
+// Structs whose fields all have locations other than payload have no body.
+func writeResponse(resp http.ResponseWriter, protocol Protocol, out interface{}) error {
+	if out == nil {
+		resp.WriteHeader(200)
+		return nil
+	}
+
+	val := reflect.ValueOf(out)
+	for val.Kind() == reflect.Ptr {
+		if val.IsNil() {
+			resp.WriteHeader(200)
+			return nil
+		}
+		val = val.Elem()
+	}
+
+	status := 200
+	var body interface{} = out
+	var raw io.Reader
+
+	if val.Kind() == reflect.Struct {
+		// A struct with neither a payload nor any unlocated members has
+		// no body at all.
+		members := false
+		typ := val.Type()
+		for i := 0; i < typ.NumField(); i++ {
+			sf := typ.Field(i)
+			name := sf.Tag.Get("locationName")
+			if name == "" {
+				name = sf.Name
+			}
+
+			switch sf.Tag.Get("location") {
+			case "":
+				if sf.Name != "XMLName" && sf.PkgPath == "" {
+					members = true
+				}
+			case "header":
+				if str, ok := formatValue(val.Field(i)); ok {
+					resp.Header().Set(name, str)
+				}
+			case "headers":
+				if m, ok := val.Field(i).Interface().(map[string]string); ok {
+					for k, v := range m {
+						resp.Header().Set(name+k, v)
+					}
+				}
+			case "statusCode":
+				if n := val.Field(i).Int(); n != 0 {
+					status = int(n)
+				}
+			case "payload":
+				members = true
+				field := val.Field(i)
+				switch p := field.Interface().(type) {
+				case []byte:
+					raw = strings.NewReader(string(p))
+				case io.Reader:
+					raw = p
+				default:
+					if field.Kind() == reflect.Ptr && field.IsNil() {
+						body = nil
+					} else {
+						body = p
+					}
+				}
+			}
+		}
+		if !members {
+			body = nil
+		}
+	}
+
+	if raw != nil {
+		if c, ok := raw.(io.Closer); ok {
+			defer c.Close()
+		}
+		resp.WriteHeader(status)
+		_, err := io.Copy(resp, raw)
+		return err
+	}
+
+	var encoded []byte
+	if body != nil {
+		var err error
+		encoded, err = protocol.marshal(body)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(encoded) > 0 {
+		resp.Header().Set("Content-Type", protocol.contentType())
+	}
+	resp.WriteHeader(status)
+	_, err := resp.Write(encoded)
+	return err
+}
+
+func (p Protocol) contentType() string {
+	if p == XML {
+		return "application/xml"
+	}
+	return "application/json"
+}
+
+func (p Protocol) marshal(v interface{}) ([]byte, error) {
+	if p == XML {
+		out, err := xml.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte(xml.Header), out...), nil
+	}
+	return json.Marshal(v)
+}
+
+func (p Protocol) unmarshal(data []byte, v interface{}) error {
+	if p == XML {
+		return xml.Unmarshal(data, v)
+	}
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,278 @@
+package awsrest
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fernomac/aws-local/pkg/common"
+)
+
+// Protocol is the wire format used for request and response bodies.
+type Protocol int
+
+const (
+	// JSON is the restJson1 protocol.
+	JSON Protocol = iota
+	// XML is the restXml protocol.
+	XML
+)
+
+// HandlerFunc is the type of function the Router uses to handle things.
+type HandlerFunc func(*Request) (interface{}, error)
+
+type route struct {
+	operation string
+	method    string
+	template  *template
+	handler   HandlerFunc
+	order     int
+}
+
+// Router routes REST requests to handlers by HTTP method and URI template.
+type Router struct {
+	protocol  Protocol
+	source    string
+	routes    []*route
+	statuses  map[string]int
+	observers []common.Observer
+}
+
+// NewRouter creates a new router speaking the given protocol.
+func NewRouter(protocol Protocol) *Router {
+	return &Router{
+		protocol: protocol,
+		statuses: make(map[string]int),
+	}
+}
+
+// HandleWith handles the named operation: requests with the given method
+// whose path matches the given template. Templates look like
+// "/functions/{FunctionName}" and may end with a greedy label
+// ("/{Bucket}/{Key+}") or required query parameters ("/{Bucket}?uploads",
+// "/{Bucket}?list-type=2").
+func (r *Router) HandleWith(operation string, method string, tmpl string, handler HandlerFunc) {
+	t, err := parseTemplate(tmpl)
+	if err != nil {
+		panic(err)
+	}
+
+	r.routes = append(r.routes, &route{
+		operation: operation,
+		method:    method,
+		template:  t,
+		handler:   handler,
+		order:     len(r.routes),
+	})
+
+	// Most specific routes first: required query parameters, then literal
+	// segments, then registration order.
+	sort.SliceStable(r.routes, func(i, j int) bool {
+		a, b := r.routes[i].template, r.routes[j].template
+		if len(a.query) != len(b.query) {
+			return len(a.query) > len(b.query)
+		}
+		if a.literals() != b.literals() {
+			return a.literals() > b.literals()
+		}
+		return r.routes[i].order < r.routes[j].order
+	})
+}
+
+// SetEventSource sets the event source reported to observers, e.g.
+// "s3.amazonaws.com".
+func (r *Router) SetEventSource(source string) {
+	r.source = source
+}
+
+// ObserveWith notifies the given observer of every call handled.
+func (r *Router) ObserveWith(observer common.Observer) {
+	r.observers = append(r.observers, observer)
+}
+
+// StatusFor sets the HTTP status code returned for errors with the given code.
+// Errors default to 400, or 500 if they are not a common.Error.
+func (r *Router) StatusFor(code string, status int) {
+	r.statuses[code] = status
+}
+
+func (r *Router) sendError(resp http.ResponseWriter, req *http.Request, requestID string, err error) {
+	status := 400
+	code, msg := "", ""
+
+	if ce, ok := err.(common.Error); ok {
+		code, msg = ce.Code, ce.Message
+		if s, ok := r.statuses[code]; ok {
+			status = s
+		}
+	} else {
+		code, msg = "InternalFailure", err.Error()
+		status = 500
+	}
+
+	var body []byte
+	if r.protocol == XML {
+		type xmlError struct {
+			XMLName   xml.Name `xml:"Error"`
+			Code      string   `xml:"Code"`
+			Message   string   `xml:"Message,omitempty"`
+			RequestID string   `xml:"RequestId"`
+		}
+		out, err := xml.Marshal(&xmlError{Code: code, Message: msg, RequestID: requestID})
+		if err != nil {
+			panic(err)
+		}
+		body = append([]byte(xml.Header), out...)
+	} else {
+		out := map[string]string{"__type": code}
+		if msg != "" {
+			out["message"] = msg
+		}
+		var err error
+		body, err = json.Marshal(out)
+		if err != nil {
+			panic(err)
+		}
+		resp.Header().Add("X-Amzn-ErrorType", code)
+	}
+
+	resp.Header().Add("Content-Type", r.protocol.contentType())
+	resp.WriteHeader(status)
+
+	if req.Method != "HEAD" {
+		resp.Write(body)
+	}
+}
+
+func (r *Router) match(req *http.Request) (*route, map[string]string, bool) {
+	query := req.URL.Query()
+	path := req.URL.EscapedPath()
+
+	pathMatched := false
+	for _, rt := range r.routes {
+		params, ok := rt.template.match(path, query)
+		if !ok {
+			continue
+		}
+		if rt.method == req.Method {
+			return rt, params, true
+		}
+		pathMatched = true
+	}
+
+	return nil, nil, pathMatched
+}
+
+// requestIDHeader is the header the request ID is returned in.
+func (p Protocol) requestIDHeader() string {
+	if p == XML {
+		return "x-amz-request-id"
+	}
+	return "x-amzn-RequestId"
+}
+
+// input renders the bound labels and query parameters, and for restJson1
+// the members of the body, as JSON for observers, which expect JSON request
+// bodies. restXml bodies are left out; they are often object data. So are
+// the X-Amz- parameters of presigned URLs, which hold their signatures.
+func (r *Router) input(params map[string]string, query url.Values, body []byte) []byte {
+	flat := map[string]interface{}{}
+	if r.protocol == JSON && len(body) > 0 {
+		json.Unmarshal(body, &flat)
+	}
+	for name, vs := range query {
+		if len(vs) > 0 && !strings.HasPrefix(name, "X-Amz-") {
+			flat[name] = vs[0]
+		}
+	}
+	for name, value := range params {
+		flat[name] = value
+	}
+	out, err := json.Marshal(flat)
+	if err != nil {
+		panic(err)
+	}
+	return out
+}
+
+func (r *Router) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	call := &common.Call{
+		EventSource: r.source,
+		RequestID:   common.NewRequestID(),
+		HTTP:        req,
+		Start:       time.Now(),
+	}
+	resp.Header().Set(r.protocol.requestIDHeader(), call.RequestID)
+
+	r.serve(resp, req, call)
+
+	if call.Operation == "" {
+		return
+	}
+	call.Duration = time.Since(call.Start)
+	for _, o := range r.observers {
+		o.Observe(call)
+	}
+}
+
+func (r *Router) serve(resp http.ResponseWriter, req *http.Request, call *common.Call) {
+	rt, params, pathMatched := r.match(req)
+	if rt == nil {
+		if pathMatched {
+			resp.Header().Add("Content-Type", r.protocol.contentType())
+			resp.WriteHeader(405)
+			return
+		}
+		r.sendError(resp, req, call.RequestID, common.NewError("UnknownOperationException"))
+		return
+	}
+
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		resp.WriteHeader(500)
+		return
+	}
+
+	query := req.URL.Query()
+	call.Input = r.input(params, query, body)
+
+	in := &Request{
+		HTTP:      req,
+		Params:    params,
+		Query:     query,
+		Header:    req.Header,
+		Body:      body,
+		Operation: rt.operation,
+		protocol:  r.protocol,
+	}
+	out, err := rt.handler(in)
+	call.Operation = in.Operation
+	if err != nil {
+		call.Err = err
+		r.sendError(resp, req, call.RequestID, err)
+		return
+	}
+	call.Output = out
+
+	if req.Method == "HEAD" {
+		resp = headWriter{resp}
+	}
+
+	if err := writeResponse(resp, r.protocol, out); err != nil {
+		call.Err = err
+	}
+}
+
+// headWriter drops the body of responses to HEAD requests.
+type headWriter struct {
+	http.ResponseWriter
+}
+
+func (w headWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
@@ -0,0 +1,152 @@
+package awsrest
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// segment is a single piece of a path template.
+type segment struct {
+	literal string
+	label   string
+	greedy  bool
+}
+
+// template is a parsed URI template such as "/{Bucket}/{Key+}?uploads".
+type template struct {
+	segments []segment
+	query    map[string]string
+}
+
+func parseTemplate(str string) (*template, error) {
+	if !strings.HasPrefix(str, "/") {
+		return nil, fmt.Errorf("template %q must start with a slash", str)
+	}
+
+	path, query := str, ""
+	if i := strings.IndexByte(str, '?'); i >= 0 {
+		path, query = str[:i], str[i+1:]
+	}
+
+	t := &template{
+		query: map[string]string{},
+	}
+
+	parts := strings.Split(path[1:], "/")
+	if len(parts) == 1 && parts[0] == "" {
+		parts = nil
+	}
+
+	for i, part := range parts {
+		if strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}") {
+			label := part[1 : len(part)-1]
+			greedy := strings.HasSuffix(label, "+")
+			if greedy {
+				label = label[:len(label)-1]
+				if i != len(parts)-1 {
+					return nil, fmt.Errorf("greedy label in %q must be last", str)
+				}
+			}
+			if label == "" {
+				return nil, fmt.Errorf("empty label in %q", str)
+			}
+			t.segments = append(t.segments, segment{label: label, greedy: greedy})
+		} else {
+			t.segments = append(t.segments, segment{literal: part})
+		}
+	}
+
+	if query != "" {
+		for _, pair := range strings.Split(query, "&") {
+			name, value := pair, ""
+			if i := strings.IndexByte(pair, '='); i >= 0 {
+				name, value = pair[:i], pair[i+1:]
+			}
+			t.query[name] = value
+		}
+	}
+
+	return t, nil
+}
+
+// literals returns the number of literal segments, used to rank templates.
+func (t *template) literals() int {
+	n := 0
+	for _, seg := range t.segments {
+		if seg.label == "" {
+			n++
+		}
+	}
+	return n
+}
+
+// greedy reports whether the template ends with a greedy label.
+func (t *template) greedy() bool {
+	return len(t.segments) > 0 && t.segments[len(t.segments)-1].greedy
+}
+
+// match matches the given escaped path and query against the template,
+// returning the bound labels.
+func (t *template) match(path string, query url.Values) (map[string]string, bool) {
+	for name, value := range t.query {
+		if _, ok := query[name]; !ok {
+			return nil, false
+		}
+		if value != "" && query.Get(name) != value {
+			return nil, false
+		}
+	}
+
+	path = strings.TrimPrefix(path, "/")
+
+	var parts []string
+	if path != "" {
+		parts = strings.Split(path, "/")
+	}
+
+	// Tolerate a single trailing slash on non-greedy templates. Greedy labels
+	// keep it: "dir/" is a different S3 key from "dir".
+	if len(parts) == len(t.segments)+1 && parts[len(parts)-1] == "" && !t.greedy() {
+		parts = parts[:len(parts)-1]
+	}
+
+	params := map[string]string{}
+
+	for i, seg := range t.segments {
+		if seg.greedy {
+			if i >= len(parts) {
+				return nil, false
+			}
+			value, err := url.PathUnescape(strings.Join(parts[i:], "/"))
+			if err != nil || value == "" {
+				return nil, false
+			}
+			params[seg.label] = value
+			return params, true
+		}
+
+		if i >= len(parts) {
+			return nil, false
+		}
+
+		if seg.label == "" {
+			if parts[i] != seg.literal {
+				return nil, false
+			}
+			continue
+		}
+
+		value, err := url.PathUnescape(parts[i])
+		if err != nil || value == "" {
+			return nil, false
+		}
+		params[seg.label] = value
+	}
+
+	if len(parts) != len(t.segments) {
+		return nil, false
+	}
+
+	return params, true
+}
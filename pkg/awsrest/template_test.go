@@ -0,0 +1,79 @@
+package awsrest
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/fernomac/aws-local/pkg/common"
+)
+
+func TestTemplateMatch(t *testing.T) {
+	tests := []struct {
+		tmpl  string
+		path  string
+		query string
+		want  map[string]string
+	}{
+		{"/", "/", "", map[string]string{}},
+		{"/{Bucket}", "/b", "", map[string]string{"Bucket": "b"}},
+		{"/{Bucket}", "/b/", "", map[string]string{"Bucket": "b"}},
+		{"/{Bucket}", "/b/c", "", nil},
+		{"/{Bucket}/{Key+}", "/b/dir/file.txt", "", map[string]string{"Bucket": "b", "Key": "dir/file.txt"}},
+		{"/{Bucket}/{Key+}", "/b/dir/", "", map[string]string{"Bucket": "b", "Key": "dir/"}},
+		{"/{Bucket}/{Key+}", "/b/a%20b", "", map[string]string{"Bucket": "b", "Key": "a b"}},
+		{"/{Bucket}/{Key+}", "/b", "", nil},
+		{"/{Bucket}/{Key+}", "/b/", "", nil},
+		{"/{Bucket}?uploads", "/b", "uploads", map[string]string{"Bucket": "b"}},
+		{"/{Bucket}?uploads", "/b", "", nil},
+		{"/{Bucket}?list-type=2", "/b", "list-type=2", map[string]string{"Bucket": "b"}},
+		{"/{Bucket}?list-type=2", "/b", "list-type=1", nil},
+		{"/functions/{FunctionName}", "/functions/f", "", map[string]string{"FunctionName": "f"}},
+		{"/functions/{FunctionName}", "/layers/f", "", nil},
+	}
+
+	for _, test := range tests {
+		tmpl, err := parseTemplate(test.tmpl)
+		if err != nil {
+			t.Fatalf("%v: %v", test.tmpl, err)
+		}
+		query, _ := url.ParseQuery(test.query)
+		got, ok := tmpl.match(test.path, query)
+		if test.want == nil {
+			if ok {
+				t.Errorf("%v %v?%v: matched %v", test.tmpl, test.path, test.query, got)
+			}
+			continue
+		}
+		if !ok || !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%v %v?%v: got %v, %v, want %v", test.tmpl, test.path, test.query, got, ok, test.want)
+		}
+	}
+}
+
+func TestParseTemplateErrors(t *testing.T) {
+	for _, tmpl := range []string{"noslash", "/{Key+}/more", "/{}"} {
+		if _, err := parseTemplate(tmpl); err == nil {
+			t.Errorf("%v: no error", tmpl)
+		}
+	}
+}
+
+type observerFunc func(*common.Call)
+
+func (f observerFunc) Observe(call *common.Call) { f(call) }
+
+func TestWriteResponseErrorIsObserved(t *testing.T) {
+	r := NewRouter(JSON)
+	var observed *common.Call
+	r.ObserveWith(observerFunc(func(call *common.Call) { observed = call }))
+	r.HandleWith("Broken", "GET", "/broken", func(*Request) (interface{}, error) {
+		return &struct{ C chan int }{}, nil
+	})
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/broken", nil))
+	if observed == nil || observed.Err == nil {
+		t.Fatalf("marshalling error not recorded: %+v", observed)
+	}
+}
@@ -0,0 +1,7 @@
+package common
+
+// AccountID is the account that owns every local resource.
+const AccountID = "000000000000"
+
+// Region is the region every local service runs in.
+const Region = "us-local-1"
@@ -0,0 +1,57 @@
+package common
+
+import (
+	"crypto/rand"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Call describes a single API call handled by a service.
+type Call struct {
+	// EventSource identifies the service, e.g. "kms.amazonaws.com".
+	EventSource string
+	// Operation is the name of the operation, e.g. "Encrypt".
+	Operation string
+	// RequestID is the request ID returned to the caller.
+	RequestID string
+	// HTTP is the underlying HTTP request.
+	HTTP *http.Request
+	// Input is the raw request body.
+	Input []byte
+	// Output is the result returned by the service, if any.
+	Output interface{}
+	// Err is the error returned by the service, if any.
+	Err error
+	// Start is when the call started.
+	Start time.Time
+	// Duration is how long the call took.
+	Duration time.Duration
+}
+
+// ErrorCode returns the error code for the call, or "" if it succeeded.
+func (c *Call) ErrorCode() string {
+	if c.Err == nil {
+		return ""
+	}
+	if ce, ok := c.Err.(Error); ok {
+		return ce.Code
+	}
+	return "InternalFailure"
+}
+
+// Observer is notified of every call a service handles.
+type Observer interface {
+	Observe(call *Call)
+}
+
+// NewRequestID makes a new random request ID.
+func NewRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	b[6] = (b[6] & 0x0F) | 0x40
+	b[8] = (b[8] & 0x3F) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
@@ -0,0 +1,18 @@
+package common
+
+import "time"
+
+// Clock tells the time. Services that care about expiry take one so that
+// tests can move time along.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// SystemClock is the real clock.
+var SystemClock Clock = systemClock{}
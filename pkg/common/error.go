@@ -19,7 +19,7 @@ func NewError(code string) Error {
 func Errorf(code string, message string, v ...interface{}) Error {
 	return Error{
 		Code:    code,
-		Message: fmt.Sprintf(message, v),
+		Message: fmt.Sprintf(message, v...),
 	}
 }
 
@@ -0,0 +1,290 @@
+package dynamodb
+
+// DynamoDB is the service interface for Amazon DynamoDB.
+type DynamoDB interface {
+	CreateTable(*CreateTableRequest) (*CreateTableResult, error)
+	DescribeTable(*DescribeTableRequest) (*DescribeTableResult, error)
+	DeleteTable(*DeleteTableRequest) (*DeleteTableResult, error)
+	ListTables(*ListTablesRequest) (*ListTablesResult, error)
+
+	PutItem(*PutItemRequest) (*PutItemResult, error)
+	GetItem(*GetItemRequest) (*GetItemResult, error)
+	UpdateItem(*UpdateItemRequest) (*UpdateItemResult, error)
+	DeleteItem(*DeleteItemRequest) (*DeleteItemResult, error)
+
+	Query(*QueryRequest) (*QueryResult, error)
+	Scan(*ScanRequest) (*ScanResult, error)
+}
+
+// Item is an item: attribute names to values.
+type Item map[string]*AttributeValue
+
+// Tag is a tag key/value pair.
+type Tag struct {
+	Key   string `json:"Key"`
+	Value string `json:"Value"`
+}
+
+// AttributeDefinition gives the type of a key attribute: S, N or B.
+type AttributeDefinition struct {
+	AttributeName string `json:"AttributeName"`
+	AttributeType string `json:"AttributeType"`
+}
+
+// KeySchemaElement is part of a primary key. KeyType is HASH or RANGE.
+type KeySchemaElement struct {
+	AttributeName string `json:"AttributeName"`
+	KeyType       string `json:"KeyType"`
+}
+
+// Projection says which attributes an index copies. ProjectionType is
+// KEYS_ONLY, INCLUDE or ALL.
+type Projection struct {
+	NonKeyAttributes []string `json:"NonKeyAttributes,omitempty"`
+	ProjectionType   string   `json:"ProjectionType"`
+}
+
+// ProvisionedThroughput is the capacity of a provisioned table or index.
+type ProvisionedThroughput struct {
+	ReadCapacityUnits  int64 `json:"ReadCapacityUnits"`
+	WriteCapacityUnits int64 `json:"WriteCapacityUnits"`
+}
+
+// ProvisionedThroughputDescription describes the capacity of a table or
+// index.
+type ProvisionedThroughputDescription struct {
+	NumberOfDecreasesToday int64 `json:"NumberOfDecreasesToday"`
+	ReadCapacityUnits      int64 `json:"ReadCapacityUnits"`
+	WriteCapacityUnits     int64 `json:"WriteCapacityUnits"`
+}
+
+// SecondaryIndex is a global or local secondary index to create.
+type SecondaryIndex struct {
+	IndexName             string                 `json:"IndexName"`
+	KeySchema             []KeySchemaElement     `json:"KeySchema"`
+	Projection            Projection             `json:"Projection"`
+	ProvisionedThroughput *ProvisionedThroughput `json:"ProvisionedThroughput,omitempty"`
+}
+
+// SecondaryIndexDescription describes a global or local secondary index.
+type SecondaryIndexDescription struct {
+	IndexArn              string                            `json:"IndexArn"`
+	IndexName             string                            `json:"IndexName"`
+	IndexSizeBytes        int64                             `json:"IndexSizeBytes"`
+	IndexStatus           string                            `json:"IndexStatus,omitempty"`
+	ItemCount             int64                             `json:"ItemCount"`
+	KeySchema             []KeySchemaElement                `json:"KeySchema"`
+	Projection            Projection                        `json:"Projection"`
+	ProvisionedThroughput *ProvisionedThroughputDescription `json:"ProvisionedThroughput,omitempty"`
+}
+
+// SSESpecification asks for a table to be encrypted at rest with a KMS key.
+type SSESpecification struct {
+	Enabled        bool   `json:"Enabled"`
+	KMSMasterKeyID string `json:"KMSMasterKeyId"`
+	SSEType        string `json:"SSEType"`
+}
+
+// SSEDescription describes how a table is encrypted at rest.
+type SSEDescription struct {
+	InaccessibleEncryptionDateTime int64  `json:"InaccessibleEncryptionDateTime,omitempty"`
+	KMSMasterKeyArn                string `json:"KMSMasterKeyArn,omitempty"`
+	SSEType                        string `json:"SSEType,omitempty"`
+	Status                         string `json:"Status"`
+}
+
+// BillingModeSummary describes how a table is billed.
+type BillingModeSummary struct {
+	BillingMode string `json:"BillingMode"`
+}
+
+// TableDescription describes a table.
+type TableDescription struct {
+	AttributeDefinitions   []AttributeDefinition             `json:"AttributeDefinitions"`
+	BillingModeSummary     *BillingModeSummary               `json:"BillingModeSummary,omitempty"`
+	CreationDateTime       int64                             `json:"CreationDateTime"`
+	GlobalSecondaryIndexes []SecondaryIndexDescription       `json:"GlobalSecondaryIndexes,omitempty"`
+	ItemCount              int64                             `json:"ItemCount"`
+	KeySchema              []KeySchemaElement                `json:"KeySchema"`
+	LocalSecondaryIndexes  []SecondaryIndexDescription       `json:"LocalSecondaryIndexes,omitempty"`
+	ProvisionedThroughput  *ProvisionedThroughputDescription `json:"ProvisionedThroughput"`
+	SSEDescription         *SSEDescription                   `json:"SSEDescription,omitempty"`
+	TableArn               string                            `json:"TableArn"`
+	TableID                string                            `json:"TableId"`
+	TableName              string                            `json:"TableName"`
+	TableSizeBytes         int64                             `json:"TableSizeBytes"`
+	TableStatus            string                            `json:"TableStatus"`
+}
+
+//
+// API shapes for tables.
+//
+
+// CreateTableRequest is a request to CreateTable.
+type CreateTableRequest struct {
+	AttributeDefinitions   []AttributeDefinition  `json:"AttributeDefinitions"`
+	BillingMode            string                 `json:"BillingMode"`
+	GlobalSecondaryIndexes []SecondaryIndex       `json:"GlobalSecondaryIndexes"`
+	KeySchema              []KeySchemaElement     `json:"KeySchema"`
+	LocalSecondaryIndexes  []SecondaryIndex       `json:"LocalSecondaryIndexes"`
+	ProvisionedThroughput  *ProvisionedThroughput `json:"ProvisionedThroughput"`
+	SSESpecification       *SSESpecification      `json:"SSESpecification"`
+	TableName              string                 `json:"TableName"`
+	Tags                   []Tag                  `json:"Tags"`
+}
+
+// CreateTableResult is the result of CreateTable.
+type CreateTableResult struct {
+	TableDescription *TableDescription `json:"TableDescription"`
+}
+
+// DescribeTableRequest is a request to DescribeTable.
+type DescribeTableRequest struct {
+	TableName string `json:"TableName"`
+}
+
+// DescribeTableResult is the result of DescribeTable.
+type DescribeTableResult struct {
+	Table *TableDescription `json:"Table"`
+}
+
+// DeleteTableRequest is a request to DeleteTable.
+type DeleteTableRequest struct {
+	TableName string `json:"TableName"`
+}
+
+// DeleteTableResult is the result of DeleteTable.
+type DeleteTableResult struct {
+	TableDescription *TableDescription `json:"TableDescription"`
+}
+
+// ListTablesRequest is a request to ListTables.
+type ListTablesRequest struct {
+	ExclusiveStartTableName string `json:"ExclusiveStartTableName"`
+	Limit                   int    `json:"Limit"`
+}
+
+// ListTablesResult is the result of ListTables.
+type ListTablesResult struct {
+	LastEvaluatedTableName string   `json:"LastEvaluatedTableName,omitempty"`
+	TableNames             []string `json:"TableNames"`
+}
+
+//
+// API shapes for items.
+//
+
+// PutItemRequest is a request to PutItem. ReturnValues is NONE or ALL_OLD.
+type PutItemRequest struct {
+	ConditionExpression       string                     `json:"ConditionExpression"`
+	ExpressionAttributeNames  map[string]string          `json:"ExpressionAttributeNames"`
+	ExpressionAttributeValues map[string]*AttributeValue `json:"ExpressionAttributeValues"`
+	Item                      Item                       `json:"Item"`
+	ReturnValues              string                     `json:"ReturnValues"`
+	TableName                 string                     `json:"TableName"`
+}
+
+// PutItemResult is the result of PutItem.
+type PutItemResult struct {
+	Attributes Item `json:"Attributes,omitempty"`
+}
+
+// GetItemRequest is a request to GetItem.
+type GetItemRequest struct {
+	ConsistentRead           bool              `json:"ConsistentRead"`
+	ExpressionAttributeNames map[string]string `json:"ExpressionAttributeNames"`
+	Key                      Item              `json:"Key"`
+	ProjectionExpression     string            `json:"ProjectionExpression"`
+	TableName                string            `json:"TableName"`
+}
+
+// GetItemResult is the result of GetItem.
+type GetItemResult struct {
+	Item Item `json:"Item,omitempty"`
+}
+
+// UpdateItemRequest is a request to UpdateItem. ReturnValues is NONE,
+// ALL_OLD, UPDATED_OLD, ALL_NEW or UPDATED_NEW.
+type UpdateItemRequest struct {
+	ConditionExpression       string                     `json:"ConditionExpression"`
+	ExpressionAttributeNames  map[string]string          `json:"ExpressionAttributeNames"`
+	ExpressionAttributeValues map[string]*AttributeValue `json:"ExpressionAttributeValues"`
+	Key                       Item                       `json:"Key"`
+	ReturnValues              string                     `json:"ReturnValues"`
+	TableName                 string                     `json:"TableName"`
+	UpdateExpression          string                     `json:"UpdateExpression"`
+}
+
+// UpdateItemResult is the result of UpdateItem.
+type UpdateItemResult struct {
+	Attributes Item `json:"Attributes,omitempty"`
+}
+
+// DeleteItemRequest is a request to DeleteItem. ReturnValues is NONE or
+// ALL_OLD.
+type DeleteItemRequest struct {
+	ConditionExpression       string                     `json:"ConditionExpression"`
+	ExpressionAttributeNames  map[string]string          `json:"ExpressionAttributeNames"`
+	ExpressionAttributeValues map[string]*AttributeValue `json:"ExpressionAttributeValues"`
+	Key                       Item                       `json:"Key"`
+	ReturnValues              string                     `json:"ReturnValues"`
+	TableName                 string                     `json:"TableName"`
+}
+
+// DeleteItemResult is the result of DeleteItem.
+type DeleteItemResult struct {
+	Attributes Item `json:"Attributes,omitempty"`
+}
+
+//
+// API shapes for queries.
+//
+
+// QueryRequest is a request to Query. Select is ALL_ATTRIBUTES,
+// ALL_PROJECTED_ATTRIBUTES, SPECIFIC_ATTRIBUTES or COUNT.
+type QueryRequest struct {
+	ConsistentRead            bool                       `json:"ConsistentRead"`
+	ExclusiveStartKey         Item                       `json:"ExclusiveStartKey"`
+	ExpressionAttributeNames  map[string]string          `json:"ExpressionAttributeNames"`
+	ExpressionAttributeValues map[string]*AttributeValue `json:"ExpressionAttributeValues"`
+	FilterExpression          string                     `json:"FilterExpression"`
+	IndexName                 string                     `json:"IndexName"`
+	KeyConditionExpression    string                     `json:"KeyConditionExpression"`
+	Limit                     int                        `json:"Limit"`
+	ProjectionExpression      string                     `json:"ProjectionExpression"`
+	ScanIndexForward          *bool                      `json:"ScanIndexForward"`
+	Select                    string                     `json:"Select"`
+	TableName                 string                     `json:"TableName"`
+}
+
+// QueryResult is the result of Query.
+type QueryResult struct {
+	Count            int    `json:"Count"`
+	Items            []Item `json:"Items"`
+	LastEvaluatedKey Item   `json:"LastEvaluatedKey,omitempty"`
+	ScannedCount     int    `json:"ScannedCount"`
+}
+
+// ScanRequest is a request to Scan.
+type ScanRequest struct {
+	ConsistentRead            bool                       `json:"ConsistentRead"`
+	ExclusiveStartKey         Item                       `json:"ExclusiveStartKey"`
+	ExpressionAttributeNames  map[string]string          `json:"ExpressionAttributeNames"`
+	ExpressionAttributeValues map[string]*AttributeValue `json:"ExpressionAttributeValues"`
+	FilterExpression          string                     `json:"FilterExpression"`
+	IndexName                 string                     `json:"IndexName"`
+	Limit                     int                        `json:"Limit"`
+	ProjectionExpression      string                     `json:"ProjectionExpression"`
+	Segment                   int                        `json:"Segment"`
+	Select                    string                     `json:"Select"`
+	TableName                 string                     `json:"TableName"`
+	TotalSegments             int                        `json:"TotalSegments"`
+}
+
+// ScanResult is the result of Scan.
+type ScanResult struct {
+	Count            int    `json:"Count"`
+	Items            []Item `json:"Items"`
+	LastEvaluatedKey Item   `json:"LastEvaluatedKey,omitempty"`
+	ScannedCount     int    `json:"ScannedCount"`
+}
@@ -0,0 +1,494 @@
+package dynamodb
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/fernomac/aws-local/pkg/common"
+)
+
+// AttributeValue is a DynamoDB value. Exactly one member is set.
+type AttributeValue struct {
+	S    *string
+	N    *string
+	B    []byte
+	SS   []string
+	NS   []string
+	BS   [][]byte
+	M    map[string]*AttributeValue
+	L    []*AttributeValue
+	NULL *bool
+	BOOL *bool
+}
+
+// Attribute types.
+const (
+	typeS    = "S"
+	typeN    = "N"
+	typeB    = "B"
+	typeSS   = "SS"
+	typeNS   = "NS"
+	typeBS   = "BS"
+	typeM    = "M"
+	typeL    = "L"
+	typeNULL = "NULL"
+	typeBOOL = "BOOL"
+)
+
+// typ returns the value's type, or "" if it has none.
+func (v *AttributeValue) typ() string {
+	switch {
+	case v == nil:
+		return ""
+	case v.S != nil:
+		return typeS
+	case v.N != nil:
+		return typeN
+	case v.B != nil:
+		return typeB
+	case v.SS != nil:
+		return typeSS
+	case v.NS != nil:
+		return typeNS
+	case v.BS != nil:
+		return typeBS
+	case v.M != nil:
+		return typeM
+	case v.L != nil:
+		return typeL
+	case v.NULL != nil:
+		return typeNULL
+	case v.BOOL != nil:
+		return typeBOOL
+	}
+	return ""
+}
+
+// MarshalJSON writes the value as {"type": value}.
+func (v *AttributeValue) MarshalJSON() ([]byte, error) {
+	var member interface{}
+	switch v.typ() {
+	case typeS:
+		member = *v.S
+	case typeN:
+		member = *v.N
+	case typeB:
+		member = v.B
+	case typeSS:
+		member = v.SS
+	case typeNS:
+		member = v.NS
+	case typeBS:
+		member = v.BS
+	case typeM:
+		member = v.M
+	case typeL:
+		member = v.L
+	case typeNULL:
+		member = *v.NULL
+	case typeBOOL:
+		member = *v.BOOL
+	default:
+		return []byte("{}"), nil
+	}
+	return json.Marshal(map[string]interface{}{v.typ(): member})
+}
+
+// UnmarshalJSON reads a value written as {"type": value}.
+func (v *AttributeValue) UnmarshalJSON(data []byte) error {
+	raw := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	if len(raw) != 1 {
+		return common.Errorf("ValidationException", "Supplied AttributeValue has more than one datatypes set, must contain exactly one of the supported datatypes")
+	}
+
+	*v = AttributeValue{}
+	for typ, member := range raw {
+		var target interface{}
+		switch typ {
+		case typeS:
+			target = &v.S
+		case typeN:
+			target = &v.N
+		case typeB:
+			target = &v.B
+		case typeSS:
+			target = &v.SS
+		case typeNS:
+			target = &v.NS
+		case typeBS:
+			target = &v.BS
+		case typeM:
+			target = &v.M
+		case typeL:
+			target = &v.L
+		case typeNULL:
+			target = &v.NULL
+		case typeBOOL:
+			target = &v.BOOL
+		default:
+			return common.Errorf("ValidationException", "Supplied AttributeValue has an unknown datatype: %v", typ)
+		}
+		if err := json.Unmarshal(member, target); err != nil {
+			return err
+		}
+	}
+	if v.typ() == "" {
+		return common.Errorf("ValidationException", "Supplied AttributeValue is empty, must contain exactly one of the supported datatypes")
+	}
+	return nil
+}
+
+// numberPattern matches the decimal numbers DynamoDB accepts.
+var numberPattern = regexp.MustCompile(`^[+-]?(\d+\.?\d*|\.\d+)([eE][+-]?\d+)?$`)
+
+// parseNumber parses a DynamoDB number.
+func parseNumber(n string) (*big.Rat, bool) {
+	n = strings.TrimSpace(n)
+	if !numberPattern.MatchString(n) {
+		return nil, false
+	}
+	// DynamoDB numbers have exponents well within this; bigger ones would
+	// take forever to expand.
+	if i := strings.IndexAny(n, "eE"); i >= 0 {
+		if exp, err := strconv.Atoi(n[i+1:]); err != nil || exp > 200 || exp < -200 {
+			return nil, false
+		}
+	}
+	return new(big.Rat).SetString(n)
+}
+
+// formatNumber writes a number the way DynamoDB returns it: no exponent, no
+// trailing zeros.
+func formatNumber(r *big.Rat) string {
+	if r.IsInt() {
+		return r.Num().String()
+	}
+	// Numbers come from decimals, so the denominator divides a power of ten.
+	digits := 0
+	scaled := new(big.Rat).Set(r)
+	ten := big.NewRat(10, 1)
+	for !scaled.IsInt() && digits < 130 {
+		scaled.Mul(scaled, ten)
+		digits++
+	}
+	return r.FloatString(digits)
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+func numberValue(r *big.Rat) *AttributeValue {
+	return &AttributeValue{N: stringPtr(formatNumber(r))}
+}
+
+// validate checks a value from a request and puts its numbers in canonical
+// form.
+func (v *AttributeValue) validate() error {
+	invalid := func(format string, args ...interface{}) error {
+		return common.Errorf("ValidationException", "One or more parameter values were invalid: "+format, args...)
+	}
+
+	switch v.typ() {
+	case "":
+		return common.Errorf("ValidationException", "Supplied AttributeValue is empty, must contain exactly one of the supported datatypes")
+
+	case typeN:
+		r, ok := parseNumber(*v.N)
+		if !ok {
+			return common.Errorf("ValidationException", "A value provided cannot be converted into a number")
+		}
+		v.N = stringPtr(formatNumber(r))
+
+	case typeSS, typeNS, typeBS:
+		if v.setLen() == 0 {
+			return invalid("An %v may not be empty", v.typ())
+		}
+		seen := map[string]bool{}
+		for i := 0; i < v.setLen(); i++ {
+			elem := v.setElem(i)
+			if err := elem.validate(); err != nil {
+				return err
+			}
+			k := elem.keyString()
+			if seen[k] {
+				return invalid("Input collection contains duplicates")
+			}
+			seen[k] = true
+			if v.NS != nil {
+				v.NS[i] = *elem.N
+			}
+		}
+
+	case typeM:
+		for _, member := range v.M {
+			if member == nil {
+				return common.Errorf("ValidationException", "Supplied AttributeValue is empty, must contain exactly one of the supported datatypes")
+			}
+			if err := member.validate(); err != nil {
+				return err
+			}
+		}
+
+	case typeL:
+		for _, member := range v.L {
+			if member == nil {
+				return common.Errorf("ValidationException", "Supplied AttributeValue is empty, must contain exactly one of the supported datatypes")
+			}
+			if err := member.validate(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// setLen returns the number of elements in a set.
+func (v *AttributeValue) setLen() int {
+	return len(v.SS) + len(v.NS) + len(v.BS)
+}
+
+// setElem returns an element of a set as a scalar value.
+func (v *AttributeValue) setElem(i int) *AttributeValue {
+	switch {
+	case v.SS != nil:
+		return &AttributeValue{S: stringPtr(v.SS[i])}
+	case v.NS != nil:
+		return &AttributeValue{N: stringPtr(v.NS[i])}
+	default:
+		return &AttributeValue{B: v.BS[i]}
+	}
+}
+
+// setOf makes a set of the given type from scalar values.
+func setOf(typ string, elems []*AttributeValue) *AttributeValue {
+	out := &AttributeValue{}
+	switch typ {
+	case typeSS:
+		out.SS = []string{}
+		for _, e := range elems {
+			out.SS = append(out.SS, *e.S)
+		}
+	case typeNS:
+		out.NS = []string{}
+		for _, e := range elems {
+			out.NS = append(out.NS, *e.N)
+		}
+	case typeBS:
+		out.BS = [][]byte{}
+		for _, e := range elems {
+			out.BS = append(out.BS, e.B)
+		}
+	}
+	return out
+}
+
+// keyString encodes a scalar value so that equal values encode equally.
+func (v *AttributeValue) keyString() string {
+	var s string
+	switch v.typ() {
+	case typeS:
+		s = *v.S
+	case typeN:
+		r, _ := parseNumber(*v.N)
+		s = formatNumber(r)
+	case typeB:
+		s = string(v.B)
+	}
+	return fmt.Sprintf("%v%d:%v", v.typ(), len(s), s)
+}
+
+// compare orders two scalar values of the same type. It returns false if
+// they can't be ordered.
+func compare(a *AttributeValue, b *AttributeValue) (int, bool) {
+	if a.typ() != b.typ() {
+		return 0, false
+	}
+	switch a.typ() {
+	case typeS:
+		return strings.Compare(*a.S, *b.S), true
+	case typeN:
+		x, _ := parseNumber(*a.N)
+		y, _ := parseNumber(*b.N)
+		return x.Cmp(y), true
+	case typeB:
+		return bytes.Compare(a.B, b.B), true
+	}
+	return 0, false
+}
+
+// equal reports whether two values are the same. Sets are equal regardless of
+// order.
+func equal(a *AttributeValue, b *AttributeValue) bool {
+	if a.typ() != b.typ() {
+		return false
+	}
+	switch a.typ() {
+	case typeS, typeN, typeB:
+		c, _ := compare(a, b)
+		return c == 0
+	case typeSS, typeNS, typeBS:
+		if a.setLen() != b.setLen() {
+			return false
+		}
+		for i := 0; i < a.setLen(); i++ {
+			if !b.setContains(a.setElem(i)) {
+				return false
+			}
+		}
+		return true
+	case typeM:
+		if len(a.M) != len(b.M) {
+			return false
+		}
+		for name, member := range a.M {
+			if other, ok := b.M[name]; !ok || !equal(member, other) {
+				return false
+			}
+		}
+		return true
+	case typeL:
+		if len(a.L) != len(b.L) {
+			return false
+		}
+		for i := range a.L {
+			if !equal(a.L[i], b.L[i]) {
+				return false
+			}
+		}
+		return true
+	case typeNULL:
+		return true
+	case typeBOOL:
+		return *a.BOOL == *b.BOOL
+	}
+	return false
+}
+
+// setContains reports whether a set contains the given scalar.
+func (v *AttributeValue) setContains(elem *AttributeValue) bool {
+	for i := 0; i < v.setLen(); i++ {
+		if equal(v.setElem(i), elem) {
+			return true
+		}
+	}
+	return false
+}
+
+// copy makes a deep copy of the value.
+func (v *AttributeValue) copy() *AttributeValue {
+	out := *v
+	if v.B != nil {
+		out.B = append([]byte{}, v.B...)
+	}
+	if v.SS != nil {
+		out.SS = append([]string{}, v.SS...)
+	}
+	if v.NS != nil {
+		out.NS = append([]string{}, v.NS...)
+	}
+	if v.BS != nil {
+		out.BS = append([][]byte{}, v.BS...)
+	}
+	if v.M != nil {
+		out.M = make(map[string]*AttributeValue, len(v.M))
+		for name, member := range v.M {
+			out.M[name] = member.copy()
+		}
+	}
+	if v.L != nil {
+		out.L = make([]*AttributeValue, len(v.L))
+		for i, member := range v.L {
+			out.L[i] = member.copy()
+		}
+	}
+	return &out
+}
+
+// size estimates the value's size the way DynamoDB counts it.
+func (v *AttributeValue) size() int {
+	switch v.typ() {
+	case typeS:
+		return len(*v.S)
+	case typeN:
+		return (len(strings.TrimLeft(*v.N, "-0."))+1)/2 + 1
+	case typeB:
+		return len(v.B)
+	case typeSS, typeNS, typeBS:
+		n := 0
+		for i := 0; i < v.setLen(); i++ {
+			n += v.setElem(i).size()
+		}
+		return n
+	case typeM:
+		n := 3
+		for name, member := range v.M {
+			n += len(name) + member.size() + 1
+		}
+		return n
+	case typeL:
+		n := 3
+		for _, member := range v.L {
+			n += member.size() + 1
+		}
+		return n
+	}
+	return 1
+}
+
+// validate checks every value in an item.
+func (it Item) validate() error {
+	for _, v := range it {
+		if v == nil {
+			return common.Errorf("ValidationException", "Supplied AttributeValue is empty, must contain exactly one of the supported datatypes")
+		}
+		if err := v.validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copy makes a deep copy of the item.
+func (it Item) copy() Item {
+	if it == nil {
+		return nil
+	}
+	out := make(Item, len(it))
+	for name, v := range it {
+		out[name] = v.copy()
+	}
+	return out
+}
+
+// size returns the item's size in bytes.
+func (it Item) size() int {
+	n := 0
+	for name, v := range it {
+		n += len(name) + v.size()
+	}
+	return n
+}
+
+// names returns the item's attribute names in order.
+func (it Item) names() []string {
+	out := []string{}
+	for name := range it {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
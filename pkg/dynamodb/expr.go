@@ -0,0 +1,1366 @@
+package dynamodb
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/fernomac/aws-local/pkg/common"
+)
+
+//
+// Document paths.
+//
+
+// pathElem is one step in a document path: a map member or a list index.
+type pathElem struct {
+	name    string
+	index   int
+	isIndex bool
+}
+
+// path is a document path such as a.b[1].c.
+type path []pathElem
+
+func (p path) String() string {
+	b := strings.Builder{}
+	for i, e := range p {
+		switch {
+		case e.isIndex:
+			fmt.Fprintf(&b, "[%d]", e.index)
+		case i > 0:
+			b.WriteString("." + e.name)
+		default:
+			b.WriteString(e.name)
+		}
+	}
+	return b.String()
+}
+
+// hasPrefix reports whether q is p or a prefix of it.
+func (p path) hasPrefix(q path) bool {
+	if len(q) > len(p) {
+		return false
+	}
+	for i := range q {
+		if p[i] != q[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// comparePaths orders paths element by element, list indexes numerically.
+func comparePaths(p path, q path) int {
+	for i := 0; i < len(p) && i < len(q); i++ {
+		switch {
+		case p[i].isIndex && q[i].isIndex && p[i].index != q[i].index:
+			if p[i].index < q[i].index {
+				return -1
+			}
+			return 1
+		case p[i].name != q[i].name:
+			return strings.Compare(p[i].name, q[i].name)
+		}
+	}
+	return len(p) - len(q)
+}
+
+// getPath returns the value at a path, or nil if there isn't one.
+func getPath(item Item, p path) *AttributeValue {
+	v := item[p[0].name]
+	for _, e := range p[1:] {
+		switch {
+		case v == nil:
+			return nil
+		case e.isIndex:
+			if v.L == nil || e.index >= len(v.L) {
+				return nil
+			}
+			v = v.L[e.index]
+		default:
+			if v.M == nil {
+				return nil
+			}
+			v = v.M[e.name]
+		}
+	}
+	return v
+}
+
+// setPath sets the value at a path. Everything but the last step must already
+// exist; setting a list index past the end appends.
+func setPath(item Item, p path, v *AttributeValue) error {
+	if len(p) == 1 {
+		item[p[0].name] = v
+		return nil
+	}
+
+	parent := getPath(item, p[:len(p)-1])
+	last := p[len(p)-1]
+	switch {
+	case last.isIndex && parent != nil && parent.L != nil:
+		if last.index < len(parent.L) {
+			parent.L[last.index] = v
+		} else {
+			parent.L = append(parent.L, v)
+		}
+	case !last.isIndex && parent != nil && parent.M != nil:
+		parent.M[last.name] = v
+	default:
+		return common.Errorf("ValidationException", "The document path provided in the update expression is invalid for update")
+	}
+	return nil
+}
+
+// removePath removes the value at a path, if there is one.
+func removePath(item Item, p path) {
+	if len(p) == 1 {
+		delete(item, p[0].name)
+		return
+	}
+
+	parent := getPath(item, p[:len(p)-1])
+	last := p[len(p)-1]
+	switch {
+	case parent == nil:
+	case last.isIndex && parent.L != nil && last.index < len(parent.L):
+		parent.L = append(parent.L[:last.index], parent.L[last.index+1:]...)
+	case !last.isIndex && parent.M != nil:
+		delete(parent.M, last.name)
+	}
+}
+
+// project copies just the given paths out of an item. Projected list elements
+// are packed together, as DynamoDB returns them.
+func project(item Item, paths []path) Item {
+	container := func(e pathElem) *AttributeValue {
+		if e.isIndex {
+			return &AttributeValue{L: []*AttributeValue{}}
+		}
+		return &AttributeValue{M: map[string]*AttributeValue{}}
+	}
+
+	out := Item{}
+	for _, p := range paths {
+		v := getPath(item, p)
+		if v == nil {
+			continue
+		}
+		if len(p) == 1 {
+			out[p[0].name] = v.copy()
+			continue
+		}
+
+		cur, ok := out[p[0].name]
+		if !ok {
+			cur = container(p[1])
+			out[p[0].name] = cur
+		}
+		for i := 1; i < len(p); i++ {
+			next := v.copy()
+			if i < len(p)-1 {
+				next = container(p[i+1])
+			}
+
+			if p[i].isIndex {
+				cur.L = append(cur.L, next)
+			} else if existing, ok := cur.M[p[i].name]; ok && i < len(p)-1 {
+				next = existing
+			} else {
+				cur.M[p[i].name] = next
+			}
+			cur = next
+		}
+	}
+	return out
+}
+
+//
+// Tokens.
+//
+
+const (
+	tokEOF = iota
+	tokIdent
+	tokName
+	tokValue
+	tokNumber
+	tokPunct
+)
+
+type token struct {
+	kind int
+	text string
+}
+
+// keywords can't be used as bare attribute names.
+var keywords = map[string]bool{
+	"AND": true, "OR": true, "NOT": true, "BETWEEN": true, "IN": true,
+	"SET": true, "REMOVE": true, "ADD": true, "DELETE": true,
+}
+
+func isWordChar(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// tokenize splits an expression into tokens.
+func tokenize(kind string, s string) ([]token, error) {
+	out := []token{}
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+
+		case c == '#' || c == ':' || isWordChar(c):
+			j := i + 1
+			for j < len(s) && isWordChar(s[j]) {
+				j++
+			}
+			t := token{kind: tokIdent, text: s[i:j]}
+			switch {
+			case c == '#':
+				t.kind = tokName
+			case c == ':':
+				t.kind = tokValue
+			case c >= '0' && c <= '9':
+				t.kind = tokNumber
+			}
+			if j == i+1 && t.kind != tokIdent && t.kind != tokNumber {
+				return nil, syntaxError(kind, t.text)
+			}
+			out = append(out, t)
+			i = j
+
+		case strings.HasPrefix(s[i:], "<>"), strings.HasPrefix(s[i:], "<="), strings.HasPrefix(s[i:], ">="):
+			out = append(out, token{kind: tokPunct, text: s[i : i+2]})
+			i += 2
+
+		case strings.IndexByte("=<>(),.[]+-", c) >= 0:
+			out = append(out, token{kind: tokPunct, text: s[i : i+1]})
+			i++
+
+		default:
+			return nil, syntaxError(kind, s[i:i+1])
+		}
+	}
+	return append(out, token{kind: tokEOF, text: "<EOF>"}), nil
+}
+
+func syntaxError(kind string, tok string) error {
+	return common.Errorf("ValidationException", "Invalid %v: Syntax error; token: \"%v\"", kind, tok)
+}
+
+//
+// Expression attribute names and values.
+//
+
+// expressions holds the names and values for the expressions in a single
+// request, and tracks which of them the expressions use.
+type expressions struct {
+	names      map[string]string
+	values     map[string]*AttributeValue
+	usedNames  map[string]bool
+	usedValues map[string]bool
+}
+
+// newExpressions validates a request's expression attribute values.
+func newExpressions(names map[string]string, values map[string]*AttributeValue) (*expressions, error) {
+	if names != nil && len(names) == 0 {
+		return nil, common.Errorf("ValidationException", "ExpressionAttributeNames must not be empty")
+	}
+	if values != nil && len(values) == 0 {
+		return nil, common.Errorf("ValidationException", "ExpressionAttributeValues must not be empty")
+	}
+	for _, v := range values {
+		if v == nil {
+			return nil, common.Errorf("ValidationException", "Supplied AttributeValue is empty, must contain exactly one of the supported datatypes")
+		}
+		if err := v.validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	return &expressions{
+		names:      names,
+		values:     values,
+		usedNames:  map[string]bool{},
+		usedValues: map[string]bool{},
+	}, nil
+}
+
+// checkUnused fails if any names or values were not used, as DynamoDB does.
+func (e *expressions) checkUnused() error {
+	unused := func(used map[string]bool, keys []string) []string {
+		out := []string{}
+		for _, k := range keys {
+			if !used[k] {
+				out = append(out, k)
+			}
+		}
+		sort.Strings(out)
+		return out
+	}
+
+	names := []string{}
+	for k := range e.names {
+		names = append(names, k)
+	}
+	if u := unused(e.usedNames, names); len(u) > 0 {
+		return common.Errorf("ValidationException", "Value provided in ExpressionAttributeNames unused in expressions: keys: {%v}", strings.Join(u, ", "))
+	}
+
+	values := []string{}
+	for k := range e.values {
+		values = append(values, k)
+	}
+	if u := unused(e.usedValues, values); len(u) > 0 {
+		return common.Errorf("ValidationException", "Value provided in ExpressionAttributeValues unused in expressions: keys: {%v}", strings.Join(u, ", "))
+	}
+	return nil
+}
+
+// parser parses a single expression.
+type parser struct {
+	e    *expressions
+	kind string
+	toks []token
+	pos  int
+}
+
+func (e *expressions) parser(kind string, s string) (*parser, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, common.Errorf("ValidationException", "Invalid %v: The expression can not be empty;", kind)
+	}
+	toks, err := tokenize(kind, s)
+	if err != nil {
+		return nil, err
+	}
+	return &parser{e: e, kind: kind, toks: toks}, nil
+}
+
+func (p *parser) peek() token {
+	return p.peekAt(0)
+}
+
+func (p *parser) peekAt(n int) token {
+	if p.pos+n >= len(p.toks) {
+		return p.toks[len(p.toks)-1]
+	}
+	return p.toks[p.pos+n]
+}
+
+func (p *parser) next() token {
+	t := p.peek()
+	if p.pos < len(p.toks)-1 {
+		p.pos++
+	}
+	return t
+}
+
+// accept consumes the given punctuation if it is next.
+func (p *parser) accept(punct string) bool {
+	if t := p.peek(); t.kind == tokPunct && t.text == punct {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(punct string) error {
+	if !p.accept(punct) {
+		return p.syntaxError()
+	}
+	return nil
+}
+
+// keyword reports whether the given keyword is next.
+func (p *parser) keyword(kw string) bool {
+	t := p.peek()
+	return t.kind == tokIdent && strings.EqualFold(t.text, kw)
+}
+
+// call reports whether a call to one of the given functions is next.
+func (p *parser) call(fns ...string) bool {
+	t := p.peek()
+	if t.kind != tokIdent || p.peekAt(1).text != "(" {
+		return false
+	}
+	for _, fn := range fns {
+		if t.text == fn {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *parser) syntaxError() error {
+	return syntaxError(p.kind, p.peek().text)
+}
+
+// end fails unless the whole expression has been consumed.
+func (p *parser) end() error {
+	if p.peek().kind != tokEOF {
+		return p.syntaxError()
+	}
+	return nil
+}
+
+// parseName parses an attribute name or #name placeholder.
+func (p *parser) parseName() (string, error) {
+	t := p.peek()
+	switch {
+	case t.kind == tokIdent && !keywords[strings.ToUpper(t.text)]:
+		p.next()
+		return t.text, nil
+
+	case t.kind == tokName:
+		p.next()
+		name, ok := p.e.names[t.text]
+		if !ok {
+			return "", common.Errorf("ValidationException", "Invalid %v: An expression attribute name used in the document path is not defined; attribute name: %v", p.kind, t.text)
+		}
+		p.e.usedNames[t.text] = true
+		return name, nil
+	}
+	return "", p.syntaxError()
+}
+
+// parseValue parses a :value placeholder.
+func (p *parser) parseValue() (*AttributeValue, error) {
+	t := p.peek()
+	if t.kind != tokValue {
+		return nil, p.syntaxError()
+	}
+	p.next()
+
+	v, ok := p.e.values[t.text]
+	if !ok {
+		return nil, common.Errorf("ValidationException", "Invalid %v: An expression attribute value used in expression is not defined; attribute value: %v", p.kind, t.text)
+	}
+	p.e.usedValues[t.text] = true
+	return v, nil
+}
+
+// parsePath parses a document path.
+func (p *parser) parsePath() (path, error) {
+	name, err := p.parseName()
+	if err != nil {
+		return nil, err
+	}
+
+	out := path{{name: name}}
+	for {
+		switch {
+		case p.accept("."):
+			name, err := p.parseName()
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, pathElem{name: name})
+
+		case p.accept("["):
+			t := p.next()
+			if t.kind != tokNumber {
+				return nil, syntaxError(p.kind, t.text)
+			}
+			n, err := strconv.Atoi(t.text)
+			if err != nil {
+				return nil, syntaxError(p.kind, t.text)
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			out = append(out, pathElem{index: n, isIndex: true})
+
+		default:
+			return out, nil
+		}
+	}
+}
+
+//
+// Operands.
+//
+
+// operand is something that evaluates to a value against an item. A nil value
+// means the attribute doesn't exist.
+type operand interface {
+	eval(item Item) (*AttributeValue, error)
+}
+
+type pathOperand struct {
+	path path
+}
+
+func (o *pathOperand) eval(item Item) (*AttributeValue, error) {
+	return getPath(item, o.path), nil
+}
+
+type valueOperand struct {
+	value *AttributeValue
+}
+
+func (o *valueOperand) eval(item Item) (*AttributeValue, error) {
+	return o.value, nil
+}
+
+// sizeOperand is size(path).
+type sizeOperand struct {
+	path path
+}
+
+func (o *sizeOperand) eval(item Item) (*AttributeValue, error) {
+	v := getPath(item, o.path)
+	n := 0
+	switch v.typ() {
+	case typeS:
+		n = len(*v.S)
+	case typeB:
+		n = len(v.B)
+	case typeSS, typeNS, typeBS:
+		n = v.setLen()
+	case typeM:
+		n = len(v.M)
+	case typeL:
+		n = len(v.L)
+	default:
+		return nil, nil
+	}
+	return numberValue(big.NewRat(int64(n), 1)), nil
+}
+
+// arithOperand is a + b or a - b in a SET action.
+type arithOperand struct {
+	op    string
+	left  operand
+	right operand
+}
+
+func (o *arithOperand) eval(item Item) (*AttributeValue, error) {
+	l, r, err := evalBoth(item, o.left, o.right)
+	if err != nil {
+		return nil, err
+	}
+	if l.N == nil || r.N == nil {
+		return nil, operandTypeError(o.op, l, r)
+	}
+
+	x, _ := parseNumber(*l.N)
+	y, _ := parseNumber(*r.N)
+	if o.op == "+" {
+		return numberValue(new(big.Rat).Add(x, y)), nil
+	}
+	return numberValue(new(big.Rat).Sub(x, y)), nil
+}
+
+// ifNotExistsOperand is if_not_exists(path, value).
+type ifNotExistsOperand struct {
+	path  path
+	value operand
+}
+
+func (o *ifNotExistsOperand) eval(item Item) (*AttributeValue, error) {
+	if v := getPath(item, o.path); v != nil {
+		return v, nil
+	}
+	return o.value.eval(item)
+}
+
+// listAppendOperand is list_append(a, b).
+type listAppendOperand struct {
+	left  operand
+	right operand
+}
+
+func (o *listAppendOperand) eval(item Item) (*AttributeValue, error) {
+	l, r, err := evalBoth(item, o.left, o.right)
+	if err != nil {
+		return nil, err
+	}
+	if l.L == nil || r.L == nil {
+		return nil, operandTypeError("list_append", l, r)
+	}
+	out := append(append([]*AttributeValue{}, l.L...), r.L...)
+	return &AttributeValue{L: out}, nil
+}
+
+// evalBoth evaluates the operands of an update function, both of which must
+// exist.
+func evalBoth(item Item, left operand, right operand) (*AttributeValue, *AttributeValue, error) {
+	l, err := left.eval(item)
+	if err != nil {
+		return nil, nil, err
+	}
+	r, err := right.eval(item)
+	if err != nil {
+		return nil, nil, err
+	}
+	if l == nil || r == nil {
+		return nil, nil, common.Errorf("ValidationException", "The provided expression refers to an attribute that does not exist in the item")
+	}
+	return l, r, nil
+}
+
+func operandTypeError(op string, vs ...*AttributeValue) error {
+	typ := ""
+	for _, v := range vs {
+		typ = v.typ()
+		if (op == "+" || op == "-") && typ != typeN || op == "list_append" && typ != typeL {
+			break
+		}
+	}
+	return common.Errorf("ValidationException", "Invalid UpdateExpression: Incorrect operand type for operator or function; operator or function: %v, operand type: %v", op, typ)
+}
+
+// parseOperand parses an operand of a condition.
+func (p *parser) parseOperand() (operand, error) {
+	switch {
+	case p.peek().kind == tokValue:
+		v, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		return &valueOperand{v}, nil
+
+	case p.call("size"):
+		p.next()
+		p.next()
+		pa, err := p.parsePath()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return &sizeOperand{pa}, nil
+	}
+
+	pa, err := p.parsePath()
+	if err != nil {
+		return nil, err
+	}
+	return &pathOperand{pa}, nil
+}
+
+//
+// Conditions.
+//
+
+// condition is a boolean expression over an item.
+type condition interface {
+	eval(item Item) (bool, error)
+}
+
+type andCondition struct {
+	left  condition
+	right condition
+}
+
+func (c *andCondition) eval(item Item) (bool, error) {
+	ok, err := c.left.eval(item)
+	if err != nil || !ok {
+		return false, err
+	}
+	return c.right.eval(item)
+}
+
+type orCondition struct {
+	left  condition
+	right condition
+}
+
+func (c *orCondition) eval(item Item) (bool, error) {
+	ok, err := c.left.eval(item)
+	if err != nil || ok {
+		return ok, err
+	}
+	return c.right.eval(item)
+}
+
+type notCondition struct {
+	cond condition
+}
+
+func (c *notCondition) eval(item Item) (bool, error) {
+	ok, err := c.cond.eval(item)
+	return !ok, err
+}
+
+// comparison is a = b, a <> b, a < b and so on. Only scalars of the same type
+// can be ordered; anything else is simply false.
+type comparison struct {
+	op    string
+	left  operand
+	right operand
+}
+
+func (c *comparison) eval(item Item) (bool, error) {
+	l, err := c.left.eval(item)
+	if err != nil {
+		return false, err
+	}
+	r, err := c.right.eval(item)
+	if err != nil {
+		return false, err
+	}
+
+	switch c.op {
+	case "=":
+		return l != nil && r != nil && equal(l, r), nil
+	case "<>":
+		return l == nil || r == nil || !equal(l, r), nil
+	}
+
+	if l == nil || r == nil {
+		return false, nil
+	}
+	n, ok := compare(l, r)
+	if !ok {
+		return false, nil
+	}
+	switch c.op {
+	case "<":
+		return n < 0, nil
+	case "<=":
+		return n <= 0, nil
+	case ">":
+		return n > 0, nil
+	default:
+		return n >= 0, nil
+	}
+}
+
+// between is a BETWEEN b AND c.
+type between struct {
+	value operand
+	lower operand
+	upper operand
+}
+
+func (c *between) eval(item Item) (bool, error) {
+	vs := []*AttributeValue{}
+	for _, o := range []operand{c.value, c.lower, c.upper} {
+		v, err := o.eval(item)
+		if err != nil || v == nil {
+			return false, err
+		}
+		vs = append(vs, v)
+	}
+
+	if n, ok := compare(vs[1], vs[2]); ok && n > 0 {
+		return false, common.Errorf("ValidationException", "Invalid ConditionExpression: The BETWEEN operator requires upper bound to be greater than or equal to lower bound")
+	}
+	lo, ok := compare(vs[0], vs[1])
+	if !ok {
+		return false, nil
+	}
+	hi, ok := compare(vs[0], vs[2])
+	return ok && lo >= 0 && hi <= 0, nil
+}
+
+// in is a IN (b, c, ...).
+type in struct {
+	value   operand
+	options []operand
+}
+
+func (c *in) eval(item Item) (bool, error) {
+	v, err := c.value.eval(item)
+	if err != nil || v == nil {
+		return false, err
+	}
+	for _, o := range c.options {
+		opt, err := o.eval(item)
+		if err != nil {
+			return false, err
+		}
+		if opt != nil && equal(v, opt) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// function is a call to one of the condition functions.
+type function struct {
+	name string
+	path path
+	arg  operand
+}
+
+func (c *function) eval(item Item) (bool, error) {
+	v := getPath(item, c.path)
+	switch c.name {
+	case "attribute_exists":
+		return v != nil, nil
+	case "attribute_not_exists":
+		return v == nil, nil
+	}
+
+	arg, err := c.arg.eval(item)
+	if err != nil || v == nil || arg == nil {
+		return false, err
+	}
+
+	switch c.name {
+	case "attribute_type":
+		return v.typ() == *arg.S, nil
+
+	case "begins_with":
+		switch {
+		case v.S != nil && arg.S != nil:
+			return strings.HasPrefix(*v.S, *arg.S), nil
+		case v.B != nil && arg.B != nil:
+			return bytes.HasPrefix(v.B, arg.B), nil
+		}
+		return false, nil
+
+	default: // contains
+		switch {
+		case v.S != nil && arg.S != nil:
+			return strings.Contains(*v.S, *arg.S), nil
+		case v.B != nil && arg.B != nil:
+			return bytes.Contains(v.B, arg.B), nil
+		case v.setLen() > 0:
+			return v.setContains(arg), nil
+		case v.L != nil:
+			for _, elem := range v.L {
+				if equal(elem, arg) {
+					return true, nil
+				}
+			}
+		}
+		return false, nil
+	}
+}
+
+var attributeTypes = map[string]bool{
+	typeS: true, typeN: true, typeB: true, typeSS: true, typeNS: true,
+	typeBS: true, typeM: true, typeL: true, typeNULL: true, typeBOOL: true,
+}
+
+// condition parses a condition expression: a ConditionExpression,
+// FilterExpression or KeyConditionExpression.
+func (e *expressions) condition(kind string, s string) (condition, error) {
+	p, err := e.parser(kind, s)
+	if err != nil {
+		return nil, err
+	}
+	c, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	return c, p.end()
+}
+
+func (p *parser) parseOr() (condition, error) {
+	c, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("OR") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		c = &orCondition{c, right}
+	}
+	return c, nil
+}
+
+func (p *parser) parseAnd() (condition, error) {
+	c, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("AND") {
+		p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		c = &andCondition{c, right}
+	}
+	return c, nil
+}
+
+func (p *parser) parseNot() (condition, error) {
+	if p.keyword("NOT") {
+		p.next()
+		c, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &notCondition{c}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (condition, error) {
+	if p.accept("(") {
+		c, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		return c, p.expect(")")
+	}
+	if p.call("attribute_exists", "attribute_not_exists", "attribute_type", "begins_with", "contains") {
+		return p.parseFunction()
+	}
+
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case p.keyword("BETWEEN"):
+		p.next()
+		lower, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		if !p.keyword("AND") {
+			return nil, p.syntaxError()
+		}
+		p.next()
+		upper, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return &between{left, lower, upper}, nil
+
+	case p.keyword("IN"):
+		p.next()
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		c := &in{value: left}
+		for {
+			o, err := p.parseOperand()
+			if err != nil {
+				return nil, err
+			}
+			c.options = append(c.options, o)
+			if !p.accept(",") {
+				break
+			}
+		}
+		if len(c.options) > 100 {
+			return nil, common.Errorf("ValidationException", "Invalid %v: The IN operator is provided with too many operands; number of operands: %v", p.kind, len(c.options))
+		}
+		return c, p.expect(")")
+	}
+
+	t := p.peek()
+	switch t.text {
+	case "=", "<>", "<", "<=", ">", ">=":
+		if t.kind != tokPunct {
+			break
+		}
+		p.next()
+		right, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return &comparison{t.text, left, right}, nil
+	}
+	return nil, p.syntaxError()
+}
+
+func (p *parser) parseFunction() (condition, error) {
+	c := &function{name: p.next().text}
+	p.next()
+
+	pa, err := p.parsePath()
+	if err != nil {
+		return nil, err
+	}
+	c.path = pa
+
+	if c.name != "attribute_exists" && c.name != "attribute_not_exists" {
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+		if c.arg, err = p.parseOperand(); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+
+	if c.name == "attribute_type" {
+		v, ok := c.arg.(*valueOperand)
+		if !ok || v.value.S == nil || !attributeTypes[*v.value.S] {
+			typ := ""
+			if ok && v.value.S != nil {
+				typ = *v.value.S
+			}
+			return nil, common.Errorf("ValidationException", "Invalid %v: Invalid attribute type name found in type condition; type: %v", p.kind, typ)
+		}
+	}
+	return c, nil
+}
+
+//
+// Key conditions.
+//
+
+// keyPart is one condition on a key attribute in a KeyConditionExpression.
+type keyPart struct {
+	name   string
+	op     string
+	values []*AttributeValue
+	cond   condition
+}
+
+// keyCondition parses a KeyConditionExpression into its conditions on the
+// hash key and, optionally, the range key.
+func (e *expressions) keyCondition(s string) ([]keyPart, error) {
+	const kind = "KeyConditionExpression"
+
+	c, err := e.condition(kind, s)
+	if err != nil {
+		return nil, err
+	}
+
+	conds := []condition{c}
+	if and, ok := c.(*andCondition); ok {
+		conds = []condition{and.left, and.right}
+	}
+
+	out := []keyPart{}
+	for _, c := range conds {
+		part := keyPart{cond: c}
+		var operands []operand
+		switch c := c.(type) {
+		case *comparison:
+			if c.op == "<>" {
+				return nil, common.Errorf("ValidationException", "Invalid %v: Invalid operator used in KeyConditionExpression: <>", kind)
+			}
+			part.op = c.op
+			operands = []operand{c.left, c.right}
+		case *between:
+			part.op = "BETWEEN"
+			operands = []operand{c.value, c.lower, c.upper}
+		case *function:
+			if c.name != "begins_with" {
+				return nil, common.Errorf("ValidationException", "Invalid %v: Invalid operator used in KeyConditionExpression: %v", kind, c.name)
+			}
+			part.op = c.name
+			operands = []operand{&pathOperand{c.path}, c.arg}
+		case *orCondition:
+			return nil, common.Errorf("ValidationException", "Invalid %v: Invalid operator used in KeyConditionExpression: OR", kind)
+		case *notCondition:
+			return nil, common.Errorf("ValidationException", "Invalid %v: Invalid operator used in KeyConditionExpression: NOT", kind)
+		default:
+			return nil, common.Errorf("ValidationException", "Query key condition not supported")
+		}
+
+		key, ok := operands[0].(*pathOperand)
+		if !ok || len(key.path) != 1 {
+			return nil, common.Errorf("ValidationException", "Query key condition not supported")
+		}
+		part.name = key.path[0].name
+		for _, o := range operands[1:] {
+			v, ok := o.(*valueOperand)
+			if !ok {
+				return nil, common.Errorf("ValidationException", "Query key condition not supported")
+			}
+			part.values = append(part.values, v.value)
+		}
+		out = append(out, part)
+	}
+
+	if len(out) == 2 && out[0].name == out[1].name {
+		return nil, common.Errorf("ValidationException", "KeyConditionExpressions must only contain one condition per key")
+	}
+	return out, nil
+}
+
+//
+// Update expressions.
+//
+
+type setAction struct {
+	path  path
+	value operand
+}
+
+type addAction struct {
+	path  path
+	value *AttributeValue
+}
+
+// update is a parsed UpdateExpression.
+type update struct {
+	sets    []setAction
+	removes []path
+	adds    []addAction
+	deletes []addAction
+}
+
+// paths returns every path the update changes.
+func (u *update) paths() []path {
+	out := []path{}
+	for _, s := range u.sets {
+		out = append(out, s.path)
+	}
+	out = append(out, u.removes...)
+	for _, a := range u.adds {
+		out = append(out, a.path)
+	}
+	for _, d := range u.deletes {
+		out = append(out, d.path)
+	}
+	return out
+}
+
+// update parses an UpdateExpression.
+func (e *expressions) update(s string) (*update, error) {
+	p, err := e.parser("UpdateExpression", s)
+	if err != nil {
+		return nil, err
+	}
+
+	u := &update{}
+	seen := map[string]bool{}
+	for p.peek().kind != tokEOF {
+		t := p.next()
+		clause := strings.ToUpper(t.text)
+		if t.kind != tokIdent || !(clause == "SET" || clause == "REMOVE" || clause == "ADD" || clause == "DELETE") {
+			return nil, syntaxError(p.kind, t.text)
+		}
+		if seen[clause] {
+			return nil, common.Errorf("ValidationException", "Invalid UpdateExpression: The \"%v\" section can only be used once in an update expression;", clause)
+		}
+		seen[clause] = true
+
+		for {
+			pa, err := p.parsePath()
+			if err != nil {
+				return nil, err
+			}
+
+			switch clause {
+			case "SET":
+				if err := p.expect("="); err != nil {
+					return nil, err
+				}
+				v, err := p.parseSetValue()
+				if err != nil {
+					return nil, err
+				}
+				u.sets = append(u.sets, setAction{pa, v})
+
+			case "REMOVE":
+				u.removes = append(u.removes, pa)
+
+			default:
+				v, err := p.parseValue()
+				if err != nil {
+					return nil, err
+				}
+				if clause == "ADD" {
+					u.adds = append(u.adds, addAction{pa, v})
+				} else {
+					u.deletes = append(u.deletes, addAction{pa, v})
+				}
+			}
+
+			if !p.accept(",") {
+				break
+			}
+		}
+	}
+
+	paths := u.paths()
+	for i := range paths {
+		for j := i + 1; j < len(paths); j++ {
+			if paths[i].hasPrefix(paths[j]) || paths[j].hasPrefix(paths[i]) {
+				return nil, common.Errorf("ValidationException", "Invalid UpdateExpression: Two document paths overlap with each other; must remove or rewrite one of these paths; path one: [%v], path two: [%v]", paths[i], paths[j])
+			}
+		}
+	}
+	return u, nil
+}
+
+// parseSetValue parses the right-hand side of a SET action.
+func (p *parser) parseSetValue() (operand, error) {
+	left, err := p.parseSetOperand()
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range []string{"+", "-"} {
+		if p.accept(op) {
+			right, err := p.parseSetOperand()
+			if err != nil {
+				return nil, err
+			}
+			return &arithOperand{op, left, right}, nil
+		}
+	}
+	return left, nil
+}
+
+func (p *parser) parseSetOperand() (operand, error) {
+	switch {
+	case p.peek().kind == tokValue:
+		v, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		return &valueOperand{v}, nil
+
+	case p.call("if_not_exists"):
+		p.next()
+		p.next()
+		pa, err := p.parsePath()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+		v, err := p.parseSetOperand()
+		if err != nil {
+			return nil, err
+		}
+		return &ifNotExistsOperand{pa, v}, p.expect(")")
+
+	case p.call("list_append"):
+		p.next()
+		p.next()
+		left, err := p.parseSetOperand()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+		right, err := p.parseSetOperand()
+		if err != nil {
+			return nil, err
+		}
+		return &listAppendOperand{left, right}, p.expect(")")
+	}
+
+	pa, err := p.parsePath()
+	if err != nil {
+		return nil, err
+	}
+	return &pathOperand{pa}, nil
+}
+
+// apply returns a copy of the item with the update applied. The values of SET
+// actions are all worked out from the item as it was before the update.
+func (u *update) apply(item Item) (Item, error) {
+	values := make([]*AttributeValue, len(u.sets))
+	for i, s := range u.sets {
+		v, err := s.value.eval(item)
+		if err != nil {
+			return nil, err
+		}
+		if v == nil {
+			return nil, common.Errorf("ValidationException", "The provided expression refers to an attribute that does not exist in the item")
+		}
+		values[i] = v
+	}
+
+	out := item.copy()
+	for i, s := range u.sets {
+		if err := setPath(out, s.path, values[i].copy()); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, a := range u.adds {
+		cur := getPath(out, a.path)
+		switch {
+		case cur == nil && (a.value.N != nil || a.value.setLen() > 0):
+			if err := setPath(out, a.path, a.value.copy()); err != nil {
+				return nil, err
+			}
+		case cur != nil && cur.N != nil && a.value.N != nil:
+			x, _ := parseNumber(*cur.N)
+			y, _ := parseNumber(*a.value.N)
+			*cur = *numberValue(new(big.Rat).Add(x, y))
+		case cur != nil && cur.setLen() > 0 && cur.typ() == a.value.typ():
+			elems := []*AttributeValue{}
+			for i := 0; i < cur.setLen(); i++ {
+				elems = append(elems, cur.setElem(i))
+			}
+			for i := 0; i < a.value.setLen(); i++ {
+				if elem := a.value.setElem(i); !cur.setContains(elem) {
+					elems = append(elems, elem)
+				}
+			}
+			*cur = *setOf(cur.typ(), elems)
+		default:
+			return nil, common.Errorf("ValidationException", "Invalid UpdateExpression: Incorrect operand type for operator or function; operator: ADD, operand type: %v", a.value.typ())
+		}
+	}
+
+	for _, d := range u.deletes {
+		cur := getPath(out, d.path)
+		switch {
+		case d.value.setLen() == 0 || cur != nil && cur.typ() != d.value.typ():
+			return nil, common.Errorf("ValidationException", "Invalid UpdateExpression: Incorrect operand type for operator or function; operator: DELETE, operand type: %v", d.value.typ())
+		case cur == nil:
+		default:
+			elems := []*AttributeValue{}
+			for i := 0; i < cur.setLen(); i++ {
+				if elem := cur.setElem(i); !d.value.setContains(elem) {
+					elems = append(elems, elem)
+				}
+			}
+			if len(elems) == 0 {
+				removePath(out, d.path)
+			} else {
+				*cur = *setOf(cur.typ(), elems)
+			}
+		}
+	}
+
+	// Remove later list elements first so earlier indexes stay put.
+	removes := append([]path{}, u.removes...)
+	sort.Slice(removes, func(i, j int) bool {
+		return comparePaths(removes[i], removes[j]) > 0
+	})
+	for _, r := range removes {
+		removePath(out, r)
+	}
+	return out, nil
+}
+
+//
+// Projections.
+//
+
+// projection parses a ProjectionExpression.
+func (e *expressions) projection(s string) ([]path, error) {
+	p, err := e.parser("ProjectionExpression", s)
+	if err != nil {
+		return nil, err
+	}
+
+	out := []path{}
+	for {
+		pa, err := p.parsePath()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, pa)
+		if !p.accept(",") {
+			break
+		}
+	}
+	return out, p.end()
+}
@@ -0,0 +1,186 @@
+package dynamodb
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func testItem(t *testing.T, s string) Item {
+	item := Item{}
+	if err := json.Unmarshal([]byte(s), &item); err != nil {
+		t.Fatalf("%v: %v", s, err)
+	}
+	return item
+}
+
+// testValues are the expression attribute values every test can use.
+const testValues = `{
+	":one": {"N": "1"}, ":two": {"N": "2"}, ":ten": {"N": "10"},
+	":a": {"S": "a"}, ":abc": {"S": "abc"}, ":b": {"S": "b"},
+	":xs": {"SS": ["x", "y"]}, ":x": {"SS": ["x"]}, ":l": {"L": [{"N": "3"}]}
+}`
+
+var testNames = map[string]string{"#n": "name", "#s": "size"}
+
+func TestConditionExpressions(t *testing.T) {
+	item := `{
+		"id": {"S": "abc"}, "n": {"N": "5"}, "name": {"S": "bob"}, "size": {"N": "3"},
+		"tags": {"SS": ["x", "y"]}, "m": {"M": {"k": {"L": [{"S": "a"}, {"N": "2"}]}}},
+		"empty": {"NULL": true}
+	}`
+
+	tests := []struct {
+		expr string
+		want bool
+		err  string
+	}{
+		{"n = :ten", false, ""},
+		{"n <> :ten", true, ""},
+		{"n < :ten AND n > :one", true, ""},
+		{"n >= :ten OR n <= :one", false, ""},
+		{"NOT n = :ten", true, ""},
+		{"n BETWEEN :one AND :ten", true, ""},
+		{"n BETWEEN :ten AND :one", false, "upper bound to be greater than or equal to lower bound"},
+		{"id IN (:a, :abc)", true, ""},
+		{"id IN (:a, :b)", false, ""},
+		{"#n = :b OR (n = :one AND #n <> :a)", false, ""},
+		{"m.k[1] = :two", true, ""},
+		{"m.k[0] = :a", true, ""},
+		{"m.k[5] = :a", false, ""},
+		{"missing = :a", false, ""},
+		{"missing <> :a", true, ""},
+		{"attribute_exists(id)", true, ""},
+		{"attribute_exists(missing)", false, ""},
+		{"attribute_not_exists(missing)", true, ""},
+		{"attribute_exists(empty)", true, ""},
+		{"attribute_type(tags, :a)", false, "Invalid attribute type name found in type condition; type: a"},
+		{"begins_with(id, :a)", true, ""},
+		{"begins_with(id, :b)", false, ""},
+		{"contains(id, :b)", true, ""},
+		{"contains(tags, :xs)", false, ""},
+		{"size(id) = :one", false, ""},
+		{"size(tags) = :two", true, ""},
+		{"size(#s) = :one", false, ""},
+		{"#s = :one", false, ""},
+		{"n > :a", false, ""},
+		{"n = ", false, "Syntax error"},
+		{"n = :nope", false, "attribute value used in expression is not defined"},
+		{"#nope = :a", false, "attribute name used in the document path is not defined"},
+		{"AND = :a", false, "Syntax error"},
+		{"nosuchfn(id)", false, "Syntax error"},
+		{"n = :one)", false, "Syntax error"},
+		{"", false, "can not be empty"},
+	}
+
+	for _, test := range tests {
+		values := map[string]*AttributeValue{}
+		if err := json.Unmarshal([]byte(testValues), &values); err != nil {
+			t.Fatal(err)
+		}
+		e, err := newExpressions(testNames, values)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		c, err := e.condition("ConditionExpression", test.expr)
+		var got bool
+		if err == nil {
+			got, err = c.eval(testItem(t, item))
+		}
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%q: got %v, want error containing %q", test.expr, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", test.expr, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%q: got %v, want %v", test.expr, got, test.want)
+		}
+	}
+}
+
+func TestUpdateExpressions(t *testing.T) {
+	item := `{"id": {"S": "abc"}, "n": {"N": "5"}, "tags": {"SS": ["x", "y"]}, "l": {"L": [{"N": "1"}, {"N": "2"}]}}`
+
+	tests := []struct {
+		expr string
+		want string
+		err  string
+	}{
+		{"SET n = :ten", `{"id":{"S":"abc"},"l":{"L":[{"N":"1"},{"N":"2"}]},"n":{"N":"10"},"tags":{"SS":["x","y"]}}`, ""},
+		{"SET n = n + :two", `{"id":{"S":"abc"},"l":{"L":[{"N":"1"},{"N":"2"}]},"n":{"N":"7"},"tags":{"SS":["x","y"]}}`, ""},
+		{"SET n = n - :ten, c = :a", `{"c":{"S":"a"},"id":{"S":"abc"},"l":{"L":[{"N":"1"},{"N":"2"}]},"n":{"N":"-5"},"tags":{"SS":["x","y"]}}`, ""},
+		{"SET c = if_not_exists(c, :one)", `{"c":{"N":"1"},"id":{"S":"abc"},"l":{"L":[{"N":"1"},{"N":"2"}]},"n":{"N":"5"},"tags":{"SS":["x","y"]}}`, ""},
+		{"SET n = if_not_exists(n, :one)", `{"id":{"S":"abc"},"l":{"L":[{"N":"1"},{"N":"2"}]},"n":{"N":"5"},"tags":{"SS":["x","y"]}}`, ""},
+		{"SET l = list_append(l, :l)", `{"id":{"S":"abc"},"l":{"L":[{"N":"1"},{"N":"2"},{"N":"3"}]},"n":{"N":"5"},"tags":{"SS":["x","y"]}}`, ""},
+		{"SET l[9] = :a", `{"id":{"S":"abc"},"l":{"L":[{"N":"1"},{"N":"2"},{"S":"a"}]},"n":{"N":"5"},"tags":{"SS":["x","y"]}}`, ""},
+		{"REMOVE n, l[0]", `{"id":{"S":"abc"},"l":{"L":[{"N":"2"}]},"tags":{"SS":["x","y"]}}`, ""},
+		{"ADD n :one, c :two", `{"c":{"N":"2"},"id":{"S":"abc"},"l":{"L":[{"N":"1"},{"N":"2"}]},"n":{"N":"6"},"tags":{"SS":["x","y"]}}`, ""},
+		{"ADD tags :xs", `{"id":{"S":"abc"},"l":{"L":[{"N":"1"},{"N":"2"}]},"n":{"N":"5"},"tags":{"SS":["x","y"]}}`, ""},
+		{"DELETE tags :x", `{"id":{"S":"abc"},"l":{"L":[{"N":"1"},{"N":"2"}]},"n":{"N":"5"},"tags":{"SS":["y"]}}`, ""},
+		{"DELETE tags :xs", `{"id":{"S":"abc"},"l":{"L":[{"N":"1"},{"N":"2"}]},"n":{"N":"5"}}`, ""},
+		{"set n = :one remove l", `{"id":{"S":"abc"},"n":{"N":"1"},"tags":{"SS":["x","y"]}}`, ""},
+		{"SET n = :one SET c = :a", "", "can only be used once"},
+		{"SET n = :one REMOVE n", "", "paths overlap"},
+		{"SET l = :one REMOVE l[0]", "", "paths overlap"},
+		{"SET c = missing", "", "does not exist"},
+		{"ADD id :one", "", "Incorrect operand type"},
+		{"DELETE n :one", "", "Incorrect operand type"},
+		{"UPSERT n = :one", "", "Syntax error"},
+		{"SET n :one", "", "Syntax error"},
+	}
+
+	for _, test := range tests {
+		values := map[string]*AttributeValue{}
+		if err := json.Unmarshal([]byte(testValues), &values); err != nil {
+			t.Fatal(err)
+		}
+		e, err := newExpressions(nil, values)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		u, err := e.update(test.expr)
+		var got Item
+		if err == nil {
+			got, err = u.apply(testItem(t, item))
+		}
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%q: got %v, want error containing %q", test.expr, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", test.expr, err)
+			continue
+		}
+		out, _ := json.Marshal(got)
+		if string(out) != test.want {
+			t.Errorf("%q:\n got %s\nwant %s", test.expr, out, test.want)
+		}
+	}
+}
+
+func TestUnusedExpressionValues(t *testing.T) {
+	e, err := newExpressions(map[string]string{"#n": "n", "#m": "m"}, map[string]*AttributeValue{":v": {S: stringPtr("a")}, ":w": {S: stringPtr("b")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.condition("ConditionExpression", "#n = :v"); err != nil {
+		t.Fatal(err)
+	}
+	err = e.checkUnused()
+	if err == nil || !strings.Contains(err.Error(), "keys: {#m}") {
+		t.Errorf("got %v", err)
+	}
+
+	if _, err := newExpressions(map[string]string{}, nil); err == nil {
+		t.Errorf("empty ExpressionAttributeNames accepted")
+	}
+}
@@ -0,0 +1,114 @@
+package dynamodb
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/fernomac/aws-local/pkg/awsjson11"
+	"github.com/fernomac/aws-local/pkg/common"
+)
+
+// NewHandler creates a new HTTP handler, notifying the given observers of
+// every call.
+func NewHandler(dynamodb DynamoDB, observers ...common.Observer) http.Handler {
+	rval := awsjson11.NewHandler("DynamoDB_20120810")
+	rval.UseJSON10()
+	rval.SetEventSource("dynamodb.amazonaws.com")
+	for _, o := range observers {
+		rval.ObserveWith(o)
+	}
+
+	//
+	// Tables.
+	//
+
+	rval.HandleWith("CreateTable", func(body []byte) (interface{}, error) {
+		req := CreateTableRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return dynamodb.CreateTable(&req)
+	})
+
+	rval.HandleWith("DescribeTable", func(body []byte) (interface{}, error) {
+		req := DescribeTableRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return dynamodb.DescribeTable(&req)
+	})
+
+	rval.HandleWith("DeleteTable", func(body []byte) (interface{}, error) {
+		req := DeleteTableRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return dynamodb.DeleteTable(&req)
+	})
+
+	rval.HandleWith("ListTables", func(body []byte) (interface{}, error) {
+		req := ListTablesRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return dynamodb.ListTables(&req)
+	})
+
+	//
+	// Items.
+	//
+
+	rval.HandleWith("PutItem", func(body []byte) (interface{}, error) {
+		req := PutItemRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return dynamodb.PutItem(&req)
+	})
+
+	rval.HandleWith("GetItem", func(body []byte) (interface{}, error) {
+		req := GetItemRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return dynamodb.GetItem(&req)
+	})
+
+	rval.HandleWith("UpdateItem", func(body []byte) (interface{}, error) {
+		req := UpdateItemRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return dynamodb.UpdateItem(&req)
+	})
+
+	rval.HandleWith("DeleteItem", func(body []byte) (interface{}, error) {
+		req := DeleteItemRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return dynamodb.DeleteItem(&req)
+	})
+
+	//
+	// Queries.
+	//
+
+	rval.HandleWith("Query", func(body []byte) (interface{}, error) {
+		req := QueryRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return dynamodb.Query(&req)
+	})
+
+	rval.HandleWith("Scan", func(body []byte) (interface{}, error) {
+		req := ScanRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return dynamodb.Scan(&req)
+	})
+
+	return rval
+}
@@ -0,0 +1,730 @@
+package dynamodb
+
+import (
+	"hash/fnv"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/fernomac/aws-local/pkg/common"
+	"github.com/fernomac/aws-local/pkg/kms"
+)
+
+// maxPageSize is how much data a single Query or Scan reads before it stops
+// and returns a LastEvaluatedKey.
+const maxPageSize = 1024 * 1024
+
+// dynamodb is the table store. Its lock guards everything, including calls out
+// to KMS.
+type dynamodb struct {
+	lock   sync.Mutex
+	kms    kms.KMS
+	tables map[string]*table
+}
+
+// New creates a new table store that encrypts tables at rest with keys from
+// the given KMS.
+func New(kms kms.KMS) DynamoDB {
+	return &dynamodb{
+		kms:    kms,
+		tables: make(map[string]*table),
+	}
+}
+
+// table looks up a table by name. The caller must hold s.lock.
+func (s *dynamodb) table(name string) (*table, error) {
+	t, ok := s.tables[name]
+	if !ok {
+		return nil, common.Errorf("ResourceNotFoundException", "Requested resource not found: Table: %v not found", name)
+	}
+	return t, nil
+}
+
+//
+// Tables.
+//
+
+func (s *dynamodb) CreateTable(req *CreateTableRequest) (*CreateTableResult, error) {
+	t, err := newTable(req)
+	if err != nil {
+		return nil, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, ok := s.tables[t.name]; ok {
+		return nil, common.Errorf("ResourceInUseException", "Table already exists: %v", t.name)
+	}
+	if t.sseKeyArn, err = sseKey(s.kms, req.SSESpecification); err != nil {
+		return nil, err
+	}
+
+	s.tables[t.name] = t
+	return &CreateTableResult{
+		TableDescription: t.describe(s.kms, "ACTIVE"),
+	}, nil
+}
+
+func (s *dynamodb) DescribeTable(req *DescribeTableRequest) (*DescribeTableResult, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	t, err := s.table(req.TableName)
+	if err != nil {
+		return nil, err
+	}
+	return &DescribeTableResult{
+		Table: t.describe(s.kms, "ACTIVE"),
+	}, nil
+}
+
+func (s *dynamodb) DeleteTable(req *DeleteTableRequest) (*DeleteTableResult, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	t, err := s.table(req.TableName)
+	if err != nil {
+		return nil, err
+	}
+
+	delete(s.tables, t.name)
+	return &DeleteTableResult{
+		TableDescription: t.describe(s.kms, "DELETING"),
+	}, nil
+}
+
+func (s *dynamodb) ListTables(req *ListTablesRequest) (*ListTablesResult, error) {
+	limit := req.Limit
+	if limit == 0 {
+		limit = 100
+	}
+	if limit < 1 || limit > 100 {
+		return nil, common.Errorf("ValidationException", "1 validation error detected: Value '%v' at 'limit' failed to satisfy constraint: Member must have value less than or equal to 100", req.Limit)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	names := []string{}
+	for name := range s.tables {
+		if name > req.ExclusiveStartTableName {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	out := &ListTablesResult{TableNames: names}
+	if len(names) > limit {
+		out.TableNames = names[:limit]
+		out.LastEvaluatedTableName = names[limit-1]
+	}
+	return out, nil
+}
+
+//
+// Items.
+//
+
+// checkReturnValues checks a ReturnValues parameter against the values an
+// operation allows.
+func checkReturnValues(rv string, allowed ...string) error {
+	if rv == "" {
+		return nil
+	}
+	for _, a := range allowed {
+		if rv == a {
+			return nil
+		}
+	}
+	return common.Errorf("ValidationException", "Return values set to invalid value")
+}
+
+// checkCondition evaluates a ConditionExpression against an item, which is
+// nil if there isn't one.
+func checkCondition(cond condition, item Item) error {
+	if cond == nil {
+		return nil
+	}
+	ok, err := cond.eval(item)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return common.Errorf("ConditionalCheckFailedException", "The conditional request failed")
+	}
+	return nil
+}
+
+// parseCondition parses an optional ConditionExpression, then checks that all
+// expression attribute names and values were used.
+func parseCondition(e *expressions, s string) (condition, error) {
+	var cond condition
+	if s != "" {
+		c, err := e.condition("ConditionExpression", s)
+		if err != nil {
+			return nil, err
+		}
+		cond = c
+	}
+	return cond, e.checkUnused()
+}
+
+func (s *dynamodb) PutItem(req *PutItemRequest) (*PutItemResult, error) {
+	if err := checkReturnValues(req.ReturnValues, "NONE", "ALL_OLD"); err != nil {
+		return nil, err
+	}
+	if err := req.Item.validate(); err != nil {
+		return nil, err
+	}
+	e, err := newExpressions(req.ExpressionAttributeNames, req.ExpressionAttributeValues)
+	if err != nil {
+		return nil, err
+	}
+	cond, err := parseCondition(e, req.ConditionExpression)
+	if err != nil {
+		return nil, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	t, err := s.table(req.TableName)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.validateItem(req.Item); err != nil {
+		return nil, err
+	}
+
+	key := t.primaryKey(req.Item)
+	old := t.items[key]
+	if err := checkCondition(cond, old); err != nil {
+		return nil, err
+	}
+	t.items[key] = req.Item.copy()
+
+	out := &PutItemResult{}
+	if req.ReturnValues == "ALL_OLD" {
+		out.Attributes = old
+	}
+	return out, nil
+}
+
+func (s *dynamodb) GetItem(req *GetItemRequest) (*GetItemResult, error) {
+	e, err := newExpressions(req.ExpressionAttributeNames, nil)
+	if err != nil {
+		return nil, err
+	}
+	var proj []path
+	if req.ProjectionExpression != "" {
+		if proj, err = e.projection(req.ProjectionExpression); err != nil {
+			return nil, err
+		}
+	}
+	if err := e.checkUnused(); err != nil {
+		return nil, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	t, err := s.table(req.TableName)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.validateKey(req.Key); err != nil {
+		return nil, err
+	}
+
+	item, ok := t.items[t.primaryKey(req.Key)]
+	if !ok {
+		return &GetItemResult{}, nil
+	}
+	if proj != nil {
+		return &GetItemResult{Item: project(item, proj)}, nil
+	}
+	return &GetItemResult{Item: item.copy()}, nil
+}
+
+func (s *dynamodb) UpdateItem(req *UpdateItemRequest) (*UpdateItemResult, error) {
+	if err := checkReturnValues(req.ReturnValues, "NONE", "ALL_OLD", "UPDATED_OLD", "ALL_NEW", "UPDATED_NEW"); err != nil {
+		return nil, err
+	}
+	e, err := newExpressions(req.ExpressionAttributeNames, req.ExpressionAttributeValues)
+	if err != nil {
+		return nil, err
+	}
+	u := &update{}
+	if req.UpdateExpression != "" {
+		if u, err = e.update(req.UpdateExpression); err != nil {
+			return nil, err
+		}
+	}
+	cond, err := parseCondition(e, req.ConditionExpression)
+	if err != nil {
+		return nil, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	t, err := s.table(req.TableName)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.validateKey(req.Key); err != nil {
+		return nil, err
+	}
+	for _, p := range u.paths() {
+		for _, name := range t.keyNames(nil) {
+			if p[0].name == name {
+				return nil, invalid("Cannot update attribute %v. This attribute is part of the key", name)
+			}
+		}
+	}
+
+	key := t.primaryKey(req.Key)
+	old, exists := t.items[key]
+	if err := checkCondition(cond, old); err != nil {
+		return nil, err
+	}
+
+	base := old
+	if !exists {
+		base = req.Key
+	}
+	item, err := u.apply(base)
+	if err != nil {
+		return nil, err
+	}
+	if err := item.validate(); err != nil {
+		return nil, err
+	}
+	if err := t.validateItem(item); err != nil {
+		return nil, err
+	}
+	t.items[key] = item
+
+	out := &UpdateItemResult{}
+	switch req.ReturnValues {
+	case "ALL_OLD":
+		out.Attributes = old.copy()
+	case "UPDATED_OLD":
+		if exists {
+			out.Attributes = project(old, u.paths())
+		}
+	case "ALL_NEW":
+		out.Attributes = item.copy()
+	case "UPDATED_NEW":
+		out.Attributes = project(item, u.paths())
+	}
+	if len(out.Attributes) == 0 {
+		out.Attributes = nil
+	}
+	return out, nil
+}
+
+func (s *dynamodb) DeleteItem(req *DeleteItemRequest) (*DeleteItemResult, error) {
+	if err := checkReturnValues(req.ReturnValues, "NONE", "ALL_OLD"); err != nil {
+		return nil, err
+	}
+	e, err := newExpressions(req.ExpressionAttributeNames, req.ExpressionAttributeValues)
+	if err != nil {
+		return nil, err
+	}
+	cond, err := parseCondition(e, req.ConditionExpression)
+	if err != nil {
+		return nil, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	t, err := s.table(req.TableName)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.validateKey(req.Key); err != nil {
+		return nil, err
+	}
+
+	key := t.primaryKey(req.Key)
+	old := t.items[key]
+	if err := checkCondition(cond, old); err != nil {
+		return nil, err
+	}
+	delete(t.items, key)
+
+	out := &DeleteItemResult{}
+	if req.ReturnValues == "ALL_OLD" {
+		out.Attributes = old
+	}
+	return out, nil
+}
+
+//
+// Queries.
+//
+
+// position is where an item falls in the order a Query or Scan reads items:
+// by range key, if there is one, then by encoded key.
+type position struct {
+	rng *AttributeValue
+	key string
+}
+
+func (p position) compare(q position) int {
+	if p.rng != nil && q.rng != nil {
+		if n, _ := compare(p.rng, q.rng); n != 0 {
+			return n
+		}
+	}
+	return strings.Compare(p.key, q.key)
+}
+
+// read is a Query or Scan in progress.
+type read struct {
+	table  *table
+	index  *index
+	query  bool
+	filter condition
+	proj   []path
+	count  bool
+	limit  int
+	// all is true when reading every attribute of items, even through an
+	// index that projects only some.
+	all bool
+	// forward is false for a Query with ScanIndexForward false.
+	forward bool
+}
+
+// position returns an item's position in the read order.
+func (r *read) position(item Item) position {
+	if r.query {
+		rng := r.table.rangeKey()
+		if r.index != nil {
+			rng = r.index.rangeKey()
+		}
+		p := position{key: r.table.primaryKey(item)}
+		if rng != "" {
+			p.rng = item[rng]
+		}
+		return p
+	}
+
+	key := ""
+	if r.index != nil {
+		for _, k := range r.index.keySchema {
+			key += item[k.AttributeName].keyString()
+		}
+	}
+	return position{key: key + r.table.primaryKey(item)}
+}
+
+// newRead sets up a Query or Scan of a table or one of its indexes.
+func newRead(t *table, indexName string, consistent bool, sel string, limit int, e *expressions, filter string, projection string) (*read, error) {
+	r := &read{table: t, limit: limit, forward: true}
+
+	if indexName != "" {
+		if r.index = t.index(indexName); r.index == nil {
+			return nil, common.Errorf("ValidationException", "The table does not have the specified index: %v", indexName)
+		}
+		if consistent && !r.index.local {
+			return nil, common.Errorf("ValidationException", "Consistent reads are not supported on global secondary indexes")
+		}
+	}
+	if limit < 0 {
+		return nil, common.Errorf("ValidationException", "1 validation error detected: Value '%v' at 'limit' failed to satisfy constraint: Member must have value greater than or equal to 1", limit)
+	}
+
+	if filter != "" {
+		c, err := e.condition("FilterExpression", filter)
+		if err != nil {
+			return nil, err
+		}
+		r.filter = c
+	}
+	if projection != "" {
+		p, err := e.projection(projection)
+		if err != nil {
+			return nil, err
+		}
+		r.proj = p
+	}
+
+	switch sel {
+	case "":
+	case "SPECIFIC_ATTRIBUTES":
+		if r.proj == nil {
+			return nil, common.Errorf("ValidationException", "SPECIFIC_ATTRIBUTES requires a ProjectionExpression")
+		}
+	case "ALL_ATTRIBUTES", "ALL_PROJECTED_ATTRIBUTES", "COUNT":
+		if r.proj != nil {
+			return nil, common.Errorf("ValidationException", "Cannot specify the ProjectionExpression when choosing to get %v", sel)
+		}
+		if sel == "ALL_PROJECTED_ATTRIBUTES" && r.index == nil {
+			return nil, common.Errorf("ValidationException", "ALL_PROJECTED_ATTRIBUTES can be used only when Querying using an IndexName")
+		}
+		if sel == "ALL_ATTRIBUTES" && r.index != nil && !r.index.local && r.index.projection.ProjectionType != "ALL" {
+			return nil, invalid("Select type ALL_ATTRIBUTES is not supported for global secondary index %v because its projection type is not ALL", r.index.name)
+		}
+		r.count = sel == "COUNT"
+		r.all = sel == "ALL_ATTRIBUTES"
+	default:
+		return nil, common.Errorf("ValidationException", "1 validation error detected: Value '%v' at 'select' failed to satisfy constraint: Member must satisfy enum value set: [SPECIFIC_ATTRIBUTES, COUNT, ALL_ATTRIBUTES, ALL_PROJECTED_ATTRIBUTES]", sel)
+	}
+	return r, nil
+}
+
+// start turns an ExclusiveStartKey into a position. It must hold exactly the
+// key attributes of the table and index being read.
+func (r *read) start(key Item) (*position, error) {
+	if key == nil {
+		return nil, nil
+	}
+	if err := key.validate(); err != nil {
+		return nil, err
+	}
+
+	names := r.table.keyNames(r.index)
+	if len(key) != len(names) {
+		return nil, common.Errorf("ValidationException", "The provided starting key is invalid: The provided key element does not match the schema")
+	}
+	for _, name := range names {
+		if v, ok := key[name]; !ok || v.typ() != r.table.attrType(name) {
+			return nil, common.Errorf("ValidationException", "The provided starting key is invalid: The provided key element does not match the schema")
+		}
+	}
+	p := r.position(key)
+	return &p, nil
+}
+
+// run reads items in order from after the start position, up to the Limit or
+// a page's worth, then filters and projects them.
+func (r *read) run(items []Item, start *position) ([]Item, int, int, Item, error) {
+	sort.Slice(items, func(i, j int) bool {
+		n := r.position(items[i]).compare(r.position(items[j]))
+		if r.forward {
+			return n < 0
+		}
+		return n > 0
+	})
+
+	out := []Item{}
+	count, scanned, size := 0, 0, 0
+	var last Item
+	stopped := false
+	for _, item := range items {
+		if start != nil {
+			n := r.position(item).compare(*start)
+			if r.forward && n <= 0 || !r.forward && n >= 0 {
+				continue
+			}
+		}
+		if r.limit > 0 && scanned == r.limit || size >= maxPageSize {
+			stopped = true
+			break
+		}
+
+		scanned++
+		size += item.size()
+		last = keyOf(item, r.table.keyNames(r.index))
+
+		if r.filter != nil {
+			ok, err := r.filter.eval(item)
+			if err != nil {
+				return nil, 0, 0, nil, err
+			}
+			if !ok {
+				continue
+			}
+		}
+
+		count++
+		if r.count {
+			continue
+		}
+		if r.all {
+			item = item.copy()
+		} else {
+			item = r.table.projectIndex(r.index, item)
+		}
+		if r.proj != nil {
+			item = project(item, r.proj)
+		}
+		out = append(out, item)
+	}
+
+	if !stopped {
+		last = nil
+	}
+	if r.count {
+		out = nil
+	}
+	return out, count, scanned, last, nil
+}
+
+// candidates returns the items a read sees: every item in the table, or just
+// those in the index.
+func (r *read) candidates() []Item {
+	out := []Item{}
+	for _, item := range r.table.items {
+		if r.index == nil || r.index.contains(item) {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+func (s *dynamodb) Query(req *QueryRequest) (*QueryResult, error) {
+	e, err := newExpressions(req.ExpressionAttributeNames, req.ExpressionAttributeValues)
+	if err != nil {
+		return nil, err
+	}
+	if req.KeyConditionExpression == "" {
+		return nil, common.Errorf("ValidationException", "Either the KeyConditions or KeyConditionExpression parameter must be specified in the request.")
+	}
+	parts, err := e.keyCondition(req.KeyConditionExpression)
+	if err != nil {
+		return nil, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	t, err := s.table(req.TableName)
+	if err != nil {
+		return nil, err
+	}
+	r, err := newRead(t, req.IndexName, req.ConsistentRead, req.Select, req.Limit, e, req.FilterExpression, req.ProjectionExpression)
+	if err != nil {
+		return nil, err
+	}
+	if err := e.checkUnused(); err != nil {
+		return nil, err
+	}
+	r.query = true
+	if req.ScanIndexForward != nil {
+		r.forward = *req.ScanIndexForward
+	}
+
+	hashKey, rangeKey := t.hashKey(), t.rangeKey()
+	if r.index != nil {
+		hashKey, rangeKey = r.index.hashKey(), r.index.rangeKey()
+	}
+
+	var hash *AttributeValue
+	conds := []condition{}
+	for _, part := range parts {
+		switch {
+		case part.name == hashKey && part.op == "=":
+			hash = part.values[0]
+		case part.name != rangeKey:
+			return nil, common.Errorf("ValidationException", "Query condition missed key schema element: %v", hashKey)
+		case part.op == "begins_with" && t.attrType(rangeKey) == typeN:
+			return nil, common.Errorf("ValidationException", "Invalid KeyConditionExpression: Incorrect operand type for operator or function; operator or function: begins_with, operand type: N")
+		}
+		for _, v := range part.values {
+			if v.typ() != t.attrType(part.name) {
+				return nil, invalid("Condition parameter type does not match schema type")
+			}
+		}
+		conds = append(conds, part.cond)
+	}
+	if hash == nil {
+		return nil, common.Errorf("ValidationException", "Query condition missed key schema element: %v", hashKey)
+	}
+
+	start, err := r.start(req.ExclusiveStartKey)
+	if err != nil {
+		return nil, err
+	}
+	if start != nil && !equal(req.ExclusiveStartKey[hashKey], hash) {
+		return nil, common.Errorf("ValidationException", "The provided starting key is outside query boundaries based on provided conditions")
+	}
+
+	items := []Item{}
+	for _, item := range r.candidates() {
+		ok := true
+		for _, c := range conds {
+			matched, err := c.eval(item)
+			if err != nil {
+				return nil, err
+			}
+			ok = ok && matched
+		}
+		if ok {
+			items = append(items, item)
+		}
+	}
+
+	out, count, scanned, last, err := r.run(items, start)
+	if err != nil {
+		return nil, err
+	}
+	return &QueryResult{
+		Count:            count,
+		Items:            out,
+		LastEvaluatedKey: last,
+		ScannedCount:     scanned,
+	}, nil
+}
+
+func (s *dynamodb) Scan(req *ScanRequest) (*ScanResult, error) {
+	if req.TotalSegments != 0 || req.Segment != 0 {
+		if req.TotalSegments < 1 || req.TotalSegments > 1000000 {
+			return nil, common.Errorf("ValidationException", "1 validation error detected: Value '%v' at 'totalSegments' failed to satisfy constraint: Member must have value between 1 and 1000000", req.TotalSegments)
+		}
+		if req.Segment < 0 || req.Segment >= req.TotalSegments {
+			return nil, common.Errorf("ValidationException", "The Segment parameter is zero-based and must be less than parameter TotalSegments: Segment: %v is not less than TotalSegments: %v", req.Segment, req.TotalSegments)
+		}
+	}
+
+	e, err := newExpressions(req.ExpressionAttributeNames, req.ExpressionAttributeValues)
+	if err != nil {
+		return nil, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	t, err := s.table(req.TableName)
+	if err != nil {
+		return nil, err
+	}
+	r, err := newRead(t, req.IndexName, req.ConsistentRead, req.Select, req.Limit, e, req.FilterExpression, req.ProjectionExpression)
+	if err != nil {
+		return nil, err
+	}
+	if err := e.checkUnused(); err != nil {
+		return nil, err
+	}
+	start, err := r.start(req.ExclusiveStartKey)
+	if err != nil {
+		return nil, err
+	}
+
+	items := []Item{}
+	for _, item := range r.candidates() {
+		if req.TotalSegments > 1 {
+			h := fnv.New32a()
+			h.Write([]byte(item[t.hashKey()].keyString()))
+			if int(h.Sum32()%uint32(req.TotalSegments)) != req.Segment {
+				continue
+			}
+		}
+		items = append(items, item)
+	}
+
+	out, count, scanned, last, err := r.run(items, start)
+	if err != nil {
+		return nil, err
+	}
+	return &ScanResult{
+		Count:            count,
+		Items:            out,
+		LastEvaluatedKey: last,
+		ScannedCount:     scanned,
+	}, nil
+}
@@ -0,0 +1,552 @@
+package dynamodb
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fernomac/aws-local/pkg/common"
+	"github.com/fernomac/aws-local/pkg/kms"
+)
+
+// Limits on tables and items.
+const (
+	maxGlobalIndexes = 20
+	maxLocalIndexes  = 5
+	maxItemSize      = 400 * 1024
+)
+
+// Billing modes.
+const (
+	billingProvisioned   = "PROVISIONED"
+	billingPayPerRequest = "PAY_PER_REQUEST"
+)
+
+// defaultKeyID is the key tables are encrypted with if SSE is enabled
+// without naming one.
+const defaultKeyID = "alias/aws/dynamodb"
+
+var namePattern = regexp.MustCompile(`^[a-zA-Z0-9_.\-]{3,255}$`)
+
+// invalid returns the ValidationException DynamoDB uses for bad parameter
+// values.
+func invalid(format string, args ...interface{}) error {
+	return common.Errorf("ValidationException", "One or more parameter values were invalid: "+format, args...)
+}
+
+// index is a global or local secondary index.
+type index struct {
+	name       string
+	local      bool
+	keySchema  []KeySchemaElement
+	projection Projection
+	throughput *ProvisionedThroughput
+}
+
+func (ix *index) hashKey() string {
+	return ix.keySchema[0].AttributeName
+}
+
+// rangeKey returns the index's range key, or "" if it has none.
+func (ix *index) rangeKey() string {
+	if len(ix.keySchema) < 2 {
+		return ""
+	}
+	return ix.keySchema[1].AttributeName
+}
+
+// contains reports whether an item appears in the index: it must have all of
+// the index's key attributes.
+func (ix *index) contains(item Item) bool {
+	for _, k := range ix.keySchema {
+		if _, ok := item[k.AttributeName]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// table is a single table.
+type table struct {
+	name        string
+	arn         string
+	id          string
+	created     time.Time
+	attrs       []AttributeDefinition
+	keySchema   []KeySchemaElement
+	billingMode string
+	throughput  *ProvisionedThroughput
+	indexes     []*index
+	tags        []Tag
+
+	// sseKeyArn is the KMS key the table is encrypted with, or "" if it uses
+	// a key owned by DynamoDB. inaccessible is when the key was first found
+	// to be unusable.
+	sseKeyArn    string
+	inaccessible time.Time
+
+	// items are keyed by primaryKey.
+	items map[string]Item
+}
+
+func tableArn(name string) string {
+	return fmt.Sprintf("arn:aws:dynamodb:%v:%v:table/%v", common.Region, common.AccountID, name)
+}
+
+func (t *table) hashKey() string {
+	return t.keySchema[0].AttributeName
+}
+
+// rangeKey returns the table's range key, or "" if it has none.
+func (t *table) rangeKey() string {
+	if len(t.keySchema) < 2 {
+		return ""
+	}
+	return t.keySchema[1].AttributeName
+}
+
+// attrType returns the type of a key attribute.
+func (t *table) attrType(name string) string {
+	for _, a := range t.attrs {
+		if a.AttributeName == name {
+			return a.AttributeType
+		}
+	}
+	return ""
+}
+
+// index returns the named index, or nil.
+func (t *table) index(name string) *index {
+	for _, ix := range t.indexes {
+		if ix.name == name {
+			return ix
+		}
+	}
+	return nil
+}
+
+// primaryKey encodes an item's primary key.
+func (t *table) primaryKey(item Item) string {
+	out := ""
+	for _, k := range t.keySchema {
+		out += item[k.AttributeName].keyString()
+	}
+	return out
+}
+
+// keyNames returns the names of the table's key attributes and, if there is
+// one, the index's.
+func (t *table) keyNames(ix *index) []string {
+	out := []string{}
+	seen := map[string]bool{}
+	schema := t.keySchema
+	if ix != nil {
+		schema = append(append([]KeySchemaElement{}, schema...), ix.keySchema...)
+	}
+	for _, k := range schema {
+		if !seen[k.AttributeName] {
+			seen[k.AttributeName] = true
+			out = append(out, k.AttributeName)
+		}
+	}
+	return out
+}
+
+// keyOf copies the named attributes out of an item.
+func keyOf(item Item, names []string) Item {
+	out := Item{}
+	for _, name := range names {
+		if v, ok := item[name]; ok {
+			out[name] = v.copy()
+		}
+	}
+	return out
+}
+
+// emptyKey reports whether a key value is an empty string or binary.
+func emptyKey(v *AttributeValue) bool {
+	return v.S != nil && *v.S == "" || v.B != nil && len(v.B) == 0
+}
+
+// validateKey checks the Key of a request against the table's key schema.
+func (t *table) validateKey(key Item) error {
+	if err := key.validate(); err != nil {
+		return err
+	}
+	if len(key) != len(t.keySchema) {
+		return common.Errorf("ValidationException", "The provided key element does not match the schema")
+	}
+	for _, k := range t.keySchema {
+		v, ok := key[k.AttributeName]
+		if !ok || v.typ() != t.attrType(k.AttributeName) {
+			return common.Errorf("ValidationException", "The provided key element does not match the schema")
+		}
+		if emptyKey(v) {
+			return common.Errorf("ValidationException", "One or more parameter values are not valid. The AttributeValue for a key attribute cannot contain an empty string value. Key: %v", k.AttributeName)
+		}
+	}
+	return nil
+}
+
+// validateItem checks an item about to be written: it must have the table's
+// key, any index keys must be the right type, and it mustn't be too big.
+func (t *table) validateItem(item Item) error {
+	for _, k := range t.keySchema {
+		v, ok := item[k.AttributeName]
+		if !ok {
+			return invalid("Missing the key %v in the item", k.AttributeName)
+		}
+		if typ := t.attrType(k.AttributeName); v.typ() != typ {
+			return invalid("Type mismatch for key %v expected: %v actual: %v", k.AttributeName, typ, v.typ())
+		}
+		if emptyKey(v) {
+			return common.Errorf("ValidationException", "One or more parameter values are not valid. The AttributeValue for a key attribute cannot contain an empty string value. Key: %v", k.AttributeName)
+		}
+	}
+
+	for _, ix := range t.indexes {
+		for _, k := range ix.keySchema {
+			v, ok := item[k.AttributeName]
+			if !ok {
+				continue
+			}
+			if typ := t.attrType(k.AttributeName); v.typ() != typ {
+				return invalid("Type mismatch for Index Key %v Expected: %v Actual: %v IndexName: %v", k.AttributeName, typ, v.typ(), ix.name)
+			}
+			if emptyKey(v) {
+				return common.Errorf("ValidationException", "One or more parameter values are not valid. A value specified for a secondary index key is not supported. The AttributeValue for a key attribute cannot contain an empty string value. IndexName: %v, IndexKey: %v", ix.name, k.AttributeName)
+			}
+		}
+	}
+
+	if item.size() > maxItemSize {
+		return common.Errorf("ValidationException", "Item size has exceeded the maximum allowed size")
+	}
+	return nil
+}
+
+// projectIndex returns the attributes of an item an index holds.
+func (t *table) projectIndex(ix *index, item Item) Item {
+	if ix == nil || ix.projection.ProjectionType == "ALL" {
+		return item.copy()
+	}
+	return keyOf(item, append(t.keyNames(ix), ix.projection.NonKeyAttributes...))
+}
+
+//
+// Creating tables.
+//
+
+// validateKeySchema checks the key schema of a table or index.
+func validateKeySchema(schema []KeySchemaElement, defined map[string]string) error {
+	if len(schema) < 1 || len(schema) > 2 {
+		return common.Errorf("ValidationException", "1 validation error detected: Value at 'keySchema' failed to satisfy constraint: Member must have length less than or equal to 2")
+	}
+	if schema[0].KeyType != "HASH" {
+		return invalid("Invalid KeySchema: The first KeySchemaElement is not a HASH key type")
+	}
+	if len(schema) == 2 {
+		if schema[1].KeyType != "RANGE" {
+			return invalid("Invalid KeySchema: The second KeySchemaElement is not a RANGE key type")
+		}
+		if schema[0].AttributeName == schema[1].AttributeName {
+			return invalid("Both the Hash Key and the Range Key element in the KeySchema have the same name")
+		}
+	}
+	for _, k := range schema {
+		if _, ok := defined[k.AttributeName]; !ok {
+			return invalid("Some index key attributes are not defined in AttributeDefinitions. Keys: [%v], AttributeDefinitions: [%v]", k.AttributeName, strings.Join(sortedKeys(defined), ", "))
+		}
+	}
+	return nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	out := []string{}
+	for k := range m {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// validateThroughput checks that a table or index has provisioned throughput
+// exactly when its billing mode needs it.
+func validateThroughput(billingMode string, tp *ProvisionedThroughput) error {
+	if billingMode == billingPayPerRequest {
+		if tp != nil {
+			return invalid("Neither ReadCapacityUnits nor WriteCapacityUnits can be specified when BillingMode is PAY_PER_REQUEST")
+		}
+		return nil
+	}
+	if tp == nil {
+		return invalid("ReadCapacityUnits and WriteCapacityUnits must both be specified when BillingMode is PROVISIONED")
+	}
+	if tp.ReadCapacityUnits < 1 || tp.WriteCapacityUnits < 1 {
+		return invalid("Cannot create a table or index with ProvisionedThroughput of less than 1")
+	}
+	return nil
+}
+
+// validateProjection checks an index projection.
+func validateProjection(p Projection) error {
+	switch p.ProjectionType {
+	case "ALL", "KEYS_ONLY":
+		if len(p.NonKeyAttributes) > 0 {
+			return invalid("ProjectionType is %v, but NonKeyAttributes is specified", p.ProjectionType)
+		}
+	case "INCLUDE":
+		if len(p.NonKeyAttributes) == 0 {
+			return invalid("ProjectionType is INCLUDE, but NonKeyAttributes is not specified")
+		}
+	default:
+		return invalid("Unknown ProjectionType: %v", p.ProjectionType)
+	}
+	return nil
+}
+
+// newTable validates a CreateTable request and makes the table it describes.
+func newTable(req *CreateTableRequest) (*table, error) {
+	if !namePattern.MatchString(req.TableName) {
+		return nil, common.Errorf("ValidationException", "TableName must be at least 3 characters long and at most 255 characters long, and contain only the characters a-z, A-Z, 0-9, '_', '-', and '.'")
+	}
+
+	defined := map[string]string{}
+	for _, a := range req.AttributeDefinitions {
+		if _, ok := defined[a.AttributeName]; ok {
+			return nil, invalid("Duplicate AttributeName in AttributeDefinitions: %v", a.AttributeName)
+		}
+		switch a.AttributeType {
+		case typeS, typeN, typeB:
+		default:
+			return nil, invalid("Member must satisfy enum value set: [B, N, S] for AttributeType of %v", a.AttributeName)
+		}
+		defined[a.AttributeName] = a.AttributeType
+	}
+
+	billingMode := req.BillingMode
+	switch billingMode {
+	case "":
+		billingMode = billingProvisioned
+	case billingProvisioned, billingPayPerRequest:
+	default:
+		return nil, invalid("Unknown BillingMode: %v", billingMode)
+	}
+
+	if err := validateKeySchema(req.KeySchema, defined); err != nil {
+		return nil, err
+	}
+	if err := validateThroughput(billingMode, req.ProvisionedThroughput); err != nil {
+		return nil, err
+	}
+
+	t := &table{
+		name:        req.TableName,
+		arn:         tableArn(req.TableName),
+		id:          common.NewRequestID(),
+		created:     time.Now(),
+		attrs:       req.AttributeDefinitions,
+		keySchema:   req.KeySchema,
+		billingMode: billingMode,
+		throughput:  req.ProvisionedThroughput,
+		tags:        req.Tags,
+		items:       make(map[string]Item),
+	}
+
+	if len(req.GlobalSecondaryIndexes) > maxGlobalIndexes {
+		return nil, common.Errorf("LimitExceededException", "Subscriber limit exceeded: The number of global secondary indexes exceeds the limit of %v", maxGlobalIndexes)
+	}
+	if len(req.LocalSecondaryIndexes) > maxLocalIndexes {
+		return nil, invalid("Table has more than %v local secondary indexes", maxLocalIndexes)
+	}
+
+	for i, si := range append(append([]SecondaryIndex{}, req.GlobalSecondaryIndexes...), req.LocalSecondaryIndexes...) {
+		ix := &index{
+			name:       si.IndexName,
+			local:      i >= len(req.GlobalSecondaryIndexes),
+			keySchema:  si.KeySchema,
+			projection: si.Projection,
+			throughput: si.ProvisionedThroughput,
+		}
+
+		if !namePattern.MatchString(ix.name) {
+			return nil, common.Errorf("ValidationException", "IndexName must be at least 3 characters long and at most 255 characters long, and contain only the characters a-z, A-Z, 0-9, '_', '-', and '.'")
+		}
+		if t.index(ix.name) != nil {
+			return nil, invalid("Duplicate index name: %v", ix.name)
+		}
+		if err := validateKeySchema(ix.keySchema, defined); err != nil {
+			return nil, err
+		}
+		if err := validateProjection(ix.projection); err != nil {
+			return nil, err
+		}
+
+		if ix.local {
+			if t.rangeKey() == "" {
+				return nil, invalid("Table KeySchema does not have a range key, which is required when specifying a LocalSecondaryIndex")
+			}
+			if ix.hashKey() != t.hashKey() || ix.rangeKey() == "" {
+				return nil, invalid("Index KeySchema does not have the same leading hash key as table KeySchema for index: %v", ix.name)
+			}
+			if ix.throughput != nil {
+				return nil, invalid("ProvisionedThroughput should not be specified for index: %v", ix.name)
+			}
+		} else if err := validateThroughput(billingMode, ix.throughput); err != nil {
+			return nil, err
+		}
+
+		t.indexes = append(t.indexes, ix)
+	}
+
+	used := map[string]bool{}
+	for _, name := range t.keyNames(nil) {
+		used[name] = true
+	}
+	for _, ix := range t.indexes {
+		for _, k := range ix.keySchema {
+			used[k.AttributeName] = true
+		}
+	}
+	if len(used) != len(defined) {
+		return nil, invalid("Some AttributeDefinitions are not used. AttributeDefinitions: [%v], keys used: [%v]", strings.Join(sortedKeys(defined), ", "), strings.Join(sortedSet(used), ", "))
+	}
+	return t, nil
+}
+
+func sortedSet(m map[string]bool) []string {
+	out := []string{}
+	for k := range m {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
+
+//
+// Encryption at rest.
+//
+
+// sseKey checks the key named in an SSESpecification, returning its ARN, or
+// "" if the table should use a key owned by DynamoDB.
+func sseKey(k kms.KMS, spec *SSESpecification) (string, error) {
+	if spec == nil || !spec.Enabled {
+		if spec != nil && spec.KMSMasterKeyID != "" {
+			return "", invalid("SSESpecification: KMSMasterKeyId can be specified only when SSE is enabled")
+		}
+		return "", nil
+	}
+	if spec.SSEType != "" && spec.SSEType != "KMS" {
+		return "", invalid("Unsupported SSEType: %v", spec.SSEType)
+	}
+
+	keyID := spec.KMSMasterKeyID
+	if keyID == "" {
+		keyID = defaultKeyID
+	}
+
+	out, err := k.DescribeKey(&kms.DescribeKeyRequest{KeyID: keyID})
+	if err != nil {
+		return "", invalid("KMSMasterKeyId %v is invalid: %v", keyID, err.Error())
+	}
+	md := out.KeyMetadata
+	if md.KeyState != kms.KeyStateEnabled {
+		return "", invalid("KMSMasterKeyId %v is not enabled; key state: %v", keyID, md.KeyState)
+	}
+	if md.KeyUsage != "ENCRYPT_DECRYPT" || md.KeySpec != "SYMMETRIC_DEFAULT" {
+		return "", invalid("KMSMasterKeyId %v is not a symmetric encryption key", keyID)
+	}
+	return md.Arn, nil
+}
+
+// accessible reports whether the table's KMS key can still be used, noting
+// when it first couldn't.
+func (t *table) accessible(k kms.KMS) bool {
+	if t.sseKeyArn == "" {
+		return true
+	}
+
+	out, err := k.DescribeKey(&kms.DescribeKeyRequest{KeyID: t.sseKeyArn})
+	if err == nil && out.KeyMetadata.KeyState == kms.KeyStateEnabled {
+		t.inaccessible = time.Time{}
+		return true
+	}
+	if t.inaccessible.IsZero() {
+		t.inaccessible = time.Now()
+	}
+	return false
+}
+
+//
+// Describing tables.
+//
+
+// describe describes the table. The status is ACTIVE unless the table's KMS
+// key has become unusable.
+func (t *table) describe(k kms.KMS, status string) *TableDescription {
+	out := &TableDescription{
+		AttributeDefinitions:  t.attrs,
+		CreationDateTime:      t.created.Unix(),
+		ItemCount:             int64(len(t.items)),
+		KeySchema:             t.keySchema,
+		ProvisionedThroughput: &ProvisionedThroughputDescription{},
+		TableArn:              t.arn,
+		TableID:               t.id,
+		TableName:             t.name,
+		TableStatus:           status,
+	}
+	for _, item := range t.items {
+		out.TableSizeBytes += int64(item.size())
+	}
+
+	if t.billingMode == billingPayPerRequest {
+		out.BillingModeSummary = &BillingModeSummary{BillingMode: billingPayPerRequest}
+	} else {
+		out.ProvisionedThroughput.ReadCapacityUnits = t.throughput.ReadCapacityUnits
+		out.ProvisionedThroughput.WriteCapacityUnits = t.throughput.WriteCapacityUnits
+	}
+
+	if t.sseKeyArn != "" {
+		out.SSEDescription = &SSEDescription{
+			KMSMasterKeyArn: t.sseKeyArn,
+			SSEType:         "KMS",
+			Status:          "ENABLED",
+		}
+		if !t.accessible(k) {
+			out.SSEDescription.InaccessibleEncryptionDateTime = t.inaccessible.Unix()
+			if status == "ACTIVE" {
+				out.TableStatus = "INACCESSIBLE_ENCRYPTION_CREDENTIALS"
+			}
+		}
+	}
+
+	for _, ix := range t.indexes {
+		d := SecondaryIndexDescription{
+			IndexArn:   t.arn + "/index/" + ix.name,
+			IndexName:  ix.name,
+			KeySchema:  ix.keySchema,
+			Projection: ix.projection,
+		}
+		for _, item := range t.items {
+			if ix.contains(item) {
+				d.ItemCount++
+				d.IndexSizeBytes += int64(t.projectIndex(ix, item).size())
+			}
+		}
+
+		if ix.local {
+			out.LocalSecondaryIndexes = append(out.LocalSecondaryIndexes, d)
+			continue
+		}
+		d.IndexStatus = status
+		d.ProvisionedThroughput = &ProvisionedThroughputDescription{}
+		if ix.throughput != nil {
+			d.ProvisionedThroughput.ReadCapacityUnits = ix.throughput.ReadCapacityUnits
+			d.ProvisionedThroughput.WriteCapacityUnits = ix.throughput.WriteCapacityUnits
+		}
+		out.GlobalSecondaryIndexes = append(out.GlobalSecondaryIndexes, d)
+	}
+	return out
+}
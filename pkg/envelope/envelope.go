@@ -0,0 +1,124 @@
+// Package envelope is the envelope encryption the service fakes share: data
+// keys from KMS, AES-GCM under those keys, and turning errors from KMS into
+// each service's own.
+package envelope
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+
+	"github.com/fernomac/aws-local/pkg/common"
+	"github.com/fernomac/aws-local/pkg/kms"
+)
+
+// NonceSize is the size of the nonces Seal makes.
+const NonceSize = 12
+
+// Codes gives the error code a service returns for an error from KMS, given
+// the KMS error's code, or "" for errors that don't come with one. An empty
+// result means the error is passed on as it is.
+type Codes func(kmsCode string) string
+
+// Table makes Codes that look KMS error codes up in codes, using fallback for
+// any other error.
+func Table(codes map[string]string, fallback string) Codes {
+	return func(kmsCode string) string {
+		if code, ok := codes[kmsCode]; ok {
+			return code
+		}
+		return fallback
+	}
+}
+
+// Error turns an error from KMS into the error the service returns.
+func (c Codes) Error(err error) error {
+	kmsCode := ""
+	if ce, ok := err.(common.Error); ok {
+		kmsCode = ce.Code
+	}
+	code := c(kmsCode)
+	if code == "" {
+		return err
+	}
+	return common.Errorf(code, "The request was rejected by KMS: %v", err)
+}
+
+// DataKey is a 256-bit data key from KMS.
+type DataKey struct {
+	KeyID      string
+	Ciphertext string
+	Plaintext  []byte
+}
+
+// GenerateDataKey gets a new data key from KMS, bound to the given encryption
+// context. Errors from KMS are turned into the service's by codes.
+func GenerateDataKey(k kms.KMS, keyID string, ctx map[string]string, codes Codes) (*DataKey, error) {
+	out, err := k.GenerateDataKey(&kms.GenerateDataKeyRequest{
+		KeyID:             keyID,
+		KeySpec:           "AES_256",
+		EncryptionContext: ctx,
+	})
+	if err != nil {
+		return nil, codes.Error(err)
+	}
+	plaintext, err := base64.StdEncoding.DecodeString(out.Plaintext)
+	if err != nil {
+		return nil, err
+	}
+	return &DataKey{KeyID: out.KeyID, Ciphertext: out.CiphertextBlob, Plaintext: plaintext}, nil
+}
+
+// DecryptDataKey asks KMS to decrypt a data key that GenerateDataKey got with
+// the same encryption context.
+func DecryptDataKey(k kms.KMS, ciphertext string, ctx map[string]string, codes Codes) (*DataKey, error) {
+	out, err := k.Decrypt(&kms.DecryptRequest{
+		CiphertextBlob:    ciphertext,
+		EncryptionContext: ctx,
+	})
+	if err != nil {
+		return nil, codes.Error(err)
+	}
+	plaintext, err := base64.StdEncoding.DecodeString(out.Plaintext)
+	if err != nil {
+		return nil, err
+	}
+	return &DataKey{KeyID: out.KeyID, Ciphertext: ciphertext, Plaintext: plaintext}, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Seal encrypts data under key with AES-GCM, binding it to aad, and returns
+// the random nonce it used along with the ciphertext.
+func Seal(key []byte, data []byte, aad []byte) ([]byte, []byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	nonce := make([]byte, NonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, nil, err
+	}
+	return nonce, aead.Seal(nil, nonce, data, aad), nil
+}
+
+// Open decrypts what Seal sealed. It fails if the ciphertext was tampered
+// with or the key or aad are wrong.
+func Open(key []byte, nonce []byte, ciphertext []byte, aad []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != NonceSize {
+		return nil, errors.New("envelope: bad nonce size")
+	}
+	return aead.Open(nil, nonce, ciphertext, aad)
+}
@@ -0,0 +1,109 @@
+package envelope
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/fernomac/aws-local/pkg/common"
+	"github.com/fernomac/aws-local/pkg/kms"
+)
+
+func TestSealOpen(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, 32)
+	nonce, ciphertext, err := Seal(key, []byte("hello"), []byte("id"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nonce) != NonceSize {
+		t.Fatalf("nonce is %v bytes", len(nonce))
+	}
+
+	tests := []struct {
+		name       string
+		key        []byte
+		nonce      []byte
+		ciphertext []byte
+		aad        string
+		ok         bool
+	}{
+		{"ok", key, nonce, ciphertext, "id", true},
+		{"wrong aad", key, nonce, ciphertext, "other", false},
+		{"wrong key", bytes.Repeat([]byte{2}, 32), nonce, ciphertext, "id", false},
+		{"short nonce", key, nonce[1:], ciphertext, "id", false},
+		{"tampered", key, nonce, append([]byte{ciphertext[0] ^ 1}, ciphertext[1:]...), "id", false},
+	}
+
+	for _, test := range tests {
+		out, err := Open(test.key, test.nonce, test.ciphertext, []byte(test.aad))
+		if test.ok != (err == nil) {
+			t.Errorf("%v: got %v", test.name, err)
+		}
+		if test.ok && string(out) != "hello" {
+			t.Errorf("%v: got %q", test.name, out)
+		}
+	}
+}
+
+func TestCodes(t *testing.T) {
+	codes := Table(map[string]string{"DisabledException": "KmsDisabled"}, "KmsInvalidState")
+	passThrough := Table(map[string]string{"NotFoundException": "InvalidKeyId"}, "")
+	plain := errors.New("boom")
+
+	tests := []struct {
+		codes Codes
+		err   error
+		code  string
+	}{
+		{codes, common.NewError("DisabledException"), "KmsDisabled"},
+		{codes, common.NewError("AccessDeniedException"), "KmsInvalidState"},
+		{codes, plain, "KmsInvalidState"},
+		{passThrough, common.NewError("NotFoundException"), "InvalidKeyId"},
+		{passThrough, common.NewError("AccessDeniedException"), "AccessDeniedException"},
+	}
+
+	for _, test := range tests {
+		ce, ok := test.codes.Error(test.err).(common.Error)
+		if !ok || ce.Code != test.code {
+			t.Errorf("%v: got %v, want %v", test.err, ce, test.code)
+		}
+	}
+	if err := passThrough.Error(plain); err != plain {
+		t.Errorf("plain error became %v", err)
+	}
+}
+
+func TestDataKeys(t *testing.T) {
+	store := kms.New()
+	key, err := store.CreateKey(&kms.CreateKeyRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	codes := Table(nil, "EncryptionFailure")
+	ctx := map[string]string{"a": "b"}
+
+	dk, err := GenerateDataKey(store, key.KeyMetadata.KeyID, ctx, codes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dk.Plaintext) != 32 || dk.KeyID != key.KeyMetadata.Arn {
+		t.Fatalf("got %+v", dk)
+	}
+
+	again, err := DecryptDataKey(store, dk.Ciphertext, ctx, codes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(again.Plaintext, dk.Plaintext) {
+		t.Errorf("decrypted a different key")
+	}
+
+	_, err = DecryptDataKey(store, dk.Ciphertext, map[string]string{"a": "c"}, codes)
+	if ce, ok := err.(common.Error); !ok || ce.Code != "EncryptionFailure" {
+		t.Errorf("wrong context: got %v", err)
+	}
+	_, err = GenerateDataKey(store, "alias/missing", ctx, codes)
+	if ce, ok := err.(common.Error); !ok || ce.Code != "EncryptionFailure" {
+		t.Errorf("missing key: got %v", err)
+	}
+}
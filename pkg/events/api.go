@@ -0,0 +1,323 @@
+package events
+
+// Events is the service interface for Amazon EventBridge.
+type Events interface {
+	CreateEventBus(*CreateEventBusRequest) (*CreateEventBusResult, error)
+	DeleteEventBus(*DeleteEventBusRequest) (*DeleteEventBusResult, error)
+	DescribeEventBus(*DescribeEventBusRequest) (*DescribeEventBusResult, error)
+	ListEventBuses(*ListEventBusesRequest) (*ListEventBusesResult, error)
+
+	PutRule(*PutRuleRequest) (*PutRuleResult, error)
+	DeleteRule(*DeleteRuleRequest) (*DeleteRuleResult, error)
+	DescribeRule(*DescribeRuleRequest) (*DescribeRuleResult, error)
+	ListRules(*ListRulesRequest) (*ListRulesResult, error)
+	EnableRule(*EnableRuleRequest) (*EnableRuleResult, error)
+	DisableRule(*DisableRuleRequest) (*DisableRuleResult, error)
+	ListRuleNamesByTarget(*ListRuleNamesByTargetRequest) (*ListRuleNamesByTargetResult, error)
+
+	PutTargets(*PutTargetsRequest) (*PutTargetsResult, error)
+	RemoveTargets(*RemoveTargetsRequest) (*RemoveTargetsResult, error)
+	ListTargetsByRule(*ListTargetsByRuleRequest) (*ListTargetsByRuleResult, error)
+
+	PutEvents(*PutEventsRequest) (*PutEventsResult, error)
+	TestEventPattern(*TestEventPatternRequest) (*TestEventPatternResult, error)
+
+	// RunSchedules isn't an AWS API. It fires the enabled scheduled rules that
+	// are due, once for each time they were due, and returns how many events
+	// it sent.
+	RunSchedules() int
+}
+
+// Rule states.
+const (
+	RuleStateEnabled  = "ENABLED"
+	RuleStateDisabled = "DISABLED"
+)
+
+// DefaultEventBus is the name of the event bus every account has.
+const DefaultEventBus = "default"
+
+//
+// Event buses.
+//
+
+// EventBus describes an event bus.
+type EventBus struct {
+	Arn  string `json:"Arn"`
+	Name string `json:"Name"`
+}
+
+// CreateEventBusRequest is the request for CreateEventBus.
+type CreateEventBusRequest struct {
+	Name string `json:"Name"`
+}
+
+// CreateEventBusResult is the result of CreateEventBus.
+type CreateEventBusResult struct {
+	EventBusArn string `json:"EventBusArn"`
+}
+
+// DeleteEventBusRequest is the request for DeleteEventBus.
+type DeleteEventBusRequest struct {
+	Name string `json:"Name"`
+}
+
+// DeleteEventBusResult is the result of DeleteEventBus.
+type DeleteEventBusResult struct{}
+
+// DescribeEventBusRequest is the request for DescribeEventBus. Name may be a
+// name or an ARN, and defaults to the default bus.
+type DescribeEventBusRequest struct {
+	Name string `json:"Name"`
+}
+
+// DescribeEventBusResult is the result of DescribeEventBus.
+type DescribeEventBusResult struct {
+	Arn  string `json:"Arn"`
+	Name string `json:"Name"`
+}
+
+// ListEventBusesRequest is the request for ListEventBuses.
+type ListEventBusesRequest struct {
+	Limit      int    `json:"Limit"`
+	NamePrefix string `json:"NamePrefix"`
+	NextToken  string `json:"NextToken"`
+}
+
+// ListEventBusesResult is the result of ListEventBuses.
+type ListEventBusesResult struct {
+	EventBuses []EventBus `json:"EventBuses"`
+	NextToken  string     `json:"NextToken,omitempty"`
+}
+
+//
+// Rules.
+//
+
+// Rule describes a rule.
+type Rule struct {
+	Arn                string `json:"Arn"`
+	Description        string `json:"Description,omitempty"`
+	EventBusName       string `json:"EventBusName"`
+	EventPattern       string `json:"EventPattern,omitempty"`
+	Name               string `json:"Name"`
+	RoleArn            string `json:"RoleArn,omitempty"`
+	ScheduleExpression string `json:"ScheduleExpression,omitempty"`
+	State              string `json:"State"`
+}
+
+// PutRuleRequest is the request for PutRule, which creates or updates a rule.
+// A rule needs an event pattern, a schedule expression or both.
+type PutRuleRequest struct {
+	Description        string `json:"Description"`
+	EventBusName       string `json:"EventBusName"`
+	EventPattern       string `json:"EventPattern"`
+	Name               string `json:"Name"`
+	RoleArn            string `json:"RoleArn"`
+	ScheduleExpression string `json:"ScheduleExpression"`
+	State              string `json:"State"`
+}
+
+// PutRuleResult is the result of PutRule.
+type PutRuleResult struct {
+	RuleArn string `json:"RuleArn"`
+}
+
+// DeleteRuleRequest is the request for DeleteRule.
+type DeleteRuleRequest struct {
+	EventBusName string `json:"EventBusName"`
+	Force        bool   `json:"Force"`
+	Name         string `json:"Name"`
+}
+
+// DeleteRuleResult is the result of DeleteRule.
+type DeleteRuleResult struct{}
+
+// DescribeRuleRequest is the request for DescribeRule.
+type DescribeRuleRequest struct {
+	EventBusName string `json:"EventBusName"`
+	Name         string `json:"Name"`
+}
+
+// DescribeRuleResult is the result of DescribeRule.
+type DescribeRuleResult Rule
+
+// ListRulesRequest is the request for ListRules.
+type ListRulesRequest struct {
+	EventBusName string `json:"EventBusName"`
+	Limit        int    `json:"Limit"`
+	NamePrefix   string `json:"NamePrefix"`
+	NextToken    string `json:"NextToken"`
+}
+
+// ListRulesResult is the result of ListRules.
+type ListRulesResult struct {
+	NextToken string `json:"NextToken,omitempty"`
+	Rules     []Rule `json:"Rules"`
+}
+
+// EnableRuleRequest is the request for EnableRule.
+type EnableRuleRequest struct {
+	EventBusName string `json:"EventBusName"`
+	Name         string `json:"Name"`
+}
+
+// EnableRuleResult is the result of EnableRule.
+type EnableRuleResult struct{}
+
+// DisableRuleRequest is the request for DisableRule.
+type DisableRuleRequest struct {
+	EventBusName string `json:"EventBusName"`
+	Name         string `json:"Name"`
+}
+
+// DisableRuleResult is the result of DisableRule.
+type DisableRuleResult struct{}
+
+// ListRuleNamesByTargetRequest is the request for ListRuleNamesByTarget.
+type ListRuleNamesByTargetRequest struct {
+	EventBusName string `json:"EventBusName"`
+	Limit        int    `json:"Limit"`
+	NextToken    string `json:"NextToken"`
+	TargetArn    string `json:"TargetArn"`
+}
+
+// ListRuleNamesByTargetResult is the result of ListRuleNamesByTarget.
+type ListRuleNamesByTargetResult struct {
+	NextToken string   `json:"NextToken,omitempty"`
+	RuleNames []string `json:"RuleNames"`
+}
+
+//
+// Targets.
+//
+
+// Target is where a rule sends the events it matches: an SQS queue ARN, an
+// http or https URL, or the ARN of a sink (see SinkArn). Input, InputPath and
+// InputTransformer, at most one of which may be set, change what is sent;
+// by default it's the whole event.
+type Target struct {
+	Arn              string            `json:"Arn"`
+	DeadLetterConfig *DeadLetterConfig `json:"DeadLetterConfig,omitempty"`
+	ID               string            `json:"Id"`
+	Input            string            `json:"Input,omitempty"`
+	InputPath        string            `json:"InputPath,omitempty"`
+	InputTransformer *InputTransformer `json:"InputTransformer,omitempty"`
+	RoleArn          string            `json:"RoleArn,omitempty"`
+	SqsParameters    *SqsParameters    `json:"SqsParameters,omitempty"`
+}
+
+// DeadLetterConfig names the SQS queue events go to when they can't be
+// delivered to a target.
+type DeadLetterConfig struct {
+	Arn string `json:"Arn,omitempty"`
+}
+
+// InputTransformer builds what a target is sent from parts of the event.
+// InputPathsMap maps names to JSON paths into the event, and each <name> in
+// InputTemplate is replaced with the value at its path.
+type InputTransformer struct {
+	InputPathsMap map[string]string `json:"InputPathsMap,omitempty"`
+	InputTemplate string            `json:"InputTemplate"`
+}
+
+// SqsParameters sets the message group of messages sent to a FIFO queue.
+type SqsParameters struct {
+	MessageGroupID string `json:"MessageGroupId,omitempty"`
+}
+
+// PutTargetsRequest is the request for PutTargets, which adds targets to a
+// rule or updates those with the same ID.
+type PutTargetsRequest struct {
+	EventBusName string   `json:"EventBusName"`
+	Rule         string   `json:"Rule"`
+	Targets      []Target `json:"Targets"`
+}
+
+// PutTargetsResultEntry is a target PutTargets or RemoveTargets failed on.
+type PutTargetsResultEntry struct {
+	ErrorCode    string `json:"ErrorCode"`
+	ErrorMessage string `json:"ErrorMessage"`
+	TargetID     string `json:"TargetId"`
+}
+
+// PutTargetsResult is the result of PutTargets.
+type PutTargetsResult struct {
+	FailedEntries    []PutTargetsResultEntry `json:"FailedEntries"`
+	FailedEntryCount int                     `json:"FailedEntryCount"`
+}
+
+// RemoveTargetsRequest is the request for RemoveTargets.
+type RemoveTargetsRequest struct {
+	EventBusName string   `json:"EventBusName"`
+	Force        bool     `json:"Force"`
+	IDs          []string `json:"Ids"`
+	Rule         string   `json:"Rule"`
+}
+
+// RemoveTargetsResult is the result of RemoveTargets.
+type RemoveTargetsResult struct {
+	FailedEntries    []PutTargetsResultEntry `json:"FailedEntries"`
+	FailedEntryCount int                     `json:"FailedEntryCount"`
+}
+
+// ListTargetsByRuleRequest is the request for ListTargetsByRule.
+type ListTargetsByRuleRequest struct {
+	EventBusName string `json:"EventBusName"`
+	Limit        int    `json:"Limit"`
+	NextToken    string `json:"NextToken"`
+	Rule         string `json:"Rule"`
+}
+
+// ListTargetsByRuleResult is the result of ListTargetsByRule.
+type ListTargetsByRuleResult struct {
+	NextToken string   `json:"NextToken,omitempty"`
+	Targets   []Target `json:"Targets"`
+}
+
+//
+// Events.
+//
+
+// PutEventsRequestEntry is an event to put. Detail is a JSON object, and Time
+// is in seconds since the epoch, defaulting to now.
+type PutEventsRequestEntry struct {
+	Detail       string   `json:"Detail"`
+	DetailType   string   `json:"DetailType"`
+	EventBusName string   `json:"EventBusName"`
+	Resources    []string `json:"Resources"`
+	Source       string   `json:"Source"`
+	Time         *float64 `json:"Time"`
+}
+
+// PutEventsRequest is the request for PutEvents.
+type PutEventsRequest struct {
+	Entries []PutEventsRequestEntry `json:"Entries"`
+}
+
+// PutEventsResultEntry is the result of putting one event: its ID, or why it
+// wasn't put.
+type PutEventsResultEntry struct {
+	ErrorCode    string `json:"ErrorCode,omitempty"`
+	ErrorMessage string `json:"ErrorMessage,omitempty"`
+	EventID      string `json:"EventId,omitempty"`
+}
+
+// PutEventsResult is the result of PutEvents. Entries are in the same order
+// as the request's.
+type PutEventsResult struct {
+	Entries          []PutEventsResultEntry `json:"Entries"`
+	FailedEntryCount int                    `json:"FailedEntryCount"`
+}
+
+// TestEventPatternRequest is the request for TestEventPattern. Event is a
+// whole event, as rules see it.
+type TestEventPatternRequest struct {
+	Event        string `json:"Event"`
+	EventPattern string `json:"EventPattern"`
+}
+
+// TestEventPatternResult is the result of TestEventPattern.
+type TestEventPatternResult struct {
+	Result bool `json:"Result"`
+}
@@ -0,0 +1,156 @@
+package events
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/fernomac/aws-local/pkg/common"
+)
+
+// bus is an event bus and its rules.
+type bus struct {
+	name  string
+	arn   string
+	rules map[string]*rule
+}
+
+func newBus(name string) *bus {
+	return &bus{
+		name:  name,
+		arn:   busArn(name),
+		rules: map[string]*rule{},
+	}
+}
+
+// rule is a rule and its targets, in the order they were added. Scheduled
+// rules next fire at nextFire, or never if it's zero.
+type rule struct {
+	name               string
+	arn                string
+	bus                string
+	description        string
+	roleArn            string
+	eventPattern       string
+	pattern            *pattern
+	scheduleExpression string
+	schedule           schedule
+	nextFire           time.Time
+	state              string
+	targets            []Target
+}
+
+func (r *rule) describe() Rule {
+	return Rule{
+		Arn:                r.arn,
+		Description:        r.description,
+		EventBusName:       r.bus,
+		EventPattern:       r.eventPattern,
+		Name:               r.name,
+		RoleArn:            r.roleArn,
+		ScheduleExpression: r.scheduleExpression,
+		State:              r.state,
+	}
+}
+
+// setTarget adds a target, or replaces the one with the same ID. It reports
+// false if the rule already has as many targets as it can.
+func (r *rule) setTarget(t Target) bool {
+	for i := range r.targets {
+		if r.targets[i].ID == t.ID {
+			r.targets[i] = t
+			return true
+		}
+	}
+	if len(r.targets) == maxTargetsPerRule {
+		return false
+	}
+	r.targets = append(r.targets, t)
+	return true
+}
+
+func (r *rule) removeTarget(id string) {
+	for i := range r.targets {
+		if r.targets[i].ID == id {
+			r.targets = append(r.targets[:i], r.targets[i+1:]...)
+			return
+		}
+	}
+}
+
+// dispatches sends an event to each of the rule's targets.
+func (r *rule) dispatches(ev *occurrence) []dispatch {
+	if len(r.targets) == 0 {
+		return nil
+	}
+	matched := *ev
+	matched.ruleArn, matched.ruleName = r.arn, r.name
+
+	out := make([]dispatch, 0, len(r.targets))
+	for _, t := range r.targets {
+		out = append(out, dispatch{event: &matched, target: t})
+	}
+	return out
+}
+
+// route sends an event to the targets of every enabled rule on the bus whose
+// pattern it matches.
+func (b *bus) route(ev *occurrence) []dispatch {
+	out := []dispatch{}
+	for _, r := range b.rules {
+		if r.state == RuleStateEnabled && r.pattern != nil && r.pattern.matches(ev.value) {
+			out = append(out, r.dispatches(ev)...)
+		}
+	}
+	return out
+}
+
+// envelope is an event as rules and targets see it.
+type envelope struct {
+	Version    string          `json:"version"`
+	ID         string          `json:"id"`
+	DetailType string          `json:"detail-type"`
+	Source     string          `json:"source"`
+	Account    string          `json:"account"`
+	Time       string          `json:"time"`
+	Region     string          `json:"region"`
+	Resources  []string        `json:"resources"`
+	Detail     json.RawMessage `json:"detail"`
+}
+
+// occurrence is an event, as JSON and as the value patterns match, along with
+// the rule that matched it once one has.
+type occurrence struct {
+	id       string
+	raw      []byte
+	value    map[string]interface{}
+	ingested time.Time
+	ruleArn  string
+	ruleName string
+}
+
+// newEvent makes an event. detail must be a JSON object.
+func newEvent(source string, detailType string, resources []string, detail json.RawMessage, t time.Time, now time.Time) *occurrence {
+	if resources == nil {
+		resources = []string{}
+	}
+	env := &envelope{
+		Version:    "0",
+		ID:         common.NewRequestID(),
+		DetailType: detailType,
+		Source:     source,
+		Account:    common.AccountID,
+		Time:       timestamp(t),
+		Region:     common.Region,
+		Resources:  resources,
+		Detail:     detail,
+	}
+	raw, err := json.Marshal(env)
+	if err != nil {
+		panic(err)
+	}
+	value := map[string]interface{}{}
+	if err := json.Unmarshal(raw, &value); err != nil {
+		panic(err)
+	}
+	return &occurrence{id: env.ID, raw: raw, value: value, ingested: now}
+}
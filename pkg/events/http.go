@@ -0,0 +1,165 @@
+package events
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/fernomac/aws-local/pkg/awsjson11"
+	"github.com/fernomac/aws-local/pkg/common"
+)
+
+// NewHandler creates a new HTTP handler, notifying the given observers of
+// every call.
+func NewHandler(events Events, observers ...common.Observer) http.Handler {
+	rval := awsjson11.NewHandler("AWSEvents")
+	rval.SetEventSource("events.amazonaws.com")
+	for _, o := range observers {
+		rval.ObserveWith(o)
+	}
+
+	//
+	// Event buses.
+	//
+
+	rval.HandleWith("CreateEventBus", func(body []byte) (interface{}, error) {
+		req := CreateEventBusRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return events.CreateEventBus(&req)
+	})
+
+	rval.HandleWith("DeleteEventBus", func(body []byte) (interface{}, error) {
+		req := DeleteEventBusRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return events.DeleteEventBus(&req)
+	})
+
+	rval.HandleWith("DescribeEventBus", func(body []byte) (interface{}, error) {
+		req := DescribeEventBusRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return events.DescribeEventBus(&req)
+	})
+
+	rval.HandleWith("ListEventBuses", func(body []byte) (interface{}, error) {
+		req := ListEventBusesRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return events.ListEventBuses(&req)
+	})
+
+	//
+	// Rules.
+	//
+
+	rval.HandleWith("PutRule", func(body []byte) (interface{}, error) {
+		req := PutRuleRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return events.PutRule(&req)
+	})
+
+	rval.HandleWith("DeleteRule", func(body []byte) (interface{}, error) {
+		req := DeleteRuleRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return events.DeleteRule(&req)
+	})
+
+	rval.HandleWith("DescribeRule", func(body []byte) (interface{}, error) {
+		req := DescribeRuleRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return events.DescribeRule(&req)
+	})
+
+	rval.HandleWith("ListRules", func(body []byte) (interface{}, error) {
+		req := ListRulesRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return events.ListRules(&req)
+	})
+
+	rval.HandleWith("EnableRule", func(body []byte) (interface{}, error) {
+		req := EnableRuleRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return events.EnableRule(&req)
+	})
+
+	rval.HandleWith("DisableRule", func(body []byte) (interface{}, error) {
+		req := DisableRuleRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return events.DisableRule(&req)
+	})
+
+	rval.HandleWith("ListRuleNamesByTarget", func(body []byte) (interface{}, error) {
+		req := ListRuleNamesByTargetRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return events.ListRuleNamesByTarget(&req)
+	})
+
+	//
+	// Targets.
+	//
+
+	rval.HandleWith("PutTargets", func(body []byte) (interface{}, error) {
+		req := PutTargetsRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return events.PutTargets(&req)
+	})
+
+	rval.HandleWith("RemoveTargets", func(body []byte) (interface{}, error) {
+		req := RemoveTargetsRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return events.RemoveTargets(&req)
+	})
+
+	rval.HandleWith("ListTargetsByRule", func(body []byte) (interface{}, error) {
+		req := ListTargetsByRuleRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return events.ListTargetsByRule(&req)
+	})
+
+	//
+	// Events.
+	//
+
+	rval.HandleWith("PutEvents", func(body []byte) (interface{}, error) {
+		req := PutEventsRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return events.PutEvents(&req)
+	})
+
+	rval.HandleWith("TestEventPattern", func(body []byte) (interface{}, error) {
+		req := TestEventPatternRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return events.TestEventPattern(&req)
+	})
+
+	return rval
+}
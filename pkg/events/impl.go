@@ -0,0 +1,669 @@
+package events
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fernomac/aws-local/pkg/common"
+	"github.com/fernomac/aws-local/pkg/sqs"
+)
+
+// Limits.
+const (
+	maxPutEvents       = 10
+	maxPutEventsSize   = 256 * 1024
+	maxPutTargets      = 10
+	maxTargetsPerRule  = 5
+	maxInputPaths      = 100
+	maxDescription     = 512
+	maxPageSize        = 100
+	maxScheduleCatchUp = 1000
+)
+
+var (
+	busNamePattern = regexp.MustCompile(`^[\.\-_A-Za-z0-9]{1,256}$`)
+	idPattern      = regexp.MustCompile(`^[\.\-_A-Za-z0-9]{1,64}$`)
+)
+
+// Option configures an Events object.
+type Option func(*events)
+
+// WithClock sets the clock that stamps events and drives scheduled rules.
+func WithClock(clock common.Clock) Option {
+	return func(s *events) {
+		s.clock = clock
+	}
+}
+
+// WithQueues sets the SQS that targets with an SQS queue ARN deliver to.
+func WithQueues(queues sqs.SQS) Option {
+	return func(s *events) {
+		s.queues = queues
+	}
+}
+
+// WithSink makes a sink available to targets under the given name. Their Arn
+// is SinkArn(name).
+func WithSink(name string, sink Sink) Option {
+	return func(s *events) {
+		s.sinks[name] = sink
+	}
+}
+
+// events is the event bus store. Its lock guards buses and their rules, and
+// is never held while delivering events.
+type events struct {
+	lock   sync.Mutex
+	queues sqs.SQS
+	sinks  map[string]Sink
+	client *http.Client
+	clock  common.Clock
+	buses  map[string]*bus
+}
+
+// New creates a new event bus store with just the default bus.
+func New(opts ...Option) Events {
+	rval := &events{
+		sinks:  make(map[string]Sink),
+		client: &http.Client{Timeout: deliveryTimeout},
+		clock:  common.SystemClock,
+		buses:  make(map[string]*bus),
+	}
+	for _, opt := range opts {
+		opt(rval)
+	}
+	rval.buses[DefaultEventBus] = newBus(DefaultEventBus)
+	return rval
+}
+
+func validation(format string, args ...interface{}) error {
+	return common.Errorf("ValidationException", format, args...)
+}
+
+func notFound(format string, args ...interface{}) error {
+	return common.Errorf("ResourceNotFoundException", format, args...)
+}
+
+func timestamp(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05Z")
+}
+
+func busArn(name string) string {
+	return fmt.Sprintf("arn:aws:events:%v:%v:event-bus/%v", common.Region, common.AccountID, name)
+}
+
+func ruleArn(busName string, name string) string {
+	if busName == DefaultEventBus {
+		return fmt.Sprintf("arn:aws:events:%v:%v:rule/%v", common.Region, common.AccountID, name)
+	}
+	return fmt.Sprintf("arn:aws:events:%v:%v:rule/%v/%v", common.Region, common.AccountID, busName, name)
+}
+
+// busName turns an event bus name or ARN into a name. Empty means the
+// default bus.
+func busName(nameOrArn string) string {
+	if nameOrArn == "" {
+		return DefaultEventBus
+	}
+	if i := strings.Index(nameOrArn, ":event-bus/"); strings.HasPrefix(nameOrArn, "arn:") && i >= 0 {
+		return nameOrArn[i+len(":event-bus/"):]
+	}
+	return nameOrArn
+}
+
+// bus looks up an event bus by name or ARN. The caller must hold s.lock.
+func (s *events) bus(nameOrArn string) (*bus, error) {
+	name := busName(nameOrArn)
+	b, ok := s.buses[name]
+	if !ok {
+		return nil, notFound("Event bus %v does not exist.", name)
+	}
+	return b, nil
+}
+
+// rule looks up a rule on an event bus. The caller must hold s.lock.
+func (s *events) rule(busNameOrArn string, name string) (*rule, error) {
+	if name == "" {
+		return nil, validation("Parameter Name is required.")
+	}
+	b, err := s.bus(busNameOrArn)
+	if err != nil {
+		return nil, err
+	}
+	r, ok := b.rules[name]
+	if !ok {
+		return nil, notFound("Rule %v does not exist on EventBus %v.", name, b.name)
+	}
+	return r, nil
+}
+
+// page returns the bounds of a page of up to limit of n items and the token
+// for the next.
+func page(nextToken string, limit int, n int) (int, int, string, error) {
+	if limit <= 0 || limit > maxPageSize {
+		limit = maxPageSize
+	}
+	offset := 0
+	if nextToken != "" {
+		raw, err := base64.RawURLEncoding.DecodeString(nextToken)
+		if err == nil {
+			offset, err = strconv.Atoi(string(raw))
+		}
+		if err != nil || offset < 0 || offset > n {
+			return 0, 0, "", validation("The nextToken provided is invalid.")
+		}
+	}
+	end := offset + limit
+	if end > n {
+		end = n
+	}
+	token := ""
+	if end < n {
+		token = base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(end)))
+	}
+	return offset, end, token, nil
+}
+
+//
+// Event buses.
+//
+
+func (s *events) CreateEventBus(req *CreateEventBusRequest) (*CreateEventBusResult, error) {
+	if !busNamePattern.MatchString(req.Name) {
+		return nil, validation("Event bus name %v is not valid.", req.Name)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, ok := s.buses[req.Name]; ok {
+		return nil, common.Errorf("ResourceAlreadyExistsException", "Event bus %v already exists.", req.Name)
+	}
+	b := newBus(req.Name)
+	s.buses[req.Name] = b
+	return &CreateEventBusResult{EventBusArn: b.arn}, nil
+}
+
+func (s *events) DeleteEventBus(req *DeleteEventBusRequest) (*DeleteEventBusResult, error) {
+	name := busName(req.Name)
+	if name == DefaultEventBus {
+		return nil, validation("Cannot delete event bus default.")
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	delete(s.buses, name)
+	return &DeleteEventBusResult{}, nil
+}
+
+func (s *events) DescribeEventBus(req *DescribeEventBusRequest) (*DescribeEventBusResult, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	b, err := s.bus(req.Name)
+	if err != nil {
+		return nil, err
+	}
+	return &DescribeEventBusResult{Arn: b.arn, Name: b.name}, nil
+}
+
+func (s *events) ListEventBuses(req *ListEventBusesRequest) (*ListEventBusesResult, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	names := []string{}
+	for name := range s.buses {
+		if strings.HasPrefix(name, req.NamePrefix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	start, end, token, err := page(req.NextToken, req.Limit, len(names))
+	if err != nil {
+		return nil, err
+	}
+	out := &ListEventBusesResult{EventBuses: []EventBus{}, NextToken: token}
+	for _, name := range names[start:end] {
+		out.EventBuses = append(out.EventBuses, EventBus{Arn: s.buses[name].arn, Name: name})
+	}
+	return out, nil
+}
+
+//
+// Rules.
+//
+
+func (s *events) PutRule(req *PutRuleRequest) (*PutRuleResult, error) {
+	if !idPattern.MatchString(req.Name) {
+		return nil, validation("Rule name %v is not valid.", req.Name)
+	}
+	if len(req.Description) > maxDescription {
+		return nil, validation("Description must be at most %v characters.", maxDescription)
+	}
+	state := req.State
+	if state == "" {
+		state = RuleStateEnabled
+	}
+	if state != RuleStateEnabled && state != RuleStateDisabled {
+		return nil, validation("State %v is not valid.", req.State)
+	}
+	if req.EventPattern == "" && req.ScheduleExpression == "" {
+		return nil, validation("Parameter(s) EventPattern or ScheduleExpression must be specified.")
+	}
+
+	var p *pattern
+	if req.EventPattern != "" {
+		var err error
+		if p, err = parsePattern(req.EventPattern); err != nil {
+			return nil, err
+		}
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	b, err := s.bus(req.EventBusName)
+	if err != nil {
+		return nil, err
+	}
+	if req.ScheduleExpression != "" && b.name != DefaultEventBus {
+		return nil, validation("ScheduleExpression is supported only on the default event bus.")
+	}
+
+	now := s.clock.Now()
+	r, ok := b.rules[req.Name]
+	if !ok {
+		r = &rule{
+			name: req.Name,
+			arn:  ruleArn(b.name, req.Name),
+			bus:  b.name,
+		}
+	}
+
+	if req.ScheduleExpression != r.scheduleExpression || r.state != state {
+		r.schedule, r.nextFire = nil, time.Time{}
+		if req.ScheduleExpression != "" {
+			sched, err := parseSchedule(req.ScheduleExpression, now)
+			if err != nil {
+				return nil, err
+			}
+			r.schedule, r.nextFire = sched, sched.next(now)
+		}
+	}
+
+	r.description = req.Description
+	r.roleArn = req.RoleArn
+	r.eventPattern = req.EventPattern
+	r.pattern = p
+	r.scheduleExpression = req.ScheduleExpression
+	r.state = state
+	b.rules[req.Name] = r
+
+	return &PutRuleResult{RuleArn: r.arn}, nil
+}
+
+func (s *events) DeleteRule(req *DeleteRuleRequest) (*DeleteRuleResult, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	b, err := s.bus(req.EventBusName)
+	if err != nil {
+		return nil, err
+	}
+	r, ok := b.rules[req.Name]
+	if !ok {
+		return &DeleteRuleResult{}, nil
+	}
+	if len(r.targets) > 0 {
+		return nil, validation("Rule can't be deleted since it has targets.")
+	}
+	delete(b.rules, r.name)
+	return &DeleteRuleResult{}, nil
+}
+
+func (s *events) DescribeRule(req *DescribeRuleRequest) (*DescribeRuleResult, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	r, err := s.rule(req.EventBusName, req.Name)
+	if err != nil {
+		return nil, err
+	}
+	out := DescribeRuleResult(r.describe())
+	return &out, nil
+}
+
+func (s *events) ListRules(req *ListRulesRequest) (*ListRulesResult, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	b, err := s.bus(req.EventBusName)
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for name := range b.rules {
+		if strings.HasPrefix(name, req.NamePrefix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	start, end, token, err := page(req.NextToken, req.Limit, len(names))
+	if err != nil {
+		return nil, err
+	}
+	out := &ListRulesResult{Rules: []Rule{}, NextToken: token}
+	for _, name := range names[start:end] {
+		out.Rules = append(out.Rules, b.rules[name].describe())
+	}
+	return out, nil
+}
+
+func (s *events) EnableRule(req *EnableRuleRequest) (*EnableRuleResult, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	r, err := s.rule(req.EventBusName, req.Name)
+	if err != nil {
+		return nil, err
+	}
+	if r.state != RuleStateEnabled {
+		r.state = RuleStateEnabled
+		if r.schedule != nil {
+			r.nextFire = r.schedule.next(s.clock.Now())
+		}
+	}
+	return &EnableRuleResult{}, nil
+}
+
+func (s *events) DisableRule(req *DisableRuleRequest) (*DisableRuleResult, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	r, err := s.rule(req.EventBusName, req.Name)
+	if err != nil {
+		return nil, err
+	}
+	r.state = RuleStateDisabled
+	return &DisableRuleResult{}, nil
+}
+
+func (s *events) ListRuleNamesByTarget(req *ListRuleNamesByTargetRequest) (*ListRuleNamesByTargetResult, error) {
+	if req.TargetArn == "" {
+		return nil, validation("Parameter TargetArn is required.")
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	b, err := s.bus(req.EventBusName)
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for name, r := range b.rules {
+		for _, t := range r.targets {
+			if t.Arn == req.TargetArn {
+				names = append(names, name)
+				break
+			}
+		}
+	}
+	sort.Strings(names)
+
+	start, end, token, err := page(req.NextToken, req.Limit, len(names))
+	if err != nil {
+		return nil, err
+	}
+	return &ListRuleNamesByTargetResult{RuleNames: names[start:end], NextToken: token}, nil
+}
+
+//
+// Targets.
+//
+
+func targetError(id string, err error) PutTargetsResultEntry {
+	ce, ok := err.(common.Error)
+	if !ok {
+		ce = common.Errorf("InternalException", "%v", err)
+	}
+	return PutTargetsResultEntry{TargetID: id, ErrorCode: ce.Code, ErrorMessage: ce.Message}
+}
+
+func (s *events) PutTargets(req *PutTargetsRequest) (*PutTargetsResult, error) {
+	if len(req.Targets) == 0 || len(req.Targets) > maxPutTargets {
+		return nil, validation("Targets must have between 1 and %v items.", maxPutTargets)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	r, err := s.rule(req.EventBusName, req.Rule)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &PutTargetsResult{FailedEntries: []PutTargetsResultEntry{}}
+	for _, t := range req.Targets {
+		if err := s.checkTarget(&t); err != nil {
+			out.FailedEntries = append(out.FailedEntries, targetError(t.ID, err))
+			continue
+		}
+		if !r.setTarget(t) {
+			err := common.Errorf("LimitExceededException", "Rule %v can have at most %v targets.", r.name, maxTargetsPerRule)
+			out.FailedEntries = append(out.FailedEntries, targetError(t.ID, err))
+		}
+	}
+	out.FailedEntryCount = len(out.FailedEntries)
+	return out, nil
+}
+
+func (s *events) RemoveTargets(req *RemoveTargetsRequest) (*RemoveTargetsResult, error) {
+	if len(req.IDs) == 0 || len(req.IDs) > maxPutTargets {
+		return nil, validation("Ids must have between 1 and %v items.", maxPutTargets)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	r, err := s.rule(req.EventBusName, req.Rule)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range req.IDs {
+		r.removeTarget(id)
+	}
+	return &RemoveTargetsResult{FailedEntries: []PutTargetsResultEntry{}}, nil
+}
+
+func (s *events) ListTargetsByRule(req *ListTargetsByRuleRequest) (*ListTargetsByRuleResult, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	r, err := s.rule(req.EventBusName, req.Rule)
+	if err != nil {
+		return nil, err
+	}
+	start, end, token, err := page(req.NextToken, req.Limit, len(r.targets))
+	if err != nil {
+		return nil, err
+	}
+	out := &ListTargetsByRuleResult{Targets: []Target{}, NextToken: token}
+	out.Targets = append(out.Targets, r.targets[start:end]...)
+	return out, nil
+}
+
+//
+// Events.
+//
+
+func entryError(code string, format string, args ...interface{}) PutEventsResultEntry {
+	return PutEventsResultEntry{ErrorCode: code, ErrorMessage: fmt.Sprintf(format, args...)}
+}
+
+// newOccurrence checks an entry and makes the event it puts, or returns why
+// it can't be put.
+func newOccurrence(e *PutEventsRequestEntry, now time.Time) (*occurrence, *PutEventsResultEntry) {
+	switch {
+	case e.Source == "":
+		out := entryError("InvalidArgument", "Parameter Source is not valid. Reason: Source is a required argument.")
+		return nil, &out
+	case e.DetailType == "":
+		out := entryError("InvalidArgument", "Parameter DetailType is not valid. Reason: DetailType is a required argument.")
+		return nil, &out
+	case e.Detail == "":
+		out := entryError("InvalidArgument", "Parameter Detail is not valid. Reason: Detail is a required argument.")
+		return nil, &out
+	case strings.HasPrefix(e.Source, "aws."):
+		out := entryError("NotAuthorizedForSourceException", "Not authorized for the source.")
+		return nil, &out
+	}
+
+	detail := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(e.Detail), &detail); err != nil {
+		out := entryError("MalformedDetail", "Detail is malformed.")
+		return nil, &out
+	}
+
+	t := now
+	if e.Time != nil {
+		sec, frac := math.Modf(*e.Time)
+		t = time.Unix(int64(sec), int64(frac*1e9))
+	}
+	return newEvent(e.Source, e.DetailType, e.Resources, json.RawMessage(e.Detail), t, now), nil
+}
+
+func (s *events) PutEvents(req *PutEventsRequest) (*PutEventsResult, error) {
+	if len(req.Entries) == 0 || len(req.Entries) > maxPutEvents {
+		return nil, validation("Entries must have between 1 and %v items.", maxPutEvents)
+	}
+	size := 0
+	for _, e := range req.Entries {
+		size += len(e.Source) + len(e.DetailType) + len(e.Detail)
+		for _, r := range e.Resources {
+			size += len(r)
+		}
+		if e.Time != nil {
+			size += 14
+		}
+	}
+	if size > maxPutEventsSize {
+		return nil, validation("Total size of the entries in the request is over the limit.")
+	}
+
+	s.lock.Lock()
+
+	now := s.clock.Now()
+	out := &PutEventsResult{Entries: make([]PutEventsResultEntry, len(req.Entries))}
+	dispatches := []dispatch{}
+	for i := range req.Entries {
+		e := &req.Entries[i]
+
+		b, err := s.bus(e.EventBusName)
+		if err != nil {
+			ce := err.(common.Error)
+			out.Entries[i] = entryError(ce.Code, "%v", ce.Message)
+			out.FailedEntryCount++
+			continue
+		}
+		ev, failed := newOccurrence(e, now)
+		if failed != nil {
+			out.Entries[i] = *failed
+			out.FailedEntryCount++
+			continue
+		}
+
+		out.Entries[i] = PutEventsResultEntry{EventID: ev.id}
+		dispatches = append(dispatches, b.route(ev)...)
+	}
+
+	s.lock.Unlock()
+
+	s.deliver(dispatches)
+	return out, nil
+}
+
+func (s *events) TestEventPattern(req *TestEventPatternRequest) (*TestEventPatternResult, error) {
+	p, err := parsePattern(req.EventPattern)
+	if err != nil {
+		return nil, err
+	}
+
+	event := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(req.Event), &event); err != nil {
+		return nil, validation("Parameter Event is not valid.")
+	}
+	for _, key := range []string{"id", "account", "source", "time", "region", "detail-type"} {
+		if _, ok := event[key]; !ok {
+			return nil, validation("Parameter Event is not valid. Reason: Missing field %v.", key)
+		}
+	}
+	return &TestEventPatternResult{Result: p.matches(event)}, nil
+}
+
+//
+// Schedules.
+//
+
+// StartScheduler calls RunSchedules every interval in the background, until
+// the returned function is called.
+func StartScheduler(svc Events, interval time.Duration) func() {
+	done := make(chan struct{})
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				svc.RunSchedules()
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }
+}
+
+// RunSchedules fires the rules that are due by the clock events was created
+// with. A rule that has fallen too far behind skips ahead.
+func (s *events) RunSchedules() int {
+	s.lock.Lock()
+
+	now := s.clock.Now()
+	dispatches := []dispatch{}
+	fired := 0
+	for _, r := range s.buses[DefaultEventBus].rules {
+		if r.schedule == nil || r.state != RuleStateEnabled {
+			continue
+		}
+		for n := 0; !r.nextFire.IsZero() && !r.nextFire.After(now); n++ {
+			if n == maxScheduleCatchUp {
+				r.nextFire = r.schedule.next(now)
+				break
+			}
+			ev := newEvent("aws.events", "Scheduled Event", []string{r.arn}, json.RawMessage("{}"), r.nextFire, now)
+			dispatches = append(dispatches, r.dispatches(ev)...)
+			fired++
+			r.nextFire = r.schedule.next(r.nextFire)
+		}
+	}
+
+	s.lock.Unlock()
+
+	s.deliver(dispatches)
+	return fired
+}
@@ -0,0 +1,466 @@
+package events
+
+import (
+	"encoding/json"
+	"net"
+	"regexp"
+	"strings"
+
+	"github.com/fernomac/aws-local/pkg/common"
+)
+
+// maxPatternDepth is how deeply patterns may nest.
+const maxPatternDepth = 10
+
+// pattern is a parsed event pattern. An event matches if every key matches,
+// and one of the $or alternatives does if there are any. A key matches if
+// one of its conditions matches the event's value, or if the nested pattern
+// matches the nested object.
+type pattern struct {
+	keys map[string]*field
+	or   []*pattern
+}
+
+type field struct {
+	conditions []condition
+	nested     *pattern
+}
+
+// condition is a single condition on a value. exists conditions are the
+// only ones that can match a missing value.
+type condition struct {
+	exists *bool
+	match  func(v interface{}) bool
+}
+
+func invalidPattern(format string, args ...interface{}) error {
+	return common.Errorf("InvalidEventPatternException", "Event pattern is not valid. Reason: "+format, args...)
+}
+
+// parsePattern parses an event pattern.
+func parsePattern(s string) (*pattern, error) {
+	raw := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(s), &raw); err != nil {
+		return nil, invalidPattern("Filter is not an object")
+	}
+	if len(raw) == 0 {
+		return nil, invalidPattern("Empty objects are not allowed")
+	}
+	return parsePatternObject(raw, 0)
+}
+
+func parsePatternObject(raw map[string]interface{}, depth int) (*pattern, error) {
+	if depth > maxPatternDepth {
+		return nil, invalidPattern("Pattern is nested too deeply")
+	}
+
+	p := &pattern{keys: map[string]*field{}}
+	for key, value := range raw {
+		if key == "$or" {
+			alts, ok := value.([]interface{})
+			if !ok || len(alts) < 2 {
+				return nil, invalidPattern("$or must be an array of at least two patterns")
+			}
+			for _, alt := range alts {
+				obj, ok := alt.(map[string]interface{})
+				if !ok || len(obj) == 0 {
+					return nil, invalidPattern("$or must be an array of at least two patterns")
+				}
+				sub, err := parsePatternObject(obj, depth+1)
+				if err != nil {
+					return nil, err
+				}
+				p.or = append(p.or, sub)
+			}
+			continue
+		}
+
+		switch v := value.(type) {
+		case map[string]interface{}:
+			if len(v) == 0 {
+				return nil, invalidPattern("Empty objects are not allowed")
+			}
+			nested, err := parsePatternObject(v, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			p.keys[key] = &field{nested: nested}
+
+		case []interface{}:
+			if len(v) == 0 {
+				return nil, invalidPattern("Empty arrays are not allowed")
+			}
+			f := &field{}
+			for _, c := range v {
+				cond, err := parseCondition(key, c)
+				if err != nil {
+					return nil, err
+				}
+				f.conditions = append(f.conditions, cond)
+			}
+			p.keys[key] = f
+
+		default:
+			return nil, invalidPattern("Match value for %v must be an array or an object", key)
+		}
+	}
+	return p, nil
+}
+
+func parseCondition(key string, c interface{}) (condition, error) {
+	switch v := c.(type) {
+	case string, float64, bool, nil:
+		return condition{match: func(x interface{}) bool { return x == v }}, nil
+	case map[string]interface{}:
+		if len(v) != 1 {
+			return condition{}, invalidPattern("%v: a condition must have exactly one operator", key)
+		}
+	default:
+		return condition{}, invalidPattern("%v: unsupported condition", key)
+	}
+
+	for op, arg := range c.(map[string]interface{}) {
+		switch op {
+		case "exists":
+			b, ok := arg.(bool)
+			if !ok {
+				return condition{}, invalidPattern("exists match pattern must be either true or false.")
+			}
+			return condition{exists: &b}, nil
+
+		case "prefix", "suffix":
+			match, err := parseAffix(key, op, arg)
+			if err != nil {
+				return condition{}, err
+			}
+			return condition{match: match}, nil
+
+		case "equals-ignore-case":
+			s, ok := arg.(string)
+			if !ok {
+				return condition{}, invalidPattern("equals-ignore-case match pattern must be a string")
+			}
+			return condition{match: stringMatcher(op, s)}, nil
+
+		case "wildcard":
+			s, ok := arg.(string)
+			if !ok {
+				return condition{}, invalidPattern("wildcard match pattern must be a string")
+			}
+			match, err := wildcardMatcher(s)
+			if err != nil {
+				return condition{}, err
+			}
+			return condition{match: match}, nil
+
+		case "anything-but":
+			match, err := parseAnythingBut(key, arg)
+			if err != nil {
+				return condition{}, err
+			}
+			return condition{match: match}, nil
+
+		case "numeric":
+			match, err := parseNumeric(key, arg)
+			if err != nil {
+				return condition{}, err
+			}
+			return condition{match: match}, nil
+
+		case "cidr":
+			s, _ := arg.(string)
+			_, network, err := net.ParseCIDR(s)
+			if err != nil {
+				return condition{}, invalidPattern("Nonstandard IP address: %v", arg)
+			}
+			return condition{match: func(x interface{}) bool {
+				s, ok := x.(string)
+				ip := net.ParseIP(s)
+				return ok && ip != nil && network.Contains(ip)
+			}}, nil
+
+		default:
+			return condition{}, invalidPattern("Unrecognized match type %v", op)
+		}
+	}
+	panic("unreachable")
+}
+
+// parseAffix parses the argument of a prefix or suffix condition: a string,
+// or {"equals-ignore-case": string} to ignore case.
+func parseAffix(key string, op string, arg interface{}) (func(interface{}) bool, error) {
+	switch v := arg.(type) {
+	case string:
+		return stringMatcher(op, v), nil
+	case map[string]interface{}:
+		if s, ok := v["equals-ignore-case"].(string); ok && len(v) == 1 {
+			return stringMatcher(op+"-ignore-case", s), nil
+		}
+	}
+	return nil, invalidPattern("%v match pattern must be a string", op)
+}
+
+func stringMatcher(op string, s string) func(interface{}) bool {
+	lower := strings.ToLower(s)
+	return func(x interface{}) bool {
+		v, ok := x.(string)
+		if !ok {
+			return false
+		}
+		switch op {
+		case "prefix":
+			return strings.HasPrefix(v, s)
+		case "suffix":
+			return strings.HasSuffix(v, s)
+		case "prefix-ignore-case":
+			return strings.HasPrefix(strings.ToLower(v), lower)
+		case "suffix-ignore-case":
+			return strings.HasSuffix(strings.ToLower(v), lower)
+		default:
+			return strings.EqualFold(v, s)
+		}
+	}
+}
+
+// wildcardMatcher matches strings against a pattern in which * matches any
+// run of characters. \* is a literal * and \\ a literal \.
+func wildcardMatcher(s string) (func(interface{}) bool, error) {
+	var expr strings.Builder
+	expr.WriteString(`(?s)^`)
+	literal := strings.Builder{}
+	star := false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\\':
+			if i+1 == len(s) || (s[i+1] != '*' && s[i+1] != '\\') {
+				return nil, invalidPattern("Invalid escape in wildcard pattern %v", s)
+			}
+			i++
+			literal.WriteByte(s[i])
+			star = false
+		case c == '*':
+			if star {
+				return nil, invalidPattern("Consecutive wildcard characters at pos %v", i)
+			}
+			expr.WriteString(regexp.QuoteMeta(literal.String()))
+			literal.Reset()
+			expr.WriteString(`.*`)
+			star = true
+		default:
+			literal.WriteByte(c)
+			star = false
+		}
+	}
+	expr.WriteString(regexp.QuoteMeta(literal.String()))
+	expr.WriteString(`$`)
+
+	re := regexp.MustCompile(expr.String())
+	return func(x interface{}) bool {
+		v, ok := x.(string)
+		return ok && re.MatchString(v)
+	}, nil
+}
+
+// parseAnythingBut parses the argument of an anything-but condition: a value,
+// a list of values, or a prefix, suffix, wildcard or equals-ignore-case
+// condition.
+func parseAnythingBut(key string, arg interface{}) (func(interface{}) bool, error) {
+	switch v := arg.(type) {
+	case string, float64:
+		return func(x interface{}) bool { return x != nil && x != v }, nil
+
+	case []interface{}:
+		if len(v) == 0 {
+			return nil, invalidPattern("Empty arrays are not allowed")
+		}
+		for _, e := range v {
+			switch e.(type) {
+			case string, float64:
+			default:
+				return nil, invalidPattern("Inside anything but list, start|null|boolean is not supported.")
+			}
+		}
+		return func(x interface{}) bool {
+			if x == nil {
+				return false
+			}
+			for _, e := range v {
+				if x == e {
+					return false
+				}
+			}
+			return true
+		}, nil
+
+	case map[string]interface{}:
+		if len(v) != 1 {
+			break
+		}
+		for op, s := range v {
+			var match func(interface{}) bool
+			var err error
+			switch op {
+			case "prefix", "suffix":
+				match, err = parseAffix(key, op, s)
+			case "wildcard":
+				str, ok := s.(string)
+				if !ok {
+					return nil, invalidPattern("wildcard match pattern must be a string")
+				}
+				match, err = wildcardMatcher(str)
+			case "equals-ignore-case":
+				str, ok := s.(string)
+				if !ok {
+					return nil, invalidPattern("equals-ignore-case match pattern must be a string")
+				}
+				match = stringMatcher(op, str)
+			default:
+				return nil, invalidPattern("Unsupported anything-but pattern: %v", op)
+			}
+			if err != nil {
+				return nil, err
+			}
+			return func(x interface{}) bool {
+				_, ok := x.(string)
+				return ok && !match(x)
+			}, nil
+		}
+	}
+	return nil, invalidPattern("Unsupported anything-but pattern")
+}
+
+// parseNumeric parses the argument of a numeric condition, a list of up to
+// two comparisons such as [">", 0, "<=", 5].
+func parseNumeric(key string, arg interface{}) (func(interface{}) bool, error) {
+	list, ok := arg.([]interface{})
+	if !ok || (len(list) != 2 && len(list) != 4) {
+		return nil, invalidPattern("%v: numeric must be a list of one or two comparisons", key)
+	}
+
+	type comparison struct {
+		op string
+		n  float64
+	}
+	comparisons := []comparison{}
+	for i := 0; i < len(list); i += 2 {
+		op, _ := list[i].(string)
+		n, ok := list[i+1].(float64)
+		if !ok {
+			return nil, invalidPattern("Value of %v must be numeric", list[i])
+		}
+		switch op {
+		case "=", "<", "<=", ">", ">=":
+		default:
+			return nil, invalidPattern("Unrecognized numeric range operator: %v", list[i])
+		}
+		if len(list) == 4 && op == "=" {
+			return nil, invalidPattern("%v: = can't be combined with another comparison", key)
+		}
+		comparisons = append(comparisons, comparison{op, n})
+	}
+
+	return func(x interface{}) bool {
+		v, ok := x.(float64)
+		if !ok {
+			return false
+		}
+		for _, c := range comparisons {
+			var ok bool
+			switch c.op {
+			case "=":
+				ok = v == c.n
+			case "<":
+				ok = v < c.n
+			case "<=":
+				ok = v <= c.n
+			case ">":
+				ok = v > c.n
+			case ">=":
+				ok = v >= c.n
+			}
+			if !ok {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
+
+// matches reports whether an event, or an object nested in one, matches the
+// pattern. A nested pattern matches an array of objects if it matches any of
+// them, and treats a missing parent, or one that isn't an object, as having
+// no leaves, so exists:false conditions under it match.
+func (p *pattern) matches(obj map[string]interface{}) bool {
+	for key, f := range p.keys {
+		value, present := obj[key]
+		if f.nested != nil {
+			if !f.nested.matchesValue(value) {
+				return false
+			}
+			continue
+		}
+		if !f.matches(value, present) {
+			return false
+		}
+	}
+
+	if len(p.or) == 0 {
+		return true
+	}
+	for _, alt := range p.or {
+		if alt.matches(obj) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *pattern) matchesValue(value interface{}) bool {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return p.matches(v)
+	case []interface{}:
+		for _, e := range v {
+			if p.matchesValue(e) {
+				return true
+			}
+		}
+		if len(v) > 0 {
+			return false
+		}
+	}
+	return p.matches(map[string]interface{}{})
+}
+
+// matches reports whether a value matches one of the field's conditions. Only
+// leaves, values that aren't objects or empty arrays, count as present, and a
+// condition matches an array if it matches any of its elements.
+func (f *field) matches(value interface{}, present bool) bool {
+	values := []interface{}{value}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		present = false
+	case []interface{}:
+		present = present && len(v) > 0
+		values = v
+	}
+
+	for _, c := range f.conditions {
+		if c.exists != nil {
+			if *c.exists == present {
+				return true
+			}
+			continue
+		}
+		if !present {
+			continue
+		}
+		for _, v := range values {
+			if c.match(v) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,131 @@
+package events
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+const testEvent = `{
+	"id": "1", "account": "000000000000", "source": "my.app", "detail-type": "Order Placed",
+	"time": "2024-01-01T00:00:00Z", "region": "us-local-1", "resources": ["arn:x"],
+	"detail": {
+		"amount": 150, "currency": "USD", "customer": {"tier": "gold", "ip": "10.1.2.3"},
+		"tags": ["a", "b"], "items": [{"sku": "X-1", "qty": 2}, {"sku": "Y-2", "qty": 5}],
+		"note": null, "flag": true, "file": "dir/report.csv", "empty": [], "scalar": "s"
+	}
+}`
+
+func TestPatterns(t *testing.T) {
+	tests := []struct {
+		pattern string
+		event   string
+		want    bool
+	}{
+		// Values.
+		{`{"source": ["my.app"]}`, testEvent, true},
+		{`{"source": ["other"]}`, testEvent, false},
+		{`{"source": ["other", "my.app"]}`, testEvent, true},
+		{`{"detail": {"amount": [150]}}`, testEvent, true},
+		{`{"detail": {"amount": ["150"]}}`, testEvent, false},
+		{`{"detail": {"note": [null]}}`, testEvent, true},
+		{`{"detail": {"flag": [true]}}`, testEvent, true},
+		{`{"detail": {"tags": ["b"]}}`, testEvent, true},
+		{`{"detail": {"tags": ["c"]}}`, testEvent, false},
+		{`{"detail": {"customer": {"tier": ["gold"], "ip": [{"cidr": "10.0.0.0/8"}]}}}`, testEvent, true},
+		{`{"detail": {"customer": {"ip": [{"cidr": "192.168.0.0/16"}]}}}`, testEvent, false},
+		{`{"detail": {"items": {"sku": ["Y-2"]}}}`, testEvent, true},
+		{`{"detail": {"items": {"sku": ["Z"]}}}`, testEvent, false},
+
+		// Strings.
+		{`{"source": [{"prefix": "my."}]}`, testEvent, true},
+		{`{"source": [{"prefix": {"equals-ignore-case": "MY."}}]}`, testEvent, true},
+		{`{"detail": {"file": [{"suffix": ".csv"}]}}`, testEvent, true},
+		{`{"detail": {"file": [{"suffix": {"equals-ignore-case": ".CSV"}}]}}`, testEvent, true},
+		{`{"detail-type": [{"equals-ignore-case": "order placed"}]}`, testEvent, true},
+		{`{"detail": {"file": [{"wildcard": "dir/*.csv"}]}}`, testEvent, true},
+		{`{"detail": {"file": [{"wildcard": "*.txt"}]}}`, testEvent, false},
+		{`{"detail": {"file": [{"wildcard": "dir\\*"}]}}`, `{"detail": {"file": "dir*"}}`, true},
+		{`{"detail": {"file": [{"wildcard": "dir\\*"}]}}`, testEvent, false},
+
+		// anything-but and numeric.
+		{`{"detail": {"currency": [{"anything-but": "USD"}]}}`, testEvent, false},
+		{`{"detail": {"currency": [{"anything-but": ["EUR", "GBP"]}]}}`, testEvent, true},
+		{`{"detail": {"currency": [{"anything-but": {"prefix": "US"}}]}}`, testEvent, false},
+		{`{"detail": {"missing": [{"anything-but": "USD"}]}}`, testEvent, false},
+		{`{"detail": {"amount": [{"numeric": [">", 100, "<=", 150]}]}}`, testEvent, true},
+		{`{"detail": {"amount": [{"numeric": ["<", 100]}]}}`, testEvent, false},
+		{`{"detail": {"currency": [{"numeric": [">", 0]}]}}`, testEvent, false},
+
+		// exists.
+		{`{"detail": {"currency": [{"exists": true}]}}`, testEvent, true},
+		{`{"detail": {"missing": [{"exists": false}]}}`, testEvent, true},
+		{`{"detail": {"missing": [{"exists": true}]}}`, testEvent, false},
+		{`{"detail": {"note": [{"exists": true}]}}`, testEvent, true},
+		{`{"detail": {"customer": [{"exists": true}]}}`, testEvent, false},
+		{`{"detail": {"customer": [{"exists": false}]}}`, testEvent, true},
+		{`{"detail": {"empty": [{"exists": true}]}}`, testEvent, false},
+		{`{"detail": {"empty": [{"exists": false}]}}`, testEvent, true},
+		{`{"detail": {"c": [{"exists": true}]}}`, `{"detail": {"c": []}}`, false},
+		{`{"detail": {"c": [{"exists": false}]}}`, `{"detail": {"c": []}}`, true},
+		{`{"detail": {"c": [{"exists": false}]}}`, `{"source": "my.app"}`, true},
+		{`{"detail": {"c": [{"exists": true}]}}`, `{"source": "my.app"}`, false},
+		{`{"detail": {"c": ["x"]}}`, `{"source": "my.app"}`, false},
+		{`{"detail": {"c": {"d": [{"exists": false}]}}}`, `{"source": "my.app"}`, true},
+		{`{"detail": {"scalar": {"d": [{"exists": false}]}}}`, testEvent, true},
+		{`{"detail": {"scalar": {"d": [{"exists": true}]}}}`, testEvent, false},
+		{`{"detail": {"items": {"sku": [{"exists": false}]}}}`, testEvent, false},
+		{`{"detail": {"items": {"price": [{"exists": false}]}}}`, testEvent, true},
+		{`{"detail": {"empty": {"sku": [{"exists": false}]}}}`, testEvent, true},
+
+		// $or.
+		{`{"detail": {"$or": [{"currency": ["EUR"]}, {"amount": [{"numeric": [">=", 150]}]}]}}`, testEvent, true},
+		{`{"detail": {"$or": [{"currency": ["EUR"]}, {"amount": [1]}]}}`, testEvent, false},
+		{`{"source": ["my.app"], "$or": [{"region": ["x"]}, {"account": ["000000000000"]}]}`, testEvent, true},
+		{`{"source": ["other"], "$or": [{"region": ["x"]}, {"account": ["000000000000"]}]}`, testEvent, false},
+	}
+
+	for _, test := range tests {
+		p, err := parsePattern(test.pattern)
+		if err != nil {
+			t.Errorf("%v: %v", test.pattern, err)
+			continue
+		}
+		event := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(test.event), &event); err != nil {
+			t.Fatal(err)
+		}
+		if got := p.matches(event); got != test.want {
+			t.Errorf("%v on %v: got %v, want %v", test.pattern, test.event, got, test.want)
+		}
+	}
+}
+
+func TestPatternErrors(t *testing.T) {
+	for _, pattern := range []string{
+		`not json`,
+		`{}`,
+		`{"a": "b"}`,
+		`{"a": []}`,
+		`{"a": {}}`,
+		`{"a": [{"nope": 1}]}`,
+		`{"a": [{"prefix": "x", "suffix": "y"}]}`,
+		`{"a": [{"exists": "yes"}]}`,
+		`{"a": [{"wildcard": "a**"}]}`,
+		`{"a": [{"wildcard": "a\\b"}]}`,
+		`{"a": [{"numeric": ["~", 1]}]}`,
+		`{"a": [{"numeric": [">", "1"]}]}`,
+		`{"a": [{"numeric": ["=", 1, "<", 2]}]}`,
+		`{"a": [{"cidr": "10.0.0.0"}]}`,
+		`{"a": [{"anything-but": []}]}`,
+		`{"a": [{"anything-but": [true]}]}`,
+		`{"$or": [{"a": ["b"]}]}`,
+		`{"a": {"b": {"c": {"d": {"e": {"f": {"g": {"h": {"i": {"j": {"k": {"l": ["m"]}}}}}}}}}}}}`,
+	} {
+		if _, err := parsePattern(pattern); err == nil {
+			t.Errorf("%v: no error", pattern)
+		} else if !strings.HasPrefix(err.Error(), "InvalidEventPatternException") {
+			t.Errorf("%v: %v", pattern, err)
+		}
+	}
+}
@@ -0,0 +1,248 @@
+package events
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cron years run up to this one.
+const maxCronYear = 2199
+
+var ratePattern = regexp.MustCompile(`^rate\(\s*(\d+)\s+(minute|minutes|hour|hours|day|days)\s*\)$`)
+
+// schedule says when a scheduled rule fires.
+type schedule interface {
+	// next returns the first time after t the rule fires, or the zero time
+	// if it never does again.
+	next(t time.Time) time.Time
+}
+
+func invalidSchedule() error {
+	return validation("Parameter ScheduleExpression is not valid.")
+}
+
+// parseSchedule parses a rate(...) or cron(...) expression. Rates count from
+// start.
+func parseSchedule(expr string, start time.Time) (schedule, error) {
+	if m := ratePattern.FindStringSubmatch(expr); m != nil {
+		n, err := strconv.Atoi(m[1])
+		if err != nil || n <= 0 || (n == 1) != !strings.HasSuffix(m[2], "s") {
+			return nil, invalidSchedule()
+		}
+		unit := time.Minute
+		switch strings.TrimSuffix(m[2], "s") {
+		case "hour":
+			unit = time.Hour
+		case "day":
+			unit = 24 * time.Hour
+		}
+		return &rate{start: start, period: time.Duration(n) * unit}, nil
+	}
+
+	if strings.HasPrefix(expr, "cron(") && strings.HasSuffix(expr, ")") {
+		return parseCron(strings.TrimSuffix(strings.TrimPrefix(expr, "cron("), ")"))
+	}
+	return nil, invalidSchedule()
+}
+
+// rate fires every period from start.
+type rate struct {
+	start  time.Time
+	period time.Duration
+}
+
+func (r *rate) next(t time.Time) time.Time {
+	if t.Before(r.start) {
+		return r.start.Add(r.period)
+	}
+	n := t.Sub(r.start)/r.period + 1
+	return r.start.Add(n * r.period)
+}
+
+// cron fires at the minutes that match all its fields, in UTC. Days match
+// either the day of month or, if that is ?, the day of week.
+type cron struct {
+	minutes []bool
+	hours   []bool
+	months  []bool
+	years   []bool
+
+	// Days of month, or lastDay for the last day of the month.
+	days    []bool
+	lastDay bool
+
+	// Days of week, 1 for Sunday to 7 for Saturday. nth is set for
+	// "weekday#n", and lastWeekday for "weekdayL".
+	weekdays    []bool
+	useWeekdays bool
+	nth         int
+	lastWeekday bool
+}
+
+var (
+	monthNames   = map[string]int{"JAN": 1, "FEB": 2, "MAR": 3, "APR": 4, "MAY": 5, "JUN": 6, "JUL": 7, "AUG": 8, "SEP": 9, "OCT": 10, "NOV": 11, "DEC": 12}
+	weekdayNames = map[string]int{"SUN": 1, "MON": 2, "TUE": 3, "WED": 4, "THU": 5, "FRI": 6, "SAT": 7}
+)
+
+// parseCron parses the six fields of a cron expression: minutes, hours, day
+// of month, month, day of week and year.
+func parseCron(expr string) (*cron, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 6 {
+		return nil, invalidSchedule()
+	}
+	dom, dow := fields[2], fields[4]
+	if (dom == "?") == (dow == "?") {
+		return nil, invalidSchedule()
+	}
+
+	c := &cron{}
+	var err error
+	if c.minutes, err = parseCronField(fields[0], 0, 59, nil); err != nil {
+		return nil, err
+	}
+	if c.hours, err = parseCronField(fields[1], 0, 23, nil); err != nil {
+		return nil, err
+	}
+	if c.months, err = parseCronField(fields[3], 1, 12, monthNames); err != nil {
+		return nil, err
+	}
+	if c.years, err = parseCronField(fields[5], 1970, maxCronYear, nil); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case dom == "L":
+		c.lastDay = true
+	case dom != "?":
+		if c.days, err = parseCronField(dom, 1, 31, nil); err != nil {
+			return nil, err
+		}
+	case dow == "L":
+		c.useWeekdays, c.lastWeekday = true, true
+		c.weekdays, _ = parseCronField("SAT", 1, 7, weekdayNames)
+	case strings.HasSuffix(dow, "L"):
+		c.useWeekdays, c.lastWeekday = true, true
+		if c.weekdays, err = parseCronField(strings.TrimSuffix(dow, "L"), 1, 7, weekdayNames); err != nil {
+			return nil, err
+		}
+	case strings.Contains(dow, "#"):
+		i := strings.IndexByte(dow, '#')
+		c.useWeekdays = true
+		if c.nth, err = strconv.Atoi(dow[i+1:]); err != nil || c.nth < 1 || c.nth > 5 {
+			return nil, invalidSchedule()
+		}
+		if c.weekdays, err = parseCronField(dow[:i], 1, 7, weekdayNames); err != nil {
+			return nil, err
+		}
+	default:
+		c.useWeekdays = true
+		if c.weekdays, err = parseCronField(dow, 1, 7, weekdayNames); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// parseCronField parses a comma-separated list of *, values and ranges, each
+// optionally with a /step, into the set of values it matches.
+func parseCronField(s string, min int, max int, names map[string]int) ([]bool, error) {
+	set := make([]bool, max+1)
+	value := func(v string) (int, error) {
+		if n, ok := names[strings.ToUpper(v)]; ok {
+			return n, nil
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < min || n > max {
+			return 0, invalidSchedule()
+		}
+		return n, nil
+	}
+
+	for _, part := range strings.Split(s, ",") {
+		step := 1
+		if i := strings.IndexByte(part, '/'); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return nil, invalidSchedule()
+			}
+			step, part = n, part[:i]
+		}
+
+		lo, hi := min, max
+		switch {
+		case part == "*":
+		case strings.Contains(part, "-"):
+			i := strings.IndexByte(part, '-')
+			var err error
+			if lo, err = value(part[:i]); err != nil {
+				return nil, err
+			}
+			if hi, err = value(part[i+1:]); err != nil {
+				return nil, err
+			}
+			if lo > hi {
+				return nil, invalidSchedule()
+			}
+		default:
+			n, err := value(part)
+			if err != nil {
+				return nil, err
+			}
+			lo = n
+			if step == 1 {
+				hi = n
+			}
+		}
+
+		for n := lo; n <= hi; n += step {
+			set[n] = true
+		}
+	}
+	return set, nil
+}
+
+// matchesDay reports whether the cron fires on the day of t.
+func (c *cron) matchesDay(t time.Time) bool {
+	last := time.Date(t.Year(), t.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	if !c.useWeekdays {
+		if c.lastDay {
+			return t.Day() == last
+		}
+		return c.days[t.Day()]
+	}
+
+	if !c.weekdays[int(t.Weekday())+1] {
+		return false
+	}
+	switch {
+	case c.lastWeekday:
+		return t.Day()+7 > last
+	case c.nth > 0:
+		return (t.Day()-1)/7+1 == c.nth
+	}
+	return true
+}
+
+func (c *cron) next(t time.Time) time.Time {
+	t = t.UTC().Truncate(time.Minute).Add(time.Minute)
+	for t.Year() <= maxCronYear {
+		switch {
+		case !c.years[t.Year()]:
+			t = time.Date(t.Year()+1, time.January, 1, 0, 0, 0, 0, time.UTC)
+		case !c.months[int(t.Month())]:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+		case !c.matchesDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+		case !c.hours[t.Hour()]:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, time.UTC)
+		case !c.minutes[t.Minute()]:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
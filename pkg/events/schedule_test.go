@@ -0,0 +1,200 @@
+package events
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	return c.now
+}
+
+func TestParseSchedule(t *testing.T) {
+	tests := []struct {
+		expr  string
+		valid bool
+	}{
+		// Rates.
+		{"rate(1 minute)", true},
+		{"rate(5 minutes)", true},
+		{"rate(1 hour)", true},
+		{"rate(2 days)", true},
+		{"rate(1 minutes)", false},
+		{"rate(2 hour)", false},
+		{"rate(0 minutes)", false},
+		{"rate(-1 minutes)", false},
+		{"rate(5 weeks)", false},
+		{"rate(5)", false},
+
+		// ? goes in exactly one of day-of-month and day-of-week.
+		{"cron(0 12 * * ? *)", true},
+		{"cron(0 12 ? * MON *)", true},
+		{"cron(0 12 ? * ? *)", false},
+		{"cron(0 12 * * * *)", false},
+		{"cron(0 12 1 * MON *)", false},
+
+		// L and #n.
+		{"cron(0 0 L * ? *)", true},
+		{"cron(0 0 ? * L *)", true},
+		{"cron(0 0 ? * 6L *)", true},
+		{"cron(0 0 ? * FRIL *)", true},
+		{"cron(0 0 ? * 2#1 *)", true},
+		{"cron(0 0 ? * MON#5 *)", true},
+		{"cron(0 0 ? * 2#0 *)", false},
+		{"cron(0 0 ? * 2#6 *)", false},
+		{"cron(0 0 ? * 8#1 *)", false},
+		{"cron(0 0 ? * 9L *)", false},
+
+		// Steps, ranges, lists and names.
+		{"cron(0/15 * * * ? *)", true},
+		{"cron(*/5 8-17 ? * MON-FRI *)", true},
+		{"cron(0 9 1,15 JAN,jul ? 2030-2040/2)", true},
+		{"cron(*/0 * * * ? *)", false},
+		{"cron(0/x * * * ? *)", false},
+		{"cron(5-1 * * * ? *)", false},
+		{"cron(60 * * * ? *)", false},
+		{"cron(0 24 * * ? *)", false},
+		{"cron(0 0 32 * ? *)", false},
+		{"cron(0 0 0 * ? *)", false},
+		{"cron(0 0 * 13 ? *)", false},
+		{"cron(0 0 ? * 0 *)", false},
+		{"cron(0 0 * * ? 1969)", false},
+		{"cron(0 0 * * ? 2200)", false},
+		{"cron(0 0 * * ?)", false},
+		{"cron(0 0 * * ? * *)", false},
+		{"cron(0 0 * * ? *", false},
+		{"every minute", false},
+	}
+
+	start := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	for _, test := range tests {
+		_, err := parseSchedule(test.expr, start)
+		switch {
+		case test.valid && err != nil:
+			t.Errorf("%v: %v", test.expr, err)
+		case !test.valid && err == nil:
+			t.Errorf("%v: no error", test.expr)
+		case err != nil && !strings.HasPrefix(err.Error(), "ValidationException"):
+			t.Errorf("%v: %v", test.expr, err)
+		}
+	}
+}
+
+func TestScheduleNext(t *testing.T) {
+	start := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		expr string
+		from string
+		want []string
+	}{
+		// Rates count whole periods from the start.
+		{"rate(5 minutes)", "2023-12-31T23:00:00Z", []string{"2024-01-01T00:05:00Z", "2024-01-01T00:10:00Z"}},
+		{"rate(5 minutes)", "2024-01-01T00:07:30Z", []string{"2024-01-01T00:10:00Z", "2024-01-01T00:15:00Z"}},
+		{"rate(1 day)", "2024-01-01T00:00:00Z", []string{"2024-01-02T00:00:00Z", "2024-01-03T00:00:00Z"}},
+
+		// Cron fires strictly after the given time.
+		{"cron(0/15 * * * ? *)", "2024-01-01T00:00:00Z", []string{"2024-01-01T00:15:00Z", "2024-01-01T00:30:00Z", "2024-01-01T00:45:00Z", "2024-01-01T01:00:00Z"}},
+		{"cron(0/15 * * * ? *)", "2024-01-01T00:14:59Z", []string{"2024-01-01T00:15:00Z"}},
+		{"cron(10-20/5 3 * * ? *)", "2024-01-01T03:12:00Z", []string{"2024-01-01T03:15:00Z", "2024-01-01T03:20:00Z", "2024-01-02T03:10:00Z"}},
+		{"cron(0 12 ? * MON-FRI *)", "2024-01-05T12:00:00Z", []string{"2024-01-08T12:00:00Z", "2024-01-09T12:00:00Z"}},
+		{"cron(0 0 31 * ? *)", "2024-01-31T00:00:00Z", []string{"2024-03-31T00:00:00Z", "2024-05-31T00:00:00Z"}},
+
+		// L is the last day of the month, leap years included.
+		{"cron(0 0 L * ? *)", "2024-01-31T00:00:00Z", []string{"2024-02-29T00:00:00Z", "2024-03-31T00:00:00Z", "2024-04-30T00:00:00Z"}},
+		{"cron(0 0 L 2 ? *)", "2024-03-01T00:00:00Z", []string{"2025-02-28T00:00:00Z"}},
+
+		// xL is the last weekday x of the month, L alone the last Saturday.
+		{"cron(0 0 ? * 6L *)", "2024-01-01T00:00:00Z", []string{"2024-01-26T00:00:00Z", "2024-02-23T00:00:00Z", "2024-03-29T00:00:00Z"}},
+		{"cron(0 0 ? * L *)", "2024-01-01T00:00:00Z", []string{"2024-01-27T00:00:00Z", "2024-02-24T00:00:00Z"}},
+
+		// x#n is the nth weekday x, skipping months that don't have one.
+		{"cron(0 9 ? * 2#1 *)", "2024-01-01T09:00:00Z", []string{"2024-02-05T09:00:00Z", "2024-03-04T09:00:00Z"}},
+		{"cron(0 0 ? * FRI#5 *)", "2024-01-01T00:00:00Z", []string{"2024-03-29T00:00:00Z", "2024-05-31T00:00:00Z"}},
+
+		// Years run out.
+		{"cron(0 0 1 1 ? 2030)", "2024-01-01T00:00:00Z", []string{"2030-01-01T00:00:00Z", ""}},
+		{"cron(0 0 * * ? *)", "2199-12-31T00:00:00Z", []string{""}},
+	}
+
+	for _, test := range tests {
+		sched, err := parseSchedule(test.expr, start)
+		if err != nil {
+			t.Errorf("%v: %v", test.expr, err)
+			continue
+		}
+		at, err := time.Parse(time.RFC3339, test.from)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, want := range test.want {
+			at = sched.next(at)
+			got := ""
+			if !at.IsZero() {
+				got = at.Format(time.RFC3339)
+			}
+			if got != want {
+				t.Errorf("%v from %v: got %q, want %q", test.expr, test.from, got, want)
+				break
+			}
+		}
+	}
+}
+
+// TestRunSchedulesCatchUp checks that a scheduled rule fires once for each
+// time it was due, up to maxScheduleCatchUp, and then skips ahead rather than
+// replaying the backlog.
+func TestRunSchedulesCatchUp(t *testing.T) {
+	clock := &testClock{time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)}
+	inbox := NewInbox(2 * maxScheduleCatchUp)
+	svc := New(WithClock(clock), WithSink("inbox", inbox))
+
+	rule, err := svc.PutRule(&PutRuleRequest{Name: "tick", ScheduleExpression: "rate(1 minute)"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.PutTargets(&PutTargetsRequest{Rule: "tick", Targets: []Target{{ID: "t", Arn: SinkArn("inbox")}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := svc.RunSchedules(); n != 0 {
+		t.Errorf("before the first period: fired %v", n)
+	}
+	clock.now = clock.now.Add(3*time.Minute + 30*time.Second)
+	if n := svc.RunSchedules(); n != 3 {
+		t.Errorf("after 3 periods: fired %v", n)
+	}
+	if n := svc.RunSchedules(); n != 0 {
+		t.Errorf("again: fired %v", n)
+	}
+	if got := len(inbox.Deliveries(rule.RuleArn, "t", 0)); got != 3 {
+		t.Errorf("got %v deliveries, want 3", got)
+	}
+
+	clock.now = clock.now.Add(5000 * time.Minute)
+	if n := svc.RunSchedules(); n != maxScheduleCatchUp {
+		t.Errorf("far behind: fired %v, want %v", n, maxScheduleCatchUp)
+	}
+	if next := svc.(*events).buses[DefaultEventBus].rules["tick"].nextFire; !next.After(clock.now) {
+		t.Errorf("far behind: next fire %v isn't after %v", next, clock.now)
+	}
+	if n := svc.RunSchedules(); n != 0 {
+		t.Errorf("after skipping ahead: fired %v", n)
+	}
+	clock.now = clock.now.Add(time.Minute)
+	if n := svc.RunSchedules(); n != 1 {
+		t.Errorf("one period later: fired %v", n)
+	}
+
+	if _, err := svc.DisableRule(&DisableRuleRequest{Name: "tick"}); err != nil {
+		t.Fatal(err)
+	}
+	clock.now = clock.now.Add(10 * time.Minute)
+	if n := svc.RunSchedules(); n != 0 {
+		t.Errorf("disabled: fired %v", n)
+	}
+}
@@ -0,0 +1,497 @@
+package events
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fernomac/aws-local/pkg/common"
+	"github.com/fernomac/aws-local/pkg/sqs"
+)
+
+// Delivery retries.
+const (
+	deliveryAttempts = 3
+	deliveryBackoff  = time.Second
+	deliveryTimeout  = 15 * time.Second
+)
+
+// Target kinds.
+const (
+	kindQueue = "sqs"
+	kindHTTP  = "http"
+	kindSink  = "sink"
+)
+
+// SinkArn is the target ARN of the sink with the given name.
+func SinkArn(name string) string {
+	return fmt.Sprintf("arn:aws:events:%v:%v:sink/%v", common.Region, common.AccountID, name)
+}
+
+func sinkName(arn string) string {
+	prefix := SinkArn("")
+	if !strings.HasPrefix(arn, prefix) {
+		return ""
+	}
+	return arn[len(prefix):]
+}
+
+func queueName(arn string) string {
+	parts := strings.Split(arn, ":")
+	if len(parts) != 6 || parts[0] != "arn" || parts[2] != "sqs" || parts[4] != common.AccountID || parts[5] == "" {
+		return ""
+	}
+	return parts[5]
+}
+
+// Delivery is what a target was sent for an event.
+type Delivery struct {
+	EventID   string `json:"eventId"`
+	RuleArn   string `json:"ruleArn"`
+	TargetID  string `json:"targetId"`
+	TargetArn string `json:"targetArn"`
+	Body      string `json:"body"`
+}
+
+// Sink receives deliveries in process, for targets whose Arn is the sink's
+// SinkArn.
+type Sink interface {
+	Deliver(d *Delivery) error
+}
+
+// Inbox is a sink that keeps the most recent deliveries in memory, for
+// checking which rules matched which events.
+type Inbox struct {
+	lock       sync.Mutex
+	size       int
+	deliveries []*Delivery
+}
+
+// NewInbox creates an inbox holding up to size deliveries.
+func NewInbox(size int) *Inbox {
+	return &Inbox{size: size}
+}
+
+// Deliver keeps a delivery, evicting the oldest if the inbox is full.
+func (i *Inbox) Deliver(d *Delivery) error {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	if i.size > 0 {
+		if len(i.deliveries) == i.size {
+			i.deliveries = i.deliveries[1:]
+		}
+		i.deliveries = append(i.deliveries, d)
+	}
+	return nil
+}
+
+// Deliveries returns the deliveries for a rule or target, or all of them if
+// both are empty, newest first.
+func (i *Inbox) Deliveries(ruleArn string, targetID string, limit int) []*Delivery {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	out := []*Delivery{}
+	for j := len(i.deliveries) - 1; j >= 0; j-- {
+		d := i.deliveries[j]
+		if ruleArn != "" && d.RuleArn != ruleArn {
+			continue
+		}
+		if targetID != "" && d.TargetID != targetID {
+			continue
+		}
+		out = append(out, d)
+		if limit > 0 && len(out) >= limit {
+			break
+		}
+	}
+	return out
+}
+
+// ServeHTTP serves deliveries as a JSON array, filtered by the ruleArn,
+// targetId and limit query parameters. DELETE empties the inbox.
+func (i *Inbox) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	if req.Method == "DELETE" {
+		i.lock.Lock()
+		i.deliveries = nil
+		i.lock.Unlock()
+		resp.WriteHeader(204)
+		return
+	}
+
+	q := req.URL.Query()
+	limit := 0
+	if l := q.Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil {
+			http.Error(resp, "invalid limit: "+err.Error(), 400)
+			return
+		}
+		limit = n
+	}
+
+	body, err := json.Marshal(i.Deliveries(q.Get("ruleArn"), q.Get("targetId"), limit))
+	if err != nil {
+		http.Error(resp, err.Error(), 500)
+		return
+	}
+
+	resp.Header().Add("Content-Type", "application/json")
+	resp.Write(body)
+}
+
+//
+// Input.
+//
+
+// parsePath parses a JSON path such as $.detail.items[0].name into the keys
+// and indexes it follows.
+func parsePath(path string) ([]interface{}, error) {
+	invalid := validation("JSON path %v is not valid.", path)
+	if !strings.HasPrefix(path, "$") {
+		return nil, invalid
+	}
+	out := []interface{}{}
+	rest := path[1:]
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			end := strings.IndexAny(rest[1:], ".[")
+			if end < 0 {
+				end = len(rest) - 1
+			}
+			key := rest[1 : end+1]
+			if key == "" {
+				return nil, invalid
+			}
+			out = append(out, key)
+			rest = rest[end+1:]
+
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, invalid
+			}
+			inside := rest[1:end]
+			if len(inside) >= 2 && (inside[0] == '\'' || inside[0] == '"') && inside[len(inside)-1] == inside[0] {
+				out = append(out, inside[1:len(inside)-1])
+			} else if n, err := strconv.Atoi(inside); err == nil && n >= 0 {
+				out = append(out, n)
+			} else {
+				return nil, invalid
+			}
+			rest = rest[end+1:]
+
+		default:
+			return nil, invalid
+		}
+	}
+	return out, nil
+}
+
+// lookup follows a parsed JSON path into a value, returning nil if it leads
+// nowhere.
+func lookup(v interface{}, path []interface{}) interface{} {
+	for _, step := range path {
+		switch s := step.(type) {
+		case string:
+			obj, ok := v.(map[string]interface{})
+			if !ok {
+				return nil
+			}
+			v = obj[s]
+		case int:
+			list, ok := v.([]interface{})
+			if !ok || s >= len(list) {
+				return nil
+			}
+			v = list[s]
+		}
+	}
+	return v
+}
+
+// validateInput checks that a target changes its input at most one way, and
+// that its paths parse.
+func validateInput(t *Target) error {
+	n := 0
+	if t.Input != "" {
+		n++
+		if !json.Valid([]byte(t.Input)) {
+			return validation("Input for target %v is not valid JSON.", t.ID)
+		}
+	}
+	if t.InputPath != "" {
+		n++
+		if _, err := parsePath(t.InputPath); err != nil {
+			return err
+		}
+	}
+	if t.InputTransformer != nil {
+		n++
+		if t.InputTransformer.InputTemplate == "" {
+			return validation("InputTemplate for target %v must not be empty.", t.ID)
+		}
+		if len(t.InputTransformer.InputPathsMap) > maxInputPaths {
+			return validation("InputPathsMap for target %v has more than %v entries.", t.ID, maxInputPaths)
+		}
+		for name, path := range t.InputTransformer.InputPathsMap {
+			if strings.HasPrefix(name, "aws.events.") {
+				return validation("InputPathsMap for target %v uses the reserved name %v.", t.ID, name)
+			}
+			if _, err := parsePath(path); err != nil {
+				return err
+			}
+		}
+	}
+	if n > 1 {
+		return validation("Only one of Input, InputPath, or InputTransformer must be provided for target %v.", t.ID)
+	}
+	return nil
+}
+
+// input is what a target is sent for an event.
+func input(t *Target, ev *occurrence) string {
+	switch {
+	case t.Input != "":
+		return t.Input
+	case t.InputPath != "":
+		path, _ := parsePath(t.InputPath)
+		return marshal(lookup(ev.value, path))
+	case t.InputTransformer != nil:
+		return transform(t.InputTransformer, ev)
+	}
+	return string(ev.raw)
+}
+
+func marshal(v interface{}) string {
+	out, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return string(out)
+}
+
+// transform fills in an input template. A placeholder inside a JSON string
+// is replaced with the text of a string value, and anywhere else with the
+// value as JSON.
+func transform(tr *InputTransformer, ev *occurrence) string {
+	values := map[string]interface{}{
+		"aws.events.rule-arn":             ev.ruleArn,
+		"aws.events.rule-name":            ev.ruleName,
+		"aws.events.event.ingestion-time": timestamp(ev.ingested),
+		"aws.events.event":                ev.value,
+		"aws.events.event.json":           ev.value,
+	}
+	for name, p := range tr.InputPathsMap {
+		path, _ := parsePath(p)
+		values[name] = lookup(ev.value, path)
+	}
+
+	tmpl := tr.InputTemplate
+	var out strings.Builder
+	inString := false
+	for i := 0; i < len(tmpl); i++ {
+		c := tmpl[i]
+		switch c {
+		case '\\':
+			if inString && i+1 < len(tmpl) {
+				out.WriteByte(c)
+				i++
+				c = tmpl[i]
+			}
+		case '"':
+			inString = !inString
+		case '<':
+			if end := strings.IndexByte(tmpl[i:], '>'); end > 0 {
+				if v, ok := values[tmpl[i+1:i+end]]; ok {
+					out.WriteString(placeholder(v, inString))
+					i += end
+					continue
+				}
+			}
+		}
+		out.WriteByte(c)
+	}
+	return out.String()
+}
+
+func placeholder(v interface{}, inString bool) string {
+	if !inString {
+		return marshal(v)
+	}
+	switch s := v.(type) {
+	case nil:
+		return ""
+	case string:
+		quoted := marshal(s)
+		return quoted[1 : len(quoted)-1]
+	default:
+		quoted := marshal(marshal(s))
+		return quoted[1 : len(quoted)-1]
+	}
+}
+
+//
+// Delivery.
+//
+
+// checkTarget checks that a target is somewhere events can be delivered.
+// The caller must hold s.lock.
+func (s *events) checkTarget(t *Target) error {
+	if !idPattern.MatchString(t.ID) {
+		return validation("Target Id %v is not valid.", t.ID)
+	}
+	if err := validateInput(t); err != nil {
+		return err
+	}
+	if t.DeadLetterConfig != nil && t.DeadLetterConfig.Arn != "" && queueName(t.DeadLetterConfig.Arn) == "" {
+		return validation("DeadLetterConfig for target %v must be an SQS queue ARN.", t.ID)
+	}
+
+	switch targetKind(t.Arn) {
+	case kindQueue:
+		if s.queues == nil {
+			return validation("Target %v: there is no SQS to deliver to.", t.ID)
+		}
+		if strings.HasSuffix(queueName(t.Arn), ".fifo") && (t.SqsParameters == nil || t.SqsParameters.MessageGroupID == "") {
+			return validation("Parameter(s) SqsParameters must be specified for target: %v.", t.ID)
+		}
+	case kindSink:
+		if _, ok := s.sinks[sinkName(t.Arn)]; !ok {
+			return validation("Target %v: there is no sink named %v.", t.ID, sinkName(t.Arn))
+		}
+	case kindHTTP:
+	default:
+		return validation("Target %v: %v is not supported locally. Targets must be SQS queues, http or https URLs, or sinks.", t.ID, t.Arn)
+	}
+	return nil
+}
+
+func targetKind(arn string) string {
+	if queueName(arn) != "" {
+		return kindQueue
+	}
+	if sinkName(arn) != "" {
+		return kindSink
+	}
+	if u, err := url.Parse(arn); err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" {
+		return kindHTTP
+	}
+	return ""
+}
+
+// dispatch is an event on its way to a target, taken while holding the lock.
+type dispatch struct {
+	event  *occurrence
+	target Target
+}
+
+// deliver sends events to their targets. Queues and sinks get them before
+// deliver returns; HTTP endpoints get them in the background. The caller
+// must not hold s.lock.
+func (s *events) deliver(dispatches []dispatch) {
+	for _, d := range dispatches {
+		t := d.target
+		delivery := &Delivery{
+			EventID:   d.event.id,
+			RuleArn:   d.event.ruleArn,
+			TargetID:  t.ID,
+			TargetArn: t.Arn,
+			Body:      input(&t, d.event),
+		}
+
+		switch targetKind(t.Arn) {
+		case kindQueue:
+			if err := s.sendToQueue(t.Arn, delivery.Body, &t, d.event.id); err != nil {
+				s.deadLetter(&t, delivery)
+			}
+
+		case kindSink:
+			sink, ok := s.sinks[sinkName(t.Arn)]
+			if !ok || sink.Deliver(delivery) != nil {
+				s.deadLetter(&t, delivery)
+			}
+
+		case kindHTTP:
+			go func(t Target, d *Delivery) {
+				if err := s.post(t.Arn, d); err != nil {
+					s.deadLetter(&t, d)
+				}
+			}(t, delivery)
+		}
+	}
+}
+
+// deadLetter sends an event that couldn't be delivered to the target's
+// dead-letter queue, if it has one.
+func (s *events) deadLetter(t *Target, d *Delivery) {
+	if t.DeadLetterConfig != nil && t.DeadLetterConfig.Arn != "" {
+		s.sendToQueue(t.DeadLetterConfig.Arn, d.Body, t, d.EventID)
+	}
+}
+
+// post sends a delivery to an HTTP endpoint, retrying a few times if it
+// doesn't answer with a 2xx status.
+func (s *events) post(endpoint string, d *Delivery) error {
+	var err error
+	for attempt := 0; attempt < deliveryAttempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(deliveryBackoff * time.Duration(attempt))
+		}
+		if err = s.postOnce(endpoint, d); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+func (s *events) postOnce(endpoint string, d *Delivery) error {
+	req, err := http.NewRequest("POST", endpoint, bytes.NewReader([]byte(d.Body)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%v answered %v", endpoint, resp.Status)
+	}
+	return nil
+}
+
+// sendToQueue sends a message to the SQS queue with the given ARN. Messages
+// to FIFO queues are deduplicated by event ID.
+func (s *events) sendToQueue(arn string, body string, t *Target, eventID string) error {
+	if s.queues == nil {
+		return fmt.Errorf("no SQS to deliver to")
+	}
+	q, err := s.queues.GetQueueURL(&sqs.GetQueueURLRequest{QueueName: queueName(arn)})
+	if err != nil {
+		return err
+	}
+
+	req := &sqs.SendMessageRequest{
+		QueueURL:    q.QueueURL,
+		MessageBody: body,
+	}
+	if strings.HasSuffix(queueName(arn), ".fifo") {
+		req.MessageDeduplicationID = eventID
+		if t.SqsParameters != nil {
+			req.MessageGroupID = t.SqsParameters.MessageGroupID
+		}
+	}
+	_, err = s.queues.SendMessage(req)
+	return err
+}
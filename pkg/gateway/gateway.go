@@ -0,0 +1,111 @@
+// Package gateway serves several AWS service fakes from one endpoint, the
+// way a single LocalStack-style port does, by working out which service each
+// request is for.
+package gateway
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/fernomac/aws-local/pkg/sigv4"
+)
+
+// Gateway routes requests to services. A request goes to the service named in
+// its SigV4 credential scope, from the Authorization header or a presigned
+// URL's X-Amz-Credential parameter; failing that, to the service whose
+// X-Amz-Target prefix it uses, or whose API version a query protocol request
+// names.
+type Gateway struct {
+	services map[string]http.Handler
+	targets  map[string]http.Handler
+	versions map[string]http.Handler
+}
+
+// New creates a gateway with no services.
+func New() *Gateway {
+	return &Gateway{
+		services: make(map[string]http.Handler),
+		targets:  make(map[string]http.Handler),
+		versions: make(map[string]http.Handler),
+	}
+}
+
+// Handle serves the named service with h. The name is the service's SigV4
+// signing name, e.g. "kms". Unsigned requests whose X-Amz-Target starts with
+// one of the given prefixes, e.g. "TrentService", are also sent to h.
+func (g *Gateway) Handle(service string, h http.Handler, targetPrefixes ...string) {
+	g.services[service] = h
+	for _, prefix := range targetPrefixes {
+		g.targets[prefix] = h
+	}
+}
+
+// HandleVersion sends unsigned query protocol requests whose Version
+// parameter is the given API version, e.g. "2011-06-15", to h. Some calls,
+// such as AssumeRoleWithWebIdentity, are made without credentials.
+func (g *Gateway) HandleVersion(version string, h http.Handler) {
+	g.versions[version] = h
+}
+
+// version returns the Version parameter of a query protocol request, from
+// its URL or form encoded body. It leaves the body for the service to read.
+func version(req *http.Request) string {
+	if v := req.URL.Query().Get("Version"); v != "" {
+		return v
+	}
+	if req.Method != "POST" || !strings.HasPrefix(req.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		return ""
+	}
+
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return ""
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		return ""
+	}
+	return form.Get("Version")
+}
+
+// service returns the SigV4 signing name of the service a request is for, or
+// "" if it isn't signed.
+func service(req *http.Request) string {
+	if auth, err := sigv4.ParseAuthorization(req.Header.Get("Authorization")); err == nil {
+		return auth.Service
+	}
+	if cred := req.URL.Query().Get("X-Amz-Credential"); cred != "" {
+		scope := strings.Split(cred, "/")
+		if len(scope) == 5 {
+			return scope[3]
+		}
+	}
+	return ""
+}
+
+func (g *Gateway) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	if h, ok := g.services[service(req)]; ok {
+		h.ServeHTTP(resp, req)
+		return
+	}
+
+	if target := req.Header.Get("X-Amz-Target"); target != "" {
+		prefix := strings.SplitN(target, ".", 2)[0]
+		if h, ok := g.targets[prefix]; ok {
+			h.ServeHTTP(resp, req)
+			return
+		}
+	}
+
+	if h, ok := g.versions[version(req)]; ok {
+		h.ServeHTTP(resp, req)
+		return
+	}
+
+	http.Error(resp, "no service found for request", http.StatusBadRequest)
+}
@@ -0,0 +1,118 @@
+package gateway
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// named is a handler that answers with its name.
+type named string
+
+func (n named) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	resp.Write([]byte(n))
+}
+
+func testGateway() *Gateway {
+	g := New()
+	g.Handle("kms", named("kms"), "TrentService")
+	g.Handle("secretsmanager", named("secretsmanager"), "secretsmanager")
+	g.Handle("s3", named("s3"))
+	return g
+}
+
+func TestRouting(t *testing.T) {
+	tests := []struct {
+		name    string
+		url     string
+		headers map[string]string
+		want    string
+	}{
+		{"signed", "/", map[string]string{
+			"Authorization": "AWS4-HMAC-SHA256 Credential=AK/20240102/us-local-1/kms/aws4_request, SignedHeaders=host, Signature=abc",
+		}, "kms"},
+		{"signing name beats target", "/", map[string]string{
+			"Authorization": "AWS4-HMAC-SHA256 Credential=AK/20240102/us-local-1/secretsmanager/aws4_request, SignedHeaders=host, Signature=abc",
+			"X-Amz-Target":  "TrentService.Encrypt",
+		}, "secretsmanager"},
+		{"presigned", "/bucket/key?X-Amz-Credential=AK%2F20240102%2Fus-local-1%2Fs3%2Faws4_request&X-Amz-Signature=abc", nil, "s3"},
+		{"unsigned target", "/", map[string]string{"X-Amz-Target": "TrentService.Encrypt"}, "kms"},
+		{"unknown signing name falls back to target", "/", map[string]string{
+			"Authorization": "AWS4-HMAC-SHA256 Credential=AK/20240102/us-local-1/nope/aws4_request, SignedHeaders=host, Signature=abc",
+			"X-Amz-Target":  "secretsmanager.GetSecretValue",
+		}, "secretsmanager"},
+		{"target prefix must match exactly", "/", map[string]string{"X-Amz-Target": "TrentServiceX.Encrypt"}, ""},
+		{"malformed authorization", "/", map[string]string{"Authorization": "AWS4-HMAC-SHA256 Credential=AK/kms"}, ""},
+		{"nothing to go on", "/", nil, ""},
+	}
+
+	g := testGateway()
+	for _, test := range tests {
+		req := httptest.NewRequest("POST", test.url, nil)
+		for k, v := range test.headers {
+			req.Header.Set(k, v)
+		}
+		resp := httptest.NewRecorder()
+		g.ServeHTTP(resp, req)
+
+		if test.want == "" {
+			if resp.Code != http.StatusBadRequest {
+				t.Errorf("%v: routed to %q", test.name, resp.Body.String())
+			}
+			continue
+		}
+		if resp.Code != 200 || resp.Body.String() != test.want {
+			t.Errorf("%v: got %v %q, want %v", test.name, resp.Code, resp.Body.String(), test.want)
+		}
+	}
+}
+
+func TestVersionRouting(t *testing.T) {
+	var seen string
+	g := testGateway()
+	g.HandleVersion("2011-06-15", http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		seen = string(body)
+	}))
+
+	form := "application/x-www-form-urlencoded; charset=utf-8"
+	tests := []struct {
+		name        string
+		url         string
+		contentType string
+		body        string
+		routed      bool
+	}{
+		{"version in query", "/?Action=GetCallerIdentity&Version=2011-06-15", "", "", true},
+		{"version in body", "/", form, "Action=AssumeRoleWithWebIdentity&Version=2011-06-15", true},
+		{"unknown version", "/", form, "Action=GetCallerIdentity&Version=2010-05-08", false},
+		{"body that isn't a form", "/", "application/json", "Version=2011-06-15", false},
+		{"no version", "/", form, "Action=GetCallerIdentity", false},
+	}
+
+	for _, test := range tests {
+		seen = ""
+		req := httptest.NewRequest("POST", test.url, strings.NewReader(test.body))
+		if test.contentType != "" {
+			req.Header.Set("Content-Type", test.contentType)
+		}
+		resp := httptest.NewRecorder()
+		g.ServeHTTP(resp, req)
+
+		if !test.routed {
+			if resp.Code != http.StatusBadRequest {
+				t.Errorf("%v: routed with %v", test.name, resp.Code)
+			}
+			continue
+		}
+		if resp.Code != 200 {
+			t.Errorf("%v: got %v %q", test.name, resp.Code, resp.Body.String())
+		}
+		// The service still gets to read the body the gateway looked at.
+		if seen != test.body {
+			t.Errorf("%v: service read %q, want %q", test.name, seen, test.body)
+		}
+	}
+}
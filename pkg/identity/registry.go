@@ -0,0 +1,169 @@
+// Package identity keeps track of the credentials handed out locally and the
+// principals they belong to, so that any service can tell who is calling.
+package identity
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fernomac/aws-local/pkg/common"
+	"github.com/fernomac/aws-local/pkg/sigv4"
+)
+
+// Principal types, as reported in CloudTrail's userIdentity.type.
+const (
+	TypeRoot        = "Root"
+	TypeIAMUser     = "IAMUser"
+	TypeAssumedRole = "AssumedRole"
+)
+
+// Principal is someone who can make calls.
+type Principal struct {
+	// Type is one of the Type constants.
+	Type string
+	// AccountID is the account the principal belongs to.
+	AccountID string
+	// Arn is the principal's ARN, e.g.
+	// arn:aws:sts::000000000000:assumed-role/Role/session.
+	Arn string
+	// UserID is the principal's unique ID, e.g. AROAEXAMPLE:session.
+	UserID string
+	// SessionTags are the tags of a role session.
+	SessionTags map[string]string
+	// TransitiveTagKeys are the session tags that carry over to role
+	// sessions assumed from this one.
+	TransitiveTagKeys []string
+	// SourceIdentity is the source identity set on a role session.
+	SourceIdentity string
+}
+
+// Root returns the root principal of the local account, which is who
+// callers with unknown credentials are taken to be.
+func Root() *Principal {
+	return &Principal{
+		Type:      TypeRoot,
+		AccountID: common.AccountID,
+		Arn:       "arn:aws:iam::" + common.AccountID + ":root",
+		UserID:    common.AccountID,
+	}
+}
+
+// Credentials are a set of (possibly temporary) access keys.
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	// Expiration is when temporary credentials stop working; zero for
+	// long-term credentials.
+	Expiration time.Time
+}
+
+type entry struct {
+	creds     Credentials
+	principal *Principal
+}
+
+// Registry maps access keys to the principals they belong to. It's safe for
+// concurrent use.
+type Registry struct {
+	lock    sync.RWMutex
+	clock   common.Clock
+	entries map[string]*entry
+}
+
+// NewRegistry creates an empty registry that expires credentials by the
+// given clock, or the system clock if it's nil.
+func NewRegistry(clock common.Clock) *Registry {
+	if clock == nil {
+		clock = common.SystemClock
+	}
+	return &Registry{
+		clock:   clock,
+		entries: make(map[string]*entry),
+	}
+}
+
+// Add registers credentials belonging to the given principal.
+func (r *Registry) Add(creds Credentials, principal *Principal) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.entries[creds.AccessKeyID] = &entry{creds, principal}
+}
+
+// purge forgets expired credentials. It's called with the lock held.
+func (r *Registry) purge(now time.Time) {
+	for id, e := range r.entries {
+		if !e.creds.Expiration.IsZero() && now.After(e.creds.Expiration.Add(time.Hour)) {
+			delete(r.entries, id)
+		}
+	}
+}
+
+// lookup returns the entry for the given access key, or nil if it isn't
+// known. It returns ExpiredToken if temporary credentials have expired.
+func (r *Registry) lookup(accessKeyID string) (*entry, error) {
+	now := r.clock.Now()
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.purge(now)
+
+	e, ok := r.entries[accessKeyID]
+	if !ok {
+		return nil, nil
+	}
+	if !e.creds.Expiration.IsZero() && now.After(e.creds.Expiration) {
+		return nil, common.Errorf("ExpiredToken", "The security token included in the request is expired")
+	}
+	return e, nil
+}
+
+// Lookup returns the principal the given access key belongs to, or nil if
+// it isn't known. It returns ExpiredToken if temporary credentials have
+// expired.
+func (r *Registry) Lookup(accessKeyID string) (*Principal, error) {
+	e, err := r.lookup(accessKeyID)
+	if err != nil || e == nil {
+		return nil, err
+	}
+	return e.principal, nil
+}
+
+// Caller returns the principal that signed the given request. Unsigned
+// requests, and requests signed with access keys that weren't handed out
+// locally, come from the account root, since callers aren't authenticated.
+// Temporary credentials must be presented with their session token.
+func (r *Registry) Caller(req *http.Request) (*Principal, error) {
+	accessKeyID := ""
+	if auth, err := sigv4.ParseAuthorization(req.Header.Get("Authorization")); err == nil {
+		accessKeyID = auth.AccessKeyID
+	} else if cred := req.URL.Query().Get("X-Amz-Credential"); cred != "" {
+		accessKeyID = strings.Split(cred, "/")[0]
+	}
+	if accessKeyID == "" {
+		return Root(), nil
+	}
+
+	e, err := r.lookup(accessKeyID)
+	if err != nil {
+		return nil, err
+	}
+	if e == nil {
+		return Root(), nil
+	}
+	if e.creds.SessionToken != "" && e.creds.SessionToken != securityToken(req) {
+		return nil, common.Errorf("InvalidClientTokenId", "The security token included in the request is invalid")
+	}
+	return e.principal, nil
+}
+
+func securityToken(req *http.Request) string {
+	if token := req.Header.Get("X-Amz-Security-Token"); token != "" {
+		return token
+	}
+	return req.URL.Query().Get("X-Amz-Security-Token")
+}
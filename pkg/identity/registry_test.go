@@ -0,0 +1,116 @@
+package identity_test
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/fernomac/aws-local/pkg/common"
+	"github.com/fernomac/aws-local/pkg/identity"
+	"github.com/fernomac/aws-local/pkg/sigv4"
+)
+
+// testClock is a clock the tests move by hand.
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	return c.now
+}
+
+func code(err error) string {
+	if ce, ok := err.(common.Error); ok {
+		return ce.Code
+	}
+	if err != nil {
+		return err.Error()
+	}
+	return ""
+}
+
+func TestCaller(t *testing.T) {
+	clock := &testClock{now: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)}
+	registry := identity.NewRegistry(clock)
+
+	user := &identity.Principal{Type: identity.TypeIAMUser, AccountID: common.AccountID, Arn: "arn:aws:iam::" + common.AccountID + ":user/alice"}
+	session := &identity.Principal{Type: identity.TypeAssumedRole, AccountID: common.AccountID, Arn: "arn:aws:sts::" + common.AccountID + ":assumed-role/r/s"}
+	registry.Add(identity.Credentials{AccessKeyID: "AKIAUSER", SecretAccessKey: "secret"}, user)
+	registry.Add(identity.Credentials{
+		AccessKeyID:     "ASIASESSION",
+		SecretAccessKey: "secret",
+		SessionToken:    "token",
+		Expiration:      clock.now.Add(time.Hour),
+	}, session)
+
+	tests := []struct {
+		name    string
+		creds   *sigv4.Credentials
+		query   string
+		advance time.Duration
+		want    *identity.Principal
+		code    string
+	}{
+		{"unsigned", nil, "", 0, identity.Root(), ""},
+		{"unknown key", &sigv4.Credentials{AccessKeyID: "AKIAOTHER", SecretAccessKey: "x"}, "", 0, identity.Root(), ""},
+		{"long-term key", &sigv4.Credentials{AccessKeyID: "AKIAUSER", SecretAccessKey: "secret"}, "", 0, user, ""},
+		{"session with token", &sigv4.Credentials{AccessKeyID: "ASIASESSION", SecretAccessKey: "secret", SessionToken: "token"}, "", 0, session, ""},
+		{"session without token", &sigv4.Credentials{AccessKeyID: "ASIASESSION", SecretAccessKey: "secret"}, "", 0, nil, "InvalidClientTokenId"},
+		{"session with wrong token", &sigv4.Credentials{AccessKeyID: "ASIASESSION", SecretAccessKey: "secret", SessionToken: "other"}, "", 0, nil, "InvalidClientTokenId"},
+		{"presigned", nil, "X-Amz-Credential=ASIASESSION/20240102/us-local-1/s3/aws4_request&X-Amz-Security-Token=token", 0, session, ""},
+		{"presigned without token", nil, "X-Amz-Credential=ASIASESSION/20240102/us-local-1/s3/aws4_request", 0, nil, "InvalidClientTokenId"},
+		{"session at expiry", &sigv4.Credentials{AccessKeyID: "ASIASESSION", SecretAccessKey: "secret", SessionToken: "token"}, "", time.Hour, session, ""},
+		{"expired session", &sigv4.Credentials{AccessKeyID: "ASIASESSION", SecretAccessKey: "secret", SessionToken: "token"}, "", time.Hour + time.Second, nil, "ExpiredToken"},
+		{"long-term key later", &sigv4.Credentials{AccessKeyID: "AKIAUSER", SecretAccessKey: "secret"}, "", 24 * time.Hour, user, ""},
+	}
+
+	start := clock.now
+	for _, test := range tests {
+		clock.now = start.Add(test.advance)
+		req := httptest.NewRequest("GET", "/?"+test.query, nil)
+		if test.creds != nil {
+			sigv4.Sign(req, nil, *test.creds, "us-local-1", "sts", clock.now)
+		}
+
+		got, err := registry.Caller(req)
+		if c := code(err); c != test.code {
+			t.Errorf("%v: got %v, want %v", test.name, c, test.code)
+			continue
+		}
+		if err == nil && got.Arn != test.want.Arn {
+			t.Errorf("%v: got %v, want %v", test.name, got.Arn, test.want.Arn)
+		}
+	}
+}
+
+func TestLookupExpiry(t *testing.T) {
+	clock := &testClock{now: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)}
+	registry := identity.NewRegistry(clock)
+	principal := &identity.Principal{Type: identity.TypeAssumedRole, Arn: "arn:aws:sts::000000000000:assumed-role/r/s"}
+	registry.Add(identity.Credentials{AccessKeyID: "ASIA", SessionToken: "t", Expiration: clock.now.Add(time.Hour)}, principal)
+
+	tests := []struct {
+		advance time.Duration
+		found   bool
+		code    string
+	}{
+		{0, true, ""},
+		{time.Hour, true, ""},
+		{time.Hour + time.Second, false, "ExpiredToken"},
+		{2 * time.Hour, false, "ExpiredToken"},
+		// An hour after they expire, credentials are forgotten.
+		{2*time.Hour + time.Second, false, ""},
+	}
+
+	start := clock.now
+	for _, test := range tests {
+		clock.now = start.Add(test.advance)
+		got, err := registry.Lookup("ASIA")
+		if c := code(err); c != test.code {
+			t.Errorf("after %v: got %v, want %v", test.advance, c, test.code)
+		}
+		if found := got != nil; found != test.found {
+			t.Errorf("after %v: found is %v", test.advance, found)
+		}
+	}
+}
@@ -0,0 +1,346 @@
+package kinesis
+
+// Kinesis is the service interface for Amazon Kinesis Data Streams.
+type Kinesis interface {
+	CreateStream(*CreateStreamRequest) (*CreateStreamResult, error)
+	DeleteStream(*DeleteStreamRequest) (*DeleteStreamResult, error)
+	DescribeStream(*DescribeStreamRequest) (*DescribeStreamResult, error)
+	DescribeStreamSummary(*DescribeStreamSummaryRequest) (*DescribeStreamSummaryResult, error)
+	ListStreams(*ListStreamsRequest) (*ListStreamsResult, error)
+
+	ListShards(*ListShardsRequest) (*ListShardsResult, error)
+	SplitShard(*SplitShardRequest) (*SplitShardResult, error)
+	MergeShards(*MergeShardsRequest) (*MergeShardsResult, error)
+
+	PutRecord(*PutRecordRequest) (*PutRecordResult, error)
+	PutRecords(*PutRecordsRequest) (*PutRecordsResult, error)
+	GetShardIterator(*GetShardIteratorRequest) (*GetShardIteratorResult, error)
+	GetRecords(*GetRecordsRequest) (*GetRecordsResult, error)
+
+	StartStreamEncryption(*StartStreamEncryptionRequest) (*StartStreamEncryptionResult, error)
+	StopStreamEncryption(*StopStreamEncryptionRequest) (*StopStreamEncryptionResult, error)
+}
+
+// Stream statuses.
+const (
+	StreamStatusActive = "ACTIVE"
+)
+
+// Encryption types.
+const (
+	EncryptionTypeNone = "NONE"
+	EncryptionTypeKMS  = "KMS"
+)
+
+// Shard iterator types.
+const (
+	IteratorTrimHorizon         = "TRIM_HORIZON"
+	IteratorLatest              = "LATEST"
+	IteratorAtSequenceNumber    = "AT_SEQUENCE_NUMBER"
+	IteratorAfterSequenceNumber = "AFTER_SEQUENCE_NUMBER"
+	IteratorAtTimestamp         = "AT_TIMESTAMP"
+)
+
+// HashKeyRange is the range of hash keys a shard owns, as decimal strings.
+type HashKeyRange struct {
+	StartingHashKey string `json:"StartingHashKey"`
+	EndingHashKey   string `json:"EndingHashKey"`
+}
+
+// SequenceNumberRange is the range of sequence numbers in a shard. The end is
+// only set once the shard is closed.
+type SequenceNumberRange struct {
+	StartingSequenceNumber string `json:"StartingSequenceNumber"`
+	EndingSequenceNumber   string `json:"EndingSequenceNumber,omitempty"`
+}
+
+// Shard describes a shard.
+type Shard struct {
+	AdjacentParentShardID string              `json:"AdjacentParentShardId,omitempty"`
+	HashKeyRange          HashKeyRange        `json:"HashKeyRange"`
+	ParentShardID         string              `json:"ParentShardId,omitempty"`
+	SequenceNumberRange   SequenceNumberRange `json:"SequenceNumberRange"`
+	ShardID               string              `json:"ShardId"`
+}
+
+// ChildShard describes a shard that took over from a closed one.
+type ChildShard struct {
+	HashKeyRange HashKeyRange `json:"HashKeyRange"`
+	ParentShards []string     `json:"ParentShards"`
+	ShardID      string       `json:"ShardId"`
+}
+
+// StreamModeDetails says how a stream's capacity is managed.
+type StreamModeDetails struct {
+	StreamMode string `json:"StreamMode"`
+}
+
+// EnhancedMetrics lists the shard-level metrics enabled on a stream.
+type EnhancedMetrics struct {
+	ShardLevelMetrics []string `json:"ShardLevelMetrics"`
+}
+
+// StreamDescription describes a stream and its shards.
+type StreamDescription struct {
+	EncryptionType          string            `json:"EncryptionType"`
+	EnhancedMonitoring      []EnhancedMetrics `json:"EnhancedMonitoring"`
+	HasMoreShards           bool              `json:"HasMoreShards"`
+	KeyID                   string            `json:"KeyId,omitempty"`
+	RetentionPeriodHours    int               `json:"RetentionPeriodHours"`
+	Shards                  []Shard           `json:"Shards"`
+	StreamARN               string            `json:"StreamARN"`
+	StreamCreationTimestamp int64             `json:"StreamCreationTimestamp"`
+	StreamModeDetails       StreamModeDetails `json:"StreamModeDetails"`
+	StreamName              string            `json:"StreamName"`
+	StreamStatus            string            `json:"StreamStatus"`
+}
+
+// StreamDescriptionSummary describes a stream without its shards.
+type StreamDescriptionSummary struct {
+	ConsumerCount           int               `json:"ConsumerCount"`
+	EncryptionType          string            `json:"EncryptionType"`
+	EnhancedMonitoring      []EnhancedMetrics `json:"EnhancedMonitoring"`
+	KeyID                   string            `json:"KeyId,omitempty"`
+	OpenShardCount          int               `json:"OpenShardCount"`
+	RetentionPeriodHours    int               `json:"RetentionPeriodHours"`
+	StreamARN               string            `json:"StreamARN"`
+	StreamCreationTimestamp int64             `json:"StreamCreationTimestamp"`
+	StreamModeDetails       StreamModeDetails `json:"StreamModeDetails"`
+	StreamName              string            `json:"StreamName"`
+	StreamStatus            string            `json:"StreamStatus"`
+}
+
+// StreamSummary is an entry in ListStreams.
+type StreamSummary struct {
+	StreamARN               string            `json:"StreamARN"`
+	StreamCreationTimestamp int64             `json:"StreamCreationTimestamp"`
+	StreamModeDetails       StreamModeDetails `json:"StreamModeDetails"`
+	StreamName              string            `json:"StreamName"`
+	StreamStatus            string            `json:"StreamStatus"`
+}
+
+// Record is a data record read from a shard. Its arrival timestamp is in
+// fractional seconds since the epoch.
+type Record struct {
+	ApproximateArrivalTimestamp float64 `json:"ApproximateArrivalTimestamp"`
+	Data                        []byte  `json:"Data"`
+	EncryptionType              string  `json:"EncryptionType,omitempty"`
+	PartitionKey                string  `json:"PartitionKey"`
+	SequenceNumber              string  `json:"SequenceNumber"`
+}
+
+//
+// API shapes for streams.
+//
+
+// CreateStreamRequest is a request to CreateStream.
+type CreateStreamRequest struct {
+	ShardCount        *int               `json:"ShardCount"`
+	StreamModeDetails *StreamModeDetails `json:"StreamModeDetails"`
+	StreamName        string             `json:"StreamName"`
+}
+
+// CreateStreamResult is the result of CreateStream.
+type CreateStreamResult struct{}
+
+// DeleteStreamRequest is a request to DeleteStream.
+type DeleteStreamRequest struct {
+	EnforceConsumerDeletion bool   `json:"EnforceConsumerDeletion"`
+	StreamARN               string `json:"StreamARN"`
+	StreamName              string `json:"StreamName"`
+}
+
+// DeleteStreamResult is the result of DeleteStream.
+type DeleteStreamResult struct{}
+
+// DescribeStreamRequest is a request to DescribeStream.
+type DescribeStreamRequest struct {
+	ExclusiveStartShardID string `json:"ExclusiveStartShardId"`
+	Limit                 int    `json:"Limit"`
+	StreamARN             string `json:"StreamARN"`
+	StreamName            string `json:"StreamName"`
+}
+
+// DescribeStreamResult is the result of DescribeStream.
+type DescribeStreamResult struct {
+	StreamDescription StreamDescription `json:"StreamDescription"`
+}
+
+// DescribeStreamSummaryRequest is a request to DescribeStreamSummary.
+type DescribeStreamSummaryRequest struct {
+	StreamARN  string `json:"StreamARN"`
+	StreamName string `json:"StreamName"`
+}
+
+// DescribeStreamSummaryResult is the result of DescribeStreamSummary.
+type DescribeStreamSummaryResult struct {
+	StreamDescriptionSummary StreamDescriptionSummary `json:"StreamDescriptionSummary"`
+}
+
+// ListStreamsRequest is a request to ListStreams.
+type ListStreamsRequest struct {
+	ExclusiveStartStreamName string `json:"ExclusiveStartStreamName"`
+	Limit                    int    `json:"Limit"`
+	NextToken                string `json:"NextToken"`
+}
+
+// ListStreamsResult is the result of ListStreams.
+type ListStreamsResult struct {
+	HasMoreStreams  bool            `json:"HasMoreStreams"`
+	NextToken       string          `json:"NextToken,omitempty"`
+	StreamNames     []string        `json:"StreamNames"`
+	StreamSummaries []StreamSummary `json:"StreamSummaries"`
+}
+
+//
+// API shapes for shards.
+//
+
+// ListShardsRequest is a request to ListShards. A NextToken names the stream,
+// so it can't be given with StreamName or StreamARN.
+type ListShardsRequest struct {
+	ExclusiveStartShardID string `json:"ExclusiveStartShardId"`
+	MaxResults            int    `json:"MaxResults"`
+	NextToken             string `json:"NextToken"`
+	StreamARN             string `json:"StreamARN"`
+	StreamName            string `json:"StreamName"`
+}
+
+// ListShardsResult is the result of ListShards.
+type ListShardsResult struct {
+	NextToken string  `json:"NextToken,omitempty"`
+	Shards    []Shard `json:"Shards"`
+}
+
+// SplitShardRequest is a request to SplitShard. NewStartingHashKey is the
+// first hash key of the second child, as a decimal string.
+type SplitShardRequest struct {
+	NewStartingHashKey string `json:"NewStartingHashKey"`
+	ShardToSplit       string `json:"ShardToSplit"`
+	StreamARN          string `json:"StreamARN"`
+	StreamName         string `json:"StreamName"`
+}
+
+// SplitShardResult is the result of SplitShard.
+type SplitShardResult struct{}
+
+// MergeShardsRequest is a request to MergeShards.
+type MergeShardsRequest struct {
+	AdjacentShardToMerge string `json:"AdjacentShardToMerge"`
+	ShardToMerge         string `json:"ShardToMerge"`
+	StreamARN            string `json:"StreamARN"`
+	StreamName           string `json:"StreamName"`
+}
+
+// MergeShardsResult is the result of MergeShards.
+type MergeShardsResult struct{}
+
+//
+// API shapes for records.
+//
+
+// PutRecordRequest is a request to PutRecord.
+type PutRecordRequest struct {
+	Data                      []byte `json:"Data"`
+	ExplicitHashKey           string `json:"ExplicitHashKey"`
+	PartitionKey              string `json:"PartitionKey"`
+	SequenceNumberForOrdering string `json:"SequenceNumberForOrdering"`
+	StreamARN                 string `json:"StreamARN"`
+	StreamName                string `json:"StreamName"`
+}
+
+// PutRecordResult is the result of PutRecord.
+type PutRecordResult struct {
+	EncryptionType string `json:"EncryptionType"`
+	SequenceNumber string `json:"SequenceNumber"`
+	ShardID        string `json:"ShardId"`
+}
+
+// PutRecordsRequestEntry is a record in a PutRecords request.
+type PutRecordsRequestEntry struct {
+	Data            []byte `json:"Data"`
+	ExplicitHashKey string `json:"ExplicitHashKey"`
+	PartitionKey    string `json:"PartitionKey"`
+}
+
+// PutRecordsRequest is a request to PutRecords.
+type PutRecordsRequest struct {
+	Records    []PutRecordsRequestEntry `json:"Records"`
+	StreamARN  string                   `json:"StreamARN"`
+	StreamName string                   `json:"StreamName"`
+}
+
+// PutRecordsResultEntry is the outcome of putting one record with PutRecords:
+// either a sequence number and shard, or an error.
+type PutRecordsResultEntry struct {
+	ErrorCode      string `json:"ErrorCode,omitempty"`
+	ErrorMessage   string `json:"ErrorMessage,omitempty"`
+	SequenceNumber string `json:"SequenceNumber,omitempty"`
+	ShardID        string `json:"ShardId,omitempty"`
+}
+
+// PutRecordsResult is the result of PutRecords.
+type PutRecordsResult struct {
+	EncryptionType    string                  `json:"EncryptionType"`
+	FailedRecordCount int                     `json:"FailedRecordCount"`
+	Records           []PutRecordsResultEntry `json:"Records"`
+}
+
+// GetShardIteratorRequest is a request to GetShardIterator. Timestamp is in
+// fractional seconds since the epoch, for AT_TIMESTAMP.
+type GetShardIteratorRequest struct {
+	ShardID                string   `json:"ShardId"`
+	ShardIteratorType      string   `json:"ShardIteratorType"`
+	StartingSequenceNumber string   `json:"StartingSequenceNumber"`
+	StreamARN              string   `json:"StreamARN"`
+	StreamName             string   `json:"StreamName"`
+	Timestamp              *float64 `json:"Timestamp"`
+}
+
+// GetShardIteratorResult is the result of GetShardIterator.
+type GetShardIteratorResult struct {
+	ShardIterator string `json:"ShardIterator"`
+}
+
+// GetRecordsRequest is a request to GetRecords.
+type GetRecordsRequest struct {
+	Limit         int    `json:"Limit"`
+	ShardIterator string `json:"ShardIterator"`
+	StreamARN     string `json:"StreamARN"`
+}
+
+// GetRecordsResult is the result of GetRecords. NextShardIterator is unset
+// once a closed shard has been read to its end, and ChildShards says where to
+// carry on.
+type GetRecordsResult struct {
+	ChildShards        []ChildShard `json:"ChildShards,omitempty"`
+	MillisBehindLatest int64        `json:"MillisBehindLatest"`
+	NextShardIterator  *string      `json:"NextShardIterator"`
+	Records            []Record     `json:"Records"`
+}
+
+//
+// API shapes for encryption.
+//
+
+// StartStreamEncryptionRequest is a request to StartStreamEncryption.
+type StartStreamEncryptionRequest struct {
+	EncryptionType string `json:"EncryptionType"`
+	KeyID          string `json:"KeyId"`
+	StreamARN      string `json:"StreamARN"`
+	StreamName     string `json:"StreamName"`
+}
+
+// StartStreamEncryptionResult is the result of StartStreamEncryption.
+type StartStreamEncryptionResult struct{}
+
+// StopStreamEncryptionRequest is a request to StopStreamEncryption.
+type StopStreamEncryptionRequest struct {
+	EncryptionType string `json:"EncryptionType"`
+	KeyID          string `json:"KeyId"`
+	StreamARN      string `json:"StreamARN"`
+	StreamName     string `json:"StreamName"`
+}
+
+// StopStreamEncryptionResult is the result of StopStreamEncryption.
+type StopStreamEncryptionResult struct{}
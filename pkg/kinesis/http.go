@@ -0,0 +1,149 @@
+package kinesis
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/fernomac/aws-local/pkg/awsjson11"
+	"github.com/fernomac/aws-local/pkg/common"
+)
+
+// NewHandler creates a new HTTP handler, notifying the given observers of
+// every call.
+func NewHandler(kinesis Kinesis, observers ...common.Observer) http.Handler {
+	rval := awsjson11.NewHandler("Kinesis_20131202")
+	rval.SetEventSource("kinesis.amazonaws.com")
+	for _, o := range observers {
+		rval.ObserveWith(o)
+	}
+
+	//
+	// Streams.
+	//
+
+	rval.HandleWith("CreateStream", func(body []byte) (interface{}, error) {
+		req := CreateStreamRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return kinesis.CreateStream(&req)
+	})
+
+	rval.HandleWith("DeleteStream", func(body []byte) (interface{}, error) {
+		req := DeleteStreamRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return kinesis.DeleteStream(&req)
+	})
+
+	rval.HandleWith("DescribeStream", func(body []byte) (interface{}, error) {
+		req := DescribeStreamRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return kinesis.DescribeStream(&req)
+	})
+
+	rval.HandleWith("DescribeStreamSummary", func(body []byte) (interface{}, error) {
+		req := DescribeStreamSummaryRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return kinesis.DescribeStreamSummary(&req)
+	})
+
+	rval.HandleWith("ListStreams", func(body []byte) (interface{}, error) {
+		req := ListStreamsRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return kinesis.ListStreams(&req)
+	})
+
+	//
+	// Shards.
+	//
+
+	rval.HandleWith("ListShards", func(body []byte) (interface{}, error) {
+		req := ListShardsRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return kinesis.ListShards(&req)
+	})
+
+	rval.HandleWith("SplitShard", func(body []byte) (interface{}, error) {
+		req := SplitShardRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return kinesis.SplitShard(&req)
+	})
+
+	rval.HandleWith("MergeShards", func(body []byte) (interface{}, error) {
+		req := MergeShardsRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return kinesis.MergeShards(&req)
+	})
+
+	//
+	// Records.
+	//
+
+	rval.HandleWith("PutRecord", func(body []byte) (interface{}, error) {
+		req := PutRecordRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return kinesis.PutRecord(&req)
+	})
+
+	rval.HandleWith("PutRecords", func(body []byte) (interface{}, error) {
+		req := PutRecordsRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return kinesis.PutRecords(&req)
+	})
+
+	rval.HandleWith("GetShardIterator", func(body []byte) (interface{}, error) {
+		req := GetShardIteratorRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return kinesis.GetShardIterator(&req)
+	})
+
+	rval.HandleWith("GetRecords", func(body []byte) (interface{}, error) {
+		req := GetRecordsRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return kinesis.GetRecords(&req)
+	})
+
+	//
+	// Encryption.
+	//
+
+	rval.HandleWith("StartStreamEncryption", func(body []byte) (interface{}, error) {
+		req := StartStreamEncryptionRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return kinesis.StartStreamEncryption(&req)
+	})
+
+	rval.HandleWith("StopStreamEncryption", func(body []byte) (interface{}, error) {
+		req := StopStreamEncryptionRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return kinesis.StopStreamEncryption(&req)
+	})
+
+	return rval
+}
@@ -0,0 +1,1015 @@
+package kinesis
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"fmt"
+	"math"
+	"math/big"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fernomac/aws-local/pkg/common"
+	"github.com/fernomac/aws-local/pkg/kms"
+)
+
+// Limits.
+const (
+	defaultRetention  = 24 * time.Hour
+	iteratorLifetime  = 5 * time.Minute
+	maxShards         = 500
+	onDemandShards    = 4
+	maxRecordSize     = 1 << 20
+	maxPutRecords     = 500
+	maxPutRecordsSize = 5 << 20
+	maxGetRecords     = 10000
+	maxGetRecordsSize = 10 << 20
+)
+
+var (
+	streamNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_.\-]{1,128}$`)
+
+	// maxHashKey is the largest hash key, 2^128-1.
+	maxHashKey = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 128), big.NewInt(1))
+)
+
+func invalid(format string, v ...interface{}) error {
+	return common.Errorf("InvalidArgumentException", format, v...)
+}
+
+func streamArn(name string) string {
+	return fmt.Sprintf("arn:aws:kinesis:%v:%v:stream/%v", common.Region, common.AccountID, name)
+}
+
+func sequenceNumber(n uint64) string {
+	return fmt.Sprintf("%056d", n)
+}
+
+func parseSequenceNumber(s string) (uint64, error) {
+	n, err := strconv.ParseUint(s, 10, 64)
+	if err != nil || len(s) > 128 {
+		return 0, invalid("StartingSequenceNumber %v is invalid.", s)
+	}
+	return n, nil
+}
+
+func timestamp(t time.Time) float64 {
+	return float64(t.UnixNano()/int64(time.Millisecond)) / 1000
+}
+
+// record is a data record in a shard.
+type record struct {
+	seq            uint64
+	arrival        time.Time
+	partitionKey   string
+	data           []byte
+	encryptionType string
+}
+
+func (r *record) describe() Record {
+	return Record{
+		ApproximateArrivalTimestamp: timestamp(r.arrival),
+		Data:                        r.data,
+		EncryptionType:              r.encryptionType,
+		PartitionKey:                r.partitionKey,
+		SequenceNumber:              sequenceNumber(r.seq),
+	}
+}
+
+// shard is a shard of a stream. Its records are in sequence number order.
+// Once closed by a split or merge it takes no more records, and it goes away
+// once its records would all have expired.
+type shard struct {
+	id       string
+	start    *big.Int
+	end      *big.Int
+	parent   string
+	adjacent string
+	startSeq uint64
+	endSeq   uint64
+	closed   time.Time
+	records  []record
+}
+
+func (s *shard) open() bool {
+	return s.closed.IsZero()
+}
+
+func (s *shard) owns(hash *big.Int) bool {
+	return s.start.Cmp(hash) <= 0 && hash.Cmp(s.end) <= 0
+}
+
+func (s *shard) hashKeyRange() HashKeyRange {
+	return HashKeyRange{
+		StartingHashKey: s.start.String(),
+		EndingHashKey:   s.end.String(),
+	}
+}
+
+func (s *shard) describe() Shard {
+	out := Shard{
+		AdjacentParentShardID: s.adjacent,
+		HashKeyRange:          s.hashKeyRange(),
+		ParentShardID:         s.parent,
+		SequenceNumberRange: SequenceNumberRange{
+			StartingSequenceNumber: sequenceNumber(s.startSeq),
+		},
+		ShardID: s.id,
+	}
+	if !s.open() {
+		out.SequenceNumberRange.EndingSequenceNumber = sequenceNumber(s.endSeq)
+	}
+	return out
+}
+
+// position returns the index of the first record at or after a sequence
+// number.
+func (s *shard) position(seq uint64) int {
+	return sort.Search(len(s.records), func(i int) bool {
+		return s.records[i].seq >= seq
+	})
+}
+
+// stream is a single stream. Its generation tells its iterators apart from
+// those of an earlier stream of the same name.
+type stream struct {
+	name       string
+	generation int64
+	mode       string
+	created    time.Time
+	retention  time.Duration
+	keyID      string
+	shards     []*shard
+	nextShard  int
+	seq        uint64
+}
+
+func (s *stream) encryptionType() string {
+	if s.keyID == "" {
+		return EncryptionTypeNone
+	}
+	return EncryptionTypeKMS
+}
+
+// newShard adds a shard owning the given hash keys.
+func (s *stream) newShard(start *big.Int, end *big.Int, parent string, adjacent string) *shard {
+	s.seq++
+	sh := &shard{
+		id:       fmt.Sprintf("shardId-%012d", s.nextShard),
+		start:    start,
+		end:      end,
+		parent:   parent,
+		adjacent: adjacent,
+		startSeq: s.seq,
+	}
+	s.nextShard++
+	s.shards = append(s.shards, sh)
+	return sh
+}
+
+// close closes a shard to new records.
+func (s *stream) close(sh *shard, now time.Time) {
+	sh.closed = now
+	sh.endSeq = s.seq
+}
+
+func (s *stream) shard(id string) (*shard, error) {
+	for _, sh := range s.shards {
+		if sh.id == id {
+			return sh, nil
+		}
+	}
+	return nil, common.Errorf("ResourceNotFoundException", "Could not find shard %v in stream %v under account %v.", id, s.name, common.AccountID)
+}
+
+// trim drops records past the retention period, and closed shards that have
+// no records left to read.
+func (s *stream) trim(now time.Time) {
+	cutoff := now.Add(-s.retention)
+	shards := s.shards[:0]
+	for _, sh := range s.shards {
+		i := sort.Search(len(sh.records), func(i int) bool {
+			return !sh.records[i].arrival.Before(cutoff)
+		})
+		sh.records = sh.records[i:]
+		if sh.open() || sh.closed.After(cutoff) {
+			shards = append(shards, sh)
+		}
+	}
+	s.shards = shards
+}
+
+func (s *stream) openShards() int {
+	n := 0
+	for _, sh := range s.shards {
+		if sh.open() {
+			n++
+		}
+	}
+	return n
+}
+
+// Option configures a Kinesis object.
+type Option func(*kinesis)
+
+// WithClock sets the clock that stamps records, expires shard iterators and
+// trims records past their stream's retention period.
+func WithClock(clock common.Clock) Option {
+	return func(k *kinesis) {
+		k.clock = clock
+	}
+}
+
+// kinesis is the stream store. Its lock guards everything, including calls out
+// to KMS.
+type kinesis struct {
+	lock        sync.Mutex
+	kms         kms.KMS
+	clock       common.Clock
+	streams     map[string]*stream
+	generations int64
+}
+
+// New creates a new stream store that encrypts streams under keys from the
+// given KMS.
+func New(kms kms.KMS, opts ...Option) Kinesis {
+	rval := &kinesis{
+		kms:     kms,
+		clock:   common.SystemClock,
+		streams: make(map[string]*stream),
+	}
+	for _, opt := range opts {
+		opt(rval)
+	}
+	return rval
+}
+
+// find looks up a stream by name or ARN, trimming expired records. The caller
+// must hold k.lock.
+func (k *kinesis) find(name string, arn string) (*stream, error) {
+	if arn != "" {
+		prefix := streamArn("")
+		if !strings.HasPrefix(arn, prefix) {
+			return nil, invalid("StreamARN %v is invalid.", arn)
+		}
+		if name != "" && name != arn[len(prefix):] {
+			return nil, invalid("StreamName %v does not match StreamARN %v.", name, arn)
+		}
+		name = arn[len(prefix):]
+	}
+	if name == "" {
+		return nil, invalid("Either StreamName or StreamARN should be provided.")
+	}
+
+	s, ok := k.streams[name]
+	if !ok {
+		return nil, common.Errorf("ResourceNotFoundException", "Stream %v under account %v not found.", name, common.AccountID)
+	}
+	s.trim(k.clock.Now())
+	return s, nil
+}
+
+// checkKey checks that a key can encrypt stream data. The caller must hold
+// k.lock.
+func (k *kinesis) checkKey(keyID string) error {
+	out, err := k.kms.DescribeKey(&kms.DescribeKeyRequest{KeyID: keyID})
+	if err != nil {
+		return common.Errorf("KMSNotFoundException", "Key %v was not found: %v", keyID, err.Error())
+	}
+	md := out.KeyMetadata
+	switch {
+	case md.KeyState == kms.KeyStateDisabled:
+		return common.Errorf("KMSDisabledException", "Key %v is disabled.", keyID)
+	case md.KeyState != kms.KeyStateEnabled:
+		return common.Errorf("KMSInvalidStateException", "Key %v is in state %v.", keyID, md.KeyState)
+	case md.KeyUsage != "ENCRYPT_DECRYPT" || md.KeySpec != "SYMMETRIC_DEFAULT":
+		return invalid("Key %v is not a symmetric encryption key.", keyID)
+	}
+	return nil
+}
+
+// accessible checks that an encrypted stream's key can still be used. The
+// caller must hold k.lock.
+func (k *kinesis) accessible(s *stream) error {
+	if s.keyID == "" {
+		return nil
+	}
+	return k.checkKey(s.keyID)
+}
+
+// page reads a limit, which defaults to def, and returns the bounds of a page
+// of n things starting at offset.
+func page(limit int, def int, max int, offset int, n int) (int, int, error) {
+	if limit == 0 {
+		limit = def
+	}
+	if limit < 1 || limit > max {
+		return 0, 0, invalid("Limit %v must be between 1 and %v.", limit, max)
+	}
+	if offset > n {
+		offset = n
+	}
+	end := offset + limit
+	if end > n {
+		end = n
+	}
+	return offset, end, nil
+}
+
+//
+// Streams.
+//
+
+func (k *kinesis) CreateStream(req *CreateStreamRequest) (*CreateStreamResult, error) {
+	if !streamNamePattern.MatchString(req.StreamName) {
+		return nil, invalid("StreamName %v must match pattern [a-zA-Z0-9_.-]+ and be at most 128 characters.", req.StreamName)
+	}
+
+	mode := "PROVISIONED"
+	if req.StreamModeDetails != nil {
+		mode = req.StreamModeDetails.StreamMode
+	}
+	count := 0
+	switch mode {
+	case "PROVISIONED":
+		if req.ShardCount == nil {
+			return nil, invalid("ShardCount is required for a PROVISIONED stream.")
+		}
+		count = *req.ShardCount
+	case "ON_DEMAND":
+		if req.ShardCount != nil {
+			return nil, invalid("ShardCount cannot be given for an ON_DEMAND stream.")
+		}
+		count = onDemandShards
+	default:
+		return nil, invalid("StreamMode %v is invalid.", mode)
+	}
+	if count < 1 || count > maxShards {
+		return nil, common.Errorf("LimitExceededException", "ShardCount %v must be between 1 and %v.", count, maxShards)
+	}
+
+	k.lock.Lock()
+	defer k.lock.Unlock()
+
+	if _, ok := k.streams[req.StreamName]; ok {
+		return nil, common.Errorf("ResourceInUseException", "Stream %v under account %v already exists.", req.StreamName, common.AccountID)
+	}
+
+	k.generations++
+	s := &stream{
+		name:       req.StreamName,
+		generation: k.generations,
+		mode:       mode,
+		created:    k.clock.Now(),
+		retention:  defaultRetention,
+	}
+
+	// Split the hash keys evenly, giving any remainder to the last shard.
+	width := new(big.Int).Add(maxHashKey, big.NewInt(1))
+	width.Div(width, big.NewInt(int64(count)))
+	for i := 0; i < count; i++ {
+		start := new(big.Int).Mul(width, big.NewInt(int64(i)))
+		end := new(big.Int).Sub(new(big.Int).Add(start, width), big.NewInt(1))
+		if i == count-1 {
+			end = maxHashKey
+		}
+		s.newShard(start, end, "", "")
+	}
+
+	k.streams[s.name] = s
+	return &CreateStreamResult{}, nil
+}
+
+func (k *kinesis) DeleteStream(req *DeleteStreamRequest) (*DeleteStreamResult, error) {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+
+	s, err := k.find(req.StreamName, req.StreamARN)
+	if err != nil {
+		return nil, err
+	}
+	delete(k.streams, s.name)
+	return &DeleteStreamResult{}, nil
+}
+
+func (k *kinesis) DescribeStream(req *DescribeStreamRequest) (*DescribeStreamResult, error) {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+
+	s, err := k.find(req.StreamName, req.StreamARN)
+	if err != nil {
+		return nil, err
+	}
+
+	offset := 0
+	if req.ExclusiveStartShardID != "" {
+		for i, sh := range s.shards {
+			if sh.id == req.ExclusiveStartShardID {
+				offset = i + 1
+			}
+		}
+	}
+	start, end, err := page(req.Limit, 100, 10000, offset, len(s.shards))
+	if err != nil {
+		return nil, err
+	}
+
+	out := &DescribeStreamResult{
+		StreamDescription: StreamDescription{
+			EncryptionType:          s.encryptionType(),
+			EnhancedMonitoring:      []EnhancedMetrics{{ShardLevelMetrics: []string{}}},
+			HasMoreShards:           end < len(s.shards),
+			KeyID:                   s.keyID,
+			RetentionPeriodHours:    int(s.retention / time.Hour),
+			Shards:                  []Shard{},
+			StreamARN:               streamArn(s.name),
+			StreamCreationTimestamp: s.created.Unix(),
+			StreamModeDetails:       StreamModeDetails{StreamMode: s.mode},
+			StreamName:              s.name,
+			StreamStatus:            StreamStatusActive,
+		},
+	}
+	for _, sh := range s.shards[start:end] {
+		out.StreamDescription.Shards = append(out.StreamDescription.Shards, sh.describe())
+	}
+	return out, nil
+}
+
+func (k *kinesis) DescribeStreamSummary(req *DescribeStreamSummaryRequest) (*DescribeStreamSummaryResult, error) {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+
+	s, err := k.find(req.StreamName, req.StreamARN)
+	if err != nil {
+		return nil, err
+	}
+	return &DescribeStreamSummaryResult{
+		StreamDescriptionSummary: StreamDescriptionSummary{
+			EncryptionType:          s.encryptionType(),
+			EnhancedMonitoring:      []EnhancedMetrics{{ShardLevelMetrics: []string{}}},
+			KeyID:                   s.keyID,
+			OpenShardCount:          s.openShards(),
+			RetentionPeriodHours:    int(s.retention / time.Hour),
+			StreamARN:               streamArn(s.name),
+			StreamCreationTimestamp: s.created.Unix(),
+			StreamModeDetails:       StreamModeDetails{StreamMode: s.mode},
+			StreamName:              s.name,
+			StreamStatus:            StreamStatusActive,
+		},
+	}, nil
+}
+
+func (k *kinesis) ListStreams(req *ListStreamsRequest) (*ListStreamsResult, error) {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+
+	names := []string{}
+	for name := range k.streams {
+		if name > req.ExclusiveStartStreamName {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	offset := 0
+	if req.NextToken != "" {
+		raw, err := base64.RawURLEncoding.DecodeString(req.NextToken)
+		if err != nil {
+			return nil, invalid("NextToken is invalid.")
+		}
+		if offset, err = strconv.Atoi(string(raw)); err != nil || offset < 0 {
+			return nil, invalid("NextToken is invalid.")
+		}
+	}
+	start, end, err := page(req.Limit, 100, 10000, offset, len(names))
+	if err != nil {
+		return nil, err
+	}
+
+	out := &ListStreamsResult{
+		HasMoreStreams:  end < len(names),
+		StreamNames:     names[start:end],
+		StreamSummaries: []StreamSummary{},
+	}
+	if out.HasMoreStreams {
+		out.NextToken = base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(end)))
+	}
+	for _, name := range out.StreamNames {
+		s := k.streams[name]
+		out.StreamSummaries = append(out.StreamSummaries, StreamSummary{
+			StreamARN:               streamArn(s.name),
+			StreamCreationTimestamp: s.created.Unix(),
+			StreamModeDetails:       StreamModeDetails{StreamMode: s.mode},
+			StreamName:              s.name,
+			StreamStatus:            StreamStatusActive,
+		})
+	}
+	return out, nil
+}
+
+//
+// Shards.
+//
+
+// ListShards pages through a stream's shards. Its tokens are the stream name
+// and the offset of the next shard.
+func (k *kinesis) ListShards(req *ListShardsRequest) (*ListShardsResult, error) {
+	name := req.StreamName
+	offset := 0
+	if req.NextToken != "" {
+		if req.StreamName != "" || req.StreamARN != "" || req.ExclusiveStartShardID != "" {
+			return nil, invalid("NextToken and StreamName, StreamARN or ExclusiveStartShardId cannot be provided together.")
+		}
+		raw, err := base64.RawURLEncoding.DecodeString(req.NextToken)
+		if err != nil {
+			return nil, invalid("NextToken is invalid.")
+		}
+		parts := strings.SplitN(string(raw), "/", 2)
+		if len(parts) != 2 {
+			return nil, invalid("NextToken is invalid.")
+		}
+		if offset, err = strconv.Atoi(parts[1]); err != nil || offset < 0 {
+			return nil, invalid("NextToken is invalid.")
+		}
+		name = parts[0]
+	}
+
+	k.lock.Lock()
+	defer k.lock.Unlock()
+
+	s, err := k.find(name, req.StreamARN)
+	if err != nil {
+		return nil, err
+	}
+	if req.ExclusiveStartShardID != "" {
+		for i, sh := range s.shards {
+			if sh.id == req.ExclusiveStartShardID {
+				offset = i + 1
+			}
+		}
+	}
+	start, end, err := page(req.MaxResults, 1000, 10000, offset, len(s.shards))
+	if err != nil {
+		return nil, err
+	}
+
+	out := &ListShardsResult{Shards: []Shard{}}
+	for _, sh := range s.shards[start:end] {
+		out.Shards = append(out.Shards, sh.describe())
+	}
+	if end < len(s.shards) {
+		out.NextToken = base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%v/%v", s.name, end)))
+	}
+	return out, nil
+}
+
+// splittable looks up an open shard to split or merge.
+func splittable(s *stream, id string) (*shard, error) {
+	sh, err := s.shard(id)
+	if err != nil {
+		return nil, err
+	}
+	if !sh.open() {
+		return nil, invalid("Shard %v in stream %v under account %v has already been merged or split, and thus is not eligible for merging or splitting.", id, s.name, common.AccountID)
+	}
+	return sh, nil
+}
+
+func (k *kinesis) SplitShard(req *SplitShardRequest) (*SplitShardResult, error) {
+	key, ok := new(big.Int).SetString(req.NewStartingHashKey, 10)
+	if !ok {
+		return nil, invalid("NewStartingHashKey %v is not a valid hash key.", req.NewStartingHashKey)
+	}
+
+	k.lock.Lock()
+	defer k.lock.Unlock()
+
+	s, err := k.find(req.StreamName, req.StreamARN)
+	if err != nil {
+		return nil, err
+	}
+	sh, err := splittable(s, req.ShardToSplit)
+	if err != nil {
+		return nil, err
+	}
+	if key.Cmp(sh.start) <= 0 || key.Cmp(sh.end) > 0 {
+		return nil, invalid("NewStartingHashKey %v is not within the hash key range of shard %v, excluding its first key.", key, sh.id)
+	}
+	if s.openShards() >= maxShards {
+		return nil, common.Errorf("LimitExceededException", "Stream %v under account %v would exceed the limit of %v open shards.", s.name, common.AccountID, maxShards)
+	}
+
+	k.close(s, sh)
+	s.newShard(sh.start, new(big.Int).Sub(key, big.NewInt(1)), sh.id, "")
+	s.newShard(key, sh.end, sh.id, "")
+	return &SplitShardResult{}, nil
+}
+
+func (k *kinesis) MergeShards(req *MergeShardsRequest) (*MergeShardsResult, error) {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+
+	s, err := k.find(req.StreamName, req.StreamARN)
+	if err != nil {
+		return nil, err
+	}
+	a, err := splittable(s, req.ShardToMerge)
+	if err != nil {
+		return nil, err
+	}
+	b, err := splittable(s, req.AdjacentShardToMerge)
+	if err != nil {
+		return nil, err
+	}
+
+	lo, hi := a, b
+	if hi.start.Cmp(lo.start) < 0 {
+		lo, hi = hi, lo
+	}
+	if a == b || new(big.Int).Add(lo.end, big.NewInt(1)).Cmp(hi.start) != 0 {
+		return nil, invalid("Shards %v and %v in stream %v under account %v are not an adjacent pair of shards eligible for merging.", a.id, b.id, s.name, common.AccountID)
+	}
+
+	k.close(s, a)
+	k.close(s, b)
+	s.newShard(lo.start, hi.end, a.id, b.id)
+	return &MergeShardsResult{}, nil
+}
+
+func (k *kinesis) close(s *stream, sh *shard) {
+	s.close(sh, k.clock.Now())
+}
+
+//
+// Records.
+//
+
+// hashKey works out the hash key a record goes to: the explicit one if given,
+// otherwise the MD5 of its partition key.
+func hashKey(partitionKey string, explicit string) (*big.Int, error) {
+	if len(partitionKey) < 1 || len(partitionKey) > 256 {
+		return nil, invalid("PartitionKey must be between 1 and 256 characters long.")
+	}
+	if explicit != "" {
+		key, ok := new(big.Int).SetString(explicit, 10)
+		if !ok || key.Sign() < 0 || key.Cmp(maxHashKey) > 0 {
+			return nil, invalid("ExplicitHashKey %v is not a valid hash key.", explicit)
+		}
+		return key, nil
+	}
+	sum := md5.Sum([]byte(partitionKey))
+	return new(big.Int).SetBytes(sum[:]), nil
+}
+
+func checkRecord(data []byte, partitionKey string, explicit string) (*big.Int, error) {
+	key, err := hashKey(partitionKey, explicit)
+	if err != nil {
+		return nil, err
+	}
+	if len(data)+len(partitionKey) > maxRecordSize {
+		return nil, invalid("Record size %v exceeds the limit of %v bytes.", len(data)+len(partitionKey), maxRecordSize)
+	}
+	return key, nil
+}
+
+// put adds a record to the open shard that owns its hash key. The caller must
+// hold k.lock.
+func (k *kinesis) put(s *stream, data []byte, partitionKey string, key *big.Int) (*shard, uint64, error) {
+	for _, sh := range s.shards {
+		if sh.open() && sh.owns(key) {
+			s.seq++
+			sh.records = append(sh.records, record{
+				seq:            s.seq,
+				arrival:        k.clock.Now().Truncate(time.Millisecond),
+				partitionKey:   partitionKey,
+				data:           append([]byte{}, data...),
+				encryptionType: s.encryptionType(),
+			})
+			return sh, s.seq, nil
+		}
+	}
+	return nil, 0, common.Errorf("InternalFailure", "No open shard in stream %v under account %v owns hash key %v.", s.name, common.AccountID, key)
+}
+
+func (k *kinesis) PutRecord(req *PutRecordRequest) (*PutRecordResult, error) {
+	key, err := checkRecord(req.Data, req.PartitionKey, req.ExplicitHashKey)
+	if err != nil {
+		return nil, err
+	}
+	if req.SequenceNumberForOrdering != "" {
+		if _, err := parseSequenceNumber(req.SequenceNumberForOrdering); err != nil {
+			return nil, err
+		}
+	}
+
+	k.lock.Lock()
+	defer k.lock.Unlock()
+
+	s, err := k.find(req.StreamName, req.StreamARN)
+	if err != nil {
+		return nil, err
+	}
+	if err := k.accessible(s); err != nil {
+		return nil, err
+	}
+
+	sh, seq, err := k.put(s, req.Data, req.PartitionKey, key)
+	if err != nil {
+		return nil, err
+	}
+	return &PutRecordResult{
+		EncryptionType: s.encryptionType(),
+		SequenceNumber: sequenceNumber(seq),
+		ShardID:        sh.id,
+	}, nil
+}
+
+// PutRecords puts a batch of records. An invalid record fails the whole call;
+// a stream key that can't be used fails each record.
+func (k *kinesis) PutRecords(req *PutRecordsRequest) (*PutRecordsResult, error) {
+	if len(req.Records) < 1 || len(req.Records) > maxPutRecords {
+		return nil, invalid("Records must have between 1 and %v entries.", maxPutRecords)
+	}
+	keys := []*big.Int{}
+	size := 0
+	for _, r := range req.Records {
+		key, err := checkRecord(r.Data, r.PartitionKey, r.ExplicitHashKey)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+		size += len(r.Data) + len(r.PartitionKey)
+	}
+	if size > maxPutRecordsSize {
+		return nil, invalid("Records size %v exceeds the limit of %v bytes.", size, maxPutRecordsSize)
+	}
+
+	k.lock.Lock()
+	defer k.lock.Unlock()
+
+	s, err := k.find(req.StreamName, req.StreamARN)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &PutRecordsResult{
+		EncryptionType: s.encryptionType(),
+		Records:        []PutRecordsResultEntry{},
+	}
+	if err := k.accessible(s); err != nil {
+		e := err.(common.Error)
+		for range req.Records {
+			out.Records = append(out.Records, PutRecordsResultEntry{ErrorCode: e.Code, ErrorMessage: e.Message})
+		}
+		out.FailedRecordCount = len(req.Records)
+		return out, nil
+	}
+
+	for i, r := range req.Records {
+		sh, seq, err := k.put(s, r.Data, r.PartitionKey, keys[i])
+		if err != nil {
+			e := err.(common.Error)
+			out.Records = append(out.Records, PutRecordsResultEntry{ErrorCode: e.Code, ErrorMessage: e.Message})
+			out.FailedRecordCount++
+			continue
+		}
+		out.Records = append(out.Records, PutRecordsResultEntry{
+			SequenceNumber: sequenceNumber(seq),
+			ShardID:        sh.id,
+		})
+	}
+	return out, nil
+}
+
+// iterator is a position in a shard: the next record read is the first at or
+// after seq.
+type iterator struct {
+	stream     string
+	generation int64
+	shard      string
+	seq        uint64
+	expires    time.Time
+}
+
+func (it *iterator) encode() string {
+	raw := fmt.Sprintf("%v|%v|%v|%v|%v", it.stream, it.generation, it.shard, it.seq, it.expires.UnixNano())
+	return base64.StdEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeIterator(token string) (*iterator, error) {
+	bad := invalid("ShardIterator %v is invalid.", token)
+
+	raw, err := base64.StdEncoding.DecodeString(token)
+	if err != nil {
+		return nil, bad
+	}
+	parts := strings.Split(string(raw), "|")
+	if len(parts) != 5 {
+		return nil, bad
+	}
+	generation, err1 := strconv.ParseInt(parts[1], 10, 64)
+	seq, err2 := strconv.ParseUint(parts[3], 10, 64)
+	expires, err3 := strconv.ParseInt(parts[4], 10, 64)
+	if err1 != nil || err2 != nil || err3 != nil {
+		return nil, bad
+	}
+	return &iterator{
+		stream:     parts[0],
+		generation: generation,
+		shard:      parts[2],
+		seq:        seq,
+		expires:    time.Unix(0, expires),
+	}, nil
+}
+
+func (k *kinesis) GetShardIterator(req *GetShardIteratorRequest) (*GetShardIteratorResult, error) {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+
+	s, err := k.find(req.StreamName, req.StreamARN)
+	if err != nil {
+		return nil, err
+	}
+	sh, err := s.shard(req.ShardID)
+	if err != nil {
+		return nil, err
+	}
+
+	it := &iterator{
+		stream:     s.name,
+		generation: s.generation,
+		shard:      sh.id,
+		expires:    k.clock.Now().Add(iteratorLifetime),
+	}
+	switch req.ShardIteratorType {
+	case IteratorTrimHorizon:
+		it.seq = sh.startSeq
+		if len(sh.records) > 0 {
+			it.seq = sh.records[0].seq
+		}
+
+	case IteratorLatest:
+		it.seq = s.seq + 1
+		if !sh.open() {
+			it.seq = sh.endSeq + 1
+		}
+
+	case IteratorAtSequenceNumber, IteratorAfterSequenceNumber:
+		seq, err := parseSequenceNumber(req.StartingSequenceNumber)
+		if err != nil {
+			return nil, err
+		}
+		if seq < sh.startSeq || !sh.open() && seq > sh.endSeq {
+			return nil, invalid("StartingSequenceNumber %v used in GetShardIterator on shard %v in stream %v under account %v is invalid because it did not come from this shard.", req.StartingSequenceNumber, sh.id, s.name, common.AccountID)
+		}
+		it.seq = seq
+		if req.ShardIteratorType == IteratorAfterSequenceNumber {
+			it.seq++
+		}
+
+	case IteratorAtTimestamp:
+		if req.Timestamp == nil {
+			return nil, invalid("Timestamp is required for AT_TIMESTAMP.")
+		}
+		at := time.Unix(0, int64(math.Round(*req.Timestamp*1000))*int64(time.Millisecond))
+		i := sort.Search(len(sh.records), func(i int) bool {
+			return !sh.records[i].arrival.Before(at)
+		})
+		it.seq = s.seq + 1
+		if !sh.open() {
+			it.seq = sh.endSeq + 1
+		}
+		if i < len(sh.records) {
+			it.seq = sh.records[i].seq
+		}
+
+	default:
+		return nil, invalid("ShardIteratorType %v is invalid.", req.ShardIteratorType)
+	}
+
+	return &GetShardIteratorResult{ShardIterator: it.encode()}, nil
+}
+
+// GetRecords reads from a shard. Reading a closed shard to its end returns no
+// next iterator, and names the shards that took over from it.
+func (k *kinesis) GetRecords(req *GetRecordsRequest) (*GetRecordsResult, error) {
+	limit := req.Limit
+	if limit == 0 {
+		limit = maxGetRecords
+	}
+	if limit < 1 || limit > maxGetRecords {
+		return nil, invalid("Limit %v must be between 1 and %v.", req.Limit, maxGetRecords)
+	}
+	it, err := decodeIterator(req.ShardIterator)
+	if err != nil {
+		return nil, err
+	}
+
+	k.lock.Lock()
+	defer k.lock.Unlock()
+
+	now := k.clock.Now()
+	if now.After(it.expires) {
+		return nil, common.Errorf("ExpiredIteratorException", "Iterator expired. The iterator was created at time %v while right now it is %v which is further in the future than the tolerated delay of %v milliseconds.", it.expires.Add(-iteratorLifetime).Format(time.RFC1123), now.Format(time.RFC1123), int64(iteratorLifetime/time.Millisecond))
+	}
+	s, err := k.find(it.stream, req.StreamARN)
+	if err != nil {
+		return nil, err
+	}
+	if s.generation != it.generation {
+		return nil, common.Errorf("ResourceNotFoundException", "Stream %v under account %v not found.", s.name, common.AccountID)
+	}
+	sh, err := s.shard(it.shard)
+	if err != nil {
+		return nil, err
+	}
+	if err := k.accessible(s); err != nil {
+		return nil, err
+	}
+
+	out := &GetRecordsResult{Records: []Record{}}
+	i := sh.position(it.seq)
+	size := 0
+	for ; i < len(sh.records) && len(out.Records) < limit; i++ {
+		r := &sh.records[i]
+		if size += len(r.data) + len(r.partitionKey); size > maxGetRecordsSize && len(out.Records) > 0 {
+			break
+		}
+		out.Records = append(out.Records, r.describe())
+		it.seq = r.seq + 1
+	}
+	if i < len(sh.records) {
+		out.MillisBehindLatest = int64(now.Sub(sh.records[i].arrival) / time.Millisecond)
+	}
+
+	if i == len(sh.records) && !sh.open() {
+		for _, child := range s.shards {
+			if child.parent == sh.id || child.adjacent == sh.id {
+				parents := []string{child.parent}
+				if child.adjacent != "" {
+					parents = append(parents, child.adjacent)
+				}
+				out.ChildShards = append(out.ChildShards, ChildShard{
+					HashKeyRange: child.hashKeyRange(),
+					ParentShards: parents,
+					ShardID:      child.id,
+				})
+			}
+		}
+		return out, nil
+	}
+
+	it.expires = now.Add(iteratorLifetime)
+	next := it.encode()
+	out.NextShardIterator = &next
+	return out, nil
+}
+
+//
+// Encryption.
+//
+
+func (k *kinesis) StartStreamEncryption(req *StartStreamEncryptionRequest) (*StartStreamEncryptionResult, error) {
+	if req.EncryptionType != EncryptionTypeKMS {
+		return nil, invalid("EncryptionType %v is invalid; it must be KMS.", req.EncryptionType)
+	}
+	if req.KeyID == "" {
+		return nil, invalid("KeyId is required.")
+	}
+
+	k.lock.Lock()
+	defer k.lock.Unlock()
+
+	s, err := k.find(req.StreamName, req.StreamARN)
+	if err != nil {
+		return nil, err
+	}
+	if err := k.checkKey(req.KeyID); err != nil {
+		return nil, err
+	}
+	s.keyID = req.KeyID
+	return &StartStreamEncryptionResult{}, nil
+}
+
+func (k *kinesis) StopStreamEncryption(req *StopStreamEncryptionRequest) (*StopStreamEncryptionResult, error) {
+	if req.EncryptionType != EncryptionTypeKMS {
+		return nil, invalid("EncryptionType %v is invalid; it must be KMS.", req.EncryptionType)
+	}
+
+	k.lock.Lock()
+	defer k.lock.Unlock()
+
+	s, err := k.find(req.StreamName, req.StreamARN)
+	if err != nil {
+		return nil, err
+	}
+	if s.keyID == "" || req.KeyID != s.keyID {
+		return nil, invalid("Stream %v under account %v is not encrypted with key %v.", s.name, common.AccountID, req.KeyID)
+	}
+	s.keyID = ""
+	return &StopStreamEncryptionResult{}, nil
+}
@@ -0,0 +1,459 @@
+package kinesis_test
+
+import (
+	"crypto/md5"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/fernomac/aws-local/pkg/common"
+	"github.com/fernomac/aws-local/pkg/kinesis"
+	"github.com/fernomac/aws-local/pkg/kms"
+)
+
+// testClock is a clock the tests move by hand.
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	return c.now
+}
+
+func code(err error) string {
+	if ce, ok := err.(common.Error); ok {
+		return ce.Code
+	}
+	if err != nil {
+		return err.Error()
+	}
+	return ""
+}
+
+func intPtr(n int) *int {
+	return &n
+}
+
+// hashSpace is the number of hash keys, 2^128.
+var hashSpace = new(big.Int).Lsh(big.NewInt(1), 128)
+
+// newTestKinesis creates a stream store with a stream called "s" with the
+// given number of shards.
+func newTestKinesis(t *testing.T, shards int) (kinesis.Kinesis, kms.KMS, *testClock) {
+	clock := &testClock{now: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)}
+	k := kms.New()
+	s := kinesis.New(k, kinesis.WithClock(clock))
+	if _, err := s.CreateStream(&kinesis.CreateStreamRequest{StreamName: "s", ShardCount: intPtr(shards)}); err != nil {
+		t.Fatal(err)
+	}
+	return s, k, clock
+}
+
+func shards(t *testing.T, s kinesis.Kinesis) []kinesis.Shard {
+	out, err := s.ListShards(&kinesis.ListShardsRequest{StreamName: "s"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out.Shards
+}
+
+func put(t *testing.T, s kinesis.Kinesis, partitionKey string, data string) *kinesis.PutRecordResult {
+	out, err := s.PutRecord(&kinesis.PutRecordRequest{StreamName: "s", PartitionKey: partitionKey, Data: []byte(data)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func iterator(t *testing.T, s kinesis.Kinesis, req *kinesis.GetShardIteratorRequest) string {
+	req.StreamName = "s"
+	out, err := s.GetShardIterator(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out.ShardIterator
+}
+
+func read(t *testing.T, s kinesis.Kinesis, it string) ([]string, *kinesis.GetRecordsResult) {
+	out, err := s.GetRecords(&kinesis.GetRecordsRequest{ShardIterator: it})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, r := range out.Records {
+		got = append(got, string(r.Data))
+	}
+	return got, out
+}
+
+func TestHashKeyRanges(t *testing.T) {
+	for _, count := range []int{1, 2, 3, 7, 16} {
+		s, _, _ := newTestKinesis(t, count)
+		width := new(big.Int).Div(hashSpace, big.NewInt(int64(count)))
+		next := big.NewInt(0)
+		for i, sh := range shards(t, s) {
+			start, _ := new(big.Int).SetString(sh.HashKeyRange.StartingHashKey, 10)
+			end, _ := new(big.Int).SetString(sh.HashKeyRange.EndingHashKey, 10)
+			if start.Cmp(next) != 0 {
+				t.Errorf("%v shards: shard %v starts at %v, want %v", count, i, start, next)
+			}
+			size := new(big.Int).Add(new(big.Int).Sub(end, start), big.NewInt(1))
+			if i < count-1 && size.Cmp(width) != 0 {
+				t.Errorf("%v shards: shard %v has %v keys, want %v", count, i, size, width)
+			}
+			next = new(big.Int).Add(end, big.NewInt(1))
+		}
+		if next.Cmp(hashSpace) != 0 {
+			t.Errorf("%v shards: last shard ends at %v", count, next)
+		}
+	}
+}
+
+func TestPartitionKeyHashing(t *testing.T) {
+	s, _, _ := newTestKinesis(t, 4)
+	quarter := new(big.Int).Div(hashSpace, big.NewInt(4))
+	ids := []string{}
+	for _, sh := range shards(t, s) {
+		ids = append(ids, sh.ShardID)
+	}
+
+	for _, key := range []string{"a", "b", "customer-1", "customer-2", "customer-3", "x", "日本"} {
+		sum := md5.Sum([]byte(key))
+		hash := new(big.Int).SetBytes(sum[:])
+		want := ids[new(big.Int).Div(hash, quarter).Int64()]
+		if got := put(t, s, key, "v").ShardID; got != want {
+			t.Errorf("%q: went to %v, want %v", key, got, want)
+		}
+	}
+
+	tests := []struct {
+		explicit string
+		shard    int
+		code     string
+	}{
+		{"0", 0, ""},
+		{new(big.Int).Sub(quarter, big.NewInt(1)).String(), 0, ""},
+		{quarter.String(), 1, ""},
+		{new(big.Int).Sub(hashSpace, big.NewInt(1)).String(), 3, ""},
+		{hashSpace.String(), 0, "InvalidArgumentException"},
+		{"-1", 0, "InvalidArgumentException"},
+		{"ten", 0, "InvalidArgumentException"},
+	}
+	for _, test := range tests {
+		out, err := s.PutRecord(&kinesis.PutRecordRequest{StreamName: "s", PartitionKey: "a", ExplicitHashKey: test.explicit, Data: []byte("v")})
+		if got := code(err); got != test.code {
+			t.Errorf("%v: got %v, want %v", test.explicit, got, test.code)
+			continue
+		}
+		if err == nil && out.ShardID != ids[test.shard] {
+			t.Errorf("%v: went to %v, want %v", test.explicit, out.ShardID, ids[test.shard])
+		}
+	}
+}
+
+func TestIteratorTypes(t *testing.T) {
+	s, _, clock := newTestKinesis(t, 1)
+	shard := shards(t, s)[0].ShardID
+	seqs := []string{}
+	times := []float64{}
+	for _, data := range []string{"one", "two", "three"} {
+		clock.now = clock.now.Add(time.Second)
+		seqs = append(seqs, put(t, s, "k", data).SequenceNumber)
+		times = append(times, float64(clock.now.Unix()))
+	}
+	latest := iterator(t, s, &kinesis.GetShardIteratorRequest{ShardID: shard, ShardIteratorType: kinesis.IteratorLatest})
+	put(t, s, "k", "four")
+
+	at := func(ts float64) *float64 {
+		return &ts
+	}
+	tests := []struct {
+		req  kinesis.GetShardIteratorRequest
+		want []string
+		code string
+	}{
+		{kinesis.GetShardIteratorRequest{ShardIteratorType: kinesis.IteratorTrimHorizon}, []string{"one", "two", "three", "four"}, ""},
+		{kinesis.GetShardIteratorRequest{ShardIteratorType: kinesis.IteratorLatest}, []string{}, ""},
+		{kinesis.GetShardIteratorRequest{ShardIteratorType: kinesis.IteratorAtSequenceNumber, StartingSequenceNumber: seqs[1]}, []string{"two", "three", "four"}, ""},
+		{kinesis.GetShardIteratorRequest{ShardIteratorType: kinesis.IteratorAfterSequenceNumber, StartingSequenceNumber: seqs[1]}, []string{"three", "four"}, ""},
+		{kinesis.GetShardIteratorRequest{ShardIteratorType: kinesis.IteratorAtTimestamp, Timestamp: at(times[1])}, []string{"two", "three", "four"}, ""},
+		{kinesis.GetShardIteratorRequest{ShardIteratorType: kinesis.IteratorAtTimestamp, Timestamp: at(times[0] - 60)}, []string{"one", "two", "three", "four"}, ""},
+		{kinesis.GetShardIteratorRequest{ShardIteratorType: kinesis.IteratorAtTimestamp, Timestamp: at(times[2] + 60)}, []string{}, ""},
+		{kinesis.GetShardIteratorRequest{ShardIteratorType: kinesis.IteratorAtTimestamp}, nil, "InvalidArgumentException"},
+		{kinesis.GetShardIteratorRequest{ShardIteratorType: kinesis.IteratorAtSequenceNumber, StartingSequenceNumber: "x"}, nil, "InvalidArgumentException"},
+		{kinesis.GetShardIteratorRequest{ShardIteratorType: "SOMEWHERE"}, nil, "InvalidArgumentException"},
+	}
+
+	for _, test := range tests {
+		req := test.req
+		req.StreamName = "s"
+		req.ShardID = shard
+		out, err := s.GetShardIterator(&req)
+		if got := code(err); got != test.code {
+			t.Errorf("%v: got %v, want %v", req.ShardIteratorType, got, test.code)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if got, _ := read(t, s, out.ShardIterator); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%v %v: got %v, want %v", req.ShardIteratorType, req.StartingSequenceNumber, got, test.want)
+		}
+	}
+
+	// LATEST reads what comes after it was made.
+	if got, _ := read(t, s, latest); !reflect.DeepEqual(got, []string{"four"}) {
+		t.Errorf("LATEST: got %v, want [four]", got)
+	}
+
+	// Reading follows on from the last record read.
+	it := iterator(t, s, &kinesis.GetShardIteratorRequest{ShardID: shard, ShardIteratorType: kinesis.IteratorTrimHorizon})
+	out, err := s.GetRecords(&kinesis.GetRecordsRequest{ShardIterator: it, Limit: 3})
+	if err != nil || len(out.Records) != 3 {
+		t.Fatalf("got %v, %v", out, err)
+	}
+	if got, _ := read(t, s, *out.NextShardIterator); !reflect.DeepEqual(got, []string{"four"}) {
+		t.Errorf("next page: got %v, want [four]", got)
+	}
+}
+
+func TestIteratorExpiry(t *testing.T) {
+	s, _, clock := newTestKinesis(t, 1)
+	shard := shards(t, s)[0].ShardID
+	req := &kinesis.GetShardIteratorRequest{ShardID: shard, ShardIteratorType: kinesis.IteratorTrimHorizon}
+
+	it := iterator(t, s, req)
+	clock.now = clock.now.Add(5 * time.Minute)
+	_, out := read(t, s, it)
+
+	// Each read's next iterator lasts another five minutes.
+	clock.now = clock.now.Add(5 * time.Minute)
+	read(t, s, *out.NextShardIterator)
+	clock.now = clock.now.Add(time.Millisecond)
+	if _, err := s.GetRecords(&kinesis.GetRecordsRequest{ShardIterator: *out.NextShardIterator}); code(err) != "ExpiredIteratorException" {
+		t.Errorf("got %v, want ExpiredIteratorException", err)
+	}
+
+	// A stream deleted and made again doesn't take the old stream's
+	// iterators.
+	it = iterator(t, s, req)
+	if _, err := s.DeleteStream(&kinesis.DeleteStreamRequest{StreamName: "s"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.CreateStream(&kinesis.CreateStreamRequest{StreamName: "s", ShardCount: intPtr(1)}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetRecords(&kinesis.GetRecordsRequest{ShardIterator: it}); code(err) != "ResourceNotFoundException" {
+		t.Errorf("old generation: got %v, want ResourceNotFoundException", err)
+	}
+
+	if _, err := s.GetRecords(&kinesis.GetRecordsRequest{ShardIterator: "garbage"}); code(err) != "InvalidArgumentException" {
+		t.Errorf("garbage: got %v, want InvalidArgumentException", err)
+	}
+}
+
+func TestSplitAndMerge(t *testing.T) {
+	s, _, _ := newTestKinesis(t, 1)
+	parent := shards(t, s)[0].ShardID
+	put(t, s, "k", "before")
+	half := new(big.Int).Rsh(hashSpace, 1)
+
+	tests := []struct {
+		key  string
+		code string
+	}{
+		{"0", "InvalidArgumentException"},
+		{hashSpace.String(), "InvalidArgumentException"},
+		{"half", "InvalidArgumentException"},
+	}
+	for _, test := range tests {
+		_, err := s.SplitShard(&kinesis.SplitShardRequest{StreamName: "s", ShardToSplit: parent, NewStartingHashKey: test.key})
+		if got := code(err); got != test.code {
+			t.Errorf("split at %v: got %v, want %v", test.key, got, test.code)
+		}
+	}
+	if _, err := s.SplitShard(&kinesis.SplitShardRequest{StreamName: "s", ShardToSplit: parent, NewStartingHashKey: half.String()}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.SplitShard(&kinesis.SplitShardRequest{StreamName: "s", ShardToSplit: parent, NewStartingHashKey: "1"}); code(err) != "InvalidArgumentException" {
+		t.Errorf("splitting a closed shard: got %v", err)
+	}
+
+	all := shards(t, s)
+	if len(all) != 3 || all[0].SequenceNumberRange.EndingSequenceNumber == "" {
+		t.Fatalf("got shards %+v", all)
+	}
+	lo, hi := all[1], all[2]
+	if lo.ParentShardID != parent || hi.ParentShardID != parent ||
+		lo.HashKeyRange.EndingHashKey != new(big.Int).Sub(half, big.NewInt(1)).String() || hi.HashKeyRange.StartingHashKey != half.String() {
+		t.Errorf("got children %+v and %+v", lo, hi)
+	}
+
+	// Reading the closed parent to its end names its children.
+	it := iterator(t, s, &kinesis.GetShardIteratorRequest{ShardID: parent, ShardIteratorType: kinesis.IteratorTrimHorizon})
+	got, out := read(t, s, it)
+	if !reflect.DeepEqual(got, []string{"before"}) || out.NextShardIterator != nil {
+		t.Errorf("parent: got %v and next %v", got, out.NextShardIterator)
+	}
+	children := []kinesis.ChildShard{
+		{HashKeyRange: lo.HashKeyRange, ParentShards: []string{parent}, ShardID: lo.ShardID},
+		{HashKeyRange: hi.HashKeyRange, ParentShards: []string{parent}, ShardID: hi.ShardID},
+	}
+	if !reflect.DeepEqual(out.ChildShards, children) {
+		t.Errorf("got children %+v, want %+v", out.ChildShards, children)
+	}
+
+	// New records go to the children.
+	if sh := put(t, s, "k", "after").ShardID; sh != lo.ShardID && sh != hi.ShardID {
+		t.Errorf("record after split went to %v", sh)
+	}
+
+	if _, err := s.MergeShards(&kinesis.MergeShardsRequest{StreamName: "s", ShardToMerge: lo.ShardID, AdjacentShardToMerge: lo.ShardID}); code(err) != "InvalidArgumentException" {
+		t.Errorf("merging a shard with itself: got %v", err)
+	}
+	if _, err := s.MergeShards(&kinesis.MergeShardsRequest{StreamName: "s", ShardToMerge: hi.ShardID, AdjacentShardToMerge: lo.ShardID}); err != nil {
+		t.Fatal(err)
+	}
+	merged := shards(t, s)[3]
+	if merged.ParentShardID != hi.ShardID || merged.AdjacentParentShardID != lo.ShardID ||
+		merged.HashKeyRange.StartingHashKey != "0" || merged.HashKeyRange.EndingHashKey != new(big.Int).Sub(hashSpace, big.NewInt(1)).String() {
+		t.Errorf("got merged shard %+v", merged)
+	}
+
+	for _, sh := range []string{lo.ShardID, hi.ShardID} {
+		it := iterator(t, s, &kinesis.GetShardIteratorRequest{ShardID: sh, ShardIteratorType: kinesis.IteratorTrimHorizon})
+		_, out := read(t, s, it)
+		want := []kinesis.ChildShard{{HashKeyRange: merged.HashKeyRange, ParentShards: []string{hi.ShardID, lo.ShardID}, ShardID: merged.ShardID}}
+		if out.NextShardIterator != nil || !reflect.DeepEqual(out.ChildShards, want) {
+			t.Errorf("%v: got next %v and children %+v", sh, out.NextShardIterator, out.ChildShards)
+		}
+	}
+
+	// An open shard has no children and always a next iterator.
+	it = iterator(t, s, &kinesis.GetShardIteratorRequest{ShardID: merged.ShardID, ShardIteratorType: kinesis.IteratorTrimHorizon})
+	if _, out := read(t, s, it); out.NextShardIterator == nil || out.ChildShards != nil {
+		t.Errorf("open shard: got next %v and children %+v", out.NextShardIterator, out.ChildShards)
+	}
+}
+
+func TestRetention(t *testing.T) {
+	s, _, clock := newTestKinesis(t, 1)
+	parent := shards(t, s)[0].ShardID
+	put(t, s, "k", "old")
+	clock.now = clock.now.Add(12 * time.Hour)
+	put(t, s, "k", "new")
+
+	horizon := func(shard string) []string {
+		got, _ := read(t, s, iterator(t, s, &kinesis.GetShardIteratorRequest{ShardID: shard, ShardIteratorType: kinesis.IteratorTrimHorizon}))
+		return got
+	}
+	if got := horizon(parent); !reflect.DeepEqual(got, []string{"old", "new"}) {
+		t.Errorf("got %v", got)
+	}
+
+	// A split closes the shard but keeps its records readable.
+	half := new(big.Int).Rsh(hashSpace, 1)
+	if _, err := s.SplitShard(&kinesis.SplitShardRequest{StreamName: "s", ShardToSplit: parent, NewStartingHashKey: half.String()}); err != nil {
+		t.Fatal(err)
+	}
+
+	clock.now = clock.now.Add(12*time.Hour - time.Millisecond)
+	if got := horizon(parent); !reflect.DeepEqual(got, []string{"old", "new"}) {
+		t.Errorf("at the retention period: got %v", got)
+	}
+	clock.now = clock.now.Add(2 * time.Millisecond)
+	if got := horizon(parent); !reflect.DeepEqual(got, []string{"new"}) {
+		t.Errorf("past the retention period: got %v", got)
+	}
+
+	// A closed shard goes once its records would all have expired.
+	clock.now = clock.now.Add(12 * time.Hour)
+	for _, sh := range shards(t, s) {
+		if sh.ShardID == parent {
+			t.Errorf("closed shard %v is still listed", parent)
+		}
+	}
+	if _, err := s.GetShardIterator(&kinesis.GetShardIteratorRequest{StreamName: "s", ShardID: parent, ShardIteratorType: kinesis.IteratorTrimHorizon}); code(err) != "ResourceNotFoundException" {
+		t.Errorf("got %v, want ResourceNotFoundException", err)
+	}
+}
+
+func TestEncryptionKeyStates(t *testing.T) {
+	s, k, _ := newTestKinesis(t, 1)
+	key, err := k.CreateKey(&kms.CreateKeyRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyID := key.KeyMetadata.KeyID
+	disabled, err := k.CreateKey(&kms.CreateKeyRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := k.DisableKey(&kms.DisableKeyRequest{KeyID: disabled.KeyMetadata.KeyID}); err != nil {
+		t.Fatal(err)
+	}
+	pending, err := k.CreateKey(&kms.CreateKeyRequest{Origin: "EXTERNAL"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		keyID string
+		code  string
+	}{
+		{"alias/missing", "KMSNotFoundException"},
+		{disabled.KeyMetadata.KeyID, "KMSDisabledException"},
+		{pending.KeyMetadata.KeyID, "KMSInvalidStateException"},
+		{"", "InvalidArgumentException"},
+		{keyID, ""},
+	}
+	for _, test := range tests {
+		_, err := s.StartStreamEncryption(&kinesis.StartStreamEncryptionRequest{StreamName: "s", EncryptionType: kinesis.EncryptionTypeKMS, KeyID: test.keyID})
+		if got := code(err); got != test.code {
+			t.Errorf("%v: got %v, want %v", test.keyID, got, test.code)
+		}
+	}
+
+	shard := shards(t, s)[0].ShardID
+	if out := put(t, s, "k", "secret"); out.EncryptionType != kinesis.EncryptionTypeKMS {
+		t.Errorf("got encryption type %v", out.EncryptionType)
+	}
+	it := iterator(t, s, &kinesis.GetShardIteratorRequest{ShardID: shard, ShardIteratorType: kinesis.IteratorTrimHorizon})
+
+	// Once the key is disabled, the stream can't be written or read.
+	if err := k.DisableKey(&kms.DisableKeyRequest{KeyID: keyID}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.PutRecord(&kinesis.PutRecordRequest{StreamName: "s", PartitionKey: "k", Data: []byte("x")}); code(err) != "KMSDisabledException" {
+		t.Errorf("PutRecord: got %v, want KMSDisabledException", err)
+	}
+	batch, err := s.PutRecords(&kinesis.PutRecordsRequest{StreamName: "s", Records: []kinesis.PutRecordsRequestEntry{{PartitionKey: "a", Data: []byte("x")}, {PartitionKey: "b", Data: []byte("y")}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if batch.FailedRecordCount != 2 || batch.Records[0].ErrorCode != "KMSDisabledException" || batch.Records[1].ErrorCode != "KMSDisabledException" {
+		t.Errorf("PutRecords: got %+v", batch)
+	}
+	if _, err := s.GetRecords(&kinesis.GetRecordsRequest{ShardIterator: it}); code(err) != "KMSDisabledException" {
+		t.Errorf("GetRecords: got %v, want KMSDisabledException", err)
+	}
+
+	if err := k.EnableKey(&kms.EnableKeyRequest{KeyID: keyID}); err != nil {
+		t.Fatal(err)
+	}
+	got, out := read(t, s, it)
+	if !reflect.DeepEqual(got, []string{"secret"}) || out.Records[0].EncryptionType != kinesis.EncryptionTypeKMS {
+		t.Errorf("got %v, %+v", got, out.Records)
+	}
+
+	if _, err := s.StopStreamEncryption(&kinesis.StopStreamEncryptionRequest{StreamName: "s", EncryptionType: kinesis.EncryptionTypeKMS, KeyID: disabled.KeyMetadata.KeyID}); code(err) != "InvalidArgumentException" {
+		t.Errorf("stopping with the wrong key: got %v", err)
+	}
+	if _, err := s.StopStreamEncryption(&kinesis.StopStreamEncryptionRequest{StreamName: "s", EncryptionType: kinesis.EncryptionTypeKMS, KeyID: keyID}); err != nil {
+		t.Fatal(err)
+	}
+	if out := put(t, s, "k", "plain"); out.EncryptionType != kinesis.EncryptionTypeNone {
+		t.Errorf("got encryption type %v after stopping", out.EncryptionType)
+	}
+}
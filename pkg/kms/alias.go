@@ -1,30 +1,95 @@
 package kms
 
 import (
-	"errors"
 	"fmt"
+	"regexp"
+	"sort"
 	"strings"
+	"time"
+
+	"github.com/fernomac/aws-local/pkg/common"
 )
 
-func (k *kms) ListAliases(req *ListAliasesRequest) (*ListAliasesResult, error) {
-	k.lock.Lock()
-	defer k.lock.Unlock()
+// alias is a named pointer to a key. Its fields are guarded by k.lock.
+type alias struct {
+	name    string
+	key     *key
+	created int64
+	updated int64
+}
+
+var aliasNamePattern = regexp.MustCompile(`^alias/[a-zA-Z0-9/_-]+$`)
+
+// validAliasName checks an alias name against the pattern and length limits
+// KMS imposes.
+func validAliasName(name string) error {
+	if len(name) > 256 || !aliasNamePattern.MatchString(name) {
+		return common.NewError("InvalidAliasNameException")
+	}
+	return nil
+}
+
+// aliasArn returns the ARN of the named alias.
+func aliasArn(name string) string {
+	return fmt.Sprintf("arn:aws:kms:%v:%v:%v", common.Region, common.AccountID, name)
+}
 
+// aliasName returns the alias name a key ID refers to, which is either the
+// name itself or the alias's ARN, or false if it isn't an alias.
+func aliasName(keyID string) (string, bool) {
+	if strings.HasPrefix(keyID, "alias/") {
+		return keyID, true
+	}
+	if i := strings.Index(keyID, ":alias/"); i >= 0 && strings.HasPrefix(keyID, "arn:") {
+		name := keyID[i+1:]
+		return name, aliasArn(name) == keyID
+	}
+	return "", false
+}
+
+func (a *alias) entry() AliasListEntry {
+	return AliasListEntry{
+		AliasArn:        aliasArn(a.name),
+		AliasName:       a.name,
+		TargetKeyID:     a.key.meta.KeyID,
+		CreationDate:    a.created,
+		LastUpdatedDate: a.updated,
+	}
+}
+
+func (k *kms) ListAliases(req *ListAliasesRequest) (*ListAliasesResult, error) {
 	if req.Marker != "" {
-		return nil, errors.New("InvalidMarkerException")
+		return nil, common.NewError("InvalidMarkerException")
 	}
 	if req.Limit != 0 {
-		return nil, errors.New("LimitNotSupported")
+		return nil, common.NewError("LimitNotSupported")
+	}
+
+	// The filter must name a key by ID or ARN, not by alias.
+	var target *key
+	if req.KeyID != "" {
+		if _, ok := aliasName(req.KeyID); ok {
+			return nil, common.NewError("InvalidArnException")
+		}
+		var err error
+		if target, err = k.lookup(req.KeyID); err != nil {
+			return nil, err
+		}
 	}
 
+	k.lock.RLock()
+	defer k.lock.RUnlock()
+
 	aliases := []AliasListEntry{}
-	for alias, key := range k.aliases {
-		aliases = append(aliases, AliasListEntry{
-			AliasArn:    fmt.Sprintf("arn:aws:kms:us-local-1:-:%v", alias),
-			AliasName:   alias,
-			TargetKeyID: key.meta.KeyID,
-		})
+	for _, a := range k.aliases {
+		if target != nil && a.key != target {
+			continue
+		}
+		aliases = append(aliases, a.entry())
 	}
+	sort.Slice(aliases, func(i, j int) bool {
+		return aliases[i].AliasName < aliases[j].AliasName
+	})
 
 	return &ListAliasesResult{
 		Aliases:   aliases,
@@ -32,48 +97,104 @@ func (k *kms) ListAliases(req *ListAliasesRequest) (*ListAliasesResult, error) {
 	}, nil
 }
 
+// target finds the key an alias is to point to, and checks that its policy
+// allows the operation. Aliases can't point to other aliases, AWS managed
+// keys, or keys that are pending deletion. The caller must hold k.lock.
+func (k *kms) target(keyID string, operation string) (*key, error) {
+	if _, ok := aliasName(keyID); ok {
+		return nil, common.NewError("ValidationException")
+	}
+
+	key := k.get(keyID)
+	if key == nil {
+		return nil, common.NewError("NotFoundException")
+	}
+	if err := k.authorizeLocked(key, "kms:"+operation, nil); err != nil {
+		return nil, err
+	}
+	if err := key.allows(operation); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
 func (k *kms) CreateAlias(req *CreateAliasRequest) error {
+	if err := validAliasName(req.AliasName); err != nil {
+		return err
+	}
+	// The alias/aws/ prefix is reserved for AWS managed keys.
+	if strings.HasPrefix(req.AliasName, awsAliasPrefix) {
+		return common.NewError("NotAuthorizedException")
+	}
+
 	k.lock.Lock()
 	defer k.lock.Unlock()
 
-	if !strings.HasPrefix(req.AliasName, "alias/") {
-		return errors.New("InvalidAliasNameException")
-	}
 	if _, ok := k.aliases[req.AliasName]; ok {
-		return errors.New("AlreadyExistsException")
+		return common.NewError("AlreadyExistsException")
 	}
 
-	key := k.get(req.TargetKeyID)
-	if key == nil {
-		return errors.New("NotFoundException")
+	key, err := k.target(req.TargetKeyID, "CreateAlias")
+	if err != nil {
+		return err
 	}
 
-	k.aliases[req.AliasName] = key
+	now := time.Now().Unix()
+	k.aliases[req.AliasName] = &alias{
+		name:    req.AliasName,
+		key:     key,
+		created: now,
+		updated: now,
+	}
 	return nil
 }
 
 func (k *kms) UpdateAlias(req *UpdateAliasRequest) error {
+	if strings.HasPrefix(req.AliasName, awsAliasPrefix) {
+		return common.NewError("NotAuthorizedException")
+	}
+
 	k.lock.Lock()
 	defer k.lock.Unlock()
 
-	if _, ok := k.aliases[req.AliasName]; !ok {
-		return errors.New("NotFoundException")
+	a, ok := k.aliases[req.AliasName]
+	if !ok {
+		return common.NewError("NotFoundException")
+	}
+	// Both the old key and the new one must allow the alias to move.
+	if err := k.authorizeLocked(a.key, "kms:UpdateAlias", nil); err != nil {
+		return err
 	}
 
-	key := k.get(req.TargetKeyID)
-	if key == nil {
-		return errors.New("NotFoundException")
+	key, err := k.target(req.TargetKeyID, "UpdateAlias")
+	if err != nil {
+		return err
 	}
 
-	k.aliases[req.AliasName] = key
+	// The new key must be usable in place of the old one.
+	if key.meta.KeySpec != a.key.meta.KeySpec || key.meta.KeyUsage != a.key.meta.KeyUsage {
+		return common.NewError("ValidationException")
+	}
+
+	a.key = key
+	a.updated = time.Now().Unix()
 	return nil
 }
 
 func (k *kms) DeleteAlias(req *DeleteAliasRequest) error {
+	if strings.HasPrefix(req.AliasName, awsAliasPrefix) {
+		return common.NewError("NotAuthorizedException")
+	}
+
+	k.lock.Lock()
 	defer k.lock.Unlock()
 
-	if _, ok := k.aliases[req.AliasName]; !ok {
-		return errors.New("NotFoundException")
+	a, ok := k.aliases[req.AliasName]
+	if !ok {
+		return common.NewError("NotFoundException")
+	}
+	if err := k.authorizeLocked(a.key, "kms:DeleteAlias", nil); err != nil {
+		return err
 	}
 
 	delete(k.aliases, req.AliasName)
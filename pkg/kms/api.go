@@ -6,6 +6,8 @@ type KMS interface {
 
 	ListGrants(*ListGrantsRequest) (*ListGrantsResult, error)
 	ListRetireableGrants(*ListRetireableGrantsRequest) (*ListRetireableGrantsResult, error)
+	// CreateGrant records a grant, but grants don't authorize anything: only
+	// key policies do, and requests that pass grant tokens are refused.
 	CreateGrant(*CreateGrantRequest) (*CreateGrantResult, error)
 	RetireGrant(*RetireGrantRequest) error
 	RevokeGrant(*RevokeGrantRequest) error
@@ -23,6 +25,13 @@ type KMS interface {
 	ScheduleKeyDeletion(*ScheduleKeyDeletionRequest) (*ScheduleKeyDeletionResult, error)
 	CancelKeyDeletion(*CancelKeyDeletionRequest) (*CancelKeyDeletionResult, error)
 
+	CreateCustomKeyStore(*CreateCustomKeyStoreRequest) (*CreateCustomKeyStoreResult, error)
+	DescribeCustomKeyStores(*DescribeCustomKeyStoresRequest) (*DescribeCustomKeyStoresResult, error)
+	ConnectCustomKeyStore(*ConnectCustomKeyStoreRequest) error
+	DisconnectCustomKeyStore(*DisconnectCustomKeyStoreRequest) error
+	UpdateCustomKeyStore(*UpdateCustomKeyStoreRequest) error
+	DeleteCustomKeyStore(*DeleteCustomKeyStoreRequest) error
+
 	GetParametersForImport(*GetParametersForImportRequest) (*GetParametersForImportResult, error)
 	ImportKeyMaterial(*ImportKeyMaterialRequest) error
 	DeleteImportedKeyMaterial(*DeleteImportedKeyMaterialRequest) error
@@ -42,6 +51,8 @@ type KMS interface {
 
 	GenerateDataKey(*GenerateDataKeyRequest) (*GenerateDataKeyResult, error)
 	GenerateDataKeyWithoutPlaintext(*GenerateDataKeyRequest) (*GenerateDataKeyResult, error)
+	GenerateDataKeyPair(*GenerateDataKeyPairRequest) (*GenerateDataKeyPairResult, error)
+	GenerateDataKeyPairWithoutPlaintext(*GenerateDataKeyPairRequest) (*GenerateDataKeyPairResult, error)
 	Encrypt(*EncryptRequest) (*EncryptResult, error)
 	Decrypt(*DecryptRequest) (*DecryptResult, error)
 	ReEncrypt(*ReEncryptRequest) (*ReEncryptResult, error)
@@ -53,12 +64,21 @@ type KMS interface {
 
 // GenerateRandomRequest is a request to GenerateRandom.
 type GenerateRandomRequest struct {
-	NumberOfBytes int `json:"NumberOfBytes"`
+	NumberOfBytes int            `json:"NumberOfBytes"`
+	Recipient     *RecipientInfo `json:"Recipient"`
 }
 
 // GenerateRandomResult is the result of GenerateRandom.
 type GenerateRandomResult struct {
-	Plaintext string `json:"Plaintext,omitempty"`
+	CiphertextForRecipient string `json:"CiphertextForRecipient,omitempty"`
+	Plaintext              string `json:"Plaintext,omitempty"`
+}
+
+// RecipientInfo identifies a Nitro enclave that results should be encrypted
+// to instead of being returned in plaintext.
+type RecipientInfo struct {
+	AttestationDocument    string `json:"AttestationDocument"`
+	KeyEncryptionAlgorithm string `json:"KeyEncryptionAlgorithm"`
 }
 
 // GrantConstraint is a constraint on a grant.
@@ -111,8 +131,9 @@ type ListRetireableGrantsResult struct {
 // CreateGrantRequest is a request to CreateGrant.
 type CreateGrantRequest struct {
 	Constraints       *GrantConstraint `json:"Constraints"`
-	GranteePrincipal  string           `json:"GranteePrincipal"`
+	DryRun            bool             `json:"DryRun"`
 	GrantTokens       []string         `json:"GrantTokens"`
+	GranteePrincipal  string           `json:"GranteePrincipal"`
 	KeyID             string           `json:"KeyId"`
 	Name              string           `json:"Name"`
 	Operations        []string         `json:"Operations"`
@@ -127,6 +148,7 @@ type CreateGrantResult struct {
 
 // RetireGrantRequest is a request to RetireGrant.
 type RetireGrantRequest struct {
+	DryRun     bool   `json:"DryRun"`
 	GrantID    string `json:"GrantId"`
 	GrantToken string `json:"GrantToken"`
 	KeyID      string `json:"KeyId"`
@@ -134,6 +156,7 @@ type RetireGrantRequest struct {
 
 // RevokeGrantRequest is a request to RevokeGrant.
 type RevokeGrantRequest struct {
+	DryRun  bool   `json:"DryRun"`
 	GrantID string `json:"GrantId"`
 	KeyID   string `json:"KeyId"`
 }
@@ -196,28 +219,42 @@ type ListKeysResult struct {
 // CreateKeyRequest is a request to CreateKey.
 type CreateKeyRequest struct {
 	BypassPolicyLockoutSafetyCheck bool   `json:"BypassPolicyLockoutSafetyCheck"`
+	CustomKeyStoreID               string `json:"CustomKeyStoreId"`
 	Description                    string `json:"Description"`
 	KeyUsage                       string `json:"KeyUsage"`
 	Origin                         string `json:"Origin"`
 	Policy                         string `json:"Policy"`
 	Tags                           []Tag  `json:"Tags"`
+	XksKeyID                       string `json:"XksKeyId"`
 }
 
 // KeyMetadata is metadata about a key.
 type KeyMetadata struct {
-	Arn             string `json:"Arn"`
-	AWSAccountID    string `json:"AWSAccountId"`
-	CreationDate    int64  `json:"CreationDate"`
-	DeletionDate    int64  `json:"DeletionDate,omitempty"`
-	Description     string `json:"Description"`
-	Enabled         bool   `json:"Enabled"`
-	ExpirationModel string `json:"ExpirationModel,omitempty"`
-	KeyID           string `json:"KeyId"`
-	KeyManager      string `json:"KeyManager"`
-	KeyState        string `json:"KeyState"`
-	KeyUsage        string `json:"KeyUsage"`
-	Origin          string `json:"Origin"`
-	ValidTo         int64  `json:"ValidTo,omitempty"`
+	Arn                         string                   `json:"Arn"`
+	AWSAccountID                string                   `json:"AWSAccountId"`
+	CloudHsmClusterID           string                   `json:"CloudHsmClusterId,omitempty"`
+	CreationDate                int64                    `json:"CreationDate"`
+	CustomKeyStoreID            string                   `json:"CustomKeyStoreId,omitempty"`
+	DeletionDate                int64                    `json:"DeletionDate,omitempty"`
+	Description                 string                   `json:"Description"`
+	Enabled                     bool                     `json:"Enabled"`
+	EncryptionAlgorithms        []string                 `json:"EncryptionAlgorithms,omitempty"`
+	ExpirationModel             string                   `json:"ExpirationModel,omitempty"`
+	KeyID                       string                   `json:"KeyId"`
+	KeyManager                  string                   `json:"KeyManager"`
+	KeySpec                     string                   `json:"KeySpec"`
+	KeyState                    KeyState                 `json:"KeyState"`
+	KeyUsage                    string                   `json:"KeyUsage"`
+	Origin                      string                   `json:"Origin"`
+	PendingDeletionWindowInDays int                      `json:"PendingDeletionWindowInDays,omitempty"`
+	ValidTo                     int64                    `json:"ValidTo,omitempty"`
+	XksKeyConfiguration         *XksKeyConfigurationType `json:"XksKeyConfiguration,omitempty"`
+}
+
+// XksKeyConfigurationType identifies the external key behind a key in an
+// external key store.
+type XksKeyConfigurationType struct {
+	ID string `json:"Id"`
 }
 
 // CreateKeyResult is the result of CreateKey.
@@ -260,8 +297,10 @@ type ScheduleKeyDeletionRequest struct {
 
 // ScheduleKeyDeletionResult is the result of ScheduleKeyDeletion.
 type ScheduleKeyDeletionResult struct {
-	DeletionDate int64  `json:"DeletionDate"`
-	KeyID        string `json:"KeyId"`
+	DeletionDate        int64    `json:"DeletionDate"`
+	KeyID               string   `json:"KeyId"`
+	KeyState            KeyState `json:"KeyState"`
+	PendingWindowInDays int      `json:"PendingWindowInDays"`
 }
 
 // CancelKeyDeletionRequest is a request to CancelKeyDeletion.
@@ -356,21 +395,120 @@ type PutKeyPolicyRequest struct {
 	PolicyName                     string `json:"PolicyName"`
 }
 
+//
+// API shapes for custom key stores.
+//
+
+// XksProxyAuthenticationCredential is the SigV4 credential KMS uses to
+// sign requests to an external key store proxy.
+type XksProxyAuthenticationCredential struct {
+	AccessKeyID        string `json:"AccessKeyId"`
+	RawSecretAccessKey string `json:"RawSecretAccessKey"`
+}
+
+// CreateCustomKeyStoreRequest is a request to CreateCustomKeyStore.
+type CreateCustomKeyStoreRequest struct {
+	CloudHsmClusterID                string                            `json:"CloudHsmClusterId"`
+	CustomKeyStoreName               string                            `json:"CustomKeyStoreName"`
+	CustomKeyStoreType               string                            `json:"CustomKeyStoreType"`
+	KeyStorePassword                 string                            `json:"KeyStorePassword"`
+	TrustAnchorCertificate           string                            `json:"TrustAnchorCertificate"`
+	XksProxyAuthenticationCredential *XksProxyAuthenticationCredential `json:"XksProxyAuthenticationCredential"`
+	XksProxyConnectivity             string                            `json:"XksProxyConnectivity"`
+	XksProxyURIEndpoint              string                            `json:"XksProxyUriEndpoint"`
+	XksProxyURIPath                  string                            `json:"XksProxyUriPath"`
+	XksProxyVpcEndpointServiceName   string                            `json:"XksProxyVpcEndpointServiceName"`
+}
+
+// CreateCustomKeyStoreResult is the result of CreateCustomKeyStore.
+type CreateCustomKeyStoreResult struct {
+	CustomKeyStoreID string `json:"CustomKeyStoreId"`
+}
+
+// DescribeCustomKeyStoresRequest is a request to DescribeCustomKeyStores.
+type DescribeCustomKeyStoresRequest struct {
+	CustomKeyStoreID   string `json:"CustomKeyStoreId"`
+	CustomKeyStoreName string `json:"CustomKeyStoreName"`
+	Limit              int    `json:"Limit"`
+	Marker             string `json:"Marker"`
+}
+
+// XksProxyConfigurationType describes how KMS reaches an external key store
+// proxy. The secret access key is never returned.
+type XksProxyConfigurationType struct {
+	AccessKeyID            string `json:"AccessKeyId,omitempty"`
+	Connectivity           string `json:"Connectivity,omitempty"`
+	URIEndpoint            string `json:"UriEndpoint,omitempty"`
+	URIPath                string `json:"UriPath,omitempty"`
+	VpcEndpointServiceName string `json:"VpcEndpointServiceName,omitempty"`
+}
+
+// CustomKeyStoresListEntry is an entry in a list of custom key stores.
+type CustomKeyStoresListEntry struct {
+	CloudHsmClusterID      string                     `json:"CloudHsmClusterId,omitempty"`
+	ConnectionErrorCode    string                     `json:"ConnectionErrorCode,omitempty"`
+	ConnectionState        string                     `json:"ConnectionState"`
+	CreationDate           int64                      `json:"CreationDate"`
+	CustomKeyStoreID       string                     `json:"CustomKeyStoreId"`
+	CustomKeyStoreName     string                     `json:"CustomKeyStoreName"`
+	CustomKeyStoreType     string                     `json:"CustomKeyStoreType"`
+	TrustAnchorCertificate string                     `json:"TrustAnchorCertificate,omitempty"`
+	XksProxyConfiguration  *XksProxyConfigurationType `json:"XksProxyConfiguration,omitempty"`
+}
+
+// DescribeCustomKeyStoresResult is the result of DescribeCustomKeyStores.
+type DescribeCustomKeyStoresResult struct {
+	CustomKeyStores []CustomKeyStoresListEntry `json:"CustomKeyStores"`
+	NextMarker      string                     `json:"NextMarker,omitempty"`
+	Truncated       bool                       `json:"Truncated,omitempty"`
+}
+
+// ConnectCustomKeyStoreRequest is a request to ConnectCustomKeyStore.
+type ConnectCustomKeyStoreRequest struct {
+	CustomKeyStoreID string `json:"CustomKeyStoreId"`
+}
+
+// DisconnectCustomKeyStoreRequest is a request to DisconnectCustomKeyStore.
+type DisconnectCustomKeyStoreRequest struct {
+	CustomKeyStoreID string `json:"CustomKeyStoreId"`
+}
+
+// UpdateCustomKeyStoreRequest is a request to UpdateCustomKeyStore.
+type UpdateCustomKeyStoreRequest struct {
+	CloudHsmClusterID                string                            `json:"CloudHsmClusterId"`
+	CustomKeyStoreID                 string                            `json:"CustomKeyStoreId"`
+	KeyStorePassword                 string                            `json:"KeyStorePassword"`
+	NewCustomKeyStoreName            string                            `json:"NewCustomKeyStoreName"`
+	XksProxyAuthenticationCredential *XksProxyAuthenticationCredential `json:"XksProxyAuthenticationCredential"`
+	XksProxyConnectivity             string                            `json:"XksProxyConnectivity"`
+	XksProxyURIEndpoint              string                            `json:"XksProxyUriEndpoint"`
+	XksProxyURIPath                  string                            `json:"XksProxyUriPath"`
+	XksProxyVpcEndpointServiceName   string                            `json:"XksProxyVpcEndpointServiceName"`
+}
+
+// DeleteCustomKeyStoreRequest is a request to DeleteCustomKeyStore.
+type DeleteCustomKeyStoreRequest struct {
+	CustomKeyStoreID string `json:"CustomKeyStoreId"`
+}
+
 //
 // API shapes for dealing with aliases.
 //
 
 // ListAliasesRequest is a request to ListAliases.
 type ListAliasesRequest struct {
+	KeyID  string `json:"KeyId"`
 	Limit  int    `json:"Limit"`
 	Marker string `json:"Marker"`
 }
 
 // AliasListEntry is an entry in an alias list.
 type AliasListEntry struct {
-	AliasArn    string `json:"AliasArn"`
-	AliasName   string `json:"AliasName"`
-	TargetKeyID string `json:"TargetKeyId"`
+	AliasArn        string `json:"AliasArn"`
+	AliasName       string `json:"AliasName"`
+	TargetKeyID     string `json:"TargetKeyId"`
+	CreationDate    int64  `json:"CreationDate,omitempty"`
+	LastUpdatedDate int64  `json:"LastUpdatedDate,omitempty"`
 }
 
 // ListAliasesResult is the result of ListAliases.
@@ -403,59 +541,97 @@ type DeleteAliasRequest struct {
 
 // GenerateDataKeyRequest is a request to GenerateDataKey.
 type GenerateDataKeyRequest struct {
+	DryRun            bool              `json:"DryRun"`
 	EncryptionContext map[string]string `json:"EncryptionContext"`
 	GrantTokens       []string          `json:"GrantTokens"`
 	KeyID             string            `json:"KeyId"`
 	KeySpec           string            `json:"KeySpec"`
 	NumberOfBytes     int               `json:"NumberOfBytes"`
+	Recipient         *RecipientInfo    `json:"Recipient"`
 }
 
 // GenerateDataKeyResult is the result of GenerateDataKey.
 type GenerateDataKeyResult struct {
-	CiphertextBlob string `json:"CiphertextBlob,omitempty"`
-	KeyID          string `json:"KeyId,omitempty"`
-	Plaintext      string `json:"Plaintext,omitempty"`
+	CiphertextBlob         string `json:"CiphertextBlob,omitempty"`
+	CiphertextForRecipient string `json:"CiphertextForRecipient,omitempty"`
+	KeyID                  string `json:"KeyId,omitempty"`
+	Plaintext              string `json:"Plaintext,omitempty"`
 }
 
-// EncryptRequest is a request to Encrypt.
-type EncryptRequest struct {
+// GenerateDataKeyPairRequest is a request to GenerateDataKeyPair.
+type GenerateDataKeyPairRequest struct {
+	DryRun            bool              `json:"DryRun"`
 	EncryptionContext map[string]string `json:"EncryptionContext"`
 	GrantTokens       []string          `json:"GrantTokens"`
 	KeyID             string            `json:"KeyId"`
-	Plaintext         string            `json:"Plaintext"`
+	KeyPairSpec       string            `json:"KeyPairSpec"`
+	Recipient         *RecipientInfo    `json:"Recipient"`
+}
+
+// GenerateDataKeyPairResult is the result of GenerateDataKeyPair.
+type GenerateDataKeyPairResult struct {
+	CiphertextForRecipient   string `json:"CiphertextForRecipient,omitempty"`
+	KeyID                    string `json:"KeyId,omitempty"`
+	KeyPairSpec              string `json:"KeyPairSpec,omitempty"`
+	PrivateKeyCiphertextBlob string `json:"PrivateKeyCiphertextBlob,omitempty"`
+	PrivateKeyPlaintext      string `json:"PrivateKeyPlaintext,omitempty"`
+	PublicKey                string `json:"PublicKey,omitempty"`
+}
+
+// EncryptRequest is a request to Encrypt.
+type EncryptRequest struct {
+	DryRun              bool              `json:"DryRun"`
+	EncryptionAlgorithm string            `json:"EncryptionAlgorithm"`
+	EncryptionContext   map[string]string `json:"EncryptionContext"`
+	GrantTokens         []string          `json:"GrantTokens"`
+	KeyID               string            `json:"KeyId"`
+	Plaintext           string            `json:"Plaintext"`
 }
 
 // EncryptResult is the result of Encrypt.
 type EncryptResult struct {
-	CiphertextBlob string `json:"CiphertextBlob,omitempty"`
-	KeyID          string `json:"KeyId,omitempty"`
+	CiphertextBlob      string `json:"CiphertextBlob,omitempty"`
+	EncryptionAlgorithm string `json:"EncryptionAlgorithm,omitempty"`
+	KeyID               string `json:"KeyId,omitempty"`
 }
 
 // DecryptRequest is a request to Decrypt.
 type DecryptRequest struct {
-	CiphertextBlob    string            `json:"CiphertextBlob"`
-	EncryptionContext map[string]string `json:"EncryptionContext"`
-	GrantTokens       []string          `json:"GrantTokens"`
+	CiphertextBlob      string            `json:"CiphertextBlob"`
+	DryRun              bool              `json:"DryRun"`
+	EncryptionAlgorithm string            `json:"EncryptionAlgorithm"`
+	EncryptionContext   map[string]string `json:"EncryptionContext"`
+	GrantTokens         []string          `json:"GrantTokens"`
+	KeyID               string            `json:"KeyId"`
+	Recipient           *RecipientInfo    `json:"Recipient"`
 }
 
 // DecryptResult is the result of Decrypt.
 type DecryptResult struct {
-	KeyID     string `json:"KeyId,omitempty"`
-	Plaintext string `json:"Plaintext,omitempty"`
+	CiphertextForRecipient string `json:"CiphertextForRecipient,omitempty"`
+	EncryptionAlgorithm    string `json:"EncryptionAlgorithm,omitempty"`
+	KeyID                  string `json:"KeyId,omitempty"`
+	Plaintext              string `json:"Plaintext,omitempty"`
 }
 
 // ReEncryptRequest is a request to ReEncrypt.
 type ReEncryptRequest struct {
-	CiphertextBlob               string            `json:"CiphertextBlob"`
-	DestinationEncryptionContext map[string]string `json:"DestinationEncryptionContext"`
-	DestinationKeyID             string            `json:"DestinationKeyId"`
-	GrantTokens                  []string          `json:"GrantTokens"`
-	SourceEncryptionContext      map[string]string `json:"SourceEncryptionContext"`
+	CiphertextBlob                 string            `json:"CiphertextBlob"`
+	DestinationEncryptionAlgorithm string            `json:"DestinationEncryptionAlgorithm"`
+	DestinationEncryptionContext   map[string]string `json:"DestinationEncryptionContext"`
+	DestinationKeyID               string            `json:"DestinationKeyId"`
+	DryRun                         bool              `json:"DryRun"`
+	GrantTokens                    []string          `json:"GrantTokens"`
+	SourceEncryptionAlgorithm      string            `json:"SourceEncryptionAlgorithm"`
+	SourceEncryptionContext        map[string]string `json:"SourceEncryptionContext"`
+	SourceKeyID                    string            `json:"SourceKeyId"`
 }
 
 // ReEncryptResult is the result of ReEncrypt.
 type ReEncryptResult struct {
-	CiphertextBlob string `json:"CiphertextBlob,omitempty"`
-	KeyID          string `json:"KeyId,omitempty"`
-	SourceKeyID    string `json:"SourceKeyId,omitempty"`
+	CiphertextBlob                 string `json:"CiphertextBlob,omitempty"`
+	DestinationEncryptionAlgorithm string `json:"DestinationEncryptionAlgorithm,omitempty"`
+	KeyID                          string `json:"KeyId,omitempty"`
+	SourceEncryptionAlgorithm      string `json:"SourceEncryptionAlgorithm,omitempty"`
+	SourceKeyID                    string `json:"SourceKeyId,omitempty"`
 }
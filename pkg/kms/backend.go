@@ -0,0 +1,160 @@
+package kms
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+	"sync"
+
+	"github.com/fernomac/aws-local/pkg/common"
+)
+
+// Backend holds key material for the keys in a custom key store, outside of
+// KMS proper: in an HSM cluster or behind an external key store proxy.
+type Backend interface {
+	// Connect checks that the backend is reachable with the given settings.
+	// A *ConnectionError says what to report as the ConnectionErrorCode.
+	Connect(config *KeyStoreConfig) error
+
+	// Disconnect releases anything the backend holds while connected.
+	Disconnect()
+
+	// CreateKey creates a key, or for external key stores checks that the
+	// given existing key is usable, and returns the ID the backend knows it by.
+	CreateKey(externalID string) (string, error)
+
+	// Encrypt encrypts plaintext with AES-GCM, authenticating aad.
+	Encrypt(keyID string, plaintext []byte, aad []byte) (iv []byte, ciphertext []byte, tag []byte, err error)
+
+	// Decrypt reverses Encrypt.
+	Decrypt(keyID string, iv []byte, ciphertext []byte, tag []byte, aad []byte) ([]byte, error)
+}
+
+// BackendFactory creates the backend for a new custom key store.
+type BackendFactory func(config *KeyStoreConfig) (Backend, error)
+
+// KeyStoreConfig is everything KMS knows about a custom key store, including
+// the secrets it never hands back out.
+type KeyStoreConfig struct {
+	ID                     string
+	Name                   string
+	Type                   string
+	CloudHsmClusterID      string
+	TrustAnchorCertificate string
+	KeyStorePassword       string
+	XksProxyURIEndpoint    string
+	XksProxyURIPath        string
+	XksProxyConnectivity   string
+	XksProxyVpcEndpoint    string
+	XksProxyCredential     XksProxyAuthenticationCredential
+}
+
+// ConnectionError is a failure to connect to a custom key store.
+type ConnectionError struct {
+	Code string
+	Err  error
+}
+
+func (e *ConnectionError) Error() string {
+	if e.Err == nil {
+		return e.Code
+	}
+	return fmt.Sprintf("%v: %v", e.Code, e.Err)
+}
+
+// softHSM is an in-process stand-in for a CloudHSM cluster.
+type softHSM struct {
+	lock     sync.Mutex
+	password string
+	counter  int
+	keys     map[string]cipher.AEAD
+}
+
+// NewSoftHSM creates an in-process HSM stand-in for a CloudHSM key store. Its
+// kmsuser password is the key store's password at creation time; connecting
+// with any other password fails with INVALID_CREDENTIALS, as it would if the
+// password were changed in KMS but not in the cluster.
+func NewSoftHSM(config *KeyStoreConfig) (Backend, error) {
+	return &softHSM{
+		password: config.KeyStorePassword,
+		keys:     make(map[string]cipher.AEAD),
+	}, nil
+}
+
+func (h *softHSM) Connect(config *KeyStoreConfig) error {
+	if config.KeyStorePassword != h.password {
+		return &ConnectionError{Code: "INVALID_CREDENTIALS"}
+	}
+	return nil
+}
+
+func (h *softHSM) Disconnect() {
+}
+
+func (h *softHSM) CreateKey(externalID string) (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	block, err := aes.NewCipher(raw)
+	if err != nil {
+		return "", err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	id := fmt.Sprintf("hsm-key-%v", h.counter)
+	h.counter++
+	h.keys[id] = aead
+	return id, nil
+}
+
+func (h *softHSM) get(keyID string) (cipher.AEAD, error) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	aead, ok := h.keys[keyID]
+	if !ok {
+		return nil, common.NewError("KMSInvalidStateException")
+	}
+	return aead, nil
+}
+
+func (h *softHSM) Encrypt(keyID string, plaintext []byte, aad []byte) ([]byte, []byte, []byte, error) {
+	aead, err := h.get(keyID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	iv := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(iv); err != nil {
+		return nil, nil, nil, err
+	}
+
+	sealed := aead.Seal(nil, iv, plaintext, aad)
+	n := len(sealed) - aead.Overhead()
+	return iv, sealed[:n], sealed[n:], nil
+}
+
+func (h *softHSM) Decrypt(keyID string, iv []byte, ciphertext []byte, tag []byte, aad []byte) ([]byte, error) {
+	aead, err := h.get(keyID)
+	if err != nil {
+		return nil, err
+	}
+	if len(iv) != aead.NonceSize() {
+		return nil, common.NewError("InvalidCiphertextException")
+	}
+
+	sealed := append(append([]byte(nil), ciphertext...), tag...)
+	plaintext, err := aead.Open(nil, iv, sealed, aad)
+	if err != nil {
+		return nil, common.NewError("InvalidCiphertextException")
+	}
+	return plaintext, nil
+}
@@ -0,0 +1,166 @@
+package kms_test
+
+import (
+	"encoding/base64"
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	"github.com/fernomac/aws-local/pkg/kms"
+)
+
+func createKeys(b *testing.B, svc kms.KMS, n int) []string {
+	ids := []string{}
+	for i := 0; i < n; i++ {
+		out, err := svc.CreateKey(&kms.CreateKeyRequest{})
+		if err != nil {
+			b.Fatal(err)
+		}
+		ids = append(ids, out.KeyMetadata.KeyID)
+	}
+	return ids
+}
+
+var plaintext = base64.StdEncoding.EncodeToString(make([]byte, 4096))
+
+func benchmarkEncrypt(b *testing.B, keys int, parallel bool) {
+	svc := kms.New()
+	ids := createKeys(b, svc, keys)
+	ctx := map[string]string{"purpose": "benchmark"}
+
+	var n uint64
+	encrypt := func() error {
+		id := ids[int(atomic.AddUint64(&n, 1))%len(ids)]
+		_, err := svc.Encrypt(&kms.EncryptRequest{
+			KeyID:             id,
+			Plaintext:         plaintext,
+			EncryptionContext: ctx,
+		})
+		return err
+	}
+
+	b.SetBytes(4096)
+	b.ResetTimer()
+
+	if !parallel {
+		for i := 0; i < b.N; i++ {
+			if err := encrypt(); err != nil {
+				b.Fatal(err)
+			}
+		}
+		return
+	}
+
+	// FailNow may only be called from the benchmark goroutine, so workers
+	// report errors and stop.
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if err := encrypt(); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
+
+func BenchmarkEncrypt(b *testing.B) {
+	benchmarkEncrypt(b, 1, false)
+}
+
+func BenchmarkEncryptParallel(b *testing.B) {
+	for _, keys := range []int{1, 16} {
+		b.Run(fmt.Sprintf("keys=%v", keys), func(b *testing.B) {
+			benchmarkEncrypt(b, keys, true)
+		})
+	}
+}
+
+func BenchmarkDecryptParallel(b *testing.B) {
+	svc := kms.New()
+	ids := createKeys(b, svc, 16)
+
+	blobs := []string{}
+	for _, id := range ids {
+		out, err := svc.Encrypt(&kms.EncryptRequest{KeyID: id, Plaintext: plaintext})
+		if err != nil {
+			b.Fatal(err)
+		}
+		blobs = append(blobs, out.CiphertextBlob)
+	}
+
+	var n uint64
+	b.SetBytes(4096)
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			blob := blobs[int(atomic.AddUint64(&n, 1))%len(blobs)]
+			if _, err := svc.Decrypt(&kms.DecryptRequest{CiphertextBlob: blob}); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
+
+func BenchmarkGenerateDataKeyParallel(b *testing.B) {
+	svc := kms.New()
+	ids := createKeys(b, svc, 16)
+
+	var n uint64
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			id := ids[int(atomic.AddUint64(&n, 1))%len(ids)]
+			_, err := svc.GenerateDataKey(&kms.GenerateDataKeyRequest{KeyID: id, KeySpec: "AES_256"})
+			if err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
+
+// BenchmarkEncryptWithAdminTraffic measures crypto throughput while other
+// goroutines keep updating key metadata.
+func BenchmarkEncryptWithAdminTraffic(b *testing.B) {
+	svc := kms.New()
+	ids := createKeys(b, svc, 16)
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			svc.TagResource(&kms.TagResourceRequest{
+				KeyID: ids[i%len(ids)],
+				Tags:  []kms.Tag{{TagKey: "n", TagValue: fmt.Sprint(i)}},
+			})
+			svc.ListKeys(&kms.ListKeysRequest{})
+		}
+	}()
+
+	var n uint64
+	b.SetBytes(4096)
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			id := ids[int(atomic.AddUint64(&n, 1))%len(ids)]
+			if _, err := svc.Encrypt(&kms.EncryptRequest{KeyID: id, Plaintext: plaintext}); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+
+	b.StopTimer()
+	close(stop)
+	<-done
+}
@@ -0,0 +1,170 @@
+package kms
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"sort"
+
+	"github.com/fernomac/aws-local/pkg/common"
+)
+
+// blobVersion is the version of the ciphertext blob format we write.
+const blobVersion = 1
+
+// tagSize is the size of the AES-GCM authentication tag.
+const tagSize = 16
+
+// ciphertextBlob is a ciphertext blob. Like the real thing, it references the
+// key by ARN along with the ID of the key material version that sealed it,
+// followed by the IV, the ciphertext and the authentication tag:
+//
+//	version     uint8
+//	keyArn      uint16 length + bytes
+//	versionID   uint16 length + bytes
+//	iv          uint16 length + bytes
+//	ciphertext  uint16 length + bytes
+//	tag         16 bytes
+//
+// Lengths are big-endian. Everything before the IV is authenticated as part of
+// the additional data, so a blob can't be re-pointed at another key.
+type ciphertextBlob struct {
+	keyArn     string
+	versionID  string
+	iv         []byte
+	ciphertext []byte
+	tag        []byte
+}
+
+func writeBytes(buf *bytes.Buffer, str []byte) error {
+	if len(str) > 0xFFFF {
+		return common.NewError("InternalFailure")
+	}
+
+	binary.Write(buf, binary.BigEndian, uint16(len(str)))
+	buf.Write(str)
+
+	return nil
+}
+
+func readBytes(buf *bytes.Reader) ([]byte, error) {
+	var l uint16
+	if err := binary.Read(buf, binary.BigEndian, &l); err != nil {
+		return nil, err
+	}
+
+	str := make([]byte, l)
+	if _, err := io.ReadFull(buf, str); err != nil {
+		return nil, err
+	}
+
+	return str, nil
+}
+
+// header returns the version, key ARN and version ID.
+func (b *ciphertextBlob) header() ([]byte, error) {
+	buf := bytes.Buffer{}
+
+	buf.WriteByte(blobVersion)
+	if err := writeBytes(&buf, []byte(b.keyArn)); err != nil {
+		return nil, err
+	}
+	if err := writeBytes(&buf, []byte(b.versionID)); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (b *ciphertextBlob) marshal() ([]byte, error) {
+	header, err := b.header()
+	if err != nil {
+		return nil, err
+	}
+
+	buf := bytes.NewBuffer(header)
+	if err := writeBytes(buf, b.iv); err != nil {
+		return nil, err
+	}
+	if err := writeBytes(buf, b.ciphertext); err != nil {
+		return nil, err
+	}
+	buf.Write(b.tag)
+
+	return buf.Bytes(), nil
+}
+
+func parseCiphertextBlob(data []byte) (*ciphertextBlob, error) {
+	invalid := common.NewError("InvalidCiphertextException")
+	buf := bytes.NewReader(data)
+
+	ver, err := buf.ReadByte()
+	if err != nil || ver != blobVersion {
+		return nil, invalid
+	}
+
+	arn, err := readBytes(buf)
+	if err != nil {
+		return nil, invalid
+	}
+
+	versionID, err := readBytes(buf)
+	if err != nil {
+		return nil, invalid
+	}
+
+	iv, err := readBytes(buf)
+	if err != nil {
+		return nil, invalid
+	}
+
+	ciphertext, err := readBytes(buf)
+	if err != nil {
+		return nil, invalid
+	}
+
+	tag := make([]byte, tagSize)
+	if _, err := io.ReadFull(buf, tag); err != nil {
+		return nil, invalid
+	}
+
+	if buf.Len() != 0 {
+		return nil, invalid
+	}
+
+	return &ciphertextBlob{
+		keyArn:     string(arn),
+		versionID:  string(versionID),
+		iv:         iv,
+		ciphertext: ciphertext,
+		tag:        tag,
+	}, nil
+}
+
+// canonicalContext serializes an encryption context unambiguously: a pair
+// count followed by length-prefixed keys and values, sorted by key.
+func canonicalContext(ctx map[string]string) []byte {
+	buf := bytes.Buffer{}
+
+	keys := make([]string, 0, len(ctx))
+	for key := range ctx {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	binary.Write(&buf, binary.BigEndian, uint32(len(keys)))
+	for _, key := range keys {
+		binary.Write(&buf, binary.BigEndian, uint32(len(key)))
+		buf.WriteString(key)
+		binary.Write(&buf, binary.BigEndian, uint32(len(ctx[key])))
+		buf.WriteString(ctx[key])
+	}
+
+	return buf.Bytes()
+}
+
+// makeAad builds the additional authenticated data for a blob.
+func makeAad(header []byte, ctx map[string]string) []byte {
+	return append(append([]byte(nil), header...), canonicalContext(ctx)...)
+}
@@ -0,0 +1,117 @@
+package kms
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/fernomac/aws-local/pkg/common"
+)
+
+func TestCanonicalContext(t *testing.T) {
+	tests := []struct {
+		a, b map[string]string
+		same bool
+	}{
+		{map[string]string{"ab": "c"}, map[string]string{"a": "bc"}, false},
+		{map[string]string{"a": "b", "c": "d"}, map[string]string{"a": "bcd"}, false},
+		{map[string]string{"a": ""}, map[string]string{}, false},
+		{map[string]string{"": "a"}, map[string]string{"a": ""}, false},
+		{nil, map[string]string{}, true},
+		{map[string]string{"a": "1", "b": "2"}, map[string]string{"b": "2", "a": "1"}, true},
+	}
+
+	for _, test := range tests {
+		same := bytes.Equal(canonicalContext(test.a), canonicalContext(test.b))
+		if same != test.same {
+			t.Errorf("%v and %v: same is %v", test.a, test.b, same)
+		}
+	}
+}
+
+func TestCiphertextBlob(t *testing.T) {
+	blob := &ciphertextBlob{
+		keyArn:     "arn:aws:kms:us-local-1:000000000000:key/k",
+		versionID:  "v",
+		iv:         []byte("0123456789ab"),
+		ciphertext: []byte("ciphertext"),
+		tag:        bytes.Repeat([]byte{7}, tagSize),
+	}
+	data, err := blob.marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := parseCiphertextBlob(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.keyArn != blob.keyArn || parsed.versionID != blob.versionID ||
+		!bytes.Equal(parsed.iv, blob.iv) || !bytes.Equal(parsed.ciphertext, blob.ciphertext) || !bytes.Equal(parsed.tag, blob.tag) {
+		t.Errorf("got %+v, want %+v", parsed, blob)
+	}
+
+	for _, bad := range [][]byte{nil, {2}, data[:len(data)-1], append(append([]byte{}, data...), 0)} {
+		if _, err := parseCiphertextBlob(bad); err == nil {
+			t.Errorf("%x: no error", bad)
+		} else if ce, ok := err.(common.Error); !ok || ce.Code != "InvalidCiphertextException" {
+			t.Errorf("%x: %v", bad, err)
+		}
+	}
+}
+
+// TestDecryptContextBoundaries checks that moving characters between the key
+// and value of an encryption context pair changes the additional data, so a
+// blob sealed under one can't be opened under the other.
+func TestDecryptContextBoundaries(t *testing.T) {
+	store := New()
+	key, err := store.CreateKey(&CreateKeyRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc, err := store.Encrypt(&EncryptRequest{
+		KeyID:             key.KeyMetadata.KeyID,
+		Plaintext:         "aGk=",
+		EncryptionContext: map[string]string{"ab": "c"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = store.Decrypt(&DecryptRequest{
+		CiphertextBlob:    enc.CiphertextBlob,
+		EncryptionContext: map[string]string{"a": "bc"},
+	})
+	if ce, ok := err.(common.Error); !ok || ce.Code != "InvalidCiphertextException" {
+		t.Errorf("got %v, want InvalidCiphertextException", err)
+	}
+}
+
+// TestDecryptKeyID checks that Decrypt reports the full ARN of the key that
+// sealed the blob, however the key was named to Encrypt.
+func TestDecryptKeyID(t *testing.T) {
+	store := New()
+	key, err := store.CreateKey(&CreateKeyRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.CreateAlias(&CreateAliasRequest{AliasName: "alias/blob", TargetKeyID: key.KeyMetadata.KeyID}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []string{key.KeyMetadata.KeyID, key.KeyMetadata.Arn, "alias/blob"} {
+		enc, err := store.Encrypt(&EncryptRequest{KeyID: id, Plaintext: "aGk="})
+		if err != nil {
+			t.Fatalf("%v: %v", id, err)
+		}
+		if enc.KeyID != key.KeyMetadata.Arn {
+			t.Errorf("%v: Encrypt returned key %v", id, enc.KeyID)
+		}
+		dec, err := store.Decrypt(&DecryptRequest{CiphertextBlob: enc.CiphertextBlob})
+		if err != nil {
+			t.Fatalf("%v: %v", id, err)
+		}
+		if dec.KeyID != key.KeyMetadata.Arn {
+			t.Errorf("%v: Decrypt returned key %v, want %v", id, dec.KeyID, key.KeyMetadata.Arn)
+		}
+	}
+}
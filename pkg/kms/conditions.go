@@ -0,0 +1,254 @@
+package kms
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// conditions holds the condition keys describing a request, keyed by
+// lower-cased name. Keys can have several values (e.g. kms:EncryptionContextKeys).
+type conditions map[string][]string
+
+func (c conditions) set(name string, values ...string) {
+	c[strings.ToLower(name)] = values
+}
+
+// encryptionContextConditions returns the condition keys for an encryption
+// context.
+func encryptionContextConditions(ctx map[string]string) conditions {
+	out := conditions{}
+	keys := []string{}
+	for k, v := range ctx {
+		out.set("kms:EncryptionContext:"+k, v)
+		keys = append(keys, k)
+	}
+	if len(keys) > 0 {
+		out.set("kms:EncryptionContextKeys", keys...)
+	}
+	return out
+}
+
+// resourceConditions returns the condition keys describing a key: its tags
+// as aws:ResourceTag/* and its aliases as kms:ResourceAliases.
+func resourceConditions(tags map[string]string, aliases []string) conditions {
+	out := conditions{}
+	for k, v := range tags {
+		out.set("aws:ResourceTag/"+k, v)
+	}
+	if len(aliases) > 0 {
+		out.set("kms:ResourceAliases", aliases...)
+	}
+	return out
+}
+
+// requestTagConditions returns the aws:RequestTag/* and aws:TagKeys condition
+// keys for the tags in a request.
+func requestTagConditions(tags []Tag) conditions {
+	out := conditions{}
+	keys := []string{}
+	for _, tag := range tags {
+		out.set("aws:RequestTag/"+tag.TagKey, tag.TagValue)
+		keys = append(keys, tag.TagKey)
+	}
+	if len(keys) > 0 {
+		out.set("aws:TagKeys", keys...)
+	}
+	return out
+}
+
+// requestAliasConditions returns the kms:RequestAlias condition key if the
+// request named its key by alias.
+func requestAliasConditions(keyID string) conditions {
+	out := conditions{}
+	if name, ok := aliasName(keyID); ok {
+		out.set("kms:RequestAlias", name)
+	}
+	return out
+}
+
+// merge returns a new set of conditions holding the union of c and other.
+func (c conditions) merge(other conditions) conditions {
+	out := conditions{}
+	for k, v := range c {
+		out[k] = v
+	}
+	for k, v := range other {
+		out[k] = v
+	}
+	return out
+}
+
+// operator is a parsed condition operator such as ForAnyValue:StringLike.
+type operator struct {
+	base      string
+	forAny    bool
+	forAll    bool
+	ifExists  bool
+	negated   bool
+	matchFunc func(have, want string) bool
+}
+
+var errUnknownOperator = errors.New("unknown condition operator")
+
+func numeric(cmp func(a, b float64) bool) func(have, want string) bool {
+	return func(have, want string) bool {
+		a, err1 := strconv.ParseFloat(have, 64)
+		b, err2 := strconv.ParseFloat(want, 64)
+		return err1 == nil && err2 == nil && cmp(a, b)
+	}
+}
+
+// globMatch matches s against an IAM-style pattern, where * matches any run
+// of characters and ? matches any single character.
+func globMatch(pattern, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for pattern != "" && pattern[0] == '*' {
+				pattern = pattern[1:]
+			}
+			if pattern == "" {
+				return true
+			}
+			for i := 0; i <= len(s); i++ {
+				if globMatch(pattern, s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if s == "" {
+				return false
+			}
+		default:
+			if s == "" || s[0] != pattern[0] {
+				return false
+			}
+		}
+		pattern, s = pattern[1:], s[1:]
+	}
+	return s == ""
+}
+
+func like(have, want string) bool {
+	return globMatch(want, have)
+}
+
+func parseOperator(str string) (*operator, error) {
+	op := &operator{}
+
+	if strings.HasPrefix(str, "ForAnyValue:") {
+		op.forAny = true
+		str = str[len("ForAnyValue:"):]
+	} else if strings.HasPrefix(str, "ForAllValues:") {
+		op.forAll = true
+		str = str[len("ForAllValues:"):]
+	}
+
+	if strings.HasSuffix(str, "IfExists") && str != "IfExists" {
+		op.ifExists = true
+		str = str[:len(str)-len("IfExists")]
+	}
+
+	op.base = str
+
+	switch str {
+	case "StringEquals", "ArnEquals", "BinaryEquals":
+		op.matchFunc = func(have, want string) bool { return have == want }
+	case "StringNotEquals", "ArnNotEquals":
+		op.negated = true
+		op.matchFunc = func(have, want string) bool { return have == want }
+	case "StringEqualsIgnoreCase":
+		op.matchFunc = strings.EqualFold
+	case "StringNotEqualsIgnoreCase":
+		op.negated = true
+		op.matchFunc = strings.EqualFold
+	case "StringLike", "ArnLike":
+		op.matchFunc = like
+	case "StringNotLike", "ArnNotLike":
+		op.negated = true
+		op.matchFunc = like
+	case "Bool":
+		op.matchFunc = strings.EqualFold
+	case "NumericEquals":
+		op.matchFunc = numeric(func(a, b float64) bool { return a == b })
+	case "NumericNotEquals":
+		op.negated = true
+		op.matchFunc = numeric(func(a, b float64) bool { return a == b })
+	case "NumericLessThan":
+		op.matchFunc = numeric(func(a, b float64) bool { return a < b })
+	case "NumericLessThanEquals":
+		op.matchFunc = numeric(func(a, b float64) bool { return a <= b })
+	case "NumericGreaterThan":
+		op.matchFunc = numeric(func(a, b float64) bool { return a > b })
+	case "NumericGreaterThanEquals":
+		op.matchFunc = numeric(func(a, b float64) bool { return a >= b })
+	case "Null":
+	default:
+		return nil, errUnknownOperator
+	}
+
+	return op, nil
+}
+
+func anyMatch(op *operator, have string, want []string) bool {
+	for _, w := range want {
+		if op.matchFunc(have, w) {
+			return true
+		}
+	}
+	return false
+}
+
+// evaluate evaluates a single condition key against the request.
+func (op *operator) evaluate(name string, want []string, ctx conditions) bool {
+	have, present := ctx[strings.ToLower(name)]
+	if present && len(have) == 0 {
+		present = false
+	}
+
+	if op.base == "Null" {
+		for _, w := range want {
+			if strings.EqualFold(w, "true") == present {
+				return false
+			}
+		}
+		return true
+	}
+
+	switch {
+	case op.forAll:
+		// Every value in the request must match; vacuously true if none.
+		for _, h := range have {
+			if anyMatch(op, h, want) == op.negated {
+				return false
+			}
+		}
+		return true
+
+	case op.forAny:
+		if !present {
+			return false
+		}
+		for _, h := range have {
+			if anyMatch(op, h, want) != op.negated {
+				return true
+			}
+		}
+		return false
+
+	default:
+		if !present {
+			return op.ifExists || op.negated
+		}
+		matched := false
+		for _, h := range have {
+			if anyMatch(op, h, want) {
+				matched = true
+				break
+			}
+		}
+		return matched != op.negated
+	}
+}
@@ -0,0 +1,174 @@
+package kms
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fernomac/aws-local/pkg/common"
+)
+
+// RequiredContextTag is the tag listing, comma-separated, the encryption
+// context keys that calls using a key must supply in strict mode.
+const RequiredContextTag = "aws-local:RequiredEncryptionContextKeys"
+
+// WithStrictEncryptionContext turns on strict mode, in which calls that use a
+// key fail with ValidationException unless they supply every encryption
+// context key the key requires. Keys say what they require with the
+// RequiredContextTag tag; required adds more, keyed by key ID, key ARN or
+// alias name, for keys that are created by the code under test.
+func WithStrictEncryptionContext(required map[string][]string) Option {
+	return func(k *kms) {
+		k.strict = true
+		k.required = required
+	}
+}
+
+// WithContextLog records the encryption contexts used with each key to l.
+func WithContextLog(l *ContextLog) Option {
+	return func(k *kms) {
+		k.contexts = l
+	}
+}
+
+// requiredContext returns the encryption context keys the key requires.
+func (k *kms) requiredContext(key *key) []string {
+	required := map[string]bool{}
+
+	key.lock.RLock()
+	for _, name := range strings.Split(key.tags[RequiredContextTag], ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			required[name] = true
+		}
+	}
+	key.lock.RUnlock()
+
+	for _, id := range append([]string{key.meta.KeyID, key.meta.Arn}, k.aliasesOf(key)...) {
+		for _, name := range k.required[id] {
+			required[name] = true
+		}
+	}
+
+	out := []string{}
+	for name := range required {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// checkContext checks, in strict mode, that ctx has every encryption context
+// key the key requires.
+func (k *kms) checkContext(key *key, ctx map[string]string) error {
+	if !k.strict {
+		return nil
+	}
+
+	missing := []string{}
+	for _, name := range k.requiredContext(key) {
+		if _, ok := ctx[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return common.Errorf("ValidationException", "encryption context for %v is missing required keys %v", key.meta.Arn, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// ContextUse is an encryption context that has been used with a key.
+type ContextUse struct {
+	KeyArn            string            `json:"keyArn"`
+	EncryptionContext map[string]string `json:"encryptionContext"`
+	Operations        map[string]int    `json:"operations"`
+	FirstUsed         time.Time         `json:"firstUsed"`
+	LastUsed          time.Time         `json:"lastUsed"`
+}
+
+// ContextLog records which encryption contexts have been used with which
+// keys, for tests to check that their callers pass the context they should.
+type ContextLog struct {
+	lock sync.Mutex
+	uses map[string]*ContextUse
+}
+
+// NewContextLog creates an empty ContextLog.
+func NewContextLog() *ContextLog {
+	return &ContextLog{
+		uses: make(map[string]*ContextUse),
+	}
+}
+
+// record notes a successful use of an encryption context with a key.
+func (l *ContextLog) record(keyArn string, operation string, ctx map[string]string) {
+	if l == nil {
+		return
+	}
+
+	now := time.Now().UTC()
+	id := keyArn + " " + string(canonicalContext(ctx))
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	use, ok := l.uses[id]
+	if !ok {
+		copied := map[string]string{}
+		for k, v := range ctx {
+			copied[k] = v
+		}
+		use = &ContextUse{
+			KeyArn:            keyArn,
+			EncryptionContext: copied,
+			Operations:        map[string]int{},
+			FirstUsed:         now,
+		}
+		l.uses[id] = use
+	}
+	use.Operations[operation]++
+	use.LastUsed = now
+}
+
+// Uses returns the contexts used with the key with the given ARN, or with
+// every key if keyArn is empty, ordered by key and then first use.
+func (l *ContextLog) Uses(keyArn string) []ContextUse {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	out := []ContextUse{}
+	for _, use := range l.uses {
+		if keyArn != "" && use.KeyArn != keyArn {
+			continue
+		}
+		copied := *use
+		copied.Operations = map[string]int{}
+		for op, n := range use.Operations {
+			copied.Operations[op] = n
+		}
+		out = append(out, copied)
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].KeyArn != out[j].KeyArn {
+			return out[i].KeyArn < out[j].KeyArn
+		}
+		return out[i].FirstUsed.Before(out[j].FirstUsed)
+	})
+	return out
+}
+
+// ServeHTTP serves the recorded uses as a JSON array, filtered by the keyArn
+// query parameter if given.
+func (l *ContextLog) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	body, err := json.Marshal(l.Uses(req.URL.Query().Get("keyArn")))
+	if err != nil {
+		http.Error(resp, err.Error(), 500)
+		return
+	}
+
+	resp.Header().Add("Content-Type", "application/json")
+	resp.Write(body)
+}
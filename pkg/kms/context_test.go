@@ -0,0 +1,166 @@
+package kms_test
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/fernomac/aws-local/pkg/kms"
+)
+
+func TestEncryptionContextMismatch(t *testing.T) {
+	store := kms.New()
+	key, err := store.CreateKey(&kms.CreateKeyRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc, err := store.Encrypt(&kms.EncryptRequest{
+		KeyID:             key.KeyMetadata.KeyID,
+		Plaintext:         "aGk=",
+		EncryptionContext: map[string]string{"tenant": "a", "purpose": "test"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		ctx  map[string]string
+		code string
+	}{
+		{map[string]string{"tenant": "a", "purpose": "test"}, ""},
+		{map[string]string{"purpose": "test", "tenant": "a"}, ""},
+		{map[string]string{"tenant": "b", "purpose": "test"}, "InvalidCiphertextException"},
+		{map[string]string{"tenant": "a"}, "InvalidCiphertextException"},
+		{map[string]string{"tenant": "a", "purpose": "test", "extra": "x"}, "InvalidCiphertextException"},
+		{nil, "InvalidCiphertextException"},
+	}
+
+	for _, test := range tests {
+		_, err := store.Decrypt(&kms.DecryptRequest{CiphertextBlob: enc.CiphertextBlob, EncryptionContext: test.ctx})
+		if got := code(err); got != test.code {
+			t.Errorf("%v: got %v, want %v", test.ctx, got, test.code)
+		}
+	}
+}
+
+func TestStrictEncryptionContext(t *testing.T) {
+	store := kms.New(kms.WithStrictEncryptionContext(map[string][]string{
+		"alias/strict": {"purpose"},
+	}))
+	tagged, err := store.CreateKey(&kms.CreateKeyRequest{
+		Tags: []kms.Tag{{TagKey: kms.RequiredContextTag, TagValue: "tenant, region"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	aliased, err := store.CreateKey(&kms.CreateKeyRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.CreateAlias(&kms.CreateAliasRequest{AliasName: "alias/strict", TargetKeyID: aliased.KeyMetadata.KeyID}); err != nil {
+		t.Fatal(err)
+	}
+	plain, err := store.CreateKey(&kms.CreateKeyRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		keyID string
+		ctx   map[string]string
+		code  string
+	}{
+		{"tagged with all keys", tagged.KeyMetadata.KeyID, map[string]string{"tenant": "a", "region": "r"}, ""},
+		{"tagged with extra keys", tagged.KeyMetadata.KeyID, map[string]string{"tenant": "a", "region": "r", "x": "y"}, ""},
+		{"tagged missing a key", tagged.KeyMetadata.KeyID, map[string]string{"tenant": "a"}, "ValidationException"},
+		{"tagged without context", tagged.KeyMetadata.KeyID, nil, "ValidationException"},
+		{"aliased with key", aliased.KeyMetadata.KeyID, map[string]string{"purpose": "p"}, ""},
+		{"aliased by alias", "alias/strict", map[string]string{"purpose": "p"}, ""},
+		{"aliased without key", aliased.KeyMetadata.KeyID, map[string]string{"tenant": "a"}, "ValidationException"},
+		{"plain without context", plain.KeyMetadata.KeyID, nil, ""},
+	}
+
+	for _, test := range tests {
+		_, err := store.Encrypt(&kms.EncryptRequest{KeyID: test.keyID, Plaintext: "aGk=", EncryptionContext: test.ctx})
+		if got := code(err); got != test.code {
+			t.Errorf("%v: Encrypt got %v, want %v", test.name, got, test.code)
+		}
+	}
+
+	// A blob sealed before the key required a context can't be opened
+	// without it once the key does.
+	enc, err := store.Encrypt(&kms.EncryptRequest{KeyID: plain.KeyMetadata.KeyID, Plaintext: "aGk="})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.TagResource(&kms.TagResourceRequest{
+		KeyID: plain.KeyMetadata.KeyID,
+		Tags:  []kms.Tag{{TagKey: kms.RequiredContextTag, TagValue: "tenant"}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	_, err = store.Decrypt(&kms.DecryptRequest{CiphertextBlob: enc.CiphertextBlob})
+	if got := code(err); got != "ValidationException" {
+		t.Errorf("Decrypt got %v, want ValidationException", got)
+	}
+}
+
+func TestContextLog(t *testing.T) {
+	log := kms.NewContextLog()
+	store := kms.New(kms.WithContextLog(log))
+	first, err := store.CreateKey(&kms.CreateKeyRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := store.CreateKey(&kms.CreateKeyRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := map[string]string{"tenant": "a"}
+	var blob string
+	for i := 0; i < 2; i++ {
+		enc, err := store.Encrypt(&kms.EncryptRequest{KeyID: first.KeyMetadata.KeyID, Plaintext: "aGk=", EncryptionContext: ctx})
+		if err != nil {
+			t.Fatal(err)
+		}
+		blob = enc.CiphertextBlob
+	}
+	if _, err := store.Decrypt(&kms.DecryptRequest{CiphertextBlob: blob, EncryptionContext: ctx}); err != nil {
+		t.Fatal(err)
+	}
+	// Failed calls aren't recorded.
+	store.Decrypt(&kms.DecryptRequest{CiphertextBlob: blob, EncryptionContext: map[string]string{"tenant": "b"}})
+	if _, err := store.Encrypt(&kms.EncryptRequest{KeyID: second.KeyMetadata.KeyID, Plaintext: "aGk="}); err != nil {
+		t.Fatal(err)
+	}
+
+	uses := log.Uses(first.KeyMetadata.Arn)
+	if len(uses) != 1 {
+		t.Fatalf("got %v uses, want 1: %+v", len(uses), uses)
+	}
+	if !reflect.DeepEqual(uses[0].EncryptionContext, ctx) {
+		t.Errorf("got context %v, want %v", uses[0].EncryptionContext, ctx)
+	}
+	if want := map[string]int{"Encrypt": 2, "Decrypt": 1}; !reflect.DeepEqual(uses[0].Operations, want) {
+		t.Errorf("got operations %v, want %v", uses[0].Operations, want)
+	}
+	if uses[0].LastUsed.Before(uses[0].FirstUsed) {
+		t.Errorf("last used %v is before first used %v", uses[0].LastUsed, uses[0].FirstUsed)
+	}
+	if all := log.Uses(""); len(all) != 2 {
+		t.Errorf("got %v uses of all keys, want 2", len(all))
+	}
+
+	resp := httptest.NewRecorder()
+	log.ServeHTTP(resp, httptest.NewRequest("GET", "/?keyArn="+second.KeyMetadata.Arn, nil))
+	served := []kms.ContextUse{}
+	if err := json.Unmarshal(resp.Body.Bytes(), &served); err != nil {
+		t.Fatal(err)
+	}
+	if len(served) != 1 || served[0].KeyArn != second.KeyMetadata.Arn || served[0].Operations["Encrypt"] != 1 {
+		t.Errorf("served %+v", served)
+	}
+}
@@ -1,162 +1,128 @@
 package kms
 
 import (
-	"bytes"
-	"crypto/aes"
-	"crypto/cipher"
 	"crypto/rand"
 	"encoding/base64"
-	"errors"
-	"sort"
+
+	"github.com/fernomac/aws-local/pkg/common"
 )
 
-func makeAad(ctx map[string]string) []byte {
-	buf := bytes.Buffer{}
+// encryptionAlgorithms are the encryption algorithms KMS knows about.
+var encryptionAlgorithms = map[string]bool{
+	"SYMMETRIC_DEFAULT":  true,
+	"RSAES_OAEP_SHA_1":   true,
+	"RSAES_OAEP_SHA_256": true,
+	"SM2PKE":             true,
+}
 
-	keys := make([]string, len(ctx))
-	for key := range ctx {
-		keys = append(keys, key)
+// checkAlgorithm checks that the key supports the given encryption algorithm,
+// which defaults to SYMMETRIC_DEFAULT, and returns it.
+func checkAlgorithm(key *key, algorithm string) (string, error) {
+	if algorithm == "" {
+		algorithm = "SYMMETRIC_DEFAULT"
 	}
-
-	sort.Strings(keys)
-
-	for _, key := range keys {
-		buf.WriteString(key)
-		buf.WriteString(ctx[key])
+	if !encryptionAlgorithms[algorithm] {
+		return "", common.NewError("ValidationException")
 	}
 
-	return buf.Bytes()
-}
-
-func writeBytes(buf *bytes.Buffer, str []byte) error {
-	l := len(str)
-	if l > 0xFFFF {
-		return errors.New("InternalFailure")
+	for _, a := range key.meta.EncryptionAlgorithms {
+		if a == algorithm {
+			return algorithm, nil
+		}
 	}
-
-	buf.WriteByte(byte(l & 0xFF))
-	buf.WriteByte(byte((l >> 8) & 0xFF))
-	buf.Write(str)
-
-	return nil
+	return "", common.NewError("InvalidKeyUsageException")
 }
 
-func makeCiphertextBlob(keyID string, nonce []byte, ciphertext []byte) ([]byte, error) {
-	buf := bytes.Buffer{}
-
-	if err := buf.WriteByte( /*version=*/ 0); err != nil {
-		return nil, err
-	}
-	if err := writeBytes(&buf, []byte(keyID)); err != nil {
-		return nil, err
-	}
-	if err := writeBytes(&buf, nonce); err != nil {
-		return nil, err
-	}
-	if err := writeBytes(&buf, ciphertext); err != nil {
-		return nil, err
-	}
-
-	return buf.Bytes(), nil
+// errNoKeyMaterial is returned for a key that has no key material to use,
+// such as an EXTERNAL key whose material hasn't been imported.
+func errNoKeyMaterial() error {
+	return common.Errorf("KMSInvalidStateException", "The key has no key material.")
 }
 
-func readLen(buf *bytes.Reader) (int, error) {
-	low, err := buf.ReadByte()
-	if err != nil {
-		return 0, err
+// seal encrypts plaintext with the key material, wherever it lives. Callers
+// check the key's state first. The AEAD is safe for concurrent use, so
+// callers don't hold the key's lock while using it.
+func (key *key) seal(plaintext []byte, aad []byte) ([]byte, []byte, []byte, error) {
+	if key.store != nil {
+		iv, ciphertext, tag, err := key.store.backend.Encrypt(key.externalID, plaintext, aad)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if len(tag) != tagSize {
+			return nil, nil, nil, common.NewError("KMSInternalException")
+		}
+		return iv, ciphertext, tag, nil
+	}
+	if key.aead == nil {
+		return nil, nil, nil, errNoKeyMaterial()
 	}
 
-	high, err := buf.ReadByte()
-	if err != nil {
-		return 0, err
+	iv := make([]byte, key.aead.NonceSize())
+	if _, err := rand.Read(iv); err != nil {
+		return nil, nil, nil, err
 	}
 
-	return (int(high) << 8) | int(low), nil
+	sealed := key.aead.Seal(nil, iv, plaintext, aad)
+	return iv, sealed[:len(sealed)-tagSize], sealed[len(sealed)-tagSize:], nil
 }
 
-func readBytes(buf *bytes.Reader) ([]byte, error) {
-	len, err := readLen(buf)
-	if err != nil {
-		return nil, err
+// open reverses seal.
+func (key *key) open(iv []byte, ciphertext []byte, tag []byte, aad []byte) ([]byte, error) {
+	if key.store != nil {
+		return key.store.backend.Decrypt(key.externalID, iv, ciphertext, tag, aad)
 	}
-
-	str := make([]byte, len)
-	_, err = buf.Read(str)
-	if err != nil {
-		return nil, err
+	if key.aead == nil {
+		return nil, errNoKeyMaterial()
 	}
 
-	return str, nil
-}
-
-func readString(buf *bytes.Reader) (string, error) {
-	str, err := readBytes(buf)
+	// A wrong encryption context fails authentication just like a tampered
+	// ciphertext does.
+	sealed := append(append([]byte(nil), ciphertext...), tag...)
+	plaintext, err := key.aead.Open(nil, iv, sealed, aad)
 	if err != nil {
-		return "", err
+		return nil, common.NewError("InvalidCiphertextException")
 	}
-	return string(str), nil
+	return plaintext, nil
 }
 
-func parseCiphertextBlob(ciphertextBlob []byte) (string, []byte, []byte, error) {
-	buf := bytes.NewReader(ciphertextBlob)
+// dryRunError is what an operation returns instead of its result when the
+// request's DryRun flag is set and everything checks out.
+func dryRunError() error {
+	return common.Errorf("DryRunOperationException", "The request would have succeeded, but the DryRun option is set.")
+}
 
-	ver, err := buf.ReadByte()
-	if err != nil {
-		return "", nil, nil, err
-	}
-	if ver != 0 {
-		return "", nil, nil, errors.New("InvalidCiphertextException")
+// encrypt encrypts plaintext under the key, binding ctx to it. If dryRun is
+// set it only does the checks, returning a nil ciphertext.
+func (k *kms) encrypt(plaintext []byte, ctx map[string]string, key *key, operation string, dryRun bool) ([]byte, error) {
+	if err := k.checkContext(key, ctx); err != nil {
+		return nil, err
 	}
-
-	keyID, err := readString(buf)
-	if err != nil {
-		return "", nil, nil, err
+	if dryRun {
+		return nil, nil
 	}
 
-	nonce, err := readBytes(buf)
-	if err != nil {
-		return "", nil, nil, err
+	blob := &ciphertextBlob{
+		keyArn:    key.meta.Arn,
+		versionID: key.version,
 	}
 
-	ciphertext, err := readBytes(buf)
-	if err != nil {
-		return "", nil, nil, err
-	}
-
-	if buf.Len() != 0 {
-		return "", nil, nil, errors.New("InvalidCiphertextException")
-	}
-
-	return keyID, nonce, ciphertext, nil
-}
-
-func encrypt(plaintext []byte, ctx map[string]string, key *key) ([]byte, error) {
-	block, err := aes.NewCipher(key.key)
+	header, err := blob.header()
 	if err != nil {
 		return nil, err
 	}
 
-	aead, err := cipher.NewGCM(block)
+	blob.iv, blob.ciphertext, blob.tag, err = key.seal(plaintext, makeAad(header, ctx))
 	if err != nil {
 		return nil, err
 	}
 
-	nonce := make([]byte, aead.NonceSize())
-	if _, err := rand.Read(nonce); err != nil {
-		return nil, err
-	}
-
-	aad := makeAad(ctx)
-	ciphertext := aead.Seal(nil, nonce, plaintext, aad)
-	return makeCiphertextBlob(key.meta.KeyID, nonce, ciphertext)
+	k.contexts.record(key.meta.Arn, operation, ctx)
+	return blob.marshal()
 }
 
 func (k *kms) doGDK(req *GenerateDataKeyRequest, withPlaintext bool) (*GenerateDataKeyResult, error) {
-	k.lock.Lock()
-	defer k.lock.Unlock()
-
 	if req.GrantTokens != nil {
-		return nil, errors.New("GrantsNotSupported")
+		return nil, common.NewError("GrantsNotSupported")
 	}
 
 	len := req.NumberOfBytes
@@ -166,41 +132,56 @@ func (k *kms) doGDK(req *GenerateDataKeyRequest, withPlaintext bool) (*GenerateD
 		} else if req.KeySpec == "AES_256" {
 			len = 32
 		} else {
-			return nil, errors.New("InvalidKeyUsageException")
+			return nil, common.NewError("InvalidKeyUsageException")
 		}
 	} else if req.KeySpec != "" {
-		return nil, errors.New("InvalidParameterCombination")
+		return nil, common.NewError("InvalidParameterCombination")
 	}
 
-	key := k.get(req.KeyID)
-	if key == nil {
-		return nil, errors.New("NotFoundException")
+	doc, conds, err := k.recipient(req.Recipient)
+	if err != nil {
+		return nil, err
+	}
+
+	operation := "GenerateDataKey"
+	if !withPlaintext {
+		operation = "GenerateDataKeyWithoutPlaintext"
 	}
-	if !key.meta.Enabled {
-		return nil, errors.New("DisabledException")
+	key, err := k.authorized(req.KeyID, "kms:"+operation, encryptionContextConditions(req.EncryptionContext).merge(conds))
+	if err != nil {
+		return nil, err
+	}
+	if err := key.allows(operation); err != nil {
+		return nil, err
 	}
 
 	plaintext := make([]byte, len)
-	_, err := rand.Read(plaintext)
-	if err != nil {
+	if _, err := rand.Read(plaintext); err != nil {
 		return nil, err
 	}
 
-	ciphertext, err := encrypt(plaintext, req.EncryptionContext, key)
+	ciphertext, err := k.encrypt(plaintext, req.EncryptionContext, key, operation, req.DryRun)
 	if err != nil {
 		return nil, err
 	}
-
-	encodedPlaintext := ""
-	if withPlaintext {
-		encodedPlaintext = base64.StdEncoding.EncodeToString(plaintext)
+	if req.DryRun {
+		return nil, dryRunError()
 	}
 
-	return &GenerateDataKeyResult{
-		KeyID:          key.meta.KeyID,
-		Plaintext:      encodedPlaintext,
+	result := &GenerateDataKeyResult{
+		KeyID:          key.meta.Arn,
 		CiphertextBlob: base64.StdEncoding.EncodeToString(ciphertext),
-	}, nil
+	}
+
+	if doc != nil {
+		if result.CiphertextForRecipient, err = sealFor(doc, plaintext); err != nil {
+			return nil, err
+		}
+	} else if withPlaintext {
+		result.Plaintext = base64.StdEncoding.EncodeToString(plaintext)
+	}
+
+	return result, nil
 }
 
 func (k *kms) GenerateDataKey(req *GenerateDataKeyRequest) (*GenerateDataKeyResult, error) {
@@ -208,23 +189,28 @@ func (k *kms) GenerateDataKey(req *GenerateDataKeyRequest) (*GenerateDataKeyResu
 }
 
 func (k *kms) GenerateDataKeyWithoutPlaintext(req *GenerateDataKeyRequest) (*GenerateDataKeyResult, error) {
+	if req.Recipient != nil {
+		return nil, common.NewError("ValidationException")
+	}
 	return k.doGDK(req, false)
 }
 
 func (k *kms) Encrypt(req *EncryptRequest) (*EncryptResult, error) {
-	k.lock.Lock()
-	defer k.lock.Unlock()
-
 	if req.GrantTokens != nil {
-		return nil, errors.New("GrantsNotSupported")
+		return nil, common.NewError("GrantsNotSupported")
 	}
 
-	key := k.get(req.KeyID)
-	if key == nil {
-		return nil, errors.New("NotFoundException")
+	key, err := k.authorized(req.KeyID, "kms:Encrypt", encryptionContextConditions(req.EncryptionContext))
+	if err != nil {
+		return nil, err
 	}
-	if !key.meta.Enabled {
-		return nil, errors.New("DisabledException")
+	if err := key.allows("Encrypt"); err != nil {
+		return nil, err
+	}
+
+	algorithm, err := checkAlgorithm(key, req.EncryptionAlgorithm)
+	if err != nil {
+		return nil, err
 	}
 
 	plaintext, err := base64.StdEncoding.DecodeString(req.Plaintext)
@@ -232,56 +218,85 @@ func (k *kms) Encrypt(req *EncryptRequest) (*EncryptResult, error) {
 		return nil, err
 	}
 
-	ciphertext, err := encrypt(plaintext, req.EncryptionContext, key)
+	ciphertext, err := k.encrypt(plaintext, req.EncryptionContext, key, "Encrypt", req.DryRun)
 	if err != nil {
 		return nil, err
 	}
+	if req.DryRun {
+		return nil, dryRunError()
+	}
 
 	return &EncryptResult{
-		KeyID:          key.meta.KeyID,
-		CiphertextBlob: base64.StdEncoding.EncodeToString(ciphertext),
+		KeyID:               key.meta.Arn,
+		CiphertextBlob:      base64.StdEncoding.EncodeToString(ciphertext),
+		EncryptionAlgorithm: algorithm,
 	}, nil
 }
 
-func (k *kms) decrypt(ciphertextBlob []byte, ctx map[string]string) (string, []byte, error) {
-	keyID, nonce, ciphertext, err := parseCiphertextBlob(ciphertextBlob)
+// decrypt decrypts a ciphertext blob, checking that the key's policy and
+// state allow the operation. If keyID is set, the blob must have been produced by that key.
+// It returns the ARN of the key and the algorithm used along with the
+// plaintext, which is nil if dryRun is set.
+func (k *kms) decrypt(ciphertextBlob []byte, ctx map[string]string, keyID string, algorithm string, operation string, conds conditions, dryRun bool) (string, string, []byte, error) {
+	blob, err := parseCiphertextBlob(ciphertextBlob)
 	if err != nil {
-		return "", nil, err
+		return "", "", nil, err
 	}
 
-	key := k.get(keyID)
-	if key == nil {
-		return "", nil, errors.New("NotFoundException")
+	key, err := k.lookup(blob.keyArn)
+	if err != nil {
+		return "", "", nil, err
+	}
+	if err := k.authorize(key, "kms:"+operation, encryptionContextConditions(ctx).merge(conds).merge(requestAliasConditions(keyID))); err != nil {
+		return "", "", nil, err
+	}
+	if err := key.allows(operation); err != nil {
+		return "", "", nil, err
 	}
-	if !key.meta.Enabled {
-		return "", nil, errors.New("DisabledException")
+
+	if keyID != "" {
+		pinned, err := k.lookup(keyID)
+		if err != nil {
+			return "", "", nil, err
+		}
+		if pinned != key {
+			return "", "", nil, common.NewError("IncorrectKeyException")
+		}
 	}
 
-	block, err := aes.NewCipher(key.key)
+	algorithm, err = checkAlgorithm(key, algorithm)
 	if err != nil {
-		return "", nil, err
+		return "", "", nil, err
 	}
 
-	aead, err := cipher.NewGCM(block)
+	if blob.versionID != key.version {
+		return "", "", nil, common.NewError("InvalidCiphertextException")
+	}
+
+	header, err := blob.header()
 	if err != nil {
-		return "", nil, err
+		return "", "", nil, err
 	}
 
-	aad := makeAad(ctx)
-	plaintext, err := aead.Open(nil, nonce, ciphertext, aad)
+	if err := k.checkContext(key, ctx); err != nil {
+		return "", "", nil, err
+	}
+	if dryRun {
+		return key.meta.Arn, algorithm, nil, nil
+	}
+
+	plaintext, err := key.open(blob.iv, blob.ciphertext, blob.tag, makeAad(header, ctx))
 	if err != nil {
-		return "", nil, err
+		return "", "", nil, err
 	}
 
-	return keyID, plaintext, nil
+	k.contexts.record(key.meta.Arn, operation, ctx)
+	return key.meta.Arn, algorithm, plaintext, nil
 }
 
 func (k *kms) Decrypt(req *DecryptRequest) (*DecryptResult, error) {
-	k.lock.Lock()
-	defer k.lock.Unlock()
-
 	if req.GrantTokens != nil {
-		return nil, errors.New("GrantsNotSupported")
+		return nil, common.NewError("GrantsNotSupported")
 	}
 
 	ciphertextBlob, err := base64.StdEncoding.DecodeString(req.CiphertextBlob)
@@ -289,23 +304,38 @@ func (k *kms) Decrypt(req *DecryptRequest) (*DecryptResult, error) {
 		return nil, err
 	}
 
-	keyID, plaintext, err := k.decrypt(ciphertextBlob, req.EncryptionContext)
+	doc, conds, err := k.recipient(req.Recipient)
 	if err != nil {
 		return nil, err
 	}
 
-	return &DecryptResult{
-		KeyID:     keyID,
-		Plaintext: base64.StdEncoding.EncodeToString(plaintext),
-	}, nil
+	keyArn, algorithm, plaintext, err := k.decrypt(ciphertextBlob, req.EncryptionContext, req.KeyID, req.EncryptionAlgorithm, "Decrypt", conds, req.DryRun)
+	if err != nil {
+		return nil, err
+	}
+	if req.DryRun {
+		return nil, dryRunError()
+	}
+
+	result := &DecryptResult{
+		KeyID:               keyArn,
+		EncryptionAlgorithm: algorithm,
+	}
+
+	if doc != nil {
+		if result.CiphertextForRecipient, err = sealFor(doc, plaintext); err != nil {
+			return nil, err
+		}
+	} else {
+		result.Plaintext = base64.StdEncoding.EncodeToString(plaintext)
+	}
+
+	return result, nil
 }
 
 func (k *kms) ReEncrypt(req *ReEncryptRequest) (*ReEncryptResult, error) {
-	k.lock.Lock()
-	defer k.lock.Unlock()
-
 	if req.GrantTokens != nil {
-		return nil, errors.New("GrantsNotSupported")
+		return nil, common.NewError("GrantsNotSupported")
 	}
 
 	ciphertextBlob, err := base64.StdEncoding.DecodeString(req.CiphertextBlob)
@@ -313,27 +343,37 @@ func (k *kms) ReEncrypt(req *ReEncryptRequest) (*ReEncryptResult, error) {
 		return nil, err
 	}
 
-	sourceKeyID, plaintext, err := k.decrypt(ciphertextBlob, req.SourceEncryptionContext)
+	sourceKeyArn, sourceAlgorithm, plaintext, err := k.decrypt(ciphertextBlob, req.SourceEncryptionContext, req.SourceKeyID, req.SourceEncryptionAlgorithm, "ReEncryptFrom", nil, req.DryRun)
 	if err != nil {
 		return nil, err
 	}
 
-	key := k.get(req.DestinationKeyID)
-	if key == nil {
-		return nil, errors.New("NotFoundException")
+	key, err := k.authorized(req.DestinationKeyID, "kms:ReEncryptTo", encryptionContextConditions(req.DestinationEncryptionContext))
+	if err != nil {
+		return nil, err
 	}
-	if !key.meta.Enabled {
-		return nil, errors.New("DisabledException")
+	if err := key.allows("ReEncryptTo"); err != nil {
+		return nil, err
 	}
 
-	ciphertext, err := encrypt(plaintext, req.DestinationEncryptionContext, key)
+	destinationAlgorithm, err := checkAlgorithm(key, req.DestinationEncryptionAlgorithm)
 	if err != nil {
 		return nil, err
 	}
 
+	ciphertext, err := k.encrypt(plaintext, req.DestinationEncryptionContext, key, "ReEncryptTo", req.DryRun)
+	if err != nil {
+		return nil, err
+	}
+	if req.DryRun {
+		return nil, dryRunError()
+	}
+
 	return &ReEncryptResult{
-		KeyID:          key.meta.KeyID,
-		SourceKeyID:    sourceKeyID,
-		CiphertextBlob: base64.StdEncoding.EncodeToString(ciphertext),
+		KeyID:                          key.meta.Arn,
+		SourceKeyID:                    sourceKeyArn,
+		CiphertextBlob:                 base64.StdEncoding.EncodeToString(ciphertext),
+		SourceEncryptionAlgorithm:      sourceAlgorithm,
+		DestinationEncryptionAlgorithm: destinationAlgorithm,
 	}, nil
 }
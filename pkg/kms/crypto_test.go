@@ -0,0 +1,151 @@
+package kms_test
+
+import (
+	"testing"
+
+	"github.com/fernomac/aws-local/pkg/common"
+	"github.com/fernomac/aws-local/pkg/kms"
+)
+
+// TestKeyWithoutMaterial checks that an EXTERNAL key, which has no key
+// material until it's imported, fails cryptographic operations with
+// KMSInvalidStateException rather than panicking.
+func TestKeyWithoutMaterial(t *testing.T) {
+	store := kms.New()
+	created, err := store.CreateKey(&kms.CreateKeyRequest{Origin: "EXTERNAL"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := created.KeyMetadata.KeyID
+	if created.KeyMetadata.KeyState != kms.KeyStatePendingImport {
+		t.Fatalf("key state is %v", created.KeyMetadata.KeyState)
+	}
+
+	tests := []struct {
+		op string
+		do func() error
+	}{
+		{"Encrypt", func() error {
+			_, err := store.Encrypt(&kms.EncryptRequest{KeyID: id, Plaintext: "aGk="})
+			return err
+		}},
+		{"GenerateDataKey", func() error {
+			_, err := store.GenerateDataKey(&kms.GenerateDataKeyRequest{KeyID: id, KeySpec: "AES_256"})
+			return err
+		}},
+		{"GenerateDataKeyPair", func() error {
+			_, err := store.GenerateDataKeyPair(&kms.GenerateDataKeyPairRequest{KeyID: id, KeyPairSpec: "ECC_NIST_P256"})
+			return err
+		}},
+		{"EnableKey", func() error {
+			return store.EnableKey(&kms.EnableKeyRequest{KeyID: id})
+		}},
+	}
+
+	for _, test := range tests {
+		err := test.do()
+		if ce, ok := err.(common.Error); !ok || ce.Code != "KMSInvalidStateException" {
+			t.Errorf("%v: got %v, want KMSInvalidStateException", test.op, err)
+		}
+	}
+}
+
+func TestDecryptKeyPinning(t *testing.T) {
+	store := kms.New()
+	sealer, err := store.CreateKey(&kms.CreateKeyRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := store.CreateKey(&kms.CreateKeyRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.CreateAlias(&kms.CreateAliasRequest{AliasName: "alias/sealer", TargetKeyID: sealer.KeyMetadata.KeyID}); err != nil {
+		t.Fatal(err)
+	}
+	enc, err := store.Encrypt(&kms.EncryptRequest{KeyID: sealer.KeyMetadata.KeyID, Plaintext: "aGk="})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		keyID string
+		code  string
+	}{
+		{"", ""},
+		{sealer.KeyMetadata.KeyID, ""},
+		{sealer.KeyMetadata.Arn, ""},
+		{"alias/sealer", ""},
+		{other.KeyMetadata.KeyID, "IncorrectKeyException"},
+		{other.KeyMetadata.Arn, "IncorrectKeyException"},
+		{"alias/missing", "NotFoundException"},
+	}
+
+	for _, test := range tests {
+		_, err := store.Decrypt(&kms.DecryptRequest{CiphertextBlob: enc.CiphertextBlob, KeyID: test.keyID})
+		if got := code(err); got != test.code {
+			t.Errorf("Decrypt with %q: got %v, want %v", test.keyID, got, test.code)
+		}
+		_, err = store.ReEncrypt(&kms.ReEncryptRequest{
+			CiphertextBlob:   enc.CiphertextBlob,
+			SourceKeyID:      test.keyID,
+			DestinationKeyID: other.KeyMetadata.KeyID,
+		})
+		if got := code(err); got != test.code {
+			t.Errorf("ReEncrypt with %q: got %v, want %v", test.keyID, got, test.code)
+		}
+	}
+}
+
+func TestEncryptionAlgorithms(t *testing.T) {
+	store := kms.New()
+	key, err := store.CreateKey(&kms.CreateKeyRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := key.KeyMetadata.KeyID
+	enc, err := store.Encrypt(&kms.EncryptRequest{KeyID: id, Plaintext: "aGk="})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if enc.EncryptionAlgorithm != "SYMMETRIC_DEFAULT" {
+		t.Errorf("Encrypt reported algorithm %q", enc.EncryptionAlgorithm)
+	}
+
+	tests := []struct {
+		algorithm string
+		code      string
+	}{
+		{"", ""},
+		{"SYMMETRIC_DEFAULT", ""},
+		{"RSAES_OAEP_SHA_256", "InvalidKeyUsageException"},
+		{"SM2PKE", "InvalidKeyUsageException"},
+		{"BOGUS", "ValidationException"},
+	}
+
+	for _, test := range tests {
+		_, err := store.Encrypt(&kms.EncryptRequest{KeyID: id, Plaintext: "aGk=", EncryptionAlgorithm: test.algorithm})
+		if got := code(err); got != test.code {
+			t.Errorf("Encrypt with %q: got %v, want %v", test.algorithm, got, test.code)
+		}
+
+		dec, err := store.Decrypt(&kms.DecryptRequest{CiphertextBlob: enc.CiphertextBlob, EncryptionAlgorithm: test.algorithm})
+		if got := code(err); got != test.code {
+			t.Errorf("Decrypt with %q: got %v, want %v", test.algorithm, got, test.code)
+		} else if err == nil && dec.EncryptionAlgorithm != "SYMMETRIC_DEFAULT" {
+			t.Errorf("Decrypt with %q reported algorithm %q", test.algorithm, dec.EncryptionAlgorithm)
+		}
+
+		re, err := store.ReEncrypt(&kms.ReEncryptRequest{
+			CiphertextBlob:                 enc.CiphertextBlob,
+			DestinationKeyID:               id,
+			SourceEncryptionAlgorithm:      test.algorithm,
+			DestinationEncryptionAlgorithm: test.algorithm,
+		})
+		if got := code(err); got != test.code {
+			t.Errorf("ReEncrypt with %q: got %v, want %v", test.algorithm, got, test.code)
+		} else if err == nil && (re.SourceEncryptionAlgorithm != "SYMMETRIC_DEFAULT" || re.DestinationEncryptionAlgorithm != "SYMMETRIC_DEFAULT") {
+			t.Errorf("ReEncrypt with %q reported algorithms %q and %q", test.algorithm, re.SourceEncryptionAlgorithm, re.DestinationEncryptionAlgorithm)
+		}
+	}
+}
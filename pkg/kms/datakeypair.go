@@ -0,0 +1,106 @@
+package kms
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+
+	"github.com/fernomac/aws-local/pkg/common"
+)
+
+// keyPairGenerators make new asymmetric key pairs, by key pair spec.
+var keyPairGenerators = map[string]func() (crypto.Signer, error){
+	"RSA_2048":      func() (crypto.Signer, error) { return rsa.GenerateKey(rand.Reader, 2048) },
+	"RSA_3072":      func() (crypto.Signer, error) { return rsa.GenerateKey(rand.Reader, 3072) },
+	"RSA_4096":      func() (crypto.Signer, error) { return rsa.GenerateKey(rand.Reader, 4096) },
+	"ECC_NIST_P256": func() (crypto.Signer, error) { return ecdsa.GenerateKey(elliptic.P256(), rand.Reader) },
+	"ECC_NIST_P384": func() (crypto.Signer, error) { return ecdsa.GenerateKey(elliptic.P384(), rand.Reader) },
+	"ECC_NIST_P521": func() (crypto.Signer, error) { return ecdsa.GenerateKey(elliptic.P521(), rand.Reader) },
+}
+
+// doGDKPair does every check, including DryRun, before generating the key
+// pair: RSA key generation is slow enough that a refused request shouldn't
+// pay for it.
+func (k *kms) doGDKPair(req *GenerateDataKeyPairRequest, withPlaintext bool) (*GenerateDataKeyPairResult, error) {
+	if req.GrantTokens != nil {
+		return nil, common.NewError("GrantsNotSupported")
+	}
+	generate, ok := keyPairGenerators[req.KeyPairSpec]
+	if !ok {
+		return nil, common.NewError("ValidationException")
+	}
+
+	doc, conds, err := k.recipient(req.Recipient)
+	if err != nil {
+		return nil, err
+	}
+
+	operation := "GenerateDataKeyPair"
+	if !withPlaintext {
+		operation = "GenerateDataKeyPairWithoutPlaintext"
+	}
+	key, err := k.authorized(req.KeyID, "kms:"+operation, encryptionContextConditions(req.EncryptionContext).merge(conds))
+	if err != nil {
+		return nil, err
+	}
+	if err := key.allows(operation); err != nil {
+		return nil, err
+	}
+	if req.DryRun {
+		if err := k.checkContext(key, req.EncryptionContext); err != nil {
+			return nil, err
+		}
+		return nil, dryRunError()
+	}
+
+	priv, err := generate()
+	if err != nil {
+		return nil, err
+	}
+
+	privateKey, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return nil, err
+	}
+	publicKey, err := x509.MarshalPKIXPublicKey(priv.Public())
+	if err != nil {
+		return nil, err
+	}
+
+	ciphertext, err := k.encrypt(privateKey, req.EncryptionContext, key, operation, false)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &GenerateDataKeyPairResult{
+		KeyID:                    key.meta.Arn,
+		KeyPairSpec:              req.KeyPairSpec,
+		PrivateKeyCiphertextBlob: base64.StdEncoding.EncodeToString(ciphertext),
+		PublicKey:                base64.StdEncoding.EncodeToString(publicKey),
+	}
+
+	if doc != nil {
+		if result.CiphertextForRecipient, err = sealFor(doc, privateKey); err != nil {
+			return nil, err
+		}
+	} else if withPlaintext {
+		result.PrivateKeyPlaintext = base64.StdEncoding.EncodeToString(privateKey)
+	}
+
+	return result, nil
+}
+
+func (k *kms) GenerateDataKeyPair(req *GenerateDataKeyPairRequest) (*GenerateDataKeyPairResult, error) {
+	return k.doGDKPair(req, true)
+}
+
+func (k *kms) GenerateDataKeyPairWithoutPlaintext(req *GenerateDataKeyPairRequest) (*GenerateDataKeyPairResult, error) {
+	if req.Recipient != nil {
+		return nil, common.NewError("ValidationException")
+	}
+	return k.doGDKPair(req, false)
+}
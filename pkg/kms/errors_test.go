@@ -0,0 +1,85 @@
+package kms_test
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/fernomac/aws-local/pkg/common"
+	"github.com/fernomac/aws-local/pkg/kms"
+	"github.com/fernomac/aws-local/pkg/metrics"
+)
+
+type recorder struct {
+	calls []*common.Call
+}
+
+func (r *recorder) Observe(call *common.Call) {
+	r.calls = append(r.calls, call)
+}
+
+// TestErrorCodes checks that failed calls reach observers with their own
+// error codes rather than InternalFailure, which is what the audit trail and
+// the error metrics report.
+func TestErrorCodes(t *testing.T) {
+	store := kms.New()
+	key, err := store.CreateKey(&kms.CreateKeyRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	disabled, err := store.CreateKey(&kms.CreateKeyRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.DisableKey(&kms.DisableKeyRequest{KeyID: disabled.KeyMetadata.KeyID}); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := &recorder{}
+	handler := kms.NewHandler(store, rec)
+
+	tests := []struct {
+		op   string
+		body string
+		code string
+	}{
+		{"DescribeKey", `{"KeyId":"00000000-0000-0000-0000-000000000000"}`, "NotFoundException"},
+		{"Encrypt", `{"KeyId":"` + disabled.KeyMetadata.KeyID + `","Plaintext":"aGk="}`, "DisabledException"},
+		{"Decrypt", `{"CiphertextBlob":"bm90IGEgYmxvYg=="}`, "InvalidCiphertextException"},
+		{"CreateAlias", `{"AliasName":"nope","TargetKeyId":"` + key.KeyMetadata.KeyID + `"}`, "InvalidAliasNameException"},
+		{"Encrypt", `{"KeyId":"` + key.KeyMetadata.KeyID + `","Plaintext":"aGk=","DryRun":true}`, "DryRunOperationException"},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("POST", "/", strings.NewReader(test.body))
+		req.Header.Set("X-Amz-Target", "TrentService."+test.op)
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+
+		if resp.Code != 400 || !strings.Contains(resp.Body.String(), test.code) {
+			t.Errorf("%v: %v %v", test.op, resp.Code, resp.Body.String())
+		}
+		call := rec.calls[len(rec.calls)-1]
+		if got := call.ErrorCode(); got != test.code {
+			t.Errorf("%v: observed %v, want %v", test.op, got, test.code)
+		}
+	}
+}
+
+// TestErrorMetrics checks that aws_local_errors_total counts KMS errors by
+// their own type.
+func TestErrorMetrics(t *testing.T) {
+	registry := metrics.NewRegistry()
+	handler := kms.NewHandler(kms.New(), metrics.NewCallMetrics(registry))
+
+	req := httptest.NewRequest("POST", "/", strings.NewReader(`{"KeyId":"alias/missing"}`))
+	req.Header.Set("X-Amz-Target", "TrentService.DescribeKey")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	resp := httptest.NewRecorder()
+	registry.ServeHTTP(resp, httptest.NewRequest("GET", "/metrics", nil))
+	want := `aws_local_errors_total{service="kms.amazonaws.com",operation="DescribeKey",type="NotFoundException"} 1`
+	if !strings.Contains(resp.Body.String(), want) {
+		t.Fatalf("missing %v in\n%v", want, resp.Body.String())
+	}
+}
@@ -1,14 +1,55 @@
 package kms
 
-import "errors"
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"time"
+
+	"github.com/fernomac/aws-local/pkg/common"
+)
+
+// grantOperations are the operations a grant can allow.
+var grantOperations = map[string]bool{
+	"Decrypt":                             true,
+	"Encrypt":                             true,
+	"GenerateDataKey":                     true,
+	"GenerateDataKeyWithoutPlaintext":     true,
+	"ReEncryptFrom":                       true,
+	"ReEncryptTo":                         true,
+	"Sign":                                true,
+	"Verify":                              true,
+	"GetPublicKey":                        true,
+	"CreateGrant":                         true,
+	"RetireGrant":                         true,
+	"DescribeKey":                         true,
+	"GenerateDataKeyPair":                 true,
+	"GenerateDataKeyPairWithoutPlaintext": true,
+	"GenerateMac":                         true,
+	"VerifyMac":                           true,
+	"DeriveSharedSecret":                  true,
+}
+
+// newGrantToken makes a new opaque grant token.
+func newGrantToken() (string, error) {
+	b := make([]byte, 48)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
 
 func (k *kms) ListGrants(req *ListGrantsRequest) (*ListGrantsResult, error) {
-	k.lock.Lock()
-	defer k.lock.Unlock()
+	key, err := k.lookup(req.KeyID)
+	if err != nil {
+		return nil, err
+	}
+
+	k.lock.RLock()
+	defer k.lock.RUnlock()
 
 	grants := []GrantListEntry{}
 	for _, grant := range k.grants {
-		if grant.KeyID == req.KeyID {
+		if grant.KeyID == key.meta.Arn {
 			grants = append(grants, *grant)
 		}
 	}
@@ -20,8 +61,8 @@ func (k *kms) ListGrants(req *ListGrantsRequest) (*ListGrantsResult, error) {
 }
 
 func (k *kms) ListRetireableGrants(req *ListRetireableGrantsRequest) (*ListRetireableGrantsResult, error) {
-	k.lock.Lock()
-	defer k.lock.Unlock()
+	k.lock.RLock()
+	defer k.lock.RUnlock()
 
 	grants := []GrantListEntry{}
 	for _, grant := range k.grants {
@@ -36,46 +77,160 @@ func (k *kms) ListRetireableGrants(req *ListRetireableGrantsRequest) (*ListRetir
 	}, nil
 }
 
+// CreateGrant records a grant. Grants are listed, retired and revoked like
+// the real thing, but don't give anyone access: key policies alone decide who
+// can use a key, and requests that pass grant tokens are refused.
 func (k *kms) CreateGrant(req *CreateGrantRequest) (*CreateGrantResult, error) {
-	// TODO: Implement me?
-	return nil, errors.New("GrantsNotSupported")
+	if req.GrantTokens != nil {
+		return nil, common.NewError("GrantsNotSupported")
+	}
+	if req.GranteePrincipal == "" || len(req.Operations) == 0 {
+		return nil, common.NewError("ValidationException")
+	}
+	for _, op := range req.Operations {
+		if !grantOperations[op] {
+			return nil, common.NewError("ValidationException")
+		}
+	}
+	if req.Constraints != nil && req.Constraints.EncryptionContextEquals != nil && req.Constraints.EncryptionContextSubset != nil {
+		return nil, common.NewError("ValidationException")
+	}
+
+	key, err := k.authorized(req.KeyID, "kms:CreateGrant", nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := key.allows("CreateGrant"); err != nil {
+		return nil, err
+	}
+	if req.DryRun {
+		return nil, dryRunError()
+	}
+
+	// Grant IDs are 64 hex digits, just like key material IDs.
+	id, err := newVersionID()
+	if err != nil {
+		return nil, err
+	}
+	token, err := newGrantToken()
+	if err != nil {
+		return nil, err
+	}
+
+	k.lock.Lock()
+	defer k.lock.Unlock()
+
+	k.grants[token] = &GrantListEntry{
+		Constraints:       req.Constraints,
+		CreationDate:      time.Now().Unix(),
+		GranteePrincipal:  req.GranteePrincipal,
+		GrantID:           id,
+		IssuingAccount:    "arn:aws:iam::" + common.AccountID + ":root",
+		KeyID:             key.meta.Arn,
+		Name:              req.Name,
+		Operations:        req.Operations,
+		RetiringPrincipal: req.RetiringPrincipal,
+	}
+
+	return &CreateGrantResult{
+		GrantID:    id,
+		GrantToken: token,
+	}, nil
 }
 
-func (k *kms) findGrantToken(keyID string, grantID string) string {
+// findGrantToken finds the token of a grant on the key with the given ARN.
+// The caller must hold k.lock.
+func (k *kms) findGrantToken(keyArn string, grantID string) string {
 	for token, grant := range k.grants {
-		if grant.KeyID == keyID && grant.GrantID == grantID {
+		if grant.KeyID == keyArn && grant.GrantID == grantID {
 			return token
 		}
 	}
 	return ""
 }
 
+// canRetire checks that a grant may be retired. KMS doesn't identify its
+// callers, so whoever retires a grant that names a retiring principal, or
+// that allows RetireGrant, is taken to be that principal; any other grant can
+// only be retired by those the key policy allows kms:RetireGrant.
+func (k *kms) canRetire(grant *GrantListEntry) error {
+	key, err := k.lookup(grant.KeyID)
+	if err != nil {
+		return err
+	}
+	if err := key.allows("RetireGrant"); err != nil {
+		return err
+	}
+
+	if grant.RetiringPrincipal != "" {
+		return nil
+	}
+	for _, op := range grant.Operations {
+		if op == "RetireGrant" {
+			return nil
+		}
+	}
+	return k.authorize(key, "kms:RetireGrant", nil)
+}
+
 func (k *kms) RetireGrant(req *RetireGrantRequest) error {
-	k.lock.Lock()
-	defer k.lock.Unlock()
+	keyArn := ""
+	if req.GrantToken == "" {
+		key, err := k.lookup(req.KeyID)
+		if err != nil {
+			return err
+		}
+		keyArn = key.meta.Arn
+	}
 
-	if req.GrantToken != "" {
-		delete(k.grants, req.GrantToken)
-	} else {
-		token := k.findGrantToken(req.KeyID, req.GrantID)
-		if token == "" {
-			return errors.New("NotFoundException")
+	k.lock.RLock()
+	token := req.GrantToken
+	if token == "" {
+		token = k.findGrantToken(keyArn, req.GrantID)
+	}
+	grant := k.grants[token]
+	k.lock.RUnlock()
+
+	if grant == nil {
+		if req.GrantToken != "" {
+			return common.NewError("InvalidGrantTokenException")
 		}
-		delete(k.grants, token)
+		return common.NewError("NotFoundException")
+	}
+	if err := k.canRetire(grant); err != nil {
+		return err
+	}
+	if req.DryRun {
+		return dryRunError()
 	}
 
+	k.lock.Lock()
+	defer k.lock.Unlock()
+
+	if _, ok := k.grants[token]; !ok {
+		return common.NewError("NotFoundException")
+	}
+	delete(k.grants, token)
 	return nil
 }
 
 func (k *kms) RevokeGrant(req *RevokeGrantRequest) error {
+	key, err := k.authorized(req.KeyID, "kms:RevokeGrant", nil)
+	if err != nil {
+		return err
+	}
+
 	k.lock.Lock()
 	defer k.lock.Unlock()
 
-	token := k.findGrantToken(req.KeyID, req.GrantID)
+	token := k.findGrantToken(key.meta.Arn, req.GrantID)
 	if token == "" {
-		return errors.New("NotFoundException")
+		return common.NewError("NotFoundException")
+	}
+	if req.DryRun {
+		return dryRunError()
 	}
-	delete(k.grants, token)
 
+	delete(k.grants, token)
 	return nil
 }
@@ -0,0 +1,141 @@
+package kms_test
+
+import (
+	"testing"
+
+	"github.com/fernomac/aws-local/pkg/common"
+	"github.com/fernomac/aws-local/pkg/kms"
+)
+
+// noRetirePolicy lets the account do anything with a key except retire its
+// grants.
+const noRetirePolicy = `{
+  "Version": "2012-10-17",
+  "Statement": [
+    {"Effect": "Allow", "Principal": {"AWS": "*"}, "Action": "kms:*", "Resource": "*"},
+    {"Effect": "Deny", "Principal": {"AWS": "*"}, "Action": "kms:RetireGrant", "Resource": "*"}
+  ]
+}`
+
+func code(err error) string {
+	if ce, ok := err.(common.Error); ok {
+		return ce.Code
+	}
+	if err != nil {
+		return err.Error()
+	}
+	return ""
+}
+
+func TestRetireGrant(t *testing.T) {
+	store := kms.New()
+	open, err := store.CreateKey(&kms.CreateKeyRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed, err := store.CreateKey(&kms.CreateKeyRequest{Policy: noRetirePolicy})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		keyID    string
+		retiring string
+		ops      []string
+		byToken  bool
+		dryRun   bool
+		code     string
+	}{
+		{"policy allows", open.KeyMetadata.KeyID, "", []string{"Encrypt"}, false, false, ""},
+		{"policy allows by token", open.KeyMetadata.KeyID, "", []string{"Encrypt"}, true, false, ""},
+		{"policy denies", closed.KeyMetadata.KeyID, "", []string{"Encrypt"}, false, false, "AccessDeniedException"},
+		{"policy denies by token", closed.KeyMetadata.KeyID, "", []string{"Encrypt"}, true, false, "AccessDeniedException"},
+		{"policy denies dry run", closed.KeyMetadata.KeyID, "", []string{"Encrypt"}, false, true, "AccessDeniedException"},
+		{"retiring principal", closed.KeyMetadata.KeyID, "arn:aws:iam::000000000000:role/r", []string{"Encrypt"}, false, false, ""},
+		{"grantee may retire", closed.KeyMetadata.KeyID, "", []string{"Encrypt", "RetireGrant"}, true, false, ""},
+		{"dry run", open.KeyMetadata.KeyID, "", []string{"Encrypt"}, false, true, "DryRunOperationException"},
+	}
+
+	for _, test := range tests {
+		grant, err := store.CreateGrant(&kms.CreateGrantRequest{
+			KeyID:             test.keyID,
+			GranteePrincipal:  "arn:aws:iam::000000000000:role/grantee",
+			Operations:        test.ops,
+			RetiringPrincipal: test.retiring,
+		})
+		if err != nil {
+			t.Fatalf("%v: %v", test.name, err)
+		}
+
+		req := &kms.RetireGrantRequest{DryRun: test.dryRun}
+		if test.byToken {
+			req.GrantToken = grant.GrantToken
+		} else {
+			req.KeyID, req.GrantID = test.keyID, grant.GrantID
+		}
+		if got := code(store.RetireGrant(req)); got != test.code {
+			t.Errorf("%v: got %v, want %v", test.name, got, test.code)
+		}
+
+		// The grant is gone if and only if the call succeeded.
+		left, err := store.ListGrants(&kms.ListGrantsRequest{KeyID: test.keyID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		found := false
+		for _, g := range left.Grants {
+			found = found || g.GrantID == grant.GrantID
+		}
+		if found != (test.code != "") {
+			t.Errorf("%v: grant still listed is %v", test.name, found)
+		}
+	}
+
+	if got := code(store.RetireGrant(&kms.RetireGrantRequest{GrantToken: "nope"})); got != "InvalidGrantTokenException" {
+		t.Errorf("unknown token: got %v", got)
+	}
+}
+
+func TestGenerateDataKeyPairChecks(t *testing.T) {
+	store := kms.New()
+	key, err := store.CreateKey(&kms.CreateKeyRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	disabled, err := store.CreateKey(&kms.CreateKeyRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.DisableKey(&kms.DisableKeyRequest{KeyID: disabled.KeyMetadata.KeyID}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		keyID  string
+		spec   string
+		dryRun bool
+		code   string
+	}{
+		{key.KeyMetadata.KeyID, "ECC_NIST_P256", false, ""},
+		{key.KeyMetadata.KeyID, "RSA_4096", true, "DryRunOperationException"},
+		{key.KeyMetadata.KeyID, "RSA_1024", false, "ValidationException"},
+		{disabled.KeyMetadata.KeyID, "RSA_4096", false, "DisabledException"},
+		{"alias/missing", "RSA_4096", false, "NotFoundException"},
+	}
+
+	for _, test := range tests {
+		out, err := store.GenerateDataKeyPair(&kms.GenerateDataKeyPairRequest{
+			KeyID:       test.keyID,
+			KeyPairSpec: test.spec,
+			DryRun:      test.dryRun,
+		})
+		if got := code(err); got != test.code {
+			t.Errorf("%v %v: got %v, want %v", test.keyID, test.spec, got, test.code)
+			continue
+		}
+		if err == nil && (out.PrivateKeyPlaintext == "" || out.PublicKey == "") {
+			t.Errorf("%v %v: incomplete result %+v", test.keyID, test.spec, out)
+		}
+	}
+}
@@ -5,11 +5,17 @@ import (
 	"net/http"
 
 	"github.com/fernomac/aws-local/pkg/awsjson11"
+	"github.com/fernomac/aws-local/pkg/common"
 )
 
-// NewHandler creates a new HTTP handler.
-func NewHandler(kms KMS) http.Handler {
+// NewHandler creates a new HTTP handler, notifying the given observers of
+// every call.
+func NewHandler(kms KMS, observers ...common.Observer) http.Handler {
 	rval := awsjson11.NewHandler("TrentService")
+	rval.SetEventSource("kms.amazonaws.com")
+	for _, o := range observers {
+		rval.ObserveWith(o)
+	}
 
 	rval.HandleWith("GenerateRandom", func(body []byte) (interface{}, error) {
 		req := GenerateRandomRequest{}
@@ -159,6 +165,58 @@ func NewHandler(kms KMS) http.Handler {
 		return kms.CancelKeyDeletion(&req)
 	})
 
+	//
+	// Custom key stores.
+	//
+
+	rval.HandleWith("CreateCustomKeyStore", func(body []byte) (interface{}, error) {
+		req := CreateCustomKeyStoreRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return kms.CreateCustomKeyStore(&req)
+	})
+
+	rval.HandleWith("DescribeCustomKeyStores", func(body []byte) (interface{}, error) {
+		req := DescribeCustomKeyStoresRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return kms.DescribeCustomKeyStores(&req)
+	})
+
+	rval.HandleWith("ConnectCustomKeyStore", func(body []byte) (interface{}, error) {
+		req := ConnectCustomKeyStoreRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return nil, kms.ConnectCustomKeyStore(&req)
+	})
+
+	rval.HandleWith("DisconnectCustomKeyStore", func(body []byte) (interface{}, error) {
+		req := DisconnectCustomKeyStoreRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return nil, kms.DisconnectCustomKeyStore(&req)
+	})
+
+	rval.HandleWith("UpdateCustomKeyStore", func(body []byte) (interface{}, error) {
+		req := UpdateCustomKeyStoreRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return nil, kms.UpdateCustomKeyStore(&req)
+	})
+
+	rval.HandleWith("DeleteCustomKeyStore", func(body []byte) (interface{}, error) {
+		req := DeleteCustomKeyStoreRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return nil, kms.DeleteCustomKeyStore(&req)
+	})
+
 	//
 	// Import.
 	//
@@ -299,6 +357,22 @@ func NewHandler(kms KMS) http.Handler {
 		return kms.GenerateDataKeyWithoutPlaintext(&req)
 	})
 
+	rval.HandleWith("GenerateDataKeyPair", func(body []byte) (interface{}, error) {
+		req := GenerateDataKeyPairRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return kms.GenerateDataKeyPair(&req)
+	})
+
+	rval.HandleWith("GenerateDataKeyPairWithoutPlaintext", func(body []byte) (interface{}, error) {
+		req := GenerateDataKeyPairRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return kms.GenerateDataKeyPairWithoutPlaintext(&req)
+	})
+
 	rval.HandleWith("Encrypt", func(body []byte) (interface{}, error) {
 		req := EncryptRequest{}
 		if err := json.Unmarshal(body, &req); err != nil {
@@ -1,43 +1,105 @@
 package kms
 
 import (
+	"crypto/cipher"
 	"crypto/rand"
+	"crypto/x509"
 	"encoding/base64"
-	"errors"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fernomac/aws-local/pkg/common"
 )
 
+// key is a single KMS key. Its lock guards the mutable fields (meta, tags,
+// policies and the parsed policy); key, version, aead, store and externalID
+// never change once the key is created. Keys in a custom key store have no
+// key or aead of their own: their crypto is done by the store's backend.
 type key struct {
+	lock     sync.RWMutex
 	key      []byte
+	version  string
+	aead     cipher.AEAD
 	meta     *KeyMetadata
 	tags     map[string]string
 	policies map[string]string
+	policy   *policy
+
+	store      *keyStore
+	externalID string
 }
 
+// kms is the KMS store. Its lock guards the index maps only; per-key state is
+// guarded by each key's own lock. Always take k.lock before key.lock, never
+// the other way round.
 type kms struct {
-	lock    sync.Mutex
+	lock    sync.RWMutex
 	counter int64
 	keys    map[string]*key
 	arns    map[string]*key
-	aliases map[string]*key
+	aliases map[string]*alias
 	grants  map[string]*GrantListEntry
+	stores  map[string]*keyStore
+
+	backends         map[string]BackendFactory
+	attestationRoots *x509.CertPool
+
+	strict   bool
+	required map[string][]string
+	contexts *ContextLog
+}
+
+// Option configures a KMS object.
+type Option func(*kms)
+
+// WithAttestationRoots sets the roots that Nitro Enclaves attestation
+// documents must chain up to. Without any, requests with a Recipient are
+// rejected.
+func WithAttestationRoots(roots *x509.CertPool) Option {
+	return func(k *kms) {
+		k.attestationRoots = roots
+	}
+}
+
+// WithBackend sets the backend used for new custom key stores of the given
+// type (AWS_CLOUDHSM or EXTERNAL_KEY_STORE). By default CloudHSM key stores
+// use NewSoftHSM and external key stores use NewXKSBackend.
+func WithBackend(storeType string, factory BackendFactory) Option {
+	return func(k *kms) {
+		k.backends[storeType] = factory
+	}
 }
 
 // New creates a new KMS object.
-func New() KMS {
-	return &kms{
+func New(opts ...Option) KMS {
+	rval := &kms{
 		counter: 0,
 		keys:    make(map[string]*key),
 		arns:    make(map[string]*key),
-		aliases: make(map[string]*key),
+		aliases: make(map[string]*alias),
 		grants:  make(map[string]*GrantListEntry),
+		stores:  make(map[string]*keyStore),
+		backends: map[string]BackendFactory{
+			"AWS_CLOUDHSM":       NewSoftHSM,
+			"EXTERNAL_KEY_STORE": NewXKSBackend,
+		},
+	}
+	for _, opt := range opts {
+		opt(rval)
 	}
+	return rval
 }
 
-func (k *kms) get(keyID string) *key {
-	if strings.HasPrefix(keyID, "alias/") {
-		return k.aliases[keyID]
+// find looks up a key by ID, ARN, alias name or alias ARN. The caller must
+// hold k.lock.
+func (k *kms) find(keyID string) *key {
+	if name, ok := aliasName(keyID); ok {
+		if a := k.aliases[name]; a != nil {
+			return a.key
+		}
+		return nil
 	}
 	if strings.HasPrefix(keyID, "arn:") {
 		return k.arns[keyID]
@@ -45,9 +107,91 @@ func (k *kms) get(keyID string) *key {
 	return k.keys[keyID]
 }
 
+// get looks up a key like find, but ignores keys whose deletion date has
+// passed. The caller must hold k.lock.
+func (k *kms) get(keyID string) *key {
+	key := k.find(keyID)
+	if key == nil || key.deleted(time.Now()) {
+		return nil
+	}
+	return key
+}
+
+// lookup looks up a key, taking the read lock on the index maps, and returns
+// NotFoundException if there's no such key. Keys whose deletion date has
+// passed are removed when next looked up, and AWS managed keys are created
+// when first looked up by their alias/aws/<service> alias.
+func (k *kms) lookup(keyID string) (*key, error) {
+	k.lock.RLock()
+	key := k.find(keyID)
+	k.lock.RUnlock()
+
+	if key == nil {
+		return k.managedKey(keyID)
+	}
+	if key.deleted(time.Now()) {
+		k.purge(time.Now())
+		return nil, common.NewError("NotFoundException")
+	}
+	return key, nil
+}
+
+// deleted reports whether the key's scheduled deletion date has passed.
+func (key *key) deleted(now time.Time) bool {
+	key.lock.RLock()
+	defer key.lock.RUnlock()
+	return key.meta.KeyState == KeyStatePendingDeletion && key.meta.DeletionDate <= now.Unix()
+}
+
+// purge removes keys whose deletion date has passed, along with their
+// aliases and grants.
+func (k *kms) purge(now time.Time) {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+
+	for id, key := range k.keys {
+		if !key.deleted(now) {
+			continue
+		}
+
+		delete(k.keys, id)
+		delete(k.arns, key.meta.Arn)
+		for name, a := range k.aliases {
+			if a.key == key {
+				delete(k.aliases, name)
+			}
+		}
+		for token, grant := range k.grants {
+			if grant.KeyID == id || grant.KeyID == key.meta.Arn {
+				delete(k.grants, token)
+			}
+		}
+	}
+}
+
+// nextID allocates a new key ID.
+func (k *kms) nextID() int64 {
+	return atomic.AddInt64(&k.counter, 1) - 1
+}
+
+// describe returns a copy of the key's metadata that is safe to hand out.
+func (key *key) describe() *KeyMetadata {
+	key.lock.RLock()
+	defer key.lock.RUnlock()
+
+	meta := *key.meta
+	meta.KeyState = key.state()
+	return &meta
+}
+
 func (k *kms) GenerateRandom(req *GenerateRandomRequest) (*GenerateRandomResult, error) {
 	if req.NumberOfBytes < 1 || req.NumberOfBytes > 1024 {
-		return nil, errors.New("InvalidParameterValue")
+		return nil, common.NewError("InvalidParameterValue")
+	}
+
+	doc, _, err := k.recipient(req.Recipient)
+	if err != nil {
+		return nil, err
 	}
 
 	out := make([]byte, req.NumberOfBytes)
@@ -55,6 +199,16 @@ func (k *kms) GenerateRandom(req *GenerateRandomRequest) (*GenerateRandomResult,
 		return nil, err
 	}
 
+	if doc != nil {
+		sealed, err := sealFor(doc, out)
+		if err != nil {
+			return nil, err
+		}
+		return &GenerateRandomResult{
+			CiphertextForRecipient: sealed,
+		}, nil
+	}
+
 	return &GenerateRandomResult{
 		Plaintext: base64.StdEncoding.EncodeToString(out),
 	}, nil
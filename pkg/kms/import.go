@@ -1,15 +1,15 @@
 package kms
 
-import "errors"
+import "github.com/fernomac/aws-local/pkg/common"
 
 func (k *kms) GetParametersForImport(req *GetParametersForImportRequest) (*GetParametersForImportResult, error) {
-	return nil, errors.New("Unimplemented")
+	return nil, common.NewError("Unimplemented")
 }
 
 func (k *kms) ImportKeyMaterial(req *ImportKeyMaterialRequest) error {
-	return errors.New("Unimplemented")
+	return common.NewError("Unimplemented")
 }
 
 func (k *kms) DeleteImportedKeyMaterial(req *DeleteImportedKeyMaterialRequest) error {
-	return errors.New("Unimplemented")
+	return common.NewError("Unimplemented")
 }
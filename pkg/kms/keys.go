@@ -1,25 +1,33 @@
 package kms
 
 import (
+	"crypto/aes"
+	"crypto/cipher"
 	"crypto/rand"
-	"errors"
+	"encoding/hex"
 	"fmt"
 	"time"
+
+	"github.com/fernomac/aws-local/pkg/common"
 )
 
 func (k *kms) ListKeys(req *ListKeysRequest) (*ListKeysResult, error) {
-	k.lock.Lock()
-	defer k.lock.Unlock()
+	k.lock.RLock()
+	defer k.lock.RUnlock()
 
 	if req.Marker != "" {
-		return nil, errors.New("InvalidMarkerException")
+		return nil, common.NewError("InvalidMarkerException")
 	}
 	if req.Limit != 0 {
-		return nil, errors.New("LimitNotSupported")
+		return nil, common.NewError("LimitNotSupported")
 	}
 
+	now := time.Now()
 	keys := []KeyListEntry{}
 	for _, key := range k.keys {
+		if key.deleted(now) {
+			continue
+		}
 		keys = append(keys, KeyListEntry{
 			KeyArn: key.meta.Arn,
 			KeyID:  key.meta.KeyID,
@@ -32,47 +40,126 @@ func (k *kms) ListKeys(req *ListKeysRequest) (*ListKeysResult, error) {
 	}, nil
 }
 
-func (k *kms) CreateKey(req *CreateKeyRequest) (*CreateKeyResult, error) {
-	k.lock.Lock()
-	defer k.lock.Unlock()
+// newVersionID makes a new key material ID, a random 64-digit hex string.
+func newVersionID() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
 
+func (k *kms) CreateKey(req *CreateKeyRequest) (*CreateKeyResult, error) {
 	keyUsage := req.KeyUsage
 	if keyUsage == "" {
 		keyUsage = "ENCRYPT_DECRYPT"
 	}
 	if keyUsage != "ENCRYPT_DECRYPT" {
-		return nil, errors.New("InvalidParameterValue")
+		return nil, common.NewError("InvalidParameterValue")
 	}
 
 	origin := req.Origin
 	if origin == "" {
 		origin = "AWS_KMS"
 	}
-	if origin != "AWS_KMS" && origin != "EXTERNAL" {
-		return nil, errors.New("InvalidParameterValue")
+	switch origin {
+	case "AWS_KMS", "EXTERNAL", "AWS_CLOUDHSM", "EXTERNAL_KEY_STORE":
+	default:
+		return nil, common.NewError("InvalidParameterValue")
+	}
+
+	// Keys in a custom key store need a connected store of the matching type.
+	var store *keyStore
+	var storeConfig KeyStoreConfig
+	if req.CustomKeyStoreID != "" || origin == "AWS_CLOUDHSM" || origin == "EXTERNAL_KEY_STORE" {
+		if req.CustomKeyStoreID == "" {
+			return nil, common.NewError("InvalidParameterValue")
+		}
+
+		var err error
+		if store, err = k.lookupStore(req.CustomKeyStoreID); err != nil {
+			return nil, err
+		}
+
+		store.lock.RLock()
+		storeConfig = store.config
+		state := store.state
+		store.lock.RUnlock()
+
+		if storeConfig.Type != origin {
+			return nil, common.NewError("InvalidParameterValue")
+		}
+		if state != "CONNECTED" {
+			return nil, common.NewError("CustomKeyStoreInvalidStateException")
+		}
+	}
+	if (req.XksKeyID != "") != (origin == "EXTERNAL_KEY_STORE") {
+		return nil, common.NewError("InvalidParameterValue")
 	}
 
-	if req.Policy != "" {
-		return nil, errors.New("PolicyNotSupported")
+	if err := validateTags(req.Tags); err != nil {
+		return nil, err
+	}
+
+	policyText := req.Policy
+	if policyText == "" {
+		policyText = defaultPolicy(common.AccountID)
+	}
+	policy, err := parsePolicy(policyText)
+	if err != nil {
+		return nil, err
+	}
+	if !req.BypassPolicyLockoutSafetyCheck && !policy.allows("kms:PutKeyPolicy", "*", nil) {
+		return nil, common.NewError("MalformedPolicyDocumentException")
 	}
 
 	// Generate a key.
 	var raw []byte
-	var state string
+	var version string
+	var aead cipher.AEAD
+	var state KeyState
+	var externalID string
 
-	if origin == "AWS_KMS" {
+	switch origin {
+	case "AWS_KMS":
 		raw = make([]byte, 32)
 		_, err := rand.Read(raw)
 		if err != nil {
 			return nil, err
 		}
-		state = "Enabled"
-	} else {
-		state = "PendingImport"
+
+		block, err := aes.NewCipher(raw)
+		if err != nil {
+			return nil, err
+		}
+		aead, err = cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+
+		version, err = newVersionID()
+		if err != nil {
+			return nil, err
+		}
+
+		state = KeyStateEnabled
+	case "EXTERNAL":
+		state = KeyStatePendingImport
+	default:
+		externalID, err = store.backend.CreateKey(req.XksKeyID)
+		if err != nil {
+			return nil, err
+		}
+
+		version, err = newVersionID()
+		if err != nil {
+			return nil, err
+		}
+
+		state = KeyStateEnabled
 	}
 
-	id := fmt.Sprintf("%v", k.counter)
-	k.counter++
+	id := fmt.Sprintf("%v", k.nextID())
 
 	tags := map[string]string{}
 	for _, tag := range req.Tags {
@@ -81,52 +168,80 @@ func (k *kms) CreateKey(req *CreateKeyRequest) (*CreateKeyResult, error) {
 
 	key := &key{
 		meta: &KeyMetadata{
-			AWSAccountID: "x",
-			Arn:          fmt.Sprintf("arn:aws:kms:us-local-1:x:key/%v", id),
-			CreationDate: time.Now().Unix(),
-			Description:  req.Description,
-			Enabled:      true,
-			KeyID:        id,
-			KeyManager:   "CUSTOMER",
-			KeyState:     state,
-			KeyUsage:     keyUsage,
-			Origin:       origin,
+			AWSAccountID:         common.AccountID,
+			Arn:                  fmt.Sprintf("arn:aws:kms:%v:%v:key/%v", common.Region, common.AccountID, id),
+			CreationDate:         time.Now().Unix(),
+			Description:          req.Description,
+			Enabled:              state == KeyStateEnabled,
+			EncryptionAlgorithms: []string{"SYMMETRIC_DEFAULT"},
+			KeyID:                id,
+			KeyManager:           "CUSTOMER",
+			KeySpec:              "SYMMETRIC_DEFAULT",
+			KeyState:             state,
+			KeyUsage:             keyUsage,
+			Origin:               origin,
 		},
-		key:  raw,
-		tags: tags,
+		key:        raw,
+		version:    version,
+		aead:       aead,
+		tags:       tags,
+		policies:   map[string]string{"default": policyText},
+		policy:     policy,
+		store:      store,
+		externalID: externalID,
+	}
+
+	if store != nil {
+		key.meta.CustomKeyStoreID = storeConfig.ID
+		key.meta.CloudHsmClusterID = storeConfig.CloudHsmClusterID
+		if origin == "EXTERNAL_KEY_STORE" {
+			key.meta.XksKeyConfiguration = &XksKeyConfigurationType{ID: externalID}
+		}
+	}
+
+	k.lock.Lock()
+	defer k.lock.Unlock()
+
+	if origin == "EXTERNAL_KEY_STORE" {
+		for _, other := range k.keys {
+			if other.store == store && other.externalID == externalID {
+				return nil, common.NewError("XksKeyAlreadyInUseException")
+			}
+		}
 	}
 
 	k.keys[key.meta.KeyID] = key
 	k.arns[key.meta.Arn] = key
 
-	return &CreateKeyResult{key.meta}, nil
+	return &CreateKeyResult{key.describe()}, nil
 }
 
 func (k *kms) DescribeKey(req *DescribeKeyRequest) (*DescribeKeyResult, error) {
-	k.lock.Lock()
-	defer k.lock.Unlock()
-
 	if req.GrantTokens != nil {
-		return nil, errors.New("GrantsNotSupported")
+		return nil, common.NewError("GrantsNotSupported")
 	}
 
-	key := k.get(req.KeyID)
-	if key == nil {
-		return nil, errors.New("NotFoundException")
+	key, err := k.authorized(req.KeyID, "kms:DescribeKey", nil)
+	if err != nil {
+		return nil, err
 	}
 
 	return &DescribeKeyResult{
-		KeyMetadata: key.meta,
+		KeyMetadata: key.describe(),
 	}, nil
 }
 
 func (k *kms) UpdateKeyDescription(req *UpdateKeyDescriptionRequest) error {
-	k.lock.Lock()
-	defer k.lock.Unlock()
+	key, err := k.authorized(req.KeyID, "kms:UpdateKeyDescription", nil)
+	if err != nil {
+		return err
+	}
 
-	key := k.get(req.KeyID)
-	if key == nil {
-		return errors.New("NotFoundException")
+	key.lock.Lock()
+	defer key.lock.Unlock()
+
+	if err := key.can("UpdateKeyDescription"); err != nil {
+		return err
 	}
 
 	key.meta.Description = req.Description
@@ -134,45 +249,91 @@ func (k *kms) UpdateKeyDescription(req *UpdateKeyDescriptionRequest) error {
 }
 
 func (k *kms) EnableKey(req *EnableKeyRequest) error {
-	k.lock.Lock()
-	defer k.lock.Unlock()
-
-	key := k.get(req.KeyID)
-	if key == nil {
-		return errors.New("NotFoundException")
+	key, err := k.authorized(req.KeyID, "kms:EnableKey", nil)
+	if err != nil {
+		return err
 	}
 
-	if key.meta.KeyState == "PendingDeletion" || key.meta.KeyState == "PendingImport" {
-		return errors.New("KMSInvalidStateException")
+	key.lock.Lock()
+	defer key.lock.Unlock()
+
+	if err := key.can("EnableKey"); err != nil {
+		return err
 	}
 
-	key.meta.Enabled = true
-	key.meta.KeyState = "Enabled"
+	key.setState(KeyStateEnabled)
 	return nil
 }
 
 func (k *kms) DisableKey(req *DisableKeyRequest) error {
-	k.lock.Lock()
-	defer k.lock.Unlock()
-
-	key := k.get(req.KeyID)
-	if key == nil {
-		return errors.New("NotFoundException")
+	key, err := k.authorized(req.KeyID, "kms:DisableKey", nil)
+	if err != nil {
+		return err
 	}
 
-	if key.meta.KeyState == "PendingDeletion" || key.meta.KeyState == "PendingImport" {
-		return errors.New("KMSInvalidStateException")
+	key.lock.Lock()
+	defer key.lock.Unlock()
+
+	if err := key.can("DisableKey"); err != nil {
+		return err
 	}
 
-	key.meta.Enabled = false
-	key.meta.KeyState = "Disabled"
+	key.setState(KeyStateDisabled)
 	return nil
 }
 
 func (k *kms) ScheduleKeyDeletion(req *ScheduleKeyDeletionRequest) (*ScheduleKeyDeletionResult, error) {
-	return nil, errors.New("Unimplemented")
+	days := req.PendingWindowInDays
+	if days == 0 {
+		days = 30
+	}
+	if days < 7 || days > 30 {
+		return nil, common.NewError("ValidationException")
+	}
+
+	key, err := k.authorized(req.KeyID, "kms:ScheduleKeyDeletion", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	key.lock.Lock()
+	defer key.lock.Unlock()
+
+	if err := key.can("ScheduleKeyDeletion"); err != nil {
+		return nil, err
+	}
+
+	key.setState(KeyStatePendingDeletion)
+	key.meta.DeletionDate = time.Now().AddDate(0, 0, days).Unix()
+	key.meta.PendingDeletionWindowInDays = days
+
+	return &ScheduleKeyDeletionResult{
+		DeletionDate:        key.meta.DeletionDate,
+		KeyID:               key.meta.Arn,
+		KeyState:            KeyStatePendingDeletion,
+		PendingWindowInDays: days,
+	}, nil
 }
 
 func (k *kms) CancelKeyDeletion(req *CancelKeyDeletionRequest) (*CancelKeyDeletionResult, error) {
-	return nil, errors.New("Unimplemented")
+	key, err := k.authorized(req.KeyID, "kms:CancelKeyDeletion", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	key.lock.Lock()
+	defer key.lock.Unlock()
+
+	if err := key.can("CancelKeyDeletion"); err != nil {
+		return nil, err
+	}
+
+	// Like the real thing, a key comes back disabled.
+	key.setState(KeyStateDisabled)
+	key.meta.DeletionDate = 0
+	key.meta.PendingDeletionWindowInDays = 0
+
+	return &CancelKeyDeletionResult{
+		KeyID: key.meta.Arn,
+	}, nil
 }
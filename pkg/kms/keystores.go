@@ -0,0 +1,403 @@
+package kms
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fernomac/aws-local/pkg/common"
+)
+
+// keyStore is a custom key store. Its lock guards config, state and
+// errorCode; backend and created never change. Take it after k.lock and any
+// key's lock.
+type keyStore struct {
+	lock      sync.RWMutex
+	config    KeyStoreConfig
+	backend   Backend
+	created   int64
+	state     string
+	errorCode string
+}
+
+// connected reports whether the store's keys can be used.
+func (s *keyStore) connected() bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.state == "CONNECTED"
+}
+
+func (s *keyStore) describe() CustomKeyStoresListEntry {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	entry := CustomKeyStoresListEntry{
+		ConnectionState:    s.state,
+		CreationDate:       s.created,
+		CustomKeyStoreID:   s.config.ID,
+		CustomKeyStoreName: s.config.Name,
+		CustomKeyStoreType: s.config.Type,
+	}
+	if s.state == "FAILED" {
+		entry.ConnectionErrorCode = s.errorCode
+	}
+
+	if s.config.Type == "AWS_CLOUDHSM" {
+		entry.CloudHsmClusterID = s.config.CloudHsmClusterID
+		entry.TrustAnchorCertificate = s.config.TrustAnchorCertificate
+	} else {
+		entry.XksProxyConfiguration = &XksProxyConfigurationType{
+			AccessKeyID:            s.config.XksProxyCredential.AccessKeyID,
+			Connectivity:           s.config.XksProxyConnectivity,
+			URIEndpoint:            s.config.XksProxyURIEndpoint,
+			URIPath:                s.config.XksProxyURIPath,
+			VpcEndpointServiceName: s.config.XksProxyVpcEndpoint,
+		}
+	}
+
+	return entry
+}
+
+// newKeyStoreID makes a new custom key store ID like cks-1234567890abcdef0.
+func newKeyStoreID() (string, error) {
+	b := make([]byte, 9)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "cks-" + hex.EncodeToString(b)[:17], nil
+}
+
+// validateXks checks the external key store proxy settings.
+func validateXks(config *KeyStoreConfig) error {
+	if !strings.HasPrefix(config.XksProxyURIEndpoint, "https://") && !strings.HasPrefix(config.XksProxyURIEndpoint, "http://") {
+		return common.NewError("ValidationException")
+	}
+	if !strings.HasSuffix(config.XksProxyURIPath, "/kms/xks/v1") {
+		return common.NewError("ValidationException")
+	}
+	if config.XksProxyCredential.AccessKeyID == "" || config.XksProxyCredential.RawSecretAccessKey == "" {
+		return common.NewError("ValidationException")
+	}
+
+	switch config.XksProxyConnectivity {
+	case "PUBLIC_ENDPOINT":
+		if config.XksProxyVpcEndpoint != "" {
+			return common.NewError("ValidationException")
+		}
+	case "VPC_ENDPOINT_SERVICE":
+		if config.XksProxyVpcEndpoint == "" {
+			return common.NewError("ValidationException")
+		}
+	default:
+		return common.NewError("ValidationException")
+	}
+
+	return nil
+}
+
+// checkUnique checks that no other store has the same name, cluster or proxy
+// URI. The caller must hold k.lock.
+func (k *kms) checkUnique(config *KeyStoreConfig) error {
+	for id, other := range k.stores {
+		if id == config.ID {
+			continue
+		}
+
+		other.lock.RLock()
+		o := other.config
+		other.lock.RUnlock()
+
+		if o.Name == config.Name {
+			return common.NewError("CustomKeyStoreNameInUseException")
+		}
+		if config.Type == "AWS_CLOUDHSM" && o.CloudHsmClusterID == config.CloudHsmClusterID {
+			return common.NewError("CloudHsmClusterInUseException")
+		}
+		if config.Type == "EXTERNAL_KEY_STORE" && o.XksProxyURIEndpoint == config.XksProxyURIEndpoint && o.XksProxyURIPath == config.XksProxyURIPath {
+			return common.NewError("XksProxyUriInUseException")
+		}
+	}
+	return nil
+}
+
+// lookupStore looks up a custom key store by ID.
+func (k *kms) lookupStore(id string) (*keyStore, error) {
+	k.lock.RLock()
+	defer k.lock.RUnlock()
+
+	store, ok := k.stores[id]
+	if !ok {
+		return nil, common.NewError("CustomKeyStoreNotFoundException")
+	}
+	return store, nil
+}
+
+func (k *kms) CreateCustomKeyStore(req *CreateCustomKeyStoreRequest) (*CreateCustomKeyStoreResult, error) {
+	if req.CustomKeyStoreName == "" {
+		return nil, common.NewError("ValidationException")
+	}
+
+	config := KeyStoreConfig{
+		Name:                   req.CustomKeyStoreName,
+		Type:                   req.CustomKeyStoreType,
+		CloudHsmClusterID:      req.CloudHsmClusterID,
+		TrustAnchorCertificate: req.TrustAnchorCertificate,
+		KeyStorePassword:       req.KeyStorePassword,
+		XksProxyURIEndpoint:    req.XksProxyURIEndpoint,
+		XksProxyURIPath:        req.XksProxyURIPath,
+		XksProxyConnectivity:   req.XksProxyConnectivity,
+		XksProxyVpcEndpoint:    req.XksProxyVpcEndpointServiceName,
+	}
+	if req.XksProxyAuthenticationCredential != nil {
+		config.XksProxyCredential = *req.XksProxyAuthenticationCredential
+	}
+
+	switch config.Type {
+	case "", "AWS_CLOUDHSM":
+		config.Type = "AWS_CLOUDHSM"
+		if config.CloudHsmClusterID == "" || config.TrustAnchorCertificate == "" || config.KeyStorePassword == "" {
+			return nil, common.NewError("ValidationException")
+		}
+	case "EXTERNAL_KEY_STORE":
+		if config.XksProxyConnectivity == "" {
+			config.XksProxyConnectivity = "PUBLIC_ENDPOINT"
+		}
+		if err := validateXks(&config); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, common.NewError("ValidationException")
+	}
+
+	factory, ok := k.backends[config.Type]
+	if !ok {
+		return nil, common.NewError("UnsupportedOperationException")
+	}
+
+	id, err := newKeyStoreID()
+	if err != nil {
+		return nil, err
+	}
+	config.ID = id
+
+	backend, err := factory(&config)
+	if err != nil {
+		return nil, err
+	}
+
+	k.lock.Lock()
+	defer k.lock.Unlock()
+
+	if err := k.checkUnique(&config); err != nil {
+		return nil, err
+	}
+
+	k.stores[id] = &keyStore{
+		config:  config,
+		backend: backend,
+		created: time.Now().Unix(),
+		state:   "DISCONNECTED",
+	}
+
+	return &CreateCustomKeyStoreResult{
+		CustomKeyStoreID: id,
+	}, nil
+}
+
+func (k *kms) DescribeCustomKeyStores(req *DescribeCustomKeyStoresRequest) (*DescribeCustomKeyStoresResult, error) {
+	if req.Marker != "" {
+		return nil, common.NewError("InvalidMarkerException")
+	}
+	if req.Limit != 0 {
+		return nil, common.NewError("LimitNotSupported")
+	}
+	if req.CustomKeyStoreID != "" && req.CustomKeyStoreName != "" {
+		return nil, common.NewError("ValidationException")
+	}
+
+	k.lock.RLock()
+	defer k.lock.RUnlock()
+
+	stores := []CustomKeyStoresListEntry{}
+	for _, store := range k.stores {
+		entry := store.describe()
+		if req.CustomKeyStoreID != "" && entry.CustomKeyStoreID != req.CustomKeyStoreID {
+			continue
+		}
+		if req.CustomKeyStoreName != "" && entry.CustomKeyStoreName != req.CustomKeyStoreName {
+			continue
+		}
+		stores = append(stores, entry)
+	}
+
+	if len(stores) == 0 && (req.CustomKeyStoreID != "" || req.CustomKeyStoreName != "") {
+		return nil, common.NewError("CustomKeyStoreNotFoundException")
+	}
+
+	return &DescribeCustomKeyStoresResult{
+		CustomKeyStores: stores,
+		Truncated:       false,
+	}, nil
+}
+
+func (k *kms) ConnectCustomKeyStore(req *ConnectCustomKeyStoreRequest) error {
+	store, err := k.lookupStore(req.CustomKeyStoreID)
+	if err != nil {
+		return err
+	}
+
+	store.lock.Lock()
+	switch store.state {
+	case "CONNECTED", "CONNECTING":
+		store.lock.Unlock()
+		return nil
+	case "DISCONNECTING", "FAILED":
+		store.lock.Unlock()
+		return common.NewError("CustomKeyStoreInvalidStateException")
+	}
+	store.state = "CONNECTING"
+	config := store.config
+	store.lock.Unlock()
+
+	// Don't hold the lock while talking to the backend, which may be slow.
+	err = store.backend.Connect(&config)
+
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	if store.state != "CONNECTING" {
+		// Disconnected while we were connecting.
+		if err == nil {
+			store.backend.Disconnect()
+		}
+		return nil
+	}
+
+	if err != nil {
+		store.state = "FAILED"
+		store.errorCode = "INTERNAL_ERROR"
+		if ce, ok := err.(*ConnectionError); ok {
+			store.errorCode = ce.Code
+		}
+		return nil
+	}
+
+	store.state = "CONNECTED"
+	store.errorCode = ""
+	return nil
+}
+
+func (k *kms) DisconnectCustomKeyStore(req *DisconnectCustomKeyStoreRequest) error {
+	store, err := k.lookupStore(req.CustomKeyStoreID)
+	if err != nil {
+		return err
+	}
+
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	if store.state == "CONNECTED" {
+		store.backend.Disconnect()
+	}
+	store.state = "DISCONNECTED"
+	store.errorCode = ""
+	return nil
+}
+
+func (k *kms) UpdateCustomKeyStore(req *UpdateCustomKeyStoreRequest) error {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+
+	store, ok := k.stores[req.CustomKeyStoreID]
+	if !ok {
+		return common.NewError("CustomKeyStoreNotFoundException")
+	}
+
+	store.lock.RLock()
+	config := store.config
+	state := store.state
+	store.lock.RUnlock()
+
+	if req.NewCustomKeyStoreName != "" {
+		config.Name = req.NewCustomKeyStoreName
+	}
+
+	// Anything but the name can only change while disconnected.
+	changed := false
+	set := func(field *string, value string) {
+		if value != "" {
+			*field = value
+			changed = true
+		}
+	}
+
+	if config.Type == "AWS_CLOUDHSM" {
+		if req.XksProxyURIEndpoint != "" || req.XksProxyURIPath != "" || req.XksProxyConnectivity != "" ||
+			req.XksProxyVpcEndpointServiceName != "" || req.XksProxyAuthenticationCredential != nil {
+			return common.NewError("ValidationException")
+		}
+		set(&config.CloudHsmClusterID, req.CloudHsmClusterID)
+		set(&config.KeyStorePassword, req.KeyStorePassword)
+	} else {
+		if req.CloudHsmClusterID != "" || req.KeyStorePassword != "" {
+			return common.NewError("ValidationException")
+		}
+		set(&config.XksProxyURIEndpoint, req.XksProxyURIEndpoint)
+		set(&config.XksProxyURIPath, req.XksProxyURIPath)
+		set(&config.XksProxyConnectivity, req.XksProxyConnectivity)
+		set(&config.XksProxyVpcEndpoint, req.XksProxyVpcEndpointServiceName)
+		if req.XksProxyConnectivity == "PUBLIC_ENDPOINT" && req.XksProxyVpcEndpointServiceName == "" {
+			config.XksProxyVpcEndpoint = ""
+		}
+		if req.XksProxyAuthenticationCredential != nil {
+			config.XksProxyCredential = *req.XksProxyAuthenticationCredential
+			changed = true
+		}
+		if err := validateXks(&config); err != nil {
+			return err
+		}
+	}
+
+	if changed && state != "DISCONNECTED" {
+		return common.NewError("CustomKeyStoreInvalidStateException")
+	}
+
+	if err := k.checkUnique(&config); err != nil {
+		return err
+	}
+
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	store.config = config
+	return nil
+}
+
+func (k *kms) DeleteCustomKeyStore(req *DeleteCustomKeyStoreRequest) error {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+
+	store, ok := k.stores[req.CustomKeyStoreID]
+	if !ok {
+		return common.NewError("CustomKeyStoreNotFoundException")
+	}
+
+	store.lock.RLock()
+	state := store.state
+	store.lock.RUnlock()
+
+	if state != "DISCONNECTED" {
+		return common.NewError("CustomKeyStoreInvalidStateException")
+	}
+
+	for _, key := range k.keys {
+		if key.store == store {
+			return common.NewError("CustomKeyStoreHasCMKsException")
+		}
+	}
+
+	delete(k.stores, req.CustomKeyStoreID)
+	return nil
+}
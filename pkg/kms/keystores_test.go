@@ -0,0 +1,346 @@
+package kms_test
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/fernomac/aws-local/pkg/kms"
+	"github.com/fernomac/aws-local/pkg/sigv4"
+	"github.com/fernomac/aws-local/pkg/xks"
+)
+
+var xksCreds = sigv4.Credentials{AccessKeyID: "AKIAXKS", SecretAccessKey: "xks-secret"}
+
+// newXksStore starts a stub proxy and creates an external key store in front
+// of it, connected unless the stub has been told to fail.
+func newXksStore(t *testing.T, store kms.KMS, stub *xks.Stub) (string, *httptest.Server) {
+	server := httptest.NewServer(stub)
+	t.Cleanup(server.Close)
+
+	out, err := store.CreateCustomKeyStore(&kms.CreateCustomKeyStoreRequest{
+		CustomKeyStoreName:  "xks-" + server.URL,
+		CustomKeyStoreType:  "EXTERNAL_KEY_STORE",
+		XksProxyURIEndpoint: server.URL,
+		XksProxyURIPath:     "/example/kms/xks/v1",
+		XksProxyAuthenticationCredential: &kms.XksProxyAuthenticationCredential{
+			AccessKeyID:        xksCreds.AccessKeyID,
+			RawSecretAccessKey: xksCreds.SecretAccessKey,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out.CustomKeyStoreID, server
+}
+
+func describeStore(t *testing.T, store kms.KMS, id string) kms.CustomKeyStoresListEntry {
+	out, err := store.DescribeCustomKeyStores(&kms.DescribeCustomKeyStoresRequest{CustomKeyStoreID: id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out.CustomKeyStores) != 1 {
+		t.Fatalf("got %v stores", len(out.CustomKeyStores))
+	}
+	return out.CustomKeyStores[0]
+}
+
+func TestXksConnectionErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(stub *xks.Stub, server *httptest.Server)
+		code  string
+	}{
+		{"healthy", func(*xks.Stub, *httptest.Server) {}, ""},
+		{"wrong credentials", func(stub *xks.Stub, _ *httptest.Server) {
+			stub.SetCredentials(sigv4.Credentials{AccessKeyID: "other", SecretAccessKey: "other"})
+		}, "INVALID_CREDENTIALS"},
+		{"access denied", func(stub *xks.Stub, _ *httptest.Server) { stub.Fail(xks.ErrAccessDenied) }, "XKS_PROXY_ACCESS_DENIED"},
+		{"bad path", func(stub *xks.Stub, _ *httptest.Server) { stub.Fail(xks.ErrInvalidURIPath) }, "XKS_PROXY_INVALID_CONFIGURATION"},
+		{"proxy error", func(stub *xks.Stub, _ *httptest.Server) { stub.Fail(xks.ErrInternal) }, "XKS_PROXY_INVALID_RESPONSE"},
+		{"timeout", func(stub *xks.Stub, _ *httptest.Server) { stub.SetLatency(300 * time.Millisecond) }, "XKS_PROXY_TIMED_OUT"},
+		{"unreachable", func(_ *xks.Stub, server *httptest.Server) { server.Close() }, "XKS_PROXY_NOT_REACHABLE"},
+	}
+
+	for _, test := range tests {
+		store := kms.New()
+		stub := xks.NewStub(xksCreds)
+		id, server := newXksStore(t, store, stub)
+		test.setup(stub, server)
+
+		if err := store.ConnectCustomKeyStore(&kms.ConnectCustomKeyStoreRequest{CustomKeyStoreID: id}); err != nil {
+			t.Fatalf("%v: %v", test.name, err)
+		}
+		entry := describeStore(t, store, id)
+		wantState := "CONNECTED"
+		if test.code != "" {
+			wantState = "FAILED"
+		}
+		if entry.ConnectionState != wantState || entry.ConnectionErrorCode != test.code {
+			t.Errorf("%v: got %v %q, want %v %q", test.name, entry.ConnectionState, entry.ConnectionErrorCode, wantState, test.code)
+		}
+		stub.SetLatency(0)
+	}
+}
+
+func TestKeyStoreLifecycle(t *testing.T) {
+	store := kms.New()
+	stub := xks.NewStub(xksCreds)
+	stub.Fail(xks.ErrAccessDenied)
+	id, _ := newXksStore(t, store, stub)
+	request := &kms.ConnectCustomKeyStoreRequest{CustomKeyStoreID: id}
+	disconnect := &kms.DisconnectCustomKeyStoreRequest{CustomKeyStoreID: id}
+
+	if got := describeStore(t, store, id); got.ConnectionState != "DISCONNECTED" || got.ConnectionErrorCode != "" {
+		t.Errorf("new store is %v %q", got.ConnectionState, got.ConnectionErrorCode)
+	}
+
+	// A failed store must be disconnected before it's retried.
+	store.ConnectCustomKeyStore(request)
+	if got := code(store.ConnectCustomKeyStore(request)); got != "CustomKeyStoreInvalidStateException" {
+		t.Errorf("reconnecting failed store: got %v", got)
+	}
+	if err := store.DisconnectCustomKeyStore(disconnect); err != nil {
+		t.Fatal(err)
+	}
+	if got := describeStore(t, store, id); got.ConnectionState != "DISCONNECTED" || got.ConnectionErrorCode != "" {
+		t.Errorf("disconnected store is %v %q", got.ConnectionState, got.ConnectionErrorCode)
+	}
+
+	stub.Fail(nil)
+	if err := store.ConnectCustomKeyStore(request); err != nil {
+		t.Fatal(err)
+	}
+	if got := describeStore(t, store, id); got.ConnectionState != "CONNECTED" {
+		t.Errorf("store is %v", got.ConnectionState)
+	}
+	if err := store.ConnectCustomKeyStore(request); err != nil {
+		t.Errorf("connecting connected store: %v", err)
+	}
+
+	// Only the name may change while connected.
+	if err := store.UpdateCustomKeyStore(&kms.UpdateCustomKeyStoreRequest{CustomKeyStoreID: id, NewCustomKeyStoreName: "renamed"}); err != nil {
+		t.Errorf("renaming: %v", err)
+	}
+	if got := code(store.UpdateCustomKeyStore(&kms.UpdateCustomKeyStoreRequest{CustomKeyStoreID: id, XksProxyURIPath: "/other/kms/xks/v1"})); got != "CustomKeyStoreInvalidStateException" {
+		t.Errorf("changing path while connected: got %v", got)
+	}
+	if got := code(store.DeleteCustomKeyStore(&kms.DeleteCustomKeyStoreRequest{CustomKeyStoreID: id})); got != "CustomKeyStoreInvalidStateException" {
+		t.Errorf("deleting connected store: got %v", got)
+	}
+
+	if err := stub.AddKey("k1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.CreateKey(&kms.CreateKeyRequest{Origin: "EXTERNAL_KEY_STORE", CustomKeyStoreID: id, XksKeyID: "k1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.DisconnectCustomKeyStore(disconnect); err != nil {
+		t.Fatal(err)
+	}
+	if got := code(store.DeleteCustomKeyStore(&kms.DeleteCustomKeyStoreRequest{CustomKeyStoreID: id})); got != "CustomKeyStoreHasCMKsException" {
+		t.Errorf("deleting store with keys: got %v", got)
+	}
+	if err := store.UpdateCustomKeyStore(&kms.UpdateCustomKeyStoreRequest{CustomKeyStoreID: id, XksProxyURIPath: "/other/kms/xks/v1"}); err != nil {
+		t.Errorf("changing path while disconnected: %v", err)
+	}
+}
+
+func TestKeyStoreValidation(t *testing.T) {
+	creds := &kms.XksProxyAuthenticationCredential{AccessKeyID: "a", RawSecretAccessKey: "s"}
+	tests := []struct {
+		name string
+		req  kms.CreateCustomKeyStoreRequest
+		code string
+	}{
+		{"xks", kms.CreateCustomKeyStoreRequest{CustomKeyStoreType: "EXTERNAL_KEY_STORE", XksProxyURIEndpoint: "https://x", XksProxyURIPath: "/kms/xks/v1", XksProxyAuthenticationCredential: creds}, ""},
+		{"xks bad scheme", kms.CreateCustomKeyStoreRequest{CustomKeyStoreType: "EXTERNAL_KEY_STORE", XksProxyURIEndpoint: "ftp://x", XksProxyURIPath: "/kms/xks/v1", XksProxyAuthenticationCredential: creds}, "ValidationException"},
+		{"xks bad path", kms.CreateCustomKeyStoreRequest{CustomKeyStoreType: "EXTERNAL_KEY_STORE", XksProxyURIEndpoint: "https://x", XksProxyURIPath: "/kms", XksProxyAuthenticationCredential: creds}, "ValidationException"},
+		{"xks no credentials", kms.CreateCustomKeyStoreRequest{CustomKeyStoreType: "EXTERNAL_KEY_STORE", XksProxyURIEndpoint: "https://x", XksProxyURIPath: "/kms/xks/v1"}, "ValidationException"},
+		{"xks bad connectivity", kms.CreateCustomKeyStoreRequest{CustomKeyStoreType: "EXTERNAL_KEY_STORE", XksProxyURIEndpoint: "https://x", XksProxyURIPath: "/kms/xks/v1", XksProxyAuthenticationCredential: creds, XksProxyConnectivity: "CARRIER_PIGEON"}, "ValidationException"},
+		{"xks vpc without service", kms.CreateCustomKeyStoreRequest{CustomKeyStoreType: "EXTERNAL_KEY_STORE", XksProxyURIEndpoint: "https://x", XksProxyURIPath: "/kms/xks/v1", XksProxyAuthenticationCredential: creds, XksProxyConnectivity: "VPC_ENDPOINT_SERVICE"}, "ValidationException"},
+		{"cloudhsm", kms.CreateCustomKeyStoreRequest{CloudHsmClusterID: "cluster-1", TrustAnchorCertificate: "cert", KeyStorePassword: "pw"}, ""},
+		{"cloudhsm no password", kms.CreateCustomKeyStoreRequest{CloudHsmClusterID: "cluster-1", TrustAnchorCertificate: "cert"}, "ValidationException"},
+		{"bad type", kms.CreateCustomKeyStoreRequest{CustomKeyStoreType: "FLOPPY"}, "ValidationException"},
+	}
+
+	for _, test := range tests {
+		store := kms.New()
+		test.req.CustomKeyStoreName = "store"
+		_, err := store.CreateCustomKeyStore(&test.req)
+		if got := code(err); got != test.code {
+			t.Errorf("%v: got %v, want %v", test.name, got, test.code)
+		}
+	}
+}
+
+func TestXksCreateKeyErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		keyID string
+		setup func(stub *xks.Stub)
+		code  string
+	}{
+		{"ok", "k1", func(*xks.Stub) {}, ""},
+		{"no key ID", "", func(*xks.Stub) {}, "InvalidParameterValue"},
+		{"missing key", "nope", func(*xks.Stub) {}, "XksKeyNotFoundException"},
+		{"disabled key", "k1", func(stub *xks.Stub) { stub.SetKeyStatus("k1", "DISABLED") }, "XksKeyInvalidConfigurationException"},
+		{"rotated credentials", "k1", func(stub *xks.Stub) {
+			stub.SetCredentials(sigv4.Credentials{AccessKeyID: "other", SecretAccessKey: "other"})
+		}, "XksProxyIncorrectAuthenticationCredentialException"},
+		{"proxy error", "k1", func(stub *xks.Stub) { stub.Fail(xks.ErrInternal) }, "XksProxyInvalidResponseException"},
+	}
+
+	for _, test := range tests {
+		store := kms.New()
+		stub := xks.NewStub(xksCreds)
+		if err := stub.AddKey("k1"); err != nil {
+			t.Fatal(err)
+		}
+		id, _ := newXksStore(t, store, stub)
+		if err := store.ConnectCustomKeyStore(&kms.ConnectCustomKeyStoreRequest{CustomKeyStoreID: id}); err != nil {
+			t.Fatal(err)
+		}
+		test.setup(stub)
+
+		_, err := store.CreateKey(&kms.CreateKeyRequest{Origin: "EXTERNAL_KEY_STORE", CustomKeyStoreID: id, XksKeyID: test.keyID})
+		if got := code(err); got != test.code {
+			t.Errorf("%v: got %v, want %v", test.name, got, test.code)
+		}
+	}
+
+	// A key already behind another KMS key can't be used twice.
+	store := kms.New()
+	stub := xks.NewStub(xksCreds)
+	stub.AddKey("k1")
+	id, _ := newXksStore(t, store, stub)
+	store.ConnectCustomKeyStore(&kms.ConnectCustomKeyStoreRequest{CustomKeyStoreID: id})
+	req := &kms.CreateKeyRequest{Origin: "EXTERNAL_KEY_STORE", CustomKeyStoreID: id, XksKeyID: "k1"}
+	if _, err := store.CreateKey(req); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.CreateKey(req); code(err) != "XksKeyAlreadyInUseException" {
+		t.Errorf("reusing key: got %v", err)
+	}
+}
+
+func TestXksCrypto(t *testing.T) {
+	store := kms.New()
+	stub := xks.NewStub(xksCreds)
+	if err := stub.AddKey("k1"); err != nil {
+		t.Fatal(err)
+	}
+	id, _ := newXksStore(t, store, stub)
+
+	if _, err := store.CreateKey(&kms.CreateKeyRequest{Origin: "EXTERNAL_KEY_STORE", CustomKeyStoreID: id, XksKeyID: "k1"}); code(err) != "CustomKeyStoreInvalidStateException" {
+		t.Errorf("creating key in disconnected store: got %v", err)
+	}
+	if err := store.ConnectCustomKeyStore(&kms.ConnectCustomKeyStoreRequest{CustomKeyStoreID: id}); err != nil {
+		t.Fatal(err)
+	}
+	key, err := store.CreateKey(&kms.CreateKeyRequest{Origin: "EXTERNAL_KEY_STORE", CustomKeyStoreID: id, XksKeyID: "k1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.KeyMetadata.XksKeyConfiguration == nil || key.KeyMetadata.XksKeyConfiguration.ID != "k1" {
+		t.Errorf("key configuration is %+v", key.KeyMetadata.XksKeyConfiguration)
+	}
+
+	ctx := map[string]string{"a": "b"}
+	enc, err := store.Encrypt(&kms.EncryptRequest{KeyID: key.KeyMetadata.KeyID, Plaintext: "aGk=", EncryptionContext: ctx})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dec, err := store.Decrypt(&kms.DecryptRequest{CiphertextBlob: enc.CiphertextBlob, EncryptionContext: ctx})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dec.Plaintext != "aGk=" {
+		t.Errorf("got plaintext %q", dec.Plaintext)
+	}
+
+	tests := []struct {
+		name  string
+		ctx   map[string]string
+		setup func()
+		code  string
+	}{
+		{"wrong context", map[string]string{"a": "c"}, func() {}, "InvalidCiphertextException"},
+		{"proxy error", ctx, func() { stub.Fail(xks.ErrInternal) }, "KMSInvalidStateException"},
+		{"timeout", ctx, func() { stub.SetLatency(300 * time.Millisecond) }, "DependencyTimeoutException"},
+		{"disabled key", ctx, func() { stub.SetKeyStatus("k1", "DISABLED") }, "KMSInvalidStateException"},
+	}
+
+	for _, test := range tests {
+		test.setup()
+		_, err := store.Decrypt(&kms.DecryptRequest{CiphertextBlob: enc.CiphertextBlob, EncryptionContext: test.ctx})
+		if got := code(err); got != test.code {
+			t.Errorf("%v: got %v, want %v", test.name, got, test.code)
+		}
+		stub.Fail(nil)
+		stub.SetLatency(0)
+		stub.SetKeyStatus("k1", "ENABLED")
+	}
+
+	// Keys in a disconnected store are unavailable.
+	if err := store.DisconnectCustomKeyStore(&kms.DisconnectCustomKeyStoreRequest{CustomKeyStoreID: id}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Decrypt(&kms.DecryptRequest{CiphertextBlob: enc.CiphertextBlob, EncryptionContext: ctx}); code(err) != "KMSInvalidStateException" {
+		t.Errorf("decrypting with disconnected store: got %v", err)
+	}
+}
+
+func TestSoftHSM(t *testing.T) {
+	store := kms.New()
+	out, err := store.CreateCustomKeyStore(&kms.CreateCustomKeyStoreRequest{
+		CustomKeyStoreName:     "hsm",
+		CloudHsmClusterID:      "cluster-1",
+		TrustAnchorCertificate: "cert",
+		KeyStorePassword:       "kmsuser-password",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := out.CustomKeyStoreID
+
+	// Changing the password in KMS but not in the cluster breaks the store.
+	if err := store.UpdateCustomKeyStore(&kms.UpdateCustomKeyStoreRequest{CustomKeyStoreID: id, KeyStorePassword: "wrong"}); err != nil {
+		t.Fatal(err)
+	}
+	store.ConnectCustomKeyStore(&kms.ConnectCustomKeyStoreRequest{CustomKeyStoreID: id})
+	if got := describeStore(t, store, id); got.ConnectionState != "FAILED" || got.ConnectionErrorCode != "INVALID_CREDENTIALS" {
+		t.Errorf("wrong password: store is %v %q", got.ConnectionState, got.ConnectionErrorCode)
+	}
+
+	store.DisconnectCustomKeyStore(&kms.DisconnectCustomKeyStoreRequest{CustomKeyStoreID: id})
+	if err := store.UpdateCustomKeyStore(&kms.UpdateCustomKeyStoreRequest{CustomKeyStoreID: id, KeyStorePassword: "kmsuser-password"}); err != nil {
+		t.Fatal(err)
+	}
+	store.ConnectCustomKeyStore(&kms.ConnectCustomKeyStoreRequest{CustomKeyStoreID: id})
+	if got := describeStore(t, store, id); got.ConnectionState != "CONNECTED" {
+		t.Fatalf("store is %v %q", got.ConnectionState, got.ConnectionErrorCode)
+	}
+
+	key, err := store.CreateKey(&kms.CreateKeyRequest{Origin: "AWS_CLOUDHSM", CustomKeyStoreID: id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.KeyMetadata.CloudHsmClusterID != "cluster-1" || key.KeyMetadata.CustomKeyStoreID != id {
+		t.Errorf("key metadata is %+v", key.KeyMetadata)
+	}
+	enc, err := store.Encrypt(&kms.EncryptRequest{KeyID: key.KeyMetadata.KeyID, Plaintext: "aGk="})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dec, err := store.Decrypt(&kms.DecryptRequest{CiphertextBlob: enc.CiphertextBlob})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dec.Plaintext != "aGk=" {
+		t.Errorf("got plaintext %q", dec.Plaintext)
+	}
+	if _, err := store.Decrypt(&kms.DecryptRequest{CiphertextBlob: enc.CiphertextBlob, EncryptionContext: map[string]string{"a": "b"}}); code(err) != "InvalidCiphertextException" {
+		t.Errorf("wrong context: got %v", err)
+	}
+}
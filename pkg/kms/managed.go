@@ -0,0 +1,189 @@
+package kms
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/fernomac/aws-local/pkg/common"
+)
+
+// awsAliasPrefix is the alias prefix reserved for AWS managed keys.
+const awsAliasPrefix = "alias/aws/"
+
+// managedServices are the services that have AWS managed keys, by the name
+// used in their alias/aws/<service> alias.
+var managedServices = map[string]bool{
+	"acm":               true,
+	"backup":            true,
+	"codecommit":        true,
+	"dms":               true,
+	"dynamodb":          true,
+	"ebs":               true,
+	"elasticfilesystem": true,
+	"es":                true,
+	"firehose":          true,
+	"fsx":               true,
+	"glue":              true,
+	"kafka":             true,
+	"kinesis":           true,
+	"kinesisvideo":      true,
+	"lambda":            true,
+	"lightsail":         true,
+	"rds":               true,
+	"redshift":          true,
+	"s3":                true,
+	"secretsmanager":    true,
+	"ses":               true,
+	"sns":               true,
+	"sqs":               true,
+	"ssm":               true,
+	"timestream":        true,
+	"xray":              true,
+}
+
+// customerOnly are the operations that can't be done to AWS managed keys.
+var customerOnly = map[string]bool{
+	"EnableKey":                 true,
+	"DisableKey":                true,
+	"ScheduleKeyDeletion":       true,
+	"CancelKeyDeletion":         true,
+	"PutKeyPolicy":              true,
+	"UpdateKeyDescription":      true,
+	"TagResource":               true,
+	"UntagResource":             true,
+	"EnableKeyRotation":         true,
+	"DisableKeyRotation":        true,
+	"CreateAlias":               true,
+	"UpdateAlias":               true,
+	"GetParametersForImport":    true,
+	"ImportKeyMaterial":         true,
+	"DeleteImportedKeyMaterial": true,
+}
+
+// awsManaged reports whether the key is an AWS managed key.
+func (key *key) awsManaged() bool {
+	return key.meta.KeyManager == "AWS"
+}
+
+// can checks that the operation may be done to the key, given who manages it
+// and what state it's in. The caller must hold key.lock.
+func (key *key) can(operation string) error {
+	if key.awsManaged() && customerOnly[operation] {
+		return common.NewError("UnsupportedOperationException")
+	}
+	return key.state().allows(operation)
+}
+
+// managedService returns the service an alias/aws/<service> alias is for, or
+// false if it isn't one.
+func managedService(alias string) (string, bool) {
+	if !strings.HasPrefix(alias, awsAliasPrefix) {
+		return "", false
+	}
+	service := strings.TrimPrefix(alias, awsAliasPrefix)
+	return service, managedServices[service]
+}
+
+// managedPolicy is the key policy of an AWS managed key: the account can use
+// the key and read its metadata, but nobody can change it.
+func managedPolicy(account string, service string) string {
+	return fmt.Sprintf(`{
+  "Version": "2012-10-17",
+  "Id": "auto-%v",
+  "Statement": [
+    {
+      "Sid": "Allow access through %v for all principals in the account that are authorized to use %v",
+      "Effect": "Allow",
+      "Principal": {"AWS": "*"},
+      "Action": ["kms:Encrypt", "kms:Decrypt", "kms:ReEncrypt*", "kms:GenerateDataKey*", "kms:DescribeKey"],
+      "Resource": "*"
+    },
+    {
+      "Sid": "Allow direct access to key metadata to the account",
+      "Effect": "Allow",
+      "Principal": {"AWS": "arn:aws:iam::%v:root"},
+      "Action": ["kms:Describe*", "kms:Get*", "kms:List*"],
+      "Resource": "*"
+    }
+  ]
+}`, service, service, service, account)
+}
+
+// managedKey returns the AWS managed key for an alias/aws/<service> alias,
+// given by name or ARN, creating it on first use like the real thing does. It
+// returns NotFoundException if the alias isn't one of those.
+func (k *kms) managedKey(keyID string) (*key, error) {
+	name, ok := aliasName(keyID)
+	if !ok {
+		return nil, common.NewError("NotFoundException")
+	}
+	service, ok := managedService(name)
+	if !ok {
+		return nil, common.NewError("NotFoundException")
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(raw)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	version, err := newVersionID()
+	if err != nil {
+		return nil, err
+	}
+
+	policyText := managedPolicy(common.AccountID, service)
+	policy, err := parsePolicy(policyText)
+	if err != nil {
+		panic(err)
+	}
+
+	k.lock.Lock()
+	defer k.lock.Unlock()
+
+	// Someone else may have got here first.
+	if existing := k.aliases[name]; existing != nil {
+		return existing.key, nil
+	}
+
+	now := time.Now().Unix()
+	id := fmt.Sprintf("%v", k.nextID())
+	key := &key{
+		meta: &KeyMetadata{
+			AWSAccountID:         common.AccountID,
+			Arn:                  fmt.Sprintf("arn:aws:kms:%v:%v:key/%v", common.Region, common.AccountID, id),
+			CreationDate:         now,
+			Description:          fmt.Sprintf("Default key that protects my %v data when no other key is defined", service),
+			Enabled:              true,
+			EncryptionAlgorithms: []string{"SYMMETRIC_DEFAULT"},
+			KeyID:                id,
+			KeyManager:           "AWS",
+			KeySpec:              "SYMMETRIC_DEFAULT",
+			KeyState:             KeyStateEnabled,
+			KeyUsage:             "ENCRYPT_DECRYPT",
+			Origin:               "AWS_KMS",
+		},
+		key:      raw,
+		version:  version,
+		aead:     aead,
+		tags:     map[string]string{},
+		policies: map[string]string{"default": policyText},
+		policy:   policy,
+	}
+
+	k.keys[key.meta.KeyID] = key
+	k.arns[key.meta.Arn] = key
+	k.aliases[name] = &alias{name: name, key: key, created: now, updated: now}
+	return key, nil
+}
@@ -0,0 +1,57 @@
+package kms_test
+
+import (
+	"testing"
+
+	"github.com/fernomac/aws-local/pkg/common"
+	"github.com/fernomac/aws-local/pkg/kms"
+)
+
+func TestManagedKeys(t *testing.T) {
+	store := kms.New()
+
+	tests := []struct {
+		keyID string
+		code  string
+	}{
+		{"alias/aws/s3", ""},
+		{"alias/aws/dynamodb", ""},
+		{"arn:aws:kms:" + common.Region + ":" + common.AccountID + ":alias/aws/sqs", ""},
+		{"alias/aws/s33", "NotFoundException"},
+		{"alias/aws/", "NotFoundException"},
+		{"alias/aws/S3", "NotFoundException"},
+		{"alias/s3", "NotFoundException"},
+	}
+
+	for _, test := range tests {
+		out, err := store.DescribeKey(&kms.DescribeKeyRequest{KeyID: test.keyID})
+		if test.code != "" {
+			if ce, ok := err.(common.Error); !ok || ce.Code != test.code {
+				t.Errorf("%v: got %v, want %v", test.keyID, err, test.code)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: %v", test.keyID, err)
+			continue
+		}
+		if out.KeyMetadata.KeyManager != "AWS" {
+			t.Errorf("%v: key manager is %v", test.keyID, out.KeyMetadata.KeyManager)
+		}
+	}
+
+	// Looking a managed key up again finds the same key.
+	first, _ := store.DescribeKey(&kms.DescribeKeyRequest{KeyID: "alias/aws/s3"})
+	second, _ := store.DescribeKey(&kms.DescribeKeyRequest{KeyID: "alias/aws/s3"})
+	if first.KeyMetadata.KeyID != second.KeyMetadata.KeyID {
+		t.Errorf("alias/aws/s3 resolved to %v and then %v", first.KeyMetadata.KeyID, second.KeyMetadata.KeyID)
+	}
+
+	keys, err := store.ListKeys(&kms.ListKeysRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys.Keys) != 3 {
+		t.Errorf("%v managed keys created, want 3", len(keys.Keys))
+	}
+}
@@ -0,0 +1,42 @@
+package kms
+
+import "github.com/fernomac/aws-local/pkg/metrics"
+
+// RegisterMetrics registers gauges describing the contents of the given KMS
+// store: keys by state, aliases and grants.
+func RegisterMetrics(r *metrics.Registry, svc KMS) {
+	k, ok := svc.(*kms)
+	if !ok {
+		return
+	}
+
+	r.NewGaugeFunc("kms_keys", "Number of keys, by key state.", func() []metrics.Sample {
+		k.lock.RLock()
+		defer k.lock.RUnlock()
+
+		counts := map[string]int{}
+		for _, key := range k.keys {
+			key.lock.RLock()
+			counts[string(key.state())]++
+			key.lock.RUnlock()
+		}
+
+		samples := []metrics.Sample{}
+		for state, n := range counts {
+			samples = append(samples, metrics.Sample{Labels: []string{state}, Value: float64(n)})
+		}
+		return samples
+	}, "state")
+
+	r.NewGaugeFunc("kms_aliases", "Number of aliases.", func() []metrics.Sample {
+		k.lock.RLock()
+		defer k.lock.RUnlock()
+		return []metrics.Sample{{Value: float64(len(k.aliases))}}
+	})
+
+	r.NewGaugeFunc("kms_grants", "Number of grants.", func() []metrics.Sample {
+		k.lock.RLock()
+		defer k.lock.RUnlock()
+		return []metrics.Sample{{Value: float64(len(k.grants))}}
+	})
+}
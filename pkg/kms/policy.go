@@ -2,7 +2,10 @@ package kms
 
 import (
 	"encoding/json"
-	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/fernomac/aws-local/pkg/common"
 )
 
 type statement struct {
@@ -17,38 +20,294 @@ type statement struct {
 	Condition    interface{} `json:"Condition"`
 }
 
+// statements is a list of statements, which may be written as a single
+// statement object.
+type statements []*statement
+
+func (s *statements) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '{' {
+		one := &statement{}
+		if err := json.Unmarshal(data, one); err != nil {
+			return err
+		}
+		*s = statements{one}
+		return nil
+	}
+	return json.Unmarshal(data, (*[]*statement)(s))
+}
+
 type policy struct {
-	Version   string       `json:"Version"`
-	Statement []*statement `json:"Statement"`
+	Version   string     `json:"Version"`
+	Statement statements `json:"Statement"`
+
+	rules []*rule
+}
+
+// condition is a single compiled condition: an operator applied to a key.
+type condition struct {
+	op     *operator
+	key    string
+	values []string
+}
+
+// rule is a compiled statement.
+type rule struct {
+	allow        bool
+	actions      []string
+	notActions   []string
+	resources    []string
+	notResources []string
+	conditions   []condition
+}
+
+// stringList reads a policy element that may be a string or a list of them.
+func stringList(v interface{}) ([]string, error) {
+	switch val := v.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []string{val}, nil
+	case bool:
+		return []string{fmt.Sprint(val)}, nil
+	case float64:
+		return []string{fmt.Sprint(val)}, nil
+	case []interface{}:
+		out := []string{}
+		for _, elem := range val {
+			strs, err := stringList(elem)
+			if err != nil || len(strs) != 1 {
+				return nil, common.NewError("MalformedPolicyDocumentException")
+			}
+			out = append(out, strs[0])
+		}
+		return out, nil
+	}
+	return nil, common.NewError("MalformedPolicyDocumentException")
+}
+
+func compile(s *statement) (*rule, error) {
+	malformed := common.NewError("MalformedPolicyDocumentException")
+	r := &rule{}
+
+	switch s.Effect {
+	case "Allow":
+		r.allow = true
+	case "Deny":
+	default:
+		return nil, malformed
+	}
+
+	if s.Principal == nil && s.NotPrincipal == nil {
+		return nil, malformed
+	}
+
+	var err error
+	if r.actions, err = stringList(s.Action); err != nil {
+		return nil, err
+	}
+	if r.notActions, err = stringList(s.NotAction); err != nil {
+		return nil, err
+	}
+	if (r.actions == nil) == (r.notActions == nil) {
+		return nil, malformed
+	}
+
+	if r.resources, err = stringList(s.Resource); err != nil {
+		return nil, err
+	}
+	if r.notResources, err = stringList(s.NotResource); err != nil {
+		return nil, err
+	}
+	if (r.resources == nil) == (r.notResources == nil) {
+		return nil, malformed
+	}
+
+	if s.Condition != nil {
+		ops, ok := s.Condition.(map[string]interface{})
+		if !ok {
+			return nil, malformed
+		}
+		for name, block := range ops {
+			op, err := parseOperator(name)
+			if err != nil {
+				return nil, malformed
+			}
+			keys, ok := block.(map[string]interface{})
+			if !ok {
+				return nil, malformed
+			}
+			for key, value := range keys {
+				values, err := stringList(value)
+				if err != nil {
+					return nil, err
+				}
+				r.conditions = append(r.conditions, condition{op: op, key: key, values: values})
+			}
+		}
+	}
+
+	return r, nil
+}
+
+func matchesAny(patterns []string, s string, fold bool) bool {
+	for _, p := range patterns {
+		if fold {
+			if globMatch(strings.ToLower(p), strings.ToLower(s)) {
+				return true
+			}
+		} else if globMatch(p, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// applies reports whether the rule applies to the request. Principals aren't
+// checked, since callers aren't authenticated; every principal matches.
+func (r *rule) applies(action string, resource string, ctx conditions) bool {
+	if r.actions != nil && !matchesAny(r.actions, action, true) {
+		return false
+	}
+	if r.notActions != nil && matchesAny(r.notActions, action, true) {
+		return false
+	}
+	if r.resources != nil && !matchesAny(r.resources, resource, false) {
+		return false
+	}
+	if r.notResources != nil && matchesAny(r.notResources, resource, false) {
+		return false
+	}
+	for _, c := range r.conditions {
+		if !c.op.evaluate(c.key, c.values, ctx) {
+			return false
+		}
+	}
+	return true
+}
+
+// allows reports whether the policy allows the action: some statement must
+// allow it and none may deny it.
+func (p *policy) allows(action string, resource string, ctx conditions) bool {
+	allowed := false
+	for _, r := range p.rules {
+		if !r.applies(action, resource, ctx) {
+			continue
+		}
+		if !r.allow {
+			return false
+		}
+		allowed = true
+	}
+	return allowed
 }
 
 func parsePolicy(str string) (*policy, error) {
 	out := &policy{}
 	if err := json.Unmarshal([]byte(str), out); err != nil {
-		return nil, err
+		return nil, common.NewError("MalformedPolicyDocumentException")
+	}
+	if len(out.Statement) == 0 {
+		return nil, common.NewError("MalformedPolicyDocumentException")
 	}
 
-	// TODO: Otherwise sanity check the policy?
+	for _, s := range out.Statement {
+		r, err := compile(s)
+		if err != nil {
+			return nil, err
+		}
+		out.rules = append(out.rules, r)
+	}
 
 	return out, nil
 }
 
-func (k *kms) ListKeyPolicies(req *ListKeyPoliciesRequest) (*ListKeyPoliciesResult, error) {
-	k.lock.Lock()
-	defer k.lock.Unlock()
+// defaultPolicy is the policy a key gets if none is given, allowing the
+// account to do anything with it.
+func defaultPolicy(account string) string {
+	return fmt.Sprintf(`{
+  "Version": "2012-10-17",
+  "Id": "key-default-1",
+  "Statement": [
+    {
+      "Sid": "Enable IAM User Permissions",
+      "Effect": "Allow",
+      "Principal": {"AWS": "arn:aws:iam::%v:root"},
+      "Action": "kms:*",
+      "Resource": "*"
+    }
+  ]
+}`, account)
+}
+
+// aliasesOf returns the names of the aliases pointing at the key.
+func (k *kms) aliasesOf(key *key) []string {
+	k.lock.RLock()
+	defer k.lock.RUnlock()
+	return k.aliasesOfLocked(key)
+}
+
+// aliasesOfLocked is aliasesOf for callers that hold k.lock.
+func (k *kms) aliasesOfLocked(key *key) []string {
+	names := []string{}
+	for name, a := range k.aliases {
+		if a.key == key {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// authorize checks that the key's policy allows the action. The request's
+// condition keys are joined by those describing the key itself.
+func (k *kms) authorize(key *key, action string, ctx conditions) error {
+	return authorizeWith(key, k.aliasesOf(key), action, ctx)
+}
+
+// authorizeLocked is authorize for callers that hold k.lock.
+func (k *kms) authorizeLocked(key *key, action string, ctx conditions) error {
+	return authorizeWith(key, k.aliasesOfLocked(key), action, ctx)
+}
+
+func authorizeWith(key *key, aliases []string, action string, ctx conditions) error {
+	key.lock.RLock()
+	p := key.policy
+	ctx = resourceConditions(key.tags, aliases).merge(ctx)
+	key.lock.RUnlock()
+
+	if p != nil && !p.allows(action, key.meta.Arn, ctx) {
+		return common.NewError("AccessDeniedException")
+	}
+	return nil
+}
 
+// authorized looks up a key and checks that its policy allows the action.
+func (k *kms) authorized(keyID string, action string, ctx conditions) (*key, error) {
+	key, err := k.lookup(keyID)
+	if err != nil {
+		return nil, err
+	}
+	if err := k.authorize(key, action, requestAliasConditions(keyID).merge(ctx)); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func (k *kms) ListKeyPolicies(req *ListKeyPoliciesRequest) (*ListKeyPoliciesResult, error) {
 	if req.Marker != "" {
-		return nil, errors.New("InvalidMarkerException")
+		return nil, common.NewError("InvalidMarkerException")
 	}
 	if req.Limit != 0 {
-		return nil, errors.New("LimitNotSupported")
+		return nil, common.NewError("LimitNotSupported")
 	}
 
-	key := k.get(req.KeyID)
-	if key == nil {
-		return nil, errors.New("NotFoundException")
+	key, err := k.lookup(req.KeyID)
+	if err != nil {
+		return nil, err
 	}
 
+	key.lock.RLock()
+	defer key.lock.RUnlock()
+
 	names := []string{}
 	for name := range key.policies {
 		names = append(names, name)
@@ -61,17 +320,17 @@ func (k *kms) ListKeyPolicies(req *ListKeyPoliciesRequest) (*ListKeyPoliciesResu
 }
 
 func (k *kms) GetKeyPolicy(req *GetKeyPolicyRequest) (*GetKeyPolicyResult, error) {
-	k.lock.Lock()
-	defer k.lock.Unlock()
-
-	key := k.get(req.KeyID)
-	if key == nil {
-		return nil, errors.New("NotFoundException")
+	key, err := k.lookup(req.KeyID)
+	if err != nil {
+		return nil, err
 	}
 
+	key.lock.RLock()
+	defer key.lock.RUnlock()
+
 	policy, ok := key.policies[req.PolicyName]
 	if !ok {
-		return nil, errors.New("NotFoundException")
+		return nil, common.NewError("NotFoundException")
 	}
 
 	return &GetKeyPolicyResult{
@@ -80,5 +339,32 @@ func (k *kms) GetKeyPolicy(req *GetKeyPolicyRequest) (*GetKeyPolicyResult, error
 }
 
 func (k *kms) PutKeyPolicy(req *PutKeyPolicyRequest) error {
-	return errors.New("Unsupported")
+	if req.PolicyName != "default" {
+		return common.NewError("NotFoundException")
+	}
+
+	key, err := k.authorized(req.KeyID, "kms:PutKeyPolicy", nil)
+	if err != nil {
+		return err
+	}
+	if err := key.allows("PutKeyPolicy"); err != nil {
+		return err
+	}
+
+	p, err := parsePolicy(req.Policy)
+	if err != nil {
+		return err
+	}
+
+	// Refuse policies that would lock everyone out of the key.
+	if !req.BypassPolicyLockoutSafetyCheck && !p.allows("kms:PutKeyPolicy", key.meta.Arn, nil) {
+		return common.NewError("MalformedPolicyDocumentException")
+	}
+
+	key.lock.Lock()
+	defer key.lock.Unlock()
+
+	key.policies[req.PolicyName] = req.Policy
+	key.policy = p
+	return nil
 }
@@ -0,0 +1,253 @@
+package kms_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/fernomac/aws-local/pkg/common"
+	"github.com/fernomac/aws-local/pkg/kms"
+)
+
+// conditionPolicy lets anyone put the key's policy, tag it and create aliases
+// for it, and do anything else only if the condition holds.
+func conditionPolicy(condition string) string {
+	return `{
+  "Version": "2012-10-17",
+  "Statement": [
+    {"Effect": "Allow", "Principal": {"AWS": "*"}, "Action": ["kms:PutKeyPolicy", "kms:TagResource", "kms:CreateAlias"], "Resource": "*"},
+    {"Effect": "Allow", "Principal": {"AWS": "*"}, "Action": "kms:*", "Resource": "*", "Condition": ` + condition + `}
+  ]
+}`
+}
+
+func createKeyWithPolicy(t *testing.T, store kms.KMS, policy string, tags ...kms.Tag) string {
+	out, err := store.CreateKey(&kms.CreateKeyRequest{Policy: policy, Tags: tags})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out.KeyMetadata.KeyID
+}
+
+func TestResourceTagConditions(t *testing.T) {
+	store := kms.New()
+	policy := conditionPolicy(`{"StringEquals": {"aws:ResourceTag/team": "blue"}}`)
+	team := func(name string) kms.Tag { return kms.Tag{TagKey: "team", TagValue: name} }
+	blue := createKeyWithPolicy(t, store, policy, team("blue"))
+	blue2 := createKeyWithPolicy(t, store, policy, team("blue"))
+	red := createKeyWithPolicy(t, store, policy, team("blue"))
+
+	for name, target := range map[string]string{"alias/blue": blue, "alias/blue2": blue2, "alias/red": red} {
+		if err := store.CreateAlias(&kms.CreateAliasRequest{AliasName: name, TargetKeyID: target}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Tags are checked as they are at the time of each call.
+	if err := store.TagResource(&kms.TagResourceRequest{KeyID: red, Tags: []kms.Tag{team("red")}}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		do   func() error
+		code string
+	}{
+		{"DescribeKey", func() error {
+			_, err := store.DescribeKey(&kms.DescribeKeyRequest{KeyID: blue})
+			return err
+		}, ""},
+		{"DescribeKey red", func() error {
+			_, err := store.DescribeKey(&kms.DescribeKeyRequest{KeyID: red})
+			return err
+		}, "AccessDeniedException"},
+		{"UpdateKeyDescription", func() error {
+			return store.UpdateKeyDescription(&kms.UpdateKeyDescriptionRequest{KeyID: blue, Description: "d"})
+		}, ""},
+		{"UpdateKeyDescription red", func() error {
+			return store.UpdateKeyDescription(&kms.UpdateKeyDescriptionRequest{KeyID: red, Description: "d"})
+		}, "AccessDeniedException"},
+		{"DisableKey", func() error { return store.DisableKey(&kms.DisableKeyRequest{KeyID: blue}) }, ""},
+		{"DisableKey red", func() error { return store.DisableKey(&kms.DisableKeyRequest{KeyID: red}) }, "AccessDeniedException"},
+		{"EnableKey", func() error { return store.EnableKey(&kms.EnableKeyRequest{KeyID: blue}) }, ""},
+		{"EnableKey red", func() error { return store.EnableKey(&kms.EnableKeyRequest{KeyID: red}) }, "AccessDeniedException"},
+		{"ScheduleKeyDeletion", func() error {
+			_, err := store.ScheduleKeyDeletion(&kms.ScheduleKeyDeletionRequest{KeyID: blue})
+			return err
+		}, ""},
+		{"ScheduleKeyDeletion red", func() error {
+			_, err := store.ScheduleKeyDeletion(&kms.ScheduleKeyDeletionRequest{KeyID: red})
+			return err
+		}, "AccessDeniedException"},
+		{"CancelKeyDeletion", func() error {
+			_, err := store.CancelKeyDeletion(&kms.CancelKeyDeletionRequest{KeyID: blue})
+			return err
+		}, ""},
+		{"CancelKeyDeletion red", func() error {
+			_, err := store.CancelKeyDeletion(&kms.CancelKeyDeletionRequest{KeyID: red})
+			return err
+		}, "AccessDeniedException"},
+		{"UpdateAlias", func() error {
+			return store.UpdateAlias(&kms.UpdateAliasRequest{AliasName: "alias/blue", TargetKeyID: blue2})
+		}, ""},
+		{"UpdateAlias to red", func() error {
+			return store.UpdateAlias(&kms.UpdateAliasRequest{AliasName: "alias/blue2", TargetKeyID: red})
+		}, "AccessDeniedException"},
+		{"UpdateAlias from red", func() error {
+			return store.UpdateAlias(&kms.UpdateAliasRequest{AliasName: "alias/red", TargetKeyID: blue})
+		}, "AccessDeniedException"},
+		{"DeleteAlias", func() error { return store.DeleteAlias(&kms.DeleteAliasRequest{AliasName: "alias/blue"}) }, ""},
+		{"DeleteAlias red", func() error { return store.DeleteAlias(&kms.DeleteAliasRequest{AliasName: "alias/red"}) }, "AccessDeniedException"},
+		{"Encrypt red", func() error {
+			_, err := store.Encrypt(&kms.EncryptRequest{KeyID: red, Plaintext: "aGk="})
+			return err
+		}, "AccessDeniedException"},
+	}
+
+	for _, test := range tests {
+		if got := code(test.do()); got != test.code {
+			t.Errorf("%v: got %v, want %v", test.name, got, test.code)
+		}
+	}
+}
+
+func TestResourceAliasConditions(t *testing.T) {
+	store := kms.New()
+	id := createKeyWithPolicy(t, store, conditionPolicy(`{"ForAnyValue:StringEquals": {"kms:ResourceAliases": "alias/app"}}`))
+
+	encrypt := func() error {
+		_, err := store.Encrypt(&kms.EncryptRequest{KeyID: id, Plaintext: "aGk="})
+		return err
+	}
+	describe := func() error {
+		_, err := store.DescribeKey(&kms.DescribeKeyRequest{KeyID: id})
+		return err
+	}
+	createAlias := func(name string) func() error {
+		return func() error { return store.CreateAlias(&kms.CreateAliasRequest{AliasName: name, TargetKeyID: id}) }
+	}
+	deleteAlias := func(name string) func() error {
+		return func() error { return store.DeleteAlias(&kms.DeleteAliasRequest{AliasName: name}) }
+	}
+
+	steps := []struct {
+		name string
+		do   func() error
+		code string
+	}{
+		{"Encrypt without alias", encrypt, "AccessDeniedException"},
+		{"DescribeKey without alias", describe, "AccessDeniedException"},
+		{"CreateAlias other", createAlias("alias/other"), ""},
+		{"Encrypt with other alias", encrypt, "AccessDeniedException"},
+		{"CreateAlias app", createAlias("alias/app"), ""},
+		{"Encrypt with alias", encrypt, ""},
+		{"DescribeKey with alias", describe, ""},
+		{"DeleteAlias app", deleteAlias("alias/app"), ""},
+		{"Encrypt after delete", encrypt, "AccessDeniedException"},
+		{"DeleteAlias other", deleteAlias("alias/other"), "AccessDeniedException"},
+	}
+
+	for _, step := range steps {
+		if got := code(step.do()); got != step.code {
+			t.Errorf("%v: got %v, want %v", step.name, got, step.code)
+		}
+	}
+}
+
+func TestRequestAliasConditions(t *testing.T) {
+	store := kms.New()
+	id := createKeyWithPolicy(t, store, conditionPolicy(`{"StringEquals": {"kms:RequestAlias": "alias/app"}}`))
+	for _, name := range []string{"alias/app", "alias/other"} {
+		if err := store.CreateAlias(&kms.CreateAliasRequest{AliasName: name, TargetKeyID: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	listed, err := store.ListAliases(&kms.ListAliasesRequest{KeyID: id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	aliasArns := map[string]string{}
+	for _, a := range listed.Aliases {
+		aliasArns[a.AliasName] = a.AliasArn
+	}
+
+	tests := []struct {
+		keyID string
+		code  string
+	}{
+		{"alias/app", ""},
+		{aliasArns["alias/app"], ""},
+		{"alias/other", "AccessDeniedException"},
+		{id, "AccessDeniedException"},
+		{fmt.Sprintf("arn:aws:kms:%v:%v:key/%v", common.Region, common.AccountID, id), "AccessDeniedException"},
+	}
+
+	for _, test := range tests {
+		_, err := store.Encrypt(&kms.EncryptRequest{KeyID: test.keyID, Plaintext: "aGk="})
+		if got := code(err); got != test.code {
+			t.Errorf("Encrypt with %v: got %v, want %v", test.keyID, got, test.code)
+		}
+		_, err = store.DescribeKey(&kms.DescribeKeyRequest{KeyID: test.keyID})
+		if got := code(err); got != test.code {
+			t.Errorf("DescribeKey with %v: got %v, want %v", test.keyID, got, test.code)
+		}
+	}
+}
+
+func TestTagLimits(t *testing.T) {
+	tags := func(prefix string, n int) []kms.Tag {
+		out := []kms.Tag{}
+		for i := 0; i < n; i++ {
+			out = append(out, kms.Tag{TagKey: fmt.Sprintf("%v%v", prefix, i), TagValue: "v"})
+		}
+		return out
+	}
+
+	create := []struct {
+		name string
+		tags []kms.Tag
+		code string
+	}{
+		{"50 tags", tags("k", 50), ""},
+		{"51 tags", tags("k", 51), "TagException"},
+		{"aws: prefix", []kms.Tag{{TagKey: "aws:owner", TagValue: "v"}}, "TagException"},
+		{"AWS: prefix", []kms.Tag{{TagKey: "AWS:owner", TagValue: "v"}}, "TagException"},
+		{"aws in key", []kms.Tag{{TagKey: "laws:owner", TagValue: "v"}}, ""},
+		{"empty key", []kms.Tag{{TagKey: "", TagValue: "v"}}, "TagException"},
+		{"long key", []kms.Tag{{TagKey: strings.Repeat("k", 129), TagValue: "v"}}, "TagException"},
+		{"long value", []kms.Tag{{TagKey: "k", TagValue: strings.Repeat("v", 257)}}, "TagException"},
+	}
+
+	for _, test := range create {
+		store := kms.New()
+		_, err := store.CreateKey(&kms.CreateKeyRequest{Tags: test.tags})
+		if got := code(err); got != test.code {
+			t.Errorf("CreateKey with %v: got %v, want %v", test.name, got, test.code)
+		}
+	}
+
+	store := kms.New()
+	id := createKeyWithPolicy(t, store, "", tags("k", 30)...)
+	tag := []struct {
+		name string
+		tags []kms.Tag
+		code string
+	}{
+		{"past the limit", tags("n", 21), "TagException"},
+		{"aws: prefix", []kms.Tag{{TagKey: "aws:owner", TagValue: "v"}}, "TagException"},
+		{"up to the limit", tags("n", 20), ""},
+		{"replacing at the limit", tags("k", 30), ""},
+		{"one more", tags("m", 1), "TagException"},
+	}
+
+	for _, test := range tag {
+		err := store.TagResource(&kms.TagResourceRequest{KeyID: id, Tags: test.tags})
+		if got := code(err); got != test.code {
+			t.Errorf("TagResource %v: got %v, want %v", test.name, got, test.code)
+		}
+	}
+
+	err := store.UntagResource(&kms.UntagResourceRequest{KeyID: id, TagKeys: []string{"aws:owner"}})
+	if got := code(err); got != "TagException" {
+		t.Errorf("UntagResource aws: prefix: got %v, want TagException", got)
+	}
+}
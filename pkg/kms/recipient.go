@@ -0,0 +1,61 @@
+package kms
+
+import (
+	"encoding/base64"
+	"fmt"
+
+	"github.com/fernomac/aws-local/pkg/attestation"
+	"github.com/fernomac/aws-local/pkg/common"
+)
+
+// recipient verifies a Nitro Enclaves recipient's attestation document and
+// returns it along with the kms:RecipientAttestation:* condition keys it
+// implies. It returns a nil document if there is no recipient.
+func (k *kms) recipient(info *RecipientInfo) (*attestation.Document, conditions, error) {
+	if info == nil {
+		return nil, conditions{}, nil
+	}
+
+	if info.KeyEncryptionAlgorithm != "RSAES_OAEP_SHA_256" {
+		return nil, nil, common.NewError("ValidationException")
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(info.AttestationDocument)
+	if err != nil || len(raw) == 0 {
+		return nil, nil, common.NewError("ValidationException")
+	}
+
+	if k.attestationRoots == nil {
+		return nil, nil, common.NewError("ValidationException")
+	}
+	doc, err := attestation.Verify(raw, k.attestationRoots)
+	if err != nil {
+		return nil, nil, common.NewError("ValidationException")
+	}
+	if doc.PublicKey == nil {
+		return nil, nil, common.NewError("ValidationException")
+	}
+
+	conds := conditions{}
+	conds.set("kms:RecipientAttestation:ImageSha384", doc.ImageSha384())
+	for i := range doc.PCRs {
+		conds.set(fmt.Sprintf("kms:RecipientAttestation:PCR%v", i), doc.PCR(i))
+	}
+
+	return doc, conds, nil
+}
+
+// sealFor encrypts plaintext to the public key in the recipient's attestation
+// document, returning a base64-encoded CMS envelope.
+func sealFor(doc *attestation.Document, plaintext []byte) (string, error) {
+	pub, err := attestation.ParseRSAPublicKey(doc.PublicKey)
+	if err != nil {
+		return "", common.NewError("ValidationException")
+	}
+
+	sealed, err := attestation.Seal(pub, plaintext)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
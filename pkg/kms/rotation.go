@@ -1,25 +1,26 @@
 package kms
 
-import "errors"
+import "github.com/fernomac/aws-local/pkg/common"
 
 func (k *kms) GetKeyRotationStatus(req *GetKeyRotationStatusRequest) (*GetKeyRotationStatusResult, error) {
-	k.lock.Lock()
-	defer k.lock.Unlock()
-
-	key := k.get(req.KeyID)
-	if key == nil {
-		return nil, errors.New("NotFoundException")
+	key, err := k.lookup(req.KeyID)
+	if err != nil {
+		return nil, err
+	}
+	if err := key.allows("GetKeyRotationStatus"); err != nil {
+		return nil, err
 	}
 
+	// AWS managed keys are always rotated.
 	return &GetKeyRotationStatusResult{
-		KeyRotationEnabled: false,
+		KeyRotationEnabled: key.awsManaged(),
 	}, nil
 }
 
 func (k *kms) EnableKeyRotation(req *EnableKeyRotationRequest) error {
-	return errors.New("Unimplemented")
+	return common.NewError("Unimplemented")
 }
 
 func (k *kms) DisableKeyRotation(req *DisableKeyRotationRequest) error {
-	return errors.New("Unimplemented")
+	return common.NewError("Unimplemented")
 }
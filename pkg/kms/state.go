@@ -0,0 +1,126 @@
+package kms
+
+import "github.com/fernomac/aws-local/pkg/common"
+
+// KeyState is the state of a key.
+type KeyState string
+
+// The states a key can be in.
+const (
+	KeyStateCreating               KeyState = "Creating"
+	KeyStateEnabled                KeyState = "Enabled"
+	KeyStateDisabled               KeyState = "Disabled"
+	KeyStatePendingDeletion        KeyState = "PendingDeletion"
+	KeyStatePendingReplicaDeletion KeyState = "PendingReplicaDeletion"
+	KeyStatePendingImport          KeyState = "PendingImport"
+	KeyStateUnavailable            KeyState = "Unavailable"
+	KeyStateUpdating               KeyState = "Updating"
+)
+
+// stateRule says which key states an operation is allowed in. In any other
+// state it fails with KMSInvalidStateException, except that operations with
+// disabled set fail with DisabledException on a disabled key.
+type stateRule struct {
+	allowed  []KeyState
+	disabled bool
+}
+
+var (
+	anyState = stateRule{allowed: []KeyState{
+		KeyStateCreating, KeyStateEnabled, KeyStateDisabled, KeyStatePendingDeletion,
+		KeyStatePendingReplicaDeletion, KeyStatePendingImport, KeyStateUnavailable, KeyStateUpdating,
+	}}
+
+	// cryptoState is for cryptographic operations.
+	cryptoState = stateRule{allowed: []KeyState{KeyStateEnabled, KeyStateUpdating}, disabled: true}
+
+	// manageState is for changing a key that isn't on its way out.
+	manageState = stateRule{allowed: []KeyState{
+		KeyStateEnabled, KeyStateDisabled, KeyStatePendingImport, KeyStateUnavailable, KeyStateUpdating,
+	}}
+)
+
+// stateMatrix is the per-operation table from "Key states of AWS KMS keys" in
+// the KMS Developer Guide.
+var stateMatrix = map[string]stateRule{
+	"Encrypt":                             cryptoState,
+	"Decrypt":                             cryptoState,
+	"ReEncryptFrom":                       cryptoState,
+	"ReEncryptTo":                         cryptoState,
+	"GenerateDataKey":                     cryptoState,
+	"GenerateDataKeyWithoutPlaintext":     cryptoState,
+	"GenerateDataKeyPair":                 cryptoState,
+	"GenerateDataKeyPairWithoutPlaintext": cryptoState,
+
+	"DescribeKey":          anyState,
+	"GetKeyPolicy":         anyState,
+	"ListKeyPolicies":      anyState,
+	"ListResourceTags":     anyState,
+	"ListGrants":           anyState,
+	"RetireGrant":          anyState,
+	"RevokeGrant":          anyState,
+	"DeleteAlias":          anyState,
+	"PutKeyPolicy":         anyState,
+	"CreateAlias":          manageState,
+	"UpdateAlias":          manageState,
+	"TagResource":          manageState,
+	"UntagResource":        manageState,
+	"UpdateKeyDescription": manageState,
+	"CreateGrant":          manageState,
+	"GetKeyRotationStatus": manageState,
+
+	"EnableKey":  {allowed: []KeyState{KeyStateEnabled, KeyStateDisabled}},
+	"DisableKey": {allowed: []KeyState{KeyStateEnabled, KeyStateDisabled}},
+
+	"EnableKeyRotation":  {allowed: []KeyState{KeyStateEnabled, KeyStateUpdating}, disabled: true},
+	"DisableKeyRotation": {allowed: []KeyState{KeyStateEnabled, KeyStateUpdating}, disabled: true},
+
+	"ScheduleKeyDeletion": {allowed: []KeyState{KeyStateEnabled, KeyStateDisabled, KeyStatePendingImport, KeyStateUnavailable}},
+	"CancelKeyDeletion":   {allowed: []KeyState{KeyStatePendingDeletion, KeyStatePendingReplicaDeletion}},
+
+	"GetParametersForImport":    {allowed: []KeyState{KeyStateEnabled, KeyStateDisabled, KeyStatePendingImport}},
+	"ImportKeyMaterial":         {allowed: []KeyState{KeyStateEnabled, KeyStateDisabled, KeyStatePendingImport}},
+	"DeleteImportedKeyMaterial": {allowed: []KeyState{KeyStateEnabled, KeyStateDisabled, KeyStatePendingImport}},
+}
+
+// allows checks that the operation is allowed in this state. An operation
+// with no rule in the matrix is a bug, reported as InternalFailure.
+func (s KeyState) allows(operation string) error {
+	rule, ok := stateMatrix[operation]
+	if !ok {
+		return common.Errorf("InternalFailure", "No key state rule for %v.", operation)
+	}
+
+	for _, a := range rule.allowed {
+		if a == s {
+			return nil
+		}
+	}
+	if s == KeyStateDisabled && rule.disabled {
+		return common.NewError("DisabledException")
+	}
+	return common.NewError("KMSInvalidStateException")
+}
+
+// state returns the key's state, which is Unavailable if the key's custom key
+// store isn't connected. The caller must hold key.lock.
+func (key *key) state() KeyState {
+	s := key.meta.KeyState
+	if key.store != nil && !key.store.connected() && (s == KeyStateEnabled || s == KeyStateDisabled) {
+		return KeyStateUnavailable
+	}
+	return s
+}
+
+// setState moves the key to a new state. The caller must hold key.lock.
+func (key *key) setState(s KeyState) {
+	key.meta.KeyState = s
+	key.meta.Enabled = s == KeyStateEnabled
+}
+
+// allows checks that the operation may be done to the key; see can.
+func (key *key) allows(operation string) error {
+	key.lock.RLock()
+	defer key.lock.RUnlock()
+	return key.can(operation)
+}
@@ -0,0 +1,76 @@
+package kms
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/fernomac/aws-local/pkg/common"
+)
+
+// keylessOperations are the operations that don't act on a key, and so have
+// no row in the state matrix.
+var keylessOperations = map[string]bool{
+	"GenerateRandom":           true,
+	"ListKeys":                 true,
+	"CreateKey":                true,
+	"ListAliases":              true,
+	"ListRetireableGrants":     true,
+	"CreateCustomKeyStore":     true,
+	"DescribeCustomKeyStores":  true,
+	"ConnectCustomKeyStore":    true,
+	"DisconnectCustomKeyStore": true,
+	"UpdateCustomKeyStore":     true,
+	"DeleteCustomKeyStore":     true,
+}
+
+// TestStateMatrixCoversOperations checks that every operation on a key has a
+// row in the state matrix, so that allows never reports InternalFailure.
+func TestStateMatrixCoversOperations(t *testing.T) {
+	api := reflect.TypeOf((*KMS)(nil)).Elem()
+	for i := 0; i < api.NumMethod(); i++ {
+		op := api.Method(i).Name
+		if keylessOperations[op] {
+			continue
+		}
+
+		rows := []string{op}
+		if op == "ReEncrypt" {
+			rows = []string{"ReEncryptFrom", "ReEncryptTo"}
+		}
+		for _, row := range rows {
+			if _, ok := stateMatrix[row]; !ok {
+				t.Errorf("%v: no key state rule for %v", op, row)
+			}
+		}
+	}
+}
+
+func TestStateAllows(t *testing.T) {
+	tests := []struct {
+		state KeyState
+		op    string
+		code  string
+	}{
+		{KeyStateEnabled, "Encrypt", ""},
+		{KeyStateDisabled, "Encrypt", "DisabledException"},
+		{KeyStatePendingImport, "Encrypt", "KMSInvalidStateException"},
+		{KeyStatePendingDeletion, "DescribeKey", ""},
+		{KeyStatePendingDeletion, "CreateAlias", "KMSInvalidStateException"},
+		{KeyStatePendingDeletion, "CancelKeyDeletion", ""},
+		{KeyStateEnabled, "CancelKeyDeletion", "KMSInvalidStateException"},
+		{KeyStateEnabled, "NoSuchOperation", "InternalFailure"},
+	}
+
+	for _, test := range tests {
+		err := test.state.allows(test.op)
+		if test.code == "" {
+			if err != nil {
+				t.Errorf("%v in %v: %v", test.op, test.state, err)
+			}
+			continue
+		}
+		if ce, ok := err.(common.Error); !ok || ce.Code != test.code {
+			t.Errorf("%v in %v: got %v, want %v", test.op, test.state, err, test.code)
+		}
+	}
+}
@@ -0,0 +1,270 @@
+package kms_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+
+	"github.com/fernomac/aws-local/pkg/kms"
+)
+
+type sealed struct {
+	blob      string
+	ctx       map[string]string
+	plaintext []byte
+}
+
+// stress drives a KMS from many goroutines at once, recording every
+// ciphertext it produces so they can be checked afterwards.
+type stress struct {
+	t   *testing.T
+	svc kms.KMS
+
+	lock   sync.Mutex
+	keys   []string
+	sealed []sealed
+}
+
+func (s *stress) randomKey(r *rand.Rand) string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.keys[r.Intn(len(s.keys))]
+}
+
+// allowed reports whether err is one that concurrent traffic can legitimately
+// cause, e.g. using a key another goroutine just disabled.
+func allowed(err error) bool {
+	switch err.Error() {
+	case "DisabledException", "NotFoundException", "AlreadyExistsException":
+		return true
+	}
+	return false
+}
+
+func (s *stress) check(op string, err error) {
+	if err != nil && !allowed(err) {
+		s.t.Errorf("%v: unexpected error: %v", op, err)
+	}
+}
+
+func (s *stress) step(r *rand.Rand, worker int) {
+	switch n := r.Intn(100); {
+	case n < 5:
+		out, err := s.svc.CreateKey(&kms.CreateKeyRequest{Description: fmt.Sprint(worker)})
+		s.check("CreateKey", err)
+		if err == nil {
+			s.lock.Lock()
+			s.keys = append(s.keys, out.KeyMetadata.KeyID)
+			s.lock.Unlock()
+		}
+
+	case n < 15:
+		alias := fmt.Sprintf("alias/stress-%v", r.Intn(8))
+		switch r.Intn(3) {
+		case 0:
+			s.check("CreateAlias", s.svc.CreateAlias(&kms.CreateAliasRequest{AliasName: alias, TargetKeyID: s.randomKey(r)}))
+		case 1:
+			s.check("UpdateAlias", s.svc.UpdateAlias(&kms.UpdateAliasRequest{AliasName: alias, TargetKeyID: s.randomKey(r)}))
+		case 2:
+			s.check("DeleteAlias", s.svc.DeleteAlias(&kms.DeleteAliasRequest{AliasName: alias}))
+		}
+
+	case n < 25:
+		id := s.randomKey(r)
+		if r.Intn(2) == 0 {
+			s.check("DisableKey", s.svc.DisableKey(&kms.DisableKeyRequest{KeyID: id}))
+		} else {
+			s.check("EnableKey", s.svc.EnableKey(&kms.EnableKeyRequest{KeyID: id}))
+		}
+
+	case n < 30:
+		id := s.randomKey(r)
+		err := s.svc.TagResource(&kms.TagResourceRequest{
+			KeyID: id,
+			Tags:  []kms.Tag{{TagKey: "worker", TagValue: fmt.Sprint(worker)}},
+		})
+		s.check("TagResource", err)
+		_, err = s.svc.DescribeKey(&kms.DescribeKeyRequest{KeyID: id})
+		s.check("DescribeKey", err)
+
+	case n < 35:
+		s.checkAliases()
+
+	case n < 70:
+		id := s.randomKey(r)
+		if r.Intn(4) == 0 {
+			id = fmt.Sprintf("alias/stress-%v", r.Intn(8))
+		}
+
+		plaintext := make([]byte, 1+r.Intn(256))
+		r.Read(plaintext)
+		ctx := map[string]string{"worker": fmt.Sprint(worker), "n": fmt.Sprint(n)}
+
+		out, err := s.svc.Encrypt(&kms.EncryptRequest{
+			KeyID:             id,
+			Plaintext:         base64.StdEncoding.EncodeToString(plaintext),
+			EncryptionContext: ctx,
+		})
+		s.check("Encrypt", err)
+		if err == nil {
+			s.lock.Lock()
+			s.sealed = append(s.sealed, sealed{out.CiphertextBlob, ctx, plaintext})
+			s.lock.Unlock()
+		}
+
+	case n < 80:
+		out, err := s.svc.GenerateDataKey(&kms.GenerateDataKeyRequest{KeyID: s.randomKey(r), KeySpec: "AES_256"})
+		s.check("GenerateDataKey", err)
+		if err == nil {
+			plaintext, _ := base64.StdEncoding.DecodeString(out.Plaintext)
+			s.lock.Lock()
+			s.sealed = append(s.sealed, sealed{out.CiphertextBlob, nil, plaintext})
+			s.lock.Unlock()
+		}
+
+	default:
+		s.lock.Lock()
+		if len(s.sealed) == 0 {
+			s.lock.Unlock()
+			return
+		}
+		c := s.sealed[r.Intn(len(s.sealed))]
+		s.lock.Unlock()
+
+		s.decrypt(c, false)
+	}
+}
+
+// decrypt checks that c decrypts to its original plaintext, and only with its
+// own encryption context.
+func (s *stress) decrypt(c sealed, mustSucceed bool) {
+	out, err := s.svc.Decrypt(&kms.DecryptRequest{CiphertextBlob: c.blob, EncryptionContext: c.ctx})
+	if err != nil {
+		if mustSucceed || !allowed(err) {
+			s.t.Errorf("Decrypt: unexpected error: %v", err)
+		}
+		return
+	}
+
+	plaintext, err := base64.StdEncoding.DecodeString(out.Plaintext)
+	if err != nil {
+		s.t.Errorf("Decrypt: bad plaintext: %v", err)
+		return
+	}
+	if !bytes.Equal(plaintext, c.plaintext) {
+		s.t.Errorf("Decrypt: got %x, want %x", plaintext, c.plaintext)
+	}
+
+	wrong := map[string]string{"worker": "nobody"}
+	if _, err := s.svc.Decrypt(&kms.DecryptRequest{CiphertextBlob: c.blob, EncryptionContext: wrong}); err == nil {
+		s.t.Errorf("Decrypt: succeeded with the wrong encryption context")
+	}
+}
+
+// checkAliases checks that every alias points at a key that exists.
+func (s *stress) checkAliases() {
+	aliases, err := s.svc.ListAliases(&kms.ListAliasesRequest{})
+	if err != nil {
+		s.t.Errorf("ListAliases: %v", err)
+		return
+	}
+
+	for _, alias := range aliases.Aliases {
+		if _, err := s.svc.DescribeKey(&kms.DescribeKeyRequest{KeyID: alias.TargetKeyID}); err != nil {
+			s.t.Errorf("alias %v points at %v: %v", alias.AliasName, alias.TargetKeyID, err)
+		}
+		if _, err := s.svc.DescribeKey(&kms.DescribeKeyRequest{KeyID: alias.AliasName}); err != nil && !allowed(err) {
+			s.t.Errorf("DescribeKey(%v): %v", alias.AliasName, err)
+		}
+	}
+}
+
+func TestConcurrentStress(t *testing.T) {
+	workers, steps := 16, 500
+	if testing.Short() {
+		steps = 100
+	}
+
+	s := &stress{t: t, svc: kms.New()}
+	for i := 0; i < 4; i++ {
+		out, err := s.svc.CreateKey(&kms.CreateKeyRequest{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.keys = append(s.keys, out.KeyMetadata.KeyID)
+	}
+
+	wg := sync.WaitGroup{}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			r := rand.New(rand.NewSource(int64(worker)))
+			for i := 0; i < steps; i++ {
+				s.step(r, worker)
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	// Once the dust settles, every key can be re-enabled and every ciphertext
+	// ever produced must decrypt.
+	for _, id := range s.keys {
+		if err := s.svc.EnableKey(&kms.EnableKeyRequest{KeyID: id}); err != nil {
+			t.Fatalf("EnableKey(%v): %v", id, err)
+		}
+	}
+
+	s.checkAliases()
+	for _, c := range s.sealed {
+		s.decrypt(c, true)
+	}
+
+	keys, err := s.svc.ListKeys(&kms.ListKeysRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys.Keys) != len(s.keys) {
+		t.Errorf("ListKeys returned %v keys, want %v", len(keys.Keys), len(s.keys))
+	}
+}
+
+// TestConcurrentAliasChurn creates and deletes one alias while other
+// goroutines resolve and list it, so that the race detector sees DeleteAlias
+// contend with every reader of the alias index.
+func TestConcurrentAliasChurn(t *testing.T) {
+	svc := kms.New()
+	out, err := svc.CreateKey(&kms.CreateKeyRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := out.KeyMetadata.KeyID
+
+	wg := sync.WaitGroup{}
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				var err error
+				switch worker % 4 {
+				case 0:
+					err = svc.CreateAlias(&kms.CreateAliasRequest{AliasName: "alias/churn", TargetKeyID: id})
+				case 1:
+					err = svc.DeleteAlias(&kms.DeleteAliasRequest{AliasName: "alias/churn"})
+				case 2:
+					_, err = svc.DescribeKey(&kms.DescribeKeyRequest{KeyID: "alias/churn"})
+				case 3:
+					_, err = svc.ListAliases(&kms.ListAliasesRequest{KeyID: id})
+				}
+				if err != nil && !allowed(err) {
+					t.Errorf("worker %v: unexpected error: %v", worker, err)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+}
@@ -1,23 +1,55 @@
 package kms
 
-import "errors"
+import (
+	"strings"
 
-func (k *kms) ListResourceTags(req *ListResourceTagsRequest) (*ListResourceTagsResult, error) {
-	k.lock.Lock()
-	defer k.lock.Unlock()
+	"github.com/fernomac/aws-local/pkg/common"
+)
+
+// maxTags is the most tags a key can have.
+const maxTags = 50
 
+// validTagKey checks a tag key's length and that it isn't in the aws:
+// namespace, which is reserved for AWS.
+func validTagKey(key string) error {
+	if len(key) < 1 || len(key) > 128 || strings.HasPrefix(strings.ToLower(key), "aws:") {
+		return common.NewError("TagException")
+	}
+	return nil
+}
+
+// validateTags checks the tags in a request.
+func validateTags(tags []Tag) error {
+	if len(tags) > maxTags {
+		return common.NewError("TagException")
+	}
+	for _, tag := range tags {
+		if err := validTagKey(tag.TagKey); err != nil {
+			return err
+		}
+		if len(tag.TagValue) > 256 {
+			return common.NewError("TagException")
+		}
+	}
+	return nil
+}
+
+func (k *kms) ListResourceTags(req *ListResourceTagsRequest) (*ListResourceTagsResult, error) {
 	if req.Marker != "" {
-		return nil, errors.New("InvalidMarkerException")
+		return nil, common.NewError("InvalidMarkerException")
 	}
 	if req.Limit != 0 {
-		return nil, errors.New("LimitNotSupported")
+		return nil, common.NewError("LimitNotSupported")
 	}
 
-	key := k.get(req.KeyID)
-	if key == nil {
-		return nil, errors.New("NotFoundException")
+	key, err := k.lookup(req.KeyID)
+	if err != nil {
+		return nil, err
 	}
 
+	key.lock.RLock()
+	defer key.lock.RUnlock()
+
 	tags := []Tag{}
 	for key, value := range key.tags {
 		tags = append(tags, Tag{TagKey: key, TagValue: value})
@@ -30,12 +62,30 @@ func (k *kms) ListResourceTags(req *ListResourceTagsRequest) (*ListResourceTagsR
 }
 
 func (k *kms) TagResource(req *TagResourceRequest) error {
-	k.lock.Lock()
-	defer k.lock.Unlock()
+	if err := validateTags(req.Tags); err != nil {
+		return err
+	}
+
+	key, err := k.authorized(req.KeyID, "kms:TagResource", requestTagConditions(req.Tags))
+	if err != nil {
+		return err
+	}
+
+	key.lock.Lock()
+	defer key.lock.Unlock()
 
-	key := k.get(req.KeyID)
-	if key == nil {
-		return errors.New("NotFoundException")
+	if err := key.can("TagResource"); err != nil {
+		return err
+	}
+
+	added := map[string]bool{}
+	for _, tag := range req.Tags {
+		if _, ok := key.tags[tag.TagKey]; !ok {
+			added[tag.TagKey] = true
+		}
+	}
+	if len(key.tags)+len(added) > maxTags {
+		return common.NewError("TagException")
 	}
 
 	for _, tag := range req.Tags {
@@ -46,12 +96,26 @@ func (k *kms) TagResource(req *TagResourceRequest) error {
 }
 
 func (k *kms) UntagResource(req *UntagResourceRequest) error {
-	k.lock.Lock()
-	defer k.lock.Unlock()
+	for _, tagKey := range req.TagKeys {
+		if err := validTagKey(tagKey); err != nil {
+			return err
+		}
+	}
+
+	conds := conditions{}
+	if len(req.TagKeys) > 0 {
+		conds.set("aws:TagKeys", req.TagKeys...)
+	}
+	key, err := k.authorized(req.KeyID, "kms:UntagResource", conds)
+	if err != nil {
+		return err
+	}
+
+	key.lock.Lock()
+	defer key.lock.Unlock()
 
-	key := k.get(req.KeyID)
-	if key == nil {
-		return errors.New("NotFoundException")
+	if err := key.can("UntagResource"); err != nil {
+		return err
 	}
 
 	for _, tag := range req.TagKeys {
@@ -0,0 +1,171 @@
+package kms
+
+import (
+	"net"
+	"sync"
+
+	"github.com/fernomac/aws-local/pkg/common"
+	"github.com/fernomac/aws-local/pkg/sigv4"
+	"github.com/fernomac/aws-local/pkg/xks"
+)
+
+// xksBackend delegates crypto to an external key store proxy.
+type xksBackend struct {
+	lock   sync.RWMutex
+	client *xks.Client
+}
+
+// NewXKSBackend creates a backend for an external key store that talks to
+// the XKS proxy given in the key store's settings.
+func NewXKSBackend(config *KeyStoreConfig) (Backend, error) {
+	return &xksBackend{}, nil
+}
+
+func isTimeout(err error) bool {
+	ne, ok := err.(net.Error)
+	return ok && ne.Timeout()
+}
+
+// connectionErrorCode maps a failed call to the proxy to a ConnectionErrorCode.
+func connectionErrorCode(err error) string {
+	switch {
+	case xks.Is(err, xks.ErrAuthenticationFailed):
+		return "INVALID_CREDENTIALS"
+	case xks.Is(err, xks.ErrAccessDenied):
+		return "XKS_PROXY_ACCESS_DENIED"
+	case xks.Is(err, xks.ErrInvalidURIPath):
+		return "XKS_PROXY_INVALID_CONFIGURATION"
+	case err == xks.ErrInvalidResponse:
+		return "XKS_PROXY_INVALID_RESPONSE"
+	case isTimeout(err):
+		return "XKS_PROXY_TIMED_OUT"
+	}
+	if _, ok := err.(*xks.Error); ok {
+		return "XKS_PROXY_INVALID_RESPONSE"
+	}
+	return "XKS_PROXY_NOT_REACHABLE"
+}
+
+// cryptoError maps a failed crypto call to the proxy to a KMS error.
+func cryptoError(err error) error {
+	switch {
+	case xks.Is(err, xks.ErrInvalidCiphertext):
+		return common.NewError("InvalidCiphertextException")
+	case isTimeout(err):
+		return common.NewError("DependencyTimeoutException")
+	}
+	return common.NewError("KMSInvalidStateException")
+}
+
+func requestMetadata(operation string) xks.RequestMetadata {
+	return xks.RequestMetadata{
+		AWSPrincipalArn: "arn:aws:iam::" + common.AccountID + ":root",
+		KMSOperation:    operation,
+		KMSRequestID:    common.NewRequestID(),
+	}
+}
+
+func (b *xksBackend) Connect(config *KeyStoreConfig) error {
+	client := xks.NewClient(config.XksProxyURIEndpoint, config.XksProxyURIPath, sigv4.Credentials{
+		AccessKeyID:     config.XksProxyCredential.AccessKeyID,
+		SecretAccessKey: config.XksProxyCredential.RawSecretAccessKey,
+	})
+
+	if _, err := client.Health(&xks.HealthRequest{RequestMetadata: requestMetadata("ConnectCustomKeyStore")}); err != nil {
+		return &ConnectionError{Code: connectionErrorCode(err), Err: err}
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.client = client
+	return nil
+}
+
+func (b *xksBackend) Disconnect() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.client = nil
+}
+
+func (b *xksBackend) get() (*xks.Client, error) {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
+	if b.client == nil {
+		return nil, common.NewError("KMSInvalidStateException")
+	}
+	return b.client, nil
+}
+
+func (b *xksBackend) CreateKey(externalID string) (string, error) {
+	if externalID == "" {
+		return "", common.NewError("InvalidParameterValue")
+	}
+
+	client, err := b.get()
+	if err != nil {
+		return "", err
+	}
+
+	meta, err := client.Metadata(externalID, &xks.MetadataRequest{RequestMetadata: requestMetadata("CreateKey")})
+	if err != nil {
+		if xks.Is(err, xks.ErrKeyNotFound) {
+			return "", common.NewError("XksKeyNotFoundException")
+		}
+		if xks.Is(err, xks.ErrAuthenticationFailed) {
+			return "", common.NewError("XksProxyIncorrectAuthenticationCredentialException")
+		}
+		if _, ok := err.(*xks.Error); ok || err == xks.ErrInvalidResponse {
+			return "", common.NewError("XksProxyInvalidResponseException")
+		}
+		return "", common.NewError("XksProxyUriUnreachableException")
+	}
+
+	usage := map[string]bool{}
+	for _, u := range meta.KeyUsage {
+		usage[u] = true
+	}
+	if meta.KeySpec != "AES_256" || !usage["ENCRYPT"] || !usage["DECRYPT"] || meta.KeyStatus != "ENABLED" {
+		return "", common.NewError("XksKeyInvalidConfigurationException")
+	}
+
+	return externalID, nil
+}
+
+func (b *xksBackend) Encrypt(keyID string, plaintext []byte, aad []byte) ([]byte, []byte, []byte, error) {
+	client, err := b.get()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	out, err := client.Encrypt(keyID, &xks.EncryptRequest{
+		RequestMetadata:             requestMetadata("Encrypt"),
+		Plaintext:                   plaintext,
+		EncryptionAlgorithm:         "AES_GCM",
+		AdditionalAuthenticatedData: aad,
+	})
+	if err != nil {
+		return nil, nil, nil, cryptoError(err)
+	}
+	return out.InitializationVector, out.Ciphertext, out.AuthenticationTag, nil
+}
+
+func (b *xksBackend) Decrypt(keyID string, iv []byte, ciphertext []byte, tag []byte, aad []byte) ([]byte, error) {
+	client, err := b.get()
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := client.Decrypt(keyID, &xks.DecryptRequest{
+		RequestMetadata:             requestMetadata("Decrypt"),
+		Ciphertext:                  ciphertext,
+		EncryptionAlgorithm:         "AES_GCM",
+		InitializationVector:        iv,
+		AuthenticationTag:           tag,
+		AdditionalAuthenticatedData: aad,
+	})
+	if err != nil {
+		return nil, cryptoError(err)
+	}
+	return out.Plaintext, nil
+}
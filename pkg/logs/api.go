@@ -0,0 +1,248 @@
+package logs
+
+// Logs is the service interface for Amazon CloudWatch Logs.
+type Logs interface {
+	CreateLogGroup(*CreateLogGroupRequest) (*CreateLogGroupResult, error)
+	DeleteLogGroup(*DeleteLogGroupRequest) (*DeleteLogGroupResult, error)
+	DescribeLogGroups(*DescribeLogGroupsRequest) (*DescribeLogGroupsResult, error)
+	PutRetentionPolicy(*PutRetentionPolicyRequest) (*PutRetentionPolicyResult, error)
+	DeleteRetentionPolicy(*DeleteRetentionPolicyRequest) (*DeleteRetentionPolicyResult, error)
+	AssociateKmsKey(*AssociateKmsKeyRequest) (*AssociateKmsKeyResult, error)
+	DisassociateKmsKey(*DisassociateKmsKeyRequest) (*DisassociateKmsKeyResult, error)
+
+	CreateLogStream(*CreateLogStreamRequest) (*CreateLogStreamResult, error)
+	DeleteLogStream(*DeleteLogStreamRequest) (*DeleteLogStreamResult, error)
+	DescribeLogStreams(*DescribeLogStreamsRequest) (*DescribeLogStreamsResult, error)
+
+	PutLogEvents(*PutLogEventsRequest) (*PutLogEventsResult, error)
+	GetLogEvents(*GetLogEventsRequest) (*GetLogEventsResult, error)
+	FilterLogEvents(*FilterLogEventsRequest) (*FilterLogEventsResult, error)
+}
+
+// LogGroup describes a log group.
+type LogGroup struct {
+	Arn               string `json:"arn"`
+	CreationTime      int64  `json:"creationTime"`
+	KmsKeyID          string `json:"kmsKeyId,omitempty"`
+	LogGroupArn       string `json:"logGroupArn"`
+	LogGroupName      string `json:"logGroupName"`
+	MetricFilterCount int    `json:"metricFilterCount"`
+	RetentionInDays   int    `json:"retentionInDays,omitempty"`
+	StoredBytes       int64  `json:"storedBytes"`
+}
+
+// LogStream describes a log stream. Times are in milliseconds since the
+// epoch.
+type LogStream struct {
+	Arn                 string `json:"arn"`
+	CreationTime        int64  `json:"creationTime"`
+	FirstEventTimestamp int64  `json:"firstEventTimestamp,omitempty"`
+	LastEventTimestamp  int64  `json:"lastEventTimestamp,omitempty"`
+	LastIngestionTime   int64  `json:"lastIngestionTime,omitempty"`
+	LogStreamName       string `json:"logStreamName"`
+	StoredBytes         int64  `json:"storedBytes"`
+	UploadSequenceToken string `json:"uploadSequenceToken,omitempty"`
+}
+
+// InputLogEvent is a log event to put.
+type InputLogEvent struct {
+	Message   string `json:"message"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+// OutputLogEvent is a log event from a single stream.
+type OutputLogEvent struct {
+	IngestionTime int64  `json:"ingestionTime"`
+	Message       string `json:"message"`
+	Timestamp     int64  `json:"timestamp"`
+}
+
+// FilteredLogEvent is a log event that matched a filter.
+type FilteredLogEvent struct {
+	EventID       string `json:"eventId"`
+	IngestionTime int64  `json:"ingestionTime"`
+	LogStreamName string `json:"logStreamName"`
+	Message       string `json:"message"`
+	Timestamp     int64  `json:"timestamp"`
+}
+
+// RejectedLogEventsInfo says which events in a batch were rejected for being
+// too old or too new.
+type RejectedLogEventsInfo struct {
+	ExpiredLogEventEndIndex  *int `json:"expiredLogEventEndIndex,omitempty"`
+	TooNewLogEventStartIndex *int `json:"tooNewLogEventStartIndex,omitempty"`
+	TooOldLogEventEndIndex   *int `json:"tooOldLogEventEndIndex,omitempty"`
+}
+
+// SearchedLogStream says whether a FilterLogEvents call searched all of a
+// stream.
+type SearchedLogStream struct {
+	LogStreamName      string `json:"logStreamName"`
+	SearchedCompletely bool   `json:"searchedCompletely"`
+}
+
+//
+// API shapes for log groups.
+//
+
+// CreateLogGroupRequest is a request to CreateLogGroup.
+type CreateLogGroupRequest struct {
+	KmsKeyID     string            `json:"kmsKeyId"`
+	LogGroupName string            `json:"logGroupName"`
+	Tags         map[string]string `json:"tags"`
+}
+
+// CreateLogGroupResult is the result of CreateLogGroup.
+type CreateLogGroupResult struct{}
+
+// DeleteLogGroupRequest is a request to DeleteLogGroup.
+type DeleteLogGroupRequest struct {
+	LogGroupName string `json:"logGroupName"`
+}
+
+// DeleteLogGroupResult is the result of DeleteLogGroup.
+type DeleteLogGroupResult struct{}
+
+// DescribeLogGroupsRequest is a request to DescribeLogGroups.
+type DescribeLogGroupsRequest struct {
+	Limit              int    `json:"limit"`
+	LogGroupNamePrefix string `json:"logGroupNamePrefix"`
+	NextToken          string `json:"nextToken"`
+}
+
+// DescribeLogGroupsResult is the result of DescribeLogGroups.
+type DescribeLogGroupsResult struct {
+	LogGroups []LogGroup `json:"logGroups"`
+	NextToken string     `json:"nextToken,omitempty"`
+}
+
+// PutRetentionPolicyRequest is a request to PutRetentionPolicy.
+type PutRetentionPolicyRequest struct {
+	LogGroupName    string `json:"logGroupName"`
+	RetentionInDays int    `json:"retentionInDays"`
+}
+
+// PutRetentionPolicyResult is the result of PutRetentionPolicy.
+type PutRetentionPolicyResult struct{}
+
+// DeleteRetentionPolicyRequest is a request to DeleteRetentionPolicy.
+type DeleteRetentionPolicyRequest struct {
+	LogGroupName string `json:"logGroupName"`
+}
+
+// DeleteRetentionPolicyResult is the result of DeleteRetentionPolicy.
+type DeleteRetentionPolicyResult struct{}
+
+// AssociateKmsKeyRequest is a request to AssociateKmsKey. The key must be
+// given by ARN.
+type AssociateKmsKeyRequest struct {
+	KmsKeyID     string `json:"kmsKeyId"`
+	LogGroupName string `json:"logGroupName"`
+}
+
+// AssociateKmsKeyResult is the result of AssociateKmsKey.
+type AssociateKmsKeyResult struct{}
+
+// DisassociateKmsKeyRequest is a request to DisassociateKmsKey.
+type DisassociateKmsKeyRequest struct {
+	LogGroupName string `json:"logGroupName"`
+}
+
+// DisassociateKmsKeyResult is the result of DisassociateKmsKey.
+type DisassociateKmsKeyResult struct{}
+
+//
+// API shapes for log streams.
+//
+
+// CreateLogStreamRequest is a request to CreateLogStream.
+type CreateLogStreamRequest struct {
+	LogGroupName  string `json:"logGroupName"`
+	LogStreamName string `json:"logStreamName"`
+}
+
+// CreateLogStreamResult is the result of CreateLogStream.
+type CreateLogStreamResult struct{}
+
+// DeleteLogStreamRequest is a request to DeleteLogStream.
+type DeleteLogStreamRequest struct {
+	LogGroupName  string `json:"logGroupName"`
+	LogStreamName string `json:"logStreamName"`
+}
+
+// DeleteLogStreamResult is the result of DeleteLogStream.
+type DeleteLogStreamResult struct{}
+
+// DescribeLogStreamsRequest is a request to DescribeLogStreams. OrderBy is
+// LogStreamName or LastEventTime.
+type DescribeLogStreamsRequest struct {
+	Descending          bool   `json:"descending"`
+	Limit               int    `json:"limit"`
+	LogGroupName        string `json:"logGroupName"`
+	LogStreamNamePrefix string `json:"logStreamNamePrefix"`
+	NextToken           string `json:"nextToken"`
+	OrderBy             string `json:"orderBy"`
+}
+
+// DescribeLogStreamsResult is the result of DescribeLogStreams.
+type DescribeLogStreamsResult struct {
+	LogStreams []LogStream `json:"logStreams"`
+	NextToken  string      `json:"nextToken,omitempty"`
+}
+
+//
+// API shapes for log events.
+//
+
+// PutLogEventsRequest is a request to PutLogEvents. SequenceToken is empty
+// for a stream's first batch, and the last NextSequenceToken after that.
+type PutLogEventsRequest struct {
+	LogEvents     []InputLogEvent `json:"logEvents"`
+	LogGroupName  string          `json:"logGroupName"`
+	LogStreamName string          `json:"logStreamName"`
+	SequenceToken string          `json:"sequenceToken"`
+}
+
+// PutLogEventsResult is the result of PutLogEvents.
+type PutLogEventsResult struct {
+	NextSequenceToken     string                 `json:"nextSequenceToken"`
+	RejectedLogEventsInfo *RejectedLogEventsInfo `json:"rejectedLogEventsInfo,omitempty"`
+}
+
+// GetLogEventsRequest is a request to GetLogEvents. Times are in
+// milliseconds since the epoch.
+type GetLogEventsRequest struct {
+	EndTime       *int64 `json:"endTime"`
+	Limit         int    `json:"limit"`
+	LogGroupName  string `json:"logGroupName"`
+	LogStreamName string `json:"logStreamName"`
+	NextToken     string `json:"nextToken"`
+	StartFromHead bool   `json:"startFromHead"`
+	StartTime     *int64 `json:"startTime"`
+}
+
+// GetLogEventsResult is the result of GetLogEvents.
+type GetLogEventsResult struct {
+	Events            []OutputLogEvent `json:"events"`
+	NextBackwardToken string           `json:"nextBackwardToken"`
+	NextForwardToken  string           `json:"nextForwardToken"`
+}
+
+// FilterLogEventsRequest is a request to FilterLogEvents.
+type FilterLogEventsRequest struct {
+	EndTime             *int64   `json:"endTime"`
+	FilterPattern       string   `json:"filterPattern"`
+	Limit               int      `json:"limit"`
+	LogGroupName        string   `json:"logGroupName"`
+	LogStreamNamePrefix string   `json:"logStreamNamePrefix"`
+	LogStreamNames      []string `json:"logStreamNames"`
+	NextToken           string   `json:"nextToken"`
+	StartTime           *int64   `json:"startTime"`
+}
+
+// FilterLogEventsResult is the result of FilterLogEvents.
+type FilterLogEventsResult struct {
+	Events             []FilteredLogEvent  `json:"events"`
+	NextToken          string              `json:"nextToken,omitempty"`
+	SearchedLogStreams []SearchedLogStream `json:"searchedLogStreams"`
+}
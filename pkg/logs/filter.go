@@ -0,0 +1,668 @@
+package logs
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/fernomac/aws-local/pkg/common"
+)
+
+// pattern is a parsed filter pattern.
+type pattern interface {
+	match(message string) bool
+}
+
+// parsePattern parses a filter pattern. There are three kinds: terms to look
+// for in unstructured messages, { JSON } patterns, and [ space, delimited ]
+// patterns.
+func parsePattern(s string) (pattern, error) {
+	s = strings.TrimSpace(s)
+	if len(s) > 1024 {
+		return nil, common.Errorf("InvalidParameterException", "Invalid filter pattern: longer than 1024 characters")
+	}
+
+	toks, err := lexPattern(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &patternParser{toks: toks}
+
+	switch {
+	case len(toks) == 0:
+		return matchAll{}, nil
+	case toks[0].is("{"):
+		return p.parseJSON()
+	case toks[0].is("["):
+		return p.parseDelimited()
+	default:
+		return parseTerms(toks)
+	}
+}
+
+func invalidPattern(format string, args ...interface{}) error {
+	return common.Errorf("InvalidParameterException", "Invalid filter pattern: "+format, args...)
+}
+
+type matchAll struct{}
+
+func (matchAll) match(string) bool {
+	return true
+}
+
+//
+// Lexing.
+//
+
+// ptoken is a token in a filter pattern. Quoted strings are kept apart so that
+// "&&" is a string and not an operator.
+type ptoken struct {
+	text   string
+	quoted bool
+}
+
+// is reports whether the token is the given unquoted punctuation or keyword.
+func (t ptoken) is(s string) bool {
+	return !t.quoted && strings.EqualFold(t.text, s)
+}
+
+// lexPattern splits a filter pattern into tokens.
+func lexPattern(s string) ([]ptoken, error) {
+	out := []ptoken{}
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+
+		case c == '"':
+			b := strings.Builder{}
+			j := i + 1
+			for ; j < len(s) && s[j] != '"'; j++ {
+				if s[j] == '\\' && j+1 < len(s) {
+					j++
+				}
+				b.WriteByte(s[j])
+			}
+			if j >= len(s) {
+				return nil, invalidPattern("unterminated string")
+			}
+			out = append(out, ptoken{text: b.String(), quoted: true})
+			i = j + 1
+
+		case c == '%' && strings.IndexByte(s[i+1:], '%') > 0:
+			// A %regular expression% can hold any punctuation.
+			j := i + 2 + strings.IndexByte(s[i+1:], '%')
+			out = append(out, ptoken{text: s[i:j]})
+			i = j
+
+		case strings.HasPrefix(s[i:], "&&"), strings.HasPrefix(s[i:], "||"),
+			strings.HasPrefix(s[i:], "!="), strings.HasPrefix(s[i:], "<="), strings.HasPrefix(s[i:], ">="):
+			out = append(out, ptoken{text: s[i : i+2]})
+			i += 2
+
+		case strings.IndexByte("{}[](),=<>", c) >= 0:
+			out = append(out, ptoken{text: s[i : i+1]})
+			i++
+
+		default:
+			// A JSON selector can hold brackets: $.a[0].
+			stop := " \t\n\r\"{}[](),=<>!&|"
+			if c == '$' {
+				stop = " \t\n\r\"{}(),=<>!&|"
+			}
+			j := i + 1
+			for j < len(s) && strings.IndexByte(stop, s[j]) < 0 {
+				j++
+			}
+			if j == i+1 && strings.IndexByte("!&|", c) >= 0 {
+				return nil, invalidPattern("unexpected %q", c)
+			}
+			out = append(out, ptoken{text: s[i:j]})
+			i = j
+		}
+	}
+	return out, nil
+}
+
+type patternParser struct {
+	toks []ptoken
+	pos  int
+}
+
+func (p *patternParser) peek() ptoken {
+	if p.pos >= len(p.toks) {
+		return ptoken{}
+	}
+	return p.toks[p.pos]
+}
+
+func (p *patternParser) next() ptoken {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+func (p *patternParser) accept(s string) bool {
+	if p.pos < len(p.toks) && p.peek().is(s) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *patternParser) expect(s string) error {
+	if !p.accept(s) {
+		return invalidPattern("expected %q", s)
+	}
+	return nil
+}
+
+func (p *patternParser) done() bool {
+	return p.pos >= len(p.toks)
+}
+
+//
+// Values shared by JSON and space-delimited patterns.
+//
+
+// comparison is an operator and the value on its right-hand side. Strings may
+// use * as a wildcard; numbers compare numerically.
+type comparison struct {
+	op     string
+	text   string
+	number *big.Rat
+	glob   *regexp.Regexp
+}
+
+func (p *patternParser) parseComparison() (*comparison, error) {
+	op := p.next()
+	switch {
+	case op.is("="), op.is("!="), op.is("<"), op.is("<="), op.is(">"), op.is(">="):
+	default:
+		return nil, invalidPattern("expected a comparison operator, not %q", op.text)
+	}
+	if p.done() {
+		return nil, invalidPattern("missing value after %v", op.text)
+	}
+
+	v := p.next()
+	c := &comparison{op: op.text, text: v.text}
+	if !v.quoted {
+		if n, ok := new(big.Rat).SetString(v.text); ok {
+			c.number = n
+		}
+	}
+	if c.number == nil {
+		if c.op != "=" && c.op != "!=" {
+			return nil, invalidPattern("%v needs a number, not %q", c.op, v.text)
+		}
+		parts := strings.Split(v.text, "*")
+		for i := range parts {
+			parts[i] = regexp.QuoteMeta(parts[i])
+		}
+		c.glob = regexp.MustCompile("^" + strings.Join(parts, ".*") + "$")
+	}
+	return c, nil
+}
+
+// matchString compares a string from a message.
+func (c *comparison) matchString(s string) bool {
+	if c.number != nil {
+		n, ok := new(big.Rat).SetString(s)
+		if !ok {
+			return c.op == "!="
+		}
+		return c.matchNumber(n)
+	}
+	return c.glob.MatchString(s) == (c.op == "=")
+}
+
+// matchNumber compares a number from a message.
+func (c *comparison) matchNumber(n *big.Rat) bool {
+	if c.number == nil {
+		return c.matchString(n.RatString())
+	}
+	cmp := n.Cmp(c.number)
+	switch c.op {
+	case "=":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	default:
+		return cmp >= 0
+	}
+}
+
+//
+// Term patterns.
+//
+
+// termPattern matches unstructured messages. Every plain term must appear,
+// at least one ?term must appear if there are any, and no -term may appear.
+// Terms match case-sensitively; %term% is a regular expression.
+type termPattern struct {
+	required []*regexp.Regexp
+	optional []*regexp.Regexp
+	excluded []*regexp.Regexp
+}
+
+func parseTerms(toks []ptoken) (pattern, error) {
+	p := &termPattern{}
+	for _, t := range toks {
+		text := t.text
+		list := &p.required
+		if !t.quoted {
+			switch {
+			case strings.HasPrefix(text, "?"):
+				list, text = &p.optional, text[1:]
+			case strings.HasPrefix(text, "-") && len(text) > 1:
+				list, text = &p.excluded, text[1:]
+			}
+		}
+		if text == "" {
+			continue
+		}
+
+		var re *regexp.Regexp
+		if !t.quoted && len(text) > 1 && strings.HasPrefix(text, "%") && strings.HasSuffix(text, "%") {
+			var err error
+			if re, err = regexp.Compile(text[1 : len(text)-1]); err != nil {
+				return nil, invalidPattern("bad regular expression %v", text)
+			}
+		} else {
+			if !t.quoted {
+				text = strings.Trim(text, `"`)
+			}
+			re = regexp.MustCompile(regexp.QuoteMeta(text))
+		}
+		*list = append(*list, re)
+	}
+	return p, nil
+}
+
+func (p *termPattern) match(message string) bool {
+	for _, re := range p.excluded {
+		if re.MatchString(message) {
+			return false
+		}
+	}
+	for _, re := range p.required {
+		if !re.MatchString(message) {
+			return false
+		}
+	}
+	if len(p.optional) == 0 {
+		return true
+	}
+	for _, re := range p.optional {
+		if re.MatchString(message) {
+			return true
+		}
+	}
+	return false
+}
+
+//
+// JSON patterns.
+//
+
+// jsonCondition is a condition on a JSON message.
+type jsonCondition interface {
+	eval(doc interface{}) bool
+}
+
+type jsonAnd struct {
+	left, right jsonCondition
+}
+
+func (c *jsonAnd) eval(doc interface{}) bool {
+	return c.left.eval(doc) && c.right.eval(doc)
+}
+
+type jsonOr struct {
+	left, right jsonCondition
+}
+
+func (c *jsonOr) eval(doc interface{}) bool {
+	return c.left.eval(doc) || c.right.eval(doc)
+}
+
+// jsonStep is one step of a selector: a member name or an array index.
+type jsonStep struct {
+	name  string
+	index int
+}
+
+// jsonTest tests the value a selector picks out. The test is one of "=",
+// "!=" and so on, or IS NULL, IS TRUE, IS FALSE or NOT EXISTS.
+type jsonTest struct {
+	selector []jsonStep
+	test     string
+	cmp      *comparison
+}
+
+// selectorPattern matches the steps of a selector such as $.a.b[0].
+var selectorPattern = regexp.MustCompile(`^\.([^.\[\]]+)|^\[(\d+)\]`)
+
+func parseSelector(s string) ([]jsonStep, error) {
+	if !strings.HasPrefix(s, "$") {
+		return nil, invalidPattern("expected a selector starting with $, not %q", s)
+	}
+	out := []jsonStep{}
+	for rest := s[1:]; rest != ""; {
+		m := selectorPattern.FindStringSubmatch(rest)
+		if m == nil {
+			return nil, invalidPattern("bad selector %v", s)
+		}
+		if m[1] != "" {
+			out = append(out, jsonStep{name: m[1], index: -1})
+		} else {
+			n, _ := strconv.Atoi(m[2])
+			out = append(out, jsonStep{index: n})
+		}
+		rest = rest[len(m[0]):]
+	}
+	return out, nil
+}
+
+// resolve returns the value a selector picks out, and whether it exists.
+func resolve(doc interface{}, selector []jsonStep) (interface{}, bool) {
+	for _, step := range selector {
+		switch v := doc.(type) {
+		case map[string]interface{}:
+			if step.index >= 0 {
+				return nil, false
+			}
+			member, ok := v[step.name]
+			if !ok {
+				return nil, false
+			}
+			doc = member
+		case []interface{}:
+			if step.index < 0 || step.index >= len(v) {
+				return nil, false
+			}
+			doc = v[step.index]
+		default:
+			return nil, false
+		}
+	}
+	return doc, true
+}
+
+func (c *jsonTest) eval(doc interface{}) bool {
+	v, ok := resolve(doc, c.selector)
+	switch c.test {
+	case "NOT EXISTS":
+		return !ok
+	case "IS NULL":
+		return ok && v == nil
+	case "IS TRUE":
+		return ok && v == true
+	case "IS FALSE":
+		return ok && v == false
+	}
+	if !ok {
+		return false
+	}
+
+	switch v := v.(type) {
+	case string:
+		if c.cmp.number != nil {
+			return false
+		}
+		return c.cmp.matchString(v)
+	case json.Number:
+		n, ok := new(big.Rat).SetString(v.String())
+		return ok && c.cmp.matchNumber(n)
+	case bool:
+		return c.cmp.number == nil && c.cmp.matchString(strconv.FormatBool(v))
+	}
+	return false
+}
+
+// jsonPattern matches messages that are JSON objects.
+type jsonPattern struct {
+	cond jsonCondition
+}
+
+func (p *jsonPattern) match(message string) bool {
+	d := json.NewDecoder(bytes.NewReader([]byte(message)))
+	d.UseNumber()
+	var doc interface{}
+	if err := d.Decode(&doc); err != nil {
+		return false
+	}
+	if _, ok := doc.(map[string]interface{}); !ok {
+		return false
+	}
+	return p.cond.eval(doc)
+}
+
+func (p *patternParser) parseJSON() (pattern, error) {
+	p.next()
+	c, err := p.parseJSONOr()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect("}"); err != nil {
+		return nil, err
+	}
+	if !p.done() {
+		return nil, invalidPattern("unexpected %q after }", p.peek().text)
+	}
+	return &jsonPattern{c}, nil
+}
+
+func (p *patternParser) parseJSONOr() (jsonCondition, error) {
+	c, err := p.parseJSONAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("||") {
+		right, err := p.parseJSONAnd()
+		if err != nil {
+			return nil, err
+		}
+		c = &jsonOr{c, right}
+	}
+	return c, nil
+}
+
+func (p *patternParser) parseJSONAnd() (jsonCondition, error) {
+	c, err := p.parseJSONPrimary()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("&&") {
+		right, err := p.parseJSONPrimary()
+		if err != nil {
+			return nil, err
+		}
+		c = &jsonAnd{c, right}
+	}
+	return c, nil
+}
+
+func (p *patternParser) parseJSONPrimary() (jsonCondition, error) {
+	if p.accept("(") {
+		c, err := p.parseJSONOr()
+		if err != nil {
+			return nil, err
+		}
+		return c, p.expect(")")
+	}
+
+	sel, err := parseSelector(p.next().text)
+	if err != nil {
+		return nil, err
+	}
+	t := &jsonTest{selector: sel}
+
+	switch {
+	case p.accept("IS"):
+		kw := strings.ToUpper(p.next().text)
+		if kw != "NULL" && kw != "TRUE" && kw != "FALSE" {
+			return nil, invalidPattern("expected NULL, TRUE or FALSE after IS")
+		}
+		t.test = "IS " + kw
+	case p.accept("NOT"):
+		if !p.accept("EXISTS") {
+			return nil, invalidPattern("expected EXISTS after NOT")
+		}
+		t.test = "NOT EXISTS"
+	default:
+		if t.cmp, err = p.parseComparison(); err != nil {
+			return nil, err
+		}
+		t.test = t.cmp.op
+	}
+	return t, nil
+}
+
+//
+// Space-delimited patterns.
+//
+
+// field is one field of a space-delimited pattern. Its conditions are ORed
+// groups of ANDed comparisons; a field with none matches anything.
+type field struct {
+	ellipsis bool
+	groups   [][]*comparison
+}
+
+func (f *field) match(s string) bool {
+	if len(f.groups) == 0 {
+		return true
+	}
+	for _, group := range f.groups {
+		ok := true
+		for _, c := range group {
+			ok = ok && c.matchString(s)
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+// delimitedPattern matches messages split into fields on spaces. Text in
+// quotes or brackets is a single field.
+type delimitedPattern struct {
+	fields []*field
+}
+
+func (p *patternParser) parseDelimited() (pattern, error) {
+	p.next()
+	out := &delimitedPattern{}
+	for {
+		name := p.next()
+		if name.text == "" || name.quoted {
+			return nil, invalidPattern("expected a field name")
+		}
+		f := &field{ellipsis: name.text == "..."}
+		out.fields = append(out.fields, f)
+
+		if !f.ellipsis && !p.peek().is(",") && !p.peek().is("]") {
+			group := []*comparison{}
+			for {
+				c, err := p.parseComparison()
+				if err != nil {
+					return nil, err
+				}
+				group = append(group, c)
+
+				switch {
+				case p.accept("&&"):
+				case p.accept("||"):
+					f.groups = append(f.groups, group)
+					group = []*comparison{}
+				default:
+					f.groups = append(f.groups, group)
+					group = nil
+				}
+				if group == nil {
+					break
+				}
+				// Each further condition names the field again.
+				if p.next().text != name.text {
+					return nil, invalidPattern("conditions on field %v must all name it", name.text)
+				}
+			}
+		}
+
+		if p.accept("]") {
+			break
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+	}
+	if !p.done() {
+		return nil, invalidPattern("unexpected %q after ]", p.peek().text)
+	}
+	return out, nil
+}
+
+// splitFields splits a message into space-delimited fields.
+func splitFields(message string) []string {
+	out := []string{}
+	for i := 0; i < len(message); {
+		switch c := message[i]; {
+		case c == ' ' || c == '\t':
+			i++
+		case c == '"' || c == '[':
+			end := byte('"')
+			if c == '[' {
+				end = ']'
+			}
+			j := strings.IndexByte(message[i+1:], end)
+			if j < 0 {
+				out = append(out, message[i+1:])
+				return out
+			}
+			out = append(out, message[i+1:i+1+j])
+			i += j + 2
+		default:
+			j := strings.IndexAny(message[i:], " \t")
+			if j < 0 {
+				j = len(message) - i
+			}
+			out = append(out, message[i:i+j])
+			i += j
+		}
+	}
+	return out
+}
+
+func (p *delimitedPattern) match(message string) bool {
+	return matchFields(p.fields, splitFields(message))
+}
+
+// matchFields matches fields against values; an ellipsis soaks up any number
+// of values.
+func matchFields(fields []*field, values []string) bool {
+	if len(fields) == 0 {
+		return len(values) == 0
+	}
+	if fields[0].ellipsis {
+		for i := 0; i <= len(values); i++ {
+			if matchFields(fields[1:], values[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	return len(values) > 0 && fields[0].match(values[0]) && matchFields(fields[1:], values[1:])
+}
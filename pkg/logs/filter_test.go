@@ -0,0 +1,102 @@
+package logs
+
+import "testing"
+
+func TestFilterPatterns(t *testing.T) {
+	tests := []struct {
+		pattern string
+		message string
+		want    bool
+	}{
+		// Terms.
+		{"", "anything", true},
+		{"ERROR", "ERROR: disk full", true},
+		{"ERROR", "error: disk full", false},
+		{"ERROR disk", "ERROR: disk full", true},
+		{"ERROR memory", "ERROR: disk full", false},
+		{`"disk full"`, "ERROR: disk full", true},
+		{`"full disk"`, "ERROR: disk full", false},
+		{"?ERROR ?WARN", "WARN: disk nearly full", true},
+		{"?ERROR ?WARN", "INFO: all good", false},
+		{"ERROR -disk", "ERROR: disk full", false},
+		{"ERROR -memory", "ERROR: disk full", true},
+		{"%[0-9]{3}%", "status 404", true},
+		{"%[0-9]{3}%", "status ok", false},
+
+		// JSON.
+		{`{ $.level = "error" }`, `{"level": "error"}`, true},
+		{`{ $.level = "error" }`, `{"level": "info"}`, false},
+		{`{ $.level = "err*" }`, `{"level": "error"}`, true},
+		{`{ $.level != "error" }`, `{"level": "info"}`, true},
+		{`{ $.level = "error" }`, `not json`, false},
+		{`{ $.level = "error" }`, `["error"]`, false},
+		{`{ $.latency > 100 }`, `{"latency": 150}`, true},
+		{`{ $.latency > 100 }`, `{"latency": 50}`, false},
+		{`{ $.latency >= 1.5e2 }`, `{"latency": 150}`, true},
+		{`{ $.latency > 100 }`, `{"latency": "150"}`, false},
+		{`{ $.code = 200 }`, `{"code": 200.0}`, true},
+		{`{ $.a.b[1] = "y" }`, `{"a": {"b": ["x", "y"]}}`, true},
+		{`{ $.a.b[2] = "y" }`, `{"a": {"b": ["x", "y"]}}`, false},
+		{`{ $.ok IS TRUE }`, `{"ok": true}`, true},
+		{`{ $.ok IS FALSE }`, `{"ok": true}`, false},
+		{`{ $.v IS NULL }`, `{"v": null}`, true},
+		{`{ $.v IS NULL }`, `{}`, false},
+		{`{ $.v NOT EXISTS }`, `{}`, true},
+		{`{ $.v NOT EXISTS }`, `{"v": null}`, false},
+		{`{ $.a = 1 && $.b = 2 }`, `{"a": 1, "b": 2}`, true},
+		{`{ $.a = 1 && $.b = 2 }`, `{"a": 1, "b": 3}`, false},
+		{`{ $.a = 1 || $.b = 2 }`, `{"a": 0, "b": 2}`, true},
+		{`{ ($.a = 1 || $.a = 2) && $.b = 3 }`, `{"a": 2, "b": 3}`, true},
+		{`{ ($.a = 1 || $.a = 2) && $.b = 3 }`, `{"a": 3, "b": 3}`, false},
+		{`{ $.s = "a && b" }`, `{"s": "a && b"}`, true},
+
+		// Space-delimited.
+		{"[ip, user, status, size]", "1.2.3.4 bob 200 512", true},
+		{"[ip, user, status, size]", "1.2.3.4 bob 200", false},
+		{"[ip, user, status = 404, size]", "1.2.3.4 bob 404 512", true},
+		{"[ip, user, status = 404, size]", "1.2.3.4 bob 200 512", false},
+		{"[ip, user, status = 4*, size]", "1.2.3.4 bob 404 512", true},
+		{"[ip, user, status >= 500 && status < 600, size]", "1.2.3.4 bob 503 512", true},
+		{"[ip, user, status >= 500 && status < 600, size]", "1.2.3.4 bob 404 512", false},
+		{"[ip, user, status = 404 || status = 500, size]", "1.2.3.4 bob 500 512", true},
+		{"[ip, ..., size > 100]", "1.2.3.4 a b c 512", true},
+		{"[ip, ..., size > 100]", "1.2.3.4 a b c 50", false},
+		{"[..., status = 200]", "200", true},
+		{`[ip, time, request = "GET *", status]`, `1.2.3.4 [10/Oct/2000:13:55:36] "GET /index.html" 200`, true},
+		{`[ip, time, request = "POST *", status]`, `1.2.3.4 [10/Oct/2000:13:55:36] "GET /index.html" 200`, false},
+	}
+
+	for _, test := range tests {
+		p, err := parsePattern(test.pattern)
+		if err != nil {
+			t.Errorf("%q: %v", test.pattern, err)
+			continue
+		}
+		if got := p.match(test.message); got != test.want {
+			t.Errorf("%q on %q: got %v, want %v", test.pattern, test.message, got, test.want)
+		}
+	}
+}
+
+func TestFilterPatternErrors(t *testing.T) {
+	for _, pattern := range []string{
+		`"unterminated`,
+		`{ $.a = 1`,
+		`{ $.a = 1 } extra`,
+		`{ a = 1 }`,
+		`{ $.a.. = 1 }`,
+		`{ $.a IS MAYBE }`,
+		`{ $.a NOT THERE }`,
+		`{ $.a > "x" }`,
+		`{ $.a = }`,
+		`[a, b = 1 && c = 2]`,
+		`[a, b > x]`,
+		`[a, b`,
+		`[a] extra`,
+		`%[%`,
+	} {
+		if _, err := parsePattern(pattern); err == nil {
+			t.Errorf("%q: no error", pattern)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package logs
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/fernomac/aws-local/pkg/awsjson11"
+	"github.com/fernomac/aws-local/pkg/common"
+)
+
+// NewHandler creates a new HTTP handler, notifying the given observers of
+// every call.
+func NewHandler(logs Logs, observers ...common.Observer) http.Handler {
+	rval := awsjson11.NewHandler("Logs_20140328")
+	rval.SetEventSource("logs.amazonaws.com")
+	for _, o := range observers {
+		rval.ObserveWith(o)
+	}
+
+	//
+	// Log groups.
+	//
+
+	rval.HandleWith("CreateLogGroup", func(body []byte) (interface{}, error) {
+		req := CreateLogGroupRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return logs.CreateLogGroup(&req)
+	})
+
+	rval.HandleWith("DeleteLogGroup", func(body []byte) (interface{}, error) {
+		req := DeleteLogGroupRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return logs.DeleteLogGroup(&req)
+	})
+
+	rval.HandleWith("DescribeLogGroups", func(body []byte) (interface{}, error) {
+		req := DescribeLogGroupsRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return logs.DescribeLogGroups(&req)
+	})
+
+	rval.HandleWith("PutRetentionPolicy", func(body []byte) (interface{}, error) {
+		req := PutRetentionPolicyRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return logs.PutRetentionPolicy(&req)
+	})
+
+	rval.HandleWith("DeleteRetentionPolicy", func(body []byte) (interface{}, error) {
+		req := DeleteRetentionPolicyRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return logs.DeleteRetentionPolicy(&req)
+	})
+
+	rval.HandleWith("AssociateKmsKey", func(body []byte) (interface{}, error) {
+		req := AssociateKmsKeyRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return logs.AssociateKmsKey(&req)
+	})
+
+	rval.HandleWith("DisassociateKmsKey", func(body []byte) (interface{}, error) {
+		req := DisassociateKmsKeyRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return logs.DisassociateKmsKey(&req)
+	})
+
+	//
+	// Log streams.
+	//
+
+	rval.HandleWith("CreateLogStream", func(body []byte) (interface{}, error) {
+		req := CreateLogStreamRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return logs.CreateLogStream(&req)
+	})
+
+	rval.HandleWith("DeleteLogStream", func(body []byte) (interface{}, error) {
+		req := DeleteLogStreamRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return logs.DeleteLogStream(&req)
+	})
+
+	rval.HandleWith("DescribeLogStreams", func(body []byte) (interface{}, error) {
+		req := DescribeLogStreamsRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return logs.DescribeLogStreams(&req)
+	})
+
+	//
+	// Log events.
+	//
+
+	rval.HandleWith("PutLogEvents", func(body []byte) (interface{}, error) {
+		req := PutLogEventsRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return logs.PutLogEvents(&req)
+	})
+
+	rval.HandleWith("GetLogEvents", func(body []byte) (interface{}, error) {
+		req := GetLogEventsRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return logs.GetLogEvents(&req)
+	})
+
+	rval.HandleWith("FilterLogEvents", func(body []byte) (interface{}, error) {
+		req := FilterLogEventsRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return logs.FilterLogEvents(&req)
+	})
+
+	return rval
+}
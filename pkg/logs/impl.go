@@ -0,0 +1,756 @@
+package logs
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fernomac/aws-local/pkg/common"
+	"github.com/fernomac/aws-local/pkg/kms"
+)
+
+// Limits on PutLogEvents batches.
+const (
+	maxBatchEvents = 10000
+	maxBatchSize   = 1048576
+	eventOverhead  = 26
+	maxBatchSpan   = 24 * time.Hour
+	maxEventAge    = 14 * 24 * time.Hour
+	maxEventFuture = 2 * time.Hour
+)
+
+// retentionDays are the retention periods PutRetentionPolicy accepts.
+var retentionDays = map[int]bool{
+	1: true, 3: true, 5: true, 7: true, 14: true, 30: true, 60: true, 90: true,
+	120: true, 150: true, 180: true, 365: true, 400: true, 545: true, 731: true,
+	1096: true, 1827: true, 2192: true, 2557: true, 2922: true, 3288: true, 3653: true,
+}
+
+var groupNamePattern = regexp.MustCompile(`^[.\-_/#A-Za-z0-9]{1,512}$`)
+
+// event is a single log event.
+type event struct {
+	id        string
+	timestamp int64
+	ingestion int64
+	message   string
+}
+
+// stream is a single log stream. Its events are kept in timestamp order.
+type stream struct {
+	name    string
+	arn     string
+	created int64
+	events  []event
+	// batches is how many batches have been put; the next batch should come
+	// with the token for that number. lastBatch is the digest of the last
+	// batch, to spot it being sent again.
+	batches       int64
+	lastBatch     [sha256.Size]byte
+	lastIngestion int64
+}
+
+func sequenceToken(n int64) string {
+	return fmt.Sprintf("%056d", n)
+}
+
+// nextToken returns the sequence token the next batch should come with, or
+// "" before the first.
+func (s *stream) nextToken() string {
+	if s.batches == 0 {
+		return ""
+	}
+	return sequenceToken(s.batches)
+}
+
+// lastToken returns the sequence token the last batch was put with.
+func (s *stream) lastToken() string {
+	if s.batches <= 1 {
+		return ""
+	}
+	return sequenceToken(s.batches - 1)
+}
+
+func (s *stream) storedBytes() int64 {
+	n := int64(0)
+	for _, e := range s.events {
+		n += int64(len(e.message))
+	}
+	return n
+}
+
+func (s *stream) describe() LogStream {
+	out := LogStream{
+		Arn:                 s.arn,
+		CreationTime:        s.created,
+		LastIngestionTime:   s.lastIngestion,
+		LogStreamName:       s.name,
+		StoredBytes:         s.storedBytes(),
+		UploadSequenceToken: s.nextToken(),
+	}
+	if len(s.events) > 0 {
+		out.FirstEventTimestamp = s.events[0].timestamp
+		out.LastEventTimestamp = s.events[len(s.events)-1].timestamp
+	}
+	return out
+}
+
+// group is a single log group.
+type group struct {
+	name      string
+	created   int64
+	retention int
+	kmsKeyID  string
+	tags      map[string]string
+	streams   map[string]*stream
+}
+
+func (g *group) arn() string {
+	return fmt.Sprintf("arn:aws:logs:%v:%v:log-group:%v", common.Region, common.AccountID, g.name)
+}
+
+func (g *group) describe() LogGroup {
+	out := LogGroup{
+		Arn:             g.arn() + ":*",
+		CreationTime:    g.created,
+		KmsKeyID:        g.kmsKeyID,
+		LogGroupArn:     g.arn(),
+		LogGroupName:    g.name,
+		RetentionInDays: g.retention,
+	}
+	for _, s := range g.streams {
+		out.StoredBytes += s.storedBytes()
+	}
+	return out
+}
+
+// Option configures a Logs object.
+type Option func(*logs)
+
+// WithClock sets the clock that stamps ingestion times and expires events
+// past their group's retention.
+func WithClock(clock common.Clock) Option {
+	return func(l *logs) {
+		l.clock = clock
+	}
+}
+
+// logs is the log store. Its lock guards everything, including calls out to
+// KMS.
+type logs struct {
+	lock   sync.Mutex
+	kms    kms.KMS
+	clock  common.Clock
+	groups map[string]*group
+	nextID int64
+}
+
+// New creates a new log store that checks the keys log groups are encrypted
+// with against the given KMS.
+func New(kms kms.KMS, opts ...Option) Logs {
+	rval := &logs{
+		kms:    kms,
+		clock:  common.SystemClock,
+		groups: make(map[string]*group),
+	}
+	for _, opt := range opts {
+		opt(rval)
+	}
+	return rval
+}
+
+func millis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+// group looks up a log group, dropping any events past its retention. The
+// caller must hold l.lock.
+func (l *logs) group(name string) (*group, error) {
+	g, ok := l.groups[name]
+	if !ok {
+		return nil, common.Errorf("ResourceNotFoundException", "The specified log group does not exist.")
+	}
+
+	if g.retention > 0 {
+		cutoff := millis(l.clock.Now().Add(-time.Duration(g.retention) * 24 * time.Hour))
+		for _, s := range g.streams {
+			i := sort.Search(len(s.events), func(i int) bool {
+				return s.events[i].timestamp >= cutoff
+			})
+			s.events = s.events[i:]
+		}
+	}
+	return g, nil
+}
+
+// stream looks up a log stream. The caller must hold l.lock.
+func (l *logs) stream(groupName string, streamName string) (*group, *stream, error) {
+	g, err := l.group(groupName)
+	if err != nil {
+		return nil, nil, err
+	}
+	s, ok := g.streams[streamName]
+	if !ok {
+		return nil, nil, common.Errorf("ResourceNotFoundException", "The specified log stream does not exist.")
+	}
+	return g, s, nil
+}
+
+// checkKey checks that a key exists and is enabled for encryption. The caller
+// must hold l.lock.
+func (l *logs) checkKey(keyID string) error {
+	if !strings.HasPrefix(keyID, "arn:") {
+		return common.Errorf("InvalidParameterException", "Specified KMS key must be an ARN: %v", keyID)
+	}
+
+	out, err := l.kms.DescribeKey(&kms.DescribeKeyRequest{KeyID: keyID})
+	if err != nil {
+		return common.Errorf("InvalidParameterException", "Specified KMS key %v does not exist.", keyID)
+	}
+	md := out.KeyMetadata
+	if md.KeyState != kms.KeyStateEnabled {
+		return common.Errorf("InvalidParameterException", "Specified KMS key %v is not enabled; its state is %v.", keyID, md.KeyState)
+	}
+	if md.KeyUsage != "ENCRYPT_DECRYPT" || md.KeySpec != "SYMMETRIC_DEFAULT" {
+		return common.Errorf("InvalidParameterException", "Specified KMS key %v is not a symmetric encryption key.", keyID)
+	}
+	return nil
+}
+
+// paging reads a limit, which defaults to max, and an offset encoded in a
+// nextToken.
+func paging(limit int, max int, nextToken string) (int, int, error) {
+	if limit == 0 {
+		limit = max
+	}
+	if limit < 1 || limit > max {
+		return 0, 0, common.Errorf("InvalidParameterException", "1 validation error detected: Value '%v' at 'limit' failed to satisfy constraint: Member must have value between 1 and %v", limit, max)
+	}
+
+	offset := 0
+	if nextToken != "" {
+		raw, err := base64.RawURLEncoding.DecodeString(nextToken)
+		if err != nil {
+			return 0, 0, common.Errorf("InvalidParameterException", "The specified nextToken is invalid.")
+		}
+		if offset, err = strconv.Atoi(string(raw)); err != nil || offset < 0 {
+			return 0, 0, common.Errorf("InvalidParameterException", "The specified nextToken is invalid.")
+		}
+	}
+	return limit, offset, nil
+}
+
+// pageToken returns the token for the page after the one ending at end, or
+// "" if there isn't one.
+func pageToken(end int, total int) string {
+	if end >= total {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(end)))
+}
+
+// page returns the bounds of a page of n things.
+func page(offset int, limit int, n int) (int, int) {
+	if offset > n {
+		offset = n
+	}
+	end := offset + limit
+	if end > n {
+		end = n
+	}
+	return offset, end
+}
+
+//
+// Log groups.
+//
+
+func (l *logs) CreateLogGroup(req *CreateLogGroupRequest) (*CreateLogGroupResult, error) {
+	if !groupNamePattern.MatchString(req.LogGroupName) {
+		return nil, common.Errorf("InvalidParameterException", "1 validation error detected: Value '%v' at 'logGroupName' failed to satisfy constraint: Member must satisfy regular expression pattern: [\\.\\-_/#A-Za-z0-9]+", req.LogGroupName)
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if _, ok := l.groups[req.LogGroupName]; ok {
+		return nil, common.Errorf("ResourceAlreadyExistsException", "The specified log group already exists")
+	}
+	if req.KmsKeyID != "" {
+		if err := l.checkKey(req.KmsKeyID); err != nil {
+			return nil, err
+		}
+	}
+
+	l.groups[req.LogGroupName] = &group{
+		name:     req.LogGroupName,
+		created:  millis(l.clock.Now()),
+		kmsKeyID: req.KmsKeyID,
+		tags:     req.Tags,
+		streams:  make(map[string]*stream),
+	}
+	return &CreateLogGroupResult{}, nil
+}
+
+func (l *logs) DeleteLogGroup(req *DeleteLogGroupRequest) (*DeleteLogGroupResult, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if _, err := l.group(req.LogGroupName); err != nil {
+		return nil, err
+	}
+	delete(l.groups, req.LogGroupName)
+	return &DeleteLogGroupResult{}, nil
+}
+
+func (l *logs) DescribeLogGroups(req *DescribeLogGroupsRequest) (*DescribeLogGroupsResult, error) {
+	limit, offset, err := paging(req.Limit, 50, req.NextToken)
+	if err != nil {
+		return nil, err
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	names := []string{}
+	for name := range l.groups {
+		if strings.HasPrefix(name, req.LogGroupNamePrefix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	start, end := page(offset, limit, len(names))
+	out := &DescribeLogGroupsResult{
+		LogGroups: []LogGroup{},
+		NextToken: pageToken(end, len(names)),
+	}
+	for _, name := range names[start:end] {
+		g, _ := l.group(name)
+		out.LogGroups = append(out.LogGroups, g.describe())
+	}
+	return out, nil
+}
+
+func (l *logs) PutRetentionPolicy(req *PutRetentionPolicyRequest) (*PutRetentionPolicyResult, error) {
+	if !retentionDays[req.RetentionInDays] {
+		return nil, common.Errorf("InvalidParameterException", "1 validation error detected: Value '%v' at 'retentionInDays' failed to satisfy constraint: Member must satisfy enum value set: [1, 3, 5, 7, 14, 30, 60, 90, 120, 150, 180, 365, 400, 545, 731, 1096, 1827, 2192, 2557, 2922, 3288, 3653]", req.RetentionInDays)
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	g, err := l.group(req.LogGroupName)
+	if err != nil {
+		return nil, err
+	}
+	g.retention = req.RetentionInDays
+	return &PutRetentionPolicyResult{}, nil
+}
+
+func (l *logs) DeleteRetentionPolicy(req *DeleteRetentionPolicyRequest) (*DeleteRetentionPolicyResult, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	g, err := l.group(req.LogGroupName)
+	if err != nil {
+		return nil, err
+	}
+	g.retention = 0
+	return &DeleteRetentionPolicyResult{}, nil
+}
+
+func (l *logs) AssociateKmsKey(req *AssociateKmsKeyRequest) (*AssociateKmsKeyResult, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	g, err := l.group(req.LogGroupName)
+	if err != nil {
+		return nil, err
+	}
+	if err := l.checkKey(req.KmsKeyID); err != nil {
+		return nil, err
+	}
+	g.kmsKeyID = req.KmsKeyID
+	return &AssociateKmsKeyResult{}, nil
+}
+
+func (l *logs) DisassociateKmsKey(req *DisassociateKmsKeyRequest) (*DisassociateKmsKeyResult, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	g, err := l.group(req.LogGroupName)
+	if err != nil {
+		return nil, err
+	}
+	g.kmsKeyID = ""
+	return &DisassociateKmsKeyResult{}, nil
+}
+
+//
+// Log streams.
+//
+
+func (l *logs) CreateLogStream(req *CreateLogStreamRequest) (*CreateLogStreamResult, error) {
+	name := req.LogStreamName
+	if name == "" || len(name) > 512 || strings.ContainsAny(name, ":*") {
+		return nil, common.Errorf("InvalidParameterException", "1 validation error detected: Value '%v' at 'logStreamName' failed to satisfy constraint: Member must satisfy regular expression pattern: [^:*]*", name)
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	g, err := l.group(req.LogGroupName)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := g.streams[name]; ok {
+		return nil, common.Errorf("ResourceAlreadyExistsException", "The specified log stream already exists")
+	}
+
+	g.streams[name] = &stream{
+		name:    name,
+		arn:     g.arn() + ":log-stream:" + name,
+		created: millis(l.clock.Now()),
+	}
+	return &CreateLogStreamResult{}, nil
+}
+
+func (l *logs) DeleteLogStream(req *DeleteLogStreamRequest) (*DeleteLogStreamResult, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	g, s, err := l.stream(req.LogGroupName, req.LogStreamName)
+	if err != nil {
+		return nil, err
+	}
+	delete(g.streams, s.name)
+	return &DeleteLogStreamResult{}, nil
+}
+
+func (l *logs) DescribeLogStreams(req *DescribeLogStreamsRequest) (*DescribeLogStreamsResult, error) {
+	switch req.OrderBy {
+	case "", "LogStreamName":
+	case "LastEventTime":
+		if req.LogStreamNamePrefix != "" {
+			return nil, common.Errorf("InvalidParameterException", "Cannot order by LastEventTime with a logStreamNamePrefix.")
+		}
+	default:
+		return nil, common.Errorf("InvalidParameterException", "1 validation error detected: Value '%v' at 'orderBy' failed to satisfy constraint: Member must satisfy enum value set: [LogStreamName, LastEventTime]", req.OrderBy)
+	}
+	limit, offset, err := paging(req.Limit, 50, req.NextToken)
+	if err != nil {
+		return nil, err
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	g, err := l.group(req.LogGroupName)
+	if err != nil {
+		return nil, err
+	}
+
+	streams := []LogStream{}
+	for name, s := range g.streams {
+		if strings.HasPrefix(name, req.LogStreamNamePrefix) {
+			streams = append(streams, s.describe())
+		}
+	}
+	sort.Slice(streams, func(i, j int) bool {
+		a, b := streams[i], streams[j]
+		if req.Descending {
+			a, b = b, a
+		}
+		if req.OrderBy == "LastEventTime" && a.LastEventTimestamp != b.LastEventTimestamp {
+			return a.LastEventTimestamp < b.LastEventTimestamp
+		}
+		return a.LogStreamName < b.LogStreamName
+	})
+
+	start, end := page(offset, limit, len(streams))
+	return &DescribeLogStreamsResult{
+		LogStreams: streams[start:end],
+		NextToken:  pageToken(end, len(streams)),
+	}, nil
+}
+
+//
+// Log events.
+//
+
+// batchDigest identifies a batch of events, to spot one being sent twice.
+func batchDigest(events []InputLogEvent) [sha256.Size]byte {
+	h := sha256.New()
+	for _, e := range events {
+		fmt.Fprintf(h, "%d:%d:%s", e.Timestamp, len(e.Message), e.Message)
+	}
+	out := [sha256.Size]byte{}
+	copy(out[:], h.Sum(nil))
+	return out
+}
+
+// PutLogEvents puts a batch of events. Sequence tokens work as they did in
+// CloudWatch Logs before 2023: the first batch to a stream comes without one,
+// and every batch after must come with the token the last one returned.
+// Sending the last batch again with the token it was put with is
+// DataAlreadyAcceptedException rather than a second copy of its events.
+func (l *logs) PutLogEvents(req *PutLogEventsRequest) (*PutLogEventsResult, error) {
+	events := req.LogEvents
+	if len(events) == 0 || len(events) > maxBatchEvents {
+		return nil, common.Errorf("InvalidParameterException", "1 validation error detected: Value at 'logEvents' failed to satisfy constraint: Member must have length between 1 and %v", maxBatchEvents)
+	}
+	size := 0
+	for i, e := range events {
+		if e.Message == "" {
+			return nil, common.Errorf("InvalidParameterException", "Log event message cannot be empty.")
+		}
+		if i > 0 && e.Timestamp < events[i-1].Timestamp {
+			return nil, common.Errorf("InvalidParameterException", "Log events in a single PutLogEvents request must be in chronological order.")
+		}
+		size += len(e.Message) + eventOverhead
+	}
+	if size > maxBatchSize {
+		return nil, common.Errorf("InvalidParameterException", "Upload too large: %v bytes exceeds limit of %v", size, maxBatchSize)
+	}
+	if time.Duration(events[len(events)-1].Timestamp-events[0].Timestamp)*time.Millisecond > maxBatchSpan {
+		return nil, common.Errorf("InvalidParameterException", "The batch of log events in a single PutLogEvents request cannot span more than 24 hours.")
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	g, s, err := l.stream(req.LogGroupName, req.LogStreamName)
+	if err != nil {
+		return nil, err
+	}
+
+	digest := batchDigest(events)
+	if req.SequenceToken != s.nextToken() {
+		if s.batches > 0 && req.SequenceToken == s.lastToken() && digest == s.lastBatch {
+			return nil, common.Errorf("DataAlreadyAcceptedException", "The given batch of log events has already been accepted. The next batch can be sent with sequenceToken: %v", s.nextToken())
+		}
+		expected := s.nextToken()
+		if expected == "" {
+			expected = "null"
+		}
+		return nil, common.Errorf("InvalidSequenceTokenException", "The given sequenceToken is invalid. The next expected sequenceToken is: %v", expected)
+	}
+
+	now := l.clock.Now()
+	tooOld := millis(now.Add(-maxEventAge))
+	tooNew := millis(now.Add(maxEventFuture))
+	expired := tooOld
+	if g.retention > 0 {
+		if cutoff := millis(now.Add(-time.Duration(g.retention) * 24 * time.Hour)); cutoff > expired {
+			expired = cutoff
+		}
+	}
+
+	// Events are in order, so the rejects are a run at either end.
+	info := &RejectedLogEventsInfo{}
+	first, last := 0, len(events)
+	for first < last && events[first].Timestamp < expired {
+		first++
+	}
+	oldEnd := 0
+	for oldEnd < first && events[oldEnd].Timestamp < tooOld {
+		oldEnd++
+	}
+	if oldEnd > 0 {
+		n := oldEnd
+		info.TooOldLogEventEndIndex = &n
+	}
+	if first > oldEnd {
+		n := first
+		info.ExpiredLogEventEndIndex = &n
+	}
+	for last > first && events[last-1].Timestamp > tooNew {
+		last--
+	}
+	if last < len(events) {
+		n := last
+		info.TooNewLogEventStartIndex = &n
+	}
+
+	ingestion := millis(now)
+	for _, e := range events[first:last] {
+		l.nextID++
+		s.events = append(s.events, event{
+			id:        sequenceToken(l.nextID),
+			timestamp: e.Timestamp,
+			ingestion: ingestion,
+			message:   e.Message,
+		})
+	}
+	sort.SliceStable(s.events, func(i, j int) bool {
+		return s.events[i].timestamp < s.events[j].timestamp
+	})
+	s.lastIngestion = ingestion
+	s.lastBatch = digest
+	s.batches++
+
+	out := &PutLogEventsResult{NextSequenceToken: s.nextToken()}
+	if first > 0 || last < len(events) {
+		out.RejectedLogEventsInfo = info
+	}
+	return out, nil
+}
+
+// inRange reports whether a timestamp falls in an optional range. The end is
+// exclusive or not as asked.
+func inRange(ts int64, start *int64, end *int64, endInclusive bool) bool {
+	if start != nil && ts < *start {
+		return false
+	}
+	if end != nil && (ts > *end || ts == *end && !endInclusive) {
+		return false
+	}
+	return true
+}
+
+// GetLogEvents reads events from a stream. Its tokens are f/N and b/N, the
+// positions to read forward or backward from.
+func (l *logs) GetLogEvents(req *GetLogEventsRequest) (*GetLogEventsResult, error) {
+	limit := req.Limit
+	if limit == 0 {
+		limit = maxBatchEvents
+	}
+	if limit < 1 || limit > maxBatchEvents {
+		return nil, common.Errorf("InvalidParameterException", "1 validation error detected: Value '%v' at 'limit' failed to satisfy constraint: Member must have value between 1 and %v", req.Limit, maxBatchEvents)
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	_, s, err := l.stream(req.LogGroupName, req.LogStreamName)
+	if err != nil {
+		return nil, err
+	}
+
+	events := []event{}
+	for _, e := range s.events {
+		if inRange(e.timestamp, req.StartTime, req.EndTime, false) {
+			events = append(events, e)
+		}
+	}
+
+	var start, end int
+	switch {
+	case req.NextToken == "":
+		if req.StartFromHead {
+			start, end = page(0, limit, len(events))
+		} else {
+			start = len(events) - limit
+			if start < 0 {
+				start = 0
+			}
+			end = len(events)
+		}
+
+	case strings.HasPrefix(req.NextToken, "f/"), strings.HasPrefix(req.NextToken, "b/"):
+		n, err := strconv.Atoi(req.NextToken[2:])
+		if err != nil || n < 0 {
+			return nil, common.Errorf("InvalidParameterException", "The specified nextToken is invalid.")
+		}
+		if n > len(events) {
+			n = len(events)
+		}
+		if req.NextToken[0] == 'f' {
+			start, end = page(n, limit, len(events))
+		} else {
+			start, end = n-limit, n
+			if start < 0 {
+				start = 0
+			}
+		}
+
+	default:
+		return nil, common.Errorf("InvalidParameterException", "The specified nextToken is invalid.")
+	}
+
+	out := &GetLogEventsResult{
+		Events:            []OutputLogEvent{},
+		NextBackwardToken: fmt.Sprintf("b/%056d", start),
+		NextForwardToken:  fmt.Sprintf("f/%056d", end),
+	}
+	for _, e := range events[start:end] {
+		out.Events = append(out.Events, OutputLogEvent{
+			IngestionTime: e.ingestion,
+			Message:       e.message,
+			Timestamp:     e.timestamp,
+		})
+	}
+	return out, nil
+}
+
+func (l *logs) FilterLogEvents(req *FilterLogEventsRequest) (*FilterLogEventsResult, error) {
+	if len(req.LogStreamNames) > 0 && req.LogStreamNamePrefix != "" {
+		return nil, common.Errorf("InvalidParameterException", "You cannot specify both LogStreamNames and LogStreamNamePrefix")
+	}
+	limit, offset, err := paging(req.Limit, maxBatchEvents, req.NextToken)
+	if err != nil {
+		return nil, err
+	}
+	p, err := parsePattern(req.FilterPattern)
+	if err != nil {
+		return nil, err
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	g, err := l.group(req.LogGroupName)
+	if err != nil {
+		return nil, err
+	}
+
+	names := req.LogStreamNames
+	if len(names) == 0 {
+		for name := range g.streams {
+			if strings.HasPrefix(name, req.LogStreamNamePrefix) {
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+
+	out := &FilterLogEventsResult{
+		Events:             []FilteredLogEvent{},
+		SearchedLogStreams: []SearchedLogStream{},
+	}
+	matched := []FilteredLogEvent{}
+	for _, name := range names {
+		s, ok := g.streams[name]
+		if !ok {
+			return nil, common.Errorf("ResourceNotFoundException", "The specified log stream does not exist.")
+		}
+		out.SearchedLogStreams = append(out.SearchedLogStreams, SearchedLogStream{LogStreamName: name, SearchedCompletely: true})
+
+		for _, e := range s.events {
+			if inRange(e.timestamp, req.StartTime, req.EndTime, true) && p.match(e.message) {
+				matched = append(matched, FilteredLogEvent{
+					EventID:       e.id,
+					IngestionTime: e.ingestion,
+					LogStreamName: name,
+					Message:       e.message,
+					Timestamp:     e.timestamp,
+				})
+			}
+		}
+	}
+	sort.SliceStable(matched, func(i, j int) bool {
+		return matched[i].Timestamp < matched[j].Timestamp
+	})
+
+	start, end := page(offset, limit, len(matched))
+	out.Events = append(out.Events, matched[start:end]...)
+	out.NextToken = pageToken(end, len(matched))
+	return out, nil
+}
@@ -0,0 +1,241 @@
+package logs_test
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/fernomac/aws-local/pkg/common"
+	"github.com/fernomac/aws-local/pkg/kms"
+	"github.com/fernomac/aws-local/pkg/logs"
+)
+
+// testClock is a clock the tests move by hand.
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	return c.now
+}
+
+func code(err error) string {
+	if ce, ok := err.(common.Error); ok {
+		return ce.Code
+	}
+	if err != nil {
+		return err.Error()
+	}
+	return ""
+}
+
+func millis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+// newTestLogs creates a log store with a group and stream called "app".
+func newTestLogs(t *testing.T, retention int) (logs.Logs, *testClock) {
+	clock := &testClock{now: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)}
+	l := logs.New(kms.New(), logs.WithClock(clock))
+	if _, err := l.CreateLogGroup(&logs.CreateLogGroupRequest{LogGroupName: "app"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.CreateLogStream(&logs.CreateLogStreamRequest{LogGroupName: "app", LogStreamName: "app"}); err != nil {
+		t.Fatal(err)
+	}
+	if retention > 0 {
+		if _, err := l.PutRetentionPolicy(&logs.PutRetentionPolicyRequest{LogGroupName: "app", RetentionInDays: retention}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return l, clock
+}
+
+// messages returns the messages in the "app" stream, oldest first.
+func messages(t *testing.T, l logs.Logs) []string {
+	out, err := l.GetLogEvents(&logs.GetLogEventsRequest{LogGroupName: "app", LogStreamName: "app", StartFromHead: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, e := range out.Events {
+		got = append(got, e.Message)
+	}
+	return got
+}
+
+func TestSequenceTokens(t *testing.T) {
+	l, clock := newTestLogs(t, 0)
+	now := millis(clock.now)
+	batch := func(messages ...string) []logs.InputLogEvent {
+		out := []logs.InputLogEvent{}
+		for _, m := range messages {
+			out = append(out, logs.InputLogEvent{Message: m, Timestamp: now})
+		}
+		return out
+	}
+
+	// tokens[n] is the token returned by the nth batch put, with tokens[0]
+	// the empty token a stream starts with.
+	tokens := []string{""}
+	steps := []struct {
+		batch []logs.InputLogEvent
+		token func() string
+		code  string
+	}{
+		{batch("a"), func() string { return "bogus" }, "InvalidSequenceTokenException"},
+		{batch("a"), func() string { return tokens[0] }, ""},
+		// The first batch again, with the token it was put with.
+		{batch("a"), func() string { return tokens[0] }, "DataAlreadyAcceptedException"},
+		{batch("b"), func() string { return tokens[0] }, "InvalidSequenceTokenException"},
+		{batch("b"), func() string { return "" }, "InvalidSequenceTokenException"},
+		{batch("b"), func() string { return tokens[1] }, ""},
+		{batch("b"), func() string { return tokens[1] }, "DataAlreadyAcceptedException"},
+		// Only the last batch counts as already accepted.
+		{batch("a"), func() string { return tokens[0] }, "InvalidSequenceTokenException"},
+		{batch("c"), func() string { return tokens[1] }, "InvalidSequenceTokenException"},
+		// The same events again with the current token are a new batch.
+		{batch("b"), func() string { return tokens[2] }, ""},
+		{batch("c", "d"), func() string { return tokens[3] }, ""},
+	}
+
+	for i, step := range steps {
+		out, err := l.PutLogEvents(&logs.PutLogEventsRequest{LogGroupName: "app", LogStreamName: "app", LogEvents: step.batch, SequenceToken: step.token()})
+		if got := code(err); got != step.code {
+			t.Fatalf("step %v: got %v, want %v", i, got, step.code)
+		}
+		if err != nil {
+			continue
+		}
+		if out.NextSequenceToken == "" || out.NextSequenceToken == tokens[len(tokens)-1] {
+			t.Fatalf("step %v: got token %q after %q", i, out.NextSequenceToken, tokens[len(tokens)-1])
+		}
+		tokens = append(tokens, out.NextSequenceToken)
+	}
+
+	if got, want := messages(t, l), []string{"a", "b", "b", "c", "d"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	streams, err := l.DescribeLogStreams(&logs.DescribeLogStreamsRequest{LogGroupName: "app"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := streams.LogStreams[0].UploadSequenceToken; got != tokens[len(tokens)-1] {
+		t.Errorf("got upload token %q, want %q", got, tokens[len(tokens)-1])
+	}
+}
+
+func TestRejectedEvents(t *testing.T) {
+	day := 24 * time.Hour
+	tests := []struct {
+		retention int
+		offsets   []time.Duration
+		old       int
+		expired   int
+		new       int
+	}{
+		{0, []time.Duration{-time.Hour, 0, time.Hour}, -1, -1, -1},
+		{0, []time.Duration{-14*day - time.Hour, -14*day - time.Minute, -14*day + time.Minute}, 2, -1, -1},
+		{0, []time.Duration{-14*day - time.Hour, -14*day - time.Minute}, 2, -1, -1},
+		{1, []time.Duration{-day - 10*time.Minute, -day - time.Minute, -time.Hour}, -1, 2, -1},
+		{30, []time.Duration{-14*day - time.Minute, -14*day + time.Minute}, 1, -1, -1},
+		{0, []time.Duration{0, 2 * time.Hour, 2*time.Hour + time.Millisecond, 3 * time.Hour}, -1, -1, 2},
+		{0, []time.Duration{3 * time.Hour}, -1, -1, 0},
+	}
+
+	index := func(n *int) int {
+		if n == nil {
+			return -1
+		}
+		return *n
+	}
+	for i, test := range tests {
+		l, clock := newTestLogs(t, test.retention)
+		events := []logs.InputLogEvent{}
+		for j, offset := range test.offsets {
+			events = append(events, logs.InputLogEvent{Message: fmt.Sprint(j), Timestamp: millis(clock.now.Add(offset))})
+		}
+		out, err := l.PutLogEvents(&logs.PutLogEventsRequest{LogGroupName: "app", LogStreamName: "app", LogEvents: events})
+		if err != nil {
+			t.Fatalf("case %v: %v", i, err)
+		}
+
+		want := []string{}
+		first, last := 0, len(events)
+		if test.old > first {
+			first = test.old
+		}
+		if test.expired > first {
+			first = test.expired
+		}
+		if test.new >= 0 {
+			last = test.new
+		}
+		for j := first; j < last; j++ {
+			want = append(want, fmt.Sprint(j))
+		}
+
+		info := out.RejectedLogEventsInfo
+		if info == nil {
+			if test.old >= 0 || test.expired >= 0 || test.new >= 0 {
+				t.Errorf("case %v: no rejected events", i)
+			}
+		} else if old, expired, new := index(info.TooOldLogEventEndIndex), index(info.ExpiredLogEventEndIndex), index(info.TooNewLogEventStartIndex); old != test.old || expired != test.expired || new != test.new {
+			t.Errorf("case %v: got old %v expired %v new %v, want %v %v %v", i, old, expired, new, test.old, test.expired, test.new)
+		}
+		if got := messages(t, l); !reflect.DeepEqual(got, want) {
+			t.Errorf("case %v: stored %v, want %v", i, got, want)
+		}
+	}
+}
+
+func TestRetention(t *testing.T) {
+	l, clock := newTestLogs(t, 0)
+	start := clock.now
+	var token string
+	for _, age := range []time.Duration{10, 5, 1} {
+		clock.now = start.Add(-age * 24 * time.Hour)
+		out, err := l.PutLogEvents(&logs.PutLogEventsRequest{
+			LogGroupName:  "app",
+			LogStreamName: "app",
+			LogEvents:     []logs.InputLogEvent{{Message: fmt.Sprintf("%vd", int(age)), Timestamp: millis(clock.now)}},
+			SequenceToken: token,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		token = out.NextSequenceToken
+	}
+	clock.now = start
+
+	steps := []struct {
+		retention int
+		advance   time.Duration
+		want      []string
+	}{
+		{0, 0, []string{"10d", "5d", "1d"}},
+		{7, 0, []string{"5d", "1d"}},
+		{7, 2*24*time.Hour - time.Minute, []string{"5d", "1d"}},
+		{7, 2 * time.Minute, []string{"1d"}},
+		// Expired events are gone for good.
+		{30, 0, []string{"1d"}},
+		{1, 0, []string{}},
+	}
+
+	for i, step := range steps {
+		if step.retention > 0 {
+			if _, err := l.PutRetentionPolicy(&logs.PutRetentionPolicyRequest{LogGroupName: "app", RetentionInDays: step.retention}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		clock.now = clock.now.Add(step.advance)
+		if got := messages(t, l); !reflect.DeepEqual(got, step.want) {
+			t.Errorf("step %v: got %v, want %v", i, got, step.want)
+		}
+	}
+
+	if _, err := l.PutRetentionPolicy(&logs.PutRetentionPolicyRequest{LogGroupName: "app", RetentionInDays: 2}); code(err) != "InvalidParameterException" {
+		t.Errorf("two days: got %v, want InvalidParameterException", err)
+	}
+}
@@ -0,0 +1,38 @@
+package metrics
+
+import "github.com/fernomac/aws-local/pkg/common"
+
+// CallMetrics records per-operation request counts, errors and latencies.
+type CallMetrics struct {
+	requests *Counter
+	errors   *Counter
+	latency  *Histogram
+}
+
+// NewCallMetrics registers the per-call metrics with the given registry.
+func NewCallMetrics(r *Registry) *CallMetrics {
+	return &CallMetrics{
+		requests: r.NewCounter(
+			"aws_local_requests_total",
+			"Number of requests handled, by service and operation.",
+			"service", "operation"),
+		errors: r.NewCounter(
+			"aws_local_errors_total",
+			"Number of requests that failed, by service, operation and error type.",
+			"service", "operation", "type"),
+		latency: r.NewHistogram(
+			"aws_local_request_duration_seconds",
+			"Time taken to handle requests, by service and operation.",
+			DefaultBuckets,
+			"service", "operation"),
+	}
+}
+
+// Observe records the given call.
+func (m *CallMetrics) Observe(call *common.Call) {
+	m.requests.Inc(call.EventSource, call.Operation)
+	if code := call.ErrorCode(); code != "" {
+		m.errors.Inc(call.EventSource, call.Operation, code)
+	}
+	m.latency.Observe(call.Duration.Seconds(), call.EventSource, call.Operation)
+}
@@ -0,0 +1,162 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Counter is a monotonically increasing value, partitioned by labels.
+type Counter struct {
+	desc
+	lock   sync.Mutex
+	labels map[string][]string
+	values map[string]float64
+}
+
+// NewCounter registers a new counter.
+func (r *Registry) NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{
+		desc:   desc{name: name, help: help, kind: "counter", labels: labels},
+		labels: make(map[string][]string),
+		values: make(map[string]float64),
+	}
+	r.register(c)
+	return c
+}
+
+// Inc adds one to the counter with the given label values.
+func (c *Counter) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Add adds delta to the counter with the given label values.
+func (c *Counter) Add(delta float64, values ...string) {
+	checkLabels(&c.desc, values)
+	k := key(values)
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if _, ok := c.labels[k]; !ok {
+		c.labels[k] = append([]string(nil), values...)
+	}
+	c.values[k] += delta
+}
+
+func (c *Counter) write(buf *bytes.Buffer) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.header(buf)
+	for _, k := range sortedKeys(c.labels) {
+		fmt.Fprintf(buf, "%v%v %v\n", c.name, labelString(c.desc.labels, c.labels[k]), formatFloat(c.values[k]))
+	}
+}
+
+type histogramData struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// Histogram counts observations into buckets, partitioned by labels.
+type Histogram struct {
+	desc
+	buckets []float64
+	lock    sync.Mutex
+	labels  map[string][]string
+	data    map[string]*histogramData
+}
+
+// NewHistogram registers a new histogram with the given upper bucket bounds.
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	b := append([]float64(nil), buckets...)
+	sort.Float64s(b)
+
+	h := &Histogram{
+		desc:    desc{name: name, help: help, kind: "histogram", labels: labels},
+		buckets: b,
+		labels:  make(map[string][]string),
+		data:    make(map[string]*histogramData),
+	}
+	r.register(h)
+	return h
+}
+
+// Observe records a value in the histogram with the given label values.
+func (h *Histogram) Observe(v float64, values ...string) {
+	checkLabels(&h.desc, values)
+	k := key(values)
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	d, ok := h.data[k]
+	if !ok {
+		h.labels[k] = append([]string(nil), values...)
+		d = &histogramData{counts: make([]uint64, len(h.buckets))}
+		h.data[k] = d
+	}
+
+	for i, bound := range h.buckets {
+		if v <= bound {
+			d.counts[i]++
+		}
+	}
+	d.sum += v
+	d.count++
+}
+
+func (h *Histogram) write(buf *bytes.Buffer) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.header(buf)
+	for _, k := range sortedKeys(h.labels) {
+		values := h.labels[k]
+		d := h.data[k]
+		for i, bound := range h.buckets {
+			fmt.Fprintf(buf, "%v_bucket%v %v\n", h.name, labelString(h.desc.labels, values, "le", formatFloat(bound)), d.counts[i])
+		}
+		fmt.Fprintf(buf, "%v_bucket%v %v\n", h.name, labelString(h.desc.labels, values, "le", "+Inf"), d.count)
+		fmt.Fprintf(buf, "%v_sum%v %v\n", h.name, labelString(h.desc.labels, values), formatFloat(d.sum))
+		fmt.Fprintf(buf, "%v_count%v %v\n", h.name, labelString(h.desc.labels, values), d.count)
+	}
+}
+
+// Sample is a single labelled value reported by a GaugeFunc.
+type Sample struct {
+	Labels []string
+	Value  float64
+}
+
+// GaugeFunc is a gauge whose values are computed on every scrape.
+type GaugeFunc struct {
+	desc
+	fn func() []Sample
+}
+
+// NewGaugeFunc registers a gauge whose samples are produced by fn.
+func (r *Registry) NewGaugeFunc(name, help string, fn func() []Sample, labels ...string) *GaugeFunc {
+	g := &GaugeFunc{
+		desc: desc{name: name, help: help, kind: "gauge", labels: labels},
+		fn:   fn,
+	}
+	r.register(g)
+	return g
+}
+
+func (g *GaugeFunc) write(buf *bytes.Buffer) {
+	samples := g.fn()
+	sort.Slice(samples, func(i, j int) bool {
+		return key(samples[i].Labels) < key(samples[j].Labels)
+	})
+
+	g.header(buf)
+	for _, s := range samples {
+		checkLabels(&g.desc, s.Labels)
+		fmt.Fprintf(buf, "%v%v %v\n", g.name, labelString(g.desc.labels, s.Labels), formatFloat(s.Value))
+	}
+}
@@ -0,0 +1,113 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are the default latency histogram buckets, in seconds.
+var DefaultBuckets = []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5}
+
+type collector interface {
+	write(buf *bytes.Buffer)
+}
+
+// Registry is a set of metrics exposed in the Prometheus text format.
+type Registry struct {
+	lock       sync.Mutex
+	collectors []collector
+}
+
+// NewRegistry creates a new, empty registry.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) register(c collector) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.collectors = append(r.collectors, c)
+}
+
+func (r *Registry) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	r.lock.Lock()
+	collectors := append([]collector(nil), r.collectors...)
+	r.lock.Unlock()
+
+	buf := bytes.Buffer{}
+	for _, c := range collectors {
+		c.write(&buf)
+	}
+
+	resp.Header().Add("Content-Type", "text/plain; version=0.0.4")
+	resp.Write(buf.Bytes())
+}
+
+type desc struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+}
+
+func (d *desc) header(buf *bytes.Buffer) {
+	fmt.Fprintf(buf, "# HELP %v %v\n", d.name, strings.Replace(d.help, "\n", `\n`, -1))
+	fmt.Fprintf(buf, "# TYPE %v %v\n", d.name, d.kind)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// labelString formats names and values as {a="x",b="y"}, with an optional
+// extra pair appended.
+func labelString(names []string, values []string, extra ...string) string {
+	if len(names) == 0 && len(extra) == 0 {
+		return ""
+	}
+
+	parts := []string{}
+	for i, name := range names {
+		parts = append(parts, fmt.Sprintf(`%v="%v"`, name, labelEscaper.Replace(values[i])))
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		parts = append(parts, fmt.Sprintf(`%v="%v"`, extra[i], labelEscaper.Replace(extra[i+1])))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	case math.IsNaN(f):
+		return "NaN"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// key joins label values into a map key.
+func key(values []string) string {
+	return strings.Join(values, "\xff")
+}
+
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func checkLabels(d *desc, values []string) {
+	if len(values) != len(d.labels) {
+		panic(fmt.Sprintf("metrics: %v wants %v label values, got %v", d.name, len(d.labels), len(values)))
+	}
+}
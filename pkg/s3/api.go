@@ -0,0 +1,630 @@
+package s3
+
+import (
+	"encoding/xml"
+	"io"
+	"time"
+)
+
+// S3 is the service interface for Amazon Simple Storage Service.
+type S3 interface {
+	CreateBucket(*CreateBucketRequest) (*CreateBucketResult, error)
+	DeleteBucket(*DeleteBucketRequest) (*DeleteBucketResult, error)
+	HeadBucket(*HeadBucketRequest) (*HeadBucketResult, error)
+	ListBuckets(*ListBucketsRequest) (*ListBucketsResult, error)
+	GetBucketLocation(*GetBucketLocationRequest) (*GetBucketLocationResult, error)
+	PutBucketEncryption(*PutBucketEncryptionRequest) (*PutBucketEncryptionResult, error)
+	GetBucketEncryption(*GetBucketEncryptionRequest) (*GetBucketEncryptionResult, error)
+	DeleteBucketEncryption(*DeleteBucketEncryptionRequest) (*DeleteBucketEncryptionResult, error)
+
+	PutObject(*PutObjectRequest) (*PutObjectResult, error)
+	CopyObject(*CopyObjectRequest) (*CopyObjectResult, error)
+	GetObject(*GetObjectRequest) (*GetObjectResult, error)
+	HeadObject(*HeadObjectRequest) (*HeadObjectResult, error)
+	DeleteObject(*DeleteObjectRequest) (*DeleteObjectResult, error)
+	DeleteObjects(*DeleteObjectsRequest) (*DeleteObjectsResult, error)
+	ListObjects(*ListObjectsRequest) (*ListObjectsResult, error)
+	ListObjectsV2(*ListObjectsV2Request) (*ListObjectsV2Result, error)
+
+	CreateMultipartUpload(*CreateMultipartUploadRequest) (*CreateMultipartUploadResult, error)
+	UploadPart(*UploadPartRequest) (*UploadPartResult, error)
+	UploadPartCopy(*UploadPartCopyRequest) (*UploadPartCopyResult, error)
+	CompleteMultipartUpload(*CompleteMultipartUploadRequest) (*CompleteMultipartUploadResult, error)
+	AbortMultipartUpload(*AbortMultipartUploadRequest) (*AbortMultipartUploadResult, error)
+	ListParts(*ListPartsRequest) (*ListPartsResult, error)
+	ListMultipartUploads(*ListMultipartUploadsRequest) (*ListMultipartUploadsResult, error)
+}
+
+// namespace is the XML namespace of S3 response documents.
+const namespace = "http://s3.amazonaws.com/doc/2006-03-01/"
+
+// Server-side encryption algorithms.
+const (
+	AES256 = "AES256"
+	AWSKMS = "aws:kms"
+)
+
+// Owner is the owner of a bucket, object or upload.
+type Owner struct {
+	DisplayName string `xml:"DisplayName,omitempty"`
+	ID          string `xml:"ID"`
+}
+
+//
+// Buckets.
+//
+
+// CreateBucketConfiguration is the body of a CreateBucket request.
+type CreateBucketConfiguration struct {
+	LocationConstraint string `xml:"LocationConstraint"`
+}
+
+// CreateBucketRequest is a request to CreateBucket.
+type CreateBucketRequest struct {
+	Bucket        string                     `location:"uri" locationName:"Bucket"`
+	Configuration *CreateBucketConfiguration `location:"payload"`
+}
+
+// CreateBucketResult is the result of CreateBucket.
+type CreateBucketResult struct {
+	Location string `location:"header" locationName:"Location"`
+}
+
+// DeleteBucketRequest is a request to DeleteBucket.
+type DeleteBucketRequest struct {
+	Bucket string `location:"uri" locationName:"Bucket"`
+}
+
+// DeleteBucketResult is the result of DeleteBucket.
+type DeleteBucketResult struct {
+	StatusCode int `location:"statusCode" json:"-"`
+}
+
+// HeadBucketRequest is a request to HeadBucket.
+type HeadBucketRequest struct {
+	Bucket string `location:"uri" locationName:"Bucket"`
+}
+
+// HeadBucketResult is the result of HeadBucket.
+type HeadBucketResult struct {
+	BucketRegion string `location:"header" locationName:"x-amz-bucket-region"`
+}
+
+// ListBucketsRequest is a request to ListBuckets.
+type ListBucketsRequest struct{}
+
+// Bucket describes a bucket.
+type Bucket struct {
+	CreationDate string `xml:"CreationDate"`
+	Name         string `xml:"Name"`
+}
+
+// ListBucketsResult is the result of ListBuckets.
+type ListBucketsResult struct {
+	XMLName xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListAllMyBucketsResult" json:"-"`
+	Owner   Owner    `xml:"Owner"`
+	Buckets []Bucket `xml:"Buckets>Bucket"`
+}
+
+// GetBucketLocationRequest is a request to GetBucketLocation.
+type GetBucketLocationRequest struct {
+	Bucket string `location:"uri" locationName:"Bucket"`
+}
+
+// GetBucketLocationResult is the result of GetBucketLocation.
+type GetBucketLocationResult struct {
+	XMLName            xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ LocationConstraint" json:"-"`
+	LocationConstraint string   `xml:",chardata"`
+}
+
+// ServerSideEncryptionByDefault is the encryption objects get when a request
+// doesn't ask for any.
+type ServerSideEncryptionByDefault struct {
+	SSEAlgorithm   string `xml:"SSEAlgorithm"`
+	KMSMasterKeyID string `xml:"KMSMasterKeyID,omitempty"`
+}
+
+// ServerSideEncryptionRule is a bucket encryption rule.
+type ServerSideEncryptionRule struct {
+	ApplyServerSideEncryptionByDefault *ServerSideEncryptionByDefault `xml:"ApplyServerSideEncryptionByDefault"`
+	BucketKeyEnabled                   bool                           `xml:"BucketKeyEnabled"`
+}
+
+// ServerSideEncryptionConfiguration is a bucket's default encryption. Its
+// XMLName is left untagged so that requests needn't give the namespace.
+type ServerSideEncryptionConfiguration struct {
+	XMLName xml.Name                   `json:"-"`
+	Rules   []ServerSideEncryptionRule `xml:"Rule"`
+}
+
+// PutBucketEncryptionRequest is a request to PutBucketEncryption.
+type PutBucketEncryptionRequest struct {
+	Bucket        string                             `location:"uri" locationName:"Bucket"`
+	Configuration *ServerSideEncryptionConfiguration `location:"payload"`
+}
+
+// PutBucketEncryptionResult is the result of PutBucketEncryption.
+type PutBucketEncryptionResult struct{}
+
+// GetBucketEncryptionRequest is a request to GetBucketEncryption.
+type GetBucketEncryptionRequest struct {
+	Bucket string `location:"uri" locationName:"Bucket"`
+}
+
+// GetBucketEncryptionResult is the result of GetBucketEncryption.
+type GetBucketEncryptionResult struct {
+	Configuration *ServerSideEncryptionConfiguration `location:"payload"`
+}
+
+// DeleteBucketEncryptionRequest is a request to DeleteBucketEncryption.
+type DeleteBucketEncryptionRequest struct {
+	Bucket string `location:"uri" locationName:"Bucket"`
+}
+
+// DeleteBucketEncryptionResult is the result of DeleteBucketEncryption.
+type DeleteBucketEncryptionResult struct {
+	StatusCode int `location:"statusCode" json:"-"`
+}
+
+//
+// Objects.
+//
+
+// PutObjectRequest is a request to PutObject.
+type PutObjectRequest struct {
+	Bucket string `location:"uri" locationName:"Bucket"`
+	Key    string `location:"uri" locationName:"Key"`
+	Body   []byte `location:"payload" json:"-"`
+
+	CacheControl       string            `location:"header" locationName:"Cache-Control"`
+	ContentDisposition string            `location:"header" locationName:"Content-Disposition"`
+	ContentEncoding    string            `location:"header" locationName:"Content-Encoding"`
+	ContentLanguage    string            `location:"header" locationName:"Content-Language"`
+	ContentMD5         string            `location:"header" locationName:"Content-MD5"`
+	ContentType        string            `location:"header" locationName:"Content-Type"`
+	Expires            string            `location:"header" locationName:"Expires"`
+	Metadata           map[string]string `location:"headers" locationName:"x-amz-meta-"`
+
+	ServerSideEncryption    string `location:"header" locationName:"x-amz-server-side-encryption"`
+	SSEKMSKeyID             string `location:"header" locationName:"x-amz-server-side-encryption-aws-kms-key-id"`
+	SSEKMSEncryptionContext string `location:"header" locationName:"x-amz-server-side-encryption-context"`
+	BucketKeyEnabled        *bool  `location:"header" locationName:"x-amz-server-side-encryption-bucket-key-enabled"`
+	SSECustomerAlgorithm    string `location:"header" locationName:"x-amz-server-side-encryption-customer-algorithm"`
+}
+
+// PutObjectResult is the result of PutObject.
+type PutObjectResult struct {
+	ETag string `location:"header" locationName:"ETag"`
+
+	ServerSideEncryption    string `location:"header" locationName:"x-amz-server-side-encryption"`
+	SSEKMSKeyID             string `location:"header" locationName:"x-amz-server-side-encryption-aws-kms-key-id"`
+	SSEKMSEncryptionContext string `location:"header" locationName:"x-amz-server-side-encryption-context"`
+	BucketKeyEnabled        *bool  `location:"header" locationName:"x-amz-server-side-encryption-bucket-key-enabled"`
+}
+
+// CopyObjectRequest is a request to CopyObject. CopySource is
+// "bucket/key", URL encoded, optionally with a leading slash.
+// MetadataDirective is COPY, the default, to keep the source's metadata and
+// content headers, or REPLACE to use the request's.
+type CopyObjectRequest struct {
+	Bucket                      string    `location:"uri" locationName:"Bucket"`
+	Key                         string    `location:"uri" locationName:"Key"`
+	CopySource                  string    `location:"header" locationName:"x-amz-copy-source"`
+	CopySourceIfMatch           string    `location:"header" locationName:"x-amz-copy-source-if-match"`
+	CopySourceIfNoneMatch       string    `location:"header" locationName:"x-amz-copy-source-if-none-match"`
+	CopySourceIfModifiedSince   time.Time `location:"header" locationName:"x-amz-copy-source-if-modified-since"`
+	CopySourceIfUnmodifiedSince time.Time `location:"header" locationName:"x-amz-copy-source-if-unmodified-since"`
+	MetadataDirective           string    `location:"header" locationName:"x-amz-metadata-directive"`
+
+	CacheControl       string            `location:"header" locationName:"Cache-Control"`
+	ContentDisposition string            `location:"header" locationName:"Content-Disposition"`
+	ContentEncoding    string            `location:"header" locationName:"Content-Encoding"`
+	ContentLanguage    string            `location:"header" locationName:"Content-Language"`
+	ContentType        string            `location:"header" locationName:"Content-Type"`
+	Expires            string            `location:"header" locationName:"Expires"`
+	Metadata           map[string]string `location:"headers" locationName:"x-amz-meta-"`
+
+	ServerSideEncryption    string `location:"header" locationName:"x-amz-server-side-encryption"`
+	SSEKMSKeyID             string `location:"header" locationName:"x-amz-server-side-encryption-aws-kms-key-id"`
+	SSEKMSEncryptionContext string `location:"header" locationName:"x-amz-server-side-encryption-context"`
+	BucketKeyEnabled        *bool  `location:"header" locationName:"x-amz-server-side-encryption-bucket-key-enabled"`
+	SSECustomerAlgorithm    string `location:"header" locationName:"x-amz-server-side-encryption-customer-algorithm"`
+}
+
+// CopyObjectResultBody is the body of the result of CopyObject.
+type CopyObjectResultBody struct {
+	XMLName      xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ CopyObjectResult" json:"-"`
+	ETag         string   `xml:"ETag"`
+	LastModified string   `xml:"LastModified"`
+}
+
+// CopyObjectResult is the result of CopyObject.
+type CopyObjectResult struct {
+	Result *CopyObjectResultBody `location:"payload"`
+
+	ServerSideEncryption    string `location:"header" locationName:"x-amz-server-side-encryption"`
+	SSEKMSKeyID             string `location:"header" locationName:"x-amz-server-side-encryption-aws-kms-key-id"`
+	SSEKMSEncryptionContext string `location:"header" locationName:"x-amz-server-side-encryption-context"`
+	BucketKeyEnabled        *bool  `location:"header" locationName:"x-amz-server-side-encryption-bucket-key-enabled"`
+}
+
+// GetObjectRequest is a request to GetObject. Range is an HTTP byte range
+// such as "bytes=0-99"; PartNumber gets one part of a multipart object. The
+// Response fields override the headers of the response.
+type GetObjectRequest struct {
+	Bucket            string    `location:"uri" locationName:"Bucket"`
+	Key               string    `location:"uri" locationName:"Key"`
+	Range             string    `location:"header" locationName:"Range"`
+	PartNumber        *int      `location:"querystring" locationName:"partNumber"`
+	IfMatch           string    `location:"header" locationName:"If-Match"`
+	IfNoneMatch       string    `location:"header" locationName:"If-None-Match"`
+	IfModifiedSince   time.Time `location:"header" locationName:"If-Modified-Since"`
+	IfUnmodifiedSince time.Time `location:"header" locationName:"If-Unmodified-Since"`
+
+	ResponseCacheControl       string `location:"querystring" locationName:"response-cache-control"`
+	ResponseContentDisposition string `location:"querystring" locationName:"response-content-disposition"`
+	ResponseContentEncoding    string `location:"querystring" locationName:"response-content-encoding"`
+	ResponseContentLanguage    string `location:"querystring" locationName:"response-content-language"`
+	ResponseContentType        string `location:"querystring" locationName:"response-content-type"`
+	ResponseExpires            string `location:"querystring" locationName:"response-expires"`
+}
+
+// GetObjectResult is the result of GetObject. StatusCode is 206 for range
+// and part requests.
+type GetObjectResult struct {
+	Body       io.Reader `location:"payload" json:"-"`
+	StatusCode int       `location:"statusCode" json:"-"`
+
+	AcceptRanges       string            `location:"header" locationName:"Accept-Ranges"`
+	CacheControl       string            `location:"header" locationName:"Cache-Control"`
+	ContentDisposition string            `location:"header" locationName:"Content-Disposition"`
+	ContentEncoding    string            `location:"header" locationName:"Content-Encoding"`
+	ContentLanguage    string            `location:"header" locationName:"Content-Language"`
+	ContentLength      int64             `location:"header" locationName:"Content-Length"`
+	ContentRange       string            `location:"header" locationName:"Content-Range"`
+	ContentType        string            `location:"header" locationName:"Content-Type"`
+	ETag               string            `location:"header" locationName:"ETag"`
+	Expires            string            `location:"header" locationName:"Expires"`
+	LastModified       time.Time         `location:"header" locationName:"Last-Modified"`
+	Metadata           map[string]string `location:"headers" locationName:"x-amz-meta-"`
+	PartsCount         *int              `location:"header" locationName:"x-amz-mp-parts-count"`
+
+	ServerSideEncryption    string `location:"header" locationName:"x-amz-server-side-encryption"`
+	SSEKMSKeyID             string `location:"header" locationName:"x-amz-server-side-encryption-aws-kms-key-id"`
+	SSEKMSEncryptionContext string `location:"header" locationName:"x-amz-server-side-encryption-context"`
+	BucketKeyEnabled        *bool  `location:"header" locationName:"x-amz-server-side-encryption-bucket-key-enabled"`
+}
+
+// HeadObjectRequest is a request to HeadObject.
+type HeadObjectRequest GetObjectRequest
+
+// HeadObjectResult is the result of HeadObject. It never has a Body.
+type HeadObjectResult GetObjectResult
+
+// DeleteObjectRequest is a request to DeleteObject.
+type DeleteObjectRequest struct {
+	Bucket string `location:"uri" locationName:"Bucket"`
+	Key    string `location:"uri" locationName:"Key"`
+}
+
+// DeleteObjectResult is the result of DeleteObject.
+type DeleteObjectResult struct {
+	StatusCode int `location:"statusCode" json:"-"`
+}
+
+// ObjectIdentifier names an object to delete.
+type ObjectIdentifier struct {
+	Key string `xml:"Key"`
+}
+
+// Delete is the body of a DeleteObjects request. Quiet leaves the objects
+// deleted out of the result.
+type Delete struct {
+	Objects []ObjectIdentifier `xml:"Object"`
+	Quiet   bool               `xml:"Quiet"`
+}
+
+// DeleteObjectsRequest is a request to DeleteObjects.
+type DeleteObjectsRequest struct {
+	Bucket string  `location:"uri" locationName:"Bucket"`
+	Delete *Delete `location:"payload"`
+}
+
+// DeletedObject is an object DeleteObjects deleted.
+type DeletedObject struct {
+	Key string `xml:"Key"`
+}
+
+// DeleteError is an object DeleteObjects couldn't delete.
+type DeleteError struct {
+	Key     string `xml:"Key"`
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+// DeleteObjectsResult is the result of DeleteObjects.
+type DeleteObjectsResult struct {
+	XMLName xml.Name        `xml:"http://s3.amazonaws.com/doc/2006-03-01/ DeleteResult" json:"-"`
+	Deleted []DeletedObject `xml:"Deleted"`
+	Errors  []DeleteError   `xml:"Error"`
+}
+
+// Object describes an object in a listing.
+type Object struct {
+	Key          string `xml:"Key"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag"`
+	Size         int64  `xml:"Size"`
+	StorageClass string `xml:"StorageClass"`
+	Owner        *Owner `xml:"Owner,omitempty"`
+}
+
+// CommonPrefix is a key prefix that objects in a listing were rolled up into.
+type CommonPrefix struct {
+	Prefix string `xml:"Prefix"`
+}
+
+// ListObjectsRequest is a request to ListObjects. EncodingType "url" URL
+// encodes the keys and prefixes in the result.
+type ListObjectsRequest struct {
+	Bucket       string `location:"uri" locationName:"Bucket"`
+	Delimiter    string `location:"querystring" locationName:"delimiter"`
+	EncodingType string `location:"querystring" locationName:"encoding-type"`
+	Marker       string `location:"querystring" locationName:"marker"`
+	MaxKeys      *int   `location:"querystring" locationName:"max-keys"`
+	Prefix       string `location:"querystring" locationName:"prefix"`
+}
+
+// ListObjectsResult is the result of ListObjects. NextMarker is only given
+// when there is a Delimiter; otherwise the last key is the next marker.
+type ListObjectsResult struct {
+	XMLName        xml.Name       `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListBucketResult" json:"-"`
+	Name           string         `xml:"Name"`
+	Prefix         string         `xml:"Prefix"`
+	Marker         string         `xml:"Marker"`
+	NextMarker     string         `xml:"NextMarker,omitempty"`
+	MaxKeys        int            `xml:"MaxKeys"`
+	Delimiter      string         `xml:"Delimiter,omitempty"`
+	IsTruncated    bool           `xml:"IsTruncated"`
+	Contents       []Object       `xml:"Contents"`
+	CommonPrefixes []CommonPrefix `xml:"CommonPrefixes"`
+	EncodingType   string         `xml:"EncodingType,omitempty"`
+}
+
+// ListObjectsV2Request is a request to ListObjectsV2.
+type ListObjectsV2Request struct {
+	Bucket            string `location:"uri" locationName:"Bucket"`
+	ContinuationToken string `location:"querystring" locationName:"continuation-token"`
+	Delimiter         string `location:"querystring" locationName:"delimiter"`
+	EncodingType      string `location:"querystring" locationName:"encoding-type"`
+	FetchOwner        bool   `location:"querystring" locationName:"fetch-owner"`
+	MaxKeys           *int   `location:"querystring" locationName:"max-keys"`
+	Prefix            string `location:"querystring" locationName:"prefix"`
+	StartAfter        string `location:"querystring" locationName:"start-after"`
+}
+
+// ListObjectsV2Result is the result of ListObjectsV2.
+type ListObjectsV2Result struct {
+	XMLName               xml.Name       `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListBucketResult" json:"-"`
+	Name                  string         `xml:"Name"`
+	Prefix                string         `xml:"Prefix"`
+	StartAfter            string         `xml:"StartAfter,omitempty"`
+	ContinuationToken     string         `xml:"ContinuationToken,omitempty"`
+	NextContinuationToken string         `xml:"NextContinuationToken,omitempty"`
+	KeyCount              int            `xml:"KeyCount"`
+	MaxKeys               int            `xml:"MaxKeys"`
+	Delimiter             string         `xml:"Delimiter,omitempty"`
+	IsTruncated           bool           `xml:"IsTruncated"`
+	Contents              []Object       `xml:"Contents"`
+	CommonPrefixes        []CommonPrefix `xml:"CommonPrefixes"`
+	EncodingType          string         `xml:"EncodingType,omitempty"`
+}
+
+//
+// Multipart uploads.
+//
+
+// CreateMultipartUploadRequest is a request to CreateMultipartUpload.
+type CreateMultipartUploadRequest struct {
+	Bucket string `location:"uri" locationName:"Bucket"`
+	Key    string `location:"uri" locationName:"Key"`
+
+	CacheControl       string            `location:"header" locationName:"Cache-Control"`
+	ContentDisposition string            `location:"header" locationName:"Content-Disposition"`
+	ContentEncoding    string            `location:"header" locationName:"Content-Encoding"`
+	ContentLanguage    string            `location:"header" locationName:"Content-Language"`
+	ContentType        string            `location:"header" locationName:"Content-Type"`
+	Expires            string            `location:"header" locationName:"Expires"`
+	Metadata           map[string]string `location:"headers" locationName:"x-amz-meta-"`
+
+	ServerSideEncryption    string `location:"header" locationName:"x-amz-server-side-encryption"`
+	SSEKMSKeyID             string `location:"header" locationName:"x-amz-server-side-encryption-aws-kms-key-id"`
+	SSEKMSEncryptionContext string `location:"header" locationName:"x-amz-server-side-encryption-context"`
+	BucketKeyEnabled        *bool  `location:"header" locationName:"x-amz-server-side-encryption-bucket-key-enabled"`
+	SSECustomerAlgorithm    string `location:"header" locationName:"x-amz-server-side-encryption-customer-algorithm"`
+}
+
+// InitiateMultipartUploadResult is the body of the result of
+// CreateMultipartUpload.
+type InitiateMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ InitiateMultipartUploadResult" json:"-"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	UploadID string   `xml:"UploadId"`
+}
+
+// CreateMultipartUploadResult is the result of CreateMultipartUpload.
+type CreateMultipartUploadResult struct {
+	Result *InitiateMultipartUploadResult `location:"payload"`
+
+	ServerSideEncryption    string `location:"header" locationName:"x-amz-server-side-encryption"`
+	SSEKMSKeyID             string `location:"header" locationName:"x-amz-server-side-encryption-aws-kms-key-id"`
+	SSEKMSEncryptionContext string `location:"header" locationName:"x-amz-server-side-encryption-context"`
+	BucketKeyEnabled        *bool  `location:"header" locationName:"x-amz-server-side-encryption-bucket-key-enabled"`
+}
+
+// UploadPartRequest is a request to UploadPart.
+type UploadPartRequest struct {
+	Bucket     string `location:"uri" locationName:"Bucket"`
+	Key        string `location:"uri" locationName:"Key"`
+	UploadID   string `location:"querystring" locationName:"uploadId"`
+	PartNumber int    `location:"querystring" locationName:"partNumber"`
+	ContentMD5 string `location:"header" locationName:"Content-MD5"`
+	Body       []byte `location:"payload" json:"-"`
+}
+
+// UploadPartResult is the result of UploadPart.
+type UploadPartResult struct {
+	ETag string `location:"header" locationName:"ETag"`
+
+	ServerSideEncryption string `location:"header" locationName:"x-amz-server-side-encryption"`
+	SSEKMSKeyID          string `location:"header" locationName:"x-amz-server-side-encryption-aws-kms-key-id"`
+	BucketKeyEnabled     *bool  `location:"header" locationName:"x-amz-server-side-encryption-bucket-key-enabled"`
+}
+
+// UploadPartCopyRequest is a request to UploadPartCopy. CopySourceRange is
+// a byte range such as "bytes=0-99".
+type UploadPartCopyRequest struct {
+	Bucket                      string    `location:"uri" locationName:"Bucket"`
+	Key                         string    `location:"uri" locationName:"Key"`
+	UploadID                    string    `location:"querystring" locationName:"uploadId"`
+	PartNumber                  int       `location:"querystring" locationName:"partNumber"`
+	CopySource                  string    `location:"header" locationName:"x-amz-copy-source"`
+	CopySourceRange             string    `location:"header" locationName:"x-amz-copy-source-range"`
+	CopySourceIfMatch           string    `location:"header" locationName:"x-amz-copy-source-if-match"`
+	CopySourceIfNoneMatch       string    `location:"header" locationName:"x-amz-copy-source-if-none-match"`
+	CopySourceIfModifiedSince   time.Time `location:"header" locationName:"x-amz-copy-source-if-modified-since"`
+	CopySourceIfUnmodifiedSince time.Time `location:"header" locationName:"x-amz-copy-source-if-unmodified-since"`
+}
+
+// CopyPartResult is the body of the result of UploadPartCopy.
+type CopyPartResult struct {
+	XMLName      xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ CopyPartResult" json:"-"`
+	ETag         string   `xml:"ETag"`
+	LastModified string   `xml:"LastModified"`
+}
+
+// UploadPartCopyResult is the result of UploadPartCopy.
+type UploadPartCopyResult struct {
+	Result *CopyPartResult `location:"payload"`
+
+	ServerSideEncryption string `location:"header" locationName:"x-amz-server-side-encryption"`
+	SSEKMSKeyID          string `location:"header" locationName:"x-amz-server-side-encryption-aws-kms-key-id"`
+	BucketKeyEnabled     *bool  `location:"header" locationName:"x-amz-server-side-encryption-bucket-key-enabled"`
+}
+
+// CompletedPart names a part to put in the object.
+type CompletedPart struct {
+	ETag       string `xml:"ETag"`
+	PartNumber int    `xml:"PartNumber"`
+}
+
+// CompletedMultipartUpload is the body of a CompleteMultipartUpload request.
+type CompletedMultipartUpload struct {
+	Parts []CompletedPart `xml:"Part"`
+}
+
+// CompleteMultipartUploadRequest is a request to CompleteMultipartUpload.
+type CompleteMultipartUploadRequest struct {
+	Bucket          string                    `location:"uri" locationName:"Bucket"`
+	Key             string                    `location:"uri" locationName:"Key"`
+	UploadID        string                    `location:"querystring" locationName:"uploadId"`
+	MultipartUpload *CompletedMultipartUpload `location:"payload"`
+}
+
+// CompleteMultipartUploadResultBody is the body of the result of
+// CompleteMultipartUpload.
+type CompleteMultipartUploadResultBody struct {
+	XMLName  xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ CompleteMultipartUploadResult" json:"-"`
+	Location string   `xml:"Location"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	ETag     string   `xml:"ETag"`
+}
+
+// CompleteMultipartUploadResult is the result of CompleteMultipartUpload.
+type CompleteMultipartUploadResult struct {
+	Result *CompleteMultipartUploadResultBody `location:"payload"`
+
+	ServerSideEncryption string `location:"header" locationName:"x-amz-server-side-encryption"`
+	SSEKMSKeyID          string `location:"header" locationName:"x-amz-server-side-encryption-aws-kms-key-id"`
+	BucketKeyEnabled     *bool  `location:"header" locationName:"x-amz-server-side-encryption-bucket-key-enabled"`
+}
+
+// AbortMultipartUploadRequest is a request to AbortMultipartUpload.
+type AbortMultipartUploadRequest struct {
+	Bucket   string `location:"uri" locationName:"Bucket"`
+	Key      string `location:"uri" locationName:"Key"`
+	UploadID string `location:"querystring" locationName:"uploadId"`
+}
+
+// AbortMultipartUploadResult is the result of AbortMultipartUpload.
+type AbortMultipartUploadResult struct {
+	StatusCode int `location:"statusCode" json:"-"`
+}
+
+// ListPartsRequest is a request to ListParts.
+type ListPartsRequest struct {
+	Bucket           string `location:"uri" locationName:"Bucket"`
+	Key              string `location:"uri" locationName:"Key"`
+	UploadID         string `location:"querystring" locationName:"uploadId"`
+	MaxParts         *int   `location:"querystring" locationName:"max-parts"`
+	PartNumberMarker int    `location:"querystring" locationName:"part-number-marker"`
+}
+
+// Part describes an uploaded part.
+type Part struct {
+	PartNumber   int    `xml:"PartNumber"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag"`
+	Size         int64  `xml:"Size"`
+}
+
+// ListPartsResult is the result of ListParts.
+type ListPartsResult struct {
+	XMLName              xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListPartsResult" json:"-"`
+	Bucket               string   `xml:"Bucket"`
+	Key                  string   `xml:"Key"`
+	UploadID             string   `xml:"UploadId"`
+	Initiator            Owner    `xml:"Initiator"`
+	Owner                Owner    `xml:"Owner"`
+	StorageClass         string   `xml:"StorageClass"`
+	PartNumberMarker     int      `xml:"PartNumberMarker"`
+	NextPartNumberMarker int      `xml:"NextPartNumberMarker"`
+	MaxParts             int      `xml:"MaxParts"`
+	IsTruncated          bool     `xml:"IsTruncated"`
+	Parts                []Part   `xml:"Part"`
+}
+
+// ListMultipartUploadsRequest is a request to ListMultipartUploads.
+type ListMultipartUploadsRequest struct {
+	Bucket         string `location:"uri" locationName:"Bucket"`
+	KeyMarker      string `location:"querystring" locationName:"key-marker"`
+	MaxUploads     *int   `location:"querystring" locationName:"max-uploads"`
+	Prefix         string `location:"querystring" locationName:"prefix"`
+	UploadIDMarker string `location:"querystring" locationName:"upload-id-marker"`
+}
+
+// MultipartUpload describes an upload in progress.
+type MultipartUpload struct {
+	Key          string `xml:"Key"`
+	UploadID     string `xml:"UploadId"`
+	Initiator    Owner  `xml:"Initiator"`
+	Owner        Owner  `xml:"Owner"`
+	StorageClass string `xml:"StorageClass"`
+	Initiated    string `xml:"Initiated"`
+}
+
+// ListMultipartUploadsResult is the result of ListMultipartUploads.
+type ListMultipartUploadsResult struct {
+	XMLName            xml.Name          `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListMultipartUploadsResult" json:"-"`
+	Bucket             string            `xml:"Bucket"`
+	KeyMarker          string            `xml:"KeyMarker"`
+	UploadIDMarker     string            `xml:"UploadIdMarker"`
+	NextKeyMarker      string            `xml:"NextKeyMarker"`
+	NextUploadIDMarker string            `xml:"NextUploadIdMarker"`
+	Prefix             string            `xml:"Prefix"`
+	MaxUploads         int               `xml:"MaxUploads"`
+	IsTruncated        bool              `xml:"IsTruncated"`
+	Uploads            []MultipartUpload `xml:"Upload"`
+}
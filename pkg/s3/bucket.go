@@ -0,0 +1,424 @@
+package s3
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/fernomac/aws-local/pkg/common"
+)
+
+// Limits.
+const (
+	maxKeyLength    = 1024
+	maxMetadataSize = 2048
+	maxListKeys     = 1000
+	maxDeleteKeys   = 1000
+	maxPartNumber   = 10000
+	minPartSize     = 5 << 20
+)
+
+var bucketNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9.\-]{1,61}[a-z0-9]$`)
+
+// owner owns everything.
+var owner = Owner{
+	DisplayName: "aws-local",
+	ID:          canonicalID(common.AccountID),
+}
+
+func canonicalID(account string) string {
+	sum := sha256.Sum256([]byte(account))
+	return hex.EncodeToString(sum[:])
+}
+
+func timestamp(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05.000Z")
+}
+
+func invalidArgument(format string, args ...interface{}) error {
+	return common.Errorf("InvalidArgument", format, args...)
+}
+
+func noSuchBucket() error {
+	return common.Errorf("NoSuchBucket", "The specified bucket does not exist")
+}
+
+func noSuchKey() error {
+	return common.Errorf("NoSuchKey", "The specified key does not exist.")
+}
+
+func noSuchUpload() error {
+	return common.Errorf("NoSuchUpload", "The specified upload does not exist. The upload ID may be invalid, or the upload may have been aborted or completed.")
+}
+
+func validateBucketName(name string) error {
+	if !bucketNamePattern.MatchString(name) || strings.Contains(name, "..") || net.ParseIP(name) != nil {
+		return common.Errorf("InvalidBucketName", "The specified bucket is not valid.")
+	}
+	return nil
+}
+
+func validateKey(key string) error {
+	if len(key) > maxKeyLength {
+		return common.Errorf("KeyTooLongError", "Your key is too long")
+	}
+	if !utf8.ValidString(key) {
+		return invalidArgument("Object key must be valid UTF-8")
+	}
+	return nil
+}
+
+func validateMetadata(meta map[string]string) error {
+	size := 0
+	for k, v := range meta {
+		size += len(k) + len(v)
+	}
+	if size > maxMetadataSize {
+		return common.Errorf("MetadataTooLarge", "Your metadata headers exceed the maximum allowed metadata size")
+	}
+	return nil
+}
+
+// checkDigest checks data against a Content-MD5 header, if there is one.
+func checkDigest(header string, data []byte) error {
+	if header == "" {
+		return nil
+	}
+	want, err := base64.StdEncoding.DecodeString(header)
+	if err != nil || len(want) != md5.Size {
+		return common.Errorf("InvalidDigest", "The Content-MD5 you specified was invalid.")
+	}
+	sum := md5.Sum(data)
+	if string(sum[:]) != string(want) {
+		return common.Errorf("BadDigest", "The Content-MD5 you specified did not match what we received.")
+	}
+	return nil
+}
+
+func etag(sum []byte) string {
+	return `"` + hex.EncodeToString(sum) + `"`
+}
+
+// sameETag compares ETags, with or without their quotes. "*" matches any.
+func sameETag(a string, b string) bool {
+	a, b = strings.Trim(strings.TrimSpace(a), `"`), strings.Trim(strings.TrimSpace(b), `"`)
+	return a == "*" || a == b
+}
+
+// matchesAny reports whether an If-Match or If-None-Match header, which may
+// list several ETags, matches an ETag.
+func matchesAny(header string, tag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		if sameETag(candidate, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// contentHeaders are the standard headers stored with an object.
+type contentHeaders struct {
+	cacheControl       string
+	contentDisposition string
+	contentEncoding    string
+	contentLanguage    string
+	contentType        string
+	expires            string
+}
+
+// withoutChunked drops the aws-chunked coding, which only describes how the
+// request was sent, from a Content-Encoding header.
+func withoutChunked(header string) string {
+	var out []string
+	for _, coding := range strings.Split(header, ",") {
+		if coding = strings.TrimSpace(coding); coding != "" && coding != "aws-chunked" {
+			out = append(out, coding)
+		}
+	}
+	return strings.Join(out, ",")
+}
+
+// bucket is a bucket and everything in it.
+type bucket struct {
+	name     string
+	created  time.Time
+	location string
+	rule     *ServerSideEncryptionRule
+	objects  map[string]*object
+	uploads  map[string]*upload
+}
+
+func newBucket(name string, location string, now time.Time) *bucket {
+	return &bucket{
+		name:     name,
+		created:  now,
+		location: location,
+		objects:  map[string]*object{},
+		uploads:  map[string]*upload{},
+	}
+}
+
+// encryptionRule returns the bucket's default encryption, which is SSE-S3
+// unless it has been set.
+func (b *bucket) encryptionRule() *ServerSideEncryptionRule {
+	if b.rule != nil {
+		return b.rule
+	}
+	return &ServerSideEncryptionRule{
+		ApplyServerSideEncryptionByDefault: &ServerSideEncryptionByDefault{SSEAlgorithm: AES256},
+	}
+}
+
+// object is an object's metadata and the segments holding its data. Parts is
+// the number of parts it was uploaded in, or 0 if it was put in one go.
+type object struct {
+	key      string
+	etag     string
+	size     int64
+	modified time.Time
+	headers  contentHeaders
+	meta     map[string]string
+	enc      *encryption
+	segments []*segment
+	parts    int
+}
+
+func (o *object) describe(withOwner bool) Object {
+	out := Object{
+		Key:          o.key,
+		LastModified: timestamp(o.modified),
+		ETag:         o.etag,
+		Size:         o.size,
+		StorageClass: "STANDARD",
+	}
+	if withOwner {
+		out.Owner = &owner
+	}
+	return out
+}
+
+// part returns the offset and size of one part of a multipart object. An
+// object put in one go has a single part.
+func (o *object) part(number int) (int64, int64, bool) {
+	if number < 1 || number > len(o.segments) {
+		return 0, 0, false
+	}
+	offset := int64(0)
+	for _, seg := range o.segments[:number-1] {
+		offset += seg.size
+	}
+	return offset, o.segments[number-1].size, true
+}
+
+// checkConditions applies conditional request headers to the object, giving
+// 412 Precondition Failed or 304 Not Modified. If-Match beats
+// If-Unmodified-Since, and If-None-Match beats If-Modified-Since, the way
+// RFC 7232 says.
+func (o *object) checkConditions(ifMatch string, ifNoneMatch string, ifModifiedSince time.Time, ifUnmodifiedSince time.Time) error {
+	modified := o.modified.Truncate(time.Second)
+
+	if ifMatch != "" {
+		if !matchesAny(ifMatch, o.etag) {
+			return preconditionFailed("If-Match")
+		}
+	} else if !ifUnmodifiedSince.IsZero() && modified.After(ifUnmodifiedSince) {
+		return preconditionFailed("If-Unmodified-Since")
+	}
+
+	if ifNoneMatch != "" {
+		if matchesAny(ifNoneMatch, o.etag) {
+			return common.Errorf("NotModified", "Not Modified")
+		}
+	} else if !ifModifiedSince.IsZero() && !modified.After(ifModifiedSince) {
+		return common.Errorf("NotModified", "Not Modified")
+	}
+
+	return nil
+}
+
+// checkCopyConditions applies x-amz-copy-source-if-* headers to a copy
+// source. Unlike checkConditions, every failure is 412 Precondition Failed.
+func (o *object) checkCopyConditions(ifMatch string, ifNoneMatch string, ifModifiedSince time.Time, ifUnmodifiedSince time.Time) error {
+	err := o.checkConditions(ifMatch, ifNoneMatch, ifModifiedSince, ifUnmodifiedSince)
+	if ce, ok := err.(common.Error); ok && ce.Code == "NotModified" {
+		return preconditionFailed("x-amz-copy-source-if-none-match or x-amz-copy-source-if-modified-since")
+	}
+	return err
+}
+
+func preconditionFailed(condition string) error {
+	return common.Errorf("PreconditionFailed", "At least one of the pre-conditions you specified did not hold: %v", condition)
+}
+
+// parseRange parses an HTTP byte range header for an object of the given
+// size, returning the offset and length to return. A missing, malformed or
+// multiple range means the whole object; a range that can't be satisfied is
+// an InvalidRange error.
+func parseRange(header string, size int64) (int64, int64, bool, error) {
+	if !strings.HasPrefix(header, "bytes=") || strings.Contains(header, ",") {
+		return 0, size, false, nil
+	}
+	spec := strings.TrimSpace(strings.TrimPrefix(header, "bytes="))
+	dash := strings.IndexByte(spec, '-')
+	if dash < 0 {
+		return 0, size, false, nil
+	}
+	first, last := spec[:dash], spec[dash+1:]
+
+	invalid := common.Errorf("InvalidRange", "The requested range is not satisfiable")
+
+	if first == "" {
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil {
+			return 0, size, false, nil
+		}
+		if n == 0 || size == 0 {
+			return 0, 0, false, invalid
+		}
+		if n > size {
+			n = size
+		}
+		return size - n, n, true, nil
+	}
+
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil {
+		return 0, size, false, nil
+	}
+	end := size - 1
+	if last != "" {
+		if end, err = strconv.ParseInt(last, 10, 64); err != nil || end < start {
+			return 0, size, false, nil
+		}
+		if end > size-1 {
+			end = size - 1
+		}
+	}
+	if start >= size {
+		return 0, 0, false, invalid
+	}
+	return start, end - start + 1, true, nil
+}
+
+// upload is a multipart upload in progress.
+type upload struct {
+	id        string
+	key       string
+	initiated time.Time
+	headers   contentHeaders
+	meta      map[string]string
+	enc       *encryption
+	parts     map[int]*part
+}
+
+// part is an uploaded part.
+type part struct {
+	number   int
+	etag     string
+	sum      []byte
+	modified time.Time
+	segment  *segment
+}
+
+func (p *part) describe() Part {
+	return Part{
+		PartNumber:   p.number,
+		LastModified: timestamp(p.modified),
+		ETag:         p.etag,
+		Size:         p.segment.size,
+	}
+}
+
+func (u *upload) describe() MultipartUpload {
+	return MultipartUpload{
+		Key:          u.key,
+		UploadID:     u.id,
+		Initiator:    owner,
+		Owner:        owner,
+		StorageClass: "STANDARD",
+		Initiated:    timestamp(u.initiated),
+	}
+}
+
+// sortedParts returns the upload's parts in order.
+func (u *upload) sortedParts() []*part {
+	out := make([]*part, 0, len(u.parts))
+	for _, p := range u.parts {
+		out = append(out, p)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].number < out[j].number })
+	return out
+}
+
+func (u *upload) segments() []*segment {
+	out := make([]*segment, 0, len(u.parts))
+	for _, p := range u.parts {
+		out = append(out, p.segment)
+	}
+	return out
+}
+
+// listing is a page of a bucket listing: objects, and the common prefixes
+// others were rolled up into. Next is the marker to carry on from.
+type listing struct {
+	objects   []*object
+	prefixes  []string
+	truncated bool
+	next      string
+}
+
+// list lists up to max objects and common prefixes in the bucket, in key
+// order, whose keys start with prefix and come after marker. Keys with the
+// delimiter after the prefix are rolled up into a common prefix ending with
+// it.
+func (b *bucket) list(prefix string, delimiter string, marker string, max int) *listing {
+	keys := make([]string, 0, len(b.objects))
+	for key := range b.objects {
+		if strings.HasPrefix(key, prefix) && key > marker {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	out := &listing{}
+	count := 0
+	for _, key := range keys {
+		name := key
+		rolled := false
+		if delimiter != "" {
+			if i := strings.Index(key[len(prefix):], delimiter); i >= 0 {
+				name = key[:len(prefix)+i+len(delimiter)]
+				rolled = true
+			}
+		}
+
+		if rolled {
+			// The prefix was already given, on this page or an earlier one.
+			if name <= marker || (len(out.prefixes) > 0 && out.prefixes[len(out.prefixes)-1] == name) {
+				continue
+			}
+		}
+
+		if count == max {
+			out.truncated = true
+			break
+		}
+		count++
+		out.next = name
+		if rolled {
+			out.prefixes = append(out.prefixes, name)
+		} else {
+			out.objects = append(out.objects, b.objects[key])
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,198 @@
+package s3
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+
+	"github.com/fernomac/aws-local/pkg/common"
+	"github.com/fernomac/aws-local/pkg/envelope"
+)
+
+// defaultKeyID is the key SSE-KMS uses when a request doesn't name one.
+const defaultKeyID = "alias/aws/s3"
+
+// encryption is how an object, or the parts of an upload, are encrypted.
+// Every object has its own data key: a ciphertext blob from KMS for aws:kms,
+// or a key sealed under the store's master key for AES256. Bucket keys are
+// only reported, not used; every object still calls KMS.
+type encryption struct {
+	algorithm   string
+	keyArn      string
+	context     map[string]string
+	userContext string
+	bucketKey   bool
+	dataKey     []byte
+}
+
+func bucketArn(name string) string {
+	return "arn:aws:s3:::" + name
+}
+
+// encryptionContext binds a data key to the bucket it protects, along with
+// whatever context the request gave.
+func encryptionContext(bucket string, user map[string]string) map[string]string {
+	out := map[string]string{}
+	for k, v := range user {
+		out[k] = v
+	}
+	out["aws:s3:arn"] = bucketArn(bucket)
+	return out
+}
+
+// parseContext decodes an x-amz-server-side-encryption-context header.
+func parseContext(header string) (map[string]string, error) {
+	if header == "" {
+		return nil, nil
+	}
+	invalid := invalidArgument("The header 'x-amz-server-side-encryption-context' shall be Base64-encoded UTF-8 string holding JSON with the encryption context key-value pairs.")
+	raw, err := base64.StdEncoding.DecodeString(header)
+	if err != nil {
+		return nil, invalid
+	}
+	out := map[string]string{}
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return nil, invalid
+	}
+	return out, nil
+}
+
+// kmsCodes are the errors S3 returns for errors from KMS: the KMS code with
+// a "KMS." prefix.
+var kmsCodes envelope.Codes = func(kmsCode string) string {
+	if kmsCode == "" {
+		return "KMS.KMSInvalidStateException"
+	}
+	return "KMS." + kmsCode
+}
+
+// seal encrypts data under a key, binding it to id. The nonce goes first.
+func seal(key []byte, id string, data []byte) ([]byte, error) {
+	nonce, ciphertext, err := envelope.Seal(key, data, []byte(id))
+	if err != nil {
+		return nil, err
+	}
+	return append(nonce, ciphertext...), nil
+}
+
+// open decrypts what seal sealed.
+func open(key []byte, id string, data []byte) ([]byte, error) {
+	if len(data) < envelope.NonceSize {
+		return nil, common.Errorf("InternalError", "Stored data for %v is corrupt.", id)
+	}
+	out, err := envelope.Open(key, data[:envelope.NonceSize], data[envelope.NonceSize:], []byte(id))
+	if err != nil {
+		return nil, common.Errorf("InternalError", "Stored data for %v is corrupt.", id)
+	}
+	return out, nil
+}
+
+// encryptionRequest is what a request asks for: its SSE headers.
+type encryptionRequest struct {
+	algorithm string
+	keyID     string
+	context   string
+	bucketKey *bool
+	customer  string
+}
+
+// newEncryption works out how to encrypt a new object or upload in b, falling
+// back to the bucket's default encryption, and makes its data key. It
+// returns the plaintext data key too. The caller must hold s.lock.
+func (s *s3) newEncryption(b *bucket, req encryptionRequest) (*encryption, []byte, error) {
+	if req.customer != "" {
+		return nil, nil, common.Errorf("NotImplemented", "Server-side encryption with customer-provided keys is not implemented.")
+	}
+
+	algorithm, keyID, bucketKey := req.algorithm, req.keyID, false
+	if algorithm == "" {
+		if keyID != "" || req.context != "" {
+			return nil, nil, invalidArgument("Server Side Encryption with AWS KMS managed key requires HTTP header x-amz-server-side-encryption : aws:kms")
+		}
+		rule := b.encryptionRule()
+		algorithm = rule.ApplyServerSideEncryptionByDefault.SSEAlgorithm
+		keyID = rule.ApplyServerSideEncryptionByDefault.KMSMasterKeyID
+		bucketKey = rule.BucketKeyEnabled
+	} else if req.bucketKey == nil {
+		bucketKey = b.encryptionRule().BucketKeyEnabled
+	}
+	if req.bucketKey != nil {
+		bucketKey = *req.bucketKey
+	}
+
+	switch algorithm {
+	case AES256:
+		if keyID != "" || req.context != "" {
+			return nil, nil, invalidArgument("Server Side Encryption with AWS KMS managed key requires HTTP header x-amz-server-side-encryption : aws:kms")
+		}
+		plaintext := make([]byte, 32)
+		if _, err := rand.Read(plaintext); err != nil {
+			return nil, nil, err
+		}
+		sealed, err := seal(s.masterKey, b.name, plaintext)
+		if err != nil {
+			return nil, nil, err
+		}
+		return &encryption{algorithm: AES256, dataKey: sealed}, plaintext, nil
+
+	case AWSKMS:
+		user, err := parseContext(req.context)
+		if err != nil {
+			return nil, nil, err
+		}
+		if keyID == "" {
+			keyID = defaultKeyID
+		}
+		ctx := encryptionContext(b.name, user)
+		dk, err := envelope.GenerateDataKey(s.kms, keyID, ctx, kmsCodes)
+		if err != nil {
+			return nil, nil, err
+		}
+		blob, err := base64.StdEncoding.DecodeString(dk.Ciphertext)
+		if err != nil {
+			return nil, nil, err
+		}
+		return &encryption{
+			algorithm:   AWSKMS,
+			keyArn:      dk.KeyID,
+			context:     ctx,
+			userContext: req.context,
+			bucketKey:   bucketKey,
+			dataKey:     blob,
+		}, dk.Plaintext, nil
+	}
+
+	return nil, nil, invalidArgument("The encryption method specified is not supported")
+}
+
+// key returns the plaintext data key, asking KMS to decrypt it for aws:kms.
+// The caller must hold s.lock.
+func (s *s3) key(bucket string, e *encryption) ([]byte, error) {
+	if e.algorithm == AES256 {
+		return open(s.masterKey, bucket, e.dataKey)
+	}
+
+	dk, err := envelope.DecryptDataKey(s.kms, base64.StdEncoding.EncodeToString(e.dataKey), e.context, kmsCodes)
+	if err != nil {
+		return nil, err
+	}
+	return dk.Plaintext, nil
+}
+
+// keyID is the x-amz-server-side-encryption-aws-kms-key-id header.
+func (e *encryption) keyID() string {
+	if e.algorithm != AWSKMS {
+		return ""
+	}
+	return e.keyArn
+}
+
+// bucketKeyEnabled is the x-amz-server-side-encryption-bucket-key-enabled
+// header, which is only given when it's true.
+func (e *encryption) bucketKeyEnabled() *bool {
+	if e.algorithm != AWSKMS || !e.bucketKey {
+		return nil
+	}
+	enabled := true
+	return &enabled
+}
@@ -0,0 +1,336 @@
+package s3
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/fernomac/aws-local/pkg/awsrest"
+	"github.com/fernomac/aws-local/pkg/common"
+)
+
+// bind binds a request, reporting bodies that don't parse the way S3 does.
+func bind(req *awsrest.Request, v interface{}) error {
+	if err := unchunk(req); err != nil {
+		return err
+	}
+	if err := req.Bind(v); err != nil {
+		if ce, ok := err.(common.Error); ok && ce.Code == "SerializationException" {
+			return malformedXML()
+		}
+		return err
+	}
+	return nil
+}
+
+// chunked reports whether a request body uses the aws-chunked encoding SigV4
+// streaming uploads are sent in.
+func chunked(header http.Header) bool {
+	return strings.HasPrefix(header.Get("X-Amz-Content-Sha256"), "STREAMING-") ||
+		strings.Contains(header.Get("Content-Encoding"), "aws-chunked")
+}
+
+// unchunk decodes an aws-chunked request body: chunks, each a hex size, an
+// optional ";chunk-signature=...", CRLF, the data and CRLF, ending with an
+// empty chunk and any trailers. Signatures and trailing checksums aren't
+// checked.
+func unchunk(req *awsrest.Request) error {
+	if !chunked(req.Header) {
+		return nil
+	}
+	invalid := common.Errorf("IncompleteBody", "The request body terminated unexpectedly")
+
+	r := bufio.NewReader(bytes.NewReader(req.Body))
+	var out []byte
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return invalid
+		}
+		size := strings.TrimSpace(line)
+		if i := strings.IndexByte(size, ';'); i >= 0 {
+			size = size[:i]
+		}
+		n, err := strconv.ParseInt(size, 16, 64)
+		if err != nil || n < 0 {
+			return invalid
+		}
+		if n == 0 {
+			break
+		}
+		chunk := make([]byte, n)
+		if _, err := io.ReadFull(r, chunk); err != nil {
+			return invalid
+		}
+		out = append(out, chunk...)
+		if crlf, err := r.ReadString('\n'); err != nil || strings.TrimSpace(crlf) != "" {
+			return invalid
+		}
+	}
+
+	if decoded := req.Header.Get("X-Amz-Decoded-Content-Length"); decoded != "" {
+		if n, err := strconv.Atoi(decoded); err != nil || n != len(out) {
+			return invalid
+		}
+	}
+	req.Body = out
+	return nil
+}
+
+// virtualHostBucket returns the bucket a virtual-hosted-style request's host
+// names, e.g. "bucket" for "bucket.s3.localhost.localstack.cloud:4566" or
+// "bucket.localhost:4566", or "" for path-style requests.
+func virtualHostBucket(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(host)
+	if net.ParseIP(host) != nil {
+		return ""
+	}
+	if i := strings.LastIndex(host, ".s3."); i > 0 {
+		return host[:i]
+	}
+	if strings.HasSuffix(host, ".localhost") {
+		bucket := strings.TrimSuffix(host, ".localhost")
+		if bucket != "s3" {
+			return bucket
+		}
+	}
+	return ""
+}
+
+// NewHandler creates a new HTTP handler, notifying the given observers of
+// every call. Requests may name the bucket in the path or, virtual-hosted
+// style, in the host.
+func NewHandler(s3 S3, observers ...common.Observer) http.Handler {
+	router := newRouter(s3, observers)
+
+	return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		if bucket := virtualHostBucket(req.Host); bucket != "" {
+			req.URL.Path = "/" + bucket + req.URL.Path
+			if req.URL.RawPath != "" {
+				req.URL.RawPath = "/" + bucket + req.URL.RawPath
+			}
+		}
+		router.ServeHTTP(resp, req)
+	})
+}
+
+func newRouter(s3 S3, observers []common.Observer) *awsrest.Router {
+	rval := awsrest.NewRouter(awsrest.XML)
+	rval.SetEventSource("s3.amazonaws.com")
+	rval.StatusFor("NoSuchBucket", 404)
+	rval.StatusFor("NoSuchKey", 404)
+	rval.StatusFor("NoSuchUpload", 404)
+	rval.StatusFor("BucketAlreadyOwnedByYou", 409)
+	rval.StatusFor("BucketNotEmpty", 409)
+	rval.StatusFor("NotModified", 304)
+	rval.StatusFor("PreconditionFailed", 412)
+	rval.StatusFor("InvalidRange", 416)
+	rval.StatusFor("InvalidPartNumber", 416)
+	rval.StatusFor("NotImplemented", 501)
+	rval.StatusFor("InternalError", 500)
+	rval.StatusFor("KMS.AccessDeniedException", 403)
+	for _, o := range observers {
+		rval.ObserveWith(o)
+	}
+
+	//
+	// Buckets.
+	//
+
+	rval.HandleWith("ListBuckets", "GET", "/", func(req *awsrest.Request) (interface{}, error) {
+		return s3.ListBuckets(&ListBucketsRequest{})
+	})
+
+	rval.HandleWith("CreateBucket", "PUT", "/{Bucket}", func(req *awsrest.Request) (interface{}, error) {
+		in := CreateBucketRequest{}
+		if err := bind(req, &in); err != nil {
+			return nil, err
+		}
+		return s3.CreateBucket(&in)
+	})
+
+	rval.HandleWith("DeleteBucket", "DELETE", "/{Bucket}", func(req *awsrest.Request) (interface{}, error) {
+		in := DeleteBucketRequest{}
+		if err := bind(req, &in); err != nil {
+			return nil, err
+		}
+		return s3.DeleteBucket(&in)
+	})
+
+	rval.HandleWith("HeadBucket", "HEAD", "/{Bucket}", func(req *awsrest.Request) (interface{}, error) {
+		in := HeadBucketRequest{}
+		if err := bind(req, &in); err != nil {
+			return nil, err
+		}
+		return s3.HeadBucket(&in)
+	})
+
+	rval.HandleWith("GetBucketLocation", "GET", "/{Bucket}?location", func(req *awsrest.Request) (interface{}, error) {
+		in := GetBucketLocationRequest{}
+		if err := bind(req, &in); err != nil {
+			return nil, err
+		}
+		return s3.GetBucketLocation(&in)
+	})
+
+	rval.HandleWith("PutBucketEncryption", "PUT", "/{Bucket}?encryption", func(req *awsrest.Request) (interface{}, error) {
+		in := PutBucketEncryptionRequest{}
+		if err := bind(req, &in); err != nil {
+			return nil, err
+		}
+		return s3.PutBucketEncryption(&in)
+	})
+
+	rval.HandleWith("GetBucketEncryption", "GET", "/{Bucket}?encryption", func(req *awsrest.Request) (interface{}, error) {
+		in := GetBucketEncryptionRequest{}
+		if err := bind(req, &in); err != nil {
+			return nil, err
+		}
+		return s3.GetBucketEncryption(&in)
+	})
+
+	rval.HandleWith("DeleteBucketEncryption", "DELETE", "/{Bucket}?encryption", func(req *awsrest.Request) (interface{}, error) {
+		in := DeleteBucketEncryptionRequest{}
+		if err := bind(req, &in); err != nil {
+			return nil, err
+		}
+		return s3.DeleteBucketEncryption(&in)
+	})
+
+	//
+	// Objects.
+	//
+
+	rval.HandleWith("PutObject", "PUT", "/{Bucket}/{Key+}", func(req *awsrest.Request) (interface{}, error) {
+		if req.Header.Get("X-Amz-Copy-Source") != "" {
+			req.Operation = "CopyObject"
+			in := CopyObjectRequest{}
+			if err := bind(req, &in); err != nil {
+				return nil, err
+			}
+			return s3.CopyObject(&in)
+		}
+		in := PutObjectRequest{}
+		if err := bind(req, &in); err != nil {
+			return nil, err
+		}
+		return s3.PutObject(&in)
+	})
+
+	rval.HandleWith("GetObject", "GET", "/{Bucket}/{Key+}", func(req *awsrest.Request) (interface{}, error) {
+		in := GetObjectRequest{}
+		if err := bind(req, &in); err != nil {
+			return nil, err
+		}
+		return s3.GetObject(&in)
+	})
+
+	rval.HandleWith("HeadObject", "HEAD", "/{Bucket}/{Key+}", func(req *awsrest.Request) (interface{}, error) {
+		in := HeadObjectRequest{}
+		if err := bind(req, &in); err != nil {
+			return nil, err
+		}
+		return s3.HeadObject(&in)
+	})
+
+	rval.HandleWith("DeleteObject", "DELETE", "/{Bucket}/{Key+}", func(req *awsrest.Request) (interface{}, error) {
+		in := DeleteObjectRequest{}
+		if err := bind(req, &in); err != nil {
+			return nil, err
+		}
+		return s3.DeleteObject(&in)
+	})
+
+	rval.HandleWith("DeleteObjects", "POST", "/{Bucket}?delete", func(req *awsrest.Request) (interface{}, error) {
+		in := DeleteObjectsRequest{}
+		if err := bind(req, &in); err != nil {
+			return nil, err
+		}
+		return s3.DeleteObjects(&in)
+	})
+
+	rval.HandleWith("ListObjects", "GET", "/{Bucket}", func(req *awsrest.Request) (interface{}, error) {
+		in := ListObjectsRequest{}
+		if err := bind(req, &in); err != nil {
+			return nil, err
+		}
+		return s3.ListObjects(&in)
+	})
+
+	rval.HandleWith("ListObjectsV2", "GET", "/{Bucket}?list-type=2", func(req *awsrest.Request) (interface{}, error) {
+		in := ListObjectsV2Request{}
+		if err := bind(req, &in); err != nil {
+			return nil, err
+		}
+		return s3.ListObjectsV2(&in)
+	})
+
+	//
+	// Multipart uploads.
+	//
+
+	rval.HandleWith("CreateMultipartUpload", "POST", "/{Bucket}/{Key+}?uploads", func(req *awsrest.Request) (interface{}, error) {
+		in := CreateMultipartUploadRequest{}
+		if err := bind(req, &in); err != nil {
+			return nil, err
+		}
+		return s3.CreateMultipartUpload(&in)
+	})
+
+	rval.HandleWith("UploadPart", "PUT", "/{Bucket}/{Key+}?partNumber&uploadId", func(req *awsrest.Request) (interface{}, error) {
+		if req.Header.Get("X-Amz-Copy-Source") != "" {
+			req.Operation = "UploadPartCopy"
+			in := UploadPartCopyRequest{}
+			if err := bind(req, &in); err != nil {
+				return nil, err
+			}
+			return s3.UploadPartCopy(&in)
+		}
+		in := UploadPartRequest{}
+		if err := bind(req, &in); err != nil {
+			return nil, err
+		}
+		return s3.UploadPart(&in)
+	})
+
+	rval.HandleWith("CompleteMultipartUpload", "POST", "/{Bucket}/{Key+}?uploadId", func(req *awsrest.Request) (interface{}, error) {
+		in := CompleteMultipartUploadRequest{}
+		if err := bind(req, &in); err != nil {
+			return nil, err
+		}
+		return s3.CompleteMultipartUpload(&in)
+	})
+
+	rval.HandleWith("AbortMultipartUpload", "DELETE", "/{Bucket}/{Key+}?uploadId", func(req *awsrest.Request) (interface{}, error) {
+		in := AbortMultipartUploadRequest{}
+		if err := bind(req, &in); err != nil {
+			return nil, err
+		}
+		return s3.AbortMultipartUpload(&in)
+	})
+
+	rval.HandleWith("ListParts", "GET", "/{Bucket}/{Key+}?uploadId", func(req *awsrest.Request) (interface{}, error) {
+		in := ListPartsRequest{}
+		if err := bind(req, &in); err != nil {
+			return nil, err
+		}
+		return s3.ListParts(&in)
+	})
+
+	rval.HandleWith("ListMultipartUploads", "GET", "/{Bucket}?uploads", func(req *awsrest.Request) (interface{}, error) {
+		in := ListMultipartUploadsRequest{}
+		if err := bind(req, &in); err != nil {
+			return nil, err
+		}
+		return s3.ListMultipartUploads(&in)
+	})
+
+	return rval
+}
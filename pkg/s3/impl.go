@@ -0,0 +1,1121 @@
+package s3
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/fernomac/aws-local/pkg/common"
+	"github.com/fernomac/aws-local/pkg/kms"
+)
+
+// Option configures an S3 object.
+type Option func(*s3)
+
+// WithClock sets the clock that stamps buckets, objects and uploads.
+func WithClock(clock common.Clock) Option {
+	return func(s *s3) {
+		s.clock = clock
+	}
+}
+
+// WithEndpoint sets the base URL of the Location of completed multipart
+// uploads, e.g. "http://localhost:4566".
+func WithEndpoint(endpoint string) Option {
+	return func(s *s3) {
+		s.endpoint = strings.TrimSuffix(endpoint, "/")
+	}
+}
+
+// s3 is the object store. Its lock guards everything, and is held while
+// calling KMS and reading and writing segment files.
+type s3 struct {
+	lock      sync.Mutex
+	kms       kms.KMS
+	clock     common.Clock
+	endpoint  string
+	store     *store
+	masterKey []byte
+	buckets   map[string]*bucket
+}
+
+// New creates a new S3 that encrypts objects through the given KMS and keeps
+// their data in the given directory.
+func New(k kms.KMS, dir string, opts ...Option) (S3, error) {
+	st, err := newStore(dir)
+	if err != nil {
+		return nil, err
+	}
+	masterKey := make([]byte, 32)
+	if _, err := rand.Read(masterKey); err != nil {
+		return nil, err
+	}
+
+	rval := &s3{
+		kms:       k,
+		clock:     common.SystemClock,
+		endpoint:  "http://localhost:4566",
+		store:     st,
+		masterKey: masterKey,
+		buckets:   make(map[string]*bucket),
+	}
+	for _, opt := range opts {
+		opt(rval)
+	}
+	return rval, nil
+}
+
+func malformedXML() error {
+	return common.Errorf("MalformedXML", "The XML you provided was not well-formed or did not validate against our published schema")
+}
+
+// bucket looks up a bucket. The caller must hold s.lock.
+func (s *s3) bucket(name string) (*bucket, error) {
+	b, ok := s.buckets[name]
+	if !ok {
+		return nil, noSuchBucket()
+	}
+	return b, nil
+}
+
+// object looks up an object. The caller must hold s.lock.
+func (s *s3) object(bucketName string, key string) (*bucket, *object, error) {
+	b, err := s.bucket(bucketName)
+	if err != nil {
+		return nil, nil, err
+	}
+	o, ok := b.objects[key]
+	if !ok {
+		return nil, nil, noSuchKey()
+	}
+	return b, o, nil
+}
+
+// upload looks up a multipart upload of a key. The caller must hold s.lock.
+func (s *s3) upload(bucketName string, key string, uploadID string) (*bucket, *upload, error) {
+	b, err := s.bucket(bucketName)
+	if err != nil {
+		return nil, nil, err
+	}
+	u, ok := b.uploads[uploadID]
+	if !ok || u.key != key {
+		return nil, nil, noSuchUpload()
+	}
+	return b, u, nil
+}
+
+// replace puts an object in a bucket, removing the data of the object it
+// replaces. The caller must hold s.lock.
+func (s *s3) replace(b *bucket, o *object) {
+	if old, ok := b.objects[o.key]; ok {
+		s.store.remove(old.segments...)
+	}
+	b.objects[o.key] = o
+}
+
+// read reads length bytes of an object's data from offset, decrypting only
+// the segments it needs. The caller must hold s.lock.
+func (s *s3) read(b *bucket, o *object, offset int64, length int64) ([]byte, error) {
+	key, err := s.key(b.name, o.enc)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, 0, length)
+	pos := int64(0)
+	for _, seg := range o.segments {
+		start, end := pos, pos+seg.size
+		pos = end
+		if end <= offset || start >= offset+length {
+			continue
+		}
+		data, err := s.store.read(key, seg)
+		if err != nil {
+			return nil, err
+		}
+		lo, hi := offset-start, offset+length-start
+		if lo < 0 {
+			lo = 0
+		}
+		if hi > seg.size {
+			hi = seg.size
+		}
+		out = append(out, data[lo:hi]...)
+	}
+	return out, nil
+}
+
+func copyMetadata(meta map[string]string) map[string]string {
+	if len(meta) == 0 {
+		return nil
+	}
+	out := make(map[string]string, len(meta))
+	for k, v := range meta {
+		out[k] = v
+	}
+	return out
+}
+
+// parseCopySource splits an x-amz-copy-source header into a bucket and key.
+func parseCopySource(source string) (string, string, error) {
+	invalid := invalidArgument("Invalid copy source object key")
+	if i := strings.IndexByte(source, '?'); i >= 0 {
+		source = source[:i]
+	}
+	source, err := url.PathUnescape(strings.TrimPrefix(source, "/"))
+	if err != nil {
+		return "", "", invalid
+	}
+	parts := strings.SplitN(source, "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", invalid
+	}
+	return parts[0], parts[1], nil
+}
+
+// maxKeys applies the default and limit to a max-keys parameter.
+func maxKeys(n *int, name string) (int, error) {
+	if n == nil {
+		return maxListKeys, nil
+	}
+	if *n < 0 {
+		return 0, invalidArgument("Argument %v must be an integer between 0 and 2147483647", name)
+	}
+	if *n > maxListKeys {
+		return maxListKeys, nil
+	}
+	return *n, nil
+}
+
+// encoder returns the function keys and prefixes in a listing are encoded
+// with, given its encoding-type parameter.
+func encoder(encodingType string) (func(string) string, error) {
+	switch encodingType {
+	case "":
+		return func(str string) string { return str }, nil
+	case "url":
+		return url.QueryEscape, nil
+	}
+	return nil, invalidArgument("Invalid Encoding Method specified in Request")
+}
+
+//
+// Buckets.
+//
+
+func (s *s3) CreateBucket(req *CreateBucketRequest) (*CreateBucketResult, error) {
+	if err := validateBucketName(req.Bucket); err != nil {
+		return nil, err
+	}
+	location := common.Region
+	if req.Configuration != nil && req.Configuration.LocationConstraint != "" {
+		location = req.Configuration.LocationConstraint
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, ok := s.buckets[req.Bucket]; ok {
+		return nil, common.Errorf("BucketAlreadyOwnedByYou", "Your previous request to create the named bucket succeeded and you already own it.")
+	}
+	s.buckets[req.Bucket] = newBucket(req.Bucket, location, s.clock.Now())
+
+	return &CreateBucketResult{Location: "/" + req.Bucket}, nil
+}
+
+func (s *s3) DeleteBucket(req *DeleteBucketRequest) (*DeleteBucketResult, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	b, err := s.bucket(req.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	if len(b.objects) > 0 {
+		return nil, common.Errorf("BucketNotEmpty", "The bucket you tried to delete is not empty")
+	}
+	for _, u := range b.uploads {
+		s.store.remove(u.segments()...)
+	}
+	delete(s.buckets, req.Bucket)
+
+	return &DeleteBucketResult{StatusCode: 204}, nil
+}
+
+func (s *s3) HeadBucket(req *HeadBucketRequest) (*HeadBucketResult, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	b, err := s.bucket(req.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	return &HeadBucketResult{BucketRegion: b.location}, nil
+}
+
+func (s *s3) ListBuckets(req *ListBucketsRequest) (*ListBucketsResult, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	out := &ListBucketsResult{Owner: owner, Buckets: []Bucket{}}
+	for _, b := range s.buckets {
+		out.Buckets = append(out.Buckets, Bucket{Name: b.name, CreationDate: timestamp(b.created)})
+	}
+	sort.Slice(out.Buckets, func(i, j int) bool { return out.Buckets[i].Name < out.Buckets[j].Name })
+	return out, nil
+}
+
+func (s *s3) GetBucketLocation(req *GetBucketLocationRequest) (*GetBucketLocationResult, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	b, err := s.bucket(req.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	return &GetBucketLocationResult{LocationConstraint: b.location}, nil
+}
+
+func (s *s3) PutBucketEncryption(req *PutBucketEncryptionRequest) (*PutBucketEncryptionResult, error) {
+	c := req.Configuration
+	if c == nil || len(c.Rules) != 1 || c.Rules[0].ApplyServerSideEncryptionByDefault == nil {
+		return nil, malformedXML()
+	}
+	rule := c.Rules[0]
+	def := *rule.ApplyServerSideEncryptionByDefault
+	switch def.SSEAlgorithm {
+	case AES256:
+		if def.KMSMasterKeyID != "" {
+			return nil, invalidArgument("a KMSMasterKeyID is not applicable if the default sse algorithm is not aws:kms")
+		}
+	case AWSKMS:
+	default:
+		return nil, malformedXML()
+	}
+	rule.ApplyServerSideEncryptionByDefault = &def
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	b, err := s.bucket(req.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	b.rule = &rule
+
+	return &PutBucketEncryptionResult{}, nil
+}
+
+func (s *s3) GetBucketEncryption(req *GetBucketEncryptionRequest) (*GetBucketEncryptionResult, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	b, err := s.bucket(req.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	return &GetBucketEncryptionResult{
+		Configuration: &ServerSideEncryptionConfiguration{
+			XMLName: xml.Name{Space: namespace, Local: "ServerSideEncryptionConfiguration"},
+			Rules:   []ServerSideEncryptionRule{*b.encryptionRule()},
+		},
+	}, nil
+}
+
+func (s *s3) DeleteBucketEncryption(req *DeleteBucketEncryptionRequest) (*DeleteBucketEncryptionResult, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	b, err := s.bucket(req.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	b.rule = nil
+
+	return &DeleteBucketEncryptionResult{StatusCode: 204}, nil
+}
+
+//
+// Objects.
+//
+
+func (s *s3) PutObject(req *PutObjectRequest) (*PutObjectResult, error) {
+	if err := validateKey(req.Key); err != nil {
+		return nil, err
+	}
+	if err := validateMetadata(req.Metadata); err != nil {
+		return nil, err
+	}
+	if err := checkDigest(req.ContentMD5, req.Body); err != nil {
+		return nil, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	b, err := s.bucket(req.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	enc, key, err := s.newEncryption(b, encryptionRequest{
+		algorithm: req.ServerSideEncryption,
+		keyID:     req.SSEKMSKeyID,
+		context:   req.SSEKMSEncryptionContext,
+		bucketKey: req.BucketKeyEnabled,
+		customer:  req.SSECustomerAlgorithm,
+	})
+	if err != nil {
+		return nil, err
+	}
+	seg, err := s.store.write(key, req.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := md5.Sum(req.Body)
+	o := &object{
+		key:      req.Key,
+		etag:     etag(sum[:]),
+		size:     int64(len(req.Body)),
+		modified: s.clock.Now(),
+		headers: contentHeaders{
+			cacheControl:       req.CacheControl,
+			contentDisposition: req.ContentDisposition,
+			contentEncoding:    withoutChunked(req.ContentEncoding),
+			contentLanguage:    req.ContentLanguage,
+			contentType:        req.ContentType,
+			expires:            req.Expires,
+		},
+		meta:     copyMetadata(req.Metadata),
+		enc:      enc,
+		segments: []*segment{seg},
+	}
+	s.replace(b, o)
+
+	return &PutObjectResult{
+		ETag:                    o.etag,
+		ServerSideEncryption:    enc.algorithm,
+		SSEKMSKeyID:             enc.keyID(),
+		SSEKMSEncryptionContext: enc.userContext,
+		BucketKeyEnabled:        enc.bucketKeyEnabled(),
+	}, nil
+}
+
+func (s *s3) CopyObject(req *CopyObjectRequest) (*CopyObjectResult, error) {
+	if err := validateKey(req.Key); err != nil {
+		return nil, err
+	}
+	srcBucket, srcKey, err := parseCopySource(req.CopySource)
+	if err != nil {
+		return nil, err
+	}
+	directive := req.MetadataDirective
+	switch directive {
+	case "":
+		directive = "COPY"
+	case "COPY":
+	case "REPLACE":
+		if err := validateMetadata(req.Metadata); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, invalidArgument("Unknown metadata directive.")
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	sb, src, err := s.object(srcBucket, srcKey)
+	if err != nil {
+		return nil, err
+	}
+	if err := src.checkCopyConditions(req.CopySourceIfMatch, req.CopySourceIfNoneMatch, req.CopySourceIfModifiedSince, req.CopySourceIfUnmodifiedSince); err != nil {
+		return nil, err
+	}
+	b, err := s.bucket(req.Bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	changesEncryption := req.ServerSideEncryption != "" || req.SSEKMSKeyID != "" || req.BucketKeyEnabled != nil
+	if srcBucket == req.Bucket && srcKey == req.Key && directive == "COPY" && !changesEncryption {
+		return nil, common.Errorf("InvalidRequest", "This copy request is illegal because it is trying to copy an object to itself without changing the object's metadata, storage class, website redirect location or encryption attributes.")
+	}
+
+	data, err := s.read(sb, src, 0, src.size)
+	if err != nil {
+		return nil, err
+	}
+	enc, key, err := s.newEncryption(b, encryptionRequest{
+		algorithm: req.ServerSideEncryption,
+		keyID:     req.SSEKMSKeyID,
+		context:   req.SSEKMSEncryptionContext,
+		bucketKey: req.BucketKeyEnabled,
+		customer:  req.SSECustomerAlgorithm,
+	})
+	if err != nil {
+		return nil, err
+	}
+	seg, err := s.store.write(key, data)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := md5.Sum(data)
+	o := &object{
+		key:      req.Key,
+		etag:     etag(sum[:]),
+		size:     int64(len(data)),
+		modified: s.clock.Now(),
+		headers:  src.headers,
+		meta:     copyMetadata(src.meta),
+		enc:      enc,
+		segments: []*segment{seg},
+	}
+	if directive == "REPLACE" {
+		o.headers = contentHeaders{
+			cacheControl:       req.CacheControl,
+			contentDisposition: req.ContentDisposition,
+			contentEncoding:    req.ContentEncoding,
+			contentLanguage:    req.ContentLanguage,
+			contentType:        req.ContentType,
+			expires:            req.Expires,
+		}
+		o.meta = copyMetadata(req.Metadata)
+	}
+	s.replace(b, o)
+
+	return &CopyObjectResult{
+		Result: &CopyObjectResultBody{
+			ETag:         o.etag,
+			LastModified: timestamp(o.modified),
+		},
+		ServerSideEncryption:    enc.algorithm,
+		SSEKMSKeyID:             enc.keyID(),
+		SSEKMSEncryptionContext: enc.userContext,
+		BucketKeyEnabled:        enc.bucketKeyEnabled(),
+	}, nil
+}
+
+func (s *s3) GetObject(req *GetObjectRequest) (*GetObjectResult, error) {
+	return s.get(req, true)
+}
+
+func (s *s3) HeadObject(req *HeadObjectRequest) (*HeadObjectResult, error) {
+	out, err := s.get((*GetObjectRequest)(req), false)
+	return (*HeadObjectResult)(out), err
+}
+
+// get gets an object, reading and decrypting its data only if body is set:
+// HeadObject doesn't call KMS.
+func (s *s3) get(req *GetObjectRequest, body bool) (*GetObjectResult, error) {
+	if req.PartNumber != nil && req.Range != "" {
+		return nil, invalidArgument("Cannot specify both Range header and partNumber query parameter")
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	b, o, err := s.object(req.Bucket, req.Key)
+	if err != nil {
+		return nil, err
+	}
+	if err := o.checkConditions(req.IfMatch, req.IfNoneMatch, req.IfModifiedSince, req.IfUnmodifiedSince); err != nil {
+		return nil, err
+	}
+
+	offset, length, partial := int64(0), o.size, false
+	if req.PartNumber != nil {
+		var ok bool
+		if offset, length, ok = o.part(*req.PartNumber); !ok {
+			return nil, common.Errorf("InvalidPartNumber", "The requested partnumber is not satisfiable")
+		}
+		partial = true
+	} else if offset, length, partial, err = parseRange(req.Range, o.size); err != nil {
+		return nil, err
+	}
+
+	out := &GetObjectResult{
+		AcceptRanges:            "bytes",
+		CacheControl:            o.headers.cacheControl,
+		ContentDisposition:      o.headers.contentDisposition,
+		ContentEncoding:         o.headers.contentEncoding,
+		ContentLanguage:         o.headers.contentLanguage,
+		ContentLength:           length,
+		ContentType:             o.headers.contentType,
+		ETag:                    o.etag,
+		Expires:                 o.headers.expires,
+		LastModified:            o.modified,
+		Metadata:                copyMetadata(o.meta),
+		ServerSideEncryption:    o.enc.algorithm,
+		SSEKMSKeyID:             o.enc.keyID(),
+		SSEKMSEncryptionContext: o.enc.userContext,
+		BucketKeyEnabled:        o.enc.bucketKeyEnabled(),
+	}
+	if out.ContentType == "" {
+		out.ContentType = "binary/octet-stream"
+	}
+	if partial {
+		out.StatusCode = 206
+		out.ContentRange = fmt.Sprintf("bytes %d-%d/%d", offset, offset+length-1, o.size)
+	}
+	if o.parts > 0 {
+		parts := o.parts
+		out.PartsCount = &parts
+	}
+
+	for value, override := range map[*string]string{
+		&out.CacheControl:       req.ResponseCacheControl,
+		&out.ContentDisposition: req.ResponseContentDisposition,
+		&out.ContentEncoding:    req.ResponseContentEncoding,
+		&out.ContentLanguage:    req.ResponseContentLanguage,
+		&out.ContentType:        req.ResponseContentType,
+		&out.Expires:            req.ResponseExpires,
+	} {
+		if override != "" {
+			*value = override
+		}
+	}
+
+	if body {
+		data, err := s.read(b, o, offset, length)
+		if err != nil {
+			return nil, err
+		}
+		out.Body = bytes.NewReader(data)
+	}
+
+	return out, nil
+}
+
+func (s *s3) DeleteObject(req *DeleteObjectRequest) (*DeleteObjectResult, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	b, err := s.bucket(req.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	if o, ok := b.objects[req.Key]; ok {
+		s.store.remove(o.segments...)
+		delete(b.objects, req.Key)
+	}
+
+	return &DeleteObjectResult{StatusCode: 204}, nil
+}
+
+func (s *s3) DeleteObjects(req *DeleteObjectsRequest) (*DeleteObjectsResult, error) {
+	if req.Delete == nil || len(req.Delete.Objects) == 0 || len(req.Delete.Objects) > maxDeleteKeys {
+		return nil, malformedXML()
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	b, err := s.bucket(req.Bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &DeleteObjectsResult{}
+	for _, id := range req.Delete.Objects {
+		if o, ok := b.objects[id.Key]; ok {
+			s.store.remove(o.segments...)
+			delete(b.objects, id.Key)
+		}
+		if !req.Delete.Quiet {
+			out.Deleted = append(out.Deleted, DeletedObject{Key: id.Key})
+		}
+	}
+	return out, nil
+}
+
+func (s *s3) ListObjects(req *ListObjectsRequest) (*ListObjectsResult, error) {
+	max, err := maxKeys(req.MaxKeys, "max-keys")
+	if err != nil {
+		return nil, err
+	}
+	encode, err := encoder(req.EncodingType)
+	if err != nil {
+		return nil, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	b, err := s.bucket(req.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	l := b.list(req.Prefix, req.Delimiter, req.Marker, max)
+
+	out := &ListObjectsResult{
+		Name:         b.name,
+		Prefix:       encode(req.Prefix),
+		Marker:       encode(req.Marker),
+		MaxKeys:      max,
+		Delimiter:    encode(req.Delimiter),
+		IsTruncated:  l.truncated,
+		EncodingType: req.EncodingType,
+	}
+	if l.truncated && req.Delimiter != "" {
+		out.NextMarker = encode(l.next)
+	}
+	for _, o := range l.objects {
+		obj := o.describe(true)
+		obj.Key = encode(obj.Key)
+		out.Contents = append(out.Contents, obj)
+	}
+	for _, prefix := range l.prefixes {
+		out.CommonPrefixes = append(out.CommonPrefixes, CommonPrefix{Prefix: encode(prefix)})
+	}
+	return out, nil
+}
+
+func (s *s3) ListObjectsV2(req *ListObjectsV2Request) (*ListObjectsV2Result, error) {
+	max, err := maxKeys(req.MaxKeys, "max-keys")
+	if err != nil {
+		return nil, err
+	}
+	encode, err := encoder(req.EncodingType)
+	if err != nil {
+		return nil, err
+	}
+
+	marker := req.StartAfter
+	if req.ContinuationToken != "" {
+		raw, err := base64.StdEncoding.DecodeString(req.ContinuationToken)
+		if err != nil {
+			return nil, invalidArgument("The continuation token provided is incorrect")
+		}
+		marker = string(raw)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	b, err := s.bucket(req.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	l := b.list(req.Prefix, req.Delimiter, marker, max)
+
+	out := &ListObjectsV2Result{
+		Name:              b.name,
+		Prefix:            encode(req.Prefix),
+		StartAfter:        encode(req.StartAfter),
+		ContinuationToken: req.ContinuationToken,
+		KeyCount:          len(l.objects) + len(l.prefixes),
+		MaxKeys:           max,
+		Delimiter:         encode(req.Delimiter),
+		IsTruncated:       l.truncated,
+		EncodingType:      req.EncodingType,
+	}
+	if l.truncated {
+		out.NextContinuationToken = base64.StdEncoding.EncodeToString([]byte(l.next))
+	}
+	for _, o := range l.objects {
+		obj := o.describe(req.FetchOwner)
+		obj.Key = encode(obj.Key)
+		out.Contents = append(out.Contents, obj)
+	}
+	for _, prefix := range l.prefixes {
+		out.CommonPrefixes = append(out.CommonPrefixes, CommonPrefix{Prefix: encode(prefix)})
+	}
+	return out, nil
+}
+
+//
+// Multipart uploads.
+//
+
+func (s *s3) CreateMultipartUpload(req *CreateMultipartUploadRequest) (*CreateMultipartUploadResult, error) {
+	if err := validateKey(req.Key); err != nil {
+		return nil, err
+	}
+	if err := validateMetadata(req.Metadata); err != nil {
+		return nil, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	b, err := s.bucket(req.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	enc, _, err := s.newEncryption(b, encryptionRequest{
+		algorithm: req.ServerSideEncryption,
+		keyID:     req.SSEKMSKeyID,
+		context:   req.SSEKMSEncryptionContext,
+		bucketKey: req.BucketKeyEnabled,
+		customer:  req.SSECustomerAlgorithm,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	u := &upload{
+		id:        randomID(),
+		key:       req.Key,
+		initiated: s.clock.Now(),
+		headers: contentHeaders{
+			cacheControl:       req.CacheControl,
+			contentDisposition: req.ContentDisposition,
+			contentEncoding:    req.ContentEncoding,
+			contentLanguage:    req.ContentLanguage,
+			contentType:        req.ContentType,
+			expires:            req.Expires,
+		},
+		meta:  copyMetadata(req.Metadata),
+		enc:   enc,
+		parts: map[int]*part{},
+	}
+	b.uploads[u.id] = u
+
+	return &CreateMultipartUploadResult{
+		Result: &InitiateMultipartUploadResult{
+			Bucket:   b.name,
+			Key:      u.key,
+			UploadID: u.id,
+		},
+		ServerSideEncryption:    enc.algorithm,
+		SSEKMSKeyID:             enc.keyID(),
+		SSEKMSEncryptionContext: enc.userContext,
+		BucketKeyEnabled:        enc.bucketKeyEnabled(),
+	}, nil
+}
+
+func validatePartNumber(n int) error {
+	if n < 1 || n > maxPartNumber {
+		return invalidArgument("Part number must be an integer between 1 and %v, inclusive", maxPartNumber)
+	}
+	return nil
+}
+
+// putPart encrypts a part under the upload's data key, replacing any part
+// with the same number. The caller must hold s.lock.
+func (s *s3) putPart(b *bucket, u *upload, number int, data []byte) (*part, error) {
+	key, err := s.key(b.name, u.enc)
+	if err != nil {
+		return nil, err
+	}
+	seg, err := s.store.write(key, data)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := md5.Sum(data)
+	p := &part{
+		number:   number,
+		etag:     etag(sum[:]),
+		sum:      sum[:],
+		modified: s.clock.Now(),
+		segment:  seg,
+	}
+	if old, ok := u.parts[number]; ok {
+		s.store.remove(old.segment)
+	}
+	u.parts[number] = p
+	return p, nil
+}
+
+func (s *s3) UploadPart(req *UploadPartRequest) (*UploadPartResult, error) {
+	if err := validatePartNumber(req.PartNumber); err != nil {
+		return nil, err
+	}
+	if err := checkDigest(req.ContentMD5, req.Body); err != nil {
+		return nil, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	b, u, err := s.upload(req.Bucket, req.Key, req.UploadID)
+	if err != nil {
+		return nil, err
+	}
+	p, err := s.putPart(b, u, req.PartNumber, req.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return &UploadPartResult{
+		ETag:                 p.etag,
+		ServerSideEncryption: u.enc.algorithm,
+		SSEKMSKeyID:          u.enc.keyID(),
+		BucketKeyEnabled:     u.enc.bucketKeyEnabled(),
+	}, nil
+}
+
+// parseCopyRange parses an x-amz-copy-source-range header, which unlike a
+// Range header must give both ends and lie within the source.
+func parseCopyRange(header string, size int64) (int64, int64, error) {
+	if header == "" {
+		return 0, size, nil
+	}
+	spec := strings.TrimPrefix(header, "bytes=")
+	ends := strings.SplitN(spec, "-", 2)
+	if spec == header || len(ends) != 2 {
+		return 0, 0, invalidArgument("The x-amz-copy-source-range value must be of the form bytes=first-last where first and last are the zero-based offsets of the first and last bytes to copy")
+	}
+	first, err1 := strconv.ParseInt(ends[0], 10, 64)
+	last, err2 := strconv.ParseInt(ends[1], 10, 64)
+	if err1 != nil || err2 != nil || first < 0 || last < first {
+		return 0, 0, invalidArgument("The x-amz-copy-source-range value must be of the form bytes=first-last where first and last are the zero-based offsets of the first and last bytes to copy")
+	}
+	if last >= size {
+		return 0, 0, invalidArgument("Range specified is not valid for source object of size: %v", size)
+	}
+	return first, last - first + 1, nil
+}
+
+func (s *s3) UploadPartCopy(req *UploadPartCopyRequest) (*UploadPartCopyResult, error) {
+	if err := validatePartNumber(req.PartNumber); err != nil {
+		return nil, err
+	}
+	srcBucket, srcKey, err := parseCopySource(req.CopySource)
+	if err != nil {
+		return nil, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	b, u, err := s.upload(req.Bucket, req.Key, req.UploadID)
+	if err != nil {
+		return nil, err
+	}
+	sb, src, err := s.object(srcBucket, srcKey)
+	if err != nil {
+		return nil, err
+	}
+	if err := src.checkCopyConditions(req.CopySourceIfMatch, req.CopySourceIfNoneMatch, req.CopySourceIfModifiedSince, req.CopySourceIfUnmodifiedSince); err != nil {
+		return nil, err
+	}
+	offset, length, err := parseCopyRange(req.CopySourceRange, src.size)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := s.read(sb, src, offset, length)
+	if err != nil {
+		return nil, err
+	}
+	p, err := s.putPart(b, u, req.PartNumber, data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &UploadPartCopyResult{
+		Result: &CopyPartResult{
+			ETag:         p.etag,
+			LastModified: timestamp(p.modified),
+		},
+		ServerSideEncryption: u.enc.algorithm,
+		SSEKMSKeyID:          u.enc.keyID(),
+		BucketKeyEnabled:     u.enc.bucketKeyEnabled(),
+	}, nil
+}
+
+func (s *s3) CompleteMultipartUpload(req *CompleteMultipartUploadRequest) (*CompleteMultipartUploadResult, error) {
+	if req.MultipartUpload == nil || len(req.MultipartUpload.Parts) == 0 {
+		return nil, malformedXML()
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	b, u, err := s.upload(req.Bucket, req.Key, req.UploadID)
+	if err != nil {
+		return nil, err
+	}
+
+	wanted := req.MultipartUpload.Parts
+	chosen := make([]*part, 0, len(wanted))
+	for i, cp := range wanted {
+		if i > 0 && cp.PartNumber <= wanted[i-1].PartNumber {
+			return nil, common.Errorf("InvalidPartOrder", "The list of parts was not in ascending order. Parts must be ordered by part number.")
+		}
+		p, ok := u.parts[cp.PartNumber]
+		if !ok || !sameETag(p.etag, cp.ETag) {
+			return nil, common.Errorf("InvalidPart", "One or more of the specified parts could not be found. The part may not have been uploaded, or the specified entity tag may not match the part's entity tag.")
+		}
+		chosen = append(chosen, p)
+	}
+	for _, p := range chosen[:len(chosen)-1] {
+		if p.segment.size < minPartSize {
+			return nil, common.Errorf("EntityTooSmall", "Your proposed upload is smaller than the minimum allowed object size.")
+		}
+	}
+
+	var sums []byte
+	size := int64(0)
+	segments := make([]*segment, 0, len(chosen))
+	used := map[int]bool{}
+	for _, p := range chosen {
+		sums = append(sums, p.sum...)
+		size += p.segment.size
+		segments = append(segments, p.segment)
+		used[p.number] = true
+	}
+	for n, p := range u.parts {
+		if !used[n] {
+			s.store.remove(p.segment)
+		}
+	}
+	sum := md5.Sum(sums)
+
+	o := &object{
+		key:      u.key,
+		etag:     fmt.Sprintf(`"%v-%v"`, hex.EncodeToString(sum[:]), len(chosen)),
+		size:     size,
+		modified: s.clock.Now(),
+		headers:  u.headers,
+		meta:     u.meta,
+		enc:      u.enc,
+		segments: segments,
+		parts:    len(chosen),
+	}
+	s.replace(b, o)
+	delete(b.uploads, u.id)
+
+	location := s.endpoint + "/" + b.name + "/" + (&url.URL{Path: o.key}).EscapedPath()
+	return &CompleteMultipartUploadResult{
+		Result: &CompleteMultipartUploadResultBody{
+			Location: location,
+			Bucket:   b.name,
+			Key:      o.key,
+			ETag:     o.etag,
+		},
+		ServerSideEncryption: o.enc.algorithm,
+		SSEKMSKeyID:          o.enc.keyID(),
+		BucketKeyEnabled:     o.enc.bucketKeyEnabled(),
+	}, nil
+}
+
+func (s *s3) AbortMultipartUpload(req *AbortMultipartUploadRequest) (*AbortMultipartUploadResult, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	b, u, err := s.upload(req.Bucket, req.Key, req.UploadID)
+	if err != nil {
+		return nil, err
+	}
+	s.store.remove(u.segments()...)
+	delete(b.uploads, u.id)
+
+	return &AbortMultipartUploadResult{StatusCode: 204}, nil
+}
+
+func (s *s3) ListParts(req *ListPartsRequest) (*ListPartsResult, error) {
+	max, err := maxKeys(req.MaxParts, "max-parts")
+	if err != nil {
+		return nil, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	b, u, err := s.upload(req.Bucket, req.Key, req.UploadID)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &ListPartsResult{
+		Bucket:           b.name,
+		Key:              u.key,
+		UploadID:         u.id,
+		Initiator:        owner,
+		Owner:            owner,
+		StorageClass:     "STANDARD",
+		PartNumberMarker: req.PartNumberMarker,
+		MaxParts:         max,
+	}
+	for _, p := range u.sortedParts() {
+		if p.number <= req.PartNumberMarker {
+			continue
+		}
+		if len(out.Parts) == max {
+			out.IsTruncated = true
+			break
+		}
+		out.Parts = append(out.Parts, p.describe())
+		out.NextPartNumberMarker = p.number
+	}
+	return out, nil
+}
+
+func (s *s3) ListMultipartUploads(req *ListMultipartUploadsRequest) (*ListMultipartUploadsResult, error) {
+	max, err := maxKeys(req.MaxUploads, "max-uploads")
+	if err != nil {
+		return nil, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	b, err := s.bucket(req.Bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	uploads := make([]*upload, 0, len(b.uploads))
+	for _, u := range b.uploads {
+		if strings.HasPrefix(u.key, req.Prefix) {
+			uploads = append(uploads, u)
+		}
+	}
+	sort.Slice(uploads, func(i, j int) bool {
+		a, b := uploads[i], uploads[j]
+		if a.key != b.key {
+			return a.key < b.key
+		}
+		if !a.initiated.Equal(b.initiated) {
+			return a.initiated.Before(b.initiated)
+		}
+		return a.id < b.id
+	})
+
+	out := &ListMultipartUploadsResult{
+		Bucket:         b.name,
+		KeyMarker:      req.KeyMarker,
+		UploadIDMarker: req.UploadIDMarker,
+		Prefix:         req.Prefix,
+		MaxUploads:     max,
+	}
+
+	// Uploads of the marker key come after the marker upload, or not at all
+	// if there's no upload ID marker.
+	passed := req.UploadIDMarker == ""
+	for _, u := range uploads {
+		if u.key < req.KeyMarker {
+			continue
+		}
+		if u.key == req.KeyMarker && req.KeyMarker != "" {
+			if !passed {
+				passed = u.id == req.UploadIDMarker
+			}
+			if req.UploadIDMarker == "" || u.id == req.UploadIDMarker || !passed {
+				continue
+			}
+		}
+		if len(out.Uploads) == max {
+			out.IsTruncated = true
+			break
+		}
+		out.Uploads = append(out.Uploads, u.describe())
+		out.NextKeyMarker = u.key
+		out.NextUploadIDMarker = u.id
+	}
+	return out, nil
+}
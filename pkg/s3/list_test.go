@@ -0,0 +1,158 @@
+package s3_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/fernomac/aws-local/pkg/common"
+	"github.com/fernomac/aws-local/pkg/kms"
+	"github.com/fernomac/aws-local/pkg/s3"
+)
+
+var testKeys = []string{"a", "b/1", "b/2", "b/3", "c", "d/x", "e"}
+
+func newTestBucket(t *testing.T) s3.S3 {
+	s, err := s3.New(kms.New(), t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.CreateBucket(&s3.CreateBucketRequest{Bucket: "bucket"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range testKeys {
+		if _, err := s.PutObject(&s3.PutObjectRequest{Bucket: "bucket", Key: key, Body: []byte(key)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return s
+}
+
+func intPtr(i int) *int {
+	return &i
+}
+
+func TestListObjectsV2Pages(t *testing.T) {
+	s := newTestBucket(t)
+
+	tests := []struct {
+		name       string
+		maxKeys    int
+		prefix     string
+		delimiter  string
+		startAfter string
+		want       []string
+		pages      int
+	}{
+		{"one page", 1000, "", "", "", testKeys, 1},
+		{"exact fit", 7, "", "", "", testKeys, 1},
+		{"pages of one", 1, "", "", "", testKeys, 7},
+		{"pages of three", 3, "", "", "", testKeys, 3},
+		{"prefix", 2, "b/", "", "", []string{"b/1", "b/2", "b/3"}, 2},
+		{"start after", 2, "", "", "b/2", []string{"b/3", "c", "d/x", "e"}, 2},
+		{"start after everything", 2, "", "", "z", nil, 1},
+		{"delimiter", 1000, "", "/", "", []string{"a", "b/", "c", "d/", "e"}, 1},
+		{"delimiter pages of one", 1, "", "/", "", []string{"a", "b/", "c", "d/", "e"}, 5},
+		{"delimiter pages of two", 2, "", "/", "", []string{"a", "b/", "c", "d/", "e"}, 3},
+		{"delimiter start after", 2, "", "/", "a", []string{"b/", "c", "d/", "e"}, 2},
+	}
+
+	for _, test := range tests {
+		req := &s3.ListObjectsV2Request{
+			Bucket:     "bucket",
+			MaxKeys:    intPtr(test.maxKeys),
+			Prefix:     test.prefix,
+			Delimiter:  test.delimiter,
+			StartAfter: test.startAfter,
+		}
+
+		var got []string
+		pages := 0
+		for {
+			out, err := s.ListObjectsV2(req)
+			if err != nil {
+				t.Fatalf("%v: %v", test.name, err)
+			}
+			pages++
+			if pages > len(testKeys)+1 {
+				t.Fatalf("%v: too many pages", test.name)
+			}
+			if out.KeyCount != len(out.Contents)+len(out.CommonPrefixes) || out.KeyCount > test.maxKeys {
+				t.Errorf("%v: page %v has KeyCount %v", test.name, pages, out.KeyCount)
+			}
+			if out.ContinuationToken != req.ContinuationToken || out.StartAfter != test.startAfter {
+				t.Errorf("%v: page %v echoes %q and %q", test.name, pages, out.ContinuationToken, out.StartAfter)
+			}
+
+			// Keys and common prefixes come back interleaved in key order.
+			i, j := 0, 0
+			for i < len(out.Contents) || j < len(out.CommonPrefixes) {
+				if j == len(out.CommonPrefixes) || (i < len(out.Contents) && out.Contents[i].Key < out.CommonPrefixes[j].Prefix) {
+					got = append(got, out.Contents[i].Key)
+					i++
+				} else {
+					got = append(got, out.CommonPrefixes[j].Prefix)
+					j++
+				}
+			}
+
+			if out.IsTruncated != (out.NextContinuationToken != "") {
+				t.Errorf("%v: IsTruncated %v with token %q", test.name, out.IsTruncated, out.NextContinuationToken)
+			}
+			if !out.IsTruncated {
+				break
+			}
+			req.ContinuationToken = out.NextContinuationToken
+		}
+
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%v: got %v, want %v", test.name, got, test.want)
+		}
+		if pages != test.pages {
+			t.Errorf("%v: got %v pages, want %v", test.name, pages, test.pages)
+		}
+	}
+}
+
+func TestListObjectsV2Tokens(t *testing.T) {
+	s := newTestBucket(t)
+
+	first, err := s.ListObjectsV2(&s3.ListObjectsV2Request{Bucket: "bucket", MaxKeys: intPtr(2)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		token      string
+		startAfter string
+		want       string
+		code       string
+	}{
+		{"token", first.NextContinuationToken, "", "b/2", ""},
+		{"token beats start after", first.NextContinuationToken, "c", "b/2", ""},
+		{"start after", "", "c", "d/x", ""},
+		{"not base64", "!!!", "", "", "InvalidArgument"},
+	}
+
+	for _, test := range tests {
+		out, err := s.ListObjectsV2(&s3.ListObjectsV2Request{
+			Bucket:            "bucket",
+			MaxKeys:           intPtr(1),
+			ContinuationToken: test.token,
+			StartAfter:        test.startAfter,
+		})
+		if test.code != "" {
+			if ce, ok := err.(common.Error); !ok || ce.Code != test.code {
+				t.Errorf("%v: got %v, want %v", test.name, err, test.code)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: %v", test.name, err)
+			continue
+		}
+		if len(out.Contents) != 1 || out.Contents[0].Key != test.want {
+			t.Errorf("%v: got %+v, want %v", test.name, out.Contents, test.want)
+		}
+	}
+}
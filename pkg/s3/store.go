@@ -0,0 +1,84 @@
+package s3
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// segmentSuffix ends the names of segment files.
+const segmentSuffix = ".seg"
+
+// segment is a piece of an object's data, encrypted in its own file. Objects
+// put in one go have one segment; multipart objects have one per part.
+type segment struct {
+	id   string
+	size int64
+}
+
+// store keeps segment files in a directory. Object metadata lives only in
+// memory, so segment files left by an earlier store are of no use, and are
+// removed when a store is opened.
+type store struct {
+	dir string
+}
+
+func newStore(dir string) (*store, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		if !f.IsDir() && strings.HasSuffix(f.Name(), segmentSuffix) {
+			os.Remove(filepath.Join(dir, f.Name()))
+		}
+	}
+	return &store{dir: dir}, nil
+}
+
+func randomID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+func (st *store) path(id string) string {
+	return filepath.Join(st.dir, id+segmentSuffix)
+}
+
+// write encrypts data under key into a new segment file.
+func (st *store) write(key []byte, data []byte) (*segment, error) {
+	seg := &segment{id: randomID(), size: int64(len(data))}
+	sealed, err := seal(key, seg.id, data)
+	if err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(st.path(seg.id), sealed, 0600); err != nil {
+		return nil, err
+	}
+	return seg, nil
+}
+
+// read decrypts a segment file.
+func (st *store) read(key []byte, seg *segment) ([]byte, error) {
+	sealed, err := ioutil.ReadFile(st.path(seg.id))
+	if err != nil {
+		return nil, err
+	}
+	return open(key, seg.id, sealed)
+}
+
+// remove deletes segment files.
+func (st *store) remove(segs ...*segment) {
+	for _, seg := range segs {
+		os.Remove(st.path(seg.id))
+	}
+}
@@ -0,0 +1,228 @@
+package secretsmanager
+
+// SecretsManager is the service interface for AWS Secrets Manager.
+type SecretsManager interface {
+	CreateSecret(*CreateSecretRequest) (*CreateSecretResult, error)
+	DescribeSecret(*DescribeSecretRequest) (*DescribeSecretResult, error)
+	UpdateSecret(*UpdateSecretRequest) (*UpdateSecretResult, error)
+	DeleteSecret(*DeleteSecretRequest) (*DeleteSecretResult, error)
+	RestoreSecret(*RestoreSecretRequest) (*RestoreSecretResult, error)
+	ListSecrets(*ListSecretsRequest) (*ListSecretsResult, error)
+
+	GetSecretValue(*GetSecretValueRequest) (*GetSecretValueResult, error)
+	PutSecretValue(*PutSecretValueRequest) (*PutSecretValueResult, error)
+	UpdateSecretVersionStage(*UpdateSecretVersionStageRequest) (*UpdateSecretVersionStageResult, error)
+	ListSecretVersionIds(*ListSecretVersionIdsRequest) (*ListSecretVersionIdsResult, error)
+}
+
+// The version stages Secrets Manager itself manages.
+const (
+	StageCurrent  = "AWSCURRENT"
+	StagePending  = "AWSPENDING"
+	StagePrevious = "AWSPREVIOUS"
+)
+
+// Tag is a tag key/value pair.
+type Tag struct {
+	Key   string `json:"Key"`
+	Value string `json:"Value"`
+}
+
+//
+// API shapes for secrets.
+//
+
+// CreateSecretRequest is a request to CreateSecret.
+type CreateSecretRequest struct {
+	ClientRequestToken string `json:"ClientRequestToken"`
+	Description        string `json:"Description"`
+	KmsKeyID           string `json:"KmsKeyId"`
+	Name               string `json:"Name"`
+	SecretBinary       []byte `json:"SecretBinary"`
+	SecretString       string `json:"SecretString"`
+	Tags               []Tag  `json:"Tags"`
+}
+
+// CreateSecretResult is the result of CreateSecret.
+type CreateSecretResult struct {
+	ARN       string `json:"ARN"`
+	Name      string `json:"Name"`
+	VersionID string `json:"VersionId,omitempty"`
+}
+
+// DescribeSecretRequest is a request to DescribeSecret.
+type DescribeSecretRequest struct {
+	SecretID string `json:"SecretId"`
+}
+
+// DescribeSecretResult is the result of DescribeSecret.
+type DescribeSecretResult struct {
+	ARN                string              `json:"ARN"`
+	CreatedDate        int64               `json:"CreatedDate,omitempty"`
+	DeletedDate        int64               `json:"DeletedDate,omitempty"`
+	Description        string              `json:"Description,omitempty"`
+	KmsKeyID           string              `json:"KmsKeyId,omitempty"`
+	LastAccessedDate   int64               `json:"LastAccessedDate,omitempty"`
+	LastChangedDate    int64               `json:"LastChangedDate,omitempty"`
+	Name               string              `json:"Name"`
+	Tags               []Tag               `json:"Tags,omitempty"`
+	VersionIdsToStages map[string][]string `json:"VersionIdsToStages,omitempty"`
+}
+
+// UpdateSecretRequest is a request to UpdateSecret.
+type UpdateSecretRequest struct {
+	ClientRequestToken string `json:"ClientRequestToken"`
+	Description        string `json:"Description"`
+	KmsKeyID           string `json:"KmsKeyId"`
+	SecretBinary       []byte `json:"SecretBinary"`
+	SecretID           string `json:"SecretId"`
+	SecretString       string `json:"SecretString"`
+}
+
+// UpdateSecretResult is the result of UpdateSecret.
+type UpdateSecretResult struct {
+	ARN       string `json:"ARN"`
+	Name      string `json:"Name"`
+	VersionID string `json:"VersionId,omitempty"`
+}
+
+// DeleteSecretRequest is a request to DeleteSecret.
+type DeleteSecretRequest struct {
+	ForceDeleteWithoutRecovery bool   `json:"ForceDeleteWithoutRecovery"`
+	RecoveryWindowInDays       int    `json:"RecoveryWindowInDays"`
+	SecretID                   string `json:"SecretId"`
+}
+
+// DeleteSecretResult is the result of DeleteSecret.
+type DeleteSecretResult struct {
+	ARN          string `json:"ARN"`
+	DeletionDate int64  `json:"DeletionDate"`
+	Name         string `json:"Name"`
+}
+
+// RestoreSecretRequest is a request to RestoreSecret.
+type RestoreSecretRequest struct {
+	SecretID string `json:"SecretId"`
+}
+
+// RestoreSecretResult is the result of RestoreSecret.
+type RestoreSecretResult struct {
+	ARN  string `json:"ARN"`
+	Name string `json:"Name"`
+}
+
+// Filter is a filter on ListSecrets. Key is one of description, name,
+// tag-key, tag-value or all; a value prefixed with ! negates it.
+type Filter struct {
+	Key    string   `json:"Key"`
+	Values []string `json:"Values"`
+}
+
+// ListSecretsRequest is a request to ListSecrets.
+type ListSecretsRequest struct {
+	Filters                []Filter `json:"Filters"`
+	IncludePlannedDeletion bool     `json:"IncludePlannedDeletion"`
+	MaxResults             int      `json:"MaxResults"`
+	NextToken              string   `json:"NextToken"`
+	SortOrder              string   `json:"SortOrder"`
+}
+
+// SecretListEntry is an entry in a list of secrets.
+type SecretListEntry struct {
+	ARN                    string              `json:"ARN"`
+	CreatedDate            int64               `json:"CreatedDate,omitempty"`
+	DeletedDate            int64               `json:"DeletedDate,omitempty"`
+	Description            string              `json:"Description,omitempty"`
+	KmsKeyID               string              `json:"KmsKeyId,omitempty"`
+	LastAccessedDate       int64               `json:"LastAccessedDate,omitempty"`
+	LastChangedDate        int64               `json:"LastChangedDate,omitempty"`
+	Name                   string              `json:"Name"`
+	SecretVersionsToStages map[string][]string `json:"SecretVersionsToStages,omitempty"`
+	Tags                   []Tag               `json:"Tags,omitempty"`
+}
+
+// ListSecretsResult is the result of ListSecrets.
+type ListSecretsResult struct {
+	NextToken  string            `json:"NextToken,omitempty"`
+	SecretList []SecretListEntry `json:"SecretList"`
+}
+
+//
+// API shapes for secret values.
+//
+
+// GetSecretValueRequest is a request to GetSecretValue. It returns the
+// AWSCURRENT version unless a version ID or stage is given.
+type GetSecretValueRequest struct {
+	SecretID     string `json:"SecretId"`
+	VersionID    string `json:"VersionId"`
+	VersionStage string `json:"VersionStage"`
+}
+
+// GetSecretValueResult is the result of GetSecretValue.
+type GetSecretValueResult struct {
+	ARN           string   `json:"ARN"`
+	CreatedDate   int64    `json:"CreatedDate"`
+	Name          string   `json:"Name"`
+	SecretBinary  []byte   `json:"SecretBinary,omitempty"`
+	SecretString  string   `json:"SecretString,omitempty"`
+	VersionID     string   `json:"VersionId"`
+	VersionStages []string `json:"VersionStages"`
+}
+
+// PutSecretValueRequest is a request to PutSecretValue. The new version
+// gets the AWSCURRENT stage unless other stages are given.
+type PutSecretValueRequest struct {
+	ClientRequestToken string   `json:"ClientRequestToken"`
+	SecretBinary       []byte   `json:"SecretBinary"`
+	SecretID           string   `json:"SecretId"`
+	SecretString       string   `json:"SecretString"`
+	VersionStages      []string `json:"VersionStages"`
+}
+
+// PutSecretValueResult is the result of PutSecretValue.
+type PutSecretValueResult struct {
+	ARN           string   `json:"ARN"`
+	Name          string   `json:"Name"`
+	VersionID     string   `json:"VersionId"`
+	VersionStages []string `json:"VersionStages"`
+}
+
+// UpdateSecretVersionStageRequest is a request to UpdateSecretVersionStage.
+type UpdateSecretVersionStageRequest struct {
+	MoveToVersionID     string `json:"MoveToVersionId"`
+	RemoveFromVersionID string `json:"RemoveFromVersionId"`
+	SecretID            string `json:"SecretId"`
+	VersionStage        string `json:"VersionStage"`
+}
+
+// UpdateSecretVersionStageResult is the result of UpdateSecretVersionStage.
+type UpdateSecretVersionStageResult struct {
+	ARN  string `json:"ARN"`
+	Name string `json:"Name"`
+}
+
+// ListSecretVersionIdsRequest is a request to ListSecretVersionIds.
+type ListSecretVersionIdsRequest struct {
+	IncludeDeprecated bool   `json:"IncludeDeprecated"`
+	MaxResults        int    `json:"MaxResults"`
+	NextToken         string `json:"NextToken"`
+	SecretID          string `json:"SecretId"`
+}
+
+// SecretVersionsListEntry is an entry in a list of secret versions.
+type SecretVersionsListEntry struct {
+	CreatedDate      int64    `json:"CreatedDate,omitempty"`
+	KmsKeyIds        []string `json:"KmsKeyIds,omitempty"`
+	LastAccessedDate int64    `json:"LastAccessedDate,omitempty"`
+	VersionID        string   `json:"VersionId"`
+	VersionStages    []string `json:"VersionStages,omitempty"`
+}
+
+// ListSecretVersionIdsResult is the result of ListSecretVersionIds.
+type ListSecretVersionIdsResult struct {
+	ARN       string                    `json:"ARN"`
+	Name      string                    `json:"Name"`
+	NextToken string                    `json:"NextToken,omitempty"`
+	Versions  []SecretVersionsListEntry `json:"Versions"`
+}
@@ -0,0 +1,69 @@
+package secretsmanager
+
+import (
+	"crypto/sha256"
+
+	"github.com/fernomac/aws-local/pkg/common"
+	"github.com/fernomac/aws-local/pkg/envelope"
+)
+
+// defaultKeyID is the key secrets are encrypted with if none is given.
+const defaultKeyID = "alias/aws/secretsmanager"
+
+// sealed is a secret value encrypted under a data key from KMS, the way
+// Secrets Manager stores it.
+type sealed struct {
+	keyID         string
+	dataKey       string
+	iv            []byte
+	ciphertext    []byte
+	binary        bool
+	plaintextHash [sha256.Size]byte
+}
+
+// encryptionContext binds a data key to the secret and version it protects.
+func encryptionContext(arn string, versionID string) map[string]string {
+	return map[string]string{
+		"SecretARN":       arn,
+		"SecretVersionId": versionID,
+	}
+}
+
+// seal encrypts a value for the given version of a secret.
+func (s *secretsManager) seal(keyID string, arn string, versionID string, value []byte, binary bool) (*sealed, error) {
+	if keyID == "" {
+		keyID = defaultKeyID
+	}
+
+	dk, err := envelope.GenerateDataKey(s.kms, keyID, encryptionContext(arn, versionID), envelope.Table(nil, "EncryptionFailure"))
+	if err != nil {
+		return nil, err
+	}
+	iv, ciphertext, err := envelope.Seal(dk.Plaintext, value, []byte(versionID))
+	if err != nil {
+		return nil, err
+	}
+
+	return &sealed{
+		keyID:         dk.KeyID,
+		dataKey:       dk.Ciphertext,
+		iv:            iv,
+		ciphertext:    ciphertext,
+		binary:        binary,
+		plaintextHash: sha256.Sum256(value),
+	}, nil
+}
+
+// open decrypts a value sealed for the given version of a secret.
+func (s *secretsManager) open(v *sealed, arn string, versionID string) ([]byte, error) {
+	dk, err := envelope.DecryptDataKey(s.kms, v.dataKey, encryptionContext(arn, versionID), envelope.Table(nil, "DecryptionFailure"))
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := envelope.Open(dk.Plaintext, v.iv, v.ciphertext, []byte(versionID))
+	if err != nil {
+		return nil, common.NewError("DecryptionFailure")
+	}
+	return value, nil
+}
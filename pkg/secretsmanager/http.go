@@ -0,0 +1,109 @@
+package secretsmanager
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/fernomac/aws-local/pkg/awsjson11"
+	"github.com/fernomac/aws-local/pkg/common"
+)
+
+// NewHandler creates a new HTTP handler, notifying the given observers of
+// every call.
+func NewHandler(sm SecretsManager, observers ...common.Observer) http.Handler {
+	rval := awsjson11.NewHandler("secretsmanager")
+	rval.SetEventSource("secretsmanager.amazonaws.com")
+	for _, o := range observers {
+		rval.ObserveWith(o)
+	}
+
+	//
+	// Secrets.
+	//
+
+	rval.HandleWith("CreateSecret", func(body []byte) (interface{}, error) {
+		req := CreateSecretRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return sm.CreateSecret(&req)
+	})
+
+	rval.HandleWith("DescribeSecret", func(body []byte) (interface{}, error) {
+		req := DescribeSecretRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return sm.DescribeSecret(&req)
+	})
+
+	rval.HandleWith("UpdateSecret", func(body []byte) (interface{}, error) {
+		req := UpdateSecretRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return sm.UpdateSecret(&req)
+	})
+
+	rval.HandleWith("DeleteSecret", func(body []byte) (interface{}, error) {
+		req := DeleteSecretRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return sm.DeleteSecret(&req)
+	})
+
+	rval.HandleWith("RestoreSecret", func(body []byte) (interface{}, error) {
+		req := RestoreSecretRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return sm.RestoreSecret(&req)
+	})
+
+	rval.HandleWith("ListSecrets", func(body []byte) (interface{}, error) {
+		req := ListSecretsRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return sm.ListSecrets(&req)
+	})
+
+	//
+	// Secret values.
+	//
+
+	rval.HandleWith("GetSecretValue", func(body []byte) (interface{}, error) {
+		req := GetSecretValueRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return sm.GetSecretValue(&req)
+	})
+
+	rval.HandleWith("PutSecretValue", func(body []byte) (interface{}, error) {
+		req := PutSecretValueRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return sm.PutSecretValue(&req)
+	})
+
+	rval.HandleWith("UpdateSecretVersionStage", func(body []byte) (interface{}, error) {
+		req := UpdateSecretVersionStageRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return sm.UpdateSecretVersionStage(&req)
+	})
+
+	rval.HandleWith("ListSecretVersionIds", func(body []byte) (interface{}, error) {
+		req := ListSecretVersionIdsRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return sm.ListSecretVersionIds(&req)
+	})
+
+	return rval
+}
@@ -0,0 +1,802 @@
+package secretsmanager
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fernomac/aws-local/pkg/common"
+	"github.com/fernomac/aws-local/pkg/kms"
+)
+
+// maxVersions is how many versions a secret keeps. Versions without a stage
+// beyond that are dropped, oldest first.
+const maxVersions = 100
+
+// maxValueSize is the biggest secret value Secrets Manager accepts.
+const maxValueSize = 65536
+
+var secretNamePattern = regexp.MustCompile(`^[a-zA-Z0-9/_+=.@-]{1,512}$`)
+
+// version is a single version of a secret's value.
+type version struct {
+	id       string
+	created  time.Time
+	accessed time.Time
+	value    *sealed
+	stages   map[string]bool
+}
+
+func (v *version) stageList() []string {
+	out := []string{}
+	for stage := range v.stages {
+		out = append(out, stage)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// secret is a single secret.
+type secret struct {
+	arn         string
+	name        string
+	description string
+	kmsKeyID    string
+	tags        []Tag
+	created     time.Time
+	changed     time.Time
+	accessed    time.Time
+	deletion    time.Time
+	versions    map[string]*version
+}
+
+// deleted reports whether the secret is scheduled for deletion.
+func (sec *secret) deleted() bool {
+	return !sec.deletion.IsZero()
+}
+
+// staged returns the version with the given stage, or nil.
+func (sec *secret) staged(stage string) *version {
+	for _, v := range sec.versions {
+		if v.stages[stage] {
+			return v
+		}
+	}
+	return nil
+}
+
+func (sec *secret) versionsToStages() map[string][]string {
+	out := map[string][]string{}
+	for id, v := range sec.versions {
+		if len(v.stages) > 0 {
+			out[id] = v.stageList()
+		}
+	}
+	return out
+}
+
+// Option configures a Secrets Manager object.
+type Option func(*secretsManager)
+
+// WithClock sets the clock that stamps secrets and versions and ends the
+// recovery window of deleted secrets.
+func WithClock(clock common.Clock) Option {
+	return func(s *secretsManager) {
+		s.clock = clock
+	}
+}
+
+// secretsManager is the Secrets Manager store. Its lock guards everything,
+// including calls out to KMS.
+type secretsManager struct {
+	lock    sync.Mutex
+	kms     kms.KMS
+	clock   common.Clock
+	secrets map[string]*secret
+}
+
+// New creates a new Secrets Manager object that encrypts secrets with keys
+// from the given KMS.
+func New(kms kms.KMS, opts ...Option) SecretsManager {
+	rval := &secretsManager{
+		kms:     kms,
+		clock:   common.SystemClock,
+		secrets: make(map[string]*secret),
+	}
+	for _, opt := range opts {
+		opt(rval)
+	}
+	return rval
+}
+
+// newSecretArn makes an ARN for a new secret, which like the real thing ends
+// in six random characters.
+func newSecretArn(name string) string {
+	const letters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	for i := range b {
+		b[i] = letters[int(b[i])%len(letters)]
+	}
+	return fmt.Sprintf("arn:aws:secretsmanager:%v:%v:secret:%v-%v", common.Region, common.AccountID, name, b)
+}
+
+// purge removes secrets whose recovery window has passed. The caller must
+// hold s.lock.
+func (s *secretsManager) purge(now time.Time) {
+	for name, sec := range s.secrets {
+		if sec.deleted() && !sec.deletion.After(now) {
+			delete(s.secrets, name)
+		}
+	}
+}
+
+// find looks up a secret by name, ARN, or ARN without the random suffix. The
+// caller must hold s.lock.
+func (s *secretsManager) find(secretID string) (*secret, error) {
+	s.purge(s.clock.Now())
+
+	if secretID == "" {
+		return nil, common.NewError("InvalidParameterException")
+	}
+
+	if !strings.HasPrefix(secretID, "arn:") {
+		if sec, ok := s.secrets[secretID]; ok {
+			return sec, nil
+		}
+	} else {
+		for _, sec := range s.secrets {
+			if secretID == sec.arn || secretID == sec.arn[:len(sec.arn)-7] {
+				return sec, nil
+			}
+		}
+	}
+
+	return nil, common.Errorf("ResourceNotFoundException", "Secrets Manager can't find the specified secret.")
+}
+
+// findLive looks up a secret that isn't scheduled for deletion.
+func (s *secretsManager) findLive(secretID string) (*secret, error) {
+	sec, err := s.find(secretID)
+	if err != nil {
+		return nil, err
+	}
+	if sec.deleted() {
+		return nil, common.Errorf("InvalidRequestException", "You can't perform this operation on the secret because it was marked for deletion.")
+	}
+	return sec, nil
+}
+
+// secretValue checks and returns the value given in a request.
+func secretValue(str string, binary []byte) ([]byte, bool, error) {
+	if str != "" && binary != nil {
+		return nil, false, common.Errorf("InvalidParameterException", "You can't specify both a binary secret value and a string secret value in the same secret.")
+	}
+	value, isBinary := []byte(str), binary != nil
+	if isBinary {
+		value = binary
+	}
+	if len(value) > maxValueSize {
+		return nil, false, common.NewError("ValidationException")
+	}
+	return value, isBinary, nil
+}
+
+// checkToken checks a client request token, making one up if none is given.
+func checkToken(token string) (string, error) {
+	if token == "" {
+		return common.NewRequestID(), nil
+	}
+	if len(token) < 32 || len(token) > 64 {
+		return "", common.NewError("ValidationException")
+	}
+	return token, nil
+}
+
+// addVersion adds a new version of the secret's value, sealed under the given
+// key, with the given stages, or returns the existing one if the token was
+// already used for the same value. The caller must hold s.lock.
+func (s *secretsManager) addVersion(sec *secret, keyID string, token string, value []byte, binary bool, stages []string) (*version, error) {
+	if existing, ok := sec.versions[token]; ok {
+		if existing.value.plaintextHash != sha256.Sum256(value) || existing.value.binary != binary {
+			return nil, common.Errorf("ResourceExistsException", "You can't modify an existing version, you can only create a new version.")
+		}
+		return existing, nil
+	}
+
+	sealed, err := s.seal(keyID, sec.arn, token, value, binary)
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.clock.Now()
+	v := &version{
+		id:      token,
+		created: now,
+		value:   sealed,
+		stages:  map[string]bool{},
+	}
+	sec.versions[token] = v
+	for _, stage := range stages {
+		moveStage(sec, stage, v)
+	}
+	sec.changed = now
+
+	prune(sec)
+	return v, nil
+}
+
+// moveStage moves a stage to the given version. Moving AWSCURRENT leaves
+// AWSPREVIOUS on the version that had it.
+func moveStage(sec *secret, stage string, to *version) {
+	from := sec.staged(stage)
+	if from == to {
+		return
+	}
+	if from != nil {
+		delete(from.stages, stage)
+	}
+	to.stages[stage] = true
+
+	if stage == StageCurrent && from != nil {
+		if previous := sec.staged(StagePrevious); previous != nil {
+			delete(previous.stages, StagePrevious)
+		}
+		from.stages[StagePrevious] = true
+	}
+}
+
+// prune drops the oldest versions without stages once there are too many.
+func prune(sec *secret) {
+	if len(sec.versions) <= maxVersions {
+		return
+	}
+
+	unstaged := []*version{}
+	for _, v := range sec.versions {
+		if len(v.stages) == 0 {
+			unstaged = append(unstaged, v)
+		}
+	}
+	sort.Slice(unstaged, func(i, j int) bool {
+		return unstaged[i].created.Before(unstaged[j].created)
+	})
+
+	for _, v := range unstaged {
+		if len(sec.versions) <= maxVersions {
+			break
+		}
+		delete(sec.versions, v.id)
+	}
+}
+
+func unix(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
+
+func (s *secretsManager) CreateSecret(req *CreateSecretRequest) (*CreateSecretResult, error) {
+	if !secretNamePattern.MatchString(req.Name) {
+		return nil, common.NewError("ValidationException")
+	}
+	value, binary, err := secretValue(req.SecretString, req.SecretBinary)
+	if err != nil {
+		return nil, err
+	}
+	token, err := checkToken(req.ClientRequestToken)
+	if err != nil {
+		return nil, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.purge(s.clock.Now())
+	if existing, ok := s.secrets[req.Name]; ok {
+		if existing.deleted() {
+			return nil, common.Errorf("InvalidRequestException", "You can't create this secret because a secret with this name is already scheduled for deletion.")
+		}
+		return nil, common.Errorf("ResourceExistsException", "The operation failed because the secret %v already exists.", req.Name)
+	}
+
+	now := s.clock.Now()
+	sec := &secret{
+		arn:         newSecretArn(req.Name),
+		name:        req.Name,
+		description: req.Description,
+		kmsKeyID:    req.KmsKeyID,
+		tags:        append([]Tag(nil), req.Tags...),
+		created:     now,
+		changed:     now,
+		versions:    map[string]*version{},
+	}
+
+	result := &CreateSecretResult{
+		ARN:  sec.arn,
+		Name: sec.name,
+	}
+
+	if req.SecretString != "" || req.SecretBinary != nil {
+		v, err := s.addVersion(sec, sec.kmsKeyID, token, value, binary, []string{StageCurrent})
+		if err != nil {
+			return nil, err
+		}
+		result.VersionID = v.id
+	}
+
+	s.secrets[sec.name] = sec
+	return result, nil
+}
+
+func (s *secretsManager) DescribeSecret(req *DescribeSecretRequest) (*DescribeSecretResult, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	sec, err := s.find(req.SecretID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DescribeSecretResult{
+		ARN:                sec.arn,
+		CreatedDate:        unix(sec.created),
+		DeletedDate:        unix(sec.deletion),
+		Description:        sec.description,
+		KmsKeyID:           sec.kmsKeyID,
+		LastAccessedDate:   unix(sec.accessed),
+		LastChangedDate:    unix(sec.changed),
+		Name:               sec.name,
+		Tags:               append([]Tag(nil), sec.tags...),
+		VersionIdsToStages: sec.versionsToStages(),
+	}, nil
+}
+
+func (s *secretsManager) UpdateSecret(req *UpdateSecretRequest) (*UpdateSecretResult, error) {
+	value, binary, err := secretValue(req.SecretString, req.SecretBinary)
+	if err != nil {
+		return nil, err
+	}
+	token, err := checkToken(req.ClientRequestToken)
+	if err != nil {
+		return nil, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	sec, err := s.findLive(req.SecretID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &UpdateSecretResult{
+		ARN:  sec.arn,
+		Name: sec.name,
+	}
+
+	// Changing the key only affects new versions. Nothing about the secret
+	// changes unless the new version, if any, seals under it.
+	keyID := sec.kmsKeyID
+	if req.KmsKeyID != "" {
+		keyID = req.KmsKeyID
+	}
+
+	if req.SecretString != "" || req.SecretBinary != nil {
+		v, err := s.addVersion(sec, keyID, token, value, binary, []string{StageCurrent})
+		if err != nil {
+			return nil, err
+		}
+		result.VersionID = v.id
+	}
+
+	sec.kmsKeyID = keyID
+	if req.Description != "" {
+		sec.description = req.Description
+	}
+	sec.changed = s.clock.Now()
+
+	return result, nil
+}
+
+func (s *secretsManager) DeleteSecret(req *DeleteSecretRequest) (*DeleteSecretResult, error) {
+	days := req.RecoveryWindowInDays
+	if req.ForceDeleteWithoutRecovery && days != 0 {
+		return nil, common.Errorf("InvalidParameterException", "You can't use ForceDeleteWithoutRecovery in conjunction with RecoveryWindowInDays.")
+	}
+	if days == 0 {
+		days = 30
+	}
+	if days < 7 || days > 30 {
+		return nil, common.Errorf("InvalidParameterException", "The RecoveryWindowInDays value must be between 7 and 30 days (inclusive).")
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	sec, err := s.find(req.SecretID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.clock.Now()
+	if req.ForceDeleteWithoutRecovery {
+		delete(s.secrets, sec.name)
+		return &DeleteSecretResult{
+			ARN:          sec.arn,
+			DeletionDate: now.Unix(),
+			Name:         sec.name,
+		}, nil
+	}
+
+	if sec.deleted() {
+		return nil, common.Errorf("InvalidRequestException", "You can't perform this operation on the secret because it was already scheduled for deletion.")
+	}
+
+	sec.deletion = now.AddDate(0, 0, days)
+	return &DeleteSecretResult{
+		ARN:          sec.arn,
+		DeletionDate: sec.deletion.Unix(),
+		Name:         sec.name,
+	}, nil
+}
+
+func (s *secretsManager) RestoreSecret(req *RestoreSecretRequest) (*RestoreSecretResult, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	sec, err := s.find(req.SecretID)
+	if err != nil {
+		return nil, err
+	}
+
+	sec.deletion = time.Time{}
+	return &RestoreSecretResult{
+		ARN:  sec.arn,
+		Name: sec.name,
+	}, nil
+}
+
+// matches reports whether a single filter value matches the secret. Values
+// match by prefix; a leading ! negates the match.
+func (sec *secret) matches(key string, value string) (bool, error) {
+	negate := strings.HasPrefix(value, "!")
+	value = strings.TrimPrefix(value, "!")
+
+	fields := []string{}
+	switch key {
+	case "name":
+		fields = append(fields, sec.name)
+	case "description":
+		fields = append(fields, sec.description)
+	case "tag-key":
+		for _, tag := range sec.tags {
+			fields = append(fields, tag.Key)
+		}
+	case "tag-value":
+		for _, tag := range sec.tags {
+			fields = append(fields, tag.Value)
+		}
+	case "all":
+		fields = append(fields, sec.name, sec.description)
+		for _, tag := range sec.tags {
+			fields = append(fields, tag.Key, tag.Value)
+		}
+	default:
+		return false, common.NewError("InvalidParameterException")
+	}
+
+	for _, f := range fields {
+		if strings.HasPrefix(f, value) {
+			return !negate, nil
+		}
+	}
+	return negate, nil
+}
+
+// paging reads MaxResults and NextToken, which is an offset into the list.
+func paging(maxResults int, nextToken string) (int, int, error) {
+	if maxResults == 0 {
+		maxResults = 100
+	}
+	if maxResults < 1 || maxResults > 100 {
+		return 0, 0, common.NewError("InvalidParameterException")
+	}
+
+	offset := 0
+	if nextToken != "" {
+		raw, err := base64.RawURLEncoding.DecodeString(nextToken)
+		if err != nil {
+			return 0, 0, common.NewError("InvalidNextTokenException")
+		}
+		if offset, err = strconv.Atoi(string(raw)); err != nil || offset < 0 {
+			return 0, 0, common.NewError("InvalidNextTokenException")
+		}
+	}
+	return maxResults, offset, nil
+}
+
+// nextToken returns the token for the page after the one ending at end, or
+// "" if there isn't one.
+func nextToken(end int, total int) string {
+	if end >= total {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(end)))
+}
+
+func (s *secretsManager) ListSecrets(req *ListSecretsRequest) (*ListSecretsResult, error) {
+	maxResults, offset, err := paging(req.MaxResults, req.NextToken)
+	if err != nil {
+		return nil, err
+	}
+	if req.SortOrder != "" && req.SortOrder != "asc" && req.SortOrder != "desc" {
+		return nil, common.NewError("ValidationException")
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.purge(s.clock.Now())
+
+	matched := []*secret{}
+next:
+	for _, sec := range s.secrets {
+		if sec.deleted() && !req.IncludePlannedDeletion {
+			continue
+		}
+		for _, f := range req.Filters {
+			ok := false
+			for _, value := range f.Values {
+				m, err := sec.matches(f.Key, value)
+				if err != nil {
+					return nil, err
+				}
+				ok = ok || m
+			}
+			if !ok {
+				continue next
+			}
+		}
+		matched = append(matched, sec)
+	}
+
+	sort.Slice(matched, func(i, j int) bool {
+		a, b := matched[i], matched[j]
+		if req.SortOrder == "desc" {
+			a, b = b, a
+		}
+		if !a.created.Equal(b.created) {
+			return a.created.Before(b.created)
+		}
+		return a.name < b.name
+	})
+
+	if offset > len(matched) {
+		offset = len(matched)
+	}
+	end := offset + maxResults
+	if end > len(matched) {
+		end = len(matched)
+	}
+
+	list := []SecretListEntry{}
+	for _, sec := range matched[offset:end] {
+		list = append(list, SecretListEntry{
+			ARN:                    sec.arn,
+			CreatedDate:            unix(sec.created),
+			DeletedDate:            unix(sec.deletion),
+			Description:            sec.description,
+			KmsKeyID:               sec.kmsKeyID,
+			LastAccessedDate:       unix(sec.accessed),
+			LastChangedDate:        unix(sec.changed),
+			Name:                   sec.name,
+			SecretVersionsToStages: sec.versionsToStages(),
+			Tags:                   append([]Tag(nil), sec.tags...),
+		})
+	}
+
+	return &ListSecretsResult{
+		NextToken:  nextToken(end, len(matched)),
+		SecretList: list,
+	}, nil
+}
+
+func (s *secretsManager) GetSecretValue(req *GetSecretValueRequest) (*GetSecretValueResult, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	sec, err := s.findLive(req.SecretID)
+	if err != nil {
+		return nil, err
+	}
+
+	stage := req.VersionStage
+	if stage == "" && req.VersionID == "" {
+		stage = StageCurrent
+	}
+
+	var v *version
+	if req.VersionID != "" {
+		v = sec.versions[req.VersionID]
+		if v != nil && stage != "" && !v.stages[stage] {
+			return nil, common.Errorf("InvalidParameterException", "You provided a VersionStage that is not associated to the provided VersionId.")
+		}
+	} else {
+		v = sec.staged(stage)
+	}
+	if v == nil {
+		return nil, common.Errorf("ResourceNotFoundException", "Secrets Manager can't find the specified secret value for staging label: %v", stage)
+	}
+
+	value, err := s.open(v.value, sec.arn, v.id)
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.clock.Now()
+	v.accessed = now
+	sec.accessed = now
+
+	result := &GetSecretValueResult{
+		ARN:           sec.arn,
+		CreatedDate:   v.created.Unix(),
+		Name:          sec.name,
+		VersionID:     v.id,
+		VersionStages: v.stageList(),
+	}
+	if v.value.binary {
+		result.SecretBinary = value
+	} else {
+		result.SecretString = string(value)
+	}
+	return result, nil
+}
+
+func (s *secretsManager) PutSecretValue(req *PutSecretValueRequest) (*PutSecretValueResult, error) {
+	if req.SecretString == "" && req.SecretBinary == nil {
+		return nil, common.Errorf("InvalidParameterException", "You must provide either SecretString or SecretBinary.")
+	}
+	value, binary, err := secretValue(req.SecretString, req.SecretBinary)
+	if err != nil {
+		return nil, err
+	}
+	token, err := checkToken(req.ClientRequestToken)
+	if err != nil {
+		return nil, err
+	}
+
+	stages := req.VersionStages
+	if len(stages) == 0 {
+		stages = []string{StageCurrent}
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	sec, err := s.findLive(req.SecretID)
+	if err != nil {
+		return nil, err
+	}
+
+	v, err := s.addVersion(sec, sec.kmsKeyID, token, value, binary, stages)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PutSecretValueResult{
+		ARN:           sec.arn,
+		Name:          sec.name,
+		VersionID:     v.id,
+		VersionStages: v.stageList(),
+	}, nil
+}
+
+func (s *secretsManager) UpdateSecretVersionStage(req *UpdateSecretVersionStageRequest) (*UpdateSecretVersionStageResult, error) {
+	if req.VersionStage == "" {
+		return nil, common.NewError("InvalidParameterException")
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	sec, err := s.findLive(req.SecretID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Taking a stage from a version means naming it in RemoveFromVersionId.
+	holder := sec.staged(req.VersionStage)
+	if holder != nil && holder.id != req.RemoveFromVersionID && holder.id != req.MoveToVersionID {
+		return nil, common.Errorf("InvalidParameterException", "The staging label %v is currently attached to version %v, so you must explicitly reference that version in RemoveFromVersionId.", req.VersionStage, holder.id)
+	}
+	if req.RemoveFromVersionID != "" && (holder == nil || holder.id != req.RemoveFromVersionID) {
+		return nil, common.Errorf("InvalidParameterException", "The staging label %v isn't attached to version %v.", req.VersionStage, req.RemoveFromVersionID)
+	}
+
+	if req.MoveToVersionID != "" {
+		to, ok := sec.versions[req.MoveToVersionID]
+		if !ok {
+			return nil, common.Errorf("ResourceNotFoundException", "Secrets Manager can't find the specified secret version.")
+		}
+		moveStage(sec, req.VersionStage, to)
+	} else if holder != nil {
+		if req.VersionStage == StageCurrent {
+			return nil, common.Errorf("InvalidParameterException", "You can only move the staging label AWSCURRENT to a different secret version.")
+		}
+		delete(holder.stages, req.VersionStage)
+	}
+
+	sec.changed = s.clock.Now()
+	prune(sec)
+
+	return &UpdateSecretVersionStageResult{
+		ARN:  sec.arn,
+		Name: sec.name,
+	}, nil
+}
+
+func (s *secretsManager) ListSecretVersionIds(req *ListSecretVersionIdsRequest) (*ListSecretVersionIdsResult, error) {
+	maxResults, offset, err := paging(req.MaxResults, req.NextToken)
+	if err != nil {
+		return nil, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	sec, err := s.find(req.SecretID)
+	if err != nil {
+		return nil, err
+	}
+
+	versions := []*version{}
+	for _, v := range sec.versions {
+		if len(v.stages) > 0 || req.IncludeDeprecated {
+			versions = append(versions, v)
+		}
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		if !versions[i].created.Equal(versions[j].created) {
+			return versions[i].created.Before(versions[j].created)
+		}
+		return versions[i].id < versions[j].id
+	})
+
+	if offset > len(versions) {
+		offset = len(versions)
+	}
+	end := offset + maxResults
+	if end > len(versions) {
+		end = len(versions)
+	}
+
+	list := []SecretVersionsListEntry{}
+	for _, v := range versions[offset:end] {
+		list = append(list, SecretVersionsListEntry{
+			CreatedDate:      unix(v.created),
+			KmsKeyIds:        []string{v.value.keyID},
+			LastAccessedDate: unix(v.accessed),
+			VersionID:        v.id,
+			VersionStages:    v.stageList(),
+		})
+	}
+
+	return &ListSecretVersionIdsResult{
+		ARN:       sec.arn,
+		Name:      sec.name,
+		NextToken: nextToken(end, len(versions)),
+		Versions:  list,
+	}, nil
+}
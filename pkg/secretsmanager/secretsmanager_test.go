@@ -0,0 +1,414 @@
+package secretsmanager_test
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/fernomac/aws-local/pkg/common"
+	"github.com/fernomac/aws-local/pkg/kms"
+	"github.com/fernomac/aws-local/pkg/secretsmanager"
+)
+
+// testClock is a clock the tests move by hand.
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	return c.now
+}
+
+func newTestSecretsManager() (secretsmanager.SecretsManager, kms.KMS, *testClock) {
+	clock := &testClock{now: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)}
+	k := kms.New()
+	return secretsmanager.New(k, secretsmanager.WithClock(clock)), k, clock
+}
+
+func code(err error) string {
+	if ce, ok := err.(common.Error); ok {
+		return ce.Code
+	}
+	if err != nil {
+		return err.Error()
+	}
+	return ""
+}
+
+// token makes a client request token, which must be at least 32 characters.
+func token(n int) string {
+	return fmt.Sprintf("%032d", n)
+}
+
+func stages(t *testing.T, s secretsmanager.SecretsManager, id string) map[string][]string {
+	out, err := s.DescribeSecret(&secretsmanager.DescribeSecretRequest{SecretID: id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out.VersionIdsToStages
+}
+
+func TestRotationStages(t *testing.T) {
+	s, _, _ := newTestSecretsManager()
+	if _, err := s.CreateSecret(&secretsmanager.CreateSecretRequest{Name: "db", SecretString: "one", ClientRequestToken: token(1)}); err != nil {
+		t.Fatal(err)
+	}
+
+	current, pending, previous := secretsmanager.StageCurrent, secretsmanager.StagePending, secretsmanager.StagePrevious
+	steps := []struct {
+		name string
+		do   func() error
+		want map[string][]string
+	}{
+		{"pending version", func() error {
+			_, err := s.PutSecretValue(&secretsmanager.PutSecretValueRequest{SecretID: "db", SecretString: "two", ClientRequestToken: token(2), VersionStages: []string{pending}})
+			return err
+		}, map[string][]string{token(1): {current}, token(2): {pending}}},
+		{"promote pending", func() error {
+			_, err := s.UpdateSecretVersionStage(&secretsmanager.UpdateSecretVersionStageRequest{SecretID: "db", VersionStage: current, MoveToVersionID: token(2), RemoveFromVersionID: token(1)})
+			return err
+		}, map[string][]string{token(1): {previous}, token(2): {current, pending}}},
+		{"finish rotation", func() error {
+			_, err := s.UpdateSecretVersionStage(&secretsmanager.UpdateSecretVersionStageRequest{SecretID: "db", VersionStage: pending, RemoveFromVersionID: token(2)})
+			return err
+		}, map[string][]string{token(1): {previous}, token(2): {current}}},
+		{"new current", func() error {
+			_, err := s.PutSecretValue(&secretsmanager.PutSecretValueRequest{SecretID: "db", SecretString: "three", ClientRequestToken: token(3)})
+			return err
+		}, map[string][]string{token(2): {previous}, token(3): {current}}},
+		{"update secret", func() error {
+			_, err := s.UpdateSecret(&secretsmanager.UpdateSecretRequest{SecretID: "db", SecretString: "four", ClientRequestToken: token(4)})
+			return err
+		}, map[string][]string{token(3): {previous}, token(4): {current}}},
+		{"roll back", func() error {
+			_, err := s.UpdateSecretVersionStage(&secretsmanager.UpdateSecretVersionStageRequest{SecretID: "db", VersionStage: current, MoveToVersionID: token(3), RemoveFromVersionID: token(4)})
+			return err
+		}, map[string][]string{token(3): {current}, token(4): {previous}}},
+		{"retried put", func() error {
+			_, err := s.PutSecretValue(&secretsmanager.PutSecretValueRequest{SecretID: "db", SecretString: "four", ClientRequestToken: token(4)})
+			return err
+		}, map[string][]string{token(3): {current}, token(4): {previous}}},
+	}
+
+	for _, step := range steps {
+		if err := step.do(); err != nil {
+			t.Fatalf("%v: %v", step.name, err)
+		}
+		if got := stages(t, s, "db"); !reflect.DeepEqual(got, step.want) {
+			t.Errorf("%v: got %v, want %v", step.name, got, step.want)
+		}
+	}
+
+	values := []struct {
+		stage, id, want string
+	}{
+		{"", "", "three"},
+		{current, "", "three"},
+		{previous, "", "four"},
+		{"", token(1), "one"},
+		{"", token(2), "two"},
+	}
+	for _, v := range values {
+		out, err := s.GetSecretValue(&secretsmanager.GetSecretValueRequest{SecretID: "db", VersionStage: v.stage, VersionID: v.id})
+		if err != nil {
+			t.Errorf("%q %q: %v", v.stage, v.id, err)
+		} else if out.SecretString != v.want {
+			t.Errorf("%q %q: got %q, want %q", v.stage, v.id, out.SecretString, v.want)
+		}
+	}
+
+	_, err := s.GetSecretValue(&secretsmanager.GetSecretValueRequest{SecretID: "db", VersionStage: pending})
+	if got := code(err); got != "ResourceNotFoundException" {
+		t.Errorf("pending after rotation: got %v", got)
+	}
+	_, err = s.GetSecretValue(&secretsmanager.GetSecretValueRequest{SecretID: "db", VersionStage: current, VersionID: token(4)})
+	if got := code(err); got != "InvalidParameterException" {
+		t.Errorf("stage not on version: got %v", got)
+	}
+	_, err = s.PutSecretValue(&secretsmanager.PutSecretValueRequest{SecretID: "db", SecretString: "other", ClientRequestToken: token(4)})
+	if got := code(err); got != "ResourceExistsException" {
+		t.Errorf("reused token: got %v", got)
+	}
+}
+
+func TestUpdateSecretVersionStageErrors(t *testing.T) {
+	s, _, _ := newTestSecretsManager()
+	if _, err := s.CreateSecret(&secretsmanager.CreateSecretRequest{Name: "db", SecretString: "one", ClientRequestToken: token(1)}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.PutSecretValue(&secretsmanager.PutSecretValueRequest{SecretID: "db", SecretString: "two", ClientRequestToken: token(2), VersionStages: []string{"custom"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		req  secretsmanager.UpdateSecretVersionStageRequest
+		code string
+	}{
+		{"no stage", secretsmanager.UpdateSecretVersionStageRequest{MoveToVersionID: token(2)}, "InvalidParameterException"},
+		{"move without remove", secretsmanager.UpdateSecretVersionStageRequest{VersionStage: "AWSCURRENT", MoveToVersionID: token(2)}, "InvalidParameterException"},
+		{"remove from wrong version", secretsmanager.UpdateSecretVersionStageRequest{VersionStage: "AWSCURRENT", MoveToVersionID: token(2), RemoveFromVersionID: token(2)}, "InvalidParameterException"},
+		{"remove unattached stage", secretsmanager.UpdateSecretVersionStageRequest{VersionStage: "nope", RemoveFromVersionID: token(1)}, "InvalidParameterException"},
+		{"move to missing version", secretsmanager.UpdateSecretVersionStageRequest{VersionStage: "AWSCURRENT", MoveToVersionID: token(9), RemoveFromVersionID: token(1)}, "ResourceNotFoundException"},
+		{"remove current", secretsmanager.UpdateSecretVersionStageRequest{VersionStage: "AWSCURRENT", RemoveFromVersionID: token(1)}, "InvalidParameterException"},
+		{"remove custom", secretsmanager.UpdateSecretVersionStageRequest{VersionStage: "custom", RemoveFromVersionID: token(2)}, ""},
+		{"add custom", secretsmanager.UpdateSecretVersionStageRequest{VersionStage: "custom", MoveToVersionID: token(1)}, ""},
+	}
+
+	for _, test := range tests {
+		test.req.SecretID = "db"
+		_, err := s.UpdateSecretVersionStage(&test.req)
+		if got := code(err); got != test.code {
+			t.Errorf("%v: got %v, want %v", test.name, got, test.code)
+		}
+	}
+
+	want := map[string][]string{token(1): {"AWSCURRENT", "custom"}}
+	if got := stages(t, s, "db"); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+// TestUpdateSecretFailure checks that an UpdateSecret whose new value can't
+// be sealed leaves the secret as it was.
+func TestUpdateSecretFailure(t *testing.T) {
+	s, k, clock := newTestSecretsManager()
+	first, err := k.CreateKey(&kms.CreateKeyRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := k.CreateKey(&kms.CreateKeyRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.CreateSecret(&secretsmanager.CreateSecretRequest{Name: "db", Description: "old", KmsKeyID: first.KeyMetadata.KeyID, SecretString: "one"}); err != nil {
+		t.Fatal(err)
+	}
+	before, err := s.DescribeSecret(&secretsmanager.DescribeSecretRequest{SecretID: "db"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clock.now = clock.now.Add(time.Hour)
+	_, err = s.UpdateSecret(&secretsmanager.UpdateSecretRequest{SecretID: "db", Description: "new", KmsKeyID: "alias/missing", SecretString: "two"})
+	if err == nil {
+		t.Fatal("no error with missing key")
+	}
+	after, err := s.DescribeSecret(&secretsmanager.DescribeSecretRequest{SecretID: "db"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(after, before) {
+		t.Errorf("secret changed to %+v from %+v", after, before)
+	}
+
+	if _, err := s.UpdateSecret(&secretsmanager.UpdateSecretRequest{SecretID: "db", Description: "new", KmsKeyID: second.KeyMetadata.KeyID, SecretString: "two"}); err != nil {
+		t.Fatal(err)
+	}
+	after, err = s.DescribeSecret(&secretsmanager.DescribeSecretRequest{SecretID: "db"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.KmsKeyID != second.KeyMetadata.KeyID || after.Description != "new" || after.LastChangedDate != clock.now.Unix() {
+		t.Errorf("secret is %+v", after)
+	}
+
+	versions, err := s.ListSecretVersionIds(&secretsmanager.ListSecretVersionIdsRequest{SecretID: "db"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := map[string]bool{}
+	for _, v := range versions.Versions {
+		keys[v.KmsKeyIds[0]] = true
+	}
+	if want := map[string]bool{first.KeyMetadata.Arn: true, second.KeyMetadata.Arn: true}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("versions sealed under %v, want %v", keys, want)
+	}
+}
+
+func TestRecoveryWindow(t *testing.T) {
+	tests := []struct {
+		name    string
+		days    int
+		force   bool
+		advance time.Duration
+		code    string
+		gone    bool
+	}{
+		{"default window", 0, false, 30*24*time.Hour - time.Second, "", false},
+		{"default window over", 0, false, 30 * 24 * time.Hour, "", true},
+		{"short window", 7, false, 7*24*time.Hour - time.Second, "", false},
+		{"short window over", 7, false, 7 * 24 * time.Hour, "", true},
+		{"long window", 30, false, 29 * 24 * time.Hour, "", false},
+		{"too short", 6, false, 0, "InvalidParameterException", false},
+		{"too long", 31, false, 0, "InvalidParameterException", false},
+		{"force", 0, true, 0, "", true},
+		{"force with window", 7, true, 0, "InvalidParameterException", false},
+	}
+
+	for _, test := range tests {
+		s, _, clock := newTestSecretsManager()
+		if _, err := s.CreateSecret(&secretsmanager.CreateSecretRequest{Name: "db", SecretString: "one"}); err != nil {
+			t.Fatal(err)
+		}
+
+		deleted, err := s.DeleteSecret(&secretsmanager.DeleteSecretRequest{SecretID: "db", RecoveryWindowInDays: test.days, ForceDeleteWithoutRecovery: test.force})
+		if got := code(err); got != test.code {
+			t.Errorf("%v: got %v, want %v", test.name, got, test.code)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+
+		days := test.days
+		if days == 0 && !test.force {
+			days = 30
+		}
+		if want := clock.now.AddDate(0, 0, days).Unix(); deleted.DeletionDate != want {
+			t.Errorf("%v: deletion date %v, want %v", test.name, deleted.DeletionDate, want)
+		}
+
+		clock.now = clock.now.Add(test.advance)
+		_, err = s.DescribeSecret(&secretsmanager.DescribeSecretRequest{SecretID: "db"})
+		if gone := code(err) == "ResourceNotFoundException"; gone != test.gone {
+			t.Errorf("%v: gone is %v (%v)", test.name, gone, err)
+		}
+		if test.gone {
+			// The name is free again.
+			if _, err := s.CreateSecret(&secretsmanager.CreateSecretRequest{Name: "db", SecretString: "two"}); err != nil {
+				t.Errorf("%v: recreating: %v", test.name, err)
+			}
+			continue
+		}
+
+		// A secret in its recovery window can only be described or restored.
+		checks := []struct {
+			op string
+			do func() error
+		}{
+			{"GetSecretValue", func() error {
+				_, err := s.GetSecretValue(&secretsmanager.GetSecretValueRequest{SecretID: "db"})
+				return err
+			}},
+			{"PutSecretValue", func() error {
+				_, err := s.PutSecretValue(&secretsmanager.PutSecretValueRequest{SecretID: "db", SecretString: "two"})
+				return err
+			}},
+			{"CreateSecret", func() error {
+				_, err := s.CreateSecret(&secretsmanager.CreateSecretRequest{Name: "db", SecretString: "two"})
+				return err
+			}},
+			{"DeleteSecret", func() error {
+				_, err := s.DeleteSecret(&secretsmanager.DeleteSecretRequest{SecretID: "db"})
+				return err
+			}},
+		}
+		for _, check := range checks {
+			if got := code(check.do()); got != "InvalidRequestException" {
+				t.Errorf("%v: %v got %v, want InvalidRequestException", test.name, check.op, got)
+			}
+		}
+
+		if _, err := s.RestoreSecret(&secretsmanager.RestoreSecretRequest{SecretID: "db"}); err != nil {
+			t.Errorf("%v: %v", test.name, err)
+			continue
+		}
+		value, err := s.GetSecretValue(&secretsmanager.GetSecretValueRequest{SecretID: "db"})
+		if err != nil || value.SecretString != "one" {
+			t.Errorf("%v: after restore got %+v, %v", test.name, value, err)
+		}
+	}
+}
+
+func TestListSecrets(t *testing.T) {
+	s, _, clock := newTestSecretsManager()
+	for _, sec := range []secretsmanager.CreateSecretRequest{
+		{Name: "prod/db", Description: "database", Tags: []secretsmanager.Tag{{Key: "env", Value: "prod"}}},
+		{Name: "prod/api", Description: "api key", Tags: []secretsmanager.Tag{{Key: "env", Value: "prod"}, {Key: "team", Value: "web"}}},
+		{Name: "dev/db", Description: "database", Tags: []secretsmanager.Tag{{Key: "env", Value: "dev"}}},
+		{Name: "old", Description: "deleted"},
+	} {
+		sec := sec
+		if _, err := s.CreateSecret(&sec); err != nil {
+			t.Fatal(err)
+		}
+		clock.now = clock.now.Add(time.Minute)
+	}
+	if _, err := s.DeleteSecret(&secretsmanager.DeleteSecretRequest{SecretID: "old"}); err != nil {
+		t.Fatal(err)
+	}
+
+	filter := func(key string, values ...string) []secretsmanager.Filter {
+		return []secretsmanager.Filter{{Key: key, Values: values}}
+	}
+
+	tests := []struct {
+		name string
+		req  secretsmanager.ListSecretsRequest
+		want []string
+		code string
+	}{
+		{"all", secretsmanager.ListSecretsRequest{}, []string{"prod/db", "prod/api", "dev/db"}, ""},
+		{"descending", secretsmanager.ListSecretsRequest{SortOrder: "desc"}, []string{"dev/db", "prod/api", "prod/db"}, ""},
+		{"planned deletion", secretsmanager.ListSecretsRequest{IncludePlannedDeletion: true}, []string{"prod/db", "prod/api", "dev/db", "old"}, ""},
+		{"name prefix", secretsmanager.ListSecretsRequest{Filters: filter("name", "prod/")}, []string{"prod/db", "prod/api"}, ""},
+		{"name values", secretsmanager.ListSecretsRequest{Filters: filter("name", "dev/", "prod/a")}, []string{"prod/api", "dev/db"}, ""},
+		{"negated name", secretsmanager.ListSecretsRequest{Filters: filter("name", "!prod/")}, []string{"dev/db"}, ""},
+		{"description", secretsmanager.ListSecretsRequest{Filters: filter("description", "data")}, []string{"prod/db", "dev/db"}, ""},
+		{"tag key", secretsmanager.ListSecretsRequest{Filters: filter("tag-key", "team")}, []string{"prod/api"}, ""},
+		{"tag value", secretsmanager.ListSecretsRequest{Filters: filter("tag-value", "dev")}, []string{"dev/db"}, ""},
+		{"all fields", secretsmanager.ListSecretsRequest{Filters: filter("all", "web")}, []string{"prod/api"}, ""},
+		{"several filters", secretsmanager.ListSecretsRequest{Filters: append(filter("tag-value", "prod"), filter("description", "data")...)}, []string{"prod/db"}, ""},
+		{"bad filter key", secretsmanager.ListSecretsRequest{Filters: filter("owner", "x")}, nil, "InvalidParameterException"},
+		{"bad sort order", secretsmanager.ListSecretsRequest{SortOrder: "up"}, nil, "ValidationException"},
+		{"bad max results", secretsmanager.ListSecretsRequest{MaxResults: 101}, nil, "InvalidParameterException"},
+		{"bad token", secretsmanager.ListSecretsRequest{NextToken: "!!"}, nil, "InvalidNextTokenException"},
+	}
+
+	for _, test := range tests {
+		out, err := s.ListSecrets(&test.req)
+		if got := code(err); got != test.code {
+			t.Errorf("%v: got %v, want %v", test.name, got, test.code)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		names := []string{}
+		for _, sec := range out.SecretList {
+			names = append(names, sec.Name)
+		}
+		if !reflect.DeepEqual(names, test.want) {
+			t.Errorf("%v: got %v, want %v", test.name, names, test.want)
+		}
+	}
+
+	// Paging walks the whole list.
+	names := []string{}
+	next := ""
+	for pages := 0; ; pages++ {
+		if pages > 3 {
+			t.Fatal("too many pages")
+		}
+		out, err := s.ListSecrets(&secretsmanager.ListSecretsRequest{MaxResults: 2, NextToken: next, IncludePlannedDeletion: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(out.SecretList) > 2 {
+			t.Errorf("page of %v", len(out.SecretList))
+		}
+		for _, sec := range out.SecretList {
+			names = append(names, sec.Name)
+		}
+		if next = out.NextToken; next == "" {
+			break
+		}
+	}
+	sort.Strings(names)
+	if want := []string{"dev/db", "old", "prod/api", "prod/db"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("paged through %v, want %v", names, want)
+	}
+}
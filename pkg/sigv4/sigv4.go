@@ -0,0 +1,236 @@
+// Package sigv4 signs and verifies requests with AWS Signature Version 4.
+package sigv4
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Algorithm is the only signing algorithm supported.
+const Algorithm = "AWS4-HMAC-SHA256"
+
+// TimeFormat is the format of the X-Amz-Date header.
+const TimeFormat = "20060102T150405Z"
+
+// MaxSkew is how far a request's X-Amz-Date may be from the verifier's clock.
+const MaxSkew = 5 * time.Minute
+
+// Credentials are the credentials used to sign a request.
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// Errors returned by Verify.
+var (
+	ErrMissingAuth      = errors.New("sigv4: missing or malformed authorization")
+	ErrUnknownAccessKey = errors.New("sigv4: unknown access key")
+	ErrExpired          = errors.New("sigv4: request time is too skewed")
+	ErrSignature        = errors.New("sigv4: signature does not match")
+)
+
+// Authorization is a parsed Authorization header.
+type Authorization struct {
+	AccessKeyID   string
+	Date          string
+	Region        string
+	Service       string
+	SignedHeaders []string
+	Signature     string
+}
+
+// ParseAuthorization parses a SigV4 Authorization header.
+func ParseAuthorization(header string) (*Authorization, error) {
+	if !strings.HasPrefix(header, Algorithm+" ") {
+		return nil, ErrMissingAuth
+	}
+
+	out := &Authorization{}
+	for _, part := range strings.Split(header[len(Algorithm)+1:], ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			return nil, ErrMissingAuth
+		}
+		switch kv[0] {
+		case "Credential":
+			scope := strings.Split(kv[1], "/")
+			if len(scope) != 5 || scope[4] != "aws4_request" {
+				return nil, ErrMissingAuth
+			}
+			out.AccessKeyID, out.Date, out.Region, out.Service = scope[0], scope[1], scope[2], scope[3]
+		case "SignedHeaders":
+			out.SignedHeaders = strings.Split(kv[1], ";")
+		case "Signature":
+			out.Signature = kv[1]
+		}
+	}
+
+	if out.AccessKeyID == "" || len(out.SignedHeaders) == 0 || out.Signature == "" {
+		return nil, ErrMissingAuth
+	}
+	return out, nil
+}
+
+func hashHex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// escape URI-encodes a string the way SigV4 wants: everything but unreserved
+// characters is percent-encoded.
+func escape(s string, keepSlash bool) string {
+	buf := strings.Builder{}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (keepSlash && c == '/') {
+			buf.WriteByte(c)
+		} else {
+			fmt.Fprintf(&buf, "%%%02X", c)
+		}
+	}
+	return buf.String()
+}
+
+func canonicalQuery(values url.Values) string {
+	pairs := []string{}
+	for k, vs := range values {
+		for _, v := range vs {
+			pairs = append(pairs, escape(k, false)+"="+escape(v, false))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+func headerValue(req *http.Request, name string) string {
+	if name == "host" {
+		if req.Host != "" {
+			return req.Host
+		}
+		return req.URL.Host
+	}
+	values := []string{}
+	for _, v := range req.Header[http.CanonicalHeaderKey(name)] {
+		values = append(values, strings.Join(strings.Fields(v), " "))
+	}
+	return strings.Join(values, ",")
+}
+
+func canonicalRequest(req *http.Request, signedHeaders []string, payloadHash string) string {
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if unescaped, err := url.PathUnescape(path); err == nil {
+		path = escape(unescaped, true)
+	}
+
+	headers := strings.Builder{}
+	for _, h := range signedHeaders {
+		headers.WriteString(h + ":" + headerValue(req, h) + "\n")
+	}
+
+	return strings.Join([]string{
+		req.Method,
+		path,
+		canonicalQuery(req.URL.Query()),
+		headers.String(),
+		strings.Join(signedHeaders, ";"),
+		payloadHash,
+	}, "\n")
+}
+
+func signature(secret, date, region, service, stringToSign string) string {
+	key := hmacSHA256([]byte("AWS4"+secret), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func stringToSign(amzDate, scope, canonical string) string {
+	return strings.Join([]string{Algorithm, amzDate, scope, hashHex([]byte(canonical))}, "\n")
+}
+
+// Sign signs the request with the given body, setting the X-Amz-Date,
+// X-Amz-Content-Sha256 and Authorization headers.
+func Sign(req *http.Request, body []byte, creds Credentials, region, service string, now time.Time) {
+	amzDate := now.UTC().Format(TimeFormat)
+	date := amzDate[:8]
+	payloadHash := hashHex(body)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	signed := []string{"host"}
+	for name := range req.Header {
+		lower := strings.ToLower(name)
+		if lower == "content-type" || strings.HasPrefix(lower, "x-amz-") {
+			signed = append(signed, lower)
+		}
+	}
+	sort.Strings(signed)
+
+	scope := strings.Join([]string{date, region, service, "aws4_request"}, "/")
+	canonical := canonicalRequest(req, signed, payloadHash)
+	sig := signature(creds.SecretAccessKey, date, region, service, stringToSign(amzDate, scope, canonical))
+
+	req.Header.Set("Authorization", fmt.Sprintf("%v Credential=%v/%v, SignedHeaders=%v, Signature=%v",
+		Algorithm, creds.AccessKeyID, scope, strings.Join(signed, ";"), sig))
+}
+
+// Verify checks the request's signature, looking up the secret key for its
+// access key with the given function. It returns the parsed authorization.
+func Verify(req *http.Request, body []byte, secret func(accessKeyID string) (string, bool), now time.Time) (*Authorization, error) {
+	auth, err := ParseAuthorization(req.Header.Get("Authorization"))
+	if err != nil {
+		return nil, err
+	}
+
+	key, ok := secret(auth.AccessKeyID)
+	if !ok {
+		return nil, ErrUnknownAccessKey
+	}
+
+	amzDate := req.Header.Get("X-Amz-Date")
+	t, err := time.Parse(TimeFormat, amzDate)
+	if err != nil || !strings.HasPrefix(amzDate, auth.Date) {
+		return nil, ErrMissingAuth
+	}
+	if skew := now.Sub(t); skew > MaxSkew || skew < -MaxSkew {
+		return nil, ErrExpired
+	}
+
+	payloadHash := hashHex(body)
+	if h := req.Header.Get("X-Amz-Content-Sha256"); h != "" && h != payloadHash {
+		return nil, ErrSignature
+	}
+
+	scope := strings.Join([]string{auth.Date, auth.Region, auth.Service, "aws4_request"}, "/")
+	canonical := canonicalRequest(req, auth.SignedHeaders, payloadHash)
+	want := signature(key, auth.Date, auth.Region, auth.Service, stringToSign(amzDate, scope, canonical))
+
+	if !hmac.Equal([]byte(want), []byte(auth.Signature)) {
+		return nil, ErrSignature
+	}
+	return auth, nil
+}
@@ -0,0 +1,109 @@
+package sigv4
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testCreds = Credentials{
+	AccessKeyID:     "AKIDEXAMPLE",
+	SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+}
+
+func testSecret(accessKeyID string) (string, bool) {
+	if accessKeyID == testCreds.AccessKeyID {
+		return testCreds.SecretAccessKey, true
+	}
+	return "", false
+}
+
+// TestVerifyExample checks Verify against the example request in the AWS
+// General Reference's "Signature Version 4 signing process".
+func TestVerifyExample(t *testing.T) {
+	req := httptest.NewRequest("GET", "https://iam.amazonaws.com/?Action=ListUsers&Version=2010-05-08", nil)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	req.Header.Set("X-Amz-Date", "20150830T123600Z")
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/iam/aws4_request, "+
+		"SignedHeaders=content-type;host;x-amz-date, "+
+		"Signature=5d672d79c15b13162d9279b0855cfba6789a8edb4c82c400e06b5924a6f2b5d7")
+
+	now := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+	auth, err := Verify(req, nil, testSecret, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if auth.Service != "iam" || auth.Region != "us-east-1" || auth.AccessKeyID != "AKIDEXAMPLE" {
+		t.Errorf("parsed %+v", auth)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	body := []byte(`{"KeyId":"alias/test"}`)
+
+	tests := []struct {
+		name   string
+		modify func(req *http.Request)
+		body   []byte
+		now    time.Time
+		err    error
+	}{
+		{"valid", nil, body, now, nil},
+		{"clock ahead within skew", nil, body, now.Add(MaxSkew - time.Second), nil},
+		{"clock behind within skew", nil, body, now.Add(-MaxSkew + time.Second), nil},
+		{"too old", nil, body, now.Add(MaxSkew + time.Second), ErrExpired},
+		{"too new", nil, body, now.Add(-MaxSkew - time.Second), ErrExpired},
+		{"tampered body", nil, []byte(`{"KeyId":"alias/other"}`), now, ErrSignature},
+		{"tampered signed header", func(r *http.Request) { r.Header.Set("X-Amz-Target", "TrentService.Decrypt") }, body, now, ErrSignature},
+		{"unsigned header", func(r *http.Request) { r.Header.Set("User-Agent", "other") }, body, now, nil},
+		{"tampered path", func(r *http.Request) { r.URL.Path = "/other" }, body, now, ErrSignature},
+		{"tampered query", func(r *http.Request) { r.URL.RawQuery = "a=2" }, body, now, ErrSignature},
+		{"unknown access key", func(r *http.Request) {
+			r.Header.Set("Authorization", strings.Replace(r.Header.Get("Authorization"), "AKIDEXAMPLE", "AKIDOTHER", 1))
+		}, body, now, ErrUnknownAccessKey},
+		{"missing authorization", func(r *http.Request) { r.Header.Del("Authorization") }, body, now, ErrMissingAuth},
+		{"date outside scope", func(r *http.Request) { r.Header.Set("X-Amz-Date", "20240103T030405Z") }, body, now, ErrMissingAuth},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("POST", "http://localhost:4566/path?a=1", nil)
+		req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+		req.Header.Set("X-Amz-Target", "TrentService.Encrypt")
+		Sign(req, body, testCreds, "us-local-1", "kms", now)
+		if test.modify != nil {
+			test.modify(req)
+		}
+
+		_, err := Verify(req, test.body, testSecret, test.now)
+		if err != test.err {
+			t.Errorf("%v: got %v, want %v", test.name, err, test.err)
+		}
+	}
+}
+
+func TestParseAuthorization(t *testing.T) {
+	tests := []struct {
+		header string
+		ok     bool
+	}{
+		{"AWS4-HMAC-SHA256 Credential=AK/20240102/us-local-1/sqs/aws4_request, SignedHeaders=host, Signature=abc", true},
+		{"AWS4-HMAC-SHA256 Credential=AK/20240102/us-local-1/sqs/aws4_request, SignedHeaders=host", false},
+		{"AWS4-HMAC-SHA256 Credential=AK/20240102/us-local-1/sqs, SignedHeaders=host, Signature=abc", false},
+		{"AWS4-HMAC-SHA256 Credential=AK/20240102/us-local-1/sqs/other, SignedHeaders=host, Signature=abc", false},
+		{"AWS AK:signature", false},
+		{"", false},
+	}
+
+	for _, test := range tests {
+		auth, err := ParseAuthorization(test.header)
+		if (err == nil) != test.ok {
+			t.Errorf("%q: got %v", test.header, err)
+		}
+		if test.ok && auth.Service != "sqs" {
+			t.Errorf("%q: service %v", test.header, auth.Service)
+		}
+	}
+}
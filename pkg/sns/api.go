@@ -0,0 +1,327 @@
+package sns
+
+import (
+	"encoding/xml"
+	"sort"
+)
+
+// SNS is the service interface for Amazon Simple Notification Service.
+type SNS interface {
+	CreateTopic(*CreateTopicRequest) (*CreateTopicResult, error)
+	DeleteTopic(*DeleteTopicRequest) (*DeleteTopicResult, error)
+	ListTopics(*ListTopicsRequest) (*ListTopicsResult, error)
+	GetTopicAttributes(*GetTopicAttributesRequest) (*GetTopicAttributesResult, error)
+	SetTopicAttributes(*SetTopicAttributesRequest) (*SetTopicAttributesResult, error)
+
+	Subscribe(*SubscribeRequest) (*SubscribeResult, error)
+	ConfirmSubscription(*ConfirmSubscriptionRequest) (*ConfirmSubscriptionResult, error)
+	Unsubscribe(*UnsubscribeRequest) (*UnsubscribeResult, error)
+	ListSubscriptions(*ListSubscriptionsRequest) (*ListSubscriptionsResult, error)
+	ListSubscriptionsByTopic(*ListSubscriptionsByTopicRequest) (*ListSubscriptionsByTopicResult, error)
+	GetSubscriptionAttributes(*GetSubscriptionAttributesRequest) (*GetSubscriptionAttributesResult, error)
+	SetSubscriptionAttributes(*SetSubscriptionAttributesRequest) (*SetSubscriptionAttributesResult, error)
+
+	Publish(*PublishRequest) (*PublishResult, error)
+	PublishBatch(*PublishBatchRequest) (*PublishBatchResult, error)
+
+	TagResource(*TagResourceRequest) (*TagResourceResult, error)
+	UntagResource(*UntagResourceRequest) (*UntagResourceResult, error)
+	ListTagsForResource(*ListTagsForResourceRequest) (*ListTagsForResourceResult, error)
+}
+
+// Attributes is a map of topic or subscription attributes. It is written as
+// a list of entries, each with a key and a value.
+type Attributes map[string]string
+
+// MarshalXML writes the attributes as entries sorted by key.
+func (a Attributes) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	type entry struct {
+		Key   string `xml:"key"`
+		Value string `xml:"value"`
+	}
+
+	keys := make([]string, 0, len(a))
+	for k := range a {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+	for _, k := range keys {
+		if err := e.EncodeElement(&entry{k, a[k]}, xml.StartElement{Name: xml.Name{Local: "entry"}}); err != nil {
+			return err
+		}
+	}
+	return e.EncodeToken(start.End())
+}
+
+// MessageAttributeValue is the value of a message attribute. DataType is
+// String, String.Array, Number or Binary.
+type MessageAttributeValue struct {
+	BinaryValue []byte `query:"BinaryValue"`
+	DataType    string `query:"DataType"`
+	StringValue string `query:"StringValue"`
+}
+
+// Tag is a topic tag.
+type Tag struct {
+	Key   string `query:"Key" xml:"Key"`
+	Value string `query:"Value" xml:"Value"`
+}
+
+// Topic names a topic.
+type Topic struct {
+	TopicArn string `xml:"TopicArn"`
+}
+
+// Subscription describes a subscription. SubscriptionArn is
+// PendingConfirmation until the subscription is confirmed.
+type Subscription struct {
+	Endpoint        string `xml:"Endpoint"`
+	Owner           string `xml:"Owner"`
+	Protocol        string `xml:"Protocol"`
+	SubscriptionArn string `xml:"SubscriptionArn"`
+	TopicArn        string `xml:"TopicArn"`
+}
+
+//
+// API shapes for topics.
+//
+
+// CreateTopicRequest is a request to CreateTopic. FIFO topics have names
+// ending in .fifo and the FifoTopic attribute set to true.
+type CreateTopicRequest struct {
+	Attributes Attributes `query:"Attributes"`
+	Name       string     `query:"Name"`
+	Tags       []Tag      `query:"Tags"`
+}
+
+// CreateTopicResult is the result of CreateTopic.
+type CreateTopicResult struct {
+	TopicArn string `xml:"TopicArn"`
+}
+
+// DeleteTopicRequest is a request to DeleteTopic.
+type DeleteTopicRequest struct {
+	TopicArn string `query:"TopicArn"`
+}
+
+// DeleteTopicResult is the result of DeleteTopic.
+type DeleteTopicResult struct{}
+
+// ListTopicsRequest is a request to ListTopics.
+type ListTopicsRequest struct {
+	NextToken string `query:"NextToken"`
+}
+
+// ListTopicsResult is the result of ListTopics.
+type ListTopicsResult struct {
+	NextToken string  `xml:"NextToken,omitempty"`
+	Topics    []Topic `xml:"Topics>member"`
+}
+
+// GetTopicAttributesRequest is a request to GetTopicAttributes.
+type GetTopicAttributesRequest struct {
+	TopicArn string `query:"TopicArn"`
+}
+
+// GetTopicAttributesResult is the result of GetTopicAttributes.
+type GetTopicAttributesResult struct {
+	Attributes Attributes `xml:"Attributes"`
+}
+
+// SetTopicAttributesRequest is a request to SetTopicAttributes.
+type SetTopicAttributesRequest struct {
+	AttributeName  string `query:"AttributeName"`
+	AttributeValue string `query:"AttributeValue"`
+	TopicArn       string `query:"TopicArn"`
+}
+
+// SetTopicAttributesResult is the result of SetTopicAttributes.
+type SetTopicAttributesResult struct{}
+
+//
+// API shapes for subscriptions.
+//
+
+// SubscribeRequest is a request to Subscribe. Protocol is sqs, http, https or
+// sink; a sink endpoint names a sink given to New with WithSink.
+type SubscribeRequest struct {
+	Attributes            Attributes `query:"Attributes"`
+	Endpoint              string     `query:"Endpoint"`
+	Protocol              string     `query:"Protocol"`
+	ReturnSubscriptionArn bool       `query:"ReturnSubscriptionArn"`
+	TopicArn              string     `query:"TopicArn"`
+}
+
+// SubscribeResult is the result of Subscribe. SubscriptionArn is "pending
+// confirmation" for subscriptions that must be confirmed, unless the request
+// set ReturnSubscriptionArn.
+type SubscribeResult struct {
+	SubscriptionArn string `xml:"SubscriptionArn"`
+}
+
+// ConfirmSubscriptionRequest is a request to ConfirmSubscription.
+type ConfirmSubscriptionRequest struct {
+	AuthenticateOnUnsubscribe string `query:"AuthenticateOnUnsubscribe"`
+	Token                     string `query:"Token"`
+	TopicArn                  string `query:"TopicArn"`
+}
+
+// ConfirmSubscriptionResult is the result of ConfirmSubscription.
+type ConfirmSubscriptionResult struct {
+	SubscriptionArn string `xml:"SubscriptionArn"`
+}
+
+// UnsubscribeRequest is a request to Unsubscribe.
+type UnsubscribeRequest struct {
+	SubscriptionArn string `query:"SubscriptionArn"`
+}
+
+// UnsubscribeResult is the result of Unsubscribe.
+type UnsubscribeResult struct{}
+
+// ListSubscriptionsRequest is a request to ListSubscriptions.
+type ListSubscriptionsRequest struct {
+	NextToken string `query:"NextToken"`
+}
+
+// ListSubscriptionsResult is the result of ListSubscriptions.
+type ListSubscriptionsResult struct {
+	NextToken     string         `xml:"NextToken,omitempty"`
+	Subscriptions []Subscription `xml:"Subscriptions>member"`
+}
+
+// ListSubscriptionsByTopicRequest is a request to ListSubscriptionsByTopic.
+type ListSubscriptionsByTopicRequest struct {
+	NextToken string `query:"NextToken"`
+	TopicArn  string `query:"TopicArn"`
+}
+
+// ListSubscriptionsByTopicResult is the result of ListSubscriptionsByTopic.
+type ListSubscriptionsByTopicResult struct {
+	NextToken     string         `xml:"NextToken,omitempty"`
+	Subscriptions []Subscription `xml:"Subscriptions>member"`
+}
+
+// GetSubscriptionAttributesRequest is a request to
+// GetSubscriptionAttributes.
+type GetSubscriptionAttributesRequest struct {
+	SubscriptionArn string `query:"SubscriptionArn"`
+}
+
+// GetSubscriptionAttributesResult is the result of
+// GetSubscriptionAttributes.
+type GetSubscriptionAttributesResult struct {
+	Attributes Attributes `xml:"Attributes"`
+}
+
+// SetSubscriptionAttributesRequest is a request to
+// SetSubscriptionAttributes.
+type SetSubscriptionAttributesRequest struct {
+	AttributeName   string `query:"AttributeName"`
+	AttributeValue  string `query:"AttributeValue"`
+	SubscriptionArn string `query:"SubscriptionArn"`
+}
+
+// SetSubscriptionAttributesResult is the result of
+// SetSubscriptionAttributes.
+type SetSubscriptionAttributesResult struct{}
+
+//
+// API shapes for publishing.
+//
+
+// PublishRequest is a request to Publish. TargetArn is a synonym for
+// TopicArn; MessageStructure "json" means Message is a JSON object with a
+// message for each protocol and a "default" one.
+type PublishRequest struct {
+	Message                string                           `query:"Message"`
+	MessageAttributes      map[string]MessageAttributeValue `query:"MessageAttributes,key=Name,value=Value"`
+	MessageDeduplicationID string                           `query:"MessageDeduplicationId"`
+	MessageGroupID         string                           `query:"MessageGroupId"`
+	MessageStructure       string                           `query:"MessageStructure"`
+	PhoneNumber            string                           `query:"PhoneNumber"`
+	Subject                string                           `query:"Subject"`
+	TargetArn              string                           `query:"TargetArn"`
+	TopicArn               string                           `query:"TopicArn"`
+}
+
+// PublishResult is the result of Publish. SequenceNumber is only set for
+// FIFO topics.
+type PublishResult struct {
+	MessageID      string `xml:"MessageId"`
+	SequenceNumber string `xml:"SequenceNumber,omitempty"`
+}
+
+// PublishBatchRequestEntry is a message in a PublishBatch request.
+type PublishBatchRequestEntry struct {
+	ID                     string                           `query:"Id"`
+	Message                string                           `query:"Message"`
+	MessageAttributes      map[string]MessageAttributeValue `query:"MessageAttributes,key=Name,value=Value"`
+	MessageDeduplicationID string                           `query:"MessageDeduplicationId"`
+	MessageGroupID         string                           `query:"MessageGroupId"`
+	MessageStructure       string                           `query:"MessageStructure"`
+	Subject                string                           `query:"Subject"`
+}
+
+// PublishBatchRequest is a request to PublishBatch.
+type PublishBatchRequest struct {
+	PublishBatchRequestEntries []PublishBatchRequestEntry `query:"PublishBatchRequestEntries"`
+	TopicArn                   string                     `query:"TopicArn"`
+}
+
+// PublishBatchResultEntry is a message PublishBatch published.
+type PublishBatchResultEntry struct {
+	ID             string `xml:"Id"`
+	MessageID      string `xml:"MessageId"`
+	SequenceNumber string `xml:"SequenceNumber,omitempty"`
+}
+
+// BatchResultErrorEntry says why one entry of a batch failed.
+type BatchResultErrorEntry struct {
+	Code        string `xml:"Code"`
+	ID          string `xml:"Id"`
+	Message     string `xml:"Message,omitempty"`
+	SenderFault bool   `xml:"SenderFault"`
+}
+
+// PublishBatchResult is the result of PublishBatch.
+type PublishBatchResult struct {
+	Failed     []BatchResultErrorEntry   `xml:"Failed>member"`
+	Successful []PublishBatchResultEntry `xml:"Successful>member"`
+}
+
+//
+// API shapes for tags.
+//
+
+// TagResourceRequest is a request to TagResource.
+type TagResourceRequest struct {
+	ResourceArn string `query:"ResourceArn"`
+	Tags        []Tag  `query:"Tags"`
+}
+
+// TagResourceResult is the result of TagResource.
+type TagResourceResult struct{}
+
+// UntagResourceRequest is a request to UntagResource.
+type UntagResourceRequest struct {
+	ResourceArn string   `query:"ResourceArn"`
+	TagKeys     []string `query:"TagKeys"`
+}
+
+// UntagResourceResult is the result of UntagResource.
+type UntagResourceResult struct{}
+
+// ListTagsForResourceRequest is a request to ListTagsForResource.
+type ListTagsForResourceRequest struct {
+	ResourceArn string `query:"ResourceArn"`
+}
+
+// ListTagsForResourceResult is the result of ListTagsForResource.
+type ListTagsForResourceResult struct {
+	Tags []Tag `xml:"Tags>member"`
+}
@@ -0,0 +1,57 @@
+package sns
+
+import (
+	"github.com/fernomac/aws-local/pkg/common"
+	"github.com/fernomac/aws-local/pkg/envelope"
+	"github.com/fernomac/aws-local/pkg/kms"
+)
+
+// sealed is a message encrypted under a data key from KMS. Messages published
+// to topics with a KmsMasterKeyId are kept sealed until they are delivered.
+type sealed struct {
+	dataKey    string
+	iv         []byte
+	ciphertext []byte
+}
+
+// encryptionContext binds a data key to the topic it protects.
+func encryptionContext(topicArn string) map[string]string {
+	return map[string]string{"aws:sns:topicArn": topicArn}
+}
+
+// kmsCodes are the errors SNS returns for errors from KMS.
+var kmsCodes = envelope.Table(map[string]string{
+	"AccessDeniedException":      "KMSAccessDenied",
+	"DisabledException":          "KMSDisabled",
+	"InvalidCiphertextException": "KMSInvalidState",
+	"InvalidKeyUsageException":   "KMSInvalidState",
+	"KMSInvalidStateException":   "KMSInvalidState",
+	"NotFoundException":          "KMSNotFound",
+	"ThrottlingException":        "KMSThrottling",
+}, "KMSInvalidState")
+
+// seal encrypts a message under a new data key for the topic.
+func seal(k kms.KMS, keyID string, topicArn string, messageID string, message string) (*sealed, error) {
+	dk, err := envelope.GenerateDataKey(k, keyID, encryptionContext(topicArn), kmsCodes)
+	if err != nil {
+		return nil, err
+	}
+	iv, ciphertext, err := envelope.Seal(dk.Plaintext, []byte(message), []byte(messageID))
+	if err != nil {
+		return nil, err
+	}
+	return &sealed{dataKey: dk.Ciphertext, iv: iv, ciphertext: ciphertext}, nil
+}
+
+// open decrypts a sealed message, asking KMS to decrypt its data key.
+func open(k kms.KMS, topicArn string, messageID string, s *sealed) (string, error) {
+	dk, err := envelope.DecryptDataKey(k, s.dataKey, encryptionContext(topicArn), kmsCodes)
+	if err != nil {
+		return "", err
+	}
+	message, err := envelope.Open(dk.Plaintext, s.iv, s.ciphertext, []byte(messageID))
+	if err != nil {
+		return "", common.Errorf("KMSInvalidState", "The message could not be decrypted.")
+	}
+	return string(message), nil
+}
@@ -0,0 +1,322 @@
+package sns
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/fernomac/aws-local/pkg/common"
+	"github.com/fernomac/aws-local/pkg/sqs"
+)
+
+// Delivery retries.
+const (
+	deliveryAttempts = 3
+	deliveryBackoff  = time.Second
+	deliveryTimeout  = 15 * time.Second
+)
+
+// document is the JSON HTTP endpoints, sinks and non-raw queue
+// subscriptions are sent. Messages aren't signed, so it has no Signature or
+// SigningCertURL.
+type document struct {
+	Type              string                       `json:"Type"`
+	MessageID         string                       `json:"MessageId"`
+	Token             string                       `json:"Token,omitempty"`
+	TopicArn          string                       `json:"TopicArn"`
+	Subject           string                       `json:"Subject,omitempty"`
+	Message           string                       `json:"Message"`
+	SequenceNumber    string                       `json:"SequenceNumber,omitempty"`
+	Timestamp         string                       `json:"Timestamp"`
+	SignatureVersion  string                       `json:"SignatureVersion"`
+	SubscribeURL      string                       `json:"SubscribeURL,omitempty"`
+	UnsubscribeURL    string                       `json:"UnsubscribeURL,omitempty"`
+	MessageAttributes map[string]documentAttribute `json:"MessageAttributes,omitempty"`
+}
+
+type documentAttribute struct {
+	Type  string `json:"Type"`
+	Value string `json:"Value"`
+}
+
+func timestamp(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05.000Z")
+}
+
+// notification is a published message on its way to the subscriptions that
+// want it. Its message is sealed if the topic is encrypted.
+type notification struct {
+	topicArn  string
+	messageID string
+	subject   string
+	message   string
+	sealed    *sealed
+	structure string
+	attrs     map[string]MessageAttributeValue
+	groupID   string
+	dedupID   string
+	seq       string
+	signature string
+	timestamp time.Time
+	targets   []target
+}
+
+// target is a copy of what a notification needs of a subscription, taken
+// while holding the lock.
+type target struct {
+	arn        string
+	protocol   string
+	endpoint   string
+	raw        bool
+	deadLetter string
+}
+
+func newTarget(sub *subscription) target {
+	return target{
+		arn:        sub.arn,
+		protocol:   sub.protocol,
+		endpoint:   sub.endpoint,
+		raw:        sub.raw(),
+		deadLetter: sub.deadLetterQueue(),
+	}
+}
+
+// messageFor picks the message for a protocol from a message with the json
+// structure.
+func messageFor(message string, structure string, protocol string) string {
+	if structure != "json" {
+		return message
+	}
+	messages := map[string]string{}
+	json.Unmarshal([]byte(message), &messages)
+	if m, ok := messages[protocol]; ok {
+		return m
+	}
+	return messages["default"]
+}
+
+func (s *sns) actionURL(params url.Values) string {
+	params.Set("Version", Version)
+	return s.endpoint + "/?" + params.Encode()
+}
+
+func (s *sns) unsubscribeURL(subscriptionArn string) string {
+	return s.actionURL(url.Values{"Action": {"Unsubscribe"}, "SubscriptionArn": {subscriptionArn}})
+}
+
+// body is what a target is sent for a notification.
+func (s *sns) body(n *notification, message string, t target) string {
+	if t.raw {
+		return message
+	}
+
+	env := &document{
+		Type:             "Notification",
+		MessageID:        n.messageID,
+		TopicArn:         n.topicArn,
+		Subject:          n.subject,
+		Message:          message,
+		SequenceNumber:   n.seq,
+		Timestamp:        timestamp(n.timestamp),
+		SignatureVersion: n.signature,
+		UnsubscribeURL:   s.unsubscribeURL(t.arn),
+	}
+	if len(n.attrs) > 0 {
+		env.MessageAttributes = map[string]documentAttribute{}
+		for name, a := range n.attrs {
+			value := a.StringValue
+			if a.DataType == "Binary" {
+				value = base64.StdEncoding.EncodeToString(a.BinaryValue)
+			}
+			env.MessageAttributes[name] = documentAttribute{Type: a.DataType, Value: value}
+		}
+	}
+
+	out, err := json.Marshal(env)
+	if err != nil {
+		panic(err)
+	}
+	return string(out)
+}
+
+// deliver sends a notification to its targets. Queues and sinks get it before
+// deliver returns; HTTP endpoints get it in the background. The caller must
+// not hold s.lock.
+func (s *sns) deliver(n *notification) {
+	message := n.message
+	if n.sealed != nil {
+		m, err := open(s.kms, n.topicArn, n.messageID, n.sealed)
+		if err != nil {
+			return
+		}
+		message = m
+	}
+
+	for _, t := range n.targets {
+		d := &Delivery{
+			Type:            "Notification",
+			MessageID:       n.messageID,
+			TopicArn:        n.topicArn,
+			SubscriptionArn: t.arn,
+			Raw:             t.raw,
+			Body:            s.body(n, messageFor(message, n.structure, t.protocol), t),
+		}
+
+		var attrs map[string]MessageAttributeValue
+		if t.raw {
+			attrs = n.attrs
+		}
+
+		switch t.protocol {
+		case protocolSQS:
+			if err := s.sendToQueue(t.endpoint, d.Body, attrs, n.groupID, n.dedupID); err != nil {
+				s.deadLetter(t, d.Body, attrs, n)
+			}
+
+		case protocolSink:
+			if err := s.sinks[t.endpoint].Deliver(d); err != nil {
+				s.deadLetter(t, d.Body, attrs, n)
+			}
+
+		case protocolHTTP, protocolHTTPS:
+			go func(t target, d *Delivery) {
+				if err := s.post(t.endpoint, d); err != nil {
+					s.deadLetter(t, d.Body, attrs, n)
+				}
+			}(t, d)
+		}
+	}
+}
+
+// deadLetter sends a message that couldn't be delivered to the target's
+// dead-letter queue, if it has one.
+func (s *sns) deadLetter(t target, body string, attrs map[string]MessageAttributeValue, n *notification) {
+	if t.deadLetter != "" {
+		s.sendToQueue(t.deadLetter, body, attrs, n.groupID, n.dedupID)
+	}
+}
+
+// confirm sends a subscription confirmation to an HTTP endpoint or sink.
+func (s *sns) confirm(t target, topicArn string, token string, now time.Time) {
+	env := &document{
+		Type:             "SubscriptionConfirmation",
+		MessageID:        common.NewRequestID(),
+		Token:            token,
+		TopicArn:         topicArn,
+		Message:          fmt.Sprintf("You have chosen to subscribe to the topic %v.\nTo confirm the subscription, visit the SubscribeURL included in this message.", topicArn),
+		SubscribeURL:     s.actionURL(url.Values{"Action": {"ConfirmSubscription"}, "TopicArn": {topicArn}, "Token": {token}}),
+		Timestamp:        timestamp(now),
+		SignatureVersion: "1",
+	}
+	s.sendControl(t, env)
+}
+
+// unsubscribed tells an HTTP endpoint or sink it has been unsubscribed.
+func (s *sns) unsubscribed(t target, topicArn string, now time.Time) {
+	env := &document{
+		Type:             "UnsubscribeConfirmation",
+		MessageID:        common.NewRequestID(),
+		TopicArn:         topicArn,
+		Message:          fmt.Sprintf("You have chosen to deactivate subscription %v.", t.arn),
+		Timestamp:        timestamp(now),
+		SignatureVersion: "1",
+	}
+	s.sendControl(t, env)
+}
+
+func (s *sns) sendControl(t target, env *document) {
+	body, err := json.Marshal(env)
+	if err != nil {
+		panic(err)
+	}
+	d := &Delivery{
+		Type:            env.Type,
+		MessageID:       env.MessageID,
+		TopicArn:        env.TopicArn,
+		SubscriptionArn: t.arn,
+		Body:            string(body),
+	}
+
+	switch t.protocol {
+	case protocolSink:
+		s.sinks[t.endpoint].Deliver(d)
+	case protocolHTTP, protocolHTTPS:
+		go s.post(t.endpoint, d)
+	}
+}
+
+// post sends a delivery to an HTTP endpoint, retrying a few times if it
+// doesn't answer with a 2xx status.
+func (s *sns) post(endpoint string, d *Delivery) error {
+	var err error
+	for attempt := 0; attempt < deliveryAttempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(deliveryBackoff * time.Duration(attempt))
+		}
+		if err = s.postOnce(endpoint, d); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+func (s *sns) postOnce(endpoint string, d *Delivery) error {
+	req, err := http.NewRequest("POST", endpoint, bytes.NewReader([]byte(d.Body)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=UTF-8")
+	req.Header.Set("x-amz-sns-message-type", d.Type)
+	req.Header.Set("x-amz-sns-message-id", d.MessageID)
+	req.Header.Set("x-amz-sns-topic-arn", d.TopicArn)
+	if d.Type != "SubscriptionConfirmation" {
+		req.Header.Set("x-amz-sns-subscription-arn", d.SubscriptionArn)
+	}
+	if d.Raw {
+		req.Header.Set("x-amz-sns-rawdelivery", "true")
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%v answered %v", endpoint, resp.Status)
+	}
+	return nil
+}
+
+// sendToQueue sends a message to the SQS queue with the given ARN.
+func (s *sns) sendToQueue(arn string, body string, attrs map[string]MessageAttributeValue, groupID string, dedupID string) error {
+	if s.queues == nil {
+		return fmt.Errorf("no SQS to deliver to")
+	}
+	q, err := s.queues.GetQueueURL(&sqs.GetQueueURLRequest{QueueName: queueName(arn)})
+	if err != nil {
+		return err
+	}
+
+	req := &sqs.SendMessageRequest{
+		QueueURL:               q.QueueURL,
+		MessageBody:            body,
+		MessageGroupID:         groupID,
+		MessageDeduplicationID: dedupID,
+	}
+	if len(attrs) > 0 {
+		req.MessageAttributes = sqs.MessageAttributes{}
+		for name, a := range attrs {
+			req.MessageAttributes[name] = sqs.MessageAttributeValue{
+				DataType:    a.DataType,
+				StringValue: a.StringValue,
+				BinaryValue: a.BinaryValue,
+			}
+		}
+	}
+	_, err = s.queues.SendMessage(req)
+	return err
+}
@@ -0,0 +1,368 @@
+package sns
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/fernomac/aws-local/pkg/common"
+)
+
+// Filter policy scopes.
+const (
+	scopeAttributes = "MessageAttributes"
+	scopeBody       = "MessageBody"
+)
+
+// policy is a parsed filter policy. A message matches if every key matches,
+// and one of the $or alternatives does if there are any. A key matches if
+// one of its conditions does, or, in a body policy, if the nested policy
+// matches the nested object.
+type policy struct {
+	keys map[string]*rule
+	or   []*policy
+}
+
+type rule struct {
+	conditions []condition
+	nested     *policy
+}
+
+// condition is a single condition on a value. exists conditions are the
+// only ones that can match a missing value.
+type condition struct {
+	exists *bool
+	match  func(v interface{}) bool
+}
+
+func invalidPolicy(format string, args ...interface{}) error {
+	return common.Errorf("InvalidParameter", "Invalid parameter: FilterPolicy: "+format, args...)
+}
+
+// parsePolicy parses a filter policy for the given scope. Only body policies
+// may nest objects.
+func parsePolicy(s string, scope string) (*policy, error) {
+	raw := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(s), &raw); err != nil {
+		return nil, invalidPolicy("failed to parse JSON")
+	}
+	return parsePolicyObject(raw, scope, 0)
+}
+
+func parsePolicyObject(raw map[string]interface{}, scope string, depth int) (*policy, error) {
+	if depth > 5 {
+		return nil, invalidPolicy("policy is nested too deeply")
+	}
+
+	p := &policy{keys: map[string]*rule{}}
+	for key, value := range raw {
+		if key == "$or" {
+			alts, ok := value.([]interface{})
+			if !ok || len(alts) < 2 {
+				return nil, invalidPolicy("$or must be a list of at least two policies")
+			}
+			for _, alt := range alts {
+				obj, ok := alt.(map[string]interface{})
+				if !ok {
+					return nil, invalidPolicy("$or must be a list of at least two policies")
+				}
+				sub, err := parsePolicyObject(obj, scope, depth+1)
+				if err != nil {
+					return nil, err
+				}
+				p.or = append(p.or, sub)
+			}
+			continue
+		}
+
+		switch v := value.(type) {
+		case map[string]interface{}:
+			if scope != scopeBody {
+				return nil, invalidPolicy("%v must be a list of conditions", key)
+			}
+			nested, err := parsePolicyObject(v, scope, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			p.keys[key] = &rule{nested: nested}
+
+		case []interface{}:
+			if len(v) == 0 {
+				return nil, invalidPolicy("%v must have at least one condition", key)
+			}
+			r := &rule{}
+			for _, c := range v {
+				cond, err := parseCondition(key, c)
+				if err != nil {
+					return nil, err
+				}
+				r.conditions = append(r.conditions, cond)
+			}
+			p.keys[key] = r
+
+		default:
+			return nil, invalidPolicy("%v must be a list of conditions", key)
+		}
+	}
+	return p, nil
+}
+
+func parseCondition(key string, c interface{}) (condition, error) {
+	switch v := c.(type) {
+	case string, float64, bool, nil:
+		return condition{match: func(x interface{}) bool { return x == v }}, nil
+	case map[string]interface{}:
+		if len(v) != 1 {
+			return condition{}, invalidPolicy("%v: a condition must have exactly one operator", key)
+		}
+	default:
+		return condition{}, invalidPolicy("%v: unsupported condition", key)
+	}
+
+	for op, arg := range c.(map[string]interface{}) {
+		switch op {
+		case "exists":
+			b, ok := arg.(bool)
+			if !ok {
+				return condition{}, invalidPolicy("%v: exists must be true or false", key)
+			}
+			return condition{exists: &b}, nil
+
+		case "prefix", "suffix", "equals-ignore-case":
+			s, ok := arg.(string)
+			if !ok {
+				return condition{}, invalidPolicy("%v: %v must be a string", key, op)
+			}
+			return condition{match: stringMatcher(op, s)}, nil
+
+		case "anything-but":
+			match, err := parseAnythingBut(key, arg)
+			if err != nil {
+				return condition{}, err
+			}
+			return condition{match: match}, nil
+
+		case "numeric":
+			match, err := parseNumeric(key, arg)
+			if err != nil {
+				return condition{}, err
+			}
+			return condition{match: match}, nil
+
+		case "cidr":
+			s, _ := arg.(string)
+			_, network, err := net.ParseCIDR(s)
+			if err != nil {
+				return condition{}, invalidPolicy("%v: malformed CIDR %v", key, arg)
+			}
+			return condition{match: func(x interface{}) bool {
+				s, ok := x.(string)
+				ip := net.ParseIP(s)
+				return ok && ip != nil && network.Contains(ip)
+			}}, nil
+
+		default:
+			return condition{}, invalidPolicy("%v: unrecognized operator %v", key, op)
+		}
+	}
+	panic("unreachable")
+}
+
+func stringMatcher(op string, s string) func(interface{}) bool {
+	return func(x interface{}) bool {
+		v, ok := x.(string)
+		if !ok {
+			return false
+		}
+		switch op {
+		case "prefix":
+			return strings.HasPrefix(v, s)
+		case "suffix":
+			return strings.HasSuffix(v, s)
+		default:
+			return strings.EqualFold(v, s)
+		}
+	}
+}
+
+// parseAnythingBut parses the argument of an anything-but condition: a value,
+// a list of values, or a prefix or suffix condition.
+func parseAnythingBut(key string, arg interface{}) (func(interface{}) bool, error) {
+	switch v := arg.(type) {
+	case string, float64:
+		return func(x interface{}) bool { return x != nil && x != v }, nil
+
+	case []interface{}:
+		if len(v) == 0 {
+			return nil, invalidPolicy("%v: anything-but needs at least one value", key)
+		}
+		for _, e := range v {
+			switch e.(type) {
+			case string, float64:
+			default:
+				return nil, invalidPolicy("%v: anything-but values must be strings or numbers", key)
+			}
+		}
+		return func(x interface{}) bool {
+			if x == nil {
+				return false
+			}
+			for _, e := range v {
+				if x == e {
+					return false
+				}
+			}
+			return true
+		}, nil
+
+	case map[string]interface{}:
+		if len(v) == 1 {
+			for op, s := range v {
+				s, ok := s.(string)
+				if ok && (op == "prefix" || op == "suffix") {
+					match := stringMatcher(op, s)
+					return func(x interface{}) bool {
+						_, ok := x.(string)
+						return ok && !match(x)
+					}, nil
+				}
+			}
+		}
+	}
+	return nil, invalidPolicy("%v: unsupported anything-but condition", key)
+}
+
+// parseNumeric parses the argument of a numeric condition, a list of up to
+// two comparisons such as [">", 0, "<=", 5].
+func parseNumeric(key string, arg interface{}) (func(interface{}) bool, error) {
+	list, ok := arg.([]interface{})
+	if !ok || (len(list) != 2 && len(list) != 4) {
+		return nil, invalidPolicy("%v: numeric must be a list of one or two comparisons", key)
+	}
+
+	type comparison struct {
+		op string
+		n  float64
+	}
+	comparisons := []comparison{}
+	for i := 0; i < len(list); i += 2 {
+		op, _ := list[i].(string)
+		n, ok := list[i+1].(float64)
+		if !ok {
+			return nil, invalidPolicy("%v: numeric comparisons need a number", key)
+		}
+		switch op {
+		case "=", "<", "<=", ">", ">=":
+		default:
+			return nil, invalidPolicy("%v: unrecognized numeric operator %v", key, list[i])
+		}
+		if len(list) == 4 && op == "=" {
+			return nil, invalidPolicy("%v: = can't be combined with another comparison", key)
+		}
+		comparisons = append(comparisons, comparison{op, n})
+	}
+
+	return func(x interface{}) bool {
+		v, ok := x.(float64)
+		if !ok {
+			return false
+		}
+		for _, c := range comparisons {
+			var ok bool
+			switch c.op {
+			case "=":
+				ok = v == c.n
+			case "<":
+				ok = v < c.n
+			case "<=":
+				ok = v <= c.n
+			case ">":
+				ok = v > c.n
+			case ">=":
+				ok = v >= c.n
+			}
+			if !ok {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
+
+// matches reports whether a message, as an object of attribute or body
+// values, matches the policy.
+func (p *policy) matches(obj map[string]interface{}) bool {
+	for key, r := range p.keys {
+		value, present := obj[key]
+		if r.nested != nil {
+			nested, ok := value.(map[string]interface{})
+			if !ok || !r.nested.matches(nested) {
+				return false
+			}
+			continue
+		}
+		if !r.matches(value, present) {
+			return false
+		}
+	}
+
+	if len(p.or) == 0 {
+		return true
+	}
+	for _, alt := range p.or {
+		if alt.matches(obj) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *rule) matches(value interface{}, present bool) bool {
+	values := []interface{}{value}
+	if list, ok := value.([]interface{}); ok {
+		values = list
+	}
+
+	for _, c := range r.conditions {
+		if c.exists != nil {
+			if *c.exists == present {
+				return true
+			}
+			continue
+		}
+		if !present {
+			continue
+		}
+		for _, v := range values {
+			if c.match(v) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// attributeValues turns message attributes into values a policy can match:
+// strings, numbers and, for String.Array attributes, lists. Binary
+// attributes can't be matched.
+func attributeValues(attrs map[string]MessageAttributeValue) map[string]interface{} {
+	out := map[string]interface{}{}
+	for name, a := range attrs {
+		switch {
+		case a.DataType == "String.Array":
+			list := []interface{}{}
+			if err := json.Unmarshal([]byte(a.StringValue), &list); err == nil {
+				out[name] = list
+			}
+		case strings.HasPrefix(a.DataType, "Number"):
+			var n float64
+			if _, err := fmt.Sscan(a.StringValue, &n); err == nil {
+				out[name] = n
+			}
+		case strings.HasPrefix(a.DataType, "String"):
+			out[name] = a.StringValue
+		}
+	}
+	return out
+}
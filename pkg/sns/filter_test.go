@@ -0,0 +1,200 @@
+package sns
+
+import (
+	"testing"
+
+	"github.com/fernomac/aws-local/pkg/common"
+)
+
+var testAttributes = map[string]MessageAttributeValue{
+	"store":     {DataType: "String", StringValue: "example_corp"},
+	"event":     {DataType: "String", StringValue: "order_placed"},
+	"price":     {DataType: "Number", StringValue: "210.75"},
+	"quantity":  {DataType: "Number.java.lang.Integer", StringValue: "3"},
+	"interests": {DataType: "String.Array", StringValue: `["soccer", "rugby", 7]`},
+	"ip":        {DataType: "String", StringValue: "10.1.2.3"},
+	"blob":      {DataType: "Binary", BinaryValue: []byte("example_corp")},
+}
+
+const testBody = `{
+	"store": "example_corp", "total": 150, "ip": "10.1.2.3", "flag": true, "note": null,
+	"order": {"id": "X-1", "items": ["a", "b"], "customer": {"tier": "gold"}},
+	"tags": []
+}`
+
+func TestFilterPolicies(t *testing.T) {
+	tests := []struct {
+		scope  string
+		policy string
+		want   bool
+	}{
+		// Values.
+		{scopeAttributes, `{"store": ["example_corp"]}`, true},
+		{scopeAttributes, `{"store": ["other"]}`, false},
+		{scopeAttributes, `{"store": ["other", "example_corp"]}`, true},
+		{scopeAttributes, `{"price": [210.75]}`, true},
+		{scopeAttributes, `{"price": ["210.75"]}`, false},
+		{scopeAttributes, `{"quantity": [3]}`, true},
+		{scopeAttributes, `{"interests": ["rugby"]}`, true},
+		{scopeAttributes, `{"interests": [7]}`, true},
+		{scopeAttributes, `{"interests": ["golf"]}`, false},
+		{scopeAttributes, `{"store": ["example_corp"], "event": ["order_placed"]}`, true},
+		{scopeAttributes, `{"store": ["example_corp"], "event": ["order_cancelled"]}`, false},
+		{scopeAttributes, `{"blob": ["example_corp"]}`, false},
+		{scopeAttributes, `{"missing": ["x"]}`, false},
+
+		// Strings.
+		{scopeAttributes, `{"store": [{"prefix": "example"}]}`, true},
+		{scopeAttributes, `{"store": [{"prefix": "corp"}]}`, false},
+		{scopeAttributes, `{"store": [{"suffix": "_corp"}]}`, true},
+		{scopeAttributes, `{"store": [{"suffix": "example"}]}`, false},
+		{scopeAttributes, `{"store": [{"equals-ignore-case": "EXAMPLE_Corp"}]}`, true},
+		{scopeAttributes, `{"interests": [{"prefix": "rug"}]}`, true},
+		{scopeAttributes, `{"price": [{"prefix": "210"}]}`, false},
+
+		// anything-but.
+		{scopeAttributes, `{"store": [{"anything-but": "example_corp"}]}`, false},
+		{scopeAttributes, `{"store": [{"anything-but": "other"}]}`, true},
+		{scopeAttributes, `{"store": [{"anything-but": ["a", "example_corp"]}]}`, false},
+		{scopeAttributes, `{"store": [{"anything-but": ["a", "b"]}]}`, true},
+		{scopeAttributes, `{"store": [{"anything-but": {"prefix": "example"}}]}`, false},
+		{scopeAttributes, `{"store": [{"anything-but": {"suffix": "_shop"}}]}`, true},
+		{scopeAttributes, `{"price": [{"anything-but": 100}]}`, true},
+		{scopeAttributes, `{"price": [{"anything-but": [210.75]}]}`, false},
+		{scopeAttributes, `{"price": [{"anything-but": {"prefix": "2"}}]}`, false},
+		{scopeAttributes, `{"missing": [{"anything-but": "x"}]}`, false},
+
+		// numeric.
+		{scopeAttributes, `{"price": [{"numeric": [">", 200]}]}`, true},
+		{scopeAttributes, `{"price": [{"numeric": ["<", 200]}]}`, false},
+		{scopeAttributes, `{"price": [{"numeric": ["=", 210.75]}]}`, true},
+		{scopeAttributes, `{"price": [{"numeric": [">=", 210.75, "<", 211]}]}`, true},
+		{scopeAttributes, `{"price": [{"numeric": [">", 200, "<=", 210]}]}`, false},
+		{scopeAttributes, `{"quantity": [{"numeric": ["<=", 3]}]}`, true},
+		{scopeAttributes, `{"store": [{"numeric": [">", 0]}]}`, false},
+		{scopeAttributes, `{"interests": [{"numeric": [">", 5]}]}`, true},
+
+		// cidr.
+		{scopeAttributes, `{"ip": [{"cidr": "10.0.0.0/8"}]}`, true},
+		{scopeAttributes, `{"ip": [{"cidr": "10.1.2.3/32"}]}`, true},
+		{scopeAttributes, `{"ip": [{"cidr": "192.168.0.0/16"}]}`, false},
+		{scopeAttributes, `{"ip": [{"cidr": "2001:db8::/32"}]}`, false},
+		{scopeAttributes, `{"store": [{"cidr": "10.0.0.0/8"}]}`, false},
+
+		// exists.
+		{scopeAttributes, `{"store": [{"exists": true}]}`, true},
+		{scopeAttributes, `{"store": [{"exists": false}]}`, false},
+		{scopeAttributes, `{"missing": [{"exists": false}]}`, true},
+		{scopeAttributes, `{"missing": [{"exists": true}]}`, false},
+		{scopeAttributes, `{"blob": [{"exists": true}]}`, false},
+		{scopeAttributes, `{"missing": ["x", {"exists": false}]}`, true},
+
+		// $or.
+		{scopeAttributes, `{"$or": [{"store": ["other"]}, {"event": ["order_placed"]}]}`, true},
+		{scopeAttributes, `{"$or": [{"store": ["other"]}, {"event": ["other"]}]}`, false},
+		{scopeAttributes, `{"store": ["example_corp"], "$or": [{"price": [{"numeric": ["<", 10]}]}, {"event": ["order_placed"]}]}`, true},
+		{scopeAttributes, `{"store": ["example_corp"], "$or": [{"price": [{"numeric": ["<", 10]}]}, {"event": ["other"]}]}`, false},
+		{scopeAttributes, `{"store": ["other"], "$or": [{"price": [210.75]}, {"event": ["order_placed"]}]}`, false},
+		{scopeAttributes, `{"$or": [{"$or": [{"store": ["x"]}, {"store": ["y"]}]}, {"ip": [{"cidr": "10.0.0.0/8"}]}]}`, true},
+
+		// Body scope.
+		{scopeBody, `{"store": ["example_corp"]}`, true},
+		{scopeBody, `{"total": [{"numeric": [">", 100]}]}`, true},
+		{scopeBody, `{"flag": [true]}`, true},
+		{scopeBody, `{"flag": [false]}`, false},
+		{scopeBody, `{"note": [null]}`, true},
+		{scopeBody, `{"note": [{"exists": true}]}`, true},
+		{scopeBody, `{"order": {"id": [{"prefix": "X-"}]}}`, true},
+		{scopeBody, `{"order": {"id": [{"prefix": "Y-"}]}}`, false},
+		{scopeBody, `{"order": {"items": ["b"]}}`, true},
+		{scopeBody, `{"order": {"customer": {"tier": ["gold"]}}}`, true},
+		{scopeBody, `{"order": {"customer": {"tier": ["silver"]}}}`, false},
+		{scopeBody, `{"order": ["X-1"]}`, false},
+		{scopeBody, `{"store": {"id": ["X-1"]}}`, false},
+		{scopeBody, `{"missing": {"id": ["X-1"]}}`, false},
+		{scopeBody, `{"ip": [{"cidr": "10.1.0.0/16"}]}`, true},
+		{scopeBody, `{"order": {"$or": [{"id": ["nope"]}, {"items": ["a"]}]}}`, true},
+		{scopeBody, `{"price": [210.75]}`, false},
+	}
+
+	for _, test := range tests {
+		p, err := parsePolicy(test.policy, test.scope)
+		if err != nil {
+			t.Errorf("%v: %v", test.policy, err)
+			continue
+		}
+		sub := &subscription{protocol: protocolSQS, attrs: map[string]string{attrFilterPolicyScope: test.scope}, policy: p}
+		e := &PublishBatchRequestEntry{Message: testBody, MessageAttributes: testAttributes}
+		if got := sub.wants(e); got != test.want {
+			t.Errorf("%v on %v: got %v, want %v", test.policy, test.scope, got, test.want)
+		}
+	}
+}
+
+func TestBodyPolicyMessages(t *testing.T) {
+	p, err := parsePolicy(`{"store": ["example_corp"]}`, scopeBody)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub := &subscription{protocol: protocolSQS, attrs: map[string]string{attrFilterPolicyScope: scopeBody}, policy: p}
+
+	tests := []struct {
+		message   string
+		structure string
+		want      bool
+	}{
+		{`{"store": "example_corp"}`, "", true},
+		{`not json`, "", false},
+		{`["example_corp"]`, "", false},
+		// A json message is matched on the message for the subscription's
+		// protocol.
+		{`{"default": "{\"store\": \"other\"}", "sqs": "{\"store\": \"example_corp\"}"}`, "json", true},
+		{`{"default": "{\"store\": \"example_corp\"}", "sqs": "{\"store\": \"other\"}"}`, "json", false},
+		{`{"default": "{\"store\": \"example_corp\"}"}`, "json", true},
+	}
+	for _, test := range tests {
+		if got := sub.wants(&PublishBatchRequestEntry{Message: test.message, MessageStructure: test.structure}); got != test.want {
+			t.Errorf("%v: got %v, want %v", test.message, got, test.want)
+		}
+	}
+}
+
+func TestFilterPolicyErrors(t *testing.T) {
+	tests := []struct {
+		scope  string
+		policy string
+	}{
+		{scopeAttributes, `not json`},
+		{scopeAttributes, `["store"]`},
+		{scopeAttributes, `{"store": "example_corp"}`},
+		{scopeAttributes, `{"store": []}`},
+		{scopeAttributes, `{"store": {"id": ["x"]}}`},
+		{scopeAttributes, `{"store": [["x"]]}`},
+		{scopeAttributes, `{"store": [{"nope": 1}]}`},
+		{scopeAttributes, `{"store": [{"prefix": "a", "suffix": "b"}]}`},
+		{scopeAttributes, `{"store": [{"prefix": 1}]}`},
+		{scopeAttributes, `{"store": [{"exists": "yes"}]}`},
+		{scopeAttributes, `{"store": [{"anything-but": []}]}`},
+		{scopeAttributes, `{"store": [{"anything-but": [true]}]}`},
+		{scopeAttributes, `{"store": [{"anything-but": {"equals-ignore-case": "x"}}]}`},
+		{scopeAttributes, `{"price": [{"numeric": [">"]}]}`},
+		{scopeAttributes, `{"price": [{"numeric": ["~", 1]}]}`},
+		{scopeAttributes, `{"price": [{"numeric": [">", "1"]}]}`},
+		{scopeAttributes, `{"price": [{"numeric": ["=", 1, "<", 2]}]}`},
+		{scopeAttributes, `{"price": [{"numeric": [">", 1, "<", 2, "<", 3]}]}`},
+		{scopeAttributes, `{"ip": [{"cidr": "10.0.0.0"}]}`},
+		{scopeAttributes, `{"ip": [{"cidr": 10}]}`},
+		{scopeAttributes, `{"$or": [{"store": ["x"]}]}`},
+		{scopeAttributes, `{"$or": {"store": ["x"]}}`},
+		{scopeAttributes, `{"$or": [{"store": ["x"]}, "y"]}`},
+		{scopeBody, `{"a": {"b": {"c": {"d": {"e": {"f": {"g": ["h"]}}}}}}}`},
+	}
+
+	for _, test := range tests {
+		if _, err := parsePolicy(test.policy, test.scope); err == nil {
+			t.Errorf("%v: no error", test.policy)
+		} else if ce, ok := err.(common.Error); !ok || ce.Code != "InvalidParameter" {
+			t.Errorf("%v: %v", test.policy, err)
+		}
+	}
+}
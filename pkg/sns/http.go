@@ -0,0 +1,177 @@
+package sns
+
+import (
+	"net/http"
+
+	"github.com/fernomac/aws-local/pkg/awsquery"
+	"github.com/fernomac/aws-local/pkg/common"
+)
+
+// Version is the API version SNS requests carry.
+const Version = "2010-03-31"
+
+// NewHandler creates a new HTTP handler, notifying the given observers of
+// every call.
+func NewHandler(sns SNS, observers ...common.Observer) http.Handler {
+	rval := awsquery.NewHandler("http://sns.amazonaws.com/doc/" + Version + "/")
+	rval.SetEventSource("sns.amazonaws.com")
+	rval.StatusFor("NotFound", 404)
+	rval.StatusFor("ResourceNotFound", 404)
+	for _, o := range observers {
+		rval.ObserveWith(o)
+	}
+
+	//
+	// Topics.
+	//
+
+	rval.HandleWith("CreateTopic", func(req *awsquery.Request) (interface{}, error) {
+		in := CreateTopicRequest{}
+		if err := req.Decode(&in); err != nil {
+			return nil, err
+		}
+		return sns.CreateTopic(&in)
+	})
+
+	rval.HandleWith("DeleteTopic", func(req *awsquery.Request) (interface{}, error) {
+		in := DeleteTopicRequest{}
+		if err := req.Decode(&in); err != nil {
+			return nil, err
+		}
+		return sns.DeleteTopic(&in)
+	})
+
+	rval.HandleWith("ListTopics", func(req *awsquery.Request) (interface{}, error) {
+		in := ListTopicsRequest{}
+		if err := req.Decode(&in); err != nil {
+			return nil, err
+		}
+		return sns.ListTopics(&in)
+	})
+
+	rval.HandleWith("GetTopicAttributes", func(req *awsquery.Request) (interface{}, error) {
+		in := GetTopicAttributesRequest{}
+		if err := req.Decode(&in); err != nil {
+			return nil, err
+		}
+		return sns.GetTopicAttributes(&in)
+	})
+
+	rval.HandleWith("SetTopicAttributes", func(req *awsquery.Request) (interface{}, error) {
+		in := SetTopicAttributesRequest{}
+		if err := req.Decode(&in); err != nil {
+			return nil, err
+		}
+		return sns.SetTopicAttributes(&in)
+	})
+
+	//
+	// Subscriptions.
+	//
+
+	rval.HandleWith("Subscribe", func(req *awsquery.Request) (interface{}, error) {
+		in := SubscribeRequest{}
+		if err := req.Decode(&in); err != nil {
+			return nil, err
+		}
+		return sns.Subscribe(&in)
+	})
+
+	rval.HandleWith("ConfirmSubscription", func(req *awsquery.Request) (interface{}, error) {
+		in := ConfirmSubscriptionRequest{}
+		if err := req.Decode(&in); err != nil {
+			return nil, err
+		}
+		return sns.ConfirmSubscription(&in)
+	})
+
+	rval.HandleWith("Unsubscribe", func(req *awsquery.Request) (interface{}, error) {
+		in := UnsubscribeRequest{}
+		if err := req.Decode(&in); err != nil {
+			return nil, err
+		}
+		return sns.Unsubscribe(&in)
+	})
+
+	rval.HandleWith("ListSubscriptions", func(req *awsquery.Request) (interface{}, error) {
+		in := ListSubscriptionsRequest{}
+		if err := req.Decode(&in); err != nil {
+			return nil, err
+		}
+		return sns.ListSubscriptions(&in)
+	})
+
+	rval.HandleWith("ListSubscriptionsByTopic", func(req *awsquery.Request) (interface{}, error) {
+		in := ListSubscriptionsByTopicRequest{}
+		if err := req.Decode(&in); err != nil {
+			return nil, err
+		}
+		return sns.ListSubscriptionsByTopic(&in)
+	})
+
+	rval.HandleWith("GetSubscriptionAttributes", func(req *awsquery.Request) (interface{}, error) {
+		in := GetSubscriptionAttributesRequest{}
+		if err := req.Decode(&in); err != nil {
+			return nil, err
+		}
+		return sns.GetSubscriptionAttributes(&in)
+	})
+
+	rval.HandleWith("SetSubscriptionAttributes", func(req *awsquery.Request) (interface{}, error) {
+		in := SetSubscriptionAttributesRequest{}
+		if err := req.Decode(&in); err != nil {
+			return nil, err
+		}
+		return sns.SetSubscriptionAttributes(&in)
+	})
+
+	//
+	// Publishing.
+	//
+
+	rval.HandleWith("Publish", func(req *awsquery.Request) (interface{}, error) {
+		in := PublishRequest{}
+		if err := req.Decode(&in); err != nil {
+			return nil, err
+		}
+		return sns.Publish(&in)
+	})
+
+	rval.HandleWith("PublishBatch", func(req *awsquery.Request) (interface{}, error) {
+		in := PublishBatchRequest{}
+		if err := req.Decode(&in); err != nil {
+			return nil, err
+		}
+		return sns.PublishBatch(&in)
+	})
+
+	//
+	// Tags.
+	//
+
+	rval.HandleWith("TagResource", func(req *awsquery.Request) (interface{}, error) {
+		in := TagResourceRequest{}
+		if err := req.Decode(&in); err != nil {
+			return nil, err
+		}
+		return sns.TagResource(&in)
+	})
+
+	rval.HandleWith("UntagResource", func(req *awsquery.Request) (interface{}, error) {
+		in := UntagResourceRequest{}
+		if err := req.Decode(&in); err != nil {
+			return nil, err
+		}
+		return sns.UntagResource(&in)
+	})
+
+	rval.HandleWith("ListTagsForResource", func(req *awsquery.Request) (interface{}, error) {
+		in := ListTagsForResourceRequest{}
+		if err := req.Decode(&in); err != nil {
+			return nil, err
+		}
+		return sns.ListTagsForResource(&in)
+	})
+
+	return rval
+}
@@ -0,0 +1,912 @@
+package sns
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/fernomac/aws-local/pkg/common"
+	"github.com/fernomac/aws-local/pkg/kms"
+	"github.com/fernomac/aws-local/pkg/sqs"
+)
+
+// Limits and timings.
+const (
+	maxBatchEntries   = 10
+	maxMessageSize    = 262144
+	maxAttributes     = 10
+	maxTags           = 50
+	pageSize          = 100
+	tokenLifetime     = 3 * 24 * time.Hour
+	deduplicationSpan = 5 * time.Minute
+)
+
+var (
+	batchIDPattern       = regexp.MustCompile(`^[A-Za-z0-9_\-]{1,80}$`)
+	attributeNamePattern = regexp.MustCompile(`^[A-Za-z0-9_.\-]{1,256}$`)
+)
+
+// Option configures an SNS object.
+type Option func(*sns)
+
+// WithClock sets the clock that times confirmation tokens, deduplication and
+// message timestamps.
+func WithClock(clock common.Clock) Option {
+	return func(s *sns) {
+		s.clock = clock
+	}
+}
+
+// WithEndpoint sets the base URL of the SubscribeURL and UnsubscribeURL links
+// in messages, e.g. "http://localhost:4566".
+func WithEndpoint(endpoint string) Option {
+	return func(s *sns) {
+		s.endpoint = strings.TrimSuffix(endpoint, "/")
+	}
+}
+
+// WithQueues sets the SQS that subscriptions with the sqs protocol deliver to.
+func WithQueues(queues sqs.SQS) Option {
+	return func(s *sns) {
+		s.queues = queues
+	}
+}
+
+// WithSink makes a sink available to subscriptions with the sink protocol
+// under the given name, which is their endpoint.
+func WithSink(name string, sink Sink) Option {
+	return func(s *sns) {
+		s.sinks[name] = sink
+	}
+}
+
+// sns is the topic store. Its lock guards topics and subscriptions, and is
+// held when calling KMS to seal messages but never while delivering them.
+type sns struct {
+	lock     sync.Mutex
+	kms      kms.KMS
+	queues   sqs.SQS
+	sinks    map[string]Sink
+	client   *http.Client
+	clock    common.Clock
+	endpoint string
+	topics   map[string]*topic
+	subs     map[string]*subscription
+}
+
+// New creates a new topic store that encrypts messages for topics with a
+// KmsMasterKeyId under keys from the given KMS.
+func New(kms kms.KMS, opts ...Option) SNS {
+	rval := &sns{
+		kms:      kms,
+		sinks:    make(map[string]Sink),
+		client:   &http.Client{Timeout: deliveryTimeout},
+		clock:    common.SystemClock,
+		endpoint: "http://localhost:4566",
+		topics:   make(map[string]*topic),
+		subs:     make(map[string]*subscription),
+	}
+	for _, opt := range opts {
+		opt(rval)
+	}
+	return rval
+}
+
+func notFound(what string) error {
+	return common.Errorf("NotFound", "%v does not exist", what)
+}
+
+// topic looks up a topic by its ARN. The caller must hold s.lock.
+func (s *sns) topic(arn string) (*topic, error) {
+	if arn == "" {
+		return nil, invalidParameter("TopicArn Reason: no value for required parameter")
+	}
+	t, ok := s.topics[topicName(arn)]
+	if !ok {
+		return nil, notFound("Topic")
+	}
+	return t, nil
+}
+
+// subscription looks up a subscription by its ARN. The caller must hold
+// s.lock.
+func (s *sns) subscription(arn string) (*subscription, error) {
+	if arn == "" {
+		return nil, invalidParameter("SubscriptionArn Reason: no value for required parameter")
+	}
+	sub, ok := s.subs[arn]
+	if !ok {
+		return nil, notFound("Subscription")
+	}
+	return sub, nil
+}
+
+// page returns the bounds of a page of n items and the token for the next.
+func page(nextToken string, n int) (int, int, string, error) {
+	offset := 0
+	if nextToken != "" {
+		raw, err := base64.RawURLEncoding.DecodeString(nextToken)
+		if err == nil {
+			offset, err = strconv.Atoi(string(raw))
+		}
+		if err != nil || offset < 0 || offset > n {
+			return 0, 0, "", invalidParameter("NextToken")
+		}
+	}
+	end := offset + pageSize
+	if end > n {
+		end = n
+	}
+	token := ""
+	if end < n {
+		token = base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(end)))
+	}
+	return offset, end, token, nil
+}
+
+func newToken() string {
+	b := make([]byte, 64)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+//
+// Topics.
+//
+
+func (s *sns) CreateTopic(req *CreateTopicRequest) (*CreateTopicResult, error) {
+	name := req.Name
+	fifo := strings.HasSuffix(name, ".fifo")
+	if !topicNamePattern.MatchString(strings.TrimSuffix(name, ".fifo")) || len(name) > 256 {
+		return nil, invalidParameter("Topic Name")
+	}
+	if fifo != (req.Attributes[attrFifoTopic] == "true") {
+		return nil, invalidParameter("Topic Name Reason: FIFO topic names must end with .fifo and set the FifoTopic attribute")
+	}
+	for k, v := range req.Attributes {
+		if err := validateTopicAttribute(k, v, fifo, true); err != nil {
+			return nil, err
+		}
+	}
+	if err := validateTags(req.Tags); err != nil {
+		return nil, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if t, ok := s.topics[name]; ok {
+		for k, v := range req.Attributes {
+			if t.attrs[k] != v {
+				return nil, invalidParameter("Attributes Reason: Topic already exists with different attributes")
+			}
+		}
+		return &CreateTopicResult{TopicArn: t.arn}, nil
+	}
+	if len(req.Tags) > maxTags {
+		return nil, common.Errorf("TagLimitExceeded", "Could not complete request: tag quota of per resource exceeded")
+	}
+
+	t := newTopic(name, fifo)
+	for k, v := range req.Attributes {
+		t.attrs[k] = v
+	}
+	for _, tag := range req.Tags {
+		t.tags[tag.Key] = tag.Value
+	}
+	s.topics[name] = t
+	return &CreateTopicResult{TopicArn: t.arn}, nil
+}
+
+func (s *sns) DeleteTopic(req *DeleteTopicRequest) (*DeleteTopicResult, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	// Deleting a topic that doesn't exist isn't an error.
+	t, err := s.topic(req.TopicArn)
+	if err != nil {
+		if ce, ok := err.(common.Error); ok && ce.Code == "NotFound" {
+			return &DeleteTopicResult{}, nil
+		}
+		return nil, err
+	}
+	for _, sub := range t.subs {
+		delete(s.subs, sub.arn)
+	}
+	delete(s.topics, t.name)
+	return &DeleteTopicResult{}, nil
+}
+
+func (s *sns) ListTopics(req *ListTopicsRequest) (*ListTopicsResult, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	names := []string{}
+	for name := range s.topics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	start, end, token, err := page(req.NextToken, len(names))
+	if err != nil {
+		return nil, err
+	}
+	out := &ListTopicsResult{NextToken: token, Topics: []Topic{}}
+	for _, name := range names[start:end] {
+		out.Topics = append(out.Topics, Topic{TopicArn: topicArn(name)})
+	}
+	return out, nil
+}
+
+func (s *sns) GetTopicAttributes(req *GetTopicAttributesRequest) (*GetTopicAttributesResult, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	t, err := s.topic(req.TopicArn)
+	if err != nil {
+		return nil, err
+	}
+	return &GetTopicAttributesResult{Attributes: t.attributes()}, nil
+}
+
+func (s *sns) SetTopicAttributes(req *SetTopicAttributesRequest) (*SetTopicAttributesResult, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	t, err := s.topic(req.TopicArn)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateTopicAttribute(req.AttributeName, req.AttributeValue, t.fifo, false); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case req.AttributeName == attrPolicy && req.AttributeValue == "":
+		t.attrs[attrPolicy] = defaultPolicy(t.arn)
+	case req.AttributeValue == "" && req.AttributeName != attrDisplayName:
+		delete(t.attrs, req.AttributeName)
+	default:
+		t.attrs[req.AttributeName] = req.AttributeValue
+	}
+	return &SetTopicAttributesResult{}, nil
+}
+
+//
+// Subscriptions.
+//
+
+// checkEndpoint checks that a topic can deliver to an endpoint with the
+// given protocol.
+func (s *sns) checkEndpoint(t *topic, protocol string, endpoint string) error {
+	switch protocol {
+	case protocolSQS:
+		name := queueName(endpoint)
+		if name == "" {
+			return invalidParameter("SQS endpoint ARN")
+		}
+		if t.fifo != strings.HasSuffix(name, ".fifo") {
+			if t.fifo {
+				return invalidParameter("Endpoint Reason: Please use FIFO SQS queue")
+			}
+			return invalidParameter("Endpoint Reason: FIFO SQS Queues can not be subscribed to standard SNS topics")
+		}
+
+	case protocolHTTP, protocolHTTPS:
+		u, err := url.Parse(endpoint)
+		if err != nil || u.Scheme != protocol || u.Host == "" {
+			return invalidParameter("Endpoint must match the specified protocol")
+		}
+		if t.fifo {
+			return invalidParameter("Endpoint Reason: FIFO topics only deliver to FIFO SQS queues")
+		}
+
+	case protocolSink:
+		if _, ok := s.sinks[endpoint]; !ok {
+			return invalidParameter("Endpoint Reason: there is no sink named %v", endpoint)
+		}
+
+	default:
+		return invalidParameter("Amazon SNS does not support this protocol locally: %v", protocol)
+	}
+	return nil
+}
+
+func (s *sns) Subscribe(req *SubscribeRequest) (*SubscribeResult, error) {
+	policy, err := validateSubscriptionAttributes(req.Attributes)
+	if err != nil {
+		return nil, err
+	}
+
+	// Sinks may confirm as soon as they're asked to, so ask once the lock is
+	// free.
+	s.lock.Lock()
+	out, confirm, err := s.subscribe(req, policy)
+	s.lock.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if confirm != nil {
+		confirm()
+	}
+	return out, nil
+}
+
+// subscribe subscribes an endpoint to a topic, returning a function that
+// asks the endpoint to confirm if it has to. The caller must hold s.lock.
+func (s *sns) subscribe(req *SubscribeRequest, policy *policy) (*SubscribeResult, func(), error) {
+	t, err := s.topic(req.TopicArn)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := s.checkEndpoint(t, req.Protocol, req.Endpoint); err != nil {
+		return nil, nil, err
+	}
+
+	result := func(sub *subscription) *SubscribeResult {
+		if sub.confirmed || req.ReturnSubscriptionArn {
+			return &SubscribeResult{SubscriptionArn: sub.arn}
+		}
+		return &SubscribeResult{SubscriptionArn: "pending confirmation"}
+	}
+
+	for _, sub := range t.subs {
+		if sub.protocol != req.Protocol || sub.endpoint != req.Endpoint {
+			continue
+		}
+		for k, v := range req.Attributes {
+			if sub.attrs[k] != v {
+				return nil, nil, invalidParameter("Attributes Reason: Subscription already exists with different attributes")
+			}
+		}
+		return result(sub), nil, nil
+	}
+
+	now := s.clock.Now()
+	sub := &subscription{
+		arn:       t.arn + ":" + common.NewRequestID(),
+		topic:     t,
+		protocol:  req.Protocol,
+		endpoint:  req.Endpoint,
+		attrs:     map[string]string{},
+		policy:    policy,
+		confirmed: req.Protocol == protocolSQS,
+	}
+	for k, v := range req.Attributes {
+		sub.attrs[k] = v
+	}
+	t.subs = append(t.subs, sub)
+	s.subs[sub.arn] = sub
+
+	if sub.confirmed {
+		return result(sub), nil, nil
+	}
+	sub.token = newToken()
+	sub.tokenExpires = now.Add(tokenLifetime)
+	target, topicArn, token := newTarget(sub), t.arn, sub.token
+	return result(sub), func() { s.confirm(target, topicArn, token, now) }, nil
+}
+
+func (s *sns) ConfirmSubscription(req *ConfirmSubscriptionRequest) (*ConfirmSubscriptionResult, error) {
+	if req.Token == "" {
+		return nil, invalidParameter("Token Reason: no value for required parameter")
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	t, err := s.topic(req.TopicArn)
+	if err != nil {
+		return nil, err
+	}
+	now := s.clock.Now()
+	for _, sub := range t.subs {
+		if sub.token == "" || sub.token != req.Token {
+			continue
+		}
+		if !sub.confirmed && !now.Before(sub.tokenExpires) {
+			break
+		}
+		sub.confirmed = true
+		if req.AuthenticateOnUnsubscribe == "true" {
+			sub.authenticated = true
+		}
+		return &ConfirmSubscriptionResult{SubscriptionArn: sub.arn}, nil
+	}
+	return nil, invalidParameter("Token")
+}
+
+func (s *sns) Unsubscribe(req *UnsubscribeRequest) (*UnsubscribeResult, error) {
+	s.lock.Lock()
+	sub, err := s.subscription(req.SubscriptionArn)
+	if err != nil {
+		s.lock.Unlock()
+		return nil, err
+	}
+	sub.topic.remove(sub)
+	delete(s.subs, sub.arn)
+	target, topicArn, now := newTarget(sub), sub.topic.arn, s.clock.Now()
+	s.lock.Unlock()
+
+	if sub.confirmed && sub.protocol != protocolSQS {
+		s.unsubscribed(target, topicArn, now)
+	}
+	return &UnsubscribeResult{}, nil
+}
+
+func (s *sns) ListSubscriptions(req *ListSubscriptionsRequest) (*ListSubscriptionsResult, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	names := []string{}
+	for name := range s.topics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	all := []Subscription{}
+	for _, name := range names {
+		for _, sub := range s.topics[name].subs {
+			all = append(all, sub.describe())
+		}
+	}
+
+	start, end, token, err := page(req.NextToken, len(all))
+	if err != nil {
+		return nil, err
+	}
+	return &ListSubscriptionsResult{NextToken: token, Subscriptions: all[start:end]}, nil
+}
+
+func (s *sns) ListSubscriptionsByTopic(req *ListSubscriptionsByTopicRequest) (*ListSubscriptionsByTopicResult, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	t, err := s.topic(req.TopicArn)
+	if err != nil {
+		return nil, err
+	}
+	start, end, token, err := page(req.NextToken, len(t.subs))
+	if err != nil {
+		return nil, err
+	}
+	out := &ListSubscriptionsByTopicResult{NextToken: token, Subscriptions: []Subscription{}}
+	for _, sub := range t.subs[start:end] {
+		out.Subscriptions = append(out.Subscriptions, sub.describe())
+	}
+	return out, nil
+}
+
+func (s *sns) GetSubscriptionAttributes(req *GetSubscriptionAttributesRequest) (*GetSubscriptionAttributesResult, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	sub, err := s.subscription(req.SubscriptionArn)
+	if err != nil {
+		return nil, err
+	}
+	return &GetSubscriptionAttributesResult{Attributes: sub.attributes()}, nil
+}
+
+func (s *sns) SetSubscriptionAttributes(req *SetSubscriptionAttributesRequest) (*SetSubscriptionAttributesResult, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	sub, err := s.subscription(req.SubscriptionArn)
+	if err != nil {
+		return nil, err
+	}
+
+	attrs := map[string]string{}
+	for k, v := range sub.attrs {
+		attrs[k] = v
+	}
+	if req.AttributeValue == "" {
+		delete(attrs, req.AttributeName)
+	} else {
+		attrs[req.AttributeName] = req.AttributeValue
+	}
+	if !knownSubscriptionAttribute(req.AttributeName) {
+		return nil, invalidParameter("AttributeName")
+	}
+	policy, err := validateSubscriptionAttributes(attrs)
+	if err != nil {
+		return nil, err
+	}
+
+	sub.attrs = attrs
+	sub.policy = policy
+	return &SetSubscriptionAttributesResult{}, nil
+}
+
+//
+// Publishing.
+//
+
+// validateMessageAttributes checks message attributes, returning their size.
+func validateMessageAttributes(attrs map[string]MessageAttributeValue) (int, error) {
+	if len(attrs) > maxAttributes {
+		return 0, common.Errorf("InvalidParameterValue", "Number of message attributes [%v] exceeds the allowed maximum [%v].", len(attrs), maxAttributes)
+	}
+
+	size := 0
+	for name, a := range attrs {
+		if !attributeNamePattern.MatchString(name) || strings.HasPrefix(strings.ToLower(name), "aws.") {
+			return 0, common.Errorf("InvalidParameterValue", "The message attribute name '%v' is invalid.", name)
+		}
+
+		base := strings.SplitN(a.DataType, ".", 2)[0]
+		if a.DataType == "String.Array" {
+			base = a.DataType
+		}
+		switch base {
+		case "String", "Number":
+			if a.StringValue == "" {
+				return 0, common.Errorf("InvalidParameterValue", "The message attribute '%v' must contain non-empty message attribute value for message attribute type '%v'.", name, a.DataType)
+			}
+			if base == "Number" {
+				if _, err := strconv.ParseFloat(a.StringValue, 64); err != nil {
+					return 0, common.Errorf("InvalidParameterValue", "Could not cast message attribute '%v' value to number.", name)
+				}
+			}
+		case "String.Array":
+			list := []interface{}{}
+			if err := json.Unmarshal([]byte(a.StringValue), &list); err != nil {
+				return 0, common.Errorf("InvalidParameterValue", "The message attribute '%v' with type 'String.Array' must use field 'String'.", name)
+			}
+			for _, e := range list {
+				switch e.(type) {
+				case string, float64, bool, nil:
+				default:
+					return 0, common.Errorf("InvalidParameterValue", "The message attribute '%v' must be an array of strings, numbers, booleans or nulls.", name)
+				}
+			}
+		case "Binary":
+			if len(a.BinaryValue) == 0 {
+				return 0, common.Errorf("InvalidParameterValue", "The message attribute '%v' must contain non-empty message attribute value for message attribute type 'Binary'.", name)
+			}
+		default:
+			return 0, common.Errorf("InvalidParameterValue", "The message attribute '%v' has an invalid message attribute type, the set of supported type prefixes is Binary, Number, and String.", name)
+		}
+		size += len(name) + len(a.DataType) + len(a.StringValue) + len(a.BinaryValue)
+	}
+	return size, nil
+}
+
+// validateMessage checks a message and its subject.
+func validateMessage(e *PublishBatchRequestEntry) error {
+	if e.Message == "" {
+		return invalidParameter("Empty message")
+	}
+	if !utf8.ValidString(e.Message) {
+		return invalidParameter("Message Reason: must be valid UTF-8")
+	}
+	if len(e.Subject) > 100 {
+		return invalidParameter("Subject Reason: must be at most 100 characters")
+	}
+	for _, r := range e.Subject {
+		if r < 0x20 || r > 0x7e {
+			return invalidParameter("Subject Reason: must be printable ASCII without line breaks")
+		}
+	}
+
+	switch e.MessageStructure {
+	case "":
+	case "json":
+		messages := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(e.Message), &messages); err != nil {
+			return invalidParameter("Message Structure - JSON message body failed to parse")
+		}
+		if _, ok := messages["default"].(string); !ok {
+			return invalidParameter("Message Structure - No default entry in JSON message body")
+		}
+		for _, m := range messages {
+			if _, ok := m.(string); !ok {
+				return invalidParameter("Message Structure - JSON message values must be strings")
+			}
+		}
+	default:
+		return invalidParameter("MessageStructure")
+	}
+
+	size, err := validateMessageAttributes(e.MessageAttributes)
+	if err != nil {
+		return err
+	}
+	if len(e.Message)+size > maxMessageSize {
+		return invalidParameter("Message too long")
+	}
+	return nil
+}
+
+// wants reports whether a subscription's filter policy lets a message
+// through.
+func (sub *subscription) wants(e *PublishBatchRequestEntry) bool {
+	if sub.policy == nil {
+		return true
+	}
+	if sub.attrs[attrFilterPolicyScope] != scopeBody {
+		return sub.policy.matches(attributeValues(e.MessageAttributes))
+	}
+
+	body := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(messageFor(e.Message, e.MessageStructure, sub.protocol)), &body); err != nil {
+		return false
+	}
+	return sub.policy.matches(body)
+}
+
+// publish publishes a message to a topic, returning the notification to
+// deliver, or nil if the message is a duplicate. The caller must hold s.lock.
+func (s *sns) publish(t *topic, e *PublishBatchRequestEntry) (*PublishBatchResultEntry, *notification, error) {
+	if err := validateMessage(e); err != nil {
+		return nil, nil, err
+	}
+
+	now := s.clock.Now()
+	dedupID := e.MessageDeduplicationID
+	if t.fifo {
+		if e.MessageGroupID == "" {
+			return nil, nil, invalidParameter("The MessageGroupId parameter is required for FIFO topics")
+		}
+		if dedupID == "" {
+			if t.attrs[attrContentBasedDeduplication] != "true" {
+				return nil, nil, invalidParameter("The topic should either have ContentBasedDeduplication enabled or MessageDeduplicationId provided explicitly")
+			}
+			sum := sha256.Sum256([]byte(e.Message))
+			dedupID = hex.EncodeToString(sum[:])
+		}
+		if len(dedupID) > 128 {
+			return nil, nil, invalidParameter("MessageDeduplicationId Reason: must be at most 128 characters")
+		}
+
+		t.expire(now)
+		if d, ok := t.dedups[dedupID]; ok {
+			return &PublishBatchResultEntry{ID: e.ID, MessageID: d.messageID, SequenceNumber: d.seq}, nil, nil
+		}
+	} else if dedupID != "" {
+		return nil, nil, invalidParameter("MessageDeduplicationId Reason: The request includes MessageDeduplicationId parameter that is not valid for this topic type")
+	}
+
+	n := &notification{
+		topicArn:  t.arn,
+		messageID: common.NewRequestID(),
+		subject:   e.Subject,
+		message:   e.Message,
+		structure: e.MessageStructure,
+		attrs:     e.MessageAttributes,
+		groupID:   e.MessageGroupID,
+		dedupID:   dedupID,
+		signature: t.attrs[attrSignatureVersion],
+		timestamp: now,
+	}
+	if n.signature == "" {
+		n.signature = "1"
+	}
+
+	if keyID := t.attrs[attrKmsMasterKeyID]; keyID != "" {
+		sealed, err := seal(s.kms, keyID, t.arn, n.messageID, e.Message)
+		if err != nil {
+			return nil, nil, err
+		}
+		n.message, n.sealed = "", sealed
+	}
+
+	if t.fifo {
+		t.seq++
+		n.seq = fmt.Sprintf("%020d", t.seq)
+		t.dedups[dedupID] = &dedup{messageID: n.messageID, seq: n.seq, expires: now.Add(deduplicationSpan)}
+	}
+
+	for _, sub := range t.subs {
+		if sub.confirmed && sub.wants(e) {
+			n.targets = append(n.targets, newTarget(sub))
+		}
+	}
+	return &PublishBatchResultEntry{ID: e.ID, MessageID: n.messageID, SequenceNumber: n.seq}, n, nil
+}
+
+func (s *sns) Publish(req *PublishRequest) (*PublishResult, error) {
+	if req.PhoneNumber != "" {
+		return nil, invalidParameter("PhoneNumber Reason: SMS is not supported locally")
+	}
+	arn := req.TopicArn
+	if arn == "" {
+		arn = req.TargetArn
+	} else if req.TargetArn != "" {
+		return nil, invalidParameter("TopicArn Reason: Only one of TopicArn and TargetArn may be given")
+	}
+
+	s.lock.Lock()
+	t, err := s.topic(arn)
+	if err != nil {
+		s.lock.Unlock()
+		return nil, err
+	}
+	out, n, err := s.publish(t, &PublishBatchRequestEntry{
+		Message:                req.Message,
+		MessageAttributes:      req.MessageAttributes,
+		MessageDeduplicationID: req.MessageDeduplicationID,
+		MessageGroupID:         req.MessageGroupID,
+		MessageStructure:       req.MessageStructure,
+		Subject:                req.Subject,
+	})
+	s.lock.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	if n != nil {
+		s.deliver(n)
+	}
+	return &PublishResult{MessageID: out.MessageID, SequenceNumber: out.SequenceNumber}, nil
+}
+
+// checkBatch checks the entry ids of a batch request.
+func checkBatch(ids []string) error {
+	if len(ids) == 0 {
+		return common.Errorf("EmptyBatchRequest", "The batch request doesn't contain any entries.")
+	}
+	if len(ids) > maxBatchEntries {
+		return common.Errorf("TooManyEntriesInBatchRequest", "The batch request contains more entries than permissible.")
+	}
+	seen := map[string]bool{}
+	for _, id := range ids {
+		if !batchIDPattern.MatchString(id) {
+			return common.Errorf("InvalidBatchEntryId", "The Id of a batch entry in a batch request doesn't abide by the specification.")
+		}
+		if seen[id] {
+			return common.Errorf("BatchEntryIdsNotDistinct", "Two or more batch entries in the request have the same Id.")
+		}
+		seen[id] = true
+	}
+	return nil
+}
+
+func batchError(id string, err error) BatchResultErrorEntry {
+	out := BatchResultErrorEntry{ID: id, Code: "InternalError", Message: err.Error()}
+	if ce, ok := err.(common.Error); ok {
+		out.Code, out.Message, out.SenderFault = ce.Code, ce.Message, true
+	}
+	return out
+}
+
+func (s *sns) PublishBatch(req *PublishBatchRequest) (*PublishBatchResult, error) {
+	ids := []string{}
+	size := 0
+	for _, e := range req.PublishBatchRequestEntries {
+		ids = append(ids, e.ID)
+		size += len(e.Message)
+	}
+	if err := checkBatch(ids); err != nil {
+		return nil, err
+	}
+	if size > maxMessageSize {
+		return nil, common.Errorf("BatchRequestTooLong", "The length of all the messages put together is more than the limit.")
+	}
+
+	s.lock.Lock()
+	t, err := s.topic(req.TopicArn)
+	if err != nil {
+		s.lock.Unlock()
+		return nil, err
+	}
+	out := &PublishBatchResult{Failed: []BatchResultErrorEntry{}, Successful: []PublishBatchResultEntry{}}
+	notifications := []*notification{}
+	for i := range req.PublishBatchRequestEntries {
+		e := &req.PublishBatchRequestEntries[i]
+		result, n, err := s.publish(t, e)
+		if err != nil {
+			out.Failed = append(out.Failed, batchError(e.ID, err))
+			continue
+		}
+		out.Successful = append(out.Successful, *result)
+		if n != nil {
+			notifications = append(notifications, n)
+		}
+	}
+	s.lock.Unlock()
+
+	for _, n := range notifications {
+		s.deliver(n)
+	}
+	return out, nil
+}
+
+//
+// Tags.
+//
+
+func validateTags(tags []Tag) error {
+	for _, tag := range tags {
+		if tag.Key == "" || len(tag.Key) > 128 || len(tag.Value) > 256 {
+			return invalidParameter("Tags Reason: tag keys must be 1 to 128 characters and values at most 256")
+		}
+	}
+	return nil
+}
+
+// tagged looks up a topic for the tagging calls. The caller must hold
+// s.lock.
+func (s *sns) tagged(arn string) (*topic, error) {
+	t, ok := s.topics[topicName(arn)]
+	if !ok {
+		return nil, common.Errorf("ResourceNotFound", "Resource does not exist")
+	}
+	return t, nil
+}
+
+func (s *sns) TagResource(req *TagResourceRequest) (*TagResourceResult, error) {
+	if err := validateTags(req.Tags); err != nil {
+		return nil, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	t, err := s.tagged(req.ResourceArn)
+	if err != nil {
+		return nil, err
+	}
+	tags := map[string]string{}
+	for k, v := range t.tags {
+		tags[k] = v
+	}
+	for _, tag := range req.Tags {
+		tags[tag.Key] = tag.Value
+	}
+	if len(tags) > maxTags {
+		return nil, common.Errorf("TagLimitExceeded", "Could not complete request: tag quota of per resource exceeded")
+	}
+	t.tags = tags
+	return &TagResourceResult{}, nil
+}
+
+func (s *sns) UntagResource(req *UntagResourceRequest) (*UntagResourceResult, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	t, err := s.tagged(req.ResourceArn)
+	if err != nil {
+		return nil, err
+	}
+	for _, k := range req.TagKeys {
+		delete(t.tags, k)
+	}
+	return &UntagResourceResult{}, nil
+}
+
+func (s *sns) ListTagsForResource(req *ListTagsForResourceRequest) (*ListTagsForResourceResult, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	t, err := s.tagged(req.ResourceArn)
+	if err != nil {
+		return nil, err
+	}
+	keys := []string{}
+	for k := range t.tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	out := &ListTagsForResourceResult{Tags: []Tag{}}
+	for _, k := range keys {
+		out.Tags = append(out.Tags, Tag{Key: k, Value: t.tags[k]})
+	}
+	return out, nil
+}
@@ -0,0 +1,134 @@
+package sns
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// Delivery is a message as sent to an HTTP endpoint or a sink.
+type Delivery struct {
+	// Type is SubscriptionConfirmation, Notification or
+	// UnsubscribeConfirmation.
+	Type            string `json:"type"`
+	MessageID       string `json:"messageId"`
+	TopicArn        string `json:"topicArn"`
+	SubscriptionArn string `json:"subscriptionArn"`
+	// Raw is set for raw message deliveries, whose Body is the message
+	// itself rather than a JSON envelope.
+	Raw  bool   `json:"raw"`
+	Body string `json:"body"`
+}
+
+// Sink receives deliveries in process, for subscriptions with the sink
+// protocol. Like an HTTP endpoint, a sink is first sent a
+// SubscriptionConfirmation, and nothing else until the subscription is
+// confirmed with the token in it.
+type Sink interface {
+	Deliver(d *Delivery) error
+}
+
+// Inbox is a sink that keeps the most recent deliveries in memory, for
+// checking fan-out by hand. Once told which SNS to use, it confirms its
+// subscriptions itself.
+type Inbox struct {
+	lock       sync.Mutex
+	sns        SNS
+	size       int
+	deliveries []*Delivery
+}
+
+// NewInbox creates an inbox holding up to size deliveries.
+func NewInbox(size int) *Inbox {
+	return &Inbox{size: size}
+}
+
+// ConfirmWith makes the inbox confirm subscriptions by calling
+// ConfirmSubscription on sns.
+func (i *Inbox) ConfirmWith(sns SNS) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	i.sns = sns
+}
+
+// Deliver keeps a delivery, evicting the oldest if the inbox is full.
+func (i *Inbox) Deliver(d *Delivery) error {
+	i.lock.Lock()
+	if i.size > 0 {
+		if len(i.deliveries) == i.size {
+			i.deliveries = i.deliveries[1:]
+		}
+		i.deliveries = append(i.deliveries, d)
+	}
+	sns := i.sns
+	i.lock.Unlock()
+
+	if d.Type != "SubscriptionConfirmation" || sns == nil {
+		return nil
+	}
+	env := document{}
+	if err := json.Unmarshal([]byte(d.Body), &env); err != nil {
+		return err
+	}
+	_, err := sns.ConfirmSubscription(&ConfirmSubscriptionRequest{
+		TopicArn: env.TopicArn,
+		Token:    env.Token,
+	})
+	return err
+}
+
+// Deliveries returns the deliveries for a topic or subscription, or all of
+// them if both are empty, newest first.
+func (i *Inbox) Deliveries(topicArn string, subscriptionArn string, limit int) []*Delivery {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	out := []*Delivery{}
+	for j := len(i.deliveries) - 1; j >= 0; j-- {
+		d := i.deliveries[j]
+		if topicArn != "" && d.TopicArn != topicArn {
+			continue
+		}
+		if subscriptionArn != "" && d.SubscriptionArn != subscriptionArn {
+			continue
+		}
+		out = append(out, d)
+		if limit > 0 && len(out) >= limit {
+			break
+		}
+	}
+	return out
+}
+
+// ServeHTTP serves deliveries as a JSON array, filtered by the topicArn,
+// subscriptionArn and limit query parameters. DELETE empties the inbox.
+func (i *Inbox) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	if req.Method == "DELETE" {
+		i.lock.Lock()
+		i.deliveries = nil
+		i.lock.Unlock()
+		resp.WriteHeader(204)
+		return
+	}
+
+	q := req.URL.Query()
+	limit := 0
+	if l := q.Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil {
+			http.Error(resp, "invalid limit: "+err.Error(), 400)
+			return
+		}
+		limit = n
+	}
+
+	body, err := json.Marshal(i.Deliveries(q.Get("topicArn"), q.Get("subscriptionArn"), limit))
+	if err != nil {
+		http.Error(resp, err.Error(), 500)
+		return
+	}
+
+	resp.Header().Add("Content-Type", "application/json")
+	resp.Write(body)
+}
@@ -0,0 +1,403 @@
+package sns_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/fernomac/aws-local/pkg/common"
+	"github.com/fernomac/aws-local/pkg/kms"
+	"github.com/fernomac/aws-local/pkg/sns"
+	"github.com/fernomac/aws-local/pkg/sqs"
+)
+
+// testClock is a clock the tests move by hand.
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	return c.now
+}
+
+func code(err error) string {
+	if ce, ok := err.(common.Error); ok {
+		return ce.Code
+	}
+	if err != nil {
+		return err.Error()
+	}
+	return ""
+}
+
+// document is the part of the JSON sent to sinks and non-raw queue
+// subscriptions the tests look at.
+type document struct {
+	Type              string `json:"Type"`
+	Token             string `json:"Token"`
+	TopicArn          string `json:"TopicArn"`
+	Subject           string `json:"Subject"`
+	Message           string `json:"Message"`
+	SequenceNumber    string `json:"SequenceNumber"`
+	MessageAttributes map[string]struct {
+		Type  string `json:"Type"`
+		Value string `json:"Value"`
+	} `json:"MessageAttributes"`
+}
+
+func parse(t *testing.T, body string) document {
+	doc := document{}
+	if err := json.Unmarshal([]byte(body), &doc); err != nil {
+		t.Fatalf("%v: %v", body, err)
+	}
+	return doc
+}
+
+type fixture struct {
+	sns    sns.SNS
+	queues sqs.SQS
+	inbox  *sns.Inbox
+	clock  *testClock
+}
+
+// newFixture creates an SNS that delivers to an SQS and to an inbox sink
+// called "inbox", which doesn't confirm its subscriptions by itself.
+func newFixture() *fixture {
+	clock := &testClock{now: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)}
+	k := kms.New()
+	queues := sqs.New(k, sqs.WithClock(clock))
+	inbox := sns.NewInbox(100)
+	return &fixture{
+		sns:    sns.New(k, sns.WithClock(clock), sns.WithQueues(queues), sns.WithSink("inbox", inbox)),
+		queues: queues,
+		inbox:  inbox,
+		clock:  clock,
+	}
+}
+
+func (f *fixture) topic(t *testing.T, name string, attrs sns.Attributes) string {
+	out, err := f.sns.CreateTopic(&sns.CreateTopicRequest{Name: name, Attributes: attrs})
+	if err != nil {
+		t.Fatalf("%v: %v", name, err)
+	}
+	return out.TopicArn
+}
+
+// queue creates a queue and returns its URL and ARN.
+func (f *fixture) queue(t *testing.T, name string, attrs sqs.Attributes) (string, string) {
+	out, err := f.queues.CreateQueue(&sqs.CreateQueueRequest{QueueName: name, Attributes: attrs})
+	if err != nil {
+		t.Fatalf("%v: %v", name, err)
+	}
+	arn, err := f.queues.GetQueueAttributes(&sqs.GetQueueAttributesRequest{QueueURL: out.QueueURL, AttributeNames: []string{"QueueArn"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out.QueueURL, arn.Attributes["QueueArn"]
+}
+
+func (f *fixture) subscribe(t *testing.T, topicArn string, protocol string, endpoint string, attrs sns.Attributes) string {
+	out, err := f.sns.Subscribe(&sns.SubscribeRequest{TopicArn: topicArn, Protocol: protocol, Endpoint: endpoint, Attributes: attrs, ReturnSubscriptionArn: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out.SubscriptionArn
+}
+
+// confirm confirms a sink subscription with the token it was sent.
+func (f *fixture) confirm(t *testing.T, topicArn string, subscriptionArn string) {
+	for _, d := range f.inbox.Deliveries(topicArn, subscriptionArn, 0) {
+		if d.Type == "SubscriptionConfirmation" {
+			if _, err := f.sns.ConfirmSubscription(&sns.ConfirmSubscriptionRequest{TopicArn: topicArn, Token: parse(t, d.Body).Token}); err != nil {
+				t.Fatal(err)
+			}
+			return
+		}
+	}
+	t.Fatalf("%v was not asked to confirm", subscriptionArn)
+}
+
+func (f *fixture) publish(t *testing.T, req *sns.PublishRequest) *sns.PublishResult {
+	out, err := f.sns.Publish(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+// notifications returns the notifications the inbox has had for a
+// subscription, oldest first.
+func (f *fixture) notifications(subscriptionArn string) []*sns.Delivery {
+	out := []*sns.Delivery{}
+	deliveries := f.inbox.Deliveries("", subscriptionArn, 0)
+	for i := len(deliveries) - 1; i >= 0; i-- {
+		if deliveries[i].Type == "Notification" {
+			out = append(out, deliveries[i])
+		}
+	}
+	return out
+}
+
+func (f *fixture) receive(t *testing.T, queueURL string) []sqs.Message {
+	zero := 0
+	out, err := f.queues.ReceiveMessage(&sqs.ReceiveMessageRequest{QueueURL: queueURL, MaxNumberOfMessages: 10, MessageAttributeNames: []string{"All"}, WaitTimeSeconds: &zero})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out.Messages
+}
+
+func TestSubscriptionConfirmation(t *testing.T) {
+	f := newFixture()
+	topicArn := f.topic(t, "orders", nil)
+
+	out, err := f.sns.Subscribe(&sns.SubscribeRequest{TopicArn: topicArn, Protocol: "sink", Endpoint: "inbox"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.SubscriptionArn != "pending confirmation" {
+		t.Errorf("got %v, want pending confirmation", out.SubscriptionArn)
+	}
+	subs, err := f.sns.ListSubscriptionsByTopic(&sns.ListSubscriptionsByTopicRequest{TopicArn: topicArn})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(subs.Subscriptions) != 1 || subs.Subscriptions[0].SubscriptionArn != "PendingConfirmation" {
+		t.Errorf("got %+v", subs.Subscriptions)
+	}
+
+	requests := f.inbox.Deliveries(topicArn, "", 0)
+	if len(requests) != 1 || requests[0].Type != "SubscriptionConfirmation" {
+		t.Fatalf("got %+v", requests)
+	}
+	subscriptionArn := requests[0].SubscriptionArn
+	doc := parse(t, requests[0].Body)
+	if doc.Type != "SubscriptionConfirmation" || doc.Token == "" || doc.TopicArn != topicArn {
+		t.Errorf("got %+v", doc)
+	}
+
+	// Nothing is delivered until the subscription is confirmed.
+	f.publish(t, &sns.PublishRequest{TopicArn: topicArn, Message: "early"})
+	if got := f.notifications(subscriptionArn); len(got) != 0 {
+		t.Errorf("pending subscription got %+v", got)
+	}
+
+	if _, err := f.sns.ConfirmSubscription(&sns.ConfirmSubscriptionRequest{TopicArn: topicArn, Token: "wrong"}); code(err) != "InvalidParameter" {
+		t.Errorf("wrong token: got %v", err)
+	}
+	confirmed, err := f.sns.ConfirmSubscription(&sns.ConfirmSubscriptionRequest{TopicArn: topicArn, Token: doc.Token})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if confirmed.SubscriptionArn != subscriptionArn {
+		t.Errorf("got %v, want %v", confirmed.SubscriptionArn, subscriptionArn)
+	}
+
+	f.publish(t, &sns.PublishRequest{TopicArn: topicArn, Message: "late"})
+	got := f.notifications(subscriptionArn)
+	if len(got) != 1 || parse(t, got[0].Body).Message != "late" {
+		t.Errorf("got %+v", got)
+	}
+
+	if _, err := f.sns.Unsubscribe(&sns.UnsubscribeRequest{SubscriptionArn: subscriptionArn}); err != nil {
+		t.Fatal(err)
+	}
+	if last := f.inbox.Deliveries(topicArn, subscriptionArn, 1); len(last) != 1 || last[0].Type != "UnsubscribeConfirmation" {
+		t.Errorf("got %+v, want an UnsubscribeConfirmation", last)
+	}
+}
+
+func TestConfirmationTokenExpiry(t *testing.T) {
+	f := newFixture()
+	topicArn := f.topic(t, "orders", nil)
+	f.subscribe(t, topicArn, "sink", "inbox", nil)
+	token := parse(t, f.inbox.Deliveries(topicArn, "", 1)[0].Body).Token
+
+	f.clock.now = f.clock.now.Add(3 * 24 * time.Hour)
+	if _, err := f.sns.ConfirmSubscription(&sns.ConfirmSubscriptionRequest{TopicArn: topicArn, Token: token}); code(err) != "InvalidParameter" {
+		t.Errorf("expired token: got %v, want InvalidParameter", err)
+	}
+}
+
+func TestInboxConfirms(t *testing.T) {
+	f := newFixture()
+	f.inbox.ConfirmWith(f.sns)
+	topicArn := f.topic(t, "orders", nil)
+	subscriptionArn := f.subscribe(t, topicArn, "sink", "inbox", nil)
+
+	attrs, err := f.sns.GetSubscriptionAttributes(&sns.GetSubscriptionAttributesRequest{SubscriptionArn: subscriptionArn})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attrs.Attributes["PendingConfirmation"] != "false" {
+		t.Errorf("got attributes %v", attrs.Attributes)
+	}
+}
+
+func TestRawDelivery(t *testing.T) {
+	f := newFixture()
+	topicArn := f.topic(t, "orders", nil)
+	rawURL, rawArn := f.queue(t, "raw", nil)
+	wrappedURL, wrappedArn := f.queue(t, "wrapped", nil)
+	f.subscribe(t, topicArn, "sqs", rawArn, sns.Attributes{"RawMessageDelivery": "true"})
+	f.subscribe(t, topicArn, "sqs", wrappedArn, nil)
+	rawSink := f.subscribe(t, topicArn, "sink", "inbox", sns.Attributes{"RawMessageDelivery": "true"})
+	f.confirm(t, topicArn, rawSink)
+
+	f.publish(t, &sns.PublishRequest{
+		TopicArn:          topicArn,
+		Message:           "hello",
+		Subject:           "greeting",
+		MessageAttributes: map[string]sns.MessageAttributeValue{"store": {DataType: "String", StringValue: "example_corp"}},
+	})
+
+	raw := f.receive(t, rawURL)
+	if len(raw) != 1 || raw[0].Body != "hello" || raw[0].MessageAttributes["store"].StringValue != "example_corp" {
+		t.Errorf("raw queue: got %+v", raw)
+	}
+
+	wrapped := f.receive(t, wrappedURL)
+	if len(wrapped) != 1 || len(wrapped[0].MessageAttributes) != 0 {
+		t.Fatalf("wrapped queue: got %+v", wrapped)
+	}
+	doc := parse(t, wrapped[0].Body)
+	if doc.Type != "Notification" || doc.Message != "hello" || doc.Subject != "greeting" || doc.TopicArn != topicArn ||
+		doc.MessageAttributes["store"].Type != "String" || doc.MessageAttributes["store"].Value != "example_corp" {
+		t.Errorf("wrapped queue: got %+v", doc)
+	}
+
+	got := f.notifications(rawSink)
+	if len(got) != 1 || !got[0].Raw || got[0].Body != "hello" {
+		t.Errorf("raw sink: got %+v", got)
+	}
+}
+
+func TestDeliveryFiltering(t *testing.T) {
+	f := newFixture()
+	topicArn := f.topic(t, "orders", nil)
+	allURL, allArn := f.queue(t, "all", nil)
+	bigURL, bigArn := f.queue(t, "big", nil)
+	goldURL, goldArn := f.queue(t, "gold", nil)
+	f.subscribe(t, topicArn, "sqs", allArn, sns.Attributes{"RawMessageDelivery": "true"})
+	f.subscribe(t, topicArn, "sqs", bigArn, sns.Attributes{"RawMessageDelivery": "true", "FilterPolicy": `{"total": [{"numeric": [">=", 100]}]}`})
+	f.subscribe(t, topicArn, "sqs", goldArn, sns.Attributes{"RawMessageDelivery": "true", "FilterPolicyScope": "MessageBody", "FilterPolicy": `{"customer": {"tier": ["gold"]}}`})
+	sink := f.subscribe(t, topicArn, "sink", "inbox", sns.Attributes{"FilterPolicy": `{"total": [{"exists": false}]}`})
+	f.confirm(t, topicArn, sink)
+
+	total := func(n string) map[string]sns.MessageAttributeValue {
+		return map[string]sns.MessageAttributeValue{"total": {DataType: "Number", StringValue: n}}
+	}
+	f.publish(t, &sns.PublishRequest{TopicArn: topicArn, Message: `{"customer": {"tier": "gold"}}`, MessageAttributes: total("150")})
+	f.publish(t, &sns.PublishRequest{TopicArn: topicArn, Message: `{"customer": {"tier": "silver"}}`, MessageAttributes: total("50")})
+	f.publish(t, &sns.PublishRequest{TopicArn: topicArn, Message: `{"customer": {"tier": "gold"}}`})
+
+	bodies := func(queueURL string) []string {
+		out := []string{}
+		for _, m := range f.receive(t, queueURL) {
+			out = append(out, m.Body)
+		}
+		return out
+	}
+	gold, silver := `{"customer": {"tier": "gold"}}`, `{"customer": {"tier": "silver"}}`
+	tests := []struct {
+		queueURL string
+		want     []string
+	}{
+		{allURL, []string{gold, silver, gold}},
+		{bigURL, []string{gold}},
+		{goldURL, []string{gold, gold}},
+	}
+	for _, test := range tests {
+		if got := bodies(test.queueURL); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%v: got %v, want %v", test.queueURL, got, test.want)
+		}
+	}
+	if got := f.notifications(sink); len(got) != 1 || parse(t, got[0].Body).Message != gold {
+		t.Errorf("sink: got %+v", got)
+	}
+}
+
+func TestMessageStructure(t *testing.T) {
+	f := newFixture()
+	topicArn := f.topic(t, "orders", nil)
+	queueURL, queueArn := f.queue(t, "q", nil)
+	f.subscribe(t, topicArn, "sqs", queueArn, sns.Attributes{"RawMessageDelivery": "true"})
+	sink := f.subscribe(t, topicArn, "sink", "inbox", sns.Attributes{"RawMessageDelivery": "true"})
+	f.confirm(t, topicArn, sink)
+
+	f.publish(t, &sns.PublishRequest{TopicArn: topicArn, MessageStructure: "json", Message: `{"default": "for everyone", "sqs": "for queues"}`})
+	if got := f.receive(t, queueURL); len(got) != 1 || got[0].Body != "for queues" {
+		t.Errorf("queue: got %+v", got)
+	}
+	if got := f.notifications(sink); len(got) != 1 || got[0].Body != "for everyone" {
+		t.Errorf("sink: got %+v", got)
+	}
+}
+
+func TestFifoDeduplication(t *testing.T) {
+	f := newFixture()
+	topicArn := f.topic(t, "orders.fifo", sns.Attributes{"FifoTopic": "true", "ContentBasedDeduplication": "true"})
+	queueURL, queueArn := f.queue(t, "orders.fifo", sqs.Attributes{"FifoQueue": "true"})
+	f.subscribe(t, topicArn, "sqs", queueArn, sns.Attributes{"RawMessageDelivery": "true"})
+	sink := f.subscribe(t, topicArn, "sink", "inbox", nil)
+	f.confirm(t, topicArn, sink)
+
+	first := f.publish(t, &sns.PublishRequest{TopicArn: topicArn, Message: "one", MessageGroupID: "g"})
+	again := f.publish(t, &sns.PublishRequest{TopicArn: topicArn, Message: "one", MessageGroupID: "g"})
+	if again.MessageID != first.MessageID || again.SequenceNumber != first.SequenceNumber {
+		t.Errorf("duplicate got %+v, want %+v", again, first)
+	}
+	second := f.publish(t, &sns.PublishRequest{TopicArn: topicArn, Message: "two", MessageGroupID: "g"})
+	if second.MessageID == first.MessageID || second.SequenceNumber <= first.SequenceNumber {
+		t.Errorf("got %+v after %+v", second, first)
+	}
+
+	// An explicit id overrides the content.
+	explicit := f.publish(t, &sns.PublishRequest{TopicArn: topicArn, Message: "three", MessageGroupID: "g", MessageDeduplicationID: "id-1"})
+	if dup := f.publish(t, &sns.PublishRequest{TopicArn: topicArn, Message: "other", MessageGroupID: "g", MessageDeduplicationID: "id-1"}); dup.MessageID != explicit.MessageID {
+		t.Errorf("same id got %v, want %v", dup.MessageID, explicit.MessageID)
+	}
+
+	// Once the interval passes, the same message is new again.
+	f.clock.now = f.clock.now.Add(5 * time.Minute)
+	if later := f.publish(t, &sns.PublishRequest{TopicArn: topicArn, Message: "one", MessageGroupID: "g"}); later.MessageID == first.MessageID {
+		t.Errorf("message after the interval was a duplicate")
+	}
+
+	messages := []string{}
+	for _, d := range f.notifications(sink) {
+		doc := parse(t, d.Body)
+		if doc.SequenceNumber == "" {
+			t.Errorf("%v has no sequence number", doc.Message)
+		}
+		messages = append(messages, doc.Message)
+	}
+	if want := []string{"one", "two", "three", "one"}; !reflect.DeepEqual(messages, want) {
+		t.Errorf("sink got %v, want %v", messages, want)
+	}
+	if got := f.receive(t, queueURL); len(got) == 0 || got[0].Body != "one" {
+		t.Errorf("queue got %+v", got)
+	}
+
+	tests := []struct {
+		topicArn string
+		req      sns.PublishRequest
+	}{
+		{topicArn, sns.PublishRequest{Message: "no group"}},
+		{f.topic(t, "plain.fifo", sns.Attributes{"FifoTopic": "true"}), sns.PublishRequest{Message: "no id", MessageGroupID: "g"}},
+		{f.topic(t, "standard", nil), sns.PublishRequest{Message: "id", MessageDeduplicationID: "x"}},
+	}
+	for _, test := range tests {
+		req := test.req
+		req.TopicArn = test.topicArn
+		if _, err := f.sns.Publish(&req); code(err) != "InvalidParameter" {
+			t.Errorf("%v: got %v, want InvalidParameter", req.Message, err)
+		}
+	}
+
+	_, standardArn := f.queue(t, "standard", nil)
+	if _, err := f.sns.Subscribe(&sns.SubscribeRequest{TopicArn: topicArn, Protocol: "sqs", Endpoint: standardArn}); code(err) != "InvalidParameter" {
+		t.Errorf("standard queue on a FIFO topic: got %v", err)
+	}
+}
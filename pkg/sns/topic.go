@@ -0,0 +1,326 @@
+package sns
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fernomac/aws-local/pkg/common"
+)
+
+// Topic attributes.
+const (
+	attrContentBasedDeduplication = "ContentBasedDeduplication"
+	attrDeliveryPolicy            = "DeliveryPolicy"
+	attrDisplayName               = "DisplayName"
+	attrFifoTopic                 = "FifoTopic"
+	attrKmsMasterKeyID            = "KmsMasterKeyId"
+	attrPolicy                    = "Policy"
+	attrSignatureVersion          = "SignatureVersion"
+	attrTracingConfig             = "TracingConfig"
+)
+
+// Subscription attributes.
+const (
+	attrFilterPolicy        = "FilterPolicy"
+	attrFilterPolicyScope   = "FilterPolicyScope"
+	attrRawMessageDelivery  = "RawMessageDelivery"
+	attrRedrivePolicy       = "RedrivePolicy"
+	attrSubscriptionRoleArn = "SubscriptionRoleArn"
+)
+
+// Subscription protocols.
+const (
+	protocolHTTP  = "http"
+	protocolHTTPS = "https"
+	protocolSink  = "sink"
+	protocolSQS   = "sqs"
+)
+
+// effectiveDeliveryPolicy is the delivery policy every topic reports. HTTP
+// deliveries are retried a few times, quickly, whatever it says.
+const effectiveDeliveryPolicy = `{"http":{"defaultHealthyRetryPolicy":{"minDelayTarget":20,"maxDelayTarget":20,"numRetries":3,"numMaxDelayRetries":0,"numNoDelayRetries":0,"numMinDelayRetries":0,"backoffFunction":"linear"},"disableSubscriptionOverrides":false,"defaultRequestPolicy":{"headerContentType":"text/plain; charset=UTF-8"}}}`
+
+var topicNamePattern = regexp.MustCompile(`^[A-Za-z0-9_\-]{1,256}$`)
+
+func topicArn(name string) string {
+	return fmt.Sprintf("arn:aws:sns:%v:%v:%v", common.Region, common.AccountID, name)
+}
+
+// topicName returns the name of the topic an ARN names, or "" if it isn't a
+// topic ARN in this account and region.
+func topicName(arn string) string {
+	prefix := fmt.Sprintf("arn:aws:sns:%v:%v:", common.Region, common.AccountID)
+	if !strings.HasPrefix(arn, prefix) {
+		return ""
+	}
+	return arn[len(prefix):]
+}
+
+func defaultPolicy(arn string) string {
+	return fmt.Sprintf(`{"Version":"2008-10-17","Id":"__default_policy_ID","Statement":[{"Sid":"__default_statement_ID","Effect":"Allow","Principal":{"AWS":"*"},"Action":["SNS:GetTopicAttributes","SNS:SetTopicAttributes","SNS:AddPermission","SNS:RemovePermission","SNS:DeleteTopic","SNS:Subscribe","SNS:ListSubscriptionsByTopic","SNS:Publish"],"Resource":"%v","Condition":{"StringEquals":{"AWS:SourceOwner":"%v"}}}]}`, arn, common.AccountID)
+}
+
+func invalidParameter(format string, args ...interface{}) error {
+	return common.Errorf("InvalidParameter", "Invalid parameter: "+format, args...)
+}
+
+func validBool(value string) bool {
+	return value == "true" || value == "false"
+}
+
+func validJSON(value string) bool {
+	obj := map[string]interface{}{}
+	return json.Unmarshal([]byte(value), &obj) == nil
+}
+
+// validateTopicAttribute checks a topic attribute. FifoTopic can only be set
+// when the topic is created.
+func validateTopicAttribute(name string, value string, fifo bool, creating bool) error {
+	switch name {
+	case attrDisplayName:
+		if len(value) > 100 {
+			return invalidParameter("DisplayName Reason: must be at most 100 characters")
+		}
+	case attrPolicy, attrDeliveryPolicy:
+		if value != "" && !validJSON(value) {
+			return invalidParameter("%v Reason: failed to parse JSON", name)
+		}
+	case attrKmsMasterKeyID:
+	case attrSignatureVersion:
+		if value != "" && value != "1" && value != "2" {
+			return invalidParameter("SignatureVersion Reason: must be 1 or 2")
+		}
+	case attrTracingConfig:
+		if value != "" && value != "PassThrough" && value != "Active" {
+			return invalidParameter("TracingConfig Reason: must be PassThrough or Active")
+		}
+	case attrFifoTopic:
+		if !creating {
+			return invalidParameter("AttributeName Reason: FifoTopic can only be set when a topic is created")
+		}
+		if !validBool(value) {
+			return invalidParameter("Attributes Reason: FifoTopic must be true or false")
+		}
+	case attrContentBasedDeduplication:
+		if !validBool(value) {
+			return invalidParameter("Attributes Reason: ContentBasedDeduplication must be true or false")
+		}
+		if !fifo {
+			return invalidParameter("Attributes Reason: Content based deduplication can only be set for FIFO topics")
+		}
+	default:
+		return invalidParameter("AttributeName")
+	}
+	return nil
+}
+
+// dedup remembers a FIFO message for the deduplication interval.
+type dedup struct {
+	messageID string
+	seq       string
+	expires   time.Time
+}
+
+// topic is a topic and its subscriptions, in the order they were made.
+type topic struct {
+	name    string
+	arn     string
+	fifo    bool
+	attrs   map[string]string
+	tags    map[string]string
+	subs    []*subscription
+	deleted int
+	dedups  map[string]*dedup
+	seq     int64
+}
+
+func newTopic(name string, fifo bool) *topic {
+	arn := topicArn(name)
+	t := &topic{
+		name:   name,
+		arn:    arn,
+		fifo:   fifo,
+		attrs:  map[string]string{attrPolicy: defaultPolicy(arn), attrDisplayName: ""},
+		tags:   map[string]string{},
+		dedups: map[string]*dedup{},
+	}
+	if fifo {
+		t.attrs[attrFifoTopic] = "true"
+		t.attrs[attrContentBasedDeduplication] = "false"
+	}
+	return t
+}
+
+func (t *topic) attributes() Attributes {
+	out := Attributes{}
+	for k, v := range t.attrs {
+		out[k] = v
+	}
+
+	confirmed, pending := 0, 0
+	for _, sub := range t.subs {
+		if sub.confirmed {
+			confirmed++
+		} else {
+			pending++
+		}
+	}
+	out["TopicArn"] = t.arn
+	out["Owner"] = common.AccountID
+	out["SubscriptionsConfirmed"] = strconv.Itoa(confirmed)
+	out["SubscriptionsPending"] = strconv.Itoa(pending)
+	out["SubscriptionsDeleted"] = strconv.Itoa(t.deleted)
+	out["EffectiveDeliveryPolicy"] = effectiveDeliveryPolicy
+	return out
+}
+
+func (t *topic) remove(sub *subscription) {
+	for i, s := range t.subs {
+		if s == sub {
+			t.subs = append(t.subs[:i], t.subs[i+1:]...)
+			t.deleted++
+			return
+		}
+	}
+}
+
+// expire drops deduplication entries whose interval has passed.
+func (t *topic) expire(now time.Time) {
+	for id, d := range t.dedups {
+		if !now.Before(d.expires) {
+			delete(t.dedups, id)
+		}
+	}
+}
+
+// subscription is a subscription to a topic. Subscriptions to HTTP endpoints
+// and sinks are pending until confirmed with their token.
+type subscription struct {
+	arn           string
+	topic         *topic
+	protocol      string
+	endpoint      string
+	attrs         map[string]string
+	policy        *policy
+	token         string
+	tokenExpires  time.Time
+	confirmed     bool
+	authenticated bool
+}
+
+// validateSubscriptionAttributes checks subscription attributes, returning
+// the filter policy they give.
+func validateSubscriptionAttributes(attrs map[string]string) (*policy, error) {
+	for name, value := range attrs {
+		switch name {
+		case attrRawMessageDelivery:
+			if !validBool(value) {
+				return nil, invalidParameter("Attributes Reason: RawMessageDelivery must be true or false")
+			}
+		case attrFilterPolicyScope:
+			if value != scopeAttributes && value != scopeBody {
+				return nil, invalidParameter("Attributes Reason: FilterPolicyScope must be MessageAttributes or MessageBody")
+			}
+		case attrDeliveryPolicy:
+			if value != "" && !validJSON(value) {
+				return nil, invalidParameter("Attributes Reason: DeliveryPolicy: failed to parse JSON")
+			}
+		case attrRedrivePolicy:
+			if value == "" {
+				continue
+			}
+			p := struct {
+				DeadLetterTargetArn string `json:"deadLetterTargetArn"`
+			}{}
+			if err := json.Unmarshal([]byte(value), &p); err != nil || queueName(p.DeadLetterTargetArn) == "" {
+				return nil, invalidParameter("RedrivePolicy: deadLetterTargetArn must be an SQS queue ARN")
+			}
+		case attrFilterPolicy, attrSubscriptionRoleArn:
+		default:
+			return nil, invalidParameter("AttributeName")
+		}
+	}
+
+	value := attrs[attrFilterPolicy]
+	if value == "" {
+		return nil, nil
+	}
+	scope := attrs[attrFilterPolicyScope]
+	if scope == "" {
+		scope = scopeAttributes
+	}
+	return parsePolicy(value, scope)
+}
+
+func knownSubscriptionAttribute(name string) bool {
+	switch name {
+	case attrDeliveryPolicy, attrFilterPolicy, attrFilterPolicyScope, attrRawMessageDelivery, attrRedrivePolicy, attrSubscriptionRoleArn:
+		return true
+	}
+	return false
+}
+
+func (sub *subscription) raw() bool {
+	return sub.attrs[attrRawMessageDelivery] == "true"
+}
+
+// deadLetterQueue returns the ARN of the queue undeliverable messages go to,
+// or "" if there isn't one.
+func (sub *subscription) deadLetterQueue() string {
+	p := struct {
+		DeadLetterTargetArn string `json:"deadLetterTargetArn"`
+	}{}
+	json.Unmarshal([]byte(sub.attrs[attrRedrivePolicy]), &p)
+	return p.DeadLetterTargetArn
+}
+
+func (sub *subscription) attributes() Attributes {
+	out := Attributes{}
+	for k, v := range sub.attrs {
+		out[k] = v
+	}
+	if _, ok := out[attrRawMessageDelivery]; !ok {
+		out[attrRawMessageDelivery] = "false"
+	}
+	if _, ok := out[attrFilterPolicy]; ok {
+		if _, ok := out[attrFilterPolicyScope]; !ok {
+			out[attrFilterPolicyScope] = scopeAttributes
+		}
+	}
+	out["SubscriptionArn"] = sub.arn
+	out["TopicArn"] = sub.topic.arn
+	out["Owner"] = common.AccountID
+	out["Protocol"] = sub.protocol
+	out["Endpoint"] = sub.endpoint
+	out["PendingConfirmation"] = strconv.FormatBool(!sub.confirmed)
+	out["ConfirmationWasAuthenticated"] = strconv.FormatBool(sub.authenticated)
+	return out
+}
+
+func (sub *subscription) describe() Subscription {
+	arn := sub.arn
+	if !sub.confirmed {
+		arn = "PendingConfirmation"
+	}
+	return Subscription{
+		Endpoint:        sub.endpoint,
+		Owner:           common.AccountID,
+		Protocol:        sub.protocol,
+		SubscriptionArn: arn,
+		TopicArn:        sub.topic.arn,
+	}
+}
+
+// queueName returns the name of the queue an SQS ARN names, or "" if it
+// isn't a queue ARN in this account.
+func queueName(arn string) string {
+	parts := strings.Split(arn, ":")
+	if len(parts) != 6 || parts[0] != "arn" || parts[2] != "sqs" || parts[4] != common.AccountID || parts[5] == "" {
+		return ""
+	}
+	return parts[5]
+}
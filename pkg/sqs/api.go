@@ -0,0 +1,370 @@
+package sqs
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"sort"
+)
+
+// SQS is the service interface for Amazon SQS.
+type SQS interface {
+	CreateQueue(*CreateQueueRequest) (*CreateQueueResult, error)
+	DeleteQueue(*DeleteQueueRequest) (*DeleteQueueResult, error)
+	GetQueueURL(*GetQueueURLRequest) (*GetQueueURLResult, error)
+	ListQueues(*ListQueuesRequest) (*ListQueuesResult, error)
+	GetQueueAttributes(*GetQueueAttributesRequest) (*GetQueueAttributesResult, error)
+	SetQueueAttributes(*SetQueueAttributesRequest) (*SetQueueAttributesResult, error)
+	PurgeQueue(*PurgeQueueRequest) (*PurgeQueueResult, error)
+	ListDeadLetterSourceQueues(*ListDeadLetterSourceQueuesRequest) (*ListDeadLetterSourceQueuesResult, error)
+
+	SendMessage(*SendMessageRequest) (*SendMessageResult, error)
+	SendMessageBatch(*SendMessageBatchRequest) (*SendMessageBatchResult, error)
+	ReceiveMessage(*ReceiveMessageRequest) (*ReceiveMessageResult, error)
+	DeleteMessage(*DeleteMessageRequest) (*DeleteMessageResult, error)
+	DeleteMessageBatch(*DeleteMessageBatchRequest) (*DeleteMessageBatchResult, error)
+	ChangeMessageVisibility(*ChangeMessageVisibilityRequest) (*ChangeMessageVisibilityResult, error)
+	ChangeMessageVisibilityBatch(*ChangeMessageVisibilityBatchRequest) (*ChangeMessageVisibilityBatchResult, error)
+}
+
+// Attributes is a map of queue or message attributes. The query protocol
+// writes it as a flattened list of Name and Value pairs.
+type Attributes map[string]string
+
+// MarshalXML writes the attributes as repeated elements, in name order.
+func (a Attributes) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	type entry struct {
+		Name  string `xml:"Name"`
+		Value string `xml:"Value"`
+	}
+
+	names := []string{}
+	for name := range a {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if err := e.EncodeElement(entry{name, a[name]}, start); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MessageAttributeValue is the value of a message attribute. DataType is
+// String, Number or Binary, optionally with a custom suffix such as
+// "Number.int".
+type MessageAttributeValue struct {
+	BinaryListValues [][]byte `json:"BinaryListValues,omitempty" query:"BinaryListValue,flattened"`
+	BinaryValue      []byte   `json:"BinaryValue,omitempty" query:"BinaryValue"`
+	DataType         string   `json:"DataType" query:"DataType"`
+	StringListValues []string `json:"StringListValues,omitempty" query:"StringListValue,flattened"`
+	StringValue      string   `json:"StringValue,omitempty" query:"StringValue"`
+}
+
+// MessageAttributes is a map of message attributes. The query protocol
+// writes it as a flattened list of Name and Value pairs.
+type MessageAttributes map[string]MessageAttributeValue
+
+// MarshalXML writes the attributes as repeated elements, in name order, with
+// binary values base64 encoded.
+func (a MessageAttributes) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	type value struct {
+		BinaryListValues []string `xml:"BinaryListValue,omitempty"`
+		BinaryValue      string   `xml:"BinaryValue,omitempty"`
+		DataType         string   `xml:"DataType"`
+		StringListValues []string `xml:"StringListValue,omitempty"`
+		StringValue      string   `xml:"StringValue,omitempty"`
+	}
+	type entry struct {
+		Name  string `xml:"Name"`
+		Value value  `xml:"Value"`
+	}
+
+	names := []string{}
+	for name := range a {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		v := a[name]
+		out := entry{Name: name, Value: value{
+			DataType:         v.DataType,
+			StringListValues: v.StringListValues,
+			StringValue:      v.StringValue,
+		}}
+		if v.BinaryValue != nil {
+			out.Value.BinaryValue = base64.StdEncoding.EncodeToString(v.BinaryValue)
+		}
+		for _, b := range v.BinaryListValues {
+			out.Value.BinaryListValues = append(out.Value.BinaryListValues, base64.StdEncoding.EncodeToString(b))
+		}
+		if err := e.EncodeElement(out, start); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Message is a message received from a queue.
+type Message struct {
+	Attributes             Attributes        `json:"Attributes,omitempty" xml:"Attribute,omitempty"`
+	Body                   string            `json:"Body" xml:"Body"`
+	MD5OfBody              string            `json:"MD5OfBody" xml:"MD5OfBody"`
+	MD5OfMessageAttributes string            `json:"MD5OfMessageAttributes,omitempty" xml:"MD5OfMessageAttributes,omitempty"`
+	MessageAttributes      MessageAttributes `json:"MessageAttributes,omitempty" xml:"MessageAttribute,omitempty"`
+	MessageID              string            `json:"MessageId" xml:"MessageId"`
+	ReceiptHandle          string            `json:"ReceiptHandle" xml:"ReceiptHandle"`
+}
+
+// BatchResultErrorEntry says why one entry of a batch failed.
+type BatchResultErrorEntry struct {
+	Code        string `json:"Code" xml:"Code"`
+	ID          string `json:"Id" xml:"Id"`
+	Message     string `json:"Message,omitempty" xml:"Message,omitempty"`
+	SenderFault bool   `json:"SenderFault" xml:"SenderFault"`
+}
+
+//
+// API shapes for queues.
+//
+
+// CreateQueueRequest is a request to CreateQueue.
+type CreateQueueRequest struct {
+	Attributes Attributes        `json:"Attributes" query:"Attribute,flattened,key=Name,value=Value"`
+	QueueName  string            `json:"QueueName" query:"QueueName"`
+	Tags       map[string]string `json:"tags" query:"Tag,flattened,key=Key,value=Value"`
+}
+
+// CreateQueueResult is the result of CreateQueue.
+type CreateQueueResult struct {
+	QueueURL string `json:"QueueUrl" xml:"QueueUrl"`
+}
+
+// DeleteQueueRequest is a request to DeleteQueue.
+type DeleteQueueRequest struct {
+	QueueURL string `json:"QueueUrl" query:"QueueUrl"`
+}
+
+// DeleteQueueResult is the result of DeleteQueue.
+type DeleteQueueResult struct{}
+
+// GetQueueURLRequest is a request to GetQueueUrl.
+type GetQueueURLRequest struct {
+	QueueName              string `json:"QueueName" query:"QueueName"`
+	QueueOwnerAWSAccountID string `json:"QueueOwnerAWSAccountId" query:"QueueOwnerAWSAccountId"`
+}
+
+// GetQueueURLResult is the result of GetQueueUrl.
+type GetQueueURLResult struct {
+	QueueURL string `json:"QueueUrl" xml:"QueueUrl"`
+}
+
+// ListQueuesRequest is a request to ListQueues. Without MaxResults it
+// returns up to 1000 queues and no NextToken.
+type ListQueuesRequest struct {
+	MaxResults      int    `json:"MaxResults" query:"MaxResults"`
+	NextToken       string `json:"NextToken" query:"NextToken"`
+	QueueNamePrefix string `json:"QueueNamePrefix" query:"QueueNamePrefix"`
+}
+
+// ListQueuesResult is the result of ListQueues.
+type ListQueuesResult struct {
+	NextToken string   `json:"NextToken,omitempty" xml:"NextToken,omitempty"`
+	QueueURLs []string `json:"QueueUrls,omitempty" xml:"QueueUrl"`
+}
+
+// GetQueueAttributesRequest is a request to GetQueueAttributes.
+// AttributeNames may include All.
+type GetQueueAttributesRequest struct {
+	AttributeNames []string `json:"AttributeNames" query:"AttributeName,flattened"`
+	QueueURL       string   `json:"QueueUrl" query:"QueueUrl"`
+}
+
+// GetQueueAttributesResult is the result of GetQueueAttributes.
+type GetQueueAttributesResult struct {
+	Attributes Attributes `json:"Attributes,omitempty" xml:"Attribute,omitempty"`
+}
+
+// SetQueueAttributesRequest is a request to SetQueueAttributes.
+type SetQueueAttributesRequest struct {
+	Attributes Attributes `json:"Attributes" query:"Attribute,flattened,key=Name,value=Value"`
+	QueueURL   string     `json:"QueueUrl" query:"QueueUrl"`
+}
+
+// SetQueueAttributesResult is the result of SetQueueAttributes.
+type SetQueueAttributesResult struct{}
+
+// PurgeQueueRequest is a request to PurgeQueue.
+type PurgeQueueRequest struct {
+	QueueURL string `json:"QueueUrl" query:"QueueUrl"`
+}
+
+// PurgeQueueResult is the result of PurgeQueue.
+type PurgeQueueResult struct{}
+
+// ListDeadLetterSourceQueuesRequest is a request to
+// ListDeadLetterSourceQueues.
+type ListDeadLetterSourceQueuesRequest struct {
+	MaxResults int    `json:"MaxResults" query:"MaxResults"`
+	NextToken  string `json:"NextToken" query:"NextToken"`
+	QueueURL   string `json:"QueueUrl" query:"QueueUrl"`
+}
+
+// ListDeadLetterSourceQueuesResult is the result of
+// ListDeadLetterSourceQueues.
+type ListDeadLetterSourceQueuesResult struct {
+	NextToken string   `json:"NextToken,omitempty" xml:"NextToken,omitempty"`
+	QueueURLs []string `json:"queueUrls" xml:"QueueUrl"`
+}
+
+//
+// API shapes for messages.
+//
+
+// SendMessageRequest is a request to SendMessage. MessageGroupId and
+// MessageDeduplicationId are for FIFO queues; DelaySeconds is for standard
+// ones.
+type SendMessageRequest struct {
+	DelaySeconds            *int              `json:"DelaySeconds" query:"DelaySeconds"`
+	MessageAttributes       MessageAttributes `json:"MessageAttributes" query:"MessageAttribute,flattened,key=Name,value=Value"`
+	MessageBody             string            `json:"MessageBody" query:"MessageBody"`
+	MessageDeduplicationID  string            `json:"MessageDeduplicationId" query:"MessageDeduplicationId"`
+	MessageGroupID          string            `json:"MessageGroupId" query:"MessageGroupId"`
+	MessageSystemAttributes MessageAttributes `json:"MessageSystemAttributes" query:"MessageSystemAttribute,flattened,key=Name,value=Value"`
+	QueueURL                string            `json:"QueueUrl" query:"QueueUrl"`
+}
+
+// SendMessageResult is the result of SendMessage. SequenceNumber is only set
+// for FIFO queues.
+type SendMessageResult struct {
+	MD5OfMessageAttributes       string `json:"MD5OfMessageAttributes,omitempty" xml:"MD5OfMessageAttributes,omitempty"`
+	MD5OfMessageBody             string `json:"MD5OfMessageBody" xml:"MD5OfMessageBody"`
+	MD5OfMessageSystemAttributes string `json:"MD5OfMessageSystemAttributes,omitempty" xml:"MD5OfMessageSystemAttributes,omitempty"`
+	MessageID                    string `json:"MessageId" xml:"MessageId"`
+	SequenceNumber               string `json:"SequenceNumber,omitempty" xml:"SequenceNumber,omitempty"`
+}
+
+// SendMessageBatchRequestEntry is a message in a SendMessageBatch request.
+type SendMessageBatchRequestEntry struct {
+	DelaySeconds            *int              `json:"DelaySeconds" query:"DelaySeconds"`
+	ID                      string            `json:"Id" query:"Id"`
+	MessageAttributes       MessageAttributes `json:"MessageAttributes" query:"MessageAttribute,flattened,key=Name,value=Value"`
+	MessageBody             string            `json:"MessageBody" query:"MessageBody"`
+	MessageDeduplicationID  string            `json:"MessageDeduplicationId" query:"MessageDeduplicationId"`
+	MessageGroupID          string            `json:"MessageGroupId" query:"MessageGroupId"`
+	MessageSystemAttributes MessageAttributes `json:"MessageSystemAttributes" query:"MessageSystemAttribute,flattened,key=Name,value=Value"`
+}
+
+// SendMessageBatchRequest is a request to SendMessageBatch.
+type SendMessageBatchRequest struct {
+	Entries  []SendMessageBatchRequestEntry `json:"Entries" query:"SendMessageBatchRequestEntry,flattened"`
+	QueueURL string                         `json:"QueueUrl" query:"QueueUrl"`
+}
+
+// SendMessageBatchResultEntry is a message SendMessageBatch sent.
+type SendMessageBatchResultEntry struct {
+	ID                           string `json:"Id" xml:"Id"`
+	MD5OfMessageAttributes       string `json:"MD5OfMessageAttributes,omitempty" xml:"MD5OfMessageAttributes,omitempty"`
+	MD5OfMessageBody             string `json:"MD5OfMessageBody" xml:"MD5OfMessageBody"`
+	MD5OfMessageSystemAttributes string `json:"MD5OfMessageSystemAttributes,omitempty" xml:"MD5OfMessageSystemAttributes,omitempty"`
+	MessageID                    string `json:"MessageId" xml:"MessageId"`
+	SequenceNumber               string `json:"SequenceNumber,omitempty" xml:"SequenceNumber,omitempty"`
+}
+
+// SendMessageBatchResult is the result of SendMessageBatch.
+type SendMessageBatchResult struct {
+	Failed     []BatchResultErrorEntry       `json:"Failed" xml:"BatchResultErrorEntry"`
+	Successful []SendMessageBatchResultEntry `json:"Successful" xml:"SendMessageBatchResultEntry"`
+}
+
+// ReceiveMessageRequest is a request to ReceiveMessage. AttributeNames and
+// MessageSystemAttributeNames both name the system attributes to return;
+// MessageAttributeNames may use All, .* or a prefix such as "foo.*".
+type ReceiveMessageRequest struct {
+	AttributeNames              []string `json:"AttributeNames" query:"AttributeName,flattened"`
+	MaxNumberOfMessages         int      `json:"MaxNumberOfMessages" query:"MaxNumberOfMessages"`
+	MessageAttributeNames       []string `json:"MessageAttributeNames" query:"MessageAttributeName,flattened"`
+	MessageSystemAttributeNames []string `json:"MessageSystemAttributeNames" query:"MessageSystemAttributeName,flattened"`
+	QueueURL                    string   `json:"QueueUrl" query:"QueueUrl"`
+	ReceiveRequestAttemptID     string   `json:"ReceiveRequestAttemptId" query:"ReceiveRequestAttemptId"`
+	VisibilityTimeout           *int     `json:"VisibilityTimeout" query:"VisibilityTimeout"`
+	WaitTimeSeconds             *int     `json:"WaitTimeSeconds" query:"WaitTimeSeconds"`
+}
+
+// ReceiveMessageResult is the result of ReceiveMessage.
+type ReceiveMessageResult struct {
+	Messages []Message `json:"Messages,omitempty" xml:"Message"`
+}
+
+// DeleteMessageRequest is a request to DeleteMessage.
+type DeleteMessageRequest struct {
+	QueueURL      string `json:"QueueUrl" query:"QueueUrl"`
+	ReceiptHandle string `json:"ReceiptHandle" query:"ReceiptHandle"`
+}
+
+// DeleteMessageResult is the result of DeleteMessage.
+type DeleteMessageResult struct{}
+
+// DeleteMessageBatchRequestEntry is a message to delete in a
+// DeleteMessageBatch request.
+type DeleteMessageBatchRequestEntry struct {
+	ID            string `json:"Id" query:"Id"`
+	ReceiptHandle string `json:"ReceiptHandle" query:"ReceiptHandle"`
+}
+
+// DeleteMessageBatchRequest is a request to DeleteMessageBatch.
+type DeleteMessageBatchRequest struct {
+	Entries  []DeleteMessageBatchRequestEntry `json:"Entries" query:"DeleteMessageBatchRequestEntry,flattened"`
+	QueueURL string                           `json:"QueueUrl" query:"QueueUrl"`
+}
+
+// DeleteMessageBatchResultEntry is a message DeleteMessageBatch deleted.
+type DeleteMessageBatchResultEntry struct {
+	ID string `json:"Id" xml:"Id"`
+}
+
+// DeleteMessageBatchResult is the result of DeleteMessageBatch.
+type DeleteMessageBatchResult struct {
+	Failed     []BatchResultErrorEntry         `json:"Failed" xml:"BatchResultErrorEntry"`
+	Successful []DeleteMessageBatchResultEntry `json:"Successful" xml:"DeleteMessageBatchResultEntry"`
+}
+
+// ChangeMessageVisibilityRequest is a request to ChangeMessageVisibility.
+type ChangeMessageVisibilityRequest struct {
+	QueueURL          string `json:"QueueUrl" query:"QueueUrl"`
+	ReceiptHandle     string `json:"ReceiptHandle" query:"ReceiptHandle"`
+	VisibilityTimeout *int   `json:"VisibilityTimeout" query:"VisibilityTimeout"`
+}
+
+// ChangeMessageVisibilityResult is the result of ChangeMessageVisibility.
+type ChangeMessageVisibilityResult struct{}
+
+// ChangeMessageVisibilityBatchRequestEntry is a message whose visibility to
+// change in a ChangeMessageVisibilityBatch request.
+type ChangeMessageVisibilityBatchRequestEntry struct {
+	ID                string `json:"Id" query:"Id"`
+	ReceiptHandle     string `json:"ReceiptHandle" query:"ReceiptHandle"`
+	VisibilityTimeout *int   `json:"VisibilityTimeout" query:"VisibilityTimeout"`
+}
+
+// ChangeMessageVisibilityBatchRequest is a request to
+// ChangeMessageVisibilityBatch.
+type ChangeMessageVisibilityBatchRequest struct {
+	Entries  []ChangeMessageVisibilityBatchRequestEntry `json:"Entries" query:"ChangeMessageVisibilityBatchRequestEntry,flattened"`
+	QueueURL string                                     `json:"QueueUrl" query:"QueueUrl"`
+}
+
+// ChangeMessageVisibilityBatchResultEntry is a message whose visibility
+// ChangeMessageVisibilityBatch changed.
+type ChangeMessageVisibilityBatchResultEntry struct {
+	ID string `json:"Id" xml:"Id"`
+}
+
+// ChangeMessageVisibilityBatchResult is the result of
+// ChangeMessageVisibilityBatch.
+type ChangeMessageVisibilityBatchResult struct {
+	Failed     []BatchResultErrorEntry                   `json:"Failed" xml:"BatchResultErrorEntry"`
+	Successful []ChangeMessageVisibilityBatchResultEntry `json:"Successful" xml:"ChangeMessageVisibilityBatchResultEntry"`
+}
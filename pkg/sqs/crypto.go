@@ -0,0 +1,103 @@
+package sqs
+
+import (
+	"time"
+
+	"github.com/fernomac/aws-local/pkg/common"
+	"github.com/fernomac/aws-local/pkg/envelope"
+)
+
+// dataKey is a data key from KMS. SQS reuses data keys for the queue's
+// KmsDataKeyReusePeriodSeconds rather than calling KMS for every message, so
+// a disabled key only starts failing calls once the cached keys expire.
+type dataKey struct {
+	keyID      string
+	ciphertext string
+	plaintext  []byte
+	expires    time.Time
+}
+
+// sealed is a message body encrypted under a data key.
+type sealed struct {
+	dataKey    string
+	iv         []byte
+	ciphertext []byte
+}
+
+// encryptionContext binds a data key to the queue it protects.
+func encryptionContext(arn string) map[string]string {
+	return map[string]string{"aws:sqs:arn": arn}
+}
+
+// kmsCodes are the errors SQS returns for errors from KMS.
+var kmsCodes = envelope.Table(map[string]string{
+	"AccessDeniedException":      "KmsAccessDenied",
+	"DisabledException":          "KmsDisabled",
+	"InvalidKeyUsageException":   "KmsInvalidKeyUsage",
+	"KMSInvalidStateException":   "KmsInvalidState",
+	"NotFoundException":          "KmsNotFound",
+	"ThrottlingException":        "KmsThrottled",
+	"InvalidCiphertextException": "KmsInvalidState",
+}, "KmsInvalidState")
+
+// seal encrypts a message body under the queue's current data key, getting a
+// new one from KMS if it has expired. The caller must hold s.lock.
+func (s *sqs) seal(q *queue, messageID string, body string) (*sealed, error) {
+	now := s.clock.Now()
+	keyID := q.attrs[attrKmsMasterKeyID]
+	if q.dataKey == nil || q.dataKey.keyID != keyID || !now.Before(q.dataKey.expires) {
+		dk, err := envelope.GenerateDataKey(s.kms, keyID, encryptionContext(q.arn()), kmsCodes)
+		if err != nil {
+			return nil, err
+		}
+		q.dataKey = &dataKey{
+			keyID:      keyID,
+			ciphertext: dk.Ciphertext,
+			plaintext:  dk.Plaintext,
+			expires:    now.Add(q.reusePeriod()),
+		}
+		q.dataKeys[dk.Ciphertext] = q.dataKey
+	}
+
+	iv, ciphertext, err := envelope.Seal(q.dataKey.plaintext, []byte(body), []byte(messageID))
+	if err != nil {
+		return nil, err
+	}
+	return &sealed{dataKey: q.dataKey.ciphertext, iv: iv, ciphertext: ciphertext}, nil
+}
+
+// open decrypts a message body, asking KMS to decrypt its data key unless
+// it was seen within the reuse period. The caller must hold s.lock.
+func (s *sqs) open(q *queue, m *message) (string, error) {
+	if m.sealed == nil {
+		return m.body, nil
+	}
+
+	now := s.clock.Now()
+	for ciphertext, dk := range q.dataKeys {
+		if !now.Before(dk.expires) {
+			delete(q.dataKeys, ciphertext)
+		}
+	}
+
+	dk, ok := q.dataKeys[m.sealed.dataKey]
+	if !ok {
+		out, err := envelope.DecryptDataKey(s.kms, m.sealed.dataKey, encryptionContext(q.arn()), kmsCodes)
+		if err != nil {
+			return "", err
+		}
+		dk = &dataKey{
+			keyID:      out.KeyID,
+			ciphertext: out.Ciphertext,
+			plaintext:  out.Plaintext,
+			expires:    now.Add(q.reusePeriod()),
+		}
+		q.dataKeys[m.sealed.dataKey] = dk
+	}
+
+	body, err := envelope.Open(dk.plaintext, m.sealed.iv, m.sealed.ciphertext, []byte(m.id))
+	if err != nil {
+		return "", common.Errorf("KmsInvalidState", "The message body could not be decrypted.")
+	}
+	return string(body), nil
+}
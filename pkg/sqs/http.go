@@ -0,0 +1,351 @@
+package sqs
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/fernomac/aws-local/pkg/awsjson11"
+	"github.com/fernomac/aws-local/pkg/awsquery"
+	"github.com/fernomac/aws-local/pkg/common"
+)
+
+// Version is the API version SQS query protocol requests carry.
+const Version = "2012-11-05"
+
+// legacyCodes are the error codes the query protocol uses where they differ
+// from the JSON protocol's.
+var legacyCodes = map[string]string{
+	"BatchEntryIdsNotDistinct":     "AWS.SimpleQueueService.BatchEntryIdsNotDistinct",
+	"BatchRequestTooLong":          "AWS.SimpleQueueService.BatchRequestTooLong",
+	"EmptyBatchRequest":            "AWS.SimpleQueueService.EmptyBatchRequest",
+	"InvalidBatchEntryId":          "AWS.SimpleQueueService.InvalidBatchEntryId",
+	"KmsAccessDenied":              "KMS.AccessDeniedException",
+	"KmsDisabled":                  "KMS.DisabledException",
+	"KmsInvalidKeyUsage":           "KMS.InvalidKeyUsageException",
+	"KmsInvalidState":              "KMS.KMSInvalidStateException",
+	"KmsNotFound":                  "KMS.NotFoundException",
+	"KmsThrottled":                 "KMS.ThrottlingException",
+	"MessageNotInflight":           "AWS.SimpleQueueService.MessageNotInflight",
+	"PurgeQueueInProgress":         "AWS.SimpleQueueService.PurgeQueueInProgress",
+	"QueueDeletedRecently":         "AWS.SimpleQueueService.QueueDeletedRecently",
+	"QueueDoesNotExist":            "AWS.SimpleQueueService.NonExistentQueue",
+	"QueueNameExists":              "QueueAlreadyExists",
+	"TooManyEntriesInBatchRequest": "AWS.SimpleQueueService.TooManyEntriesInBatchRequest",
+}
+
+// legacy rewrites an error's code for the query protocol.
+func legacy(out interface{}, err error) (interface{}, error) {
+	if err != nil {
+		if ce, ok := err.(common.Error); ok {
+			if code, ok := legacyCodes[ce.Code]; ok {
+				ce.Code = code
+			}
+			return nil, ce
+		}
+		return nil, err
+	}
+	return out, nil
+}
+
+// NewHandler creates a new HTTP handler, notifying the given observers of
+// every call. Requests with an X-Amz-Target header use the JSON protocol;
+// the rest use the query protocol, and may be sent to the queue's URL rather
+// than naming it in a QueueUrl parameter.
+func NewHandler(sqs SQS, observers ...common.Observer) http.Handler {
+	jsonHandler := newJSONHandler(sqs, observers)
+	queryHandler := newQueryHandler(sqs, observers)
+
+	return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("X-Amz-Target") != "" {
+			jsonHandler.ServeHTTP(resp, req)
+			return
+		}
+
+		if parts := strings.Split(strings.Trim(req.URL.Path, "/"), "/"); len(parts) == 2 {
+			values := req.URL.Query()
+			if values.Get("QueueUrl") == "" {
+				values.Set("QueueUrl", "http://"+req.Host+req.URL.Path)
+				req.URL.RawQuery = values.Encode()
+			}
+		}
+		queryHandler.ServeHTTP(resp, req)
+	})
+}
+
+func newJSONHandler(sqs SQS, observers []common.Observer) http.Handler {
+	rval := awsjson11.NewHandler("AmazonSQS")
+	rval.UseJSON10()
+	rval.SetEventSource("sqs.amazonaws.com")
+	for _, o := range observers {
+		rval.ObserveWith(o)
+	}
+
+	//
+	// Queues.
+	//
+
+	rval.HandleWith("CreateQueue", func(body []byte) (interface{}, error) {
+		req := CreateQueueRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return sqs.CreateQueue(&req)
+	})
+
+	rval.HandleWith("DeleteQueue", func(body []byte) (interface{}, error) {
+		req := DeleteQueueRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return sqs.DeleteQueue(&req)
+	})
+
+	rval.HandleWith("GetQueueUrl", func(body []byte) (interface{}, error) {
+		req := GetQueueURLRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return sqs.GetQueueURL(&req)
+	})
+
+	rval.HandleWith("ListQueues", func(body []byte) (interface{}, error) {
+		req := ListQueuesRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return sqs.ListQueues(&req)
+	})
+
+	rval.HandleWith("GetQueueAttributes", func(body []byte) (interface{}, error) {
+		req := GetQueueAttributesRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return sqs.GetQueueAttributes(&req)
+	})
+
+	rval.HandleWith("SetQueueAttributes", func(body []byte) (interface{}, error) {
+		req := SetQueueAttributesRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return sqs.SetQueueAttributes(&req)
+	})
+
+	rval.HandleWith("PurgeQueue", func(body []byte) (interface{}, error) {
+		req := PurgeQueueRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return sqs.PurgeQueue(&req)
+	})
+
+	rval.HandleWith("ListDeadLetterSourceQueues", func(body []byte) (interface{}, error) {
+		req := ListDeadLetterSourceQueuesRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return sqs.ListDeadLetterSourceQueues(&req)
+	})
+
+	//
+	// Messages.
+	//
+
+	rval.HandleWith("SendMessage", func(body []byte) (interface{}, error) {
+		req := SendMessageRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return sqs.SendMessage(&req)
+	})
+
+	rval.HandleWith("SendMessageBatch", func(body []byte) (interface{}, error) {
+		req := SendMessageBatchRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return sqs.SendMessageBatch(&req)
+	})
+
+	rval.HandleWith("ReceiveMessage", func(body []byte) (interface{}, error) {
+		req := ReceiveMessageRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return sqs.ReceiveMessage(&req)
+	})
+
+	rval.HandleWith("DeleteMessage", func(body []byte) (interface{}, error) {
+		req := DeleteMessageRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return sqs.DeleteMessage(&req)
+	})
+
+	rval.HandleWith("DeleteMessageBatch", func(body []byte) (interface{}, error) {
+		req := DeleteMessageBatchRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return sqs.DeleteMessageBatch(&req)
+	})
+
+	rval.HandleWith("ChangeMessageVisibility", func(body []byte) (interface{}, error) {
+		req := ChangeMessageVisibilityRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return sqs.ChangeMessageVisibility(&req)
+	})
+
+	rval.HandleWith("ChangeMessageVisibilityBatch", func(body []byte) (interface{}, error) {
+		req := ChangeMessageVisibilityBatchRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return sqs.ChangeMessageVisibilityBatch(&req)
+	})
+
+	return rval
+}
+
+func newQueryHandler(sqs SQS, observers []common.Observer) http.Handler {
+	rval := awsquery.NewHandler("http://queue.amazonaws.com/doc/" + Version + "/")
+	rval.SetEventSource("sqs.amazonaws.com")
+	for _, o := range observers {
+		rval.ObserveWith(o)
+	}
+
+	//
+	// Queues.
+	//
+
+	rval.HandleWith("CreateQueue", func(req *awsquery.Request) (interface{}, error) {
+		in := CreateQueueRequest{}
+		if err := req.Decode(&in); err != nil {
+			return nil, err
+		}
+		return legacy(sqs.CreateQueue(&in))
+	})
+
+	rval.HandleWith("DeleteQueue", func(req *awsquery.Request) (interface{}, error) {
+		in := DeleteQueueRequest{}
+		if err := req.Decode(&in); err != nil {
+			return nil, err
+		}
+		return legacy(sqs.DeleteQueue(&in))
+	})
+
+	rval.HandleWith("GetQueueUrl", func(req *awsquery.Request) (interface{}, error) {
+		in := GetQueueURLRequest{}
+		if err := req.Decode(&in); err != nil {
+			return nil, err
+		}
+		return legacy(sqs.GetQueueURL(&in))
+	})
+
+	rval.HandleWith("ListQueues", func(req *awsquery.Request) (interface{}, error) {
+		in := ListQueuesRequest{}
+		if err := req.Decode(&in); err != nil {
+			return nil, err
+		}
+		return legacy(sqs.ListQueues(&in))
+	})
+
+	rval.HandleWith("GetQueueAttributes", func(req *awsquery.Request) (interface{}, error) {
+		in := GetQueueAttributesRequest{}
+		if err := req.Decode(&in); err != nil {
+			return nil, err
+		}
+		return legacy(sqs.GetQueueAttributes(&in))
+	})
+
+	rval.HandleWith("SetQueueAttributes", func(req *awsquery.Request) (interface{}, error) {
+		in := SetQueueAttributesRequest{}
+		if err := req.Decode(&in); err != nil {
+			return nil, err
+		}
+		return legacy(sqs.SetQueueAttributes(&in))
+	})
+
+	rval.HandleWith("PurgeQueue", func(req *awsquery.Request) (interface{}, error) {
+		in := PurgeQueueRequest{}
+		if err := req.Decode(&in); err != nil {
+			return nil, err
+		}
+		return legacy(sqs.PurgeQueue(&in))
+	})
+
+	rval.HandleWith("ListDeadLetterSourceQueues", func(req *awsquery.Request) (interface{}, error) {
+		in := ListDeadLetterSourceQueuesRequest{}
+		if err := req.Decode(&in); err != nil {
+			return nil, err
+		}
+		return legacy(sqs.ListDeadLetterSourceQueues(&in))
+	})
+
+	//
+	// Messages.
+	//
+
+	rval.HandleWith("SendMessage", func(req *awsquery.Request) (interface{}, error) {
+		in := SendMessageRequest{}
+		if err := req.Decode(&in); err != nil {
+			return nil, err
+		}
+		return legacy(sqs.SendMessage(&in))
+	})
+
+	rval.HandleWith("SendMessageBatch", func(req *awsquery.Request) (interface{}, error) {
+		in := SendMessageBatchRequest{}
+		if err := req.Decode(&in); err != nil {
+			return nil, err
+		}
+		return legacy(sqs.SendMessageBatch(&in))
+	})
+
+	rval.HandleWith("ReceiveMessage", func(req *awsquery.Request) (interface{}, error) {
+		in := ReceiveMessageRequest{}
+		if err := req.Decode(&in); err != nil {
+			return nil, err
+		}
+		return legacy(sqs.ReceiveMessage(&in))
+	})
+
+	rval.HandleWith("DeleteMessage", func(req *awsquery.Request) (interface{}, error) {
+		in := DeleteMessageRequest{}
+		if err := req.Decode(&in); err != nil {
+			return nil, err
+		}
+		return legacy(sqs.DeleteMessage(&in))
+	})
+
+	rval.HandleWith("DeleteMessageBatch", func(req *awsquery.Request) (interface{}, error) {
+		in := DeleteMessageBatchRequest{}
+		if err := req.Decode(&in); err != nil {
+			return nil, err
+		}
+		return legacy(sqs.DeleteMessageBatch(&in))
+	})
+
+	rval.HandleWith("ChangeMessageVisibility", func(req *awsquery.Request) (interface{}, error) {
+		in := ChangeMessageVisibilityRequest{}
+		if err := req.Decode(&in); err != nil {
+			return nil, err
+		}
+		return legacy(sqs.ChangeMessageVisibility(&in))
+	})
+
+	rval.HandleWith("ChangeMessageVisibilityBatch", func(req *awsquery.Request) (interface{}, error) {
+		in := ChangeMessageVisibilityBatchRequest{}
+		if err := req.Decode(&in); err != nil {
+			return nil, err
+		}
+		return legacy(sqs.ChangeMessageVisibilityBatch(&in))
+	})
+
+	return rval
+}
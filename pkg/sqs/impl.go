@@ -0,0 +1,1088 @@
+package sqs
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/fernomac/aws-local/pkg/common"
+	"github.com/fernomac/aws-local/pkg/kms"
+)
+
+// Limits and timings.
+const (
+	maxBatchEntries    = 10
+	maxAttributes      = 10
+	maxWaitSeconds     = 20
+	maxVisibility      = 43200
+	maxDelaySeconds    = 900
+	deleteCooldown     = 60 * time.Second
+	purgeCooldown      = 60 * time.Second
+	deduplicationSpan  = 5 * time.Minute
+	longPollInterval   = 50 * time.Millisecond
+	defaultListResults = 1000
+)
+
+var (
+	batchIDPattern       = regexp.MustCompile(`^[A-Za-z0-9_\-]{1,80}$`)
+	attributeNamePattern = regexp.MustCompile(`^[A-Za-z0-9_.\-]{1,256}$`)
+)
+
+// Option configures an SQS object.
+type Option func(*sqs)
+
+// WithClock sets the clock that times visibility timeouts, delays, retention
+// and deduplication. Long polls wait in real time whatever the clock says.
+func WithClock(clock common.Clock) Option {
+	return func(s *sqs) {
+		s.clock = clock
+	}
+}
+
+// WithEndpoint sets the base URL of queue URLs, e.g. "http://localhost:4566".
+// Queues are looked up by the path of their URL, so the host clients use
+// doesn't have to match.
+func WithEndpoint(endpoint string) Option {
+	return func(s *sqs) {
+		s.endpoint = strings.TrimSuffix(endpoint, "/")
+	}
+}
+
+// sqs is the queue store. Its lock guards everything, including calls out to
+// KMS.
+type sqs struct {
+	lock     sync.Mutex
+	kms      kms.KMS
+	clock    common.Clock
+	endpoint string
+	queues   map[string]*queue
+	deleted  map[string]time.Time
+}
+
+// New creates a new queue store that encrypts messages for queues with a
+// KmsMasterKeyId under keys from the given KMS.
+func New(kms kms.KMS, opts ...Option) SQS {
+	rval := &sqs{
+		kms:      kms,
+		clock:    common.SystemClock,
+		endpoint: "http://localhost:4566",
+		queues:   make(map[string]*queue),
+		deleted:  make(map[string]time.Time),
+	}
+	for _, opt := range opts {
+		opt(rval)
+	}
+	return rval
+}
+
+func (s *sqs) queueURL(name string) string {
+	return s.endpoint + "/" + common.AccountID + "/" + name
+}
+
+func noSuchQueue() error {
+	return common.Errorf("QueueDoesNotExist", "The specified queue does not exist.")
+}
+
+func missing(name string) error {
+	return common.Errorf("MissingParameter", "The request must contain the parameter %v.", name)
+}
+
+func invalidParameter(name string, value interface{}, reason string) error {
+	return common.Errorf("InvalidParameterValue", "Value %v for parameter %v is invalid. Reason: %v", value, name, reason)
+}
+
+// queue looks up a queue by its URL, dropping expired messages. The caller
+// must hold s.lock.
+func (s *sqs) queue(queueURL string) (*queue, error) {
+	if queueURL == "" {
+		return nil, missing("QueueUrl")
+	}
+	u, err := url.Parse(queueURL)
+	if err != nil {
+		return nil, noSuchQueue()
+	}
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(parts) != 2 || parts[0] != common.AccountID {
+		return nil, noSuchQueue()
+	}
+	q, ok := s.queues[parts[1]]
+	if !ok {
+		return nil, noSuchQueue()
+	}
+	q.expire(s.clock.Now())
+	return q, nil
+}
+
+// checkRedrive checks that a queue may send messages to the dead-letter queue
+// named in its attributes. The caller must hold s.lock.
+func (s *sqs) checkRedrive(name string, fifo bool, attrs map[string]string) error {
+	value, ok := attrs[attrRedrivePolicy]
+	if !ok || value == "" {
+		return nil
+	}
+	p, _ := parseRedrivePolicy(value)
+
+	target, ok := s.queues[queueName(p.DeadLetterTargetArn)]
+	if !ok {
+		return invalidParameter(attrRedrivePolicy, value, "Dead letter target does not exist.")
+	}
+	if target.fifo != fifo {
+		return invalidParameter(attrRedrivePolicy, value, "Dead-letter queue must be same type of queue as the source.")
+	}
+	if allow, ok := target.attrs[attrRedriveAllowPolicy]; ok {
+		p, err := parseRedriveAllowPolicy(allow)
+		if err == nil && !p.allows(queueArn(name)) {
+			return invalidParameter(attrRedrivePolicy, value, "Dead letter target's redrive allow policy does not permit this source queue.")
+		}
+	}
+	return nil
+}
+
+// page reads a page size and an offset encoded in a token.
+func page(maxResults int, nextToken string, n int) (int, int, string, error) {
+	limit := maxResults
+	if limit == 0 {
+		limit = defaultListResults
+	}
+	if limit < 1 || limit > 1000 {
+		return 0, 0, "", invalidParameter("MaxResults", maxResults, "MaxResults must be between 1 and 1000.")
+	}
+
+	offset := 0
+	if nextToken != "" {
+		raw, err := base64.RawURLEncoding.DecodeString(nextToken)
+		if err == nil {
+			offset, err = strconv.Atoi(string(raw))
+		}
+		if err != nil || offset < 0 {
+			return 0, 0, "", invalidParameter("NextToken", nextToken, "Invalid NextToken value.")
+		}
+	}
+	if offset > n {
+		offset = n
+	}
+	end := offset + limit
+	if end > n {
+		end = n
+	}
+
+	token := ""
+	if maxResults != 0 && end < n {
+		token = base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(end)))
+	}
+	return offset, end, token, nil
+}
+
+//
+// Queues.
+//
+
+func (s *sqs) CreateQueue(req *CreateQueueRequest) (*CreateQueueResult, error) {
+	name := req.QueueName
+	fifo := strings.HasSuffix(name, ".fifo")
+	if !queueNamePattern.MatchString(strings.TrimSuffix(name, ".fifo")) || len(name) > 80 {
+		return nil, invalidParameter("QueueName", name, "Can only include alphanumeric characters, hyphens, or underscores. 1 to 80 in length")
+	}
+	if req.Attributes[attrFifoQueue] == "true" && !fifo {
+		return nil, invalidAttribute(attrFifoQueue, "The name of a FIFO queue can only include alphanumeric characters, hyphens, or underscores, must end with .fifo suffix and be 1 to 80 in length.")
+	}
+	if fifo && req.Attributes[attrFifoQueue] != "true" {
+		return nil, invalidParameter("QueueName", name, "The name of a FIFO queue must end with .fifo, and only FIFO queues may have such names; set FifoQueue to true.")
+	}
+	attrs, err := validateAttributes(req.Attributes, fifo, true)
+	if err != nil {
+		return nil, err
+	}
+	if len(req.Tags) > 50 {
+		return nil, invalidParameter("Tags", len(req.Tags), "A queue can have at most 50 tags.")
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	now := s.clock.Now()
+	if q, ok := s.queues[name]; ok {
+		for attr, value := range attrs {
+			if q.attrs[attr] != value {
+				return nil, common.Errorf("QueueNameExists", "A queue already exists with the same name and a different value for attribute %v", attr)
+			}
+		}
+		return &CreateQueueResult{QueueURL: s.queueURL(name)}, nil
+	}
+	if deleted, ok := s.deleted[name]; ok && now.Sub(deleted) < deleteCooldown {
+		return nil, common.Errorf("QueueDeletedRecently", "You must wait 60 seconds after deleting a queue before you can create another with the same name.")
+	}
+	if err := s.checkRedrive(name, fifo, attrs); err != nil {
+		return nil, err
+	}
+
+	q := newQueue(name, fifo, now)
+	q.apply(attrs, now)
+	for k, v := range req.Tags {
+		q.tags[k] = v
+	}
+	s.queues[name] = q
+	delete(s.deleted, name)
+	return &CreateQueueResult{QueueURL: s.queueURL(name)}, nil
+}
+
+func (s *sqs) DeleteQueue(req *DeleteQueueRequest) (*DeleteQueueResult, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	q, err := s.queue(req.QueueURL)
+	if err != nil {
+		return nil, err
+	}
+	delete(s.queues, q.name)
+	s.deleted[q.name] = s.clock.Now()
+	q.wake()
+	return &DeleteQueueResult{}, nil
+}
+
+func (s *sqs) GetQueueURL(req *GetQueueURLRequest) (*GetQueueURLResult, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if req.QueueName == "" {
+		return nil, missing("QueueName")
+	}
+	if req.QueueOwnerAWSAccountID != "" && req.QueueOwnerAWSAccountID != common.AccountID {
+		return nil, noSuchQueue()
+	}
+	if _, ok := s.queues[req.QueueName]; !ok {
+		return nil, noSuchQueue()
+	}
+	return &GetQueueURLResult{QueueURL: s.queueURL(req.QueueName)}, nil
+}
+
+func (s *sqs) ListQueues(req *ListQueuesRequest) (*ListQueuesResult, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	names := []string{}
+	for name := range s.queues {
+		if strings.HasPrefix(name, req.QueueNamePrefix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	start, end, token, err := page(req.MaxResults, req.NextToken, len(names))
+	if err != nil {
+		return nil, err
+	}
+	out := &ListQueuesResult{NextToken: token}
+	for _, name := range names[start:end] {
+		out.QueueURLs = append(out.QueueURLs, s.queueURL(name))
+	}
+	return out, nil
+}
+
+func (s *sqs) GetQueueAttributes(req *GetQueueAttributesRequest) (*GetQueueAttributesResult, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	q, err := s.queue(req.QueueURL)
+	if err != nil {
+		return nil, err
+	}
+	attrs, err := q.attributes(req.AttributeNames, s.clock.Now())
+	if err != nil {
+		return nil, err
+	}
+	return &GetQueueAttributesResult{Attributes: attrs}, nil
+}
+
+func (s *sqs) SetQueueAttributes(req *SetQueueAttributesRequest) (*SetQueueAttributesResult, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	q, err := s.queue(req.QueueURL)
+	if err != nil {
+		return nil, err
+	}
+	attrs, err := validateAttributes(req.Attributes, q.fifo, false)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkRedrive(q.name, q.fifo, attrs); err != nil {
+		return nil, err
+	}
+	q.apply(attrs, s.clock.Now())
+	return &SetQueueAttributesResult{}, nil
+}
+
+func (s *sqs) PurgeQueue(req *PurgeQueueRequest) (*PurgeQueueResult, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	q, err := s.queue(req.QueueURL)
+	if err != nil {
+		return nil, err
+	}
+	now := s.clock.Now()
+	if !q.purged.IsZero() && now.Sub(q.purged) < purgeCooldown {
+		return nil, common.Errorf("PurgeQueueInProgress", "Only one PurgeQueue operation on %v is allowed every 60 seconds.", q.name)
+	}
+	q.messages = nil
+	q.purged = now
+	return &PurgeQueueResult{}, nil
+}
+
+func (s *sqs) ListDeadLetterSourceQueues(req *ListDeadLetterSourceQueuesRequest) (*ListDeadLetterSourceQueuesResult, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	q, err := s.queue(req.QueueURL)
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for name, source := range s.queues {
+		if p := source.redrivePolicy(); p != nil && p.DeadLetterTargetArn == q.arn() {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	start, end, token, err := page(req.MaxResults, req.NextToken, len(names))
+	if err != nil {
+		return nil, err
+	}
+	out := &ListDeadLetterSourceQueuesResult{QueueURLs: []string{}, NextToken: token}
+	for _, name := range names[start:end] {
+		out.QueueURLs = append(out.QueueURLs, s.queueURL(name))
+	}
+	return out, nil
+}
+
+//
+// Messages.
+//
+
+// md5Hex returns the hex MD5 of some data, as SQS checksums bodies.
+func md5Hex(data []byte) string {
+	sum := md5.Sum(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// md5OfAttributes is the checksum SQS gives for message attributes: the MD5
+// of each attribute's length-prefixed name, type and value, in name order.
+// SDKs check it, so it must be exactly right.
+func md5OfAttributes(attrs MessageAttributes) string {
+	if len(attrs) == 0 {
+		return ""
+	}
+	names := []string{}
+	for name := range attrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	h := md5.New()
+	write := func(b []byte) {
+		n := make([]byte, 4)
+		binary.BigEndian.PutUint32(n, uint32(len(b)))
+		h.Write(n)
+		h.Write(b)
+	}
+	for _, name := range names {
+		v := attrs[name]
+		write([]byte(name))
+		write([]byte(v.DataType))
+		if strings.HasPrefix(v.DataType, "Binary") {
+			h.Write([]byte{2})
+			write(v.BinaryValue)
+		} else {
+			h.Write([]byte{1})
+			write([]byte(v.StringValue))
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// validBody reports the first character SQS doesn't allow in a message body,
+// if any.
+func validBody(body string) (rune, bool) {
+	for i, r := range body {
+		if r == utf8.RuneError {
+			if _, size := utf8.DecodeRuneInString(body[i:]); size == 1 {
+				return r, false
+			}
+		}
+		switch {
+		case r == 0x9 || r == 0xA || r == 0xD:
+		case r >= 0x20 && r <= 0xD7FF:
+		case r >= 0xE000 && r <= 0xFFFD:
+		case r >= 0x10000 && r <= 0x10FFFF:
+		default:
+			return r, false
+		}
+	}
+	return 0, true
+}
+
+// validateMessageAttributes checks message attributes, returning their size.
+func validateMessageAttributes(attrs MessageAttributes, system bool) (int, error) {
+	kind := "user"
+	if system {
+		kind = "system"
+	}
+	if len(attrs) > maxAttributes {
+		return 0, invalidParameter("MessageAttributes", len(attrs), fmt.Sprintf("Number of message attributes [%v] exceeds the allowed maximum [%v].", len(attrs), maxAttributes))
+	}
+
+	size := 0
+	for name, v := range attrs {
+		if system {
+			if name != "AWSTraceHeader" || v.DataType != "String" {
+				return 0, invalidParameter("MessageSystemAttributes", name, "Only the AWSTraceHeader system attribute, of type String, may be set.")
+			}
+		} else {
+			lower := strings.ToLower(name)
+			if !attributeNamePattern.MatchString(name) || strings.HasPrefix(lower, "aws.") || strings.HasPrefix(lower, "amazon.") ||
+				strings.HasPrefix(name, ".") || strings.HasSuffix(name, ".") || strings.Contains(name, "..") {
+				return 0, invalidParameter("MessageAttributes", name, "Message attribute name is invalid.")
+			}
+		}
+
+		base := strings.SplitN(v.DataType, ".", 2)[0]
+		if len(v.DataType) > 256 || base != "String" && base != "Number" && base != "Binary" {
+			return 0, invalidParameter("MessageAttributes", v.DataType, fmt.Sprintf("The message (%v) attribute '%v' has an invalid message attribute type, the set of supported type prefixes is Binary, Number, and String.", kind, name))
+		}
+		if len(v.StringListValues) > 0 || len(v.BinaryListValues) > 0 {
+			return 0, invalidParameter("MessageAttributes", name, "StringListValues and BinaryListValues are not supported.")
+		}
+		switch base {
+		case "Binary":
+			if len(v.BinaryValue) == 0 || v.StringValue != "" {
+				return 0, invalidParameter("MessageAttributes", name, fmt.Sprintf("Message (%v) attribute '%v' must contain a non-empty value of type 'Binary'.", kind, name))
+			}
+			size += len(v.BinaryValue)
+		default:
+			if v.StringValue == "" || v.BinaryValue != nil {
+				return 0, invalidParameter("MessageAttributes", name, fmt.Sprintf("Message (%v) attribute '%v' must contain a non-empty value of type '%v'.", kind, name, base))
+			}
+			if base == "Number" {
+				if _, err := strconv.ParseFloat(v.StringValue, 64); err != nil {
+					return 0, invalidParameter("MessageAttributes", name, fmt.Sprintf("Can't cast the value of message (%v) attribute '%v' to a number.", kind, name))
+				}
+			}
+			if _, ok := validBody(v.StringValue); !ok {
+				return 0, common.Errorf("InvalidMessageContents", "Message (%v) attribute '%v' contains invalid characters.", kind, name)
+			}
+			size += len(v.StringValue)
+		}
+		size += len(name) + len(v.DataType)
+	}
+	return size, nil
+}
+
+// messageSize is the size a message counts for against the queue's
+// MaximumMessageSize.
+func messageSize(entry *SendMessageBatchRequestEntry) (int, error) {
+	size, err := validateMessageAttributes(entry.MessageAttributes, false)
+	if err != nil {
+		return 0, err
+	}
+	return size + len(entry.MessageBody), nil
+}
+
+// send validates and enqueues a message, or returns the one it duplicates.
+// The caller must hold s.lock.
+func (s *sqs) send(q *queue, entry *SendMessageBatchRequestEntry) (*SendMessageBatchResultEntry, error) {
+	if entry.MessageBody == "" {
+		return nil, missing("MessageBody")
+	}
+	if r, ok := validBody(entry.MessageBody); !ok {
+		return nil, common.Errorf("InvalidMessageContents", "Invalid binary character '#x%X' was found in the message body, the set of allowed characters is #x9 | #xA | #xD | #x20 to #xD7FF | #xE000 to #xFFFD | #x10000 to #x10FFFF", r)
+	}
+	size, err := messageSize(entry)
+	if err != nil {
+		return nil, err
+	}
+	if max := q.int(attrMaximumMessageSize); size > max {
+		return nil, invalidParameter("MessageBody", "", fmt.Sprintf("Message must be shorter than %v bytes.", max))
+	}
+	if _, err := validateMessageAttributes(entry.MessageSystemAttributes, true); err != nil {
+		return nil, err
+	}
+
+	delay := q.seconds(attrDelaySeconds)
+	if entry.DelaySeconds != nil {
+		if q.fifo {
+			return nil, invalidParameter("DelaySeconds", *entry.DelaySeconds, "The request include parameter that is not valid for this queue type.")
+		}
+		if *entry.DelaySeconds < 0 || *entry.DelaySeconds > maxDelaySeconds {
+			return nil, invalidParameter("DelaySeconds", *entry.DelaySeconds, "DelaySeconds must be >= 0 and <= 900.")
+		}
+		delay = time.Duration(*entry.DelaySeconds) * time.Second
+	}
+
+	for _, id := range []struct{ name, value string }{{"MessageGroupId", entry.MessageGroupID}, {"MessageDeduplicationId", entry.MessageDeduplicationID}} {
+		if id.value == "" {
+			continue
+		}
+		ok := len(id.value) <= 128
+		for _, r := range id.value {
+			ok = ok && r >= 33 && r <= 126
+		}
+		if !ok {
+			return nil, invalidParameter(id.name, id.value, id.name+" can only include alphanumeric and punctuation characters. 1 to 128 in length.")
+		}
+	}
+
+	now := s.clock.Now()
+	id := common.NewRequestID()
+	out := &SendMessageBatchResultEntry{
+		ID:                           entry.ID,
+		MD5OfMessageAttributes:       md5OfAttributes(entry.MessageAttributes),
+		MD5OfMessageBody:             md5Hex([]byte(entry.MessageBody)),
+		MD5OfMessageSystemAttributes: md5OfAttributes(entry.MessageSystemAttributes),
+		MessageID:                    id,
+	}
+
+	m := &message{
+		id:        id,
+		body:      entry.MessageBody,
+		md5Body:   out.MD5OfMessageBody,
+		attrs:     entry.MessageAttributes,
+		md5Attrs:  out.MD5OfMessageAttributes,
+		system:    entry.MessageSystemAttributes,
+		md5System: out.MD5OfMessageSystemAttributes,
+		groupID:   entry.MessageGroupID,
+		sent:      now,
+		visible:   now.Add(delay),
+	}
+
+	if q.fifo {
+		if entry.MessageGroupID == "" {
+			return nil, missing("MessageGroupId")
+		}
+		dedupID := entry.MessageDeduplicationID
+		if dedupID == "" {
+			if q.attrs[attrContentBasedDeduplication] != "true" {
+				return nil, invalidParameter("MessageDeduplicationId", "", "The queue should either have ContentBasedDeduplication enabled or MessageDeduplicationId provided explicitly")
+			}
+			sum := sha256.Sum256([]byte(entry.MessageBody))
+			dedupID = hex.EncodeToString(sum[:])
+		}
+		key := dedupID
+		if q.attrs[attrDeduplicationScope] == "messageGroup" {
+			key = entry.MessageGroupID + "/" + dedupID
+		}
+		if d, ok := q.dedups[key]; ok {
+			out.MessageID, out.SequenceNumber = d.messageID, d.seq
+			return out, nil
+		}
+
+		q.seq++
+		m.dedupID = dedupID
+		m.seq = fmt.Sprintf("%020d", q.seq)
+		out.SequenceNumber = m.seq
+		q.dedups[key] = dedup{messageID: id, seq: m.seq, expires: now.Add(deduplicationSpan)}
+	} else if entry.MessageDeduplicationID != "" {
+		return nil, invalidParameter("MessageDeduplicationId", entry.MessageDeduplicationID, "The request include parameter that is not valid for this queue type.")
+	}
+
+	if q.encrypted() {
+		sealed, err := s.seal(q, id, entry.MessageBody)
+		if err != nil {
+			return nil, err
+		}
+		m.body, m.sealed = "", sealed
+	}
+
+	q.messages = append(q.messages, m)
+	q.wake()
+	return out, nil
+}
+
+func (s *sqs) SendMessage(req *SendMessageRequest) (*SendMessageResult, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	q, err := s.queue(req.QueueURL)
+	if err != nil {
+		return nil, err
+	}
+	out, err := s.send(q, &SendMessageBatchRequestEntry{
+		DelaySeconds:            req.DelaySeconds,
+		MessageAttributes:       req.MessageAttributes,
+		MessageBody:             req.MessageBody,
+		MessageDeduplicationID:  req.MessageDeduplicationID,
+		MessageGroupID:          req.MessageGroupID,
+		MessageSystemAttributes: req.MessageSystemAttributes,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &SendMessageResult{
+		MD5OfMessageAttributes:       out.MD5OfMessageAttributes,
+		MD5OfMessageBody:             out.MD5OfMessageBody,
+		MD5OfMessageSystemAttributes: out.MD5OfMessageSystemAttributes,
+		MessageID:                    out.MessageID,
+		SequenceNumber:               out.SequenceNumber,
+	}, nil
+}
+
+// checkBatch checks the IDs of a batch's entries.
+func checkBatch(ids []string, entryName string) error {
+	if len(ids) == 0 {
+		return common.Errorf("EmptyBatchRequest", "There should be at least one %v in the request.", entryName)
+	}
+	if len(ids) > maxBatchEntries {
+		return common.Errorf("TooManyEntriesInBatchRequest", "Maximum number of entries per request are %v. You have sent %v.", maxBatchEntries, len(ids))
+	}
+	seen := map[string]bool{}
+	for _, id := range ids {
+		if !batchIDPattern.MatchString(id) {
+			return common.Errorf("InvalidBatchEntryId", "A batch entry id can only contain alphanumeric characters, hyphens and underscores. It can be at most 80 letters long.")
+		}
+		if seen[id] {
+			return common.Errorf("BatchEntryIdsNotDistinct", "Id %v repeated.", id)
+		}
+		seen[id] = true
+	}
+	return nil
+}
+
+// batchError turns an error into a failed batch entry.
+func batchError(id string, err error) BatchResultErrorEntry {
+	out := BatchResultErrorEntry{ID: id, SenderFault: true}
+	if ce, ok := err.(common.Error); ok {
+		out.Code, out.Message = ce.Code, ce.Message
+	} else {
+		out.Code, out.Message, out.SenderFault = "InternalError", err.Error(), false
+	}
+	return out
+}
+
+func (s *sqs) SendMessageBatch(req *SendMessageBatchRequest) (*SendMessageBatchResult, error) {
+	ids := []string{}
+	for _, e := range req.Entries {
+		ids = append(ids, e.ID)
+	}
+	if err := checkBatch(ids, "SendMessageBatchRequestEntry"); err != nil {
+		return nil, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	q, err := s.queue(req.QueueURL)
+	if err != nil {
+		return nil, err
+	}
+	total := 0
+	for i := range req.Entries {
+		if size, err := messageSize(&req.Entries[i]); err == nil {
+			total += size
+		}
+	}
+	if max := q.int(attrMaximumMessageSize); total > max {
+		return nil, common.Errorf("BatchRequestTooLong", "Batch requests cannot be longer than %v bytes. You have sent %v bytes.", max, total)
+	}
+
+	out := &SendMessageBatchResult{
+		Failed:     []BatchResultErrorEntry{},
+		Successful: []SendMessageBatchResultEntry{},
+	}
+	for i := range req.Entries {
+		entry, err := s.send(q, &req.Entries[i])
+		if err != nil {
+			out.Failed = append(out.Failed, batchError(req.Entries[i].ID, err))
+			continue
+		}
+		out.Successful = append(out.Successful, *entry)
+	}
+	return out, nil
+}
+
+// deadLetter moves a message that has been received too many times to its
+// queue's dead-letter queue, reporting whether it did. Bodies are decrypted
+// and sealed again for the dead-letter queue. The caller must hold s.lock.
+func (s *sqs) deadLetter(q *queue, i int) bool {
+	p := q.redrivePolicy()
+	m := q.messages[i]
+	if p == nil || m.receipts < p.MaxReceiveCount {
+		return false
+	}
+	target, ok := s.queues[queueName(p.DeadLetterTargetArn)]
+	if !ok || target == q {
+		return false
+	}
+
+	body, err := s.open(q, m)
+	if err != nil {
+		return false
+	}
+	moved := *m
+	moved.body, moved.sealed = body, nil
+	if target.encrypted() {
+		sealed, err := s.seal(target, m.id, body)
+		if err != nil {
+			return false
+		}
+		moved.body, moved.sealed = "", sealed
+	}
+	now := s.clock.Now()
+	moved.visible, moved.receipts, moved.firstReceipt, moved.receipt = now, 0, time.Time{}, ""
+	if target.fifo {
+		target.seq++
+		moved.seq = fmt.Sprintf("%020d", target.seq)
+		moved.sent = now
+	}
+
+	q.remove(i)
+	target.messages = append(target.messages, &moved)
+	target.wake()
+	return true
+}
+
+// receiptHandle makes a new receipt handle for a message.
+func receiptHandle(m *message) string {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(m.id + "/" + hex.EncodeToString(nonce)))
+}
+
+// messageID returns the ID of the message a receipt handle is for.
+func messageID(handle string) (string, error) {
+	invalid := common.Errorf("ReceiptHandleIsInvalid", "The input receipt handle \"%v\" is not a valid receipt handle.", handle)
+	if handle == "" {
+		return "", missing("ReceiptHandle")
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(handle)
+	if err != nil {
+		return "", invalid
+	}
+	parts := strings.Split(string(raw), "/")
+	if len(parts) != 2 {
+		return "", invalid
+	}
+	return parts[0], nil
+}
+
+// receive takes up to max messages from a queue, moving any received too
+// often to the dead-letter queue. A FIFO queue only gives out messages from
+// a group with none in flight, in order. The caller must hold s.lock.
+func (s *sqs) receive(q *queue, max int, visibility time.Duration) ([]*message, []string, error) {
+	now := s.clock.Now()
+	taken := []*message{}
+	blocked := map[string]bool{}
+	for i := 0; i < len(q.messages) && len(taken) < max; {
+		m := q.messages[i]
+		if q.fifo && blocked[m.groupID] {
+			i++
+			continue
+		}
+		if m.visible.After(now) {
+			blocked[m.groupID] = true
+			i++
+			continue
+		}
+		if s.deadLetter(q, i) {
+			continue
+		}
+		taken = append(taken, m)
+		i++
+	}
+
+	// Decrypt everything before changing anything, so that a KMS failure
+	// leaves the messages where they were.
+	bodies := []string{}
+	for _, m := range taken {
+		body, err := s.open(q, m)
+		if err != nil {
+			return nil, nil, err
+		}
+		bodies = append(bodies, body)
+	}
+
+	for _, m := range taken {
+		m.receipts++
+		if m.firstReceipt.IsZero() {
+			m.firstReceipt = now
+		}
+		m.receipt = receiptHandle(m)
+		m.visible = now.Add(visibility)
+	}
+	return taken, bodies, nil
+}
+
+// wanted reports whether a name is selected by a list that may contain All,
+// .* or prefixes such as "foo.*".
+func wanted(names []string, name string) bool {
+	for _, n := range names {
+		switch {
+		case n == "All" || n == ".*" || n == name:
+			return true
+		case strings.HasSuffix(n, ".*") && strings.HasPrefix(name, strings.TrimSuffix(n, "*")):
+			return true
+		}
+	}
+	return false
+}
+
+// systemAttributes returns the system attributes of a message asked for.
+func systemAttributes(q *queue, m *message, names []string) Attributes {
+	all := Attributes{
+		"SenderId":                         common.AccountID,
+		"SentTimestamp":                    strconv.FormatInt(m.sent.UnixNano()/int64(time.Millisecond), 10),
+		"ApproximateReceiveCount":          strconv.Itoa(m.receipts),
+		"ApproximateFirstReceiveTimestamp": strconv.FormatInt(m.firstReceipt.UnixNano()/int64(time.Millisecond), 10),
+	}
+	if v, ok := m.system["AWSTraceHeader"]; ok {
+		all["AWSTraceHeader"] = v.StringValue
+	}
+	if m.groupID != "" {
+		all["MessageGroupId"] = m.groupID
+	}
+	if q.fifo {
+		all["MessageDeduplicationId"] = m.dedupID
+		all["SequenceNumber"] = m.seq
+	}
+
+	out := Attributes{}
+	for name, value := range all {
+		if wanted(names, name) {
+			out[name] = value
+		}
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
+
+// ReceiveMessage receives messages, long polling for up to WaitTimeSeconds
+// if there are none.
+func (s *sqs) ReceiveMessage(req *ReceiveMessageRequest) (*ReceiveMessageResult, error) {
+	max := req.MaxNumberOfMessages
+	if max == 0 {
+		max = 1
+	}
+	if max < 1 || max > maxBatchEntries {
+		return nil, invalidParameter("MaxNumberOfMessages", max, "must be between 1 and 10, if provided.")
+	}
+	if req.VisibilityTimeout != nil && (*req.VisibilityTimeout < 0 || *req.VisibilityTimeout > maxVisibility) {
+		return nil, invalidParameter("VisibilityTimeout", *req.VisibilityTimeout, "Must be between 0 and 43200, if provided.")
+	}
+	if req.WaitTimeSeconds != nil && (*req.WaitTimeSeconds < 0 || *req.WaitTimeSeconds > maxWaitSeconds) {
+		return nil, invalidParameter("WaitTimeSeconds", *req.WaitTimeSeconds, "Must be >= 0 and <= 20, if provided.")
+	}
+
+	var deadline time.Time
+	for {
+		s.lock.Lock()
+		q, err := s.queue(req.QueueURL)
+		if err != nil {
+			s.lock.Unlock()
+			return nil, err
+		}
+
+		if deadline.IsZero() {
+			wait := q.seconds(attrReceiveMessageWaitTimeSeconds)
+			if req.WaitTimeSeconds != nil {
+				wait = time.Duration(*req.WaitTimeSeconds) * time.Second
+			}
+			deadline = time.Now().Add(wait)
+		}
+		visibility := q.seconds(attrVisibilityTimeout)
+		if req.VisibilityTimeout != nil {
+			visibility = time.Duration(*req.VisibilityTimeout) * time.Second
+		}
+
+		taken, bodies, err := s.receive(q, max, visibility)
+		if err != nil {
+			s.lock.Unlock()
+			return nil, err
+		}
+		if len(taken) > 0 || !time.Now().Before(deadline) {
+			out := &ReceiveMessageResult{}
+			names := append(append([]string{}, req.AttributeNames...), req.MessageSystemAttributeNames...)
+			for i, m := range taken {
+				msg := Message{
+					Attributes:    systemAttributes(q, m, names),
+					Body:          bodies[i],
+					MD5OfBody:     m.md5Body,
+					MessageID:     m.id,
+					ReceiptHandle: m.receipt,
+				}
+				for name, value := range m.attrs {
+					if wanted(req.MessageAttributeNames, name) {
+						if msg.MessageAttributes == nil {
+							msg.MessageAttributes = MessageAttributes{}
+						}
+						msg.MessageAttributes[name] = value
+					}
+				}
+				msg.MD5OfMessageAttributes = md5OfAttributes(msg.MessageAttributes)
+				out.Messages = append(out.Messages, msg)
+			}
+			s.lock.Unlock()
+			return out, nil
+		}
+
+		notify := q.notify
+		s.lock.Unlock()
+
+		wait := time.Until(deadline)
+		if wait > longPollInterval {
+			wait = longPollInterval
+		}
+		select {
+		case <-notify:
+		case <-time.After(wait):
+		}
+	}
+}
+
+// deleteMessage deletes a message by receipt handle. Standard queues delete
+// the message even if the handle is out of date, as SQS usually does; FIFO
+// queues insist on the latest. The caller must hold s.lock.
+func (s *sqs) deleteMessage(q *queue, handle string) error {
+	id, err := messageID(handle)
+	if err != nil {
+		return err
+	}
+	i := q.find(id)
+	if i < 0 {
+		return nil
+	}
+	if q.fifo && q.messages[i].receipt != handle {
+		return common.Errorf("ReceiptHandleIsInvalid", "The receipt handle has expired.")
+	}
+	q.remove(i)
+	q.wake()
+	return nil
+}
+
+func (s *sqs) DeleteMessage(req *DeleteMessageRequest) (*DeleteMessageResult, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	q, err := s.queue(req.QueueURL)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.deleteMessage(q, req.ReceiptHandle); err != nil {
+		return nil, err
+	}
+	return &DeleteMessageResult{}, nil
+}
+
+func (s *sqs) DeleteMessageBatch(req *DeleteMessageBatchRequest) (*DeleteMessageBatchResult, error) {
+	ids := []string{}
+	for _, e := range req.Entries {
+		ids = append(ids, e.ID)
+	}
+	if err := checkBatch(ids, "DeleteMessageBatchRequestEntry"); err != nil {
+		return nil, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	q, err := s.queue(req.QueueURL)
+	if err != nil {
+		return nil, err
+	}
+	out := &DeleteMessageBatchResult{
+		Failed:     []BatchResultErrorEntry{},
+		Successful: []DeleteMessageBatchResultEntry{},
+	}
+	for _, e := range req.Entries {
+		if err := s.deleteMessage(q, e.ReceiptHandle); err != nil {
+			out.Failed = append(out.Failed, batchError(e.ID, err))
+			continue
+		}
+		out.Successful = append(out.Successful, DeleteMessageBatchResultEntry{ID: e.ID})
+	}
+	return out, nil
+}
+
+// changeVisibility changes the visibility timeout of a message in flight.
+// The caller must hold s.lock.
+func (s *sqs) changeVisibility(q *queue, handle string, timeout *int) error {
+	if timeout == nil {
+		return missing("VisibilityTimeout")
+	}
+	if *timeout < 0 || *timeout > maxVisibility {
+		return invalidParameter("VisibilityTimeout", *timeout, "VisibilityTimeout must be an integer between 0 and 43200")
+	}
+	id, err := messageID(handle)
+	if err != nil {
+		return err
+	}
+
+	now := s.clock.Now()
+	i := q.find(id)
+	if i < 0 || q.messages[i].receipt != handle || !q.messages[i].inFlight(now) {
+		return common.Errorf("MessageNotInflight", "Message does not exist or is not available for visibility timeout change.")
+	}
+	q.messages[i].visible = now.Add(time.Duration(*timeout) * time.Second)
+	q.wake()
+	return nil
+}
+
+func (s *sqs) ChangeMessageVisibility(req *ChangeMessageVisibilityRequest) (*ChangeMessageVisibilityResult, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	q, err := s.queue(req.QueueURL)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.changeVisibility(q, req.ReceiptHandle, req.VisibilityTimeout); err != nil {
+		return nil, err
+	}
+	return &ChangeMessageVisibilityResult{}, nil
+}
+
+func (s *sqs) ChangeMessageVisibilityBatch(req *ChangeMessageVisibilityBatchRequest) (*ChangeMessageVisibilityBatchResult, error) {
+	ids := []string{}
+	for _, e := range req.Entries {
+		ids = append(ids, e.ID)
+	}
+	if err := checkBatch(ids, "ChangeMessageVisibilityBatchRequestEntry"); err != nil {
+		return nil, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	q, err := s.queue(req.QueueURL)
+	if err != nil {
+		return nil, err
+	}
+	out := &ChangeMessageVisibilityBatchResult{
+		Failed:     []BatchResultErrorEntry{},
+		Successful: []ChangeMessageVisibilityBatchResultEntry{},
+	}
+	for _, e := range req.Entries {
+		if err := s.changeVisibility(q, e.ReceiptHandle, e.VisibilityTimeout); err != nil {
+			out.Failed = append(out.Failed, batchError(e.ID, err))
+			continue
+		}
+		out.Successful = append(out.Successful, ChangeMessageVisibilityBatchResultEntry{ID: e.ID})
+	}
+	return out, nil
+}
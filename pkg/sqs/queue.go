@@ -0,0 +1,497 @@
+package sqs
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fernomac/aws-local/pkg/common"
+)
+
+// Queue attribute names.
+const (
+	attrDelaySeconds                  = "DelaySeconds"
+	attrMaximumMessageSize            = "MaximumMessageSize"
+	attrMessageRetentionPeriod        = "MessageRetentionPeriod"
+	attrReceiveMessageWaitTimeSeconds = "ReceiveMessageWaitTimeSeconds"
+	attrVisibilityTimeout             = "VisibilityTimeout"
+	attrPolicy                        = "Policy"
+	attrRedrivePolicy                 = "RedrivePolicy"
+	attrRedriveAllowPolicy            = "RedriveAllowPolicy"
+	attrKmsMasterKeyID                = "KmsMasterKeyId"
+	attrKmsDataKeyReusePeriodSeconds  = "KmsDataKeyReusePeriodSeconds"
+	attrSqsManagedSseEnabled          = "SqsManagedSseEnabled"
+	attrFifoQueue                     = "FifoQueue"
+	attrContentBasedDeduplication     = "ContentBasedDeduplication"
+	attrDeduplicationScope            = "DeduplicationScope"
+	attrFifoThroughputLimit           = "FifoThroughputLimit"
+
+	attrQueueArn                              = "QueueArn"
+	attrApproximateNumberOfMessages           = "ApproximateNumberOfMessages"
+	attrApproximateNumberOfMessagesNotVisible = "ApproximateNumberOfMessagesNotVisible"
+	attrApproximateNumberOfMessagesDelayed    = "ApproximateNumberOfMessagesDelayed"
+	attrCreatedTimestamp                      = "CreatedTimestamp"
+	attrLastModifiedTimestamp                 = "LastModifiedTimestamp"
+)
+
+// intRanges are the bounds of the numeric queue attributes.
+var intRanges = map[string][2]int{
+	attrDelaySeconds:                  {0, 900},
+	attrMaximumMessageSize:            {1024, 262144},
+	attrMessageRetentionPeriod:        {60, 1209600},
+	attrReceiveMessageWaitTimeSeconds: {0, 20},
+	attrVisibilityTimeout:             {0, 43200},
+	attrKmsDataKeyReusePeriodSeconds:  {60, 86400},
+}
+
+// fifoAttributes may only be set on FIFO queues.
+var fifoAttributes = map[string][]string{
+	attrContentBasedDeduplication: {"true", "false"},
+	attrDeduplicationScope:        {"messageGroup", "queue"},
+	attrFifoThroughputLimit:       {"perQueue", "perMessageGroupId"},
+}
+
+// computedAttributes are read-only attributes worked out on demand.
+var computedAttributes = []string{
+	attrQueueArn,
+	attrApproximateNumberOfMessages,
+	attrApproximateNumberOfMessagesNotVisible,
+	attrApproximateNumberOfMessagesDelayed,
+	attrCreatedTimestamp,
+	attrLastModifiedTimestamp,
+}
+
+var queueNamePattern = regexp.MustCompile(`^[A-Za-z0-9_\-]{1,80}$`)
+
+func queueArn(name string) string {
+	return fmt.Sprintf("arn:aws:sqs:%v:%v:%v", common.Region, common.AccountID, name)
+}
+
+// queueName returns the name of the queue an ARN is for, or "" if it isn't
+// a queue ARN in this account.
+func queueName(arn string) string {
+	prefix := queueArn("")
+	if !strings.HasPrefix(arn, prefix) {
+		return ""
+	}
+	return arn[len(prefix):]
+}
+
+func invalidAttribute(name string, reason string) error {
+	if reason == "" {
+		return common.Errorf("InvalidAttributeValue", "Invalid value for the parameter %v.", name)
+	}
+	return common.Errorf("InvalidAttributeValue", "Invalid value for the parameter %v. Reason: %v", name, reason)
+}
+
+// redrivePolicy is a queue's RedrivePolicy: where messages go once they have
+// been received too many times.
+type redrivePolicy struct {
+	DeadLetterTargetArn string `json:"deadLetterTargetArn"`
+	MaxReceiveCount     int    `json:"maxReceiveCount"`
+}
+
+// parseRedrivePolicy reads a RedrivePolicy, whose maxReceiveCount may be a
+// number or a string.
+func parseRedrivePolicy(value string) (*redrivePolicy, error) {
+	raw := struct {
+		DeadLetterTargetArn string      `json:"deadLetterTargetArn"`
+		MaxReceiveCount     json.Number `json:"maxReceiveCount"`
+	}{}
+	if err := json.Unmarshal([]byte(value), &raw); err != nil {
+		return nil, invalidAttribute(attrRedrivePolicy, "Redrive policy is not a valid JSON map.")
+	}
+	if raw.DeadLetterTargetArn == "" {
+		return nil, invalidAttribute(attrRedrivePolicy, "Redrive policy does not contain mandatory attribute: deadLetterTargetArn.")
+	}
+	count, err := strconv.Atoi(raw.MaxReceiveCount.String())
+	if err != nil || count < 1 || count > 1000 {
+		return nil, invalidAttribute(attrRedrivePolicy, "Invalid value for maxReceiveCount: "+raw.MaxReceiveCount.String()+", valid values are from 1 to 1000 both inclusive.")
+	}
+	return &redrivePolicy{DeadLetterTargetArn: raw.DeadLetterTargetArn, MaxReceiveCount: count}, nil
+}
+
+// redriveAllowPolicy is a queue's RedriveAllowPolicy: which queues may use it
+// as their dead-letter queue.
+type redriveAllowPolicy struct {
+	RedrivePermission string   `json:"redrivePermission"`
+	SourceQueueArns   []string `json:"sourceQueueArns,omitempty"`
+}
+
+func parseRedriveAllowPolicy(value string) (*redriveAllowPolicy, error) {
+	p := &redriveAllowPolicy{}
+	if err := json.Unmarshal([]byte(value), p); err != nil {
+		return nil, invalidAttribute(attrRedriveAllowPolicy, "Redrive allow policy is not a valid JSON map.")
+	}
+	switch p.RedrivePermission {
+	case "allowAll", "denyAll":
+		if len(p.SourceQueueArns) > 0 {
+			return nil, invalidAttribute(attrRedriveAllowPolicy, "sourceQueueArns can only be given when redrivePermission is byQueue.")
+		}
+	case "byQueue":
+		if len(p.SourceQueueArns) < 1 || len(p.SourceQueueArns) > 10 {
+			return nil, invalidAttribute(attrRedriveAllowPolicy, "sourceQueueArns must list between 1 and 10 queues when redrivePermission is byQueue.")
+		}
+	default:
+		return nil, invalidAttribute(attrRedriveAllowPolicy, "redrivePermission must be allowAll, denyAll or byQueue.")
+	}
+	return p, nil
+}
+
+// allows reports whether the policy lets the given queue use this one as its
+// dead-letter queue.
+func (p *redriveAllowPolicy) allows(source string) bool {
+	switch p.RedrivePermission {
+	case "denyAll":
+		return false
+	case "byQueue":
+		for _, arn := range p.SourceQueueArns {
+			if arn == source {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// message is a message in a queue. It is in flight while it has a receipt
+// handle and is not yet visible again.
+type message struct {
+	id           string
+	body         string
+	sealed       *sealed
+	md5Body      string
+	attrs        MessageAttributes
+	md5Attrs     string
+	system       MessageAttributes
+	md5System    string
+	groupID      string
+	dedupID      string
+	seq          string
+	sent         time.Time
+	visible      time.Time
+	receipts     int
+	firstReceipt time.Time
+	receipt      string
+}
+
+func (m *message) inFlight(now time.Time) bool {
+	return m.receipt != "" && m.visible.After(now)
+}
+
+// dedup is a FIFO message's deduplication ID, remembered for five minutes.
+type dedup struct {
+	messageID string
+	seq       string
+	expires   time.Time
+}
+
+// queue is a single queue. Its attrs hold every settable attribute that has
+// a value, defaults included.
+type queue struct {
+	name     string
+	fifo     bool
+	attrs    map[string]string
+	tags     map[string]string
+	created  time.Time
+	modified time.Time
+	messages []*message
+	dedups   map[string]dedup
+	seq      uint64
+	purged   time.Time
+	dataKey  *dataKey
+	dataKeys map[string]*dataKey
+	// notify is closed, and replaced, whenever messages may have become
+	// available, waking long polls.
+	notify chan struct{}
+}
+
+func newQueue(name string, fifo bool, now time.Time) *queue {
+	q := &queue{
+		name: name,
+		fifo: fifo,
+		attrs: map[string]string{
+			attrDelaySeconds:                  "0",
+			attrMaximumMessageSize:            "262144",
+			attrMessageRetentionPeriod:        "345600",
+			attrReceiveMessageWaitTimeSeconds: "0",
+			attrVisibilityTimeout:             "30",
+			attrSqsManagedSseEnabled:          "true",
+		},
+		tags:     map[string]string{},
+		created:  now,
+		modified: now,
+		dedups:   make(map[string]dedup),
+		dataKeys: make(map[string]*dataKey),
+		notify:   make(chan struct{}),
+	}
+	if fifo {
+		q.attrs[attrFifoQueue] = "true"
+		q.attrs[attrContentBasedDeduplication] = "false"
+		q.attrs[attrDeduplicationScope] = "queue"
+		q.attrs[attrFifoThroughputLimit] = "perQueue"
+	}
+	return q
+}
+
+func (q *queue) arn() string {
+	return queueArn(q.name)
+}
+
+func (q *queue) int(name string) int {
+	n, _ := strconv.Atoi(q.attrs[name])
+	return n
+}
+
+func (q *queue) seconds(name string) time.Duration {
+	return time.Duration(q.int(name)) * time.Second
+}
+
+// reusePeriod is how long data keys are reused, 300 seconds by default.
+func (q *queue) reusePeriod() time.Duration {
+	if _, ok := q.attrs[attrKmsDataKeyReusePeriodSeconds]; !ok {
+		return 300 * time.Second
+	}
+	return q.seconds(attrKmsDataKeyReusePeriodSeconds)
+}
+
+func (q *queue) encrypted() bool {
+	return q.attrs[attrKmsMasterKeyID] != ""
+}
+
+func (q *queue) redrivePolicy() *redrivePolicy {
+	value, ok := q.attrs[attrRedrivePolicy]
+	if !ok {
+		return nil
+	}
+	p, err := parseRedrivePolicy(value)
+	if err != nil {
+		return nil
+	}
+	return p
+}
+
+// wake wakes any long polls waiting on the queue.
+func (q *queue) wake() {
+	close(q.notify)
+	q.notify = make(chan struct{})
+}
+
+// expire drops messages past the retention period and forgets deduplication
+// IDs past the deduplication window.
+func (q *queue) expire(now time.Time) {
+	cutoff := now.Add(-q.seconds(attrMessageRetentionPeriod))
+	kept := q.messages[:0]
+	for _, m := range q.messages {
+		if m.sent.After(cutoff) {
+			kept = append(kept, m)
+		}
+	}
+	for i := len(kept); i < len(q.messages); i++ {
+		q.messages[i] = nil
+	}
+	q.messages = kept
+
+	for id, d := range q.dedups {
+		if !now.Before(d.expires) {
+			delete(q.dedups, id)
+		}
+	}
+}
+
+// find returns the index of the message with the given ID, or -1.
+func (q *queue) find(id string) int {
+	for i, m := range q.messages {
+		if m.id == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func (q *queue) remove(i int) {
+	copy(q.messages[i:], q.messages[i+1:])
+	q.messages[len(q.messages)-1] = nil
+	q.messages = q.messages[:len(q.messages)-1]
+}
+
+// attributes returns the named attributes, or all of them for "All".
+func (q *queue) attributes(names []string, now time.Time) (Attributes, error) {
+	all := Attributes{}
+	for name, value := range q.attrs {
+		all[name] = value
+	}
+	if q.encrypted() {
+		all[attrKmsDataKeyReusePeriodSeconds] = strconv.Itoa(int(q.reusePeriod() / time.Second))
+	} else {
+		delete(all, attrKmsDataKeyReusePeriodSeconds)
+	}
+
+	visible, inFlight, delayed := 0, 0, 0
+	for _, m := range q.messages {
+		switch {
+		case m.inFlight(now):
+			inFlight++
+		case m.visible.After(now):
+			delayed++
+		default:
+			visible++
+		}
+	}
+	all[attrQueueArn] = q.arn()
+	all[attrApproximateNumberOfMessages] = strconv.Itoa(visible)
+	all[attrApproximateNumberOfMessagesNotVisible] = strconv.Itoa(inFlight)
+	all[attrApproximateNumberOfMessagesDelayed] = strconv.Itoa(delayed)
+	all[attrCreatedTimestamp] = strconv.FormatInt(q.created.Unix(), 10)
+	all[attrLastModifiedTimestamp] = strconv.FormatInt(q.modified.Unix(), 10)
+
+	out := Attributes{}
+	for _, name := range names {
+		if name == "All" {
+			return all, nil
+		}
+		if !knownAttribute(name) {
+			return nil, common.Errorf("InvalidAttributeName", "Unknown Attribute %v.", name)
+		}
+		if value, ok := all[name]; ok {
+			out[name] = value
+		}
+	}
+	return out, nil
+}
+
+func knownAttribute(name string) bool {
+	if _, ok := intRanges[name]; ok {
+		return true
+	}
+	if _, ok := fifoAttributes[name]; ok {
+		return true
+	}
+	for _, computed := range computedAttributes {
+		if name == computed {
+			return true
+		}
+	}
+	switch name {
+	case attrPolicy, attrRedrivePolicy, attrRedriveAllowPolicy, attrKmsMasterKeyID, attrSqsManagedSseEnabled, attrFifoQueue:
+		return true
+	}
+	return false
+}
+
+// validateAttributes checks attributes being set on a queue, returning them
+// in the form the queue keeps them. Dead-letter targets are checked by the
+// caller, which can see the other queues.
+func validateAttributes(attrs Attributes, fifo bool, creating bool) (map[string]string, error) {
+	out := map[string]string{}
+	for name, value := range attrs {
+		if r, ok := intRanges[name]; ok {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < r[0] || n > r[1] {
+				return nil, invalidAttribute(name, "")
+			}
+			out[name] = strconv.Itoa(n)
+			continue
+		}
+		if allowed, ok := fifoAttributes[name]; ok {
+			if !fifo {
+				return nil, common.Errorf("InvalidAttributeName", "Unknown Attribute %v.", name)
+			}
+			found := false
+			for _, a := range allowed {
+				found = found || value == a
+			}
+			if !found {
+				return nil, invalidAttribute(name, "")
+			}
+			out[name] = value
+			continue
+		}
+
+		switch name {
+		case attrFifoQueue:
+			if !creating {
+				return nil, invalidAttribute(name, "Modifying queue type is not supported.")
+			}
+			if value != strconv.FormatBool(fifo) {
+				return nil, invalidAttribute(name, "The name of a FIFO queue can only include alphanumeric characters, hyphens, or underscores, must end with .fifo suffix and be 1 to 80 in length.")
+			}
+			if fifo {
+				out[name] = value
+			}
+
+		case attrSqsManagedSseEnabled:
+			if value != "true" && value != "false" {
+				return nil, invalidAttribute(name, "")
+			}
+			out[name] = value
+
+		case attrPolicy:
+			if value != "" && !json.Valid([]byte(value)) {
+				return nil, invalidAttribute(name, "Policy is not a valid JSON document.")
+			}
+			out[name] = value
+
+		case attrRedrivePolicy:
+			if value == "" {
+				out[name] = ""
+				continue
+			}
+			p, err := parseRedrivePolicy(value)
+			if err != nil {
+				return nil, err
+			}
+			normal, _ := json.Marshal(p)
+			out[name] = string(normal)
+
+		case attrRedriveAllowPolicy:
+			if value == "" {
+				out[name] = ""
+				continue
+			}
+			p, err := parseRedriveAllowPolicy(value)
+			if err != nil {
+				return nil, err
+			}
+			normal, _ := json.Marshal(p)
+			out[name] = string(normal)
+
+		case attrKmsMasterKeyID:
+			out[name] = value
+
+		default:
+			return nil, common.Errorf("InvalidAttributeName", "Unknown Attribute %v.", name)
+		}
+	}
+
+	if out[attrKmsMasterKeyID] != "" && out[attrSqsManagedSseEnabled] == "true" {
+		return nil, invalidAttribute(attrSqsManagedSseEnabled, "You can use one type of server-side encryption (SSE) at one time. You can either enable KMS SSE or SQS SSE.")
+	}
+	return out, nil
+}
+
+// apply sets validated attributes on a queue. Empty values unset optional
+// attributes, and KMS and SQS managed encryption turn each other off.
+func (q *queue) apply(attrs map[string]string, now time.Time) {
+	for name, value := range attrs {
+		if value == "" {
+			delete(q.attrs, name)
+			continue
+		}
+		q.attrs[name] = value
+	}
+
+	if _, ok := attrs[attrKmsMasterKeyID]; ok {
+		if q.encrypted() {
+			q.attrs[attrSqsManagedSseEnabled] = "false"
+		}
+	}
+	if attrs[attrSqsManagedSseEnabled] == "true" {
+		delete(q.attrs, attrKmsMasterKeyID)
+	}
+	q.modified = now
+}
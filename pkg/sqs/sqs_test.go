@@ -0,0 +1,235 @@
+package sqs_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fernomac/aws-local/pkg/common"
+	"github.com/fernomac/aws-local/pkg/kms"
+	"github.com/fernomac/aws-local/pkg/sqs"
+)
+
+// testClock is a clock the tests move by hand.
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	return c.now
+}
+
+func newTestSQS() (sqs.SQS, kms.KMS, *testClock) {
+	clock := &testClock{now: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)}
+	k := kms.New()
+	return sqs.New(k, sqs.WithClock(clock)), k, clock
+}
+
+func intPtr(i int) *int {
+	return &i
+}
+
+func code(err error) string {
+	if ce, ok := err.(common.Error); ok {
+		return ce.Code
+	}
+	if err != nil {
+		return err.Error()
+	}
+	return ""
+}
+
+func createQueue(t *testing.T, s sqs.SQS, name string, attrs sqs.Attributes) (string, string) {
+	out, err := s.CreateQueue(&sqs.CreateQueueRequest{QueueName: name, Attributes: attrs})
+	if err != nil {
+		t.Fatalf("%v: %v", name, err)
+	}
+	arn, err := s.GetQueueAttributes(&sqs.GetQueueAttributesRequest{QueueURL: out.QueueURL, AttributeNames: []string{"QueueArn"}})
+	if err != nil {
+		t.Fatalf("%v: %v", name, err)
+	}
+	return out.QueueURL, arn.Attributes["QueueArn"]
+}
+
+func receive(t *testing.T, s sqs.SQS, queueURL string, visibility *int) []sqs.Message {
+	out, err := s.ReceiveMessage(&sqs.ReceiveMessageRequest{
+		QueueURL:            queueURL,
+		MaxNumberOfMessages: 10,
+		VisibilityTimeout:   visibility,
+		WaitTimeSeconds:     intPtr(0),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out.Messages
+}
+
+func TestVisibilityTimeout(t *testing.T) {
+	tests := []struct {
+		name       string
+		visibility *int
+		change     *int
+		advance    time.Duration
+		want       int
+	}{
+		{"hidden within timeout", nil, nil, 29 * time.Second, 0},
+		{"visible after timeout", nil, nil, 30 * time.Second, 1},
+		{"request timeout", intPtr(5), nil, 5 * time.Second, 1},
+		{"zero request timeout", intPtr(0), nil, 0, 1},
+		{"extended", nil, intPtr(60), 30 * time.Second, 0},
+		{"extended then expired", nil, intPtr(60), 60 * time.Second, 1},
+		{"released", nil, intPtr(0), 0, 1},
+	}
+
+	for _, test := range tests {
+		s, _, clock := newTestSQS()
+		queueURL, _ := createQueue(t, s, "q", sqs.Attributes{"VisibilityTimeout": "30"})
+		if _, err := s.SendMessage(&sqs.SendMessageRequest{QueueURL: queueURL, MessageBody: "hello"}); err != nil {
+			t.Fatal(err)
+		}
+
+		first := receive(t, s, queueURL, test.visibility)
+		if len(first) != 1 {
+			t.Fatalf("%v: first receive got %v messages", test.name, len(first))
+		}
+		if test.change != nil {
+			if _, err := s.ChangeMessageVisibility(&sqs.ChangeMessageVisibilityRequest{
+				QueueURL:          queueURL,
+				ReceiptHandle:     first[0].ReceiptHandle,
+				VisibilityTimeout: test.change,
+			}); err != nil {
+				t.Fatalf("%v: %v", test.name, err)
+			}
+		}
+
+		clock.now = clock.now.Add(test.advance)
+		if got := receive(t, s, queueURL, nil); len(got) != test.want {
+			t.Errorf("%v: got %v messages, want %v", test.name, len(got), test.want)
+		}
+	}
+}
+
+func TestRedrive(t *testing.T) {
+	tests := []struct {
+		name      string
+		maxCount  string
+		encrypted bool
+		receives  int
+		want      int
+		moved     bool
+	}{
+		{"under limit", "1", false, 1, 1, false},
+		{"over limit", "1", false, 2, 1, true},
+		{"at limit", "3", false, 3, 3, false},
+		{"well over limit", "3", false, 5, 3, true},
+		{"encrypted", "1", true, 2, 1, true},
+	}
+
+	for _, test := range tests {
+		s, k, _ := newTestSQS()
+		attrs := sqs.Attributes{}
+		if test.encrypted {
+			key, err := k.CreateKey(&kms.CreateKeyRequest{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			attrs["KmsMasterKeyId"] = key.KeyMetadata.KeyID
+		}
+		dlqURL, dlqArn := createQueue(t, s, "dlq", attrs)
+		attrs["RedrivePolicy"] = `{"deadLetterTargetArn":"` + dlqArn + `","maxReceiveCount":"` + test.maxCount + `"}`
+		queueURL, _ := createQueue(t, s, "q", attrs)
+		if _, err := s.SendMessage(&sqs.SendMessageRequest{QueueURL: queueURL, MessageBody: "hello"}); err != nil {
+			t.Fatal(err)
+		}
+
+		got := 0
+		for i := 0; i < test.receives; i++ {
+			got += len(receive(t, s, queueURL, intPtr(0)))
+		}
+		if got != test.want {
+			t.Errorf("%v: received %v times, want %v", test.name, got, test.want)
+		}
+
+		dead := receive(t, s, dlqURL, nil)
+		if moved := len(dead) == 1; moved != test.moved {
+			t.Errorf("%v: moved is %v", test.name, moved)
+		}
+		if test.moved && len(dead) == 1 && dead[0].Body != "hello" {
+			t.Errorf("%v: dead letter body %q", test.name, dead[0].Body)
+		}
+	}
+}
+
+func TestFIFODeduplication(t *testing.T) {
+	type send struct {
+		group, dedupID, body string
+	}
+	tests := []struct {
+		name      string
+		attrs     sqs.Attributes
+		first     send
+		second    send
+		advance   time.Duration
+		duplicate bool
+		code      string
+	}{
+		{"same id", nil, send{"g", "a", "x"}, send{"g", "a", "y"}, 0, true, ""},
+		{"different id", nil, send{"g", "a", "x"}, send{"g", "b", "x"}, 0, false, ""},
+		{"same id in window", nil, send{"g", "a", "x"}, send{"g", "a", "x"}, 5*time.Minute - time.Second, true, ""},
+		{"same id after window", nil, send{"g", "a", "x"}, send{"g", "a", "x"}, 5 * time.Minute, false, ""},
+		{"queue scope", nil, send{"g", "a", "x"}, send{"h", "a", "x"}, 0, true, ""},
+		{"group scope", sqs.Attributes{"DeduplicationScope": "messageGroup", "FifoThroughputLimit": "perMessageGroupId"}, send{"g", "a", "x"}, send{"h", "a", "x"}, 0, false, ""},
+		{"group scope same group", sqs.Attributes{"DeduplicationScope": "messageGroup", "FifoThroughputLimit": "perMessageGroupId"}, send{"g", "a", "x"}, send{"g", "a", "y"}, 0, true, ""},
+		{"content based same body", sqs.Attributes{"ContentBasedDeduplication": "true"}, send{"g", "", "x"}, send{"g", "", "x"}, 0, true, ""},
+		{"content based different body", sqs.Attributes{"ContentBasedDeduplication": "true"}, send{"g", "", "x"}, send{"g", "", "y"}, 0, false, ""},
+		{"explicit id beats content", sqs.Attributes{"ContentBasedDeduplication": "true"}, send{"g", "a", "x"}, send{"g", "b", "x"}, 0, false, ""},
+		{"no id", nil, send{"g", "a", "x"}, send{"g", "", "x"}, 0, false, "InvalidParameterValue"},
+		{"no group", nil, send{"g", "a", "x"}, send{"", "b", "x"}, 0, false, "MissingParameter"},
+	}
+
+	for _, test := range tests {
+		s, _, clock := newTestSQS()
+		attrs := sqs.Attributes{"FifoQueue": "true"}
+		for name, value := range test.attrs {
+			attrs[name] = value
+		}
+		queueURL, _ := createQueue(t, s, "q.fifo", attrs)
+
+		first, err := s.SendMessage(&sqs.SendMessageRequest{
+			QueueURL:               queueURL,
+			MessageGroupID:         test.first.group,
+			MessageDeduplicationID: test.first.dedupID,
+			MessageBody:            test.first.body,
+		})
+		if err != nil {
+			t.Fatalf("%v: %v", test.name, err)
+		}
+		clock.now = clock.now.Add(test.advance)
+		second, err := s.SendMessage(&sqs.SendMessageRequest{
+			QueueURL:               queueURL,
+			MessageGroupID:         test.second.group,
+			MessageDeduplicationID: test.second.dedupID,
+			MessageBody:            test.second.body,
+		})
+		if got := code(err); got != test.code {
+			t.Errorf("%v: got %v, want %v", test.name, got, test.code)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+
+		if duplicate := second.MessageID == first.MessageID; duplicate != test.duplicate {
+			t.Errorf("%v: duplicate is %v", test.name, duplicate)
+		}
+		if duplicate := second.SequenceNumber == first.SequenceNumber; duplicate != test.duplicate {
+			t.Errorf("%v: sequence number duplicate is %v", test.name, duplicate)
+		}
+		want := 2
+		if test.duplicate {
+			want = 1
+		}
+		if got := receive(t, s, queueURL, nil); len(got) != want {
+			t.Errorf("%v: got %v messages, want %v", test.name, len(got), want)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package ssm
+
+// SSM is the service interface for AWS Systems Manager Parameter Store.
+type SSM interface {
+	PutParameter(*PutParameterRequest) (*PutParameterResult, error)
+	GetParameter(*GetParameterRequest) (*GetParameterResult, error)
+	GetParameters(*GetParametersRequest) (*GetParametersResult, error)
+	GetParametersByPath(*GetParametersByPathRequest) (*GetParametersByPathResult, error)
+	DeleteParameter(*DeleteParameterRequest) (*DeleteParameterResult, error)
+	DeleteParameters(*DeleteParametersRequest) (*DeleteParametersResult, error)
+
+	GetParameterHistory(*GetParameterHistoryRequest) (*GetParameterHistoryResult, error)
+	LabelParameterVersion(*LabelParameterVersionRequest) (*LabelParameterVersionResult, error)
+	UnlabelParameterVersion(*UnlabelParameterVersionRequest) (*UnlabelParameterVersionResult, error)
+}
+
+// Parameter types.
+const (
+	TypeString       = "String"
+	TypeStringList   = "StringList"
+	TypeSecureString = "SecureString"
+)
+
+// Parameter tiers.
+const (
+	TierStandard           = "Standard"
+	TierAdvanced           = "Advanced"
+	TierIntelligentTiering = "Intelligent-Tiering"
+)
+
+// Tag is a tag key/value pair.
+type Tag struct {
+	Key   string `json:"Key"`
+	Value string `json:"Value"`
+}
+
+// Parameter is a parameter's value.
+type Parameter struct {
+	ARN              string `json:"ARN"`
+	DataType         string `json:"DataType"`
+	LastModifiedDate int64  `json:"LastModifiedDate"`
+	Name             string `json:"Name"`
+	Selector         string `json:"Selector,omitempty"`
+	Type             string `json:"Type"`
+	Value            string `json:"Value"`
+	Version          int64  `json:"Version"`
+}
+
+// ParameterStringFilter is a filter on GetParametersByPath. Key is one of
+// Type, KeyId or Label; Option is Equals.
+type ParameterStringFilter struct {
+	Key    string   `json:"Key"`
+	Option string   `json:"Option"`
+	Values []string `json:"Values"`
+}
+
+//
+// API shapes for parameters.
+//
+
+// PutParameterRequest is a request to PutParameter.
+type PutParameterRequest struct {
+	AllowedPattern string `json:"AllowedPattern"`
+	DataType       string `json:"DataType"`
+	Description    string `json:"Description"`
+	KeyID          string `json:"KeyId"`
+	Name           string `json:"Name"`
+	Overwrite      bool   `json:"Overwrite"`
+	Tags           []Tag  `json:"Tags"`
+	Tier           string `json:"Tier"`
+	Type           string `json:"Type"`
+	Value          string `json:"Value"`
+}
+
+// PutParameterResult is the result of PutParameter.
+type PutParameterResult struct {
+	Tier    string `json:"Tier"`
+	Version int64  `json:"Version"`
+}
+
+// GetParameterRequest is a request to GetParameter. The name may end in a
+// selector, :version or :label.
+type GetParameterRequest struct {
+	Name           string `json:"Name"`
+	WithDecryption bool   `json:"WithDecryption"`
+}
+
+// GetParameterResult is the result of GetParameter.
+type GetParameterResult struct {
+	Parameter *Parameter `json:"Parameter"`
+}
+
+// GetParametersRequest is a request to GetParameters.
+type GetParametersRequest struct {
+	Names          []string `json:"Names"`
+	WithDecryption bool     `json:"WithDecryption"`
+}
+
+// GetParametersResult is the result of GetParameters.
+type GetParametersResult struct {
+	InvalidParameters []string    `json:"InvalidParameters"`
+	Parameters        []Parameter `json:"Parameters"`
+}
+
+// GetParametersByPathRequest is a request to GetParametersByPath.
+type GetParametersByPathRequest struct {
+	MaxResults       int                     `json:"MaxResults"`
+	NextToken        string                  `json:"NextToken"`
+	ParameterFilters []ParameterStringFilter `json:"ParameterFilters"`
+	Path             string                  `json:"Path"`
+	Recursive        bool                    `json:"Recursive"`
+	WithDecryption   bool                    `json:"WithDecryption"`
+}
+
+// GetParametersByPathResult is the result of GetParametersByPath.
+type GetParametersByPathResult struct {
+	NextToken  string      `json:"NextToken,omitempty"`
+	Parameters []Parameter `json:"Parameters"`
+}
+
+// DeleteParameterRequest is a request to DeleteParameter.
+type DeleteParameterRequest struct {
+	Name string `json:"Name"`
+}
+
+// DeleteParameterResult is the result of DeleteParameter.
+type DeleteParameterResult struct{}
+
+// DeleteParametersRequest is a request to DeleteParameters.
+type DeleteParametersRequest struct {
+	Names []string `json:"Names"`
+}
+
+// DeleteParametersResult is the result of DeleteParameters.
+type DeleteParametersResult struct {
+	DeletedParameters []string `json:"DeletedParameters"`
+	InvalidParameters []string `json:"InvalidParameters"`
+}
+
+//
+// API shapes for versions.
+//
+
+// GetParameterHistoryRequest is a request to GetParameterHistory.
+type GetParameterHistoryRequest struct {
+	MaxResults     int    `json:"MaxResults"`
+	Name           string `json:"Name"`
+	NextToken      string `json:"NextToken"`
+	WithDecryption bool   `json:"WithDecryption"`
+}
+
+// ParameterHistory is a single version of a parameter.
+type ParameterHistory struct {
+	AllowedPattern   string   `json:"AllowedPattern,omitempty"`
+	DataType         string   `json:"DataType"`
+	Description      string   `json:"Description,omitempty"`
+	KeyID            string   `json:"KeyId,omitempty"`
+	Labels           []string `json:"Labels"`
+	LastModifiedDate int64    `json:"LastModifiedDate"`
+	LastModifiedUser string   `json:"LastModifiedUser"`
+	Name             string   `json:"Name"`
+	Tier             string   `json:"Tier"`
+	Type             string   `json:"Type"`
+	Value            string   `json:"Value"`
+	Version          int64    `json:"Version"`
+}
+
+// GetParameterHistoryResult is the result of GetParameterHistory.
+type GetParameterHistoryResult struct {
+	NextToken  string             `json:"NextToken,omitempty"`
+	Parameters []ParameterHistory `json:"Parameters"`
+}
+
+// LabelParameterVersionRequest is a request to LabelParameterVersion. It
+// labels the latest version unless one is given.
+type LabelParameterVersionRequest struct {
+	Labels           []string `json:"Labels"`
+	Name             string   `json:"Name"`
+	ParameterVersion int64    `json:"ParameterVersion"`
+}
+
+// LabelParameterVersionResult is the result of LabelParameterVersion.
+type LabelParameterVersionResult struct {
+	InvalidLabels    []string `json:"InvalidLabels"`
+	ParameterVersion int64    `json:"ParameterVersion"`
+}
+
+// UnlabelParameterVersionRequest is a request to UnlabelParameterVersion.
+type UnlabelParameterVersionRequest struct {
+	Labels           []string `json:"Labels"`
+	Name             string   `json:"Name"`
+	ParameterVersion int64    `json:"ParameterVersion"`
+}
+
+// UnlabelParameterVersionResult is the result of UnlabelParameterVersion.
+type UnlabelParameterVersionResult struct {
+	InvalidLabels []string `json:"InvalidLabels"`
+	RemovedLabels []string `json:"RemovedLabels"`
+}
@@ -0,0 +1,63 @@
+package ssm
+
+import (
+	"encoding/base64"
+
+	"github.com/fernomac/aws-local/pkg/envelope"
+	"github.com/fernomac/aws-local/pkg/kms"
+)
+
+// defaultKeyID is the key SecureString parameters are encrypted with if none
+// is given.
+const defaultKeyID = "alias/aws/ssm"
+
+// encryptionContext binds a SecureString value to its parameter, as Parameter
+// Store does.
+func encryptionContext(arn string) map[string]string {
+	return map[string]string{"PARAMETER_ARN": arn}
+}
+
+// kmsCodes are the errors Parameter Store returns for errors from KMS.
+// Problems with the key itself come back as InvalidKeyId; anything else is
+// passed on as is.
+var kmsCodes = envelope.Table(map[string]string{
+	"NotFoundException":        "InvalidKeyId",
+	"InvalidArnException":      "InvalidKeyId",
+	"DisabledException":        "InvalidKeyId",
+	"KMSInvalidStateException": "InvalidKeyId",
+}, "")
+
+// encrypt encrypts a SecureString value, returning the ciphertext as Parameter
+// Store reports it without decryption, and the ARN of the key used.
+func (s *ssm) encrypt(keyID string, arn string, value string) (string, string, error) {
+	if keyID == "" {
+		keyID = defaultKeyID
+	}
+
+	out, err := s.kms.Encrypt(&kms.EncryptRequest{
+		KeyID:             keyID,
+		Plaintext:         base64.StdEncoding.EncodeToString([]byte(value)),
+		EncryptionContext: encryptionContext(arn),
+	})
+	if err != nil {
+		return "", "", kmsCodes.Error(err)
+	}
+	return out.CiphertextBlob, out.KeyID, nil
+}
+
+// decrypt decrypts a SecureString value.
+func (s *ssm) decrypt(arn string, ciphertext string) (string, error) {
+	out, err := s.kms.Decrypt(&kms.DecryptRequest{
+		CiphertextBlob:    ciphertext,
+		EncryptionContext: encryptionContext(arn),
+	})
+	if err != nil {
+		return "", kmsCodes.Error(err)
+	}
+
+	value, err := base64.StdEncoding.DecodeString(out.Plaintext)
+	if err != nil {
+		return "", err
+	}
+	return string(value), nil
+}
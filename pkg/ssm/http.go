@@ -0,0 +1,101 @@
+package ssm
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/fernomac/aws-local/pkg/awsjson11"
+	"github.com/fernomac/aws-local/pkg/common"
+)
+
+// NewHandler creates a new HTTP handler, notifying the given observers of
+// every call.
+func NewHandler(ssm SSM, observers ...common.Observer) http.Handler {
+	rval := awsjson11.NewHandler("AmazonSSM")
+	rval.SetEventSource("ssm.amazonaws.com")
+	for _, o := range observers {
+		rval.ObserveWith(o)
+	}
+
+	//
+	// Parameters.
+	//
+
+	rval.HandleWith("PutParameter", func(body []byte) (interface{}, error) {
+		req := PutParameterRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return ssm.PutParameter(&req)
+	})
+
+	rval.HandleWith("GetParameter", func(body []byte) (interface{}, error) {
+		req := GetParameterRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return ssm.GetParameter(&req)
+	})
+
+	rval.HandleWith("GetParameters", func(body []byte) (interface{}, error) {
+		req := GetParametersRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return ssm.GetParameters(&req)
+	})
+
+	rval.HandleWith("GetParametersByPath", func(body []byte) (interface{}, error) {
+		req := GetParametersByPathRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return ssm.GetParametersByPath(&req)
+	})
+
+	rval.HandleWith("DeleteParameter", func(body []byte) (interface{}, error) {
+		req := DeleteParameterRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return ssm.DeleteParameter(&req)
+	})
+
+	rval.HandleWith("DeleteParameters", func(body []byte) (interface{}, error) {
+		req := DeleteParametersRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return ssm.DeleteParameters(&req)
+	})
+
+	//
+	// Versions.
+	//
+
+	rval.HandleWith("GetParameterHistory", func(body []byte) (interface{}, error) {
+		req := GetParameterHistoryRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return ssm.GetParameterHistory(&req)
+	})
+
+	rval.HandleWith("LabelParameterVersion", func(body []byte) (interface{}, error) {
+		req := LabelParameterVersionRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return ssm.LabelParameterVersion(&req)
+	})
+
+	rval.HandleWith("UnlabelParameterVersion", func(body []byte) (interface{}, error) {
+		req := UnlabelParameterVersionRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return ssm.UnlabelParameterVersion(&req)
+	})
+
+	return rval
+}
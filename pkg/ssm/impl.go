@@ -0,0 +1,752 @@
+package ssm
+
+import (
+	"encoding/base64"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fernomac/aws-local/pkg/common"
+	"github.com/fernomac/aws-local/pkg/kms"
+)
+
+// maxVersions is how many versions a parameter keeps. Once it has that many,
+// putting a new one drops the oldest, unless it's labeled.
+const maxVersions = 100
+
+// maxHierarchyLevels is how deep parameter names may nest.
+const maxHierarchyLevels = 15
+
+// Value size limits, by tier.
+const (
+	maxStandardValue = 4096
+	maxAdvancedValue = 8192
+)
+
+// maxLabels is how many labels a single version may have.
+const maxLabels = 10
+
+// lastModifiedUser is who every change is recorded as being made by, since
+// callers aren't authenticated.
+var lastModifiedUser = "arn:aws:iam::" + common.AccountID + ":root"
+
+var (
+	namePattern  = regexp.MustCompile(`^[a-zA-Z0-9_.\-/]+$`)
+	labelPattern = regexp.MustCompile(`^[a-zA-Z0-9_.\-]{1,100}$`)
+)
+
+// version is a single version of a parameter.
+type version struct {
+	number         int64
+	typ            string
+	dataType       string
+	description    string
+	allowedPattern string
+	keyID          string
+	tier           string
+	// value is the parameter value, or for SecureString parameters the
+	// ciphertext from KMS.
+	value    string
+	modified time.Time
+	labels   map[string]bool
+}
+
+func (v *version) labelList() []string {
+	out := []string{}
+	for label := range v.labels {
+		out = append(out, label)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// parameter is a single parameter.
+type parameter struct {
+	name     string
+	arn      string
+	tags     []Tag
+	versions []*version
+}
+
+// latest returns the latest version of the parameter.
+func (p *parameter) latest() *version {
+	return p.versions[len(p.versions)-1]
+}
+
+// version returns the version with the given number, or nil.
+func (p *parameter) version(number int64) *version {
+	for _, v := range p.versions {
+		if v.number == number {
+			return v
+		}
+	}
+	return nil
+}
+
+// labeled returns the version with the given label, or nil.
+func (p *parameter) labeled(label string) *version {
+	for _, v := range p.versions {
+		if v.labels[label] {
+			return v
+		}
+	}
+	return nil
+}
+
+// selected returns the version a selector, :version or :label, picks out.
+func (p *parameter) selected(selector string) (*version, error) {
+	if selector == "" {
+		return p.latest(), nil
+	}
+
+	var v *version
+	if number, err := strconv.ParseInt(selector[1:], 10, 64); err == nil {
+		v = p.version(number)
+	} else {
+		v = p.labeled(selector[1:])
+	}
+	if v == nil {
+		return nil, common.Errorf("ParameterVersionNotFound", "Systems Manager could not find version %v of %v.", selector[1:], p.name)
+	}
+	return v, nil
+}
+
+// ssm is the Parameter Store. Its lock guards everything, including calls out
+// to KMS.
+type ssm struct {
+	lock   sync.Mutex
+	kms    kms.KMS
+	params map[string]*parameter
+}
+
+// New creates a new Parameter Store that encrypts SecureString parameters
+// with keys from the given KMS.
+func New(kms kms.KMS) SSM {
+	return &ssm{
+		kms:    kms,
+		params: make(map[string]*parameter),
+	}
+}
+
+// parameterArn returns the ARN of the named parameter. Names in a hierarchy
+// already start with a slash.
+func parameterArn(name string) string {
+	if !strings.HasPrefix(name, "/") {
+		name = "/" + name
+	}
+	return fmt.Sprintf("arn:aws:ssm:%v:%v:parameter%v", common.Region, common.AccountID, name)
+}
+
+// reserved reports whether a name or label uses a prefix AWS keeps for
+// itself.
+func reserved(name string) bool {
+	lower := strings.ToLower(strings.TrimPrefix(name, "/"))
+	return strings.HasPrefix(lower, "aws") || strings.HasPrefix(lower, "ssm")
+}
+
+// validName checks a parameter name.
+func validName(name string) error {
+	if name == "" || len(name) > 2048 || !namePattern.MatchString(name) {
+		return common.Errorf("ValidationException", "Parameter name: can't be prefixed with \"aws\" or \"ssm\" (case-insensitive). It must use only letters, numbers, or the following symbols: . (period), - (hyphen), _ (underscore).")
+	}
+	if reserved(name) {
+		return common.Errorf("ValidationException", "No access to reserved parameter name: %v.", name)
+	}
+	if strings.Contains(name, "/") && !strings.HasPrefix(name, "/") {
+		return common.Errorf("ValidationException", "Parameter name must be a fully qualified name.")
+	}
+	if strings.Count(name, "/") > maxHierarchyLevels {
+		return common.Errorf("HierarchyLevelLimitExceededException", "A hierarchy can have a maximum of %v levels.", maxHierarchyLevels)
+	}
+	return nil
+}
+
+// trimArn turns a parameter ARN into a name.
+func trimArn(id string) string {
+	return strings.TrimPrefix(id, fmt.Sprintf("arn:aws:ssm:%v:%v:parameter", common.Region, common.AccountID))
+}
+
+// splitSelector splits a parameter name or ARN into a name and a :version or
+// :label selector.
+func splitSelector(id string) (string, string) {
+	id = trimArn(id)
+	if i := strings.LastIndex(id, ":"); i >= 0 {
+		return id[:i], id[i:]
+	}
+	return id, ""
+}
+
+// find looks up a parameter by name or ARN. The caller must hold s.lock.
+func (s *ssm) find(name string) (*parameter, error) {
+	name = trimArn(name)
+	if p, ok := s.params[name]; ok {
+		return p, nil
+	}
+	// An ARN loses the distinction between "/name" and "name".
+	if strings.HasPrefix(name, "/") && strings.Count(name, "/") == 1 {
+		if p, ok := s.params[name[1:]]; ok {
+			return p, nil
+		}
+	}
+	return nil, common.NewError("ParameterNotFound")
+}
+
+// value returns a version's value, decrypting it if asked to. The caller must
+// hold s.lock.
+func (s *ssm) value(p *parameter, v *version, withDecryption bool) (string, error) {
+	if v.typ != TypeSecureString || !withDecryption {
+		return v.value, nil
+	}
+	return s.decrypt(p.arn, v.value)
+}
+
+// toParameter renders a version of a parameter. The caller must hold s.lock.
+func (s *ssm) toParameter(p *parameter, v *version, selector string, withDecryption bool) (*Parameter, error) {
+	value, err := s.value(p, v, withDecryption)
+	if err != nil {
+		return nil, err
+	}
+	return &Parameter{
+		ARN:              p.arn,
+		DataType:         v.dataType,
+		LastModifiedDate: v.modified.Unix(),
+		Name:             p.name,
+		Selector:         selector,
+		Type:             v.typ,
+		Value:            value,
+		Version:          v.number,
+	}, nil
+}
+
+// tier works out the tier a value needs.
+func tier(requested string, previous string, value string) (string, error) {
+	if requested == "" {
+		requested = TierStandard
+		if previous != "" {
+			requested = previous
+		}
+	}
+
+	switch requested {
+	case TierIntelligentTiering:
+		if len(value) > maxStandardValue || previous == TierAdvanced {
+			return TierAdvanced, nil
+		}
+		return TierStandard, nil
+	case TierStandard:
+		if previous == TierAdvanced {
+			return "", common.Errorf("ValidationException", "This parameter uses the advanced-parameter tier. You can't downgrade a parameter from the advanced-parameter tier to the standard-parameter tier.")
+		}
+		if len(value) > maxStandardValue {
+			return "", common.Errorf("ValidationException", "Standard tier parameters support a maximum parameter value of %v characters.", maxStandardValue)
+		}
+		return TierStandard, nil
+	case TierAdvanced:
+		if len(value) > maxAdvancedValue {
+			return "", common.Errorf("ValidationException", "Advanced tier parameters support a maximum parameter value of %v characters.", maxAdvancedValue)
+		}
+		return TierAdvanced, nil
+	}
+	return "", common.Errorf("ValidationException", "Tier %v is not supported.", requested)
+}
+
+// paging reads MaxResults, which defaults to limit, and NextToken, which is
+// an offset into the list.
+func paging(maxResults int, limit int, nextToken string) (int, int, error) {
+	if maxResults == 0 {
+		maxResults = limit
+	}
+	if maxResults < 1 || maxResults > limit {
+		return 0, 0, common.Errorf("ValidationException", "MaxResults must be between 1 and %v.", limit)
+	}
+
+	offset := 0
+	if nextToken != "" {
+		raw, err := base64.RawURLEncoding.DecodeString(nextToken)
+		if err != nil {
+			return 0, 0, common.NewError("InvalidNextToken")
+		}
+		if offset, err = strconv.Atoi(string(raw)); err != nil || offset < 0 {
+			return 0, 0, common.NewError("InvalidNextToken")
+		}
+	}
+	return maxResults, offset, nil
+}
+
+// nextToken returns the token for the page after the one ending at end, or
+// "" if there isn't one.
+func nextToken(end int, total int) string {
+	if end >= total {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(end)))
+}
+
+//
+// Parameters.
+//
+
+func (s *ssm) PutParameter(req *PutParameterRequest) (*PutParameterResult, error) {
+	if err := validName(req.Name); err != nil {
+		return nil, err
+	}
+	if req.Value == "" {
+		return nil, common.Errorf("ValidationException", "Parameter value can't be empty.")
+	}
+	switch req.Type {
+	case "", TypeString, TypeStringList, TypeSecureString:
+	default:
+		return nil, common.Errorf("ValidationException", "Parameter type %v is not supported.", req.Type)
+	}
+	switch req.DataType {
+	case "", "text", "aws:ec2:image", "aws:ssm:integration":
+	default:
+		return nil, common.Errorf("ValidationException", "The following data type is not supported: %v", req.DataType)
+	}
+	if len(req.Tags) > 0 && req.Overwrite {
+		return nil, common.Errorf("ValidationException", "Invalid request: tags and overwrite can't be used together. To create a parameter with tags, please remove overwrite flag. To update tags for an existing parameter, please use AddTagsToResource or RemoveTagsFromResource.")
+	}
+	if len(req.Tags) > 50 {
+		return nil, common.NewError("TooManyTagsError")
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	p, exists := s.params[req.Name]
+	if exists && !req.Overwrite {
+		return nil, common.Errorf("ParameterAlreadyExists", "The parameter already exists. To overwrite this request, set the overwrite option in the request to true.")
+	}
+
+	v := &version{
+		number:         1,
+		typ:            req.Type,
+		dataType:       req.DataType,
+		description:    req.Description,
+		allowedPattern: req.AllowedPattern,
+		keyID:          req.KeyID,
+		labels:         map[string]bool{},
+	}
+	previousTier := ""
+	if exists {
+		latest := p.latest()
+		v.number = latest.number + 1
+		previousTier = latest.tier
+		if v.typ == "" {
+			v.typ = latest.typ
+		}
+		if v.dataType == "" {
+			v.dataType = latest.dataType
+		}
+		if v.description == "" {
+			v.description = latest.description
+		}
+		if v.allowedPattern == "" {
+			v.allowedPattern = latest.allowedPattern
+		}
+		if v.keyID == "" && v.typ == TypeSecureString && latest.typ == TypeSecureString {
+			v.keyID = latest.keyID
+		}
+	}
+	if v.typ == "" {
+		return nil, common.Errorf("ValidationException", "A parameter type is required when you create a parameter.")
+	}
+	if v.dataType == "" {
+		v.dataType = "text"
+	}
+	if req.KeyID != "" && v.typ != TypeSecureString {
+		return nil, common.Errorf("ValidationException", "KeyId is required for SecureString type parameter only.")
+	}
+
+	if v.allowedPattern != "" {
+		pattern, err := regexp.Compile(v.allowedPattern)
+		if err != nil {
+			return nil, common.Errorf("ValidationException", "The allowed pattern %v is not a valid regular expression.", v.allowedPattern)
+		}
+		if !pattern.MatchString(req.Value) {
+			return nil, common.Errorf("ParameterPatternMismatchException", "Parameter value, cannot be validated against allowedPattern: %v", v.allowedPattern)
+		}
+	}
+
+	t, err := tier(req.Tier, previousTier, req.Value)
+	if err != nil {
+		return nil, err
+	}
+	v.tier = t
+
+	if exists && len(p.versions) >= maxVersions && len(p.versions[0].labels) > 0 {
+		return nil, common.Errorf("ParameterMaxVersionLimitExceeded", "You attempted to create a new version of %v by calling the PutParameter API with the overwrite flag. Version %v, the oldest version, can't be deleted because it has a label associated with it. Move the label to another version of the parameter, and try again.", req.Name, p.versions[0].number)
+	}
+
+	if !exists {
+		p = &parameter{
+			name: req.Name,
+			arn:  parameterArn(req.Name),
+			tags: append([]Tag(nil), req.Tags...),
+		}
+	}
+
+	v.value = req.Value
+	if v.typ == TypeSecureString {
+		ciphertext, keyArn, err := s.encrypt(v.keyID, p.arn, req.Value)
+		if err != nil {
+			return nil, err
+		}
+		v.value = ciphertext
+		if v.keyID == "" {
+			v.keyID = keyArn
+		}
+	}
+	v.modified = time.Now()
+
+	p.versions = append(p.versions, v)
+	if len(p.versions) > maxVersions {
+		p.versions = p.versions[1:]
+	}
+	s.params[p.name] = p
+
+	return &PutParameterResult{
+		Tier:    v.tier,
+		Version: v.number,
+	}, nil
+}
+
+func (s *ssm) GetParameter(req *GetParameterRequest) (*GetParameterResult, error) {
+	name, selector := splitSelector(req.Name)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	p, err := s.find(name)
+	if err != nil {
+		return nil, err
+	}
+	v, err := p.selected(selector)
+	if err != nil {
+		return nil, err
+	}
+
+	param, err := s.toParameter(p, v, selector, req.WithDecryption)
+	if err != nil {
+		return nil, err
+	}
+	return &GetParameterResult{Parameter: param}, nil
+}
+
+func (s *ssm) GetParameters(req *GetParametersRequest) (*GetParametersResult, error) {
+	if len(req.Names) < 1 || len(req.Names) > 10 {
+		return nil, common.Errorf("ValidationException", "Names must contain between 1 and 10 names.")
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	out := &GetParametersResult{
+		InvalidParameters: []string{},
+		Parameters:        []Parameter{},
+	}
+	for _, id := range req.Names {
+		name, selector := splitSelector(id)
+		p, err := s.find(name)
+		if err != nil {
+			out.InvalidParameters = append(out.InvalidParameters, id)
+			continue
+		}
+		v, err := p.selected(selector)
+		if err != nil {
+			out.InvalidParameters = append(out.InvalidParameters, id)
+			continue
+		}
+		param, err := s.toParameter(p, v, selector, req.WithDecryption)
+		if err != nil {
+			return nil, err
+		}
+		out.Parameters = append(out.Parameters, *param)
+	}
+	return out, nil
+}
+
+// filter returns the version of p the filters pick out, or nil if they
+// exclude it.
+func filter(p *parameter, filters []ParameterStringFilter) (*version, error) {
+	v := p.latest()
+	for _, f := range filters {
+		if f.Option != "" && f.Option != "Equals" {
+			return nil, common.Errorf("InvalidFilterOption", "The option %v is not valid for key %v.", f.Option, f.Key)
+		}
+
+		var match *version
+		for _, value := range f.Values {
+			switch f.Key {
+			case "Type":
+				if v.typ == value {
+					match = v
+				}
+			case "KeyId":
+				if v.keyID == value {
+					match = v
+				}
+			case "Label":
+				if labeled := p.labeled(value); labeled != nil {
+					match = labeled
+				}
+			default:
+				return nil, common.Errorf("InvalidFilterKey", "The filter key %v is not valid.", f.Key)
+			}
+		}
+		if match == nil {
+			return nil, nil
+		}
+		v = match
+	}
+	return v, nil
+}
+
+func (s *ssm) GetParametersByPath(req *GetParametersByPathRequest) (*GetParametersByPathResult, error) {
+	if !strings.HasPrefix(req.Path, "/") || len(req.Path) > 2048 {
+		return nil, common.Errorf("ValidationException", "The parameter path must start with a forward slash.")
+	}
+	if strings.Count(strings.TrimSuffix(req.Path, "/"), "/") > maxHierarchyLevels {
+		return nil, common.Errorf("HierarchyLevelLimitExceededException", "A hierarchy can have a maximum of %v levels.", maxHierarchyLevels)
+	}
+	maxResults, offset, err := paging(req.MaxResults, 10, req.NextToken)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := strings.TrimSuffix(req.Path, "/") + "/"
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	names := []string{}
+	for name := range s.params {
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		if !req.Recursive && strings.Contains(name[len(prefix):], "/") {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	type match struct {
+		p *parameter
+		v *version
+	}
+	matched := []match{}
+	for _, name := range names {
+		v, err := filter(s.params[name], req.ParameterFilters)
+		if err != nil {
+			return nil, err
+		}
+		if v != nil {
+			matched = append(matched, match{s.params[name], v})
+		}
+	}
+
+	if offset > len(matched) {
+		offset = len(matched)
+	}
+	end := offset + maxResults
+	if end > len(matched) {
+		end = len(matched)
+	}
+
+	out := &GetParametersByPathResult{
+		NextToken:  nextToken(end, len(matched)),
+		Parameters: []Parameter{},
+	}
+	for _, m := range matched[offset:end] {
+		param, err := s.toParameter(m.p, m.v, "", req.WithDecryption)
+		if err != nil {
+			return nil, err
+		}
+		out.Parameters = append(out.Parameters, *param)
+	}
+	return out, nil
+}
+
+func (s *ssm) DeleteParameter(req *DeleteParameterRequest) (*DeleteParameterResult, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	p, err := s.find(req.Name)
+	if err != nil {
+		return nil, err
+	}
+	delete(s.params, p.name)
+	return &DeleteParameterResult{}, nil
+}
+
+func (s *ssm) DeleteParameters(req *DeleteParametersRequest) (*DeleteParametersResult, error) {
+	if len(req.Names) < 1 || len(req.Names) > 10 {
+		return nil, common.Errorf("ValidationException", "Names must contain between 1 and 10 names.")
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	out := &DeleteParametersResult{
+		DeletedParameters: []string{},
+		InvalidParameters: []string{},
+	}
+	for _, name := range req.Names {
+		p, err := s.find(name)
+		if err != nil {
+			out.InvalidParameters = append(out.InvalidParameters, name)
+			continue
+		}
+		delete(s.params, p.name)
+		out.DeletedParameters = append(out.DeletedParameters, name)
+	}
+	return out, nil
+}
+
+//
+// Versions.
+//
+
+func (s *ssm) GetParameterHistory(req *GetParameterHistoryRequest) (*GetParameterHistoryResult, error) {
+	maxResults, offset, err := paging(req.MaxResults, 50, req.NextToken)
+	if err != nil {
+		return nil, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	p, err := s.find(req.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	if offset > len(p.versions) {
+		offset = len(p.versions)
+	}
+	end := offset + maxResults
+	if end > len(p.versions) {
+		end = len(p.versions)
+	}
+
+	out := &GetParameterHistoryResult{
+		NextToken:  nextToken(end, len(p.versions)),
+		Parameters: []ParameterHistory{},
+	}
+	for _, v := range p.versions[offset:end] {
+		value, err := s.value(p, v, req.WithDecryption)
+		if err != nil {
+			return nil, err
+		}
+		out.Parameters = append(out.Parameters, ParameterHistory{
+			AllowedPattern:   v.allowedPattern,
+			DataType:         v.dataType,
+			Description:      v.description,
+			KeyID:            v.keyID,
+			Labels:           v.labelList(),
+			LastModifiedDate: v.modified.Unix(),
+			LastModifiedUser: lastModifiedUser,
+			Name:             p.name,
+			Tier:             v.tier,
+			Type:             v.typ,
+			Value:            value,
+			Version:          v.number,
+		})
+	}
+	return out, nil
+}
+
+// validLabel checks a version label.
+func validLabel(label string) bool {
+	return labelPattern.MatchString(label) && !reserved(label) && !('0' <= label[0] && label[0] <= '9')
+}
+
+func (s *ssm) LabelParameterVersion(req *LabelParameterVersionRequest) (*LabelParameterVersionResult, error) {
+	if len(req.Labels) < 1 || len(req.Labels) > maxLabels {
+		return nil, common.Errorf("ValidationException", "Labels must contain between 1 and %v labels.", maxLabels)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	p, err := s.find(req.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	v := p.latest()
+	if req.ParameterVersion != 0 {
+		if v = p.version(req.ParameterVersion); v == nil {
+			return nil, common.Errorf("ParameterVersionNotFound", "Systems Manager could not find version %v of %v.", req.ParameterVersion, p.name)
+		}
+	}
+
+	valid, invalid := []string{}, []string{}
+	for _, label := range req.Labels {
+		if validLabel(label) {
+			valid = append(valid, label)
+		} else {
+			invalid = append(invalid, label)
+		}
+	}
+
+	count := len(v.labels)
+	for _, label := range valid {
+		if !v.labels[label] {
+			count++
+		}
+	}
+	if count > maxLabels {
+		return nil, common.Errorf("ParameterVersionLabelLimitExceeded", "A parameter version can have maximum %v labels.", maxLabels)
+	}
+
+	// A label can only be on one version; labeling moves it.
+	for _, label := range valid {
+		if from := p.labeled(label); from != nil {
+			delete(from.labels, label)
+		}
+		v.labels[label] = true
+	}
+
+	return &LabelParameterVersionResult{
+		InvalidLabels:    invalid,
+		ParameterVersion: v.number,
+	}, nil
+}
+
+func (s *ssm) UnlabelParameterVersion(req *UnlabelParameterVersionRequest) (*UnlabelParameterVersionResult, error) {
+	if len(req.Labels) < 1 || len(req.Labels) > maxLabels {
+		return nil, common.Errorf("ValidationException", "Labels must contain between 1 and %v labels.", maxLabels)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	p, err := s.find(req.Name)
+	if err != nil {
+		return nil, err
+	}
+	v := p.version(req.ParameterVersion)
+	if v == nil {
+		return nil, common.Errorf("ParameterVersionNotFound", "Systems Manager could not find version %v of %v.", req.ParameterVersion, p.name)
+	}
+
+	out := &UnlabelParameterVersionResult{
+		InvalidLabels: []string{},
+		RemovedLabels: []string{},
+	}
+	for _, label := range req.Labels {
+		if v.labels[label] {
+			delete(v.labels, label)
+			out.RemovedLabels = append(out.RemovedLabels, label)
+		} else {
+			out.InvalidLabels = append(out.InvalidLabels, label)
+		}
+	}
+	return out, nil
+}
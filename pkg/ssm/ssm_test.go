@@ -0,0 +1,339 @@
+package ssm_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/fernomac/aws-local/pkg/common"
+	"github.com/fernomac/aws-local/pkg/kms"
+	"github.com/fernomac/aws-local/pkg/ssm"
+)
+
+func code(err error) string {
+	if ce, ok := err.(common.Error); ok {
+		return ce.Code
+	}
+	if err != nil {
+		return err.Error()
+	}
+	return ""
+}
+
+func put(t *testing.T, s ssm.SSM, name string, value string) int64 {
+	out, err := s.PutParameter(&ssm.PutParameterRequest{Name: name, Value: value, Type: ssm.TypeString, Overwrite: true})
+	if err != nil {
+		t.Fatalf("%v: %v", name, err)
+	}
+	return out.Version
+}
+
+func names(params []ssm.Parameter) []string {
+	out := []string{}
+	for _, p := range params {
+		out = append(out, p.Name)
+	}
+	return out
+}
+
+func TestGetParametersByPath(t *testing.T) {
+	s := ssm.New(kms.New())
+	for _, name := range []string{"/app/b", "/app/a", "/app/db/host", "/app/db/port", "/app/db/replica/host", "/apple", "/other/x", "top"} {
+		put(t, s, name, "v")
+	}
+	if _, err := s.LabelParameterVersion(&ssm.LabelParameterVersionRequest{Name: "/app/db/host", Labels: []string{"prod"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path      string
+		recursive bool
+		filters   []ssm.ParameterStringFilter
+		want      []string
+		code      string
+	}{
+		{"/app", false, nil, []string{"/app/a", "/app/b"}, ""},
+		{"/app/", false, nil, []string{"/app/a", "/app/b"}, ""},
+		{"/app", true, nil, []string{"/app/a", "/app/b", "/app/db/host", "/app/db/port", "/app/db/replica/host"}, ""},
+		{"/app/db", false, nil, []string{"/app/db/host", "/app/db/port"}, ""},
+		{"/", false, nil, []string{"/apple"}, ""},
+		{"/missing", true, nil, []string{}, ""},
+		{"/app", true, []ssm.ParameterStringFilter{{Key: "Label", Values: []string{"prod"}}}, []string{"/app/db/host"}, ""},
+		{"/app", true, []ssm.ParameterStringFilter{{Key: "Type", Option: "Equals", Values: []string{ssm.TypeSecureString}}}, []string{}, ""},
+		{"/app", true, []ssm.ParameterStringFilter{{Key: "Type", Option: "BeginsWith", Values: []string{"S"}}}, nil, "InvalidFilterOption"},
+		{"/app", true, []ssm.ParameterStringFilter{{Key: "Name", Values: []string{"a"}}}, nil, "InvalidFilterKey"},
+		{"app", false, nil, nil, "ValidationException"},
+	}
+
+	for _, test := range tests {
+		out, err := s.GetParametersByPath(&ssm.GetParametersByPathRequest{Path: test.path, Recursive: test.recursive, ParameterFilters: test.filters})
+		if got := code(err); got != test.code {
+			t.Errorf("%v: got %v, want %v", test.path, got, test.code)
+			continue
+		}
+		if err == nil && !reflect.DeepEqual(names(out.Parameters), test.want) {
+			t.Errorf("%v (recursive %v): got %v, want %v", test.path, test.recursive, names(out.Parameters), test.want)
+		}
+	}
+}
+
+func TestGetParametersByPathPaging(t *testing.T) {
+	s := ssm.New(kms.New())
+	want := []string{}
+	for _, name := range []string{"/p/a", "/p/b", "/p/c/d", "/p/c/e", "/p/f"} {
+		put(t, s, name, "v")
+		want = append(want, name)
+	}
+
+	got := []string{}
+	pages := 0
+	token := ""
+	for {
+		out, err := s.GetParametersByPath(&ssm.GetParametersByPathRequest{Path: "/p", Recursive: true, MaxResults: 2, NextToken: token})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, names(out.Parameters)...)
+		pages++
+		if token = out.NextToken; token == "" {
+			break
+		}
+	}
+	if !reflect.DeepEqual(got, want) || pages != 3 {
+		t.Errorf("got %v in %v pages, want %v in 3", got, pages, want)
+	}
+
+	for _, test := range []struct {
+		maxResults int
+		token      string
+		code       string
+	}{
+		{0, "", ""},
+		{10, "", ""},
+		{11, "", "ValidationException"},
+		{-1, "", "ValidationException"},
+		{1, "!!!", "InvalidNextToken"},
+		{1, "LTE", "InvalidNextToken"},
+	} {
+		_, err := s.GetParametersByPath(&ssm.GetParametersByPathRequest{Path: "/p", MaxResults: test.maxResults, NextToken: test.token})
+		if got := code(err); got != test.code {
+			t.Errorf("MaxResults %v, token %q: got %v, want %v", test.maxResults, test.token, got, test.code)
+		}
+	}
+}
+
+func TestSelectors(t *testing.T) {
+	s := ssm.New(kms.New())
+	for _, value := range []string{"one", "two", "three"} {
+		put(t, s, "/app/mode", value)
+	}
+	if _, err := s.LabelParameterVersion(&ssm.LabelParameterVersionRequest{Name: "/app/mode", ParameterVersion: 2, Labels: []string{"stable"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		value   string
+		version int64
+		code    string
+	}{
+		{"/app/mode", "three", 3, ""},
+		{"/app/mode:1", "one", 1, ""},
+		{"/app/mode:3", "three", 3, ""},
+		{"/app/mode:stable", "two", 2, ""},
+		{"arn:aws:ssm:" + common.Region + ":" + common.AccountID + ":parameter/app/mode:stable", "two", 2, ""},
+		{"/app/mode:4", "", 0, "ParameterVersionNotFound"},
+		{"/app/mode:beta", "", 0, "ParameterVersionNotFound"},
+		{"/app/other:1", "", 0, "ParameterNotFound"},
+	}
+
+	for _, test := range tests {
+		out, err := s.GetParameter(&ssm.GetParameterRequest{Name: test.name})
+		if got := code(err); got != test.code {
+			t.Errorf("%v: got %v, want %v", test.name, got, test.code)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if out.Parameter.Value != test.value || out.Parameter.Version != test.version {
+			t.Errorf("%v: got %v version %v, want %v version %v", test.name, out.Parameter.Value, out.Parameter.Version, test.value, test.version)
+		}
+	}
+
+	out, err := s.GetParameters(&ssm.GetParametersRequest{Names: []string{"/app/mode:1", "/app/mode:9", "/app/mode:stable", "/nope"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	selectors := []string{}
+	for _, p := range out.Parameters {
+		selectors = append(selectors, p.Selector)
+	}
+	if !reflect.DeepEqual(selectors, []string{":1", ":stable"}) || !reflect.DeepEqual(out.InvalidParameters, []string{"/app/mode:9", "/nope"}) {
+		t.Errorf("got selectors %v and invalid %v", selectors, out.InvalidParameters)
+	}
+}
+
+func TestLabels(t *testing.T) {
+	s := ssm.New(kms.New())
+	for _, value := range []string{"one", "two", "three"} {
+		put(t, s, "/app/mode", value)
+	}
+	labels := func() map[int64][]string {
+		out, err := s.GetParameterHistory(&ssm.GetParameterHistoryRequest{Name: "/app/mode"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := map[int64][]string{}
+		for _, v := range out.Parameters {
+			got[v.Version] = v.Labels
+		}
+		return got
+	}
+
+	steps := []struct {
+		version int64
+		labels  []string
+		invalid []string
+		want    map[int64][]string
+	}{
+		{1, []string{"prod", "blue"}, []string{}, map[int64][]string{1: {"blue", "prod"}, 2: {}, 3: {}}},
+		// Labeling another version moves the label.
+		{2, []string{"prod"}, []string{}, map[int64][]string{1: {"blue"}, 2: {"prod"}, 3: {}}},
+		// No version means the latest.
+		{0, []string{"blue"}, []string{}, map[int64][]string{1: {}, 2: {"prod"}, 3: {"blue"}}},
+		{1, []string{"1st", "aws-x", "SSM-y", "has space", "ok"}, []string{"1st", "aws-x", "SSM-y", "has space"}, map[int64][]string{1: {"ok"}, 2: {"prod"}, 3: {"blue"}}},
+	}
+
+	for i, step := range steps {
+		out, err := s.LabelParameterVersion(&ssm.LabelParameterVersionRequest{Name: "/app/mode", ParameterVersion: step.version, Labels: step.labels})
+		if err != nil {
+			t.Fatalf("step %v: %v", i, err)
+		}
+		if !reflect.DeepEqual(out.InvalidLabels, step.invalid) {
+			t.Errorf("step %v: got invalid labels %v, want %v", i, out.InvalidLabels, step.invalid)
+		}
+		if got := labels(); !reflect.DeepEqual(got, step.want) {
+			t.Errorf("step %v: got %v, want %v", i, got, step.want)
+		}
+	}
+
+	_, err := s.LabelParameterVersion(&ssm.LabelParameterVersionRequest{Name: "/app/mode", ParameterVersion: 9, Labels: []string{"x"}})
+	if code(err) != "ParameterVersionNotFound" {
+		t.Errorf("labeling a missing version: got %v", err)
+	}
+	many := []string{}
+	for _, label := range []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j"} {
+		many = append(many, "l"+label)
+	}
+	if _, err := s.LabelParameterVersion(&ssm.LabelParameterVersionRequest{Name: "/app/mode", ParameterVersion: 1, Labels: many}); code(err) != "ParameterVersionLabelLimitExceeded" {
+		t.Errorf("eleventh label: got %v", err)
+	}
+
+	unlabeled, err := s.UnlabelParameterVersion(&ssm.UnlabelParameterVersionRequest{Name: "/app/mode", ParameterVersion: 2, Labels: []string{"prod", "blue"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(unlabeled.RemovedLabels, []string{"prod"}) || !reflect.DeepEqual(unlabeled.InvalidLabels, []string{"blue"}) {
+		t.Errorf("unlabel: got %+v", unlabeled)
+	}
+	if _, err := s.GetParameter(&ssm.GetParameterRequest{Name: "/app/mode:prod"}); code(err) != "ParameterVersionNotFound" {
+		t.Errorf("removed label still selects: %v", err)
+	}
+}
+
+func TestLabeledOldestVersion(t *testing.T) {
+	s := ssm.New(kms.New())
+	for i := 0; i < 100; i++ {
+		put(t, s, "busy", "v")
+	}
+	if _, err := s.LabelParameterVersion(&ssm.LabelParameterVersionRequest{Name: "busy", ParameterVersion: 1, Labels: []string{"first"}}); err != nil {
+		t.Fatal(err)
+	}
+	_, err := s.PutParameter(&ssm.PutParameterRequest{Name: "busy", Value: "v", Overwrite: true})
+	if code(err) != "ParameterMaxVersionLimitExceeded" {
+		t.Fatalf("got %v, want ParameterMaxVersionLimitExceeded", err)
+	}
+
+	// Once the label moves off, the oldest version can go.
+	if _, err := s.LabelParameterVersion(&ssm.LabelParameterVersionRequest{Name: "busy", Labels: []string{"first"}}); err != nil {
+		t.Fatal(err)
+	}
+	if v := put(t, s, "busy", "v"); v != 101 {
+		t.Errorf("got version %v, want 101", v)
+	}
+	if _, err := s.GetParameter(&ssm.GetParameterRequest{Name: "busy:1"}); code(err) != "ParameterVersionNotFound" {
+		t.Errorf("version 1: got %v", err)
+	}
+}
+
+func TestSecureString(t *testing.T) {
+	k := kms.New()
+	s := ssm.New(k)
+	key, err := k.CreateKey(&kms.CreateKeyRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.PutParameter(&ssm.PutParameterRequest{Name: "/db/password", Value: "hunter2", Type: ssm.TypeSecureString}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.PutParameter(&ssm.PutParameterRequest{Name: "/db/token", Value: "abc", Type: ssm.TypeSecureString, KeyID: key.KeyMetadata.KeyID}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"/db/password", "/db/token"} {
+		raw, err := s.GetParameter(&ssm.GetParameterRequest{Name: name})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if raw.Parameter.Value == "" || raw.Parameter.Value == "hunter2" || raw.Parameter.Value == "abc" {
+			t.Errorf("%v: got %q without decryption", name, raw.Parameter.Value)
+		}
+	}
+
+	out, err := s.GetParametersByPath(&ssm.GetParametersByPathRequest{Path: "/db", WithDecryption: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := map[string]string{}
+	for _, p := range out.Parameters {
+		values[p.Name] = p.Value
+	}
+	if want := map[string]string{"/db/password": "hunter2", "/db/token": "abc"}; !reflect.DeepEqual(values, want) {
+		t.Errorf("got %v, want %v", values, want)
+	}
+
+	// Overwriting keeps the key.
+	if _, err := s.PutParameter(&ssm.PutParameterRequest{Name: "/db/token", Value: "def", Overwrite: true}); err != nil {
+		t.Fatal(err)
+	}
+	history, err := s.GetParameterHistory(&ssm.GetParameterHistoryRequest{Name: "/db/token", WithDecryption: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range history.Parameters {
+		if v.KeyID != key.KeyMetadata.KeyID {
+			t.Errorf("version %v: got key %v, want %v", v.Version, v.KeyID, key.KeyMetadata.KeyID)
+		}
+	}
+	if history.Parameters[1].Value != "def" {
+		t.Errorf("got %q, want def", history.Parameters[1].Value)
+	}
+
+	if _, err := s.PutParameter(&ssm.PutParameterRequest{Name: "/db/other", Value: "x", Type: ssm.TypeSecureString, KeyID: "alias/missing"}); code(err) != "InvalidKeyId" {
+		t.Errorf("missing key: got %v, want InvalidKeyId", err)
+	}
+	if _, err := s.PutParameter(&ssm.PutParameterRequest{Name: "/db/plain", Value: "x", Type: ssm.TypeString, KeyID: key.KeyMetadata.KeyID}); code(err) != "ValidationException" {
+		t.Errorf("key on a String: got %v, want ValidationException", err)
+	}
+
+	if err := k.DisableKey(&kms.DisableKeyRequest{KeyID: key.KeyMetadata.KeyID}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetParameter(&ssm.GetParameterRequest{Name: "/db/token", WithDecryption: true}); code(err) != "InvalidKeyId" {
+		t.Errorf("disabled key: got %v, want InvalidKeyId", err)
+	}
+	if _, err := s.GetParameter(&ssm.GetParameterRequest{Name: "/db/token"}); err != nil {
+		t.Errorf("disabled key without decryption: %v", err)
+	}
+}
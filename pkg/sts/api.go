@@ -0,0 +1,120 @@
+package sts
+
+import (
+	"time"
+
+	"github.com/fernomac/aws-local/pkg/identity"
+)
+
+// STS is the service interface for AWS Security Token Service. Calls that
+// act on behalf of the caller are given the caller's principal.
+type STS interface {
+	GetCallerIdentity(*identity.Principal, *GetCallerIdentityRequest) (*GetCallerIdentityResult, error)
+	AssumeRole(*identity.Principal, *AssumeRoleRequest) (*AssumeRoleResult, error)
+	AssumeRoleWithWebIdentity(*AssumeRoleWithWebIdentityRequest) (*AssumeRoleWithWebIdentityResult, error)
+	GetSessionToken(*identity.Principal, *GetSessionTokenRequest) (*GetSessionTokenResult, error)
+}
+
+// Tag is a session tag.
+type Tag struct {
+	Key   string `query:"Key"`
+	Value string `query:"Value"`
+}
+
+// PolicyDescriptorType names a managed session policy.
+type PolicyDescriptorType struct {
+	Arn string `query:"arn"`
+}
+
+// Credentials are temporary security credentials.
+type Credentials struct {
+	AccessKeyID     string    `xml:"AccessKeyId"`
+	SecretAccessKey string    `xml:"SecretAccessKey"`
+	SessionToken    string    `xml:"SessionToken"`
+	Expiration      time.Time `xml:"Expiration"`
+}
+
+// AssumedRoleUser identifies a role session.
+type AssumedRoleUser struct {
+	Arn           string `xml:"Arn"`
+	AssumedRoleID string `xml:"AssumedRoleId"`
+}
+
+//
+// API shapes for callers.
+//
+
+// GetCallerIdentityRequest is a request to GetCallerIdentity.
+type GetCallerIdentityRequest struct{}
+
+// GetCallerIdentityResult is the result of GetCallerIdentity.
+type GetCallerIdentityResult struct {
+	Account string `xml:"Account"`
+	Arn     string `xml:"Arn"`
+	UserID  string `xml:"UserId"`
+}
+
+//
+// API shapes for roles.
+//
+
+// AssumeRoleRequest is a request to AssumeRole.
+type AssumeRoleRequest struct {
+	DurationSeconds   int                    `query:"DurationSeconds"`
+	ExternalID        string                 `query:"ExternalId"`
+	Policy            string                 `query:"Policy"`
+	PolicyArns        []PolicyDescriptorType `query:"PolicyArns"`
+	RoleArn           string                 `query:"RoleArn"`
+	RoleSessionName   string                 `query:"RoleSessionName"`
+	SerialNumber      string                 `query:"SerialNumber"`
+	SourceIdentity    string                 `query:"SourceIdentity"`
+	Tags              []Tag                  `query:"Tags"`
+	TokenCode         string                 `query:"TokenCode"`
+	TransitiveTagKeys []string               `query:"TransitiveTagKeys"`
+}
+
+// AssumeRoleResult is the result of AssumeRole.
+type AssumeRoleResult struct {
+	AssumedRoleUser  *AssumedRoleUser `xml:"AssumedRoleUser"`
+	Credentials      *Credentials     `xml:"Credentials"`
+	PackedPolicySize int              `xml:"PackedPolicySize,omitempty"`
+	SourceIdentity   string           `xml:"SourceIdentity,omitempty"`
+}
+
+// AssumeRoleWithWebIdentityRequest is a request to AssumeRoleWithWebIdentity.
+type AssumeRoleWithWebIdentityRequest struct {
+	DurationSeconds  int                    `query:"DurationSeconds"`
+	Policy           string                 `query:"Policy"`
+	PolicyArns       []PolicyDescriptorType `query:"PolicyArns"`
+	ProviderID       string                 `query:"ProviderId"`
+	RoleArn          string                 `query:"RoleArn"`
+	RoleSessionName  string                 `query:"RoleSessionName"`
+	WebIdentityToken string                 `query:"WebIdentityToken"`
+}
+
+// AssumeRoleWithWebIdentityResult is the result of AssumeRoleWithWebIdentity.
+type AssumeRoleWithWebIdentityResult struct {
+	AssumedRoleUser             *AssumedRoleUser `xml:"AssumedRoleUser"`
+	Audience                    string           `xml:"Audience"`
+	Credentials                 *Credentials     `xml:"Credentials"`
+	PackedPolicySize            int              `xml:"PackedPolicySize,omitempty"`
+	Provider                    string           `xml:"Provider"`
+	SourceIdentity              string           `xml:"SourceIdentity,omitempty"`
+	SubjectFromWebIdentityToken string           `xml:"SubjectFromWebIdentityToken"`
+}
+
+//
+// API shapes for sessions.
+//
+
+// GetSessionTokenRequest is a request to GetSessionToken.
+type GetSessionTokenRequest struct {
+	DurationSeconds int    `query:"DurationSeconds"`
+	SerialNumber    string `query:"SerialNumber"`
+	TokenCode       string `query:"TokenCode"`
+}
+
+// GetSessionTokenResult is the result of GetSessionToken.
+type GetSessionTokenResult struct {
+	Credentials *Credentials `xml:"Credentials"`
+}
@@ -0,0 +1,83 @@
+package sts
+
+import (
+	"net/http"
+
+	"github.com/fernomac/aws-local/pkg/awsquery"
+	"github.com/fernomac/aws-local/pkg/common"
+	"github.com/fernomac/aws-local/pkg/identity"
+)
+
+// Version is the API version STS requests carry.
+const Version = "2011-06-15"
+
+// NewHandler creates a new HTTP handler that works out who is calling from
+// the given registry, notifying the given observers of every call.
+func NewHandler(sts STS, registry *identity.Registry, observers ...common.Observer) http.Handler {
+	rval := awsquery.NewHandler("https://sts.amazonaws.com/doc/" + Version + "/")
+	rval.SetEventSource("sts.amazonaws.com")
+	rval.StatusFor("AccessDenied", 403)
+	rval.StatusFor("ExpiredToken", 403)
+	rval.StatusFor("InvalidClientTokenId", 403)
+	for _, o := range observers {
+		rval.ObserveWith(o)
+	}
+
+	//
+	// Callers.
+	//
+
+	rval.HandleWith("GetCallerIdentity", func(req *awsquery.Request) (interface{}, error) {
+		caller, err := registry.Caller(req.HTTP)
+		if err != nil {
+			return nil, err
+		}
+		in := GetCallerIdentityRequest{}
+		if err := req.Decode(&in); err != nil {
+			return nil, err
+		}
+		return sts.GetCallerIdentity(caller, &in)
+	})
+
+	//
+	// Roles.
+	//
+
+	rval.HandleWith("AssumeRole", func(req *awsquery.Request) (interface{}, error) {
+		caller, err := registry.Caller(req.HTTP)
+		if err != nil {
+			return nil, err
+		}
+		in := AssumeRoleRequest{}
+		if err := req.Decode(&in); err != nil {
+			return nil, err
+		}
+		return sts.AssumeRole(caller, &in)
+	})
+
+	rval.HandleWith("AssumeRoleWithWebIdentity", func(req *awsquery.Request) (interface{}, error) {
+		in := AssumeRoleWithWebIdentityRequest{}
+		if err := req.Decode(&in); err != nil {
+			return nil, err
+		}
+		return sts.AssumeRoleWithWebIdentity(&in)
+	})
+
+	//
+	// Sessions.
+	//
+
+	rval.HandleWith("GetSessionToken", func(req *awsquery.Request) (interface{}, error) {
+		caller, err := registry.Caller(req.HTTP)
+		if err != nil {
+			return nil, err
+		}
+		in := GetSessionTokenRequest{}
+		if err := req.Decode(&in); err != nil {
+			return nil, err
+		}
+		return sts.GetSessionToken(caller, &in)
+	})
+
+	return rval
+}
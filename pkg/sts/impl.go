@@ -0,0 +1,430 @@
+package sts
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/fernomac/aws-local/pkg/common"
+	"github.com/fernomac/aws-local/pkg/identity"
+)
+
+// Limits on session durations, in seconds.
+const (
+	minDuration          = 900
+	defaultRoleDuration  = 3600
+	maxRoleDuration      = 43200
+	maxChainedDuration   = 3600
+	defaultTokenDuration = 43200
+	maxTokenDuration     = 129600
+	maxRootTokenDuration = 3600
+)
+
+// maxPackedPolicy is how big, in bytes, session policies and tags may be
+// once packed.
+const maxPackedPolicy = 2048
+
+// maxSessionTags is how many session tags a session may have.
+const maxSessionTags = 50
+
+var (
+	roleArnPattern     = regexp.MustCompile(`^arn:aws:iam::(\d{12}):role/((?:[\w+=,.@-]+/)*)([\w+=,.@-]{1,64})$`)
+	sessionNamePattern = regexp.MustCompile(`^[\w+=,.@-]{2,64}$`)
+	externalIDPattern  = regexp.MustCompile(`^[\w+=,.@:/-]+$`)
+	tagKeyPattern      = regexp.MustCompile(`^[\p{L}\p{Z}\p{N}_.:/=+\-@]{1,128}$`)
+	tokenCodePattern   = regexp.MustCompile(`^\d{6}$`)
+)
+
+// Role configures how a role may be assumed. Roles that aren't configured
+// can be assumed by anyone, for up to the longest duration AWS allows.
+type Role struct {
+	// Arn is the role's ARN.
+	Arn string `json:"arn"`
+	// ExternalID, if set, must be given to assume the role.
+	ExternalID string `json:"externalId"`
+	// MaxSessionDuration is the longest session, in seconds, the role
+	// allows. It defaults to an hour.
+	MaxSessionDuration int `json:"maxSessionDuration"`
+}
+
+// Option configures an STS object.
+type Option func(*sts)
+
+// WithRole configures a role.
+func WithRole(role Role) Option {
+	return func(s *sts) {
+		if role.MaxSessionDuration == 0 {
+			role.MaxSessionDuration = defaultRoleDuration
+		}
+		s.roles[role.Arn] = &role
+	}
+}
+
+// WithIssuer trusts web identity tokens from the given issuer.
+func WithIssuer(issuer Issuer) Option {
+	return func(s *sts) {
+		s.issuers = append(s.issuers, &issuer)
+	}
+}
+
+// WithClock sets the clock credentials expire by.
+func WithClock(clock common.Clock) Option {
+	return func(s *sts) {
+		s.clock = clock
+	}
+}
+
+type sts struct {
+	clock    common.Clock
+	registry *identity.Registry
+	roles    map[string]*Role
+	issuers  []*Issuer
+}
+
+// New creates a new STS that registers the credentials it hands out with the
+// given registry.
+func New(registry *identity.Registry, opts ...Option) STS {
+	rval := &sts{
+		clock:    common.SystemClock,
+		registry: registry,
+		roles:    make(map[string]*Role),
+	}
+	for _, opt := range opts {
+		opt(rval)
+	}
+	return rval
+}
+
+func validationError(value interface{}, member string, constraint string) error {
+	return common.Errorf("ValidationError", "1 validation error detected: Value '%v' at '%v' failed to satisfy constraint: %v", value, member, constraint)
+}
+
+func randomString(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+// uniqueID makes an ID like the ones IAM gives things, e.g. AROA followed by
+// sixteen characters. Passing a seed makes it stable.
+func uniqueID(prefix string, seed string) string {
+	b := make([]byte, 10)
+	if seed != "" {
+		sum := sha256.Sum256([]byte(seed))
+		copy(b, sum[:])
+	} else if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return prefix + base32.StdEncoding.EncodeToString(b)
+}
+
+// duration checks a requested session duration, in seconds.
+func duration(requested int, def int, max int) (time.Duration, error) {
+	if requested == 0 {
+		requested = def
+	}
+	if requested < minDuration {
+		return 0, validationError(requested, "durationSeconds", fmt.Sprintf("Member must have value greater than or equal to %v", minDuration))
+	}
+	if requested > max {
+		return 0, validationError(requested, "durationSeconds", fmt.Sprintf("Member must have value less than or equal to %v", max))
+	}
+	return time.Duration(requested) * time.Second, nil
+}
+
+// issue makes temporary credentials for the principal and registers them.
+func (s *sts) issue(principal *identity.Principal, d time.Duration) *Credentials {
+	creds := identity.Credentials{
+		AccessKeyID:     uniqueID("ASIA", ""),
+		SecretAccessKey: randomString(30),
+		SessionToken:    randomString(192),
+		Expiration:      s.clock.Now().Add(d).UTC().Truncate(time.Second),
+	}
+	s.registry.Add(creds, principal)
+
+	return &Credentials{
+		AccessKeyID:     creds.AccessKeyID,
+		SecretAccessKey: creds.SecretAccessKey,
+		SessionToken:    creds.SessionToken,
+		Expiration:      creds.Expiration,
+	}
+}
+
+// packedPolicySize checks the session policies and tags fit, returning how
+// full they make the packed policy as a percentage.
+func packedPolicySize(policy string, policyArns []PolicyDescriptorType, tags map[string]string) (int, error) {
+	if policy != "" {
+		if !json.Valid([]byte(policy)) {
+			return 0, common.Errorf("MalformedPolicyDocument", "The policy is not in the valid JSON format.")
+		}
+	}
+	if len(policyArns) > 10 {
+		return 0, validationError(len(policyArns), "policyArns", "Member must have length less than or equal to 10")
+	}
+
+	size := len(policy)
+	for _, arn := range policyArns {
+		size += len(arn.Arn)
+	}
+	for k, v := range tags {
+		size += len(k) + len(v)
+	}
+	if size == 0 {
+		return 0, nil
+	}
+
+	percent := (size*100 + maxPackedPolicy - 1) / maxPackedPolicy
+	if percent > 100 {
+		return 0, common.Errorf("PackedPolicyTooLarge", "Packed policy consumes %v%% of allotted space, please use smaller policy.", percent)
+	}
+	return percent, nil
+}
+
+// sessionTags works out the tags of a new session: the caller's transitive
+// tags, which can't be overridden, plus the requested ones.
+func sessionTags(caller *identity.Principal, tags []Tag, transitive []string) (map[string]string, []string, error) {
+	if len(tags) > maxSessionTags {
+		return nil, nil, validationError(len(tags), "tags", fmt.Sprintf("Member must have length less than or equal to %v", maxSessionTags))
+	}
+
+	out := map[string]string{}
+	keys := map[string]bool{}
+	for _, tag := range tags {
+		if !tagKeyPattern.MatchString(tag.Key) || strings.HasPrefix(strings.ToLower(tag.Key), "aws:") {
+			return nil, nil, common.Errorf("InvalidParameterValue", "The tag key %v is invalid.", tag.Key)
+		}
+		if len(tag.Value) > 256 {
+			return nil, nil, common.Errorf("InvalidParameterValue", "The tag value for %v is too long.", tag.Key)
+		}
+		lower := strings.ToLower(tag.Key)
+		if _, ok := keys[lower]; ok {
+			return nil, nil, common.Errorf("InvalidParameterValue", "Duplicate tag keys found. Please note that Tag keys are case insensitive.")
+		}
+		keys[lower] = true
+		out[tag.Key] = tag.Value
+	}
+
+	transitiveKeys := []string{}
+	for _, key := range transitive {
+		if _, ok := keys[strings.ToLower(key)]; !ok {
+			return nil, nil, common.Errorf("InvalidParameterValue", "The transitive tag key %v is not one of the session tags.", key)
+		}
+		transitiveKeys = append(transitiveKeys, key)
+	}
+
+	if caller != nil {
+		for _, key := range caller.TransitiveTagKeys {
+			if _, ok := keys[strings.ToLower(key)]; ok {
+				return nil, nil, common.Errorf("InvalidParameterValue", "The session tag %v is transitive and can't be overridden.", key)
+			}
+			out[key] = caller.SessionTags[key]
+			transitiveKeys = append(transitiveKeys, key)
+		}
+	}
+
+	if len(out) > maxSessionTags {
+		return nil, nil, common.Errorf("InvalidParameterValue", "A session may have at most %v tags, including transitive ones.", maxSessionTags)
+	}
+	return out, transitiveKeys, nil
+}
+
+// roleSession makes the principal for a session of the given role.
+func roleSession(roleArn string, sessionName string) (*identity.Principal, *AssumedRoleUser, error) {
+	m := roleArnPattern.FindStringSubmatch(roleArn)
+	if m == nil {
+		return nil, nil, validationError(roleArn, "roleArn", "Member must be a valid role ARN")
+	}
+	if !sessionNamePattern.MatchString(sessionName) {
+		return nil, nil, validationError(sessionName, "roleSessionName", `Member must satisfy regular expression pattern: [\w+=,.@-]*`)
+	}
+
+	account, name := m[1], m[3]
+	user := &AssumedRoleUser{
+		Arn:           fmt.Sprintf("arn:aws:sts::%v:assumed-role/%v/%v", account, name, sessionName),
+		AssumedRoleID: uniqueID("AROA", roleArn) + ":" + sessionName,
+	}
+	return &identity.Principal{
+		Type:      identity.TypeAssumedRole,
+		AccountID: account,
+		Arn:       user.Arn,
+		UserID:    user.AssumedRoleID,
+	}, user, nil
+}
+
+// maxDuration is the longest session the role allows the caller.
+func (s *sts) maxDuration(caller *identity.Principal, roleArn string) int {
+	if caller != nil && caller.Type == identity.TypeAssumedRole {
+		return maxChainedDuration
+	}
+	if role, ok := s.roles[roleArn]; ok {
+		return role.MaxSessionDuration
+	}
+	return maxRoleDuration
+}
+
+func checkMFA(serialNumber string, tokenCode string) error {
+	if (serialNumber == "") != (tokenCode == "") {
+		return common.Errorf("AccessDenied", "MultiFactorAuthentication failed, SerialNumber and TokenCode must be given together.")
+	}
+	if tokenCode != "" && !tokenCodePattern.MatchString(tokenCode) {
+		return validationError(tokenCode, "tokenCode", `Member must satisfy regular expression pattern: [\d]*`)
+	}
+	return nil
+}
+
+//
+// Callers.
+//
+
+func (s *sts) GetCallerIdentity(caller *identity.Principal, req *GetCallerIdentityRequest) (*GetCallerIdentityResult, error) {
+	return &GetCallerIdentityResult{
+		Account: caller.AccountID,
+		Arn:     caller.Arn,
+		UserID:  caller.UserID,
+	}, nil
+}
+
+//
+// Roles.
+//
+
+func (s *sts) AssumeRole(caller *identity.Principal, req *AssumeRoleRequest) (*AssumeRoleResult, error) {
+	principal, user, err := roleSession(req.RoleArn, req.RoleSessionName)
+	if err != nil {
+		return nil, err
+	}
+
+	d, err := duration(req.DurationSeconds, defaultRoleDuration, maxRoleDuration)
+	if err != nil {
+		return nil, err
+	}
+	if int(d/time.Second) > s.maxDuration(caller, req.RoleArn) {
+		return nil, common.Errorf("ValidationError", "The requested DurationSeconds exceeds the MaxSessionDuration set for this role.")
+	}
+
+	if req.ExternalID != "" && (len(req.ExternalID) < 2 || len(req.ExternalID) > 1224 || !externalIDPattern.MatchString(req.ExternalID)) {
+		return nil, validationError(req.ExternalID, "externalId", `Member must satisfy regular expression pattern: [\w+=,.@:\/-]*`)
+	}
+	if role, ok := s.roles[req.RoleArn]; ok && role.ExternalID != "" && role.ExternalID != req.ExternalID {
+		return nil, common.Errorf("AccessDenied", "User: %v is not authorized to perform: sts:AssumeRole on resource: %v", caller.Arn, req.RoleArn)
+	}
+
+	if err := checkMFA(req.SerialNumber, req.TokenCode); err != nil {
+		return nil, err
+	}
+
+	sourceIdentity := req.SourceIdentity
+	if sourceIdentity != "" && !sessionNamePattern.MatchString(sourceIdentity) {
+		return nil, validationError(sourceIdentity, "sourceIdentity", `Member must satisfy regular expression pattern: [\w+=,.@-]*`)
+	}
+	if caller.SourceIdentity != "" {
+		if sourceIdentity != "" && sourceIdentity != caller.SourceIdentity {
+			return nil, common.Errorf("AccessDenied", "The source identity of a role session can't be changed.")
+		}
+		sourceIdentity = caller.SourceIdentity
+	}
+
+	tags, transitive, err := sessionTags(caller, req.Tags, req.TransitiveTagKeys)
+	if err != nil {
+		return nil, err
+	}
+	packed, err := packedPolicySize(req.Policy, req.PolicyArns, tags)
+	if err != nil {
+		return nil, err
+	}
+
+	principal.SessionTags = tags
+	principal.TransitiveTagKeys = transitive
+	principal.SourceIdentity = sourceIdentity
+
+	return &AssumeRoleResult{
+		AssumedRoleUser:  user,
+		Credentials:      s.issue(principal, d),
+		PackedPolicySize: packed,
+		SourceIdentity:   sourceIdentity,
+	}, nil
+}
+
+func (s *sts) AssumeRoleWithWebIdentity(req *AssumeRoleWithWebIdentityRequest) (*AssumeRoleWithWebIdentityResult, error) {
+	principal, user, err := roleSession(req.RoleArn, req.RoleSessionName)
+	if err != nil {
+		return nil, err
+	}
+
+	d, err := duration(req.DurationSeconds, defaultRoleDuration, maxRoleDuration)
+	if err != nil {
+		return nil, err
+	}
+	if int(d/time.Second) > s.maxDuration(nil, req.RoleArn) {
+		return nil, common.Errorf("ValidationError", "The requested DurationSeconds exceeds the MaxSessionDuration set for this role.")
+	}
+
+	if len(req.WebIdentityToken) < 4 || len(req.WebIdentityToken) > 20000 {
+		return nil, validationError("***", "webIdentityToken", "Member must have length between 4 and 20000")
+	}
+	token, err := s.verifyToken(req.WebIdentityToken)
+	if err != nil {
+		return nil, err
+	}
+
+	tags := []Tag{}
+	for key, value := range token.tags {
+		tags = append(tags, Tag{Key: key, Value: value})
+	}
+	sessionTags, transitive, err := sessionTags(nil, tags, token.transitiveTagKeys)
+	if err != nil {
+		return nil, common.Errorf("InvalidIdentityToken", "%v", err.(common.Error).Message)
+	}
+	packed, err := packedPolicySize(req.Policy, req.PolicyArns, sessionTags)
+	if err != nil {
+		return nil, err
+	}
+
+	principal.SessionTags = sessionTags
+	principal.TransitiveTagKeys = transitive
+
+	return &AssumeRoleWithWebIdentityResult{
+		AssumedRoleUser:             user,
+		Audience:                    token.audience,
+		Credentials:                 s.issue(principal, d),
+		PackedPolicySize:            packed,
+		Provider:                    hostOf(token.issuer.URL),
+		SubjectFromWebIdentityToken: token.subject,
+	}, nil
+}
+
+//
+// Sessions.
+//
+
+func (s *sts) GetSessionToken(caller *identity.Principal, req *GetSessionTokenRequest) (*GetSessionTokenResult, error) {
+	if caller.Type == identity.TypeAssumedRole {
+		return nil, common.Errorf("AccessDenied", "Cannot call GetSessionToken with session credentials")
+	}
+
+	def, max := defaultTokenDuration, maxTokenDuration
+	if caller.Type == identity.TypeRoot {
+		def, max = maxRootTokenDuration, maxRootTokenDuration
+	}
+	d, err := duration(req.DurationSeconds, def, max)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkMFA(req.SerialNumber, req.TokenCode); err != nil {
+		return nil, err
+	}
+
+	principal := *caller
+	return &GetSessionTokenResult{
+		Credentials: s.issue(&principal, d),
+	}, nil
+}
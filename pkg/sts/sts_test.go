@@ -0,0 +1,350 @@
+package sts_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/fernomac/aws-local/pkg/common"
+	"github.com/fernomac/aws-local/pkg/identity"
+	"github.com/fernomac/aws-local/pkg/sts"
+)
+
+// testClock is a clock the tests move by hand.
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	return c.now
+}
+
+func code(err error) string {
+	if ce, ok := err.(common.Error); ok {
+		return ce.Code
+	}
+	if err != nil {
+		return err.Error()
+	}
+	return ""
+}
+
+const (
+	roleArn       = "arn:aws:iam::000000000000:role/open"
+	externalArn   = "arn:aws:iam::000000000000:role/partner"
+	shortRoleArn  = "arn:aws:iam::000000000000:role/short"
+	issuerURL     = "https://oidc.example.com"
+	clientID      = "my-app"
+	iamUserArn    = "arn:aws:iam::000000000000:user/alice"
+	iamUserUserID = "AIDAALICE"
+)
+
+func newTestSTS(opts ...sts.Option) (sts.STS, *identity.Registry, *testClock) {
+	clock := &testClock{now: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)}
+	registry := identity.NewRegistry(clock)
+	opts = append([]sts.Option{
+		sts.WithClock(clock),
+		sts.WithRole(sts.Role{Arn: externalArn, ExternalID: "partner-123"}),
+		sts.WithRole(sts.Role{Arn: shortRoleArn, MaxSessionDuration: 7200}),
+	}, opts...)
+	return sts.New(registry, opts...), registry, clock
+}
+
+func iamUser() *identity.Principal {
+	return &identity.Principal{Type: identity.TypeIAMUser, AccountID: common.AccountID, Arn: iamUserArn, UserID: iamUserUserID}
+}
+
+// session looks up the principal that credentials were issued to.
+func session(t *testing.T, registry *identity.Registry, creds *sts.Credentials) *identity.Principal {
+	p, err := registry.Lookup(creds.AccessKeyID)
+	if err != nil || p == nil {
+		t.Fatalf("credentials %v: %v, %v", creds.AccessKeyID, p, err)
+	}
+	return p
+}
+
+func TestExternalID(t *testing.T) {
+	s, _, _ := newTestSTS()
+	tests := []struct {
+		role       string
+		externalID string
+		code       string
+	}{
+		{externalArn, "partner-123", ""},
+		{externalArn, "", "AccessDenied"},
+		{externalArn, "partner-456", "AccessDenied"},
+		{roleArn, "", ""},
+		{roleArn, "anything", ""},
+		{roleArn, "x", "ValidationError"},
+		{roleArn, "has space", "ValidationError"},
+	}
+
+	for _, test := range tests {
+		_, err := s.AssumeRole(identity.Root(), &sts.AssumeRoleRequest{RoleArn: test.role, RoleSessionName: "session", ExternalID: test.externalID})
+		if err == nil && test.code == "" {
+			continue
+		}
+		if got := code(err); got != test.code {
+			t.Errorf("%v with %q: got %v, want %v", test.role, test.externalID, got, test.code)
+		}
+	}
+}
+
+func TestDurations(t *testing.T) {
+	s, registry, clock := newTestSTS()
+	chained, err := s.AssumeRole(identity.Root(), &sts.AssumeRoleRequest{RoleArn: roleArn, RoleSessionName: "first"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	roleSession := session(t, registry, chained.Credentials)
+
+	assume := func(caller *identity.Principal, role string) func(int) (*sts.Credentials, error) {
+		return func(seconds int) (*sts.Credentials, error) {
+			out, err := s.AssumeRole(caller, &sts.AssumeRoleRequest{RoleArn: role, RoleSessionName: "session", DurationSeconds: seconds})
+			if err != nil {
+				return nil, err
+			}
+			return out.Credentials, nil
+		}
+	}
+	token := func(caller *identity.Principal) func(int) (*sts.Credentials, error) {
+		return func(seconds int) (*sts.Credentials, error) {
+			out, err := s.GetSessionToken(caller, &sts.GetSessionTokenRequest{DurationSeconds: seconds})
+			if err != nil {
+				return nil, err
+			}
+			return out.Credentials, nil
+		}
+	}
+
+	tests := []struct {
+		name    string
+		do      func(int) (*sts.Credentials, error)
+		seconds int
+		want    time.Duration
+		code    string
+	}{
+		{"role default", assume(identity.Root(), roleArn), 0, time.Hour, ""},
+		{"role minimum", assume(identity.Root(), roleArn), 900, 15 * time.Minute, ""},
+		{"role too short", assume(identity.Root(), roleArn), 899, 0, "ValidationError"},
+		{"role maximum", assume(identity.Root(), roleArn), 43200, 12 * time.Hour, ""},
+		{"role too long", assume(identity.Root(), roleArn), 43201, 0, "ValidationError"},
+		{"configured maximum", assume(identity.Root(), shortRoleArn), 7200, 2 * time.Hour, ""},
+		{"past configured maximum", assume(identity.Root(), shortRoleArn), 7201, 0, "ValidationError"},
+		{"chained maximum", assume(roleSession, roleArn), 3600, time.Hour, ""},
+		{"chained too long", assume(roleSession, roleArn), 3601, 0, "ValidationError"},
+		{"user token default", token(iamUser()), 0, 12 * time.Hour, ""},
+		{"user token maximum", token(iamUser()), 129600, 36 * time.Hour, ""},
+		{"user token too long", token(iamUser()), 129601, 0, "ValidationError"},
+		{"root token default", token(identity.Root()), 0, time.Hour, ""},
+		{"root token too long", token(identity.Root()), 3601, 0, "ValidationError"},
+		{"session token from role", token(roleSession), 0, 0, "AccessDenied"},
+	}
+
+	for _, test := range tests {
+		creds, err := test.do(test.seconds)
+		if got := code(err); got != test.code {
+			t.Errorf("%v: got %v, want %v", test.name, got, test.code)
+			continue
+		}
+		if err == nil && !creds.Expiration.Equal(clock.now.Add(test.want)) {
+			t.Errorf("%v: expires %v, want %v", test.name, creds.Expiration, clock.now.Add(test.want))
+		}
+	}
+}
+
+func TestCredentialsExpire(t *testing.T) {
+	s, registry, clock := newTestSTS()
+	out, err := s.GetSessionToken(iamUser(), &sts.GetSessionTokenRequest{DurationSeconds: 900})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := session(t, registry, out.Credentials)
+	if p.Arn != iamUserArn || p.UserID != iamUserUserID {
+		t.Errorf("session token belongs to %+v", p)
+	}
+
+	clock.now = clock.now.Add(15*time.Minute + time.Second)
+	if _, err := registry.Lookup(out.Credentials.AccessKeyID); code(err) != "ExpiredToken" {
+		t.Errorf("got %v, want ExpiredToken", err)
+	}
+}
+
+func TestTransitiveTags(t *testing.T) {
+	s, registry, _ := newTestSTS()
+	first, err := s.AssumeRole(identity.Root(), &sts.AssumeRoleRequest{
+		RoleArn:           roleArn,
+		RoleSessionName:   "first",
+		Tags:              []sts.Tag{{Key: "team", Value: "web"}, {Key: "project", Value: "x"}},
+		TransitiveTagKeys: []string{"team"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	caller := session(t, registry, first.Credentials)
+
+	tests := []struct {
+		name       string
+		tags       []sts.Tag
+		transitive []string
+		want       map[string]string
+		code       string
+	}{
+		{"inherited", nil, nil, map[string]string{"team": "web"}, ""},
+		{"added", []sts.Tag{{Key: "env", Value: "dev"}}, nil, map[string]string{"team": "web", "env": "dev"}, ""},
+		{"override", []sts.Tag{{Key: "team", Value: "ops"}}, nil, nil, "InvalidParameterValue"},
+		{"override other case", []sts.Tag{{Key: "TEAM", Value: "ops"}}, nil, nil, "InvalidParameterValue"},
+		{"transitive not a tag", []sts.Tag{{Key: "env", Value: "dev"}}, []string{"owner"}, nil, "InvalidParameterValue"},
+		{"duplicate keys", []sts.Tag{{Key: "env", Value: "a"}, {Key: "Env", Value: "b"}}, nil, nil, "InvalidParameterValue"},
+		{"aws: prefix", []sts.Tag{{Key: "aws:env", Value: "a"}}, nil, nil, "InvalidParameterValue"},
+	}
+
+	for _, test := range tests {
+		out, err := s.AssumeRole(caller, &sts.AssumeRoleRequest{RoleArn: roleArn, RoleSessionName: "second", Tags: test.tags, TransitiveTagKeys: test.transitive})
+		if got := code(err); got != test.code {
+			t.Errorf("%v: got %v, want %v", test.name, got, test.code)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		p := session(t, registry, out.Credentials)
+		if !reflect.DeepEqual(p.SessionTags, test.want) {
+			t.Errorf("%v: got tags %v, want %v", test.name, p.SessionTags, test.want)
+		}
+		if !reflect.DeepEqual(p.TransitiveTagKeys, []string{"team"}) {
+			t.Errorf("%v: got transitive keys %v", test.name, p.TransitiveTagKeys)
+		}
+	}
+
+	// Transitive tags carry on down the chain.
+	second, err := s.AssumeRole(caller, &sts.AssumeRoleRequest{RoleArn: roleArn, RoleSessionName: "second"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	third, err := s.AssumeRole(session(t, registry, second.Credentials), &sts.AssumeRoleRequest{RoleArn: roleArn, RoleSessionName: "third"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := session(t, registry, third.Credentials).SessionTags; !reflect.DeepEqual(got, map[string]string{"team": "web"}) {
+		t.Errorf("third session has tags %v", got)
+	}
+}
+
+// signToken makes an ES256 JWT with the given claims.
+func signToken(t *testing.T, key *ecdsa.PrivateKey, claims map[string]interface{}) string {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"ES256","typ":"JWT"}`))
+	body, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := header + "." + base64.RawURLEncoding.EncodeToString(body)
+
+	digest := sha256.Sum256([]byte(signed))
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestWebIdentity(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, registry, clock := newTestSTS(sts.WithIssuer(sts.Issuer{URL: issuerURL, ClientIDs: []string{clientID}, Keys: []crypto.PublicKey{&key.PublicKey}}))
+	now := clock.now.Unix()
+
+	claims := func(change func(map[string]interface{})) map[string]interface{} {
+		c := map[string]interface{}{"iss": issuerURL, "sub": "user-1", "aud": clientID, "exp": now + 600}
+		change(c)
+		return c
+	}
+	same := func(map[string]interface{}) {}
+
+	tests := []struct {
+		name   string
+		key    *ecdsa.PrivateKey
+		claims map[string]interface{}
+		code   string
+	}{
+		{"valid", key, claims(same), ""},
+		{"issuer with slash", key, claims(func(c map[string]interface{}) { c["iss"] = issuerURL + "/" }), ""},
+		{"audience list", key, claims(func(c map[string]interface{}) { c["aud"] = []string{"other", clientID} }), ""},
+		{"unknown issuer", key, claims(func(c map[string]interface{}) { c["iss"] = "https://evil.example.com" }), "InvalidIdentityToken"},
+		{"wrong audience", key, claims(func(c map[string]interface{}) { c["aud"] = "other" }), "InvalidIdentityToken"},
+		{"wrong key", other, claims(same), "InvalidIdentityToken"},
+		{"expired", key, claims(func(c map[string]interface{}) { c["exp"] = now }), "ExpiredTokenException"},
+		{"no expiry", key, claims(func(c map[string]interface{}) { delete(c, "exp") }), "ExpiredTokenException"},
+		{"not yet valid", key, claims(func(c map[string]interface{}) { c["nbf"] = now + 60 }), "InvalidIdentityToken"},
+		{"no subject", key, claims(func(c map[string]interface{}) { delete(c, "sub") }), "InvalidIdentityToken"},
+		{"two tag values", key, claims(func(c map[string]interface{}) {
+			c["https://aws.amazon.com/tags"] = map[string]interface{}{"principal_tags": map[string][]string{"team": {"a", "b"}}}
+		}), "InvalidIdentityToken"},
+	}
+
+	for _, test := range tests {
+		out, err := s.AssumeRoleWithWebIdentity(&sts.AssumeRoleWithWebIdentityRequest{
+			RoleArn:          roleArn,
+			RoleSessionName:  "web",
+			WebIdentityToken: signToken(t, test.key, test.claims),
+		})
+		if got := code(err); got != test.code {
+			t.Errorf("%v: got %v, want %v", test.name, got, test.code)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if out.Provider != "oidc.example.com" || out.Audience != clientID || out.SubjectFromWebIdentityToken != "user-1" {
+			t.Errorf("%v: got %+v", test.name, out)
+		}
+	}
+
+	for _, token := range []string{"a.b", "a.b.c", "not a token at all"} {
+		_, err := s.AssumeRoleWithWebIdentity(&sts.AssumeRoleWithWebIdentityRequest{RoleArn: roleArn, RoleSessionName: "web", WebIdentityToken: token})
+		if got := code(err); got != "InvalidIdentityToken" && got != "ValidationError" {
+			t.Errorf("%q: got %v", token, got)
+		}
+	}
+
+	// Session tags in the token become transitive session tags.
+	out, err := s.AssumeRoleWithWebIdentity(&sts.AssumeRoleWithWebIdentityRequest{
+		RoleArn:         roleArn,
+		RoleSessionName: "web",
+		WebIdentityToken: signToken(t, key, claims(func(c map[string]interface{}) {
+			c["https://aws.amazon.com/tags"] = map[string]interface{}{
+				"principal_tags":      map[string][]string{"team": {"web"}, "env": {"dev"}},
+				"transitive_tag_keys": []string{"team"},
+			}
+		})),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := session(t, registry, out.Credentials)
+	if want := map[string]string{"team": "web", "env": "dev"}; !reflect.DeepEqual(p.SessionTags, want) {
+		t.Errorf("got tags %v, want %v", p.SessionTags, want)
+	}
+	keys := append([]string(nil), p.TransitiveTagKeys...)
+	sort.Strings(keys)
+	if !reflect.DeepEqual(keys, []string{"team"}) {
+		t.Errorf("got transitive keys %v", keys)
+	}
+}
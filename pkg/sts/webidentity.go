@@ -0,0 +1,242 @@
+package sts
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/fernomac/aws-local/pkg/common"
+)
+
+// Issuer is an OpenID Connect identity provider whose tokens
+// AssumeRoleWithWebIdentity accepts.
+type Issuer struct {
+	// URL is the issuer URL tokens carry in their iss claim, e.g.
+	// https://oidc.example.com.
+	URL string
+	// ClientIDs are the audiences tokens may be issued for.
+	ClientIDs []string
+	// Keys are the public keys tokens may be signed with: RSA or ECDSA.
+	Keys []crypto.PublicKey
+}
+
+// ParsePublicKeys reads the public keys out of PEM encoded public keys and
+// certificates.
+func ParsePublicKeys(data []byte) ([]crypto.PublicKey, error) {
+	keys := []crypto.PublicKey{}
+	for {
+		block, rest := pem.Decode(data)
+		if block == nil {
+			break
+		}
+		data = rest
+
+		switch block.Type {
+		case "PUBLIC KEY":
+			key, err := x509.ParsePKIXPublicKey(block.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, key)
+		case "CERTIFICATE":
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, cert.PublicKey)
+		}
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no public keys found")
+	}
+	return keys, nil
+}
+
+// hostOf strips the scheme and any trailing slash from an issuer URL, which
+// is how AWS compares them and how it reports the provider.
+func hostOf(url string) string {
+	url = strings.TrimPrefix(url, "https://")
+	return strings.TrimSuffix(url, "/")
+}
+
+// audience is the aud claim, which may be a string or a list of them.
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	single := ""
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	many := []string{}
+	if err := json.Unmarshal(data, &many); err != nil {
+		return err
+	}
+	*a = audience(many)
+	return nil
+}
+
+// webToken is a verified web identity token.
+type webToken struct {
+	issuer            *Issuer
+	subject           string
+	audience          string
+	tags              map[string]string
+	transitiveTagKeys []string
+}
+
+type tokenHeader struct {
+	Alg string `json:"alg"`
+}
+
+type tokenClaims struct {
+	Iss  string   `json:"iss"`
+	Sub  string   `json:"sub"`
+	Aud  audience `json:"aud"`
+	Exp  *int64   `json:"exp"`
+	Nbf  *int64   `json:"nbf"`
+	Tags *struct {
+		PrincipalTags     map[string][]string `json:"principal_tags"`
+		TransitiveTagKeys []string            `json:"transitive_tag_keys"`
+	} `json:"https://aws.amazon.com/tags"`
+}
+
+func invalidToken(message string) error {
+	return common.Errorf("InvalidIdentityToken", "%v", message)
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// verifySignature checks a JWS signature over signed with any of the keys.
+func verifySignature(alg string, keys []crypto.PublicKey, signed string, sig []byte) bool {
+	var hash crypto.Hash
+	switch alg[2:] {
+	case "256":
+		hash = crypto.SHA256
+	case "384":
+		hash = crypto.SHA384
+	case "512":
+		hash = crypto.SHA512
+	default:
+		return false
+	}
+	h := hash.New()
+	h.Write([]byte(signed))
+	digest := h.Sum(nil)
+
+	for _, key := range keys {
+		switch pub := key.(type) {
+		case *rsa.PublicKey:
+			switch alg[:2] {
+			case "RS":
+				if rsa.VerifyPKCS1v15(pub, hash, digest, sig) == nil {
+					return true
+				}
+			case "PS":
+				if rsa.VerifyPSS(pub, hash, digest, sig, nil) == nil {
+					return true
+				}
+			}
+		case *ecdsa.PublicKey:
+			size := (pub.Curve.Params().BitSize + 7) / 8
+			if alg[:2] == "ES" && len(sig) == 2*size {
+				r := new(big.Int).SetBytes(sig[:size])
+				s := new(big.Int).SetBytes(sig[size:])
+				if ecdsa.Verify(pub, digest, r, s) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// verifyToken checks a web identity token was issued by a configured issuer
+// for one of its clients, and hasn't expired.
+func (s *sts) verifyToken(token string) (*webToken, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, invalidToken("Couldn't parse the web identity token.")
+	}
+
+	header := tokenHeader{}
+	claims := tokenClaims{}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, invalidToken("Couldn't parse the web identity token.")
+	}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, invalidToken("Couldn't parse the web identity token.")
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || len(header.Alg) != 5 {
+		return nil, invalidToken("Couldn't parse the web identity token.")
+	}
+
+	var issuer *Issuer
+	for _, i := range s.issuers {
+		if hostOf(i.URL) == hostOf(claims.Iss) {
+			issuer = i
+		}
+	}
+	if issuer == nil {
+		return nil, invalidToken("No OpenIDConnect provider found in your account for " + claims.Iss)
+	}
+
+	if !verifySignature(header.Alg, issuer.Keys, parts[0]+"."+parts[1], sig) {
+		return nil, invalidToken("The web identity token signature could not be verified.")
+	}
+
+	aud := ""
+	for _, a := range claims.Aud {
+		for _, id := range issuer.ClientIDs {
+			if a == id {
+				aud = a
+			}
+		}
+	}
+	if aud == "" {
+		return nil, invalidToken("Incorrect token audience")
+	}
+
+	now := s.clock.Now()
+	if claims.Exp == nil || !now.Before(time.Unix(*claims.Exp, 0)) {
+		return nil, common.Errorf("ExpiredTokenException", "Token expired: current date/time %v must be before the expiration date/time", now.UTC().Format(time.RFC3339))
+	}
+	if claims.Nbf != nil && now.Before(time.Unix(*claims.Nbf, 0)) {
+		return nil, invalidToken("The web identity token is not yet valid.")
+	}
+	if claims.Sub == "" {
+		return nil, invalidToken("The web identity token has no subject.")
+	}
+
+	out := &webToken{
+		issuer:   issuer,
+		subject:  claims.Sub,
+		audience: aud,
+	}
+	if claims.Tags != nil {
+		out.tags = map[string]string{}
+		for key, values := range claims.Tags.PrincipalTags {
+			if len(values) != 1 {
+				return nil, invalidToken("Session tags in the web identity token must have exactly one value.")
+			}
+			out.tags[key] = values[0]
+		}
+		out.transitiveTagKeys = claims.Tags.TransitiveTagKeys
+	}
+	return out, nil
+}
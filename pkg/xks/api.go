@@ -0,0 +1,114 @@
+// Package xks implements the AWS KMS External Key Store (XKS) proxy API: a
+// client that KMS uses to talk to a proxy, and a stub proxy to test against.
+package xks
+
+import "fmt"
+
+// Service is the SigV4 service name that XKS requests are signed with.
+const Service = "kms-xks-proxy"
+
+// RequestMetadata describes the KMS request that caused an XKS call.
+type RequestMetadata struct {
+	AWSPrincipalArn string `json:"awsPrincipalArn"`
+	KMSKeyArn       string `json:"kmsKeyArn,omitempty"`
+	KMSOperation    string `json:"kmsOperation"`
+	KMSRequestID    string `json:"kmsRequestId"`
+}
+
+// HealthRequest is a request to GetHealthStatus.
+type HealthRequest struct {
+	RequestMetadata RequestMetadata `json:"requestMetadata"`
+}
+
+// EKMFleetDetails describes one external key manager.
+type EKMFleetDetails struct {
+	ID           string `json:"id"`
+	Model        string `json:"model"`
+	HealthStatus string `json:"healthStatus"`
+}
+
+// HealthResponse is the result of GetHealthStatus.
+type HealthResponse struct {
+	XksProxyFleetSize int               `json:"xksProxyFleetSize"`
+	XksProxyVendor    string            `json:"xksProxyVendor"`
+	XksProxyModel     string            `json:"xksProxyModel"`
+	EKMVendor         string            `json:"ekmVendor"`
+	EKMFleetDetails   []EKMFleetDetails `json:"ekmFleetDetails"`
+}
+
+// MetadataRequest is a request to GetKeyMetadata.
+type MetadataRequest struct {
+	RequestMetadata RequestMetadata `json:"requestMetadata"`
+}
+
+// MetadataResponse is the result of GetKeyMetadata.
+type MetadataResponse struct {
+	KeySpec   string   `json:"keySpec"`
+	KeyUsage  []string `json:"keyUsage"`
+	KeyStatus string   `json:"keyStatus"`
+}
+
+// EncryptRequest is a request to Encrypt. Binary fields are base64-encoded
+// on the wire.
+type EncryptRequest struct {
+	RequestMetadata             RequestMetadata `json:"requestMetadata"`
+	Plaintext                   []byte          `json:"plaintext"`
+	EncryptionAlgorithm         string          `json:"encryptionAlgorithm"`
+	AdditionalAuthenticatedData []byte          `json:"additionalAuthenticatedData,omitempty"`
+}
+
+// EncryptResponse is the result of Encrypt.
+type EncryptResponse struct {
+	Ciphertext           []byte `json:"ciphertext"`
+	InitializationVector []byte `json:"initializationVector"`
+	AuthenticationTag    []byte `json:"authenticationTag"`
+}
+
+// DecryptRequest is a request to Decrypt.
+type DecryptRequest struct {
+	RequestMetadata             RequestMetadata `json:"requestMetadata"`
+	Ciphertext                  []byte          `json:"ciphertext"`
+	EncryptionAlgorithm         string          `json:"encryptionAlgorithm"`
+	InitializationVector        []byte          `json:"initializationVector"`
+	AuthenticationTag           []byte          `json:"authenticationTag"`
+	AdditionalAuthenticatedData []byte          `json:"additionalAuthenticatedData,omitempty"`
+}
+
+// DecryptResponse is the result of Decrypt.
+type DecryptResponse struct {
+	Plaintext []byte `json:"plaintext"`
+}
+
+// Error is an error returned by a proxy.
+type Error struct {
+	Status  int    `json:"-"`
+	Name    string `json:"errorName"`
+	Message string `json:"errorMessage,omitempty"`
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("xks: %v (%v)", e.Name, e.Status)
+	}
+	return fmt.Sprintf("xks: %v (%v): %v", e.Name, e.Status, e.Message)
+}
+
+// Errors a proxy can return, with their HTTP statuses.
+var (
+	ErrValidation           = &Error{Status: 400, Name: "ValidationException"}
+	ErrInvalidState         = &Error{Status: 400, Name: "InvalidStateException"}
+	ErrInvalidCiphertext    = &Error{Status: 400, Name: "InvalidCiphertextException"}
+	ErrInvalidKeyUsage      = &Error{Status: 400, Name: "InvalidKeyUsageException"}
+	ErrAuthenticationFailed = &Error{Status: 401, Name: "AuthenticationFailedException"}
+	ErrAccessDenied         = &Error{Status: 403, Name: "AccessDeniedException"}
+	ErrKeyNotFound          = &Error{Status: 404, Name: "KeyNotFoundException"}
+	ErrInvalidURIPath       = &Error{Status: 404, Name: "InvalidUriPathException"}
+	ErrUnsupportedOperation = &Error{Status: 501, Name: "UnsupportedOperationException"}
+	ErrInternal             = &Error{Status: 500, Name: "InternalException"}
+)
+
+// Is reports whether err is a proxy error with the same name as target.
+func Is(err error, target *Error) bool {
+	e, ok := err.(*Error)
+	return ok && e.Name == target.Name
+}
@@ -0,0 +1,123 @@
+package xks
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/fernomac/aws-local/pkg/sigv4"
+)
+
+// ErrInvalidResponse is returned when a proxy's response can't be understood.
+var ErrInvalidResponse = errors.New("xks: invalid response from proxy")
+
+// Client talks to an XKS proxy.
+type Client struct {
+	endpoint string
+	path     string
+	region   string
+	creds    sigv4.Credentials
+	http     *http.Client
+}
+
+// NewClient creates a client for the proxy at the given endpoint (e.g.
+// https://xks.example.com) and URI path prefix (e.g. /example/kms/xks/v1),
+// signing requests with the given credentials.
+func NewClient(endpoint string, path string, creds sigv4.Credentials) *Client {
+	return &Client{
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		path:     strings.TrimSuffix(path, "/"),
+		region:   "us-local-1",
+		creds:    creds,
+		http:     &http.Client{Timeout: 250 * time.Millisecond},
+	}
+}
+
+// SetTimeout sets how long to wait for each call; KMS itself gives up after
+// 250ms.
+func (c *Client) SetTimeout(d time.Duration) {
+	c.http.Timeout = d
+}
+
+func (c *Client) call(suffix string, in interface{}, out interface{}) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", c.endpoint+c.path+suffix, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	sigv4.Sign(req, body, c.creds, c.region, Service, time.Now())
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		e := &Error{}
+		if err := json.Unmarshal(data, e); err != nil || e.Name == "" {
+			return ErrInvalidResponse
+		}
+		e.Status = resp.StatusCode
+		return e
+	}
+
+	if err := json.Unmarshal(data, out); err != nil {
+		return ErrInvalidResponse
+	}
+	return nil
+}
+
+// Health calls GetHealthStatus.
+func (c *Client) Health(req *HealthRequest) (*HealthResponse, error) {
+	out := &HealthResponse{}
+	if err := c.call("/health", req, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Metadata calls GetKeyMetadata for the given external key.
+func (c *Client) Metadata(keyID string, req *MetadataRequest) (*MetadataResponse, error) {
+	out := &MetadataResponse{}
+	if err := c.call("/keys/"+url.PathEscape(keyID)+"/metadata", req, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Encrypt calls Encrypt with the given external key.
+func (c *Client) Encrypt(keyID string, req *EncryptRequest) (*EncryptResponse, error) {
+	out := &EncryptResponse{}
+	if err := c.call("/keys/"+url.PathEscape(keyID)+"/encrypt", req, out); err != nil {
+		return nil, err
+	}
+	if len(out.InitializationVector) == 0 || len(out.AuthenticationTag) == 0 {
+		return nil, ErrInvalidResponse
+	}
+	return out, nil
+}
+
+// Decrypt calls Decrypt with the given external key.
+func (c *Client) Decrypt(keyID string, req *DecryptRequest) (*DecryptResponse, error) {
+	out := &DecryptResponse{}
+	if err := c.call("/keys/"+url.PathEscape(keyID)+"/decrypt", req, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,247 @@
+package xks
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fernomac/aws-local/pkg/sigv4"
+)
+
+// stubKey is a key held by the stub proxy.
+type stubKey struct {
+	aead   cipher.AEAD
+	status string
+}
+
+// Stub is an in-memory XKS proxy for tests. It serves the XKS API under any
+// URI path prefix ending in /kms/xks/v1, and can be told to misbehave.
+type Stub struct {
+	lock    sync.Mutex
+	creds   sigv4.Credentials
+	keys    map[string]*stubKey
+	fault   *Error
+	latency time.Duration
+}
+
+// NewStub creates a stub proxy that accepts requests signed with the given
+// credentials.
+func NewStub(creds sigv4.Credentials) *Stub {
+	return &Stub{
+		creds: creds,
+		keys:  make(map[string]*stubKey),
+	}
+}
+
+// AddKey creates a new AES-256 key with the given ID.
+func (s *Stub) AddKey(id string) error {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return err
+	}
+	block, err := aes.NewCipher(raw)
+	if err != nil {
+		return err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.keys[id] = &stubKey{aead: aead, status: "ENABLED"}
+	return nil
+}
+
+// SetKeyStatus sets a key's status to ENABLED or DISABLED.
+func (s *Stub) SetKeyStatus(id string, status string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	key, ok := s.keys[id]
+	if !ok {
+		return ErrKeyNotFound
+	}
+	key.status = status
+	return nil
+}
+
+// Fail makes every subsequent request fail with the given error, or stops
+// failing if err is nil.
+func (s *Stub) Fail(err *Error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.fault = err
+}
+
+// SetLatency delays every subsequent response by d.
+func (s *Stub) SetLatency(d time.Duration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.latency = d
+}
+
+// SetCredentials changes the credentials the stub accepts.
+func (s *Stub) SetCredentials(creds sigv4.Credentials) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.creds = creds
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, err *Error) {
+	writeJSON(w, err.Status, err)
+}
+
+func (s *Stub) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	s.lock.Lock()
+	creds, fault, latency := s.creds, s.fault, s.latency
+	s.lock.Unlock()
+
+	time.Sleep(latency)
+
+	if req.Method != "POST" {
+		writeError(w, ErrValidation)
+		return
+	}
+
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		writeError(w, ErrValidation)
+		return
+	}
+
+	secret := func(accessKeyID string) (string, bool) {
+		return creds.SecretAccessKey, accessKeyID == creds.AccessKeyID
+	}
+	auth, err := sigv4.Verify(req, body, secret, time.Now())
+	if err != nil || auth.Service != Service {
+		writeError(w, ErrAuthenticationFailed)
+		return
+	}
+
+	if fault != nil {
+		writeError(w, fault)
+		return
+	}
+
+	i := strings.Index(req.URL.Path, "/kms/xks/v1/")
+	if i < 0 {
+		writeError(w, ErrInvalidURIPath)
+		return
+	}
+	route := strings.Split(req.URL.Path[i+len("/kms/xks/v1/"):], "/")
+
+	if len(route) == 1 && route[0] == "health" {
+		s.health(w)
+		return
+	}
+	if len(route) != 3 || route[0] != "keys" {
+		writeError(w, ErrInvalidURIPath)
+		return
+	}
+
+	s.lock.Lock()
+	key, ok := s.keys[route[1]]
+	status := ""
+	if ok {
+		status = key.status
+	}
+	s.lock.Unlock()
+
+	if !ok {
+		writeError(w, ErrKeyNotFound)
+		return
+	}
+
+	switch route[2] {
+	case "metadata":
+		writeJSON(w, http.StatusOK, &MetadataResponse{
+			KeySpec:   "AES_256",
+			KeyUsage:  []string{"ENCRYPT", "DECRYPT"},
+			KeyStatus: status,
+		})
+	case "encrypt":
+		if status != "ENABLED" {
+			writeError(w, ErrInvalidState)
+			return
+		}
+		in := EncryptRequest{}
+		if err := json.Unmarshal(body, &in); err != nil || in.EncryptionAlgorithm != "AES_GCM" {
+			writeError(w, ErrValidation)
+			return
+		}
+		s.encrypt(w, key, &in)
+	case "decrypt":
+		if status != "ENABLED" {
+			writeError(w, ErrInvalidState)
+			return
+		}
+		in := DecryptRequest{}
+		if err := json.Unmarshal(body, &in); err != nil || in.EncryptionAlgorithm != "AES_GCM" {
+			writeError(w, ErrValidation)
+			return
+		}
+		s.decrypt(w, key, &in)
+	default:
+		writeError(w, ErrInvalidURIPath)
+	}
+}
+
+func (s *Stub) health(w http.ResponseWriter) {
+	writeJSON(w, http.StatusOK, &HealthResponse{
+		XksProxyFleetSize: 1,
+		XksProxyVendor:    "aws-local",
+		XksProxyModel:     "stub",
+		EKMVendor:         "aws-local",
+		EKMFleetDetails: []EKMFleetDetails{
+			{ID: "ekm-1", Model: "stub", HealthStatus: "ACTIVE"},
+		},
+	})
+}
+
+func (s *Stub) encrypt(w http.ResponseWriter, key *stubKey, in *EncryptRequest) {
+	iv := make([]byte, key.aead.NonceSize())
+	if _, err := rand.Read(iv); err != nil {
+		writeError(w, ErrInternal)
+		return
+	}
+
+	sealed := key.aead.Seal(nil, iv, in.Plaintext, in.AdditionalAuthenticatedData)
+	n := len(sealed) - key.aead.Overhead()
+
+	writeJSON(w, http.StatusOK, &EncryptResponse{
+		Ciphertext:           sealed[:n],
+		InitializationVector: iv,
+		AuthenticationTag:    sealed[n:],
+	})
+}
+
+func (s *Stub) decrypt(w http.ResponseWriter, key *stubKey, in *DecryptRequest) {
+	if len(in.InitializationVector) != key.aead.NonceSize() {
+		writeError(w, ErrInvalidCiphertext)
+		return
+	}
+
+	sealed := append(append([]byte(nil), in.Ciphertext...), in.AuthenticationTag...)
+	plaintext, err := key.aead.Open(nil, in.InitializationVector, sealed, in.AdditionalAuthenticatedData)
+	if err != nil {
+		writeError(w, ErrInvalidCiphertext)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, &DecryptResponse{Plaintext: plaintext})
+}